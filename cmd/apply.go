@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/job"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyYes           bool
+	applyForce         bool
+	applyMaxConcurrent int
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <job.yaml>",
+	Short: "Run a provisioning job on several drives",
+	Long: `Run the steps of a job manifest on every drive it targets, in parallel.
+Each drive goes through the steps in order and stops at the first that
+fails; the other drives carry on.
+
+Steps:
+  flash    Write an image (image, verify)
+  format   Format with one partition (fs, label, quick)
+  label    Set the label of the first volume (name)
+  copy     Copy a directory onto the first volume (source, dest)
+  verify   Compare with an image (image), or without one re-read the files
+           copied by earlier copy steps
+  eject    Safely eject the drive
+
+A manifest looks like:
+
+  targets:
+    ports: 1-8          # or disks: 2-9, serials: [...], all: true
+    exclude: [ABC123]
+  maxConcurrent: 4
+  steps:
+    - format: {fs: exfat, label: KIOSK}
+    - copy: ./content
+    - verify
+    - eject
+
+WARNING: jobs with a flash or format step ERASE ALL DATA on the drives!
+
+With --json, every drive's start, progress and completion and the final
+summary are streamed as NDJSON with operation "apply".`,
+	Example: `  wusbkit apply job.yaml
+  wusbkit apply job.yaml --yes --json
+  wusbkit apply job.yaml --retries 1 --report run.json --yes`,
+	Args: cobra.ExactArgs(1),
+	RunE: runApply,
+}
+
+func init() {
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Skip confirmation prompt")
+	applyCmd.Flags().BoolVar(&applyForce, "force", false, "Override safety protections (system disk, BitLocker-locked volumes)")
+	applyCmd.Flags().IntVar(&applyMaxConcurrent, "max-concurrent", 0, "Max drives worked on at once (default: the manifest's maxConcurrent, 0=unlimited)")
+	addBatchFlags(applyCmd)
+	rootCmd.AddCommand(applyCmd)
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	manifest, err := job.Load(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if manifest.Erases() && !format.IsAdmin() {
+		errMsg := "Administrator privileges required for jobs that flash or format"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	disks, err := jobDisks(manifest.Targets)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	// Check every drive before touching any
+	enum := usb.NewEnumerator()
+	var deviceNames []string
+	var problems targetProblems
+	for _, diskNum := range disks {
+		device, err := enum.GetDeviceByDiskNumber(diskNum)
+		if err != nil {
+			problems.add(output.ErrCodeUSBNotFound, fmt.Sprintf("disk %d: %v", diskNum, err))
+			continue
+		}
+		if device == nil {
+			problems.add(output.ErrCodeUSBNotFound, fmt.Sprintf("disk %d: not found or not a USB device", diskNum))
+			continue
+		}
+		if manifest.Erases() && !applyForce {
+			if err := checkDriveSafety(enum, device, ""); err != nil {
+				problems.add(output.ErrCodeInvalidInput, err.Error())
+				continue
+			}
+			if device.BitLocker == usb.BitLockerLocked {
+				problems.add(output.ErrCodeInvalidInput,
+					fmt.Sprintf("disk %d has a BitLocker-locked volume (%s)", diskNum, device.DriveLetter))
+				continue
+			}
+		}
+		deviceNames = append(deviceNames, fmt.Sprintf("%d (%s - %s)", diskNum, device.FriendlyName, device.SizeHuman))
+	}
+	if err := problems.report(len(disks)); err != nil {
+		return err
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !applyYes && !jsonOutput {
+		if manifest.Erases() {
+			pterm.Warning.Printf("This will ERASE ALL DATA on %d drives:\n", len(disks))
+		} else {
+			pterm.Info.Printf("This job runs on %d drives:\n", len(disks))
+		}
+		for i, name := range deviceNames {
+			pterm.Info.Printf("  Disk %s\n", name)
+			if manifest.Erases() {
+				printContentSummary(disks[i], "    ")
+			}
+		}
+		pterm.Info.Println("Steps:")
+		for _, line := range manifest.Describe() {
+			pterm.Info.Printf("  %s\n", line)
+		}
+
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Continue with the job?")
+
+		if !confirmed {
+			pterm.Info.Println("Job cancelled")
+			return nil
+		}
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	maxConcurrent := manifest.MaxConcurrent
+	if cmd.Flags().Changed("max-concurrent") {
+		maxConcurrent = applyMaxConcurrent
+	}
+	executor := newBatchExecutor(maxConcurrent, len(disks))
+	if !jsonOutput {
+		pterm.Info.Printf("Running %d steps on %d drives...\n", len(manifest.Steps), len(disks))
+	}
+
+	result := executor.RunAll(ctx, "apply", disks, manifest.Run)
+
+	// Output result (non-JSON mode - JSON mode streams NDJSON)
+	if !jsonOutput {
+		parallel.PrintBatchResult(result, "Provisioned")
+	}
+
+	return finishBatch(result, "provision")
+}
+
+// jobDisks resolves a manifest's targets to disk numbers, using the same
+// selection as --serial, --port, --all and --exclude.
+func jobDisks(t job.Targets) ([]int, error) {
+	var disks []int
+	if t.Disks != "" {
+		var err error
+		if disks, err = parallel.ParseDisks(t.Disks); err != nil {
+			return nil, fmt.Errorf("invalid targets.disks: %w", err)
+		}
+	}
+
+	if len(t.Serials) > 0 || t.Ports != "" || t.All {
+		targetSerials = strings.Join(t.Serials, ",")
+		targetPorts = t.Ports
+		targetAll = t.All
+		targetExclude = strings.Join(t.Exclude, ",")
+		identifier, err := resolveTarget(targetDisks, sizeRange{})
+		if err != nil {
+			return nil, err
+		}
+		selected, err := parallel.ParseDisks(identifier)
+		if err != nil {
+			return nil, err
+		}
+		disks = append(disks, selected...)
+	}
+
+	// Disks listed by number are left out by --exclude too
+	enum := usb.NewEnumerator()
+	exclude := t.Exclude
+	kept := disks[:0]
+	seen := make(map[int]bool)
+	for _, n := range disks {
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		if len(exclude) > 0 {
+			if d, err := enum.GetDeviceByDiskNumber(n); err == nil && d != nil && matchesExclude(*d, exclude) {
+				continue
+			}
+		}
+		kept = append(kept, n)
+	}
+	if len(kept) == 0 {
+		return nil, errors.New("no USB drives match the job's targets")
+	}
+	return kept, nil
+}
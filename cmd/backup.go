@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupOutput   string
+	backupHashAlgo string
+	backupNoHash   bool
+	backupBuffer   string
+	backupForce    bool
+	backupUsed     string
+	backupFormat   string
+	backupSplit    string
+	backupMap      string
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <drive>",
+	Short: "Back up a USB drive to an image file",
+	Long: `Read a USB drive into a raw image file that flash can write back.
+
+The output is compressed according to its extension:
+  .img, .bin, .raw    Uncompressed
+  .gz                 gzip
+  .zst                Zstandard
+  .xz                 xz
+
+A .vhd or .vhdx output (or --format vhd/vhdx) creates a dynamically
+expanding virtual disk instead, which can be attached in Disk Management
+or Hyper-V to inspect the drive's contents. Virtual disks can't be
+compressed and only the drive's contents are hashed.
+
+--split-size writes the image as numbered chunks (backup.img.001, .002...)
+plus an index file (backup.img.split) so it fits on FAT32 media; "fat32"
+splits at 4GB minus 1 byte. flash takes the index (or the .001 chunk) and
+reassembles the image while writing.
+
+With --used, only the used parts of the drive are read and the rest is
+stored as zeros, which compresses to nothing (uncompressed images are
+written as sparse files):
+  partitions          Partition table and partitions; MBR images end
+                      after the last partition
+  clusters            Also skip free space inside FAT, exFAT and NTFS
+                      volumes
+
+--map also writes a block map of the drive (see flash --map), so restoring
+a newer image to the same drive only writes the blocks that differ. Parts
+not read with --used are unknown to the map and are always written.
+
+The drive's volumes are locked while it is read so the image is
+consistent. A digest of the output file is written next to it
+(e.g. backup.img.gz.sha256) for use with flash --checksum-file.`,
+	Example: `  wusbkit backup E: --out backup.img
+  wusbkit backup 2 --out D:\images\pi.img.zst --used clusters
+  wusbkit backup E: --out stick.vhdx --used clusters
+  wusbkit backup 2 --out F:\pi.img.zst --split-size fat32
+  wusbkit backup E: -o backup.img.xz --hash-algo sha512 --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBackup,
+}
+
+func init() {
+	backupCmd.Flags().StringVarP(&backupOutput, "out", "o", "", "Output image path (required)")
+	backupCmd.Flags().StringVar(&backupHashAlgo, "hash-algo", "sha256", "Digest algorithm: sha256, sha512, sha1, md5, blake3, xxhash")
+	backupCmd.Flags().BoolVar(&backupNoHash, "no-hash", false, "Don't hash the image or write a checksum file")
+	backupCmd.Flags().StringVarP(&backupBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB, 16M)")
+	backupCmd.Flags().StringVar(&backupUsed, "used", "", "Only read used space: partitions, clusters")
+	backupCmd.Flags().StringVar(&backupFormat, "format", "", "Output format: raw, vhd, vhdx (default: by extension)")
+	backupCmd.Flags().StringVar(&backupSplit, "split-size", "", "Split raw output into chunks of this size (e.g., 2G, fat32)")
+	backupCmd.Flags().StringVar(&backupMap, "map", "", "Also write a block map (.wusbmap) of the drive for flash --map")
+	backupCmd.Flags().BoolVarP(&backupForce, "force", "f", false, "Overwrite an existing output file")
+	backupCmd.MarkFlagRequired("out")
+	addTargetFlags(backupCmd, targetSingle)
+	rootCmd.AddCommand(backupCmd)
+}
+
+// validateBackupFlags checks the flags and returns the buffer size in MB
+// and the chunk size in bytes (0 when not splitting).
+func validateBackupFlags() (int, int64, error) {
+	bufferMB, err := parseBufferSize(backupBuffer)
+	if err != nil {
+		return 0, 0, err
+	}
+	if bufferMB < 1 || bufferMB > 64 {
+		return 0, 0, fmt.Errorf("buffer size must be between 1 and 64 MB")
+	}
+	switch backupUsed {
+	case "", flash.BackupUsedPartitions, flash.BackupUsedClusters:
+	default:
+		return 0, 0, fmt.Errorf("invalid --used %q: use partitions or clusters", backupUsed)
+	}
+	imageFormat, err := flash.BackupFormat(backupOutput, strings.ToLower(backupFormat))
+	if err != nil {
+		return 0, 0, err
+	}
+	if imageFormat == flash.BackupFormatRaw {
+		if _, err := flash.BackupCompression(backupOutput); err != nil {
+			return 0, 0, err
+		}
+	}
+	var splitSize int64
+	if backupSplit != "" {
+		if imageFormat != flash.BackupFormatRaw {
+			return 0, 0, fmt.Errorf("--split-size can't be used with %s output", imageFormat)
+		}
+		if strings.EqualFold(backupSplit, "fat32") {
+			splitSize = flash.FAT32MaxFileSize
+		} else if splitSize, err = parseSize(backupSplit); err != nil {
+			return 0, 0, err
+		}
+		if splitSize < 1024*1024 {
+			return 0, 0, fmt.Errorf("--split-size must be at least 1M")
+		}
+	}
+	if !backupNoHash {
+		switch strings.ToLower(backupHashAlgo) {
+		case "md5", "sha1", "sha256", "sha512", "blake3", "xxhash":
+		default:
+			return 0, 0, fmt.Errorf("unsupported --hash-algo %q: use sha256, sha512, sha1, md5, blake3 or xxhash", backupHashAlgo)
+		}
+	}
+	existing := backupOutput
+	if splitSize > 0 {
+		existing += flash.SplitIndexExt
+	}
+	if _, err := os.Stat(existing); err == nil && !backupForce {
+		return 0, 0, fmt.Errorf("%s already exists (use --force to overwrite)", existing)
+	}
+	return bufferMB, splitSize, nil
+}
+
+func runBackup(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	bufferMB, splitSize, err := validateBackupFlags()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	outputPath := backupOutput
+	if absPath, err := filepath.Abs(outputPath); err == nil {
+		outputPath = absPath
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		errMsg := fmt.Sprintf("failed to create output directory: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts := flash.BackupOptions{
+		DiskNumber:  device.DiskNumber,
+		DriveLetter: device.DriveLetter,
+		OutputPath:  outputPath,
+		BufferSize:  bufferMB,
+		Used:        backupUsed,
+		Format:      strings.ToLower(backupFormat),
+		SplitSize:   splitSize,
+		BlockMap:    backupMap,
+		DiskSerial:  device.SerialNumber,
+	}
+	if !backupNoHash {
+		opts.HashAlgorithm = strings.ToLower(backupHashAlgo)
+	}
+
+	if !jsonOutput {
+		pterm.Info.Printf("Backing up disk %d (%s - %s) to %s\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman, outputPath)
+	}
+
+	backuper := flash.NewBackuper()
+	type backupDone struct {
+		result *flash.BackupResult
+		err    error
+	}
+	doneChan := make(chan backupDone, 1)
+	go func() {
+		result, err := backuper.Backup(ctx, opts)
+		doneChan <- backupDone{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range backuper.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Opening drive...")
+		for progress := range backuper.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				text := fmt.Sprintf("%s %d%% | %s / %s", progress.Stage, progress.Percentage,
+					flash.FormatBytes(progress.BytesWritten), flash.FormatBytes(progress.TotalBytes))
+				if progress.Speed != "" {
+					text += fmt.Sprintf(" | %s", progress.Speed)
+				}
+				spinner.UpdateText(text)
+			case flash.StatusError:
+				spinner.Fail(progress.Error)
+			case flash.StatusComplete:
+				spinner.Success("Backup complete!")
+			}
+		}
+	}
+
+	done := <-doneChan
+	if done.err != nil {
+		if !jsonOutput && done.err != context.Canceled {
+			PrintError(done.err.Error(), output.ErrCodeInternalError)
+		}
+		return done.err
+	}
+
+	result := done.result
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+		return nil
+	}
+
+	for _, w := range result.Warnings {
+		pterm.Warning.Println(w)
+	}
+	if result.BytesRead < result.ImageSize {
+		pterm.Info.Printfln("Read %s of %s (used space only)",
+			flash.FormatBytes(result.BytesRead), flash.FormatBytes(result.ImageSize))
+	}
+	size := flash.FormatBytes(result.OutputSize)
+	if result.Compression != "" {
+		size += fmt.Sprintf(" (%s, %.0f%% of %s)", result.Compression,
+			float64(result.OutputSize)*100/float64(max(result.ImageSize, 1)), flash.FormatBytes(result.ImageSize))
+	}
+	pterm.Info.Printfln("Image: %s, %s", result.Output, size)
+	if result.Chunks > 0 {
+		pterm.Info.Printfln("Split into %d chunks", result.Chunks)
+	}
+	if result.BlockMap != "" {
+		pterm.Info.Printfln("Block map: %s", result.BlockMap)
+	}
+	if result.Hash != "" {
+		pterm.Info.Printfln("%s (drive): %s", strings.ToUpper(result.HashAlgorithm), result.Hash)
+		if result.FileHash != "" && result.FileHash != result.Hash {
+			pterm.Info.Printfln("%s (file):  %s", strings.ToUpper(result.HashAlgorithm), result.FileHash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchRetries    int
+	batchRetryDelay time.Duration
+	batchOpTimeout  time.Duration
+	batchFailFast   bool
+	batchMaxFailed  int
+	batchFailPct    int  // 0 = not set
+	batchMaxSet     bool // --max-failures was given
+	batchReport     string
+	batchCommand    string // Name of the command running, e.g. "flash"
+)
+
+// addBatchFlags registers the flags that control how a command that handles
+// several drives at once treats a drive that fails or hangs, and how many
+// failures the run tolerates. They are checked before the command runs.
+func addBatchFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&batchRetries, "retries", 0, "Retry a drive that fails up to this many times (several drives only)")
+	cmd.Flags().DurationVar(&batchRetryDelay, "retry-delay", 5*time.Second, "Wait between retries of a drive")
+	cmd.Flags().DurationVar(&batchOpTimeout, "op-timeout", 0, "Fail a drive whose attempt takes longer than this, e.g. 30m (several drives only)")
+	cmd.Flags().BoolVar(&batchFailFast, "fail-fast", false, "Abort the remaining drives as soon as the run has failed")
+	cmd.Flags().IntVar(&batchMaxFailed, "max-failures", 0, "Number of failed drives the run tolerates before it fails")
+	cmd.Flags().IntVar(&batchFailPct, "fail-on-percentage", 0, "Fail the run once this percentage of its drives failed (1-100)")
+	cmd.Flags().StringVar(&batchReport, "report", "", "Write the result of a run on several drives to this JSON file, for retry")
+
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		batchMaxSet = cmd.Flags().Changed("max-failures")
+		batchCommand = cmd.Name()
+		if err := checkBatchFlags(); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+		if batchReport != "" {
+			startBatchReport(cmd)
+		}
+		return run(cmd, args)
+	}
+}
+
+func checkBatchFlags() error {
+	if batchRetries < 0 {
+		return errors.New("--retries can't be negative")
+	}
+	if batchRetryDelay < 0 {
+		return errors.New("--retry-delay can't be negative")
+	}
+	if batchOpTimeout < 0 {
+		return errors.New("--op-timeout can't be negative")
+	}
+	if batchMaxFailed < 0 {
+		return errors.New("--max-failures can't be negative")
+	}
+	if batchFailPct < 0 || batchFailPct > 100 {
+		return errors.New("--fail-on-percentage must be between 1 and 100")
+	}
+	return nil
+}
+
+// newBatchExecutor creates the executor for a multi-disk run over total
+// drives, with the policy set by addBatchFlags.
+func newBatchExecutor(maxConcurrent, total int) *parallel.Executor {
+	executor := parallel.NewExecutor(maxConcurrent, jsonOutput)
+	executor.SetRetries(batchRetries, batchRetryDelay)
+	executor.SetOpTimeout(batchOpTimeout)
+	if batchFailFast {
+		executor.SetFailFast(allowedFailures(total))
+	}
+	return executor
+}
+
+// allowedFailures returns how many of total drives may fail without failing
+// the run: none by default, else the stricter of --max-failures and
+// --fail-on-percentage.
+func allowedFailures(total int) int {
+	if !batchMaxSet && batchFailPct == 0 {
+		return 0
+	}
+	allowed := total
+	if batchMaxSet {
+		allowed = batchMaxFailed
+	}
+	if batchFailPct > 0 {
+		// The run fails once failed/total reaches the percentage
+		byPct := int(math.Ceil(float64(batchFailPct)*float64(total)/100)) - 1
+		allowed = min(allowed, byPct)
+	}
+	return max(allowed, 0)
+}
+
+// finishBatch writes the --report file of a multi-disk run, if asked for,
+// runs the post-batch hook and returns the error the run ends with.
+func finishBatch(result parallel.BatchResult, verb string) error {
+	if batchReport != "" {
+		if err := writeBatchReport(result); err != nil && !jsonOutput {
+			pterm.Warning.Printf("Could not write report: %v\n", err)
+		}
+	}
+	runBatchHook(result)
+	return batchError(result, verb)
+}
+
+// batchError returns the error a multi-disk run ends with, verb naming the
+// operation ("flash"): nil if no more drives failed than allowed.
+func batchError(result parallel.BatchResult, verb string) error {
+	if result.Failed == 0 {
+		return nil
+	}
+	if !result.Aborted && result.Failed <= allowedFailures(result.Total) {
+		if !jsonOutput {
+			pterm.Warning.Printf("%d of %d drives failed to %s, within the allowed failures\n",
+				result.Failed, result.Total, verb)
+		}
+		return nil
+	}
+	return fmt.Errorf("%d drives failed to %s", result.Failed, verb)
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/iso"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	bootsectorMBR      string
+	bootsectorActive   int
+	bootsectorInactive bool
+	bootsectorPBR      string
+	bootsectorBootsect string
+	bootsectorForce    bool
+	bootsectorYes      bool
+)
+
+var bootsectorCmd = &cobra.Command{
+	Use:   "bootsector <drive>",
+	Short: "Show or write MBR boot code, active flags and partition boot records",
+	Long: `Show or modify the boot sectors of a USB drive, like ms-sys.
+
+Without flags the MBR is only read: the boot code is identified and the
+partition table shown with its active flags.
+
+  --mbr       Write standard MBR boot code (windows, grub2, syslinux,
+              grub4dos), keeping the partition table and disk signature
+  --active N  Mark MBR partition slot N (1-4) active and clear the others
+  --inactive  Clear all active flags
+  --pbr       Install a partition boot record on the drive's FAT32/NTFS
+              volume: bootmgr (Vista and later) or ntldr (XP). Uses
+              bootsect.exe from PATH or --bootsect`,
+	Example: `  wusbkit bootsector E:
+  wusbkit bootsector E: --mbr windows --active 1
+  wusbkit bootsector 2 --pbr bootmgr --bootsect D:\boot\bootsect.exe
+  wusbkit bootsector E: --inactive --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBootsector,
+}
+
+// bootsectorResult is the JSON result of the bootsector command.
+type bootsectorResult struct {
+	DiskNumber int          `json:"diskNumber"`
+	MBR        *iso.MBRInfo `json:"mbr"`
+	Changes    []string     `json:"changes"`
+}
+
+func init() {
+	bootsectorCmd.Flags().StringVar(&bootsectorMBR, "mbr", "", "Write MBR boot code: windows, grub2, syslinux, grub4dos")
+	bootsectorCmd.Flags().IntVar(&bootsectorActive, "active", 0, "Mark MBR partition slot (1-4) active")
+	bootsectorCmd.Flags().BoolVar(&bootsectorInactive, "inactive", false, "Clear all active flags")
+	bootsectorCmd.Flags().StringVar(&bootsectorPBR, "pbr", "", "Install partition boot record: bootmgr, ntldr")
+	bootsectorCmd.Flags().StringVar(&bootsectorBootsect, "bootsect", "", "Path to bootsect.exe (default: search PATH)")
+	bootsectorCmd.Flags().BoolVarP(&bootsectorForce, "force", "f", false, "Allow writing to a system disk")
+	bootsectorCmd.Flags().BoolVarP(&bootsectorYes, "yes", "y", false, "Skip confirmation prompt")
+	// Only writes need confirming; without changes the command just shows the MBR
+	addConfirmFlagFor(bootsectorCmd, func(args []string) []string {
+		if bootsectorMBR == "" && bootsectorActive == 0 && !bootsectorInactive && bootsectorPBR == "" {
+			return nil
+		}
+		return args[:1]
+	})
+	addTargetFlags(bootsectorCmd, targetSingle)
+	rootCmd.AddCommand(bootsectorCmd)
+}
+
+// validateBootsectorFlags checks the flag combination and returns the boot
+// code to write, if any.
+func validateBootsectorFlags(cmd *cobra.Command) (*iso.BootloaderType, error) {
+	if cmd.Flags().Changed("active") && (bootsectorActive < 1 || bootsectorActive > 4) {
+		return nil, fmt.Errorf("invalid --active %d: must be 1-4", bootsectorActive)
+	}
+	if bootsectorActive > 0 && bootsectorInactive {
+		return nil, errors.New("--active and --inactive cannot be used together")
+	}
+	switch bootsectorPBR {
+	case "", iso.PBRBootmgr, iso.PBRNTLDR:
+	default:
+		return nil, fmt.Errorf("invalid --pbr %q: use bootmgr or ntldr", bootsectorPBR)
+	}
+	if bootsectorMBR == "" {
+		return nil, nil
+	}
+	bootType, err := iso.ParseBootloader(bootsectorMBR)
+	if err != nil {
+		return nil, err
+	}
+	return &bootType, nil
+}
+
+func runBootsector(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	bootType, err := validateBootsectorFlags(cmd)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+	writing := bootType != nil || bootsectorActive > 0 || bootsectorInactive || bootsectorPBR != ""
+
+	// Raw access to sector 0 needs admin even for reading
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to access boot sectors"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	if writing {
+		if !bootsectorForce {
+			if isSystem, _ := enum.IsSystemDisk(device.DiskNumber); isSystem {
+				errMsg := fmt.Sprintf("Disk %d appears to be a system disk. Use --force to override.", device.DiskNumber)
+				if jsonOutput {
+					output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+				} else {
+					PrintError(errMsg, output.ErrCodeInvalidInput)
+				}
+				return errors.New(errMsg)
+			}
+		}
+		if bootsectorPBR != "" && device.DriveLetter == "" {
+			errMsg := fmt.Sprintf("Disk %d has no drive letter to install a boot record on", device.DiskNumber)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return errors.New(errMsg)
+		}
+
+		diskLock, err := lock.NewDiskLock(device.DiskNumber)
+		if err != nil {
+			errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+			} else {
+				PrintError(errMsg, output.ErrCodeInternalError)
+			}
+			return err
+		}
+		if err := diskLock.TryLock(cmd.Context(), 1*time.Second); err != nil {
+			errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+			} else {
+				PrintError(errMsg, output.ErrCodeDiskBusy)
+			}
+			return errors.New(errMsg)
+		}
+		defer diskLock.Unlock()
+
+		if !bootsectorYes && !jsonOutput {
+			pterm.Warning.Printf("This will modify the boot sectors of disk %d (%s - %s)\n",
+				device.DiskNumber, device.FriendlyName, device.SizeHuman)
+			confirmed, _ := pterm.DefaultInteractiveConfirm.
+				WithDefaultValue(false).
+				Show("Continue?")
+			if !confirmed {
+				pterm.Info.Println("Bootsector cancelled")
+				return nil
+			}
+		}
+	}
+
+	result, err := applyBootsector(device, bootType)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(result)
+	}
+	for _, change := range result.Changes {
+		pterm.Success.Println(change)
+	}
+	output.PrintMBRInfo(device.DiskNumber, result.MBR)
+	return nil
+}
+
+// applyBootsector performs the requested changes in order (boot code,
+// active flags, partition boot record) and reads back the resulting MBR.
+func applyBootsector(device *usb.Device, bootType *iso.BootloaderType) (*bootsectorResult, error) {
+	result := &bootsectorResult{DiskNumber: device.DiskNumber, Changes: []string{}}
+
+	handle, err := disk.OpenPhysicalDisk(device.DiskNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(handle)
+
+	if bootType != nil {
+		if err := iso.WriteBootCode(handle, *bootType); err != nil {
+			return nil, err
+		}
+		result.Changes = append(result.Changes, fmt.Sprintf("Wrote %s MBR boot code", bootType))
+	}
+
+	if bootsectorActive > 0 || bootsectorInactive {
+		if err := iso.SetActivePartition(handle, bootsectorActive); err != nil {
+			return nil, err
+		}
+		if bootsectorInactive {
+			result.Changes = append(result.Changes, "Cleared active flags")
+		} else {
+			result.Changes = append(result.Changes, fmt.Sprintf("Marked partition %d active", bootsectorActive))
+		}
+		// Let Windows pick up the new flags; not fatal if it can't
+		_ = disk.UpdateDiskProperties(handle)
+	}
+
+	if bootsectorPBR != "" {
+		if err := iso.InstallPBR(device.DriveLetter, bootsectorPBR, bootsectorBootsect); err != nil {
+			return nil, err
+		}
+		result.Changes = append(result.Changes, fmt.Sprintf("Installed %s boot record on %s", bootsectorPBR, device.DriveLetter))
+	}
+
+	result.MBR, err = iso.ReadMBR(handle)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
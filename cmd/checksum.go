@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checksumPartition int
+	checksumAlgo      string
+	checksumBuffer    string
+)
+
+var checksumCmd = &cobra.Command{
+	Use:   "checksum <drive>",
+	Short: "Compute a digest of a USB drive or partition",
+	Long: `Read a whole USB drive, or one of its partitions, and print its digest.
+Nothing is written.
+
+Algorithms:
+  sha256   Default; the one to use for chain-of-custody records
+  sha512, sha1, md5
+  blake3   Cryptographic and several times faster than SHA-256
+  xxhash   64-bit XXH64; fastest, but only detects accidental changes
+
+The drive's volumes are locked while it is read so the digest reflects a
+consistent state.`,
+	Example: `  wusbkit checksum E:
+  wusbkit checksum 2 --partition 1 --algo blake3
+  wusbkit checksum 2 --algo xxhash --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runChecksum,
+}
+
+func init() {
+	checksumCmd.Flags().IntVarP(&checksumPartition, "partition", "p", 0, "Only hash this partition number")
+	checksumCmd.Flags().StringVar(&checksumAlgo, "algo", "sha256", "Digest algorithm: sha256, sha512, sha1, md5, blake3, xxhash")
+	checksumCmd.Flags().StringVarP(&checksumBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB, 16M)")
+	addTargetFlags(checksumCmd, targetSingle)
+	rootCmd.AddCommand(checksumCmd)
+}
+
+func runChecksum(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	bufferMB, err := parseBufferSize(checksumBuffer)
+	if err == nil && (bufferMB < 1 || bufferMB > 64) {
+		err = fmt.Errorf("buffer size must be between 1M and 64M (got %dM)", bufferMB)
+	}
+	if err == nil {
+		switch strings.ToLower(checksumAlgo) {
+		case "md5", "sha1", "sha256", "sha512", "blake3", "xxhash":
+		default:
+			err = fmt.Errorf("unsupported --algo %q: use sha256, sha512, sha1, md5, blake3 or xxhash", checksumAlgo)
+		}
+	}
+	if err == nil && checksumPartition < 0 {
+		err = fmt.Errorf("invalid --partition %d", checksumPartition)
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts := flash.DiskChecksumOptions{
+		DiskNumber:  device.DiskNumber,
+		DriveLetter: device.DriveLetter,
+		Partition:   checksumPartition,
+		Algorithm:   strings.ToLower(checksumAlgo),
+		BufferSize:  bufferMB,
+	}
+
+	hasher := flash.NewDiskHasher()
+	type checksumDone struct {
+		result *flash.DiskChecksumResult
+		err    error
+	}
+	doneChan := make(chan checksumDone, 1)
+	go func() {
+		result, err := hasher.Checksum(ctx, opts)
+		doneChan <- checksumDone{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range hasher.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Opening drive...")
+		for progress := range hasher.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				text := fmt.Sprintf("Hashing %d%% | %s / %s", progress.Percentage,
+					flash.FormatBytes(progress.BytesWritten), flash.FormatBytes(progress.TotalBytes))
+				if progress.Speed != "" {
+					text += fmt.Sprintf(" | %s", progress.Speed)
+				}
+				spinner.UpdateText(text)
+			case flash.StatusError:
+				spinner.Fail(progress.Error)
+			case flash.StatusComplete:
+				spinner.Success("Checksum complete")
+			}
+		}
+	}
+
+	done := <-doneChan
+	if done.err != nil {
+		if !jsonOutput && done.err != context.Canceled {
+			PrintError(done.err.Error(), output.ErrCodeInternalError)
+		}
+		return done.err
+	}
+
+	result := done.result
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+		return nil
+	}
+
+	target := fmt.Sprintf("disk %d", result.DiskNumber)
+	if result.Partition > 0 {
+		target += fmt.Sprintf(" partition %d", result.Partition)
+	}
+	pterm.Info.Printfln("Hashed %s of %s in %s", flash.FormatBytes(result.Size), target, result.Duration)
+	pterm.Info.Printfln("%s (%s): %s", strings.ToUpper(result.Algorithm), target, result.Hash)
+	return nil
+}
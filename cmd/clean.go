@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cleanYes     bool
+	cleanForce   bool
+	cleanMaxSize string
+)
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean <drive>",
+	Short: "Quickly blank a USB drive's partition table",
+	Long: `Zero the first and last 4MB of a USB drive, like diskpart's clean.
+
+WARNING: The drive's partitions will be GONE and its data inaccessible!
+
+This removes the MBR, both copies of a GPT and the filesystem signatures
+at the start of the first partition, then has Windows re-read the drive,
+which shows up as an uninitialized disk ready to be formatted or flashed.
+It takes a second regardless of the drive's size. The rest of the data is
+still on the drive and can be recovered with forensic tools; use wipe to
+destroy it.`,
+	Example: `  wusbkit clean E:
+  wusbkit clean 2 --yes --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runClean,
+}
+
+func init() {
+	cleanCmd.Flags().BoolVarP(&cleanYes, "yes", "y", false, "Skip confirmation prompt")
+	cleanCmd.Flags().StringVar(&cleanMaxSize, "max-size", "", "Maximum device size to allow (e.g., 64G, 256G)")
+	cleanCmd.Flags().BoolVar(&cleanForce, "force", false, "Override safety protections (system disk, size limits)")
+	addConfirmFlag(cleanCmd)
+	addTargetFlags(cleanCmd, targetSingle)
+	addDrivePicker(cleanCmd)
+	rootCmd.AddCommand(cleanCmd)
+}
+
+func runClean(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+	if !cleanForce {
+		if err := checkDriveSafety(enum, device, cleanMaxSize); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !cleanYes && !jsonOutput {
+		pterm.Warning.Printf("This will REMOVE ALL PARTITIONS on disk %d (%s - %s)\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Continue with clean?")
+		if !confirmed {
+			pterm.Info.Println("Clean cancelled")
+			return nil
+		}
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Cleaning disk %d...", device.DiskNumber))
+	}
+
+	result, err := flash.Clean(device.DiskNumber, device.DriveLetter)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			spinner.Fail(err.Error())
+		}
+		return err
+	}
+
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+		return nil
+	}
+	spinner.Success(fmt.Sprintf("Disk %d cleaned (%s zeroed in %s)", result.DiskNumber,
+		flash.FormatBytes(result.BytesZeroed), result.Duration))
+	return nil
+}
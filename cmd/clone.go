@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cloneVerify  bool
+	cloneYes     bool
+	cloneForce   bool
+	cloneBuffer  string
+	cloneMaxSize string
+)
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone <source> <target>...",
+	Short: "Copy a USB drive to one or more other drives",
+	Long: `Copy a USB drive sector by sector onto one or more target drives.
+
+WARNING: This will COMPLETELY OVERWRITE every target drive!
+
+The source is read once and each buffer is written to all targets in
+parallel, so cloning to many drives takes about as long as cloning to
+one (the slowest target sets the pace). Targets can be given as drive
+letters, disk numbers or disk lists (e.g., 3-6 or 3,5,7). A target that
+fails is dropped and the others carry on.
+
+With --verify, the source's SHA-256 is computed while reading and every
+target is read back in parallel and compared against it.
+
+If a target is smaller than the source, only the source up to the end of
+its last partition is copied (to every target) and a GPT is rewritten to
+fit each target, so a 32GB stick with an 8GB image on it can be cloned to
+a 16GB one. A target the partitions don't fit on fails with the size it
+would need; shrink the last partition on the source first.
+
+The copies share the source's disk signature, so Windows may take one of
+them offline while both are attached.`,
+	Example: `  wusbkit clone E: F:
+  wusbkit clone 2 3-6 --verify --yes
+  wusbkit clone 2 3 5 7 --json --yes`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runClone,
+}
+
+func init() {
+	cloneCmd.Flags().BoolVar(&cloneVerify, "verify", false, "Read every target back and compare it with the source")
+	cloneCmd.Flags().BoolVarP(&cloneYes, "yes", "y", false, "Skip confirmation prompt")
+	cloneCmd.Flags().StringVar(&cloneMaxSize, "max-size", "", "Maximum target size to allow (e.g., 64G, 256G)")
+	cloneCmd.Flags().BoolVar(&cloneForce, "force", false, "Override safety protections for targets (system disk, size limits)")
+	cloneCmd.Flags().StringVarP(&cloneBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB, 16M)")
+	// The source is only read; --confirm names the targets
+	addConfirmFlagFor(cloneCmd, func(args []string) []string { return args[1:] })
+	rootCmd.AddCommand(cloneCmd)
+}
+
+// resolveCloneTargets looks up the target drives given as drive letters,
+// disk numbers or disk lists, and checks none of them is the source or
+// fails the safety checks.
+func resolveCloneTargets(enum *usb.Enumerator, source *usb.Device, args []string) ([]*usb.Device, error) {
+	var targets []*usb.Device
+	seen := map[int]bool{source.DiskNumber: true}
+	for _, arg := range args {
+		var devices []*usb.Device
+		if parallel.IsMultiDiskArg(arg) {
+			disks, err := parallel.ParseDisks(arg)
+			if err != nil {
+				return nil, err
+			}
+			for _, diskNum := range disks {
+				device, err := enum.GetDeviceByDiskNumber(diskNum)
+				if err != nil {
+					return nil, err
+				}
+				devices = append(devices, device)
+			}
+		} else {
+			device, err := enum.GetDevice(arg)
+			if err != nil {
+				return nil, err
+			}
+			devices = append(devices, device)
+		}
+
+		for _, device := range devices {
+			if device.DiskNumber == source.DiskNumber {
+				return nil, fmt.Errorf("disk %d is the source and can't also be a target", device.DiskNumber)
+			}
+			if seen[device.DiskNumber] {
+				continue
+			}
+			seen[device.DiskNumber] = true
+			if !cloneForce {
+				if err := checkDriveSafety(enum, device, cloneMaxSize); err != nil {
+					return nil, err
+				}
+			}
+			targets = append(targets, device)
+		}
+	}
+	return targets, nil
+}
+
+func runClone(cmd *cobra.Command, args []string) error {
+	bufferMB, err := parseBufferSize(cloneBuffer)
+	if err == nil && (bufferMB < 1 || bufferMB > 64) {
+		err = fmt.Errorf("buffer size must be between 1M and 64M (got %dM)", bufferMB)
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	source, err := enum.GetDevice(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+	targets, err := resolveCloneTargets(enum, source, args[1:])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !cloneYes && !jsonOutput {
+		pterm.Info.Printf("Source: disk %d (%s - %s)\n", source.DiskNumber, source.FriendlyName, source.SizeHuman)
+		pterm.Warning.Printf("This will COMPLETELY OVERWRITE %d drive(s):\n", len(targets))
+		for _, t := range targets {
+			pterm.Info.Printf("  Disk %d (%s - %s)\n", t.DiskNumber, t.FriendlyName, t.SizeHuman)
+		}
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Continue with clone?")
+		if !confirmed {
+			pterm.Info.Println("Clone cancelled")
+			return nil
+		}
+	}
+
+	// Lock the source and every target
+	for _, device := range append([]*usb.Device{source}, targets...) {
+		diskLock, err := lock.NewDiskLock(device.DiskNumber)
+		if err != nil {
+			errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+			} else {
+				PrintError(errMsg, output.ErrCodeInternalError)
+			}
+			return err
+		}
+		if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+			errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+			} else {
+				PrintError(errMsg, output.ErrCodeDiskBusy)
+			}
+			return errors.New(errMsg)
+		}
+		defer diskLock.Unlock()
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts := flash.CloneOptions{
+		SourceDisk:        source.DiskNumber,
+		SourceDriveLetter: source.DriveLetter,
+		BufferSize:        bufferMB,
+		Verify:            cloneVerify,
+	}
+	for _, t := range targets {
+		opts.Targets = append(opts.Targets, flash.CloneTarget{DiskNumber: t.DiskNumber, DriveLetter: t.DriveLetter})
+	}
+
+	cloner := flash.NewCloner()
+	type cloneDone struct {
+		result *flash.CloneResult
+		err    error
+	}
+	doneChan := make(chan cloneDone, 1)
+	go func() {
+		result, err := cloner.Clone(ctx, opts)
+		doneChan <- cloneDone{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range cloner.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Cloning disk %d to %d drive(s)...", source.DiskNumber, len(targets)))
+		status := make(map[int]string)
+		for progress := range cloner.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				status[progress.DiskNumber] = fmt.Sprintf("disk %d: %s %d%%", progress.DiskNumber, progress.Stage, progress.Percentage)
+			case flash.StatusError:
+				status[progress.DiskNumber] = fmt.Sprintf("disk %d: failed", progress.DiskNumber)
+			case flash.StatusComplete:
+				status[progress.DiskNumber] = fmt.Sprintf("disk %d: done", progress.DiskNumber)
+			}
+			disks := make([]int, 0, len(status))
+			for d := range status {
+				disks = append(disks, d)
+			}
+			sort.Ints(disks)
+			parts := make([]string, len(disks))
+			for i, d := range disks {
+				parts[i] = status[d]
+			}
+			text := strings.Join(parts, " | ")
+			if progress.Speed != "" {
+				text += " | " + progress.Speed
+			}
+			spinner.UpdateText(text)
+		}
+		spinner.Stop()
+	}
+
+	done := <-doneChan
+	if done.result == nil {
+		if !jsonOutput && done.err != context.Canceled {
+			PrintError(done.err.Error(), output.ErrCodeFlashFailed)
+		}
+		return done.err
+	}
+
+	result := done.result
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+	} else {
+		fmt.Printf("Cloned disk %d to %d/%d drives (%s)\n", result.SourceDisk,
+			result.Succeeded, len(result.Targets), flash.FormatBytes(result.Size))
+		if result.Shrunk {
+			pterm.Info.Println("Copied up to the end of the last partition to fit a smaller target")
+		}
+		for _, t := range result.Targets {
+			state := "OK"
+			if t.Verified {
+				state = "OK, verified"
+			}
+			if !t.Success {
+				state = "FAILED: " + t.Error
+			}
+			fmt.Printf("  Disk %d: %s (%s)\n", t.DiskNumber, state, t.Duration)
+		}
+		if result.Hash != "" {
+			pterm.Info.Printfln("SHA-256 (source): %s", result.Hash)
+		}
+	}
+
+	if done.err != nil {
+		return done.err
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%d drives failed to clone", result.Failed)
+	}
+	return nil
+}
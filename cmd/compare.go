@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	comparePartitions bool
+	compareBuffer     string
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <driveA> <driveB>",
+	Short: "Check whether two USB drives are identical",
+	Long: `Read two USB drives side by side and report whether they are
+bit-identical, writing nothing.
+
+The drives are compared region by region following the first drive's
+partition table: the partition table itself, each partition, unallocated
+gaps and (on GPT) the backup header area at the end. Each region reports
+whether it matched, its first differing offset and how many bytes differ.
+
+Drives of different sizes are never identical; the common part is still
+compared. With --partitions only the first drive up to the end of its
+last partition is compared, e.g. to check a clone made onto a larger
+drive.
+
+The command exits with an error if the drives differ.`,
+	Example: `  wusbkit compare E: F:
+  wusbkit compare 2 3 --partitions
+  wusbkit compare 2 3 --json`,
+	Args: cobra.ExactArgs(2),
+	RunE: runCompare,
+}
+
+func init() {
+	compareCmd.Flags().BoolVar(&comparePartitions, "partitions", false, "Only compare up to the end of the first drive's last partition")
+	compareCmd.Flags().StringVarP(&compareBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB, 16M)")
+	rootCmd.AddCommand(compareCmd)
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	bufferMB, err := parseBufferSize(compareBuffer)
+	if err == nil && (bufferMB < 1 || bufferMB > 64) {
+		err = fmt.Errorf("buffer size must be between 1M and 64M (got %dM)", bufferMB)
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	var devices []*usb.Device
+	for _, arg := range args {
+		device, err := enum.GetDevice(arg)
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+			} else {
+				PrintError(err.Error(), output.ErrCodeUSBNotFound)
+			}
+			return err
+		}
+		devices = append(devices, device)
+	}
+	if devices[0].DiskNumber == devices[1].DiskNumber {
+		errMsg := fmt.Sprintf("both arguments are disk %d", devices[0].DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	for _, device := range devices {
+		diskLock, err := lock.NewDiskLock(device.DiskNumber)
+		if err != nil {
+			errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+			} else {
+				PrintError(errMsg, output.ErrCodeInternalError)
+			}
+			return err
+		}
+		if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+			errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+			} else {
+				PrintError(errMsg, output.ErrCodeDiskBusy)
+			}
+			return errors.New(errMsg)
+		}
+		defer diskLock.Unlock()
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts := flash.CompareOptions{
+		DiskA:        devices[0].DiskNumber,
+		DriveLetterA: devices[0].DriveLetter,
+		DiskB:        devices[1].DiskNumber,
+		DriveLetterB: devices[1].DriveLetter,
+		Extent:       flash.CompareExtentDisk,
+		BufferSize:   bufferMB,
+	}
+	if comparePartitions {
+		opts.Extent = flash.CompareExtentPartitions
+	}
+
+	if !jsonOutput {
+		pterm.Info.Printf("Comparing disk %d (%s - %s) with disk %d (%s - %s)\n",
+			devices[0].DiskNumber, devices[0].FriendlyName, devices[0].SizeHuman,
+			devices[1].DiskNumber, devices[1].FriendlyName, devices[1].SizeHuman)
+	}
+
+	comparer := flash.NewComparer()
+	type compareDone struct {
+		result *flash.CompareResult
+		err    error
+	}
+	doneChan := make(chan compareDone, 1)
+	go func() {
+		result, err := comparer.Compare(ctx, opts)
+		doneChan <- compareDone{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range comparer.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Opening drives...")
+		for progress := range comparer.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				text := fmt.Sprintf("%s %d%% | %s / %s", progress.Stage, progress.Percentage,
+					flash.FormatBytes(progress.BytesWritten), flash.FormatBytes(progress.TotalBytes))
+				if progress.Speed != "" {
+					text += fmt.Sprintf(" | %s", progress.Speed)
+				}
+				spinner.UpdateText(text)
+			case flash.StatusError:
+				spinner.Fail(progress.Error)
+			case flash.StatusComplete:
+				spinner.Success("Comparison complete")
+			}
+		}
+	}
+
+	done := <-doneChan
+	if done.err != nil {
+		if !jsonOutput && done.err != context.Canceled {
+			PrintError(done.err.Error(), output.ErrCodeInternalError)
+		}
+		return done.err
+	}
+
+	result := done.result
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+	} else {
+		if result.SizeA != result.SizeB && result.Extent == flash.CompareExtentDisk {
+			pterm.Warning.Printfln("Drive sizes differ: %s vs %s",
+				flash.FormatBytes(result.SizeA), flash.FormatBytes(result.SizeB))
+		}
+		for _, r := range result.Regions {
+			state := "identical"
+			if !r.Identical {
+				state = fmt.Sprintf("DIFFERENT (%s differ, first at offset %d)",
+					flash.FormatBytes(r.DifferentBytes), *r.FirstDifference)
+			}
+			fmt.Printf("  %-16s %10s at %-12d %s\n", r.Name, flash.FormatBytes(r.Length), r.Offset, state)
+		}
+		if result.Identical {
+			pterm.Success.Printfln("Drives are identical (%s compared)", flash.FormatBytes(result.BytesCompared))
+		} else if result.FirstDifference != nil {
+			pterm.Error.Printfln("Drives differ: %s differ, first at offset %d",
+				flash.FormatBytes(result.DifferentBytes), *result.FirstDifference)
+		}
+	}
+
+	if !result.Identical {
+		return fmt.Errorf("disk %d and disk %d differ", result.DiskA, result.DiskB)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/spf13/cobra"
+)
+
+// requireConfirmEnv makes --confirm mandatory whenever a destructive command
+// runs without a prompt (--yes or --json).
+const requireConfirmEnv = "WUSBKIT_REQUIRE_CONFIRM"
+
+var confirmTokens string
+
+// addConfirmFlag registers --confirm on a destructive command: the serial
+// numbers or disk numbers of the drives the caller expects to erase, checked
+// against the drives the command is about to work on. It must be called
+// before addTargetFlags so the drive argument it checks is already resolved.
+func addConfirmFlag(cmd *cobra.Command) {
+	addConfirmFlagFor(cmd, func(args []string) []string { return args[:1] })
+}
+
+// addConfirmFlagFor is addConfirmFlag for commands whose drives to erase
+// aren't just their first argument. targets returns the drive arguments the
+// command will overwrite, or none if it won't write at all.
+func addConfirmFlagFor(cmd *cobra.Command, targets func(args []string) []string) {
+	cmd.Flags().StringVar(&confirmTokens, "confirm", "", "Serial or disk numbers the target drives must match (comma-separated; see "+requireConfirmEnv+")")
+
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if err := checkConfirm(cmd, targets(args)); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+		return run(cmd, args)
+	}
+}
+
+// checkConfirm verifies that the --confirm tokens name exactly the drives in
+// identifiers: every drive must be named by its serial number or disk number,
+// and every token must name one of the drives.
+func checkConfirm(cmd *cobra.Command, identifiers []string) error {
+	if len(identifiers) == 0 {
+		return nil // Nothing will be written
+	}
+	tokens := splitList(confirmTokens)
+	if len(tokens) == 0 {
+		if confirmRequired() && unattended(cmd) {
+			return fmt.Errorf("--confirm is required with --yes or --json (%s is set)", requireConfirmEnv)
+		}
+		return nil
+	}
+
+	var devices []usb.Device
+	for _, identifier := range identifiers {
+		found, err := confirmTargets(identifier)
+		if err != nil {
+			return err
+		}
+		devices = append(devices, found...)
+	}
+
+	for _, d := range devices {
+		if !confirmMatchesAny(d, tokens) {
+			return fmt.Errorf("disk %d (%s, serial %s) is not named by --confirm; refusing to continue",
+				d.DiskNumber, d.FriendlyName, confirmSerial(d))
+		}
+	}
+	for _, token := range tokens {
+		found := false
+		for _, d := range devices {
+			if confirmMatches(d, token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("--confirm %s does not match any target drive; refusing to continue", token)
+		}
+	}
+	return nil
+}
+
+// confirmRequired reports whether WUSBKIT_REQUIRE_CONFIRM is turned on.
+func confirmRequired() bool {
+	on, _ := strconv.ParseBool(os.Getenv(requireConfirmEnv))
+	return on
+}
+
+// unattended reports whether the command will skip its confirmation prompt.
+func unattended(cmd *cobra.Command) bool {
+	if jsonOutput {
+		return true
+	}
+	f := cmd.Flags().Lookup("yes")
+	return f != nil && f.Value.String() == "true"
+}
+
+// confirmTargets looks up the drives a drive argument refers to.
+func confirmTargets(identifier string) ([]usb.Device, error) {
+	enum := usb.NewEnumerator()
+	if !parallel.IsMultiDiskArg(identifier) {
+		device, err := enum.GetDevice(identifier)
+		if err != nil {
+			return nil, err
+		}
+		return []usb.Device{*device}, nil
+	}
+
+	disks, err := parallel.ParseDisks(identifier)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]usb.Device, 0, len(disks))
+	for _, n := range disks {
+		device, err := enum.GetDeviceByDiskNumber(n)
+		if err != nil {
+			return nil, err
+		}
+		if device == nil {
+			return nil, fmt.Errorf("disk %d not found", n)
+		}
+		devices = append(devices, *device)
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("no drives to confirm")
+	}
+	return devices, nil
+}
+
+// confirmMatches reports whether a --confirm token names a drive, by serial
+// number or disk number.
+func confirmMatches(d usb.Device, token string) bool {
+	serial := strings.TrimSpace(d.SerialNumber)
+	return (serial != "" && strings.EqualFold(serial, token)) || token == strconv.Itoa(d.DiskNumber)
+}
+
+func confirmMatchesAny(d usb.Device, tokens []string) bool {
+	for _, token := range tokens {
+		if confirmMatches(d, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmSerial returns a drive's serial number for messages.
+func confirmSerial(d usb.Device) string {
+	if serial := strings.TrimSpace(d.SerialNumber); serial != "" {
+		return serial
+	}
+	return "none"
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/pterm/pterm"
+)
+
+// printContentSummary lists the volumes on a drive with their labels, space
+// used and top-level folder and file counts, ahead of a confirmation prompt,
+// so a drive that still holds someone's data stands out before it is erased.
+func printContentSummary(diskNumber int, indent string) {
+	volumes, err := disk.ListVolumesByDiskNumber(diskNumber)
+	if err != nil || len(volumes) == 0 {
+		pterm.Info.Printf("%sNo volumes on the drive\n", indent)
+		return
+	}
+
+	for _, volume := range volumes {
+		name := "Volume without drive letter"
+		if root, _ := disk.GetVolumeDriveLetter(volume); root != "" {
+			name = "Volume " + strings.TrimSuffix(root, `\`)
+		}
+
+		contents, err := disk.GetVolumeContents(volume)
+		if err != nil {
+			pterm.Info.Printf("%s%s: unreadable (RAW, locked or not mounted)\n", indent, name)
+			continue
+		}
+
+		label := "no label"
+		if contents.Label != "" {
+			label = fmt.Sprintf("%q", contents.Label)
+		}
+		pterm.Info.Printf("%s%s %s (%s): %s of %s used, %d folders, %d files\n",
+			indent, name, label, contents.FileSystem,
+			flash.FormatBytes(contents.UsedBytes), flash.FormatBytes(contents.TotalBytes),
+			contents.Folders, contents.Files)
+	}
+}
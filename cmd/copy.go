@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/files"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	copyDest          string
+	copyVerify        bool
+	copySync          bool
+	copyParallel      bool
+	copyMaxConcurrent int
+	copyManifest      string
+	copyEject         bool
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy <src-dir> <drives>",
+	Short: "Copy a directory onto one or more USB drives",
+	Long: `Copy a directory tree onto the volume of one or more USB drives, in
+parallel when there are several. Existing files with the same names are
+replaced; nothing else on the drives is touched.
+
+Every file is hashed (SHA-256) as it is written. --verify reads every copy
+back and compares the hashes. --sync skips files already on the drive with
+the same size and modification time, so reloading updated content only
+copies what changed. Paths longer than 260 characters are supported.
+
+--manifest saves the list of copied files with their hashes, for checking
+the drives later with verify-files.
+
+The drives can be drive letters (E, E,F,G) or disk numbers (2, 2-6); a
+disk's first volume with a drive letter is used.`,
+	Example: `  wusbkit copy .\content E:
+  wusbkit copy .\content E,F,G --verify
+  wusbkit copy .\content 2-9 --dest kiosk --sync --json
+  wusbkit copy .\content E,F,G --manifest content.json
+  wusbkit copy .\content E,F,G --verify --eject`,
+	Args: cobra.ExactArgs(2),
+	RunE: runCopy,
+}
+
+func init() {
+	copyCmd.Flags().StringVar(&copyDest, "dest", "", "Directory on the drives to copy into (default: the root)")
+	copyCmd.Flags().BoolVar(&copyVerify, "verify", false, "Read every file back and compare its hash")
+	copyCmd.Flags().BoolVar(&copySync, "sync", false, "Skip files already on the drive with the same size and modification time")
+	copyCmd.Flags().StringVar(&copyManifest, "manifest", "", "Save the copied files' hashes to this file, for verify-files")
+	copyCmd.Flags().BoolVar(&copyEject, "eject", false, "Flush and eject each drive once its files are copied")
+	copyCmd.Flags().BoolVar(&copyParallel, "parallel", false, "Copy to multiple drives in parallel")
+	copyCmd.Flags().IntVar(&copyMaxConcurrent, "max-concurrent", 0, "Max concurrent operations (0=unlimited)")
+	addBatchFlags(copyCmd)
+	rootCmd.AddCommand(copyCmd)
+}
+
+func runCopy(cmd *cobra.Command, args []string) error {
+	source := args[0]
+	if info, err := os.Stat(source); err != nil || !info.IsDir() {
+		errMsg := fmt.Sprintf("source directory not found: %s", source)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	letters, err := parseDriversOrDisks(args[1])
+	if err == nil && len(letters) == 0 {
+		err = errors.New("no valid drives provided")
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Check every drive before copying to any
+	enum := usb.NewEnumerator()
+	var devices []*usb.Device
+	var problems targetProblems
+	for _, dl := range letters {
+		device, err := enum.GetDeviceByDriveLetter(dl)
+		if err != nil {
+			problems.add(output.ErrCodeUSBNotFound, fmt.Sprintf("drive %s: %v", dl, err))
+			continue
+		}
+		if device == nil {
+			problems.add(output.ErrCodeUSBNotFound, fmt.Sprintf("drive %s: not found or not a USB device", dl))
+			continue
+		}
+		devices = append(devices, device)
+	}
+	if err := problems.report(len(letters)); err != nil {
+		return err
+	}
+
+	opts := files.Options{
+		Source: source,
+		Verify: copyVerify,
+		Sync:   copySync,
+	}
+	if copyParallel || len(letters) > 1 {
+		return runParallelCopy(letters, devices, opts)
+	}
+	opts.Target = copyTarget(letters[0])
+	return runSingleCopy(devices[0], opts)
+}
+
+// copyTarget returns the directory to copy into on a drive.
+func copyTarget(letter string) string {
+	return filepath.Join(strings.TrimSuffix(letter, ":")+`:\`, copyDest)
+}
+
+func runSingleCopy(device *usb.Device, opts files.Options) error {
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	copier := files.NewCopier()
+	type outcome struct {
+		result *files.Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := copier.Copy(ctx, opts)
+		done <- outcome{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range copier.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Scanning source...")
+		for progress := range copier.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				if progress.Stage == files.StageScanning {
+					continue
+				}
+				text := fmt.Sprintf("%s %d%% | %s / %s", progress.Stage, progress.Percentage,
+					flash.FormatBytes(progress.BytesCopied), flash.FormatBytes(progress.TotalBytes))
+				if progress.TotalFiles > 0 {
+					text += fmt.Sprintf(" | %d/%d files", progress.Files, progress.TotalFiles)
+				}
+				if progress.Speed != "" {
+					text += " | " + progress.Speed
+				}
+				spinner.UpdateText(text)
+			case flash.StatusError:
+				spinner.Fail(progress.Error)
+			case flash.StatusComplete:
+				spinner.Success("Copy complete!")
+			}
+		}
+	}
+
+	o := <-done
+	if o.err != nil {
+		if !jsonOutput && o.err != context.Canceled {
+			PrintError(o.err.Error(), output.ErrCodeInternalError)
+		}
+		return o.err
+	}
+
+	if copyManifest != "" {
+		if err := writeCopyManifest(opts.Source, o.result.Entries); err != nil {
+			return err
+		}
+	}
+
+	if !jsonOutput {
+		msg := fmt.Sprintf("Copied %d files (%s) to %s in %s", o.result.Files,
+			flash.FormatBytes(o.result.Bytes), opts.Target, o.result.Duration)
+		if o.result.Skipped > 0 {
+			msg += fmt.Sprintf(", %d unchanged", o.result.Skipped)
+		}
+		if o.result.Verified {
+			msg += " (verified)"
+		}
+		pterm.Info.Println(msg)
+	}
+	if copyEject {
+		if err := ejectAfter("copy", device); err != nil {
+			if !jsonOutput {
+				PrintError(err.Error(), output.ErrCodeInternalError)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func runParallelCopy(letters []string, devices []*usb.Device, opts files.Options) error {
+	disks := make([]int, len(devices))
+	dirs := make([]string, len(devices))
+	for i, d := range devices {
+		disks[i] = d.DiskNumber
+		dirs[i] = copyTarget(letters[i])
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	executor := newBatchExecutor(copyMaxConcurrent, len(disks))
+	executor.SetEject(copyEject)
+	if !jsonOutput {
+		pterm.Info.Printf("Copying %s to %d drives in parallel...\n", opts.Source, len(disks))
+	}
+
+	result := executor.CopyAll(ctx, disks, dirs, opts)
+
+	// Output result (non-JSON mode - JSON mode streams NDJSON)
+	if !jsonOutput {
+		parallel.PrintBatchResult(result, "Copied to")
+	}
+
+	// Every drive got the same files, so the manifest is the source's
+	if copyManifest != "" && result.Succeeded > 0 {
+		entries, err := files.HashTree(ctx, opts.Source)
+		if err == nil {
+			err = writeCopyManifest(opts.Source, entries)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return finishBatch(result, "copy to")
+}
+
+// writeCopyManifest saves the --manifest of a copy.
+func writeCopyManifest(source string, entries []files.Entry) error {
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	if err := files.WriteManifest(copyManifest, files.NewManifest(source, entries)); err != nil {
+		errMsg := fmt.Sprintf("failed to write manifest: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return errors.New(errMsg)
+	}
+	if !jsonOutput {
+		pterm.Info.Printf("Manifest saved to %s\n", copyManifest)
+	}
+	return nil
+}
@@ -51,6 +51,7 @@ func init() {
 	createCmd.Flags().BoolVarP(&createYes, "yes", "y", false, "Skip confirmation prompt")
 	createCmd.Flags().BoolVar(&createVerify, "verify", false, "Verify image after creation")
 	createCmd.MarkFlagRequired("output")
+	addTargetFlags(createCmd, targetSingle)
 	rootCmd.AddCommand(createCmd)
 }
 
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diskpartScript  string
+	diskpartYes     bool
+	diskpartForce   bool
+	diskpartMaxSize string
+)
+
+var diskpartCmd = &cobra.Command{
+	Use:   "diskpart <drive>",
+	Short: "Run a diskpart script against a USB drive",
+	Long: `Run a diskpart script against one USB drive, as an escape hatch for
+layouts format and flash don't cover.
+
+The script is confined to the drive: it is started with "select disk N",
+any "select disk" line (or "select disk=N") must name the same disk by
+number, and "select volume" and "select vdisk" are refused since they could
+reach other disks (select partitions instead). The drive is locked against other wusbkit operations
+while diskpart runs. diskpart stops at the first failing command.`,
+	Example: `  wusbkit diskpart 2 --script layout.txt
+  wusbkit diskpart --serial 0401396 --script layout.txt --yes --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDiskpart,
+}
+
+func init() {
+	diskpartCmd.Flags().StringVar(&diskpartScript, "script", "", "diskpart script file")
+	diskpartCmd.Flags().BoolVarP(&diskpartYes, "yes", "y", false, "Skip confirmation prompt")
+	diskpartCmd.Flags().StringVar(&diskpartMaxSize, "max-size", "", "Maximum device size to allow (e.g., 64G, 256G)")
+	diskpartCmd.Flags().BoolVar(&diskpartForce, "force", false, "Override safety protections (system disk, size limits)")
+	diskpartCmd.MarkFlagRequired("script")
+	addConfirmFlag(diskpartCmd)
+	addTargetFlags(diskpartCmd, targetSingle)
+	addDrivePicker(diskpartCmd)
+	rootCmd.AddCommand(diskpartCmd)
+}
+
+// diskpartResult is the JSON output of diskpart.
+type diskpartResult struct {
+	DiskNumber int    `json:"diskNumber"`
+	Script     string `json:"script"`
+	Output     string `json:"output"`
+	Duration   string `json:"duration"`
+}
+
+func runDiskpart(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	data, err := os.ReadFile(diskpartScript)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to run diskpart"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+	if !diskpartForce {
+		if err := checkDriveSafety(enum, device, diskpartMaxSize); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+	}
+
+	script, err := format.PrepareDiskpartScript(string(data), device.DiskNumber)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", diskpartScript, err)
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !diskpartYes && !jsonOutput {
+		pterm.Warning.Printf("This will run a diskpart script on disk %d (%s - %s):\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		printContentSummary(device.DiskNumber, "  ")
+		for _, line := range strings.Split(strings.TrimSpace(script), "\r\n") {
+			fmt.Printf("    %s\n", line)
+		}
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Run the script?")
+		if !confirmed {
+			pterm.Info.Println("diskpart cancelled")
+			return nil
+		}
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Running diskpart on disk %d...", device.DiskNumber))
+	}
+
+	start := time.Now()
+	out, err := format.RunDiskpart(ctx, script)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(fmt.Sprintf("%v: %s", err, strings.TrimSpace(out)), output.ErrCodeInternalError)
+		} else {
+			spinner.Fail(err.Error())
+			fmt.Print(out)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(diskpartResult{
+			DiskNumber: device.DiskNumber,
+			Script:     script,
+			Output:     out,
+			Duration:   time.Since(start).Round(time.Millisecond).String(),
+		})
+	}
+	spinner.Success(fmt.Sprintf("diskpart script ran on disk %d", device.DiskNumber))
+	fmt.Print(out)
+	return nil
+}
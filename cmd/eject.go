@@ -1,18 +1,23 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"syscall"
+	"strings"
 
 	"github.com/lazaroagomez/wusbkit/internal/disk"
 	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
 	"github.com/lazaroagomez/wusbkit/internal/usb"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
-	"golang.org/x/sys/windows"
 )
 
-var ejectYes bool
+var (
+	ejectYes           bool
+	ejectForce         bool
+	ejectMaxConcurrent int
+)
 
 var ejectCmd = &cobra.Command{
 	Use:   "eject <drive>",
@@ -24,23 +29,48 @@ ensuring all pending writes are flushed before ejecting.
 
 The drive can be specified by:
   - Drive letter (e.g., E: or E)
-  - Disk number (e.g., 2)`,
+  - Disk number (e.g., 2)
+  - Multiple disks (e.g., 2,3,4 or 2-6)
+  - Serial number or hub port, with --serial, --port or --location
+  - Every USB drive, with --all (--exclude leaves drives out)
+
+Several drives are flushed and ejected in parallel, with a summary of the
+drives that ejected and those that didn't (e.g. because a file on them is
+open), handy at the end of a duplication run.
+
+When a program has a file, folder or window open on the drive, the eject
+fails and the error lists the processes holding it (finding other users'
+processes requires administrator privileges). --force dismounts the volumes
+anyway: the programs' open files stop working and unsaved changes in them
+are lost.`,
 	Example: `  wusbkit eject E:
   wusbkit eject E
   wusbkit eject 2
-  wusbkit eject E: --yes`,
+  wusbkit eject E: --yes
+  wusbkit eject E: --yes --force
+  wusbkit eject --port 1-4 --yes
+  wusbkit eject --all --yes
+  wusbkit eject --serial AA0123,BB4567 --json`,
 	Args: cobra.ExactArgs(1),
 	RunE: runEject,
 }
 
 func init() {
 	ejectCmd.Flags().BoolVarP(&ejectYes, "yes", "y", false, "Skip confirmation prompt")
+	ejectCmd.Flags().BoolVar(&ejectForce, "force", false, "Dismount volumes that programs hold open, invalidating their open files")
+	ejectCmd.Flags().IntVar(&ejectMaxConcurrent, "max-concurrent", 0, "Max concurrent operations (0=unlimited)")
+	addBatchFlags(ejectCmd)
+	addTargetFlags(ejectCmd, targetDisks)
 	rootCmd.AddCommand(ejectCmd)
 }
 
 func runEject(cmd *cobra.Command, args []string) error {
 	identifier := args[0]
 
+	if parallel.IsMultiDiskArg(identifier) {
+		return runMultiEject(identifier)
+	}
+
 	// Find the device
 	enum := usb.NewEnumerator()
 	device, err := enum.GetDevice(identifier)
@@ -68,13 +98,18 @@ func runEject(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Eject using native IOCTL_STORAGE_EJECT_MEDIA — no PowerShell needed
-	if err := ejectDisk(device.DiskNumber); err != nil {
+	// Flush, lock and dismount the volumes, then eject — no PowerShell needed
+	if err := disk.EjectDiskWithOptions(device.DiskNumber, disk.EjectOptions{Force: ejectForce}); err != nil {
 		errMsg := fmt.Sprintf("Failed to eject disk %d: %v", device.DiskNumber, err)
+		code := output.ErrCodeInternalError
+		if errors.Is(err, disk.ErrVolumeInUse) {
+			code = output.ErrCodeDiskBusy
+		}
 		if jsonOutput {
-			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+			output.PrintJSONErrorDetails(errMsg, code, volumeInUseDetails(err))
 		} else {
-			PrintError(errMsg, output.ErrCodeInternalError)
+			PrintError(errMsg, code)
+			printVolumeInUse(err)
 		}
 		return err
 	}
@@ -99,40 +134,130 @@ func runEject(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// ejectDisk safely ejects a physical disk using native Windows API.
-func ejectDisk(diskNumber int) error {
-	path := fmt.Sprintf(`\\.\PhysicalDrive%d`, diskNumber)
-	pathPtr, err := syscall.UTF16PtrFromString(path)
-	if err != nil {
-		return fmt.Errorf("invalid disk path: %w", err)
-	}
-
-	handle, err := windows.CreateFile(
-		pathPtr,
-		windows.GENERIC_READ|windows.GENERIC_WRITE,
-		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
-		nil,
-		windows.OPEN_EXISTING,
-		0,
-		0,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to open disk: %w", err)
-	}
-	defer windows.CloseHandle(handle)
-
-	var bytesReturned uint32
-	err = windows.DeviceIoControl(
-		handle,
-		disk.IOCTL_STORAGE_EJECT_MEDIA,
-		nil, 0,
-		nil, 0,
-		&bytesReturned,
-		nil,
-	)
+// ejectResult is the JSON output of ejectAfter.
+type ejectResult struct {
+	DiskNumber  int    `json:"diskNumber"`
+	DriveLetter string `json:"driveLetter"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+}
+
+// runMultiEject flushes and ejects several disks in parallel, continuing
+// past failures, and summarizes the run like the other batch commands.
+func runMultiEject(identifier string) error {
+	disks, err := parallel.ParseDisks(identifier)
+	if err == nil && len(disks) == 0 {
+		err = errors.New("no valid disk numbers provided")
+	}
 	if err != nil {
-		return fmt.Errorf("IOCTL_STORAGE_EJECT_MEDIA failed: %w", err)
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
 	}
 
+	enum := usb.NewEnumerator()
+	var devices []*usb.Device
+	for _, diskNum := range disks {
+		device, err := enum.GetDeviceByDiskNumber(diskNum)
+		if err == nil && device == nil {
+			err = errors.New("not found or not a USB device")
+		}
+		if err != nil {
+			errMsg := fmt.Sprintf("disk %d: %v", diskNum, err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
+			} else {
+				PrintError(errMsg, output.ErrCodeUSBNotFound)
+			}
+			return fmt.Errorf("disk %d: %w", diskNum, err)
+		}
+		devices = append(devices, device)
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !ejectYes && !jsonOutput {
+		pterm.Info.Printf("Ejecting %d drives:\n", len(devices))
+		for _, d := range devices {
+			pterm.Info.Printf("  Disk %d (%s - %s)\n", d.DiskNumber, d.FriendlyName, d.SizeHuman)
+		}
+
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(true).
+			Show("Continue?")
+
+		if !confirmed {
+			pterm.Info.Println("Eject cancelled")
+			return nil
+		}
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	executor := newBatchExecutor(ejectMaxConcurrent, len(disks))
+	if !jsonOutput {
+		pterm.Info.Printf("Ejecting %d drives in parallel...\n", len(disks))
+	}
+
+	result := executor.EjectAll(ctx, disks, disk.EjectOptions{Force: ejectForce})
+
+	// Output result (non-JSON mode - JSON mode streams NDJSON)
+	if !jsonOutput {
+		parallel.PrintBatchResult(result, "Ejected")
+	}
+
+	return finishBatch(result, "eject")
+}
+
+// printVolumeInUse lists the files each process holds open on a volume
+// that failed to eject, if that's why it failed.
+func printVolumeInUse(err error) {
+	var inUse *disk.VolumeInUseError
+	if !errors.As(err, &inUse) {
+		return
+	}
+	for _, p := range inUse.Processes {
+		pterm.Info.Printf("  %s (PID %d): %s\n", p.Name, p.PID, strings.Join(p.Files, ", "))
+	}
+	pterm.Info.Println("Close them and retry, or use --force to dismount anyway")
+}
+
+// volumeInUseDetails returns the volume and the processes holding it open,
+// for the JSON error of a volume that failed to eject, or nil if that isn't
+// why it failed.
+func volumeInUseDetails(err error) map[string]interface{} {
+	var inUse *disk.VolumeInUseError
+	if !errors.As(err, &inUse) {
+		return nil
+	}
+	processes := inUse.Processes
+	if processes == nil {
+		processes = []disk.VolumeProcess{}
+	}
+	return map[string]interface{}{
+		"volume":    inUse.Volume,
+		"processes": processes,
+	}
+}
+
+// ejectAfter ejects a drive whose operation succeeded, for --eject. The
+// error, if any, fails the operation: a drive left mounted must not pass
+// for a finished one. In JSON mode the error is printed here; otherwise it
+// is left to the caller.
+func ejectAfter(operation string, device *usb.Device) error {
+	if err := disk.EjectDisk(device.DiskNumber); err != nil {
+		err = fmt.Errorf("%s succeeded, but eject failed: %w", operation, err)
+		if jsonOutput {
+			output.PrintJSONErrorDetails(err.Error(), output.ErrCodeInternalError, volumeInUseDetails(err))
+		}
+		return err
+	}
+	if jsonOutput {
+		return output.PrintJSON(ejectResult{DiskNumber: device.DiskNumber, DriveLetter: device.DriveLetter, Success: true})
+	}
+	pterm.Success.Printf("Ejected disk %d (%s) - safe to remove\n", device.DiskNumber, device.FriendlyName)
 	return nil
 }
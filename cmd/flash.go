@@ -12,8 +12,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/lazaroagomez/wusbkit/internal/cloudinit"
 	"github.com/lazaroagomez/wusbkit/internal/flash"
 	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/hooks"
 	"github.com/lazaroagomez/wusbkit/internal/lock"
 	"github.com/lazaroagomez/wusbkit/internal/output"
 	"github.com/lazaroagomez/wusbkit/internal/parallel"
@@ -28,11 +30,33 @@ var (
 	flashYes            bool
 	flashBuffer         string
 	flashHash           bool
+	flashHashAlgo       string
 	flashSkipUnchanged  bool
 	flashMaxSize        string
 	flashForce          bool
 	flashParallel       bool
 	flashMaxConcurrent  int
+	flashMinWriteSpeed  string
+	flashFailSlow       bool
+	flashZipEntry       string
+	flashExpectedHash   string
+	flashChecksumFile   string
+	flashSeek           string
+	flashSkip           string
+	flashCount          string
+	flashPartition      int
+	flashNoTrim         bool
+	flashSparse         bool
+	flashUserData       string
+	flashMetaData       string
+	flashSMBUser        string
+	flashNoCache        bool
+	flashValidateImage  bool
+	flashMode           string
+	flashFS             string
+	flashLabel          string
+	flashEject          bool
+	flashMap            string
 )
 
 var flashCmd = &cobra.Command{
@@ -46,19 +70,49 @@ The drive can be specified by:
   - Drive letter (e.g., E: or E)
   - Disk number (e.g., 2)
   - Multiple disks (e.g., 2,3,4 or 2-6 or 2,4-6,8)
+  - Serial number or hub port, with --serial, --port or --location
+  - Every USB drive, with --all (--exclude leaves drives out)
 
 Supported image sources:
   - Local files: .img, .iso, .bin, .raw
   - Compressed: .gz, .xz, .zst/.zstd (streaming decompression)
   - Archives: .zip (streams first image file inside)
-  - Remote URLs: HTTP/HTTPS URLs (streams directly without downloading)`,
+  - Remote URLs: HTTP/HTTPS URLs (streams directly without downloading)
+
+With --mode files, an ISO is not written raw: the drive is partitioned and
+formatted (FAT32 by default) and the ISO's files are copied onto it, with
+install.wim split when it exceeds FAT32's 4GB limit. Use this for Windows
+install ISOs, which usually don't boot when raw-flashed.
+
+--label sets the volume label of the image's first partition once it is
+written and the disk rescanned, so flashed drives get asset labels in the
+same run.
+
+--map keeps a block map (.wusbmap) of per-block hashes of what was last
+written to the drive; it can also be made by backup --map. When the map
+exists and belongs to the drive, only the blocks whose hash differs are
+written, without reading the drive, so reflashing a slightly newer image
+takes seconds. The map is updated after every successful flash. It can't
+see changes made to the drive in between, so add --verify if the drive
+may have been written to since.
+
+When flashing several drives, --min-write-speed flags drives whose
+sustained write speed (averaged over the write, excluding verification)
+falls below the threshold, catching slow or dying sticks during mass
+duplication; with --fail-slow they are reported as failed.`,
 	Example: `  wusbkit flash 2 --image ubuntu.img
   wusbkit flash E: --image raspios.img.xz --verify
   wusbkit flash 2 --image debian.iso --yes --json
   wusbkit flash E: --image https://example.com/image.img --hash
   wusbkit flash 2,3,4 --image ubuntu.img --parallel --json --yes
   wusbkit flash 2-6 --image raspios.img --parallel --yes
-  wusbkit flash 2,4-6,8 --image debian.iso --parallel --max-concurrent 3 --yes`,
+  wusbkit flash 2,4-6,8 --image debian.iso --parallel --max-concurrent 3 --yes
+  wusbkit flash 2-9 --image kiosk.img --min-write-speed 10M --fail-slow --yes
+  wusbkit flash E: --image Win11_24H2_x64.iso --mode files
+  wusbkit flash E: --image build-42.img --map kiosk.wusbmap
+  wusbkit flash 2-9 --image kiosk.img --label KIOSK-042 --yes
+  wusbkit flash 2-9 --image kiosk.img --eject --yes
+  wusbkit flash --port 1-10 --image kiosk.img --yes`,
 	Args: cobra.ExactArgs(1),
 	RunE: runFlash,
 }
@@ -68,13 +122,40 @@ func init() {
 	flashCmd.Flags().BoolVar(&flashVerify, "verify", false, "Verify write by reading back and comparing")
 	flashCmd.Flags().BoolVarP(&flashYes, "yes", "y", false, "Skip confirmation prompt")
 	flashCmd.Flags().StringVarP(&flashBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB)")
-	flashCmd.Flags().BoolVar(&flashHash, "hash", false, "Calculate and display SHA-256 hash")
+	flashCmd.Flags().BoolVar(&flashHash, "hash", false, "Calculate and display a hash of the image (see --hash-algo)")
+	flashCmd.Flags().StringVar(&flashHashAlgo, "hash-algo", "sha256", "Algorithm for --hash: sha256, sha512, sha1, md5, blake3, xxhash (implies --hash)")
 	flashCmd.Flags().BoolVar(&flashSkipUnchanged, "skip-unchanged", false, "Skip writing sectors that haven't changed")
-	flashCmd.Flags().StringVar(&flashMaxSize, "max-size", "", "Maximum device size to allow (e.g., 64G, 256G)")
-	flashCmd.Flags().BoolVar(&flashForce, "force", false, "Override safety protections (system disk, size limits)")
+	flashCmd.Flags().StringVar(&flashMaxSize, "max-size", "", "Maximum device size to allow (e.g., 64G, 256G); larger drives are skipped when flashing several")
+	flashCmd.Flags().BoolVar(&flashForce, "force", false, "Override safety protections (system disk, size limits, BitLocker-locked volumes)")
 	flashCmd.Flags().BoolVar(&flashParallel, "parallel", false, "Flash same image to multiple disks in parallel")
 	flashCmd.Flags().IntVar(&flashMaxConcurrent, "max-concurrent", 0, "Max concurrent operations (0=unlimited)")
+	flashCmd.Flags().StringVar(&flashMinWriteSpeed, "min-write-speed", "", "Flag parallel targets whose sustained write speed per second is below this (e.g., 10M)")
+	flashCmd.Flags().BoolVar(&flashFailSlow, "fail-slow", false, "Fail targets below --min-write-speed instead of only flagging them")
+	flashCmd.Flags().StringVar(&flashZipEntry, "zip-entry", "", "File inside a .zip/.7z archive to flash (default: first image)")
+	flashCmd.Flags().StringVar(&flashExpectedHash, "expected-hash", "", "Expected image digest, as hex or algo:hex (md5, sha1, sha256, sha512, blake3, xxhash)")
+	flashCmd.Flags().StringVar(&flashChecksumFile, "checksum-file", "", "Checksum sidecar to verify the image against (e.g. SHA256SUMS, image.sha256)")
+	flashCmd.Flags().StringVar(&flashSeek, "seek", "", "Device offset to start writing at, like dd seek (e.g., 1M; must be 4K-aligned)")
+	flashCmd.Flags().StringVar(&flashSkip, "skip", "", "Image bytes to skip before writing, like dd skip (e.g., 512K)")
+	flashCmd.Flags().StringVar(&flashCount, "count", "", "Maximum image bytes to write, like dd count (e.g., 64M)")
+	flashCmd.Flags().IntVar(&flashPartition, "partition", 0, "Write the image into this partition number instead of the whole disk")
+	flashCmd.Flags().BoolVar(&flashNoTrim, "no-trim", false, "Write the whole image instead of stopping after the last partition")
+	flashCmd.Flags().BoolVar(&flashSparse, "sparse", false, "Skip writing all-zero blocks (only safe on an already-zeroed drive)")
+	flashCmd.Flags().StringVar(&flashUserData, "user-data", "", "cloud-init user-data file to seed onto the boot partition after flashing")
+	flashCmd.Flags().StringVar(&flashMetaData, "meta-data", "", "cloud-init meta-data file (default: generated instance-id)")
+	addHTTPFlags(flashCmd)
+	flashCmd.Flags().BoolVar(&flashValidateImage, "validate-image", false, "Abort if the image looks like a text/HTML file or a truncated download")
+	flashCmd.Flags().BoolVar(&flashNoCache, "no-cache", false, "Stream URL images even if they were pulled into the image cache")
+	flashCmd.Flags().StringVar(&flashMode, "mode", flashModeRaw, "Write mode: raw (sector copy) or files (format and copy an ISO's files)")
+	flashCmd.Flags().StringVar(&flashFS, "fs", "", "Filesystem for --mode files: fat32, exfat, ntfs (default: fat32, ntfs if a file other than install.wim exceeds 4GB)")
+	flashCmd.Flags().StringVar(&flashLabel, "label", "", "Volume label: set on the first partition after flashing (--mode files: default USB)")
+	flashCmd.Flags().BoolVar(&flashEject, "eject", false, "Flush and eject each drive once it is flashed successfully")
+	flashCmd.Flags().StringVar(&flashMap, "map", "", "Block map file (.wusbmap): write only blocks changed since the map was made, then update it")
+	flashCmd.Flags().StringVar(&flashSMBUser, "smb-user", "", "User for a \\\\server\\share image, as [DOMAIN\\]user[:password] (prompts if password omitted)")
 	flashCmd.MarkFlagRequired("image")
+	addBatchFlags(flashCmd)
+	addConfirmFlag(flashCmd)
+	addTargetFlags(flashCmd, targetDisks)
+	addDrivePicker(flashCmd)
 	rootCmd.AddCommand(flashCmd)
 }
 
@@ -131,27 +212,158 @@ func parseBufferSize(s string) (int, error) {
 	return val, nil
 }
 
+// formatImageSize returns a human-readable image size, or "unknown size" for
+// compressed streams whose uncompressed size can't be determined up front.
+func formatImageSize(size int64) string {
+	if size == flash.SizeUnknown {
+		return "unknown size"
+	}
+	return flash.FormatBytes(size)
+}
+
+// resolveExpectedHash returns the digest the image must match, taken from
+// --expected-hash or looked up in --checksum-file.
+func resolveExpectedHash(expected, checksumFile, imagePath string, httpOpts flash.HTTPOptions) (flash.ExpectedHash, error) {
+	switch {
+	case expected != "" && checksumFile != "":
+		return flash.ExpectedHash{}, errors.New("--expected-hash and --checksum-file are mutually exclusive")
+	case expected != "":
+		return flash.ParseExpectedHash(expected)
+	case checksumFile != "":
+		return flash.LoadChecksumFile(checksumFile, imagePath, httpOpts)
+	default:
+		return flash.ExpectedHash{}, nil
+	}
+}
+
+// parseRegion parses --seek, --skip and --count (all in bytes, with optional
+// K/M/G/T suffixes) and validates them for the writer.
+func parseRegion() (seek, skip, count int64, err error) {
+	if seek, err = parseSize(flashSeek); err != nil {
+		return 0, 0, 0, fmt.Errorf("--seek: %w", err)
+	}
+	if skip, err = parseSize(flashSkip); err != nil {
+		return 0, 0, 0, fmt.Errorf("--skip: %w", err)
+	}
+	if count, err = parseSize(flashCount); err != nil {
+		return 0, 0, 0, fmt.Errorf("--count: %w", err)
+	}
+	return seek, skip, count, flash.ValidateRegion(seek, skip, count)
+}
+
+// loadCloudInitSeed reads --user-data/--meta-data, returning nil when no
+// cloud-init seed was requested.
+func loadCloudInitSeed() (*cloudinit.Seed, error) {
+	if flashUserData == "" {
+		if flashMetaData != "" {
+			return nil, errors.New("--meta-data requires --user-data")
+		}
+		return nil, nil
+	}
+	return cloudinit.LoadSeed(flashUserData, flashMetaData)
+}
+
+// connectSMBShare authenticates to the share holding a UNC image path when
+// --smb-user is given. The returned function disconnects it again.
+func connectSMBShare() (func(), error) {
+	if flashSMBUser == "" {
+		return func() {}, nil
+	}
+	if !flash.IsUNCPath(flashImage) {
+		return nil, errors.New("--smb-user requires a \\\\server\\share image path")
+	}
+	user, password, err := splitCredentials("--smb-user", flashSMBUser, true)
+	if err != nil {
+		return nil, err
+	}
+	return flash.ConnectSMB(flashImage, user, password)
+}
+
 func runFlash(cmd *cobra.Command, args []string) error {
 	identifier := args[0]
 
+	if flashMap != "" && (flashMode != flashModeRaw || flashParallel || parallel.IsMultiDiskArg(identifier)) {
+		errMsg := "--map tracks a single drive and can only be used for a raw flash of one drive"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	switch strings.ToLower(flashHashAlgo) {
+	case "md5", "sha1", "sha256", "sha512", "blake3", "xxhash":
+	default:
+		errMsg := fmt.Sprintf("unsupported --hash-algo %q: use sha256, sha512, sha1, md5, blake3 or xxhash", flashHashAlgo)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+	if cmd.Flags().Changed("hash-algo") {
+		flashHash = true
+	}
+
+	switch flashMode {
+	case flashModeRaw:
+	case flashModeFiles:
+		return runFilesFlash(cmd, args)
+	default:
+		errMsg := fmt.Sprintf("invalid --mode %q: use raw or files", flashMode)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
 	// Check if parallel mode (explicit flag or multi-disk syntax)
 	if flashParallel || parallel.IsMultiDiskArg(identifier) {
 		return runParallelFlash(cmd, args)
 	}
 
+	if flashMinWriteSpeed != "" || flashFailSlow {
+		errMsg := "--min-write-speed and --fail-slow apply to parallel flashing (use --parallel or several disks)"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
 	return runSingleFlash(cmd, args)
 }
 
 func runSingleFlash(cmd *cobra.Command, args []string) error {
 	identifier := args[0]
 
+	// Prefer a copy pulled with `wusbkit image pull` over streaming the URL
+	imagePath, sourceImage := useCachedImage(flashImage)
+
 	// Check if image is a URL (skip file existence check for URLs)
-	isURL := flash.IsURL(flashImage)
+	isURL := flash.IsURL(imagePath)
+
+	// Authenticate to the SMB share first so the image can be found
+	disconnectSMB, err := connectSMBShare()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+	defer disconnectSMB()
 
 	// Validate local image file exists (skip for URLs)
 	if !isURL {
-		if _, err := os.Stat(flashImage); os.IsNotExist(err) {
-			errMsg := fmt.Sprintf("Image file not found: %s", flashImage)
+		if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+			errMsg := fmt.Sprintf("Image file not found: %s", imagePath)
 			if jsonOutput {
 				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
 			} else {
@@ -161,6 +373,50 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Resolve credentials and proxy for URL images
+	httpOpts, err := resolveHTTPOptions(sourceImage)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Resolve the expected checksum, if any
+	expectedHash, err := resolveExpectedHash(flashExpectedHash, flashChecksumFile, sourceImage, httpOpts)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Parse the dd-style write region
+	seek, skip, count, err := parseRegion()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Load the cloud-init seed, if any
+	seed, err := loadCloudInitSeed()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
 	// Check for admin privileges
 	if !format.IsAdmin() {
 		errMsg := "Administrator privileges required for flashing"
@@ -220,6 +476,17 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 			}
 			return errors.New(errMsg)
 		}
+
+		// Refuse to overwrite encrypted data nobody has unlocked
+		if device.BitLocker == usb.BitLockerLocked {
+			errMsg := fmt.Sprintf("Disk %d has a BitLocker-locked volume (%s). Unlock it or use --force to override.", device.DiskNumber, device.DriveLetter)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return errors.New(errMsg)
+		}
 	}
 
 	// Acquire exclusive lock on the disk
@@ -245,7 +512,13 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 	defer diskLock.Unlock()
 
 	// Get image info for display
-	source, err := flash.OpenSource(flashImage)
+	source, err := flash.OpenSourceWithOptions(imagePath, flash.SourceOptions{
+		ArchiveEntry: flashZipEntry,
+		Skip:         skip,
+		Count:        count,
+		Trim:         !flashNoTrim && flashPartition == 0,
+		HTTP:         httpOpts,
+	})
 	if err != nil {
 		if jsonOutput {
 			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
@@ -258,10 +531,14 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 	imageName := source.Name()
 	source.Close()
 
-	// Validate image fits on device
-	if imageSize > device.Size {
+	// Validate image fits on device (streams of unknown size are checked while writing)
+	if imageSize != flash.SizeUnknown && seek+imageSize > device.Size {
 		errMsg := fmt.Sprintf("Image (%s) is larger than device (%s)",
 			flash.FormatBytes(imageSize), device.SizeHuman)
+		if seek > 0 {
+			errMsg = fmt.Sprintf("Image (%s) at offset %s does not fit on device (%s)",
+				flash.FormatBytes(imageSize), flash.FormatBytes(seek), device.SizeHuman)
+		}
 		if jsonOutput {
 			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
 		} else {
@@ -270,11 +547,40 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 		return errors.New(errMsg)
 	}
 
+	// Validate image fits in the target partition
+	if flashPartition > 0 {
+		target, err := flash.ResolvePartition(device.DiskNumber, flashPartition)
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+		if imageSize != flash.SizeUnknown && seek+imageSize > target.Length {
+			errMsg := fmt.Sprintf("Image (%s) does not fit in partition %d (%s)",
+				flash.FormatBytes(imageSize), flashPartition, flash.FormatBytes(target.Length))
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return errors.New(errMsg)
+		}
+	}
+
 	// Confirmation prompt (unless --yes or --json)
 	if !flashYes && !jsonOutput {
-		pterm.Warning.Printf("This will COMPLETELY OVERWRITE disk %d (%s - %s)\n",
-			device.DiskNumber, device.FriendlyName, device.SizeHuman)
-		pterm.Info.Printf("Image: %s (%s)\n", imageName, flash.FormatBytes(imageSize))
+		if flashPartition > 0 {
+			pterm.Warning.Printf("This will OVERWRITE partition %d on disk %d (%s - %s)\n",
+				flashPartition, device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		} else {
+			pterm.Warning.Printf("This will COMPLETELY OVERWRITE disk %d (%s - %s)\n",
+				device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		}
+		printContentSummary(device.DiskNumber, "  ")
+		pterm.Info.Printf("Image: %s (%s)\n", imageName, formatImageSize(imageSize))
 
 		if flashVerify {
 			pterm.Info.Println("Verification: enabled")
@@ -328,16 +634,41 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 	// Prepare flash options
 	opts := flash.Options{
 		DiskNumber:    device.DiskNumber,
-		ImagePath:     flashImage,
+		ImagePath:     imagePath,
 		Verify:        flashVerify,
 		BufferSize:    bufferMB,
 		CalculateHash: flashHash,
+		HashAlgorithm: strings.ToLower(flashHashAlgo),
 		SkipUnchanged: flashSkipUnchanged,
+		ArchiveEntry:  flashZipEntry,
+		Seek:          seek,
+		Skip:          skip,
+		Count:         count,
+		Partition:     flashPartition,
+		NoTrim:        flashNoTrim,
+		Sparse:        flashSparse,
+		CloudInit:     seed,
+		Label:         flashLabel,
+		HTTP:          httpOpts,
+		ValidateImage: flashValidateImage,
+		ExpectedHash:  expectedHash,
+		BlockMap:      flashMap,
+		DiskSerial:    device.SerialNumber,
+	}
+
+	if err := runDriveHook(ctx, hooks.PreFlash, device, nil); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeFlashFailed)
+		} else {
+			PrintError(err.Error(), output.ErrCodeFlashFailed)
+		}
+		return err
 	}
 
 	flasher := flash.NewFlasher()
 
 	// Start flash in background
+	start := time.Now()
 	errChan := make(chan error, 1)
 	go func() {
 		_, _, err := flasher.Flash(ctx, opts)
@@ -358,16 +689,44 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 		for progress := range flasher.Progress() {
 			switch progress.Status {
 			case flash.StatusInProgress:
-				text := fmt.Sprintf("%s %d%% | %s / %s",
-					progress.Stage,
-					progress.Percentage,
-					flash.FormatBytes(progress.BytesWritten),
-					flash.FormatBytes(progress.TotalBytes))
+				var text string
+				if progress.TotalBytes > 0 {
+					text = fmt.Sprintf("%s %d%% | %s / %s",
+						progress.Stage,
+						progress.Percentage,
+						flash.FormatBytes(progress.BytesWritten),
+						flash.FormatBytes(progress.TotalBytes))
+				} else if progress.Percentage > 0 {
+					// Unknown total: percentage is estimated from compressed input
+					text = fmt.Sprintf("%s ~%d%% | %s",
+						progress.Stage,
+						progress.Percentage,
+						flash.FormatBytes(progress.BytesWritten))
+				} else {
+					// No estimate at all (e.g. a URL without Content-Length)
+					text = fmt.Sprintf("%s | %s",
+						progress.Stage,
+						flash.FormatBytes(progress.BytesWritten))
+				}
 				if progress.Speed != "" {
 					text += fmt.Sprintf(" | %s", progress.Speed)
 				}
+				if progress.BytesSkipped > 0 {
+					text += fmt.Sprintf(" | %s skipped", flash.FormatBytes(progress.BytesSkipped))
+				}
 				spinner.UpdateText(text)
 
+			case flash.StatusHashVerified:
+				spinner.UpdateText(fmt.Sprintf("Checksum verified (%s)", expectedHash.Algorithm))
+
+			case flash.StatusImageValidated:
+				for _, w := range progress.Validation.Warnings {
+					pterm.Warning.Println(w)
+				}
+				if progress.Validation.OK() {
+					spinner.UpdateText(fmt.Sprintf("Image looks valid (%s)", progress.Validation.Format))
+				}
+
 			case flash.StatusError:
 				spinner.Fail(progress.Error)
 
@@ -378,17 +737,32 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 				}
 				spinner.Success(msg)
 				if progress.Hash != "" {
-					pterm.Info.Printf("SHA-256: %s\n", progress.Hash)
+					pterm.Info.Printf("%s: %s\n", strings.ToUpper(progress.HashAlgorithm), progress.Hash)
+				}
+				if expectedHash.IsSet() {
+					pterm.Info.Printf("Checksum: %s verified\n", expectedHash.Algorithm)
 				}
 				if progress.BytesSkipped > 0 {
-					pterm.Info.Printf("Skipped: %s (unchanged)\n", flash.FormatBytes(progress.BytesSkipped))
+					reason := "unchanged"
+					if flashMap != "" {
+						reason = "unchanged since last flash"
+					} else if flashSparse {
+						reason = "unchanged or zero"
+					}
+					pterm.Info.Printf("Skipped: %s (%s)\n", flash.FormatBytes(progress.BytesSkipped), reason)
 				}
+				printPartitions(progress.Partitions)
 			}
 		}
 	}
 
 	// Wait for flash to complete
-	if err := <-errChan; err != nil {
+	err = <-errChan
+	if err == nil && flashEject {
+		err = ejectAfter("flash", device)
+	}
+	runPostHook(hooks.PostFlash, device, start, err)
+	if err != nil {
 		if !jsonOutput && err != context.Canceled {
 			PrintError(err.Error(), output.ErrCodeFlashFailed)
 		}
@@ -398,10 +772,41 @@ func runSingleFlash(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// printPartitions lists a flashed drive's partitions as Windows sees them
+// after the rescan.
+func printPartitions(partitions []flash.Partition) {
+	for _, p := range partitions {
+		line := fmt.Sprintf("Partition %d: %s", p.Number, flash.FormatBytes(p.Size))
+		if p.DriveLetter != "" {
+			line += " on " + p.DriveLetter
+		}
+		if p.FileSystem != "" {
+			line += ", " + p.FileSystem
+		}
+		if p.Label != "" {
+			line += fmt.Sprintf(" %q", p.Label)
+		}
+		pterm.Info.Println(line)
+	}
+}
+
 // runParallelFlash flashes the same image to multiple disks in parallel
 func runParallelFlash(cmd *cobra.Command, args []string) error {
 	identifier := args[0]
 
+	minWriteSpeed, err := parseSize(flashMinWriteSpeed)
+	if err == nil && (minWriteSpeed < 0 || (flashFailSlow && minWriteSpeed == 0)) {
+		err = errors.New("--min-write-speed must be positive (and is required by --fail-slow)")
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
 	// Parse disk numbers
 	disks, err := parallel.ParseDisks(identifier)
 	if err != nil {
@@ -423,13 +828,28 @@ func runParallelFlash(cmd *cobra.Command, args []string) error {
 		return errors.New(errMsg)
 	}
 
+	// Prefer a copy pulled with `wusbkit image pull` over streaming the URL
+	imagePath, sourceImage := useCachedImage(flashImage)
+
 	// Check if image is a URL (skip file existence check for URLs)
-	isURL := flash.IsURL(flashImage)
+	isURL := flash.IsURL(imagePath)
+
+	// Authenticate to the SMB share first so the image can be found
+	disconnectSMB, err := connectSMBShare()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+	defer disconnectSMB()
 
 	// Validate local image file exists (skip for URLs)
 	if !isURL {
-		if _, err := os.Stat(flashImage); os.IsNotExist(err) {
-			errMsg := fmt.Sprintf("Image file not found: %s", flashImage)
+		if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+			errMsg := fmt.Sprintf("Image file not found: %s", imagePath)
 			if jsonOutput {
 				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
 			} else {
@@ -439,6 +859,50 @@ func runParallelFlash(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Resolve credentials and proxy for URL images
+	httpOpts, err := resolveHTTPOptions(sourceImage)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Resolve the expected checksum, if any
+	expectedHash, err := resolveExpectedHash(flashExpectedHash, flashChecksumFile, sourceImage, httpOpts)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Parse the dd-style write region
+	seek, skip, count, err := parseRegion()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Load the cloud-init seed, if any
+	seed, err := loadCloudInitSeed()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
 	// Check for admin privileges
 	if !format.IsAdmin() {
 		errMsg := "Administrator privileges required for flashing"
@@ -451,7 +915,13 @@ func runParallelFlash(cmd *cobra.Command, args []string) error {
 	}
 
 	// Get image info for display
-	source, err := flash.OpenSource(flashImage)
+	source, err := flash.OpenSourceWithOptions(imagePath, flash.SourceOptions{
+		ArchiveEntry: flashZipEntry,
+		Skip:         skip,
+		Count:        count,
+		Trim:         !flashNoTrim && flashPartition == 0,
+		HTTP:         httpOpts,
+	})
 	if err != nil {
 		if jsonOutput {
 			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
@@ -464,90 +934,73 @@ func runParallelFlash(cmd *cobra.Command, args []string) error {
 	imageName := source.Name()
 	source.Close()
 
-	// Validate all disks exist, are USB, and can hold the image
+	if _, err := parseSize(flashMaxSize); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Validate all disks exist, are USB, and can hold the image. Every disk
+	// is checked before anything is reported, so a long range with a few
+	// bad targets is fixed in one go.
 	enum := usb.NewEnumerator()
 	var deviceNames []string
+	var problems targetProblems
+	devices := make(map[int]*usb.Device, len(disks))
 	for _, diskNum := range disks {
 		device, err := enum.GetDeviceByDiskNumber(diskNum)
 		if err != nil {
-			errMsg := fmt.Sprintf("disk %d: %v", diskNum, err)
-			if jsonOutput {
-				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
-			} else {
-				PrintError(errMsg, output.ErrCodeUSBNotFound)
-			}
-			return fmt.Errorf("disk %d: %w", diskNum, err)
+			problems.add(output.ErrCodeUSBNotFound, fmt.Sprintf("disk %d: %v", diskNum, err))
+			continue
 		}
 		if device == nil {
-			errMsg := fmt.Sprintf("disk %d: not found or not a USB device", diskNum)
-			if jsonOutput {
-				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
-			} else {
-				PrintError(errMsg, output.ErrCodeUSBNotFound)
-			}
-			return fmt.Errorf("disk %d: not found or not a USB device", diskNum)
+			problems.add(output.ErrCodeUSBNotFound, fmt.Sprintf("disk %d: not found or not a USB device", diskNum))
+			continue
 		}
 
 		// Validate image fits on device
-		if imageSize > device.Size {
+		if imageSize != flash.SizeUnknown && seek+imageSize > device.Size {
 			errMsg := fmt.Sprintf("disk %d: image (%s) is larger than device (%s)",
 				diskNum, flash.FormatBytes(imageSize), device.SizeHuman)
-			if jsonOutput {
-				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
-			} else {
-				PrintError(errMsg, output.ErrCodeInvalidInput)
+			if seek > 0 {
+				errMsg = fmt.Sprintf("disk %d: image (%s) at offset %s does not fit on device (%s)",
+					diskNum, flash.FormatBytes(imageSize), flash.FormatBytes(seek), device.SizeHuman)
 			}
-			return errors.New(errMsg)
+			problems.add(output.ErrCodeInvalidInput, errMsg)
+			continue
 		}
 
 		// Safety checks (unless --force)
 		if !flashForce {
-			// Check max size limit
-			if flashMaxSize != "" {
-				maxSize, err := parseSize(flashMaxSize)
-				if err != nil {
-					if jsonOutput {
-						output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
-					} else {
-						PrintError(err.Error(), output.ErrCodeInvalidInput)
-					}
-					return err
-				}
-				if maxSize > 0 && device.Size > maxSize {
-					errMsg := fmt.Sprintf("disk %d: size (%s) exceeds maximum allowed (%s)",
-						diskNum, device.SizeHuman, flashMaxSize)
-					if jsonOutput {
-						output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
-					} else {
-						PrintError(errMsg, output.ErrCodeInvalidInput)
-					}
-					return errors.New(errMsg)
-				}
+			if err := checkDriveSafety(enum, device, flashMaxSize); err != nil {
+				problems.add(output.ErrCodeInvalidInput, err.Error())
+				continue
 			}
-
-			// Check if this is a system disk
-			isSystem, _ := enum.IsSystemDisk(device.DiskNumber)
-			if isSystem {
-				errMsg := fmt.Sprintf("disk %d appears to be a system disk", diskNum)
-				if jsonOutput {
-					output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
-				} else {
-					PrintError(errMsg, output.ErrCodeInvalidInput)
-				}
-				return errors.New(errMsg)
+			if device.BitLocker == usb.BitLockerLocked {
+				problems.add(output.ErrCodeInvalidInput,
+					fmt.Sprintf("disk %d has a BitLocker-locked volume (%s)", diskNum, device.DriveLetter))
+				continue
 			}
 		}
 
 		deviceNames = append(deviceNames, fmt.Sprintf("%d (%s - %s)", diskNum, device.FriendlyName, device.SizeHuman))
+		devices[diskNum] = device
+	}
+	if err := problems.report(len(disks)); err != nil {
+		return err
 	}
 
 	// Confirmation prompt (unless --yes or --json)
 	if !flashYes && !jsonOutput {
 		pterm.Warning.Printf("This will COMPLETELY OVERWRITE %d drives:\n", len(disks))
-		for _, name := range deviceNames {
+		for i, name := range deviceNames {
 			pterm.Info.Printf("  Disk %s\n", name)
+			printContentSummary(disks[i], "    ")
 		}
-		pterm.Info.Printf("Image: %s (%s)\n", imageName, flash.FormatBytes(imageSize))
+		pterm.Info.Printf("Image: %s (%s)\n", imageName, formatImageSize(imageSize))
 
 		if flashVerify {
 			pterm.Info.Println("Verification: enabled")
@@ -585,11 +1038,23 @@ func runParallelFlash(cmd *cobra.Command, args []string) error {
 
 	// Build options
 	opts := flash.Options{
-		ImagePath:     flashImage,
+		ImagePath:     imagePath,
 		Verify:        flashVerify,
 		BufferSize:    bufferMB,
 		CalculateHash: flashHash,
+		HashAlgorithm: strings.ToLower(flashHashAlgo),
 		SkipUnchanged: flashSkipUnchanged,
+		ArchiveEntry:  flashZipEntry,
+		Seek:          seek,
+		Skip:          skip,
+		Count:         count,
+		Partition:     flashPartition,
+		NoTrim:        flashNoTrim,
+		Sparse:        flashSparse,
+		CloudInit:     seed,
+		Label:         flashLabel,
+		HTTP:          httpOpts,
+		ValidateImage: flashValidateImage,
 	}
 
 	// Setup context with cancellation for Ctrl+C
@@ -607,8 +1072,21 @@ func runParallelFlash(cmd *cobra.Command, args []string) error {
 		cancel()
 	}()
 
+	// Verify a local image once up front rather than once per disk.
+	// URL images are streamed per disk, so each download is checked while writing.
+	if expectedHash.IsSet() {
+		if isURL {
+			opts.ExpectedHash = expectedHash
+		} else if err := verifyImageChecksum(ctx, imagePath, expectedHash); err != nil {
+			return err
+		}
+	}
+
 	// Execute parallel flash
-	executor := parallel.NewExecutor(flashMaxConcurrent, jsonOutput)
+	executor := newBatchExecutor(flashMaxConcurrent, len(disks))
+	executor.SetMinWriteSpeed(minWriteSpeed, flashFailSlow)
+	executor.SetEject(flashEject)
+	setBatchHooks(executor, hooks.PreFlash, hooks.PostFlash, devices)
 
 	if !jsonOutput {
 		pterm.Info.Printf("Flashing %d drives in parallel...\n", len(disks))
@@ -621,8 +1099,40 @@ func runParallelFlash(cmd *cobra.Command, args []string) error {
 		parallel.PrintBatchResult(result, "Flashed")
 	}
 
-	if result.Failed > 0 {
-		return fmt.Errorf("%d drives failed to flash", result.Failed)
+	return finishBatch(result, "flash")
+}
+
+// verifyImageChecksum hashes the local image at imagePath and compares it
+// with expected, emitting a hash_verified event in JSON mode.
+func verifyImageChecksum(ctx context.Context, imagePath string, expected flash.ExpectedHash) error {
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Verifying %s checksum...", expected.Algorithm))
+	}
+
+	digest, err := flash.HashFile(ctx, imagePath, expected.Algorithm, nil)
+	if err == nil && digest != expected.Digest {
+		err = fmt.Errorf("checksum mismatch: expected %s %s, got %s", expected.Algorithm, expected.Digest, digest)
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			spinner.Fail(err.Error())
+		}
+		return err
+	}
+
+	if jsonOutput {
+		data, _ := json.Marshal(flash.Progress{
+			Stage:      flash.StageChecksum,
+			Percentage: 100,
+			Status:     flash.StatusHashVerified,
+			Hash:       expected.String(),
+		})
+		fmt.Println(string(data))
+	} else {
+		spinner.Success(fmt.Sprintf("Checksum verified (%s)", expected.Algorithm))
 	}
 	return nil
 }
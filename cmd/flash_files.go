@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/hooks"
+	"github.com/lazaroagomez/wusbkit/internal/iso"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// Flash modes selected by --mode
+const (
+	flashModeRaw   = "raw"
+	flashModeFiles = "files"
+)
+
+// validateFilesMode checks the flags and image for --mode files, which
+// needs a local ISO and a single drive.
+func validateFilesMode(identifier string) error {
+	if flashParallel || parallel.IsMultiDiskArg(identifier) {
+		return errors.New("--mode files supports a single drive")
+	}
+	if flash.IsURL(flashImage) {
+		return errors.New("--mode files needs a local ISO file, not a URL")
+	}
+	if !strings.EqualFold(filepath.Ext(flashImage), ".iso") {
+		return fmt.Errorf("--mode files needs an .iso image (got %s)", filepath.Base(flashImage))
+	}
+	switch strings.ToUpper(flashFS) {
+	case "", "FAT32", "EXFAT", "NTFS":
+	default:
+		return fmt.Errorf("invalid --fs %q: use fat32, exfat or ntfs", flashFS)
+	}
+	return nil
+}
+
+// runFilesFlash partitions and formats the drive and copies the ISO's files
+// onto it instead of writing the ISO sector by sector, which is what
+// Windows install media needs to boot from USB.
+func runFilesFlash(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	if err := validateFilesMode(identifier); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Authenticate to the SMB share first so the image can be found
+	disconnectSMB, err := connectSMBShare()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+	defer disconnectSMB()
+
+	if _, err := os.Stat(flashImage); os.IsNotExist(err) {
+		errMsg := fmt.Sprintf("Image file not found: %s", flashImage)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	// Check for admin privileges
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for flashing"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	// Find the device
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	// Refuse system disks unless --force
+	if !flashForce {
+		if isSystem, _ := enum.IsSystemDisk(device.DiskNumber); isSystem {
+			errMsg := fmt.Sprintf("Disk %d appears to be a system disk. Use --force to override.", device.DiskNumber)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return errors.New(errMsg)
+		}
+	}
+
+	// Acquire exclusive lock on the disk
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+	defer diskLock.Unlock()
+
+	// Confirmation prompt (unless --yes or --json)
+	if !flashYes && !jsonOutput {
+		pterm.Warning.Printf("This will ERASE disk %d (%s - %s) and copy the ISO's files onto it\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		printContentSummary(device.DiskNumber, "  ")
+		pterm.Info.Printf("Image: %s\n", filepath.Base(flashImage))
+
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Continue with flash?")
+		if !confirmed {
+			pterm.Info.Println("Flash cancelled")
+			return nil
+		}
+	}
+
+	// Setup context with cancellation for Ctrl+C
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		if !jsonOutput {
+			pterm.Warning.Println("\nCancelling... (waiting for current operation)")
+		}
+		cancel()
+	}()
+
+	if err := runDriveHook(ctx, hooks.PreFlash, device, nil); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeFlashFailed)
+		} else {
+			PrintError(err.Error(), output.ErrCodeFlashFailed)
+		}
+		return err
+	}
+
+	writer := iso.NewWriter()
+	start := time.Now()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- writer.Write(ctx, iso.WriteOptions{
+			DiskNumber: device.DiskNumber,
+			ISOPath:    flashImage,
+			FileSystem: flashFS,
+			Label:      flashLabel,
+		})
+	}()
+
+	if jsonOutput {
+		for progress := range writer.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Preparing...")
+		for progress := range writer.Progress() {
+			switch {
+			case progress.Error != "":
+				spinner.Fail(progress.Error)
+			case progress.Stage == "complete":
+				spinner.Success("Flash complete! (files copied)")
+			case progress.Warning != "":
+				pterm.Warning.Println(progress.Warning)
+			default:
+				spinner.UpdateText(fmt.Sprintf("%d%% | %s", progress.Percentage, progress.Status))
+			}
+		}
+	}
+
+	err = <-errChan
+	if err == nil && flashEject {
+		err = ejectAfter("flash", device)
+	}
+	runPostHook(hooks.PostFlash, device, start, err)
+	if err != nil {
+		if !jsonOutput && err != context.Canceled {
+			PrintError(err.Error(), output.ErrCodeFlashFailed)
+		}
+		return err
+	}
+	return nil
+}
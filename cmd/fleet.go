@@ -0,0 +1,440 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/fleet"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fleetImage         string
+	fleetPorts         string
+	fleetVerify        bool
+	fleetLabel         string
+	fleetEject         bool
+	fleetMinSize       string
+	fleetMaxSize       string
+	fleetMaxConcurrent int
+	fleetBuffer        string
+	fleetLog           string
+	fleetYes           bool
+	fleetTargetCount   int
+)
+
+var fleetCmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "Run a duplication station that flashes drives as they are plugged in",
+	Long: `Watch for USB drives being plugged in and flash each one with the image,
+optionally setting its label and ejecting it when done, until interrupted
+with Ctrl+C. Drives already plugged in when the station starts are left
+alone; replug them to have them flashed. Card readers can stay attached:
+a card inserted into one is flashed like a drive plugged in, and taking it
+out counts as a removal.
+
+WARNING: Every qualifying drive plugged in while the station runs is
+COMPLETELY OVERWRITTEN without asking!
+
+--ports limits the station to drives in those hub port numbers (e.g., 1-8
+for an 8-port duplicator hub); --min-size and --max-size skip drives
+outside the size range. System disks are always skipped.
+
+--target-count stops the station once that many drives have been flashed
+successfully, for production runs of a set number of units; failed drives
+don't count towards it.
+
+A dashboard shows each drive in progress and the running totals: drives
+done, failed and remaining and the average time per stick. When the
+station stops, a production report sums up the run, listing every failed
+drive. With --json, every event (inserted, skipped, progress, complete,
+removed) and the final report are printed as JSON lines instead; --log
+appends the same NDJSON lines to a file either way.`,
+	Example: `  wusbkit fleet --image kiosk.img --ports 1-8
+  wusbkit fleet --image kiosk.img.xz --ports 1-8 --verify --label KIOSK --eject
+  wusbkit fleet --image kiosk.img --min-size 16G --max-size 64G --log station.ndjson --yes
+  wusbkit fleet --image kiosk.img --ports 1-8 --target-count 500 --eject
+  wusbkit fleet --image kiosk.img --ports 1-4 --json --yes`,
+	Args: cobra.NoArgs,
+	RunE: runFleet,
+}
+
+func init() {
+	fleetCmd.Flags().StringVarP(&fleetImage, "image", "i", "", "Path to image file or URL (required)")
+	fleetCmd.Flags().StringVar(&fleetPorts, "ports", "", "Hub port numbers to accept drives on (e.g., 1-8 or 1,3,5-8; default: any)")
+	fleetCmd.Flags().BoolVar(&fleetVerify, "verify", false, "Verify each drive by reading it back")
+	fleetCmd.Flags().StringVar(&fleetLabel, "label", "", "Volume label to set on each drive after flashing")
+	fleetCmd.Flags().BoolVar(&fleetEject, "eject", false, "Eject each drive when it is done")
+	fleetCmd.Flags().StringVar(&fleetMinSize, "min-size", "", "Skip drives smaller than this (e.g., 16G)")
+	fleetCmd.Flags().StringVar(&fleetMaxSize, "max-size", "", "Skip drives larger than this (e.g., 64G)")
+	fleetCmd.Flags().IntVar(&fleetMaxConcurrent, "max-concurrent", 0, "Max drives flashed at once (0=unlimited)")
+	fleetCmd.Flags().StringVarP(&fleetBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB)")
+	fleetCmd.Flags().StringVar(&fleetLog, "log", "", "Append NDJSON events to this file")
+	fleetCmd.Flags().IntVar(&fleetTargetCount, "target-count", 0, "Stop once this many drives have been flashed successfully")
+	fleetCmd.Flags().BoolVarP(&fleetYes, "yes", "y", false, "Skip confirmation prompt")
+	fleetCmd.MarkFlagRequired("image")
+	rootCmd.AddCommand(fleetCmd)
+}
+
+// fleetOptions validates the flags and builds the station options.
+func fleetOptions() (fleet.Options, error) {
+	opts := fleet.Options{
+		Label:         fleetLabel,
+		Eject:         fleetEject,
+		MaxConcurrent: fleetMaxConcurrent,
+		TargetCount:   fleetTargetCount,
+	}
+	if fleetTargetCount < 0 {
+		return opts, errors.New("--target-count can't be negative")
+	}
+
+	if !flash.IsURL(fleetImage) {
+		if _, err := os.Stat(fleetImage); err != nil {
+			return opts, fmt.Errorf("image not found: %s", fleetImage)
+		}
+	}
+
+	bufferMB, err := parseBufferSize(fleetBuffer)
+	if err != nil {
+		return opts, err
+	}
+	if bufferMB < 1 || bufferMB > 64 {
+		return opts, fmt.Errorf("buffer size must be between 1 and 64 MB")
+	}
+	opts.Flash = flash.Options{
+		ImagePath:  fleetImage,
+		Verify:     fleetVerify,
+		BufferSize: bufferMB,
+	}
+
+	if fleetPorts != "" {
+		if opts.Ports, err = parallel.ParseDisks(fleetPorts); err != nil {
+			return opts, fmt.Errorf("invalid --ports %q: %w", fleetPorts, err)
+		}
+	}
+	if opts.MinSize, err = parseSize(fleetMinSize); err != nil {
+		return opts, fmt.Errorf("invalid --min-size: %w", err)
+	}
+	if opts.MaxSize, err = parseSize(fleetMaxSize); err != nil {
+		return opts, fmt.Errorf("invalid --max-size: %w", err)
+	}
+	if opts.MaxSize > 0 && opts.MinSize > opts.MaxSize {
+		return opts, errors.New("--min-size is larger than --max-size")
+	}
+	return opts, nil
+}
+
+func runFleet(cmd *cobra.Command, args []string) error {
+	opts, err := fleetOptions()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	var logFile *os.File
+	if fleetLog != "" {
+		logFile, err = os.OpenFile(fleetLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			errMsg := fmt.Sprintf("failed to open log: %v", err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return errors.New(errMsg)
+		}
+		defer logFile.Close()
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !fleetYes && !jsonOutput {
+		where := "any port"
+		if fleetPorts != "" {
+			where = "ports " + fleetPorts
+		}
+		pterm.Warning.Printf("Every USB drive plugged into %s will be COMPLETELY OVERWRITTEN without asking\n", where)
+		pterm.Info.Printf("Image: %s\n", fleetImage)
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Start the station?")
+		if !confirmed {
+			pterm.Info.Println("Fleet cancelled")
+			return nil
+		}
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	station := fleet.NewStation(opts)
+	done := make(chan error, 1)
+	go func() {
+		done <- station.Run(ctx)
+	}()
+
+	dashboard := newFleetDashboard(filepath.Base(fleetImage), fleetTargetCount)
+	if !jsonOutput {
+		dashboard.start()
+	}
+	emit := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		if logFile != nil {
+			logFile.Write(append(data, '\n'))
+		}
+		if jsonOutput {
+			fmt.Println(string(data))
+		}
+	}
+	for ev := range station.Events() {
+		emit(ev)
+		dashboard.update(ev)
+	}
+	dashboard.stop()
+
+	report := dashboard.report()
+	emit(report)
+	if !jsonOutput {
+		printFleetReport(report)
+	}
+
+	if err := <-done; err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+	return nil
+}
+
+// fleetUnit is a drive shown on the dashboard.
+type fleetUnit struct {
+	event  fleet.Event // Latest event for the drive
+	status string
+}
+
+// fleetReport is the production report printed when the station stops, as
+// the last NDJSON line with --json.
+type fleetReport struct {
+	Type           string        `json:"type"` // Always "report"
+	Image          string        `json:"image"`
+	TargetCount    int           `json:"targetCount,omitempty"`
+	Succeeded      int           `json:"succeeded"`
+	Failed         int           `json:"failed"`
+	Skipped        int           `json:"skipped"`
+	Remaining      int           `json:"remaining,omitempty"`
+	Elapsed        string        `json:"elapsed"`
+	AveragePerUnit string        `json:"averagePerUnit,omitempty"` // Mean flash time of a good drive
+	UnitsPerHour   float64       `json:"unitsPerHour,omitempty"`   // Good drives per hour of station time
+	Failures       []fleet.Event `json:"failures,omitempty"`
+}
+
+// fleetDashboard tracks the station's progress and, once started, renders
+// it in place.
+type fleetDashboard struct {
+	image                      string
+	target                     int
+	started                    time.Time
+	area                       *pterm.AreaPrinter
+	units                      map[int]*fleetUnit
+	succeeded, failed, skipped int
+	goodTime                   time.Duration // Total flash time of good drives
+	failures                   []fleet.Event
+	lastSkip                   string
+}
+
+func newFleetDashboard(image string, target int) *fleetDashboard {
+	return &fleetDashboard{image: image, target: target, started: time.Now(), units: make(map[int]*fleetUnit)}
+}
+
+func (d *fleetDashboard) start() {
+	d.area, _ = pterm.DefaultArea.Start()
+	d.render()
+}
+
+func (d *fleetDashboard) stop() {
+	if d.area != nil {
+		d.area.Stop()
+	}
+}
+
+// update applies an event to the dashboard and redraws it.
+func (d *fleetDashboard) update(ev fleet.Event) {
+	switch ev.Type {
+	case fleet.EventInserted:
+		d.units[ev.DiskNumber] = &fleetUnit{event: ev, status: "Waiting..."}
+	case fleet.EventSkipped:
+		d.skipped++
+		d.lastSkip = fmt.Sprintf("disk %d (%s): %s", ev.DiskNumber, ev.FriendlyName, ev.Reason)
+	case fleet.EventProgress:
+		if u, ok := d.units[ev.DiskNumber]; ok {
+			u.event = ev
+			u.status = fmt.Sprintf("%s %d%%", ev.Stage, ev.Percentage)
+			if ev.Speed != "" {
+				u.status += " | " + ev.Speed
+			}
+		}
+	case fleet.EventComplete:
+		u, ok := d.units[ev.DiskNumber]
+		if !ok {
+			u = &fleetUnit{}
+			d.units[ev.DiskNumber] = u
+		}
+		u.event = ev
+		if ev.Success {
+			d.succeeded++
+			if took, err := time.ParseDuration(ev.Duration); err == nil {
+				d.goodTime += took
+			}
+			u.status = pterm.Green(fmt.Sprintf("Done in %s - remove the drive", ev.Duration))
+		} else {
+			d.failed++
+			d.failures = append(d.failures, ev)
+			u.status = pterm.Red("FAILED: " + ev.Error)
+		}
+	case fleet.EventRemoved:
+		delete(d.units, ev.DiskNumber)
+	}
+	d.render()
+}
+
+func (d *fleetDashboard) render() {
+	if d.area == nil {
+		return
+	}
+
+	var b strings.Builder
+	done := pterm.Green(d.succeeded)
+	if d.target > 0 {
+		done = fmt.Sprintf("%s/%d", pterm.Green(d.succeeded), d.target)
+	}
+	fmt.Fprintf(&b, "%s  |  %s succeeded  %s failed  %d in progress  %d skipped",
+		pterm.Bold.Sprint("Fleet: "+d.image), done, pterm.Red(d.failed), d.inProgress(), d.skipped)
+	if d.target > 0 {
+		fmt.Fprintf(&b, "  %d remaining", d.remaining())
+	}
+	if avg := d.average(); avg > 0 {
+		fmt.Fprintf(&b, "  |  avg %s per stick", avg)
+	}
+	b.WriteString("\n")
+
+	disks := make([]int, 0, len(d.units))
+	for n := range d.units {
+		disks = append(disks, n)
+	}
+	sort.Ints(disks)
+	for _, n := range disks {
+		u := d.units[n]
+		port := u.event.Port
+		if port == "" {
+			port = "-"
+		}
+		fmt.Fprintf(&b, "  Port %-3s Disk %-3d %-28s %s\n", port, n, u.event.FriendlyName, u.status)
+	}
+	if len(disks) == 0 {
+		b.WriteString("  Waiting for drives...\n")
+	}
+	if d.lastSkip != "" {
+		fmt.Fprintf(&b, "  Last skipped: %s\n", d.lastSkip)
+	}
+	d.area.Update(b.String())
+}
+
+// inProgress counts the drives on the dashboard that aren't done yet.
+func (d *fleetDashboard) inProgress() int {
+	n := 0
+	for _, u := range d.units {
+		if u.event.Type != fleet.EventComplete {
+			n++
+		}
+	}
+	return n
+}
+
+// remaining returns how many good drives are still needed for the target.
+func (d *fleetDashboard) remaining() int {
+	if d.target <= d.succeeded {
+		return 0
+	}
+	return d.target - d.succeeded
+}
+
+// average returns the mean flash time of the good drives so far.
+func (d *fleetDashboard) average() time.Duration {
+	if d.succeeded == 0 {
+		return 0
+	}
+	return (d.goodTime / time.Duration(d.succeeded)).Round(time.Second)
+}
+
+// report summarizes the run.
+func (d *fleetDashboard) report() fleetReport {
+	elapsed := time.Since(d.started)
+	r := fleetReport{
+		Type:        "report",
+		Image:       d.image,
+		TargetCount: d.target,
+		Succeeded:   d.succeeded,
+		Failed:      d.failed,
+		Skipped:     d.skipped,
+		Remaining:   d.remaining(),
+		Elapsed:     elapsed.Round(time.Second).String(),
+		Failures:    d.failures,
+	}
+	if avg := d.average(); avg > 0 {
+		r.AveragePerUnit = avg.String()
+	}
+	if hours := elapsed.Hours(); hours > 0 && d.succeeded > 0 {
+		r.UnitsPerHour = math.Round(float64(d.succeeded)/hours*10) / 10
+	}
+	return r
+}
+
+// printFleetReport prints the production report in text mode.
+func printFleetReport(r fleetReport) {
+	pterm.DefaultSection.Println("Production report")
+	pterm.Info.Printf("Image: %s\n", r.Image)
+	if r.TargetCount > 0 {
+		pterm.Info.Printf("Target: %d (%d remaining)\n", r.TargetCount, r.Remaining)
+	}
+	pterm.Info.Printf("Succeeded: %d, failed: %d, skipped: %d\n", r.Succeeded, r.Failed, r.Skipped)
+	pterm.Info.Printf("Station time: %s", r.Elapsed)
+	if r.AveragePerUnit != "" {
+		pterm.Printf(", avg %s per stick, %.1f sticks/hour", r.AveragePerUnit, r.UnitsPerHour)
+	}
+	pterm.Println()
+	for _, f := range r.Failures {
+		pterm.Warning.Printf("Failed: disk %d, port %s, serial %s (%s): %s\n",
+			f.DiskNumber, f.Port, f.SerialNumber, f.FriendlyName, f.Error)
+	}
+	if r.TargetCount > 0 && r.Remaining == 0 {
+		pterm.Success.Printf("Target of %d drives reached\n", r.TargetCount)
+	}
+}
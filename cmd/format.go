@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/hooks"
 	"github.com/lazaroagomez/wusbkit/internal/lock"
 	"github.com/lazaroagomez/wusbkit/internal/output"
 	"github.com/lazaroagomez/wusbkit/internal/parallel"
@@ -26,6 +28,17 @@ var (
 	formatQuick       bool
 	formatParallel    bool
 	formatMaxConcurrent int
+	formatForce       bool
+	formatMaxSize     string
+	formatEject       bool
+	formatStartIndex  int
+	formatLayoutSpec  string
+	formatProfile     string
+	formatDriveLetter string
+	formatMountPoint  string
+	formatPrintScript bool
+	formatZap         bool
+	formatCheck       bool
 )
 
 var formatCmd = &cobra.Command{
@@ -39,25 +52,88 @@ The drive can be specified by:
   - Drive letter (e.g., E: or E)
   - Disk number (e.g., 2)
   - Multiple disks (e.g., 2,3,4 or 2-6 or 2,4-6,8)
-
-Supported filesystems: fat32, ntfs, exfat`,
+  - Serial number or hub port, with --serial, --port or --location
+  - Every USB drive, with --all (--exclude leaves drives out)
+
+Supported filesystems: fat32, ntfs, exfat, refs, udf, ext2, ext4. FAT32
+works beyond Windows' 32GB limit, up to 2TB. ReFS needs a Windows edition
+that can format it. ext2 and ext4 are written natively for Linux devices;
+Windows doesn't mount them, so they get no drive letter.
+
+The label can be a template such as KIOSK_{n:03} or SN{serial:8}, with
+drives numbered from --start-index in hub port order (see label --help).
+
+--layout creates several partitions instead of one, each with its own
+size, file system and label, e.g. a boot partition and a data partition:
+  --layout "1:16G:fat32:BOOT,2:*:ntfs:DATA"
+Each partition is number:size:fs[:label], numbered from 1 in disk order;
+a size of * takes the rest of the disk and is only allowed last. MBR
+allows up to 4 partitions. --layout also takes a YAML or JSON file:
+  partitions:
+    - {size: 16G, fs: fat32, label: BOOT}
+    - {size: "*", fs: ntfs, label: DATA}
+
+--profile sdcard formats the way the SD Association's SD Formatter does,
+for cameras and embedded boards: FAT12/16 up to 2GB, FAT32 with 32KB
+clusters up to 32GB, and exFAT with 128-512KB clusters above, with the
+partition starting on the card's boundary unit (4MB for SDHC, 16-64MB
+for SDXC).
+
+--zap zeroes the first and last 4MB of the drive before partitioning, for
+recycled drives whose leftover RAID, LVM or GPT signatures get in the way
+of a clean format (see clean).
+
+--check, with --quick=false, reads every formatted partition back after
+formatting it and reports the clusters that can't be read, so a full
+format also confirms the media is healthy.
+
+--print-script prints the diskpart commands that would do the same
+format (partitions, offsets, file systems, labels, drive letter) and
+exits without touching the drive, for review or to run with diskpart.`,
 	Example: `  wusbkit format E: --fs fat32 --label MYUSB
   wusbkit format 2 --fs ntfs --yes
   wusbkit format E: --fs exfat --label DATA --quick=false
+  wusbkit format 2 --fs ext4 --label rootfs --yes
   wusbkit format 2,3,4,5 --fs exfat --label "USB" --parallel --json --yes
   wusbkit format 2-6 --fs fat32 --parallel --yes
-  wusbkit format 2,4-6,8 --fs exfat --parallel --max-concurrent 3 --yes`,
+  wusbkit format 2,4-6,8 --fs exfat --parallel --max-concurrent 3 --yes
+  wusbkit format --port 1-4 --fs exfat --yes
+  wusbkit format 2-6 --fs exfat --label KIOSK --eject --yes
+  wusbkit format --port 1-8 --fs exfat --label "KIOSK_{n:03}" --yes
+  wusbkit format 2 --layout "1:16G:fat32:BOOT,2:*:ntfs:DATA" --yes
+  wusbkit format E: --profile sdcard --label CAMERA --yes
+  wusbkit format 2 --fs exfat --drive-letter U --yes
+  wusbkit format 2 --fs ntfs --mount-point C:\mnt\usb --yes
+  wusbkit format 2-6 --layout layout.yaml --yes
+  wusbkit format 2 --fs exfat --zap --yes
+  wusbkit format 2 --fs ntfs --quick=false --check --json --yes
+  wusbkit format 2 --layout "1:16G:fat32:BOOT,2:*:ntfs:DATA" --print-script`,
 	Args: cobra.ExactArgs(1),
 	RunE: runFormat,
 }
 
 func init() {
 	formatCmd.Flags().BoolVarP(&formatYes, "yes", "y", false, "Skip confirmation prompt")
-	formatCmd.Flags().StringVar(&formatFS, "fs", "fat32", "Filesystem type: fat32, ntfs, exfat")
-	formatCmd.Flags().StringVar(&formatLabel, "label", "USB", "Volume label")
+	formatCmd.Flags().StringVar(&formatFS, "fs", "fat32", "Filesystem type: fat32, ntfs, exfat, refs, udf, ext2, ext4")
+	formatCmd.Flags().StringVar(&formatLabel, "label", "USB", "Volume label, or a template like KIOSK_{n:03}")
+	formatCmd.Flags().IntVar(&formatStartIndex, "start-index", 1, "First number given to {n} in a label template")
+	formatCmd.Flags().StringVar(&formatLayoutSpec, "layout", "", "Several partitions, e.g. 1:16G:fat32:BOOT,2:*:ntfs:DATA, or a layout file")
+	formatCmd.Flags().StringVar(&formatProfile, "profile", "", "Format profile: sdcard (SD Association layout for the card's capacity)")
+	formatCmd.Flags().StringVar(&formatDriveLetter, "drive-letter", "", "Drive letter to give the formatted volume (e.g., U)")
+	formatCmd.Flags().StringVar(&formatMountPoint, "mount-point", "", `Empty folder to mount the formatted volume on instead of a drive letter (e.g., C:\mnt\usb)`)
+	formatCmd.Flags().BoolVar(&formatPrintScript, "print-script", false, "Print the equivalent diskpart script without formatting")
 	formatCmd.Flags().BoolVar(&formatQuick, "quick", true, "Quick format")
+	formatCmd.Flags().BoolVar(&formatCheck, "check", false, "With --quick=false, read the drive back after formatting and count bad clusters")
+	formatCmd.Flags().BoolVar(&formatZap, "zap", false, "Zero the first and last 4MB first, clearing old RAID/LVM/GPT signatures")
 	formatCmd.Flags().BoolVar(&formatParallel, "parallel", false, "Format multiple disks in parallel")
 	formatCmd.Flags().IntVar(&formatMaxConcurrent, "max-concurrent", 0, "Max concurrent operations (0=unlimited)")
+	formatCmd.Flags().StringVar(&formatMaxSize, "max-size", "", "Maximum device size to allow (e.g., 64G, 256G); larger drives are skipped when formatting several")
+	formatCmd.Flags().BoolVar(&formatEject, "eject", false, "Flush and eject each drive once it is formatted successfully")
+	formatCmd.Flags().BoolVar(&formatForce, "force", false, "Override safety protections (system disk, size limits, BitLocker-locked volumes)")
+	addBatchFlags(formatCmd)
+	addConfirmFlag(formatCmd)
+	addTargetFlags(formatCmd, targetDisks)
+	addDrivePicker(formatCmd)
 	rootCmd.AddCommand(formatCmd)
 }
 
@@ -85,8 +161,46 @@ func runSingleFormat(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := checkFormatProfile(cmd); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if err := checkFormatAccessPath(false); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if formatCheck && formatQuick {
+		errMsg := "--check reads the drive back after a full format; add --quick=false"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	partitions, err := formatLayout(cmd)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
 	// Check for admin privileges
-	if !format.IsAdmin() {
+	if !formatPrintScript && !format.IsAdmin() {
 		errMsg := "Administrator privileges required for formatting"
 		if jsonOutput {
 			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
@@ -108,6 +222,72 @@ func runSingleFormat(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if !formatForce {
+		if err := checkDriveSafety(enum, device, formatMaxSize); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+	}
+
+	// Refuse to erase encrypted data nobody has unlocked
+	if device.BitLocker == usb.BitLockerLocked && !formatForce {
+		errMsg := fmt.Sprintf("Disk %d has a BitLocker-locked volume (%s). Unlock it or use --force to override.", device.DiskNumber, device.DriveLetter)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	if err := checkLayoutFits(device, partitions); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	labels, err := driveLabels(formatLabel, []*usb.Device{device}, formatStartIndex, formatFS)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	opts := format.Options{
+		DiskNumber:  device.DiskNumber,
+		FileSystem:  formatFS,
+		Label:       labels[device.DiskNumber],
+		Quick:       formatQuick,
+		Partitions:  partitions,
+		Profile:     formatProfile,
+		DriveLetter: formatDriveLetter,
+		MountPoint:  formatMountPoint,
+		Zap:         formatZap,
+		Check:       formatCheck,
+	}
+
+	if formatPrintScript {
+		err := printFormatScripts([]*usb.Device{device}, opts, labels)
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+		}
+		return err
+	}
+
 	// Check if disk is being flashed
 	diskLock, err := lock.NewDiskLock(device.DiskNumber)
 	if err != nil {
@@ -135,6 +315,8 @@ func runSingleFormat(cmd *cobra.Command, args []string) error {
 	if !formatYes && !jsonOutput {
 		pterm.Warning.Printf("This will ERASE ALL DATA on disk %d (%s - %s)\n",
 			device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		printContentSummary(device.DiskNumber, "  ")
+		printLayout(partitions)
 
 		confirmed, _ := pterm.DefaultInteractiveConfirm.
 			WithDefaultValue(false).
@@ -147,17 +329,11 @@ func runSingleFormat(cmd *cobra.Command, args []string) error {
 	}
 
 	// Perform format
-	opts := format.Options{
-		DiskNumber: device.DiskNumber,
-		FileSystem: formatFS,
-		Label:      formatLabel,
-		Quick:      formatQuick,
-	}
-
 	formatter := format.NewFormatter()
 
 	// Start format in background
 	ctx := context.Background()
+	start := time.Now()
 	errChan := make(chan error, 1)
 
 	go func() {
@@ -182,17 +358,39 @@ func runSingleFormat(cmd *cobra.Command, args []string) error {
 			case "error":
 				spinner.Fail(progress.Error)
 			case "complete":
-				if progress.Drive != "" {
+				if progress.MountPoint != "" {
+					spinner.Success(fmt.Sprintf("Format complete! Mounted on %s", progress.MountPoint))
+				} else if progress.Drive != "" && len(progress.Volumes) == 0 {
 					spinner.Success(fmt.Sprintf("Format complete! Drive assigned: %s", progress.Drive))
 				} else {
 					spinner.Success("Format complete!")
 				}
+				if progress.BadClusters != nil {
+					if *progress.BadClusters > 0 {
+						pterm.Warning.Printf("%d bad clusters: the drive has unreadable areas\n", *progress.BadClusters)
+					} else {
+						pterm.Info.Println("No bad clusters found")
+					}
+				}
+				for _, v := range progress.Volumes {
+					drive := v.DriveLetter
+					if drive == "" {
+						drive = "no drive letter"
+					}
+					pterm.Info.Printf("  Partition %d: %s %s %q (%s)\n", v.Partition,
+						usb.FormatSize(v.Size), v.FileSystem, v.Label, drive)
+				}
 			}
 		}
 	}
 
 	// Wait for format to complete
-	if err := <-errChan; err != nil {
+	err = <-errChan
+	if err == nil && formatEject {
+		err = ejectAfter("format", device)
+	}
+	runPostHook(hooks.PostFormat, device, start, err)
+	if err != nil {
 		if !jsonOutput {
 			PrintError(err.Error(), output.ErrCodeFormatFailed)
 		}
@@ -237,8 +435,36 @@ func runParallelFormat(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := checkFormatProfile(cmd); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if err := checkFormatAccessPath(true); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if formatCheck && formatQuick {
+		errMsg := "--check reads the drive back after a full format; add --quick=false"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
 	// Check for admin privileges
-	if !format.IsAdmin() {
+	if !formatPrintScript && !format.IsAdmin() {
 		errMsg := "Administrator privileges required for formatting"
 		if jsonOutput {
 			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
@@ -248,37 +474,121 @@ func runParallelFormat(cmd *cobra.Command, args []string) error {
 		return errors.New(errMsg)
 	}
 
-	// Validate all disks exist and are USB
+	partitions, err := formatLayout(cmd)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if _, err := parseSize(formatMaxSize); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Validate all disks exist and are USB, reporting every bad target at once
 	enum := usb.NewEnumerator()
 	var deviceNames []string
+	var problems targetProblems
+	devices := make(map[int]*usb.Device, len(disks))
 	for _, diskNum := range disks {
 		device, err := enum.GetDeviceByDiskNumber(diskNum)
 		if err != nil {
-			errMsg := fmt.Sprintf("disk %d: %v", diskNum, err)
-			if jsonOutput {
-				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
-			} else {
-				PrintError(errMsg, output.ErrCodeUSBNotFound)
-			}
-			return fmt.Errorf("disk %d: %w", diskNum, err)
+			problems.add(output.ErrCodeUSBNotFound, fmt.Sprintf("disk %d: %v", diskNum, err))
+			continue
 		}
 		if device == nil {
-			errMsg := fmt.Sprintf("disk %d: not found or not a USB device", diskNum)
+			problems.add(output.ErrCodeUSBNotFound, fmt.Sprintf("disk %d: not found or not a USB device", diskNum))
+			continue
+		}
+		if !formatForce {
+			if err := checkDriveSafety(enum, device, formatMaxSize); err != nil {
+				problems.add(output.ErrCodeInvalidInput, err.Error())
+				continue
+			}
+			if device.BitLocker == usb.BitLockerLocked {
+				problems.add(output.ErrCodeInvalidInput,
+					fmt.Sprintf("disk %d has a BitLocker-locked volume (%s)", diskNum, device.DriveLetter))
+				continue
+			}
+		}
+		if err := checkLayoutFits(device, partitions); err != nil {
+			problems.add(output.ErrCodeInvalidInput, err.Error())
+			continue
+		}
+		deviceNames = append(deviceNames, fmt.Sprintf("%d (%s - %s)", diskNum, device.FriendlyName, device.SizeHuman))
+		devices[diskNum] = device
+	}
+	if err := problems.report(len(disks)); err != nil {
+		return err
+	}
+
+	deviceList := make([]*usb.Device, len(disks))
+	for i, diskNum := range disks {
+		deviceList[i] = devices[diskNum]
+	}
+	labels, err := driveLabels(formatLabel, deviceList, formatStartIndex, formatFS)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Build options
+	opts := format.Options{
+		FileSystem: formatFS,
+		Label:      formatLabel,
+		Quick:      formatQuick,
+		Partitions: partitions,
+		Profile:    formatProfile,
+		Zap:        formatZap,
+		Check:      formatCheck,
+	}
+
+	if formatPrintScript {
+		err := printFormatScripts(deviceList, opts, labels)
+		if err != nil {
 			if jsonOutput {
-				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
 			} else {
-				PrintError(errMsg, output.ErrCodeUSBNotFound)
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
 			}
-			return fmt.Errorf("disk %d: not found or not a USB device", diskNum)
 		}
-		deviceNames = append(deviceNames, fmt.Sprintf("%d (%s - %s)", diskNum, device.FriendlyName, device.SizeHuman))
+		return err
 	}
 
 	// Confirmation prompt (unless --yes or --json)
 	if !formatYes && !jsonOutput {
 		pterm.Warning.Printf("This will ERASE ALL DATA on %d drives:\n", len(disks))
-		for _, name := range deviceNames {
+		for i, name := range deviceNames {
+			if labels[disks[i]] != formatLabel {
+				name += " -> " + labels[disks[i]]
+			}
 			pterm.Info.Printf("  Disk %s\n", name)
+			printContentSummary(disks[i], "    ")
+		}
+		if len(partitions) > 0 {
+			printLayout(partitions)
+		} else if formatProfile != "" {
+			pterm.Info.Printf("Profile: %s (file system chosen by capacity)\n", formatProfile)
+			if formatLabel != "" {
+				pterm.Info.Printf("Label: %s\n", formatLabel)
+			}
+		} else {
+			pterm.Info.Printf("File system: %s\n", formatFS)
+			if formatLabel != "" {
+				pterm.Info.Printf("Label: %s\n", formatLabel)
+			}
 		}
 
 		confirmed, _ := pterm.DefaultInteractiveConfirm.
@@ -291,13 +601,6 @@ func runParallelFormat(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Build options
-	opts := format.Options{
-		FileSystem: formatFS,
-		Label:      formatLabel,
-		Quick:      formatQuick,
-	}
-
 	// Setup context with cancellation for Ctrl+C
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -314,21 +617,131 @@ func runParallelFormat(cmd *cobra.Command, args []string) error {
 	}()
 
 	// Execute parallel format
-	executor := parallel.NewExecutor(formatMaxConcurrent, jsonOutput)
+	executor := newBatchExecutor(formatMaxConcurrent, len(disks))
+	executor.SetEject(formatEject)
+	setBatchHooks(executor, "", hooks.PostFormat, devices)
 
 	if !jsonOutput {
 		pterm.Info.Printf("Formatting %d drives in parallel...\n", len(disks))
 	}
 
-	result := executor.FormatAll(ctx, disks, opts)
+	result := executor.FormatAll(ctx, disks, opts, labels)
 
 	// Output result (non-JSON mode - JSON mode streams NDJSON)
 	if !jsonOutput {
 		parallel.PrintBatchResult(result, "Formatted")
 	}
 
-	if result.Failed > 0 {
-		return fmt.Errorf("%d drives failed to format", result.Failed)
+	return finishBatch(result, "format")
+}
+
+// formatLayout returns the partitions of --layout, given as a spec or the
+// path of a layout file, or nil without it. --layout sets each partition's
+// file system and label, so it can't be combined with --fs and --label.
+func formatLayout(cmd *cobra.Command) ([]format.Partition, error) {
+	if formatLayoutSpec == "" {
+		return nil, nil
+	}
+	if cmd.Flags().Changed("fs") || cmd.Flags().Changed("label") {
+		return nil, errors.New("--layout sets each partition's file system and label; drop --fs and --label")
+	}
+	if info, err := os.Stat(formatLayoutSpec); err == nil && !info.IsDir() {
+		return format.ReadLayoutFile(formatLayoutSpec)
+	}
+	return format.ParseLayout(formatLayoutSpec)
+}
+
+// checkFormatProfile validates --profile. A profile picks the file system
+// and partition itself, so it can't be combined with --fs and --layout.
+func checkFormatProfile(cmd *cobra.Command) error {
+	if formatProfile == "" {
+		return nil
+	}
+	if err := format.ValidateProfile(formatProfile); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("fs") || formatLayoutSpec != "" {
+		return fmt.Errorf("--profile %s picks the file system and partition; drop --fs and --layout", formatProfile)
+	}
+	return nil
+}
+
+// formatScript is the JSON output of format --print-script.
+type formatScript struct {
+	DiskNumber int    `json:"diskNumber"`
+	Script     string `json:"script"`
+}
+
+// printFormatScripts prints, for --print-script, the diskpart equivalent of
+// formatting each drive with opts, without touching the drives.
+func printFormatScripts(devices []*usb.Device, opts format.Options, labels map[int]string) error {
+	var scripts []formatScript
+	for _, device := range devices {
+		opts.DiskNumber = device.DiskNumber
+		opts.Label = labels[device.DiskNumber]
+		script, err := format.DiskpartScript(opts, device.Size)
+		if err != nil {
+			return fmt.Errorf("disk %d: %w", device.DiskNumber, err)
+		}
+		scripts = append(scripts, formatScript{DiskNumber: device.DiskNumber, Script: script})
+	}
+
+	if jsonOutput {
+		if len(scripts) == 1 {
+			return output.PrintJSON(scripts[0])
+		}
+		return output.PrintJSON(scripts)
+	}
+	for i, s := range scripts {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(strings.ReplaceAll(s.Script, "\r\n", "\n"))
+	}
+	return nil
+}
+
+// checkFormatAccessPath validates --drive-letter and --mount-point, which
+// give one volume a fixed path: they can't be combined, nor used with
+// several drives (batch), several partitions, or ext, which Windows doesn't
+// mount.
+func checkFormatAccessPath(batch bool) error {
+	if formatDriveLetter == "" && formatMountPoint == "" {
+		return nil
+	}
+	switch {
+	case formatDriveLetter != "" && formatMountPoint != "":
+		return errors.New("--drive-letter and --mount-point can't be combined")
+	case batch:
+		return errors.New("--drive-letter and --mount-point give one drive a fixed path; format drives one at a time to use them")
+	case formatLayoutSpec != "":
+		return errors.New("--drive-letter and --mount-point can't be combined with --layout")
+	case strings.HasPrefix(strings.ToLower(formatFS), "ext"):
+		return fmt.Errorf("%s volumes aren't mounted by Windows, so they can't get a drive letter or mount point", formatFS)
 	}
 	return nil
 }
+
+// checkLayoutFits checks that a drive is large enough for a layout's
+// fixed-size partitions.
+func checkLayoutFits(device *usb.Device, partitions []format.Partition) error {
+	if len(partitions) == 0 || device.Size == 0 {
+		return nil
+	}
+	if need := format.LayoutSize(partitions); need > device.Size {
+		return fmt.Errorf("disk %d (%s) is too small for the layout, which needs %s",
+			device.DiskNumber, device.SizeHuman, usb.FormatSize(need))
+	}
+	return nil
+}
+
+// printLayout lists the partitions of a --layout before formatting.
+func printLayout(partitions []format.Partition) {
+	for i, p := range partitions {
+		size := "rest of the disk"
+		if p.Size > 0 {
+			size = usb.FormatSize(p.Size)
+		}
+		pterm.Info.Printf("Partition %d: %s, %s, label %q\n", i+1, size, p.FileSystem, p.Label)
+	}
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/fsck"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fsckFix           bool
+	fsckParallel      bool
+	fsckMaxConcurrent int
+)
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck <drive>",
+	Short: "Check the file systems of a USB drive",
+	Long: `Check the file system of every volume on a USB drive with chkdsk and
+report the result: whether errors were found, whether they were fixed, and
+how many clusters are marked bad.
+
+The check is read-only unless --fix is given, which repairs the errors
+found (chkdsk /f), dismounting each volume first; files open on the drive
+are closed. A drive left with errors fails the command, so scripts and
+batch runs can tell healthy drives from the others.
+
+Bad cluster counts are read from chkdsk's English output; in other display
+languages only the errors found and fixed are reported. ext volumes, which
+Windows doesn't mount, aren't checked.
+
+The drive can be specified by drive letter, disk number or several disks
+(e.g., 2,3,4 or 2-6), which are checked in parallel. --all selects every
+USB drive except system disks; --exclude leaves drives out.`,
+	Example: `  wusbkit fsck E:
+  wusbkit fsck 2 --fix
+  wusbkit fsck 2-6 --json
+  wusbkit fsck --all --fix --report fsck.json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFsck,
+}
+
+func init() {
+	fsckCmd.Flags().BoolVar(&fsckFix, "fix", false, "Repair the errors found (dismounts each volume)")
+	fsckCmd.Flags().BoolVar(&fsckParallel, "parallel", false, "Check multiple disks in parallel")
+	fsckCmd.Flags().IntVar(&fsckMaxConcurrent, "max-concurrent", 0, "Max concurrent operations (0=unlimited)")
+	addBatchFlags(fsckCmd)
+	addTargetFlags(fsckCmd, targetDisks)
+	rootCmd.AddCommand(fsckCmd)
+}
+
+func runFsck(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to check file systems"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	opts := fsck.Options{Fix: fsckFix}
+	if fsckParallel || parallel.IsMultiDiskArg(identifier) {
+		return runParallelFsck(identifier, opts)
+	}
+	return runSingleFsck(identifier, opts)
+}
+
+func runSingleFsck(identifier string, opts fsck.Options) error {
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts.DiskNumber = device.DiskNumber
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Checking disk %d (%s)...", device.DiskNumber, device.FriendlyName))
+		opts.Progress = func(stage string, percentage int) {
+			spinner.UpdateText(fmt.Sprintf("%s (%d%%)", stage, percentage))
+		}
+	}
+
+	result, err := fsck.Check(ctx, opts)
+	if result == nil {
+		if spinner != nil {
+			spinner.Fail(err.Error())
+		}
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		if printErr := output.PrintJSON(result); printErr != nil {
+			return printErr
+		}
+		return err
+	}
+
+	switch {
+	case err != nil:
+		spinner.Fail(err.Error())
+	case result.ErrorsFixed:
+		spinner.Success("File system errors found and fixed")
+	default:
+		spinner.Success("No file system errors found")
+	}
+	for _, v := range result.Volumes {
+		name := v.DriveLetter
+		if name == "" {
+			name = v.Volume
+		}
+		switch {
+		case v.Error != "":
+			pterm.Warning.Printf("  %s: not checked: %s\n", name, v.Error)
+		case v.ErrorsFixed:
+			pterm.Info.Printf("  %s (%s): errors fixed, %d bad clusters\n", name, v.FileSystem, v.BadClusters)
+		case v.ErrorsFound:
+			pterm.Error.Printf("  %s (%s): errors found, %d bad clusters\n", name, v.FileSystem, v.BadClusters)
+		default:
+			pterm.Info.Printf("  %s (%s): healthy, %d bad clusters\n", name, v.FileSystem, v.BadClusters)
+		}
+	}
+	return err
+}
+
+func runParallelFsck(identifier string, opts fsck.Options) error {
+	disks, err := parallel.ParseDisks(identifier)
+	if err == nil && len(disks) == 0 {
+		err = errors.New("no valid disk numbers provided")
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Validate all disks exist and are USB
+	enum := usb.NewEnumerator()
+	for _, diskNum := range disks {
+		device, err := enum.GetDeviceByDiskNumber(diskNum)
+		if err == nil && device == nil {
+			err = errors.New("not found or not a USB device")
+		}
+		if err != nil {
+			errMsg := fmt.Sprintf("disk %d: %v", diskNum, err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
+			} else {
+				PrintError(errMsg, output.ErrCodeUSBNotFound)
+			}
+			return fmt.Errorf("disk %d: %w", diskNum, err)
+		}
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	executor := newBatchExecutor(fsckMaxConcurrent, len(disks))
+	if !jsonOutput {
+		pterm.Info.Printf("Checking %d drives in parallel...\n", len(disks))
+	}
+
+	result := executor.FsckAll(ctx, disks, opts)
+
+	// Output result (non-JSON mode - JSON mode streams NDJSON)
+	if !jsonOutput {
+		parallel.PrintBatchResult(result, "Checked")
+	}
+
+	return finishBatch(result, "pass the check")
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/hooks"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+)
+
+// driveHookPayload is what a per-drive hook reads on stdin.
+type driveHookPayload struct {
+	Hook   string                    `json:"hook"`
+	Device *usb.Device               `json:"device"`
+	Result *parallel.OperationResult `json:"result,omitempty"` // Not set for pre- hooks
+}
+
+// batchHookPayload is what the post-batch hook reads on stdin.
+type batchHookPayload struct {
+	Hook      string               `json:"hook"`
+	Operation string               `json:"operation"`
+	Result    parallel.BatchResult `json:"result"`
+}
+
+// runDriveHook runs a per-drive hook for device, with result for post-
+// hooks.
+func runDriveHook(ctx context.Context, event string, device *usb.Device, result *parallel.OperationResult) error {
+	env := map[string]string{
+		"WUSBKIT_DISK_NUMBER":  strconv.Itoa(device.DiskNumber),
+		"WUSBKIT_SERIAL":       strings.TrimSpace(device.SerialNumber),
+		"WUSBKIT_DRIVE_LETTER": device.DriveLetter,
+	}
+	if result != nil {
+		env["WUSBKIT_SUCCESS"] = strconv.FormatBool(result.Success)
+		env["WUSBKIT_ERROR"] = result.Error
+	}
+	return hooks.Run(ctx, event, driveHookPayload{Hook: event, Device: device, Result: result}, env)
+}
+
+// runPostHook runs a post- hook for a drive an operation started at start
+// finished with err. The operation is done either way, so a failing hook
+// is only warned about.
+func runPostHook(event string, device *usb.Device, start time.Time, err error) {
+	result := parallel.OperationResult{
+		DiskNumber: device.DiskNumber,
+		Serial:     strings.TrimSpace(device.SerialNumber),
+		Success:    err == nil,
+		Error:      errorText(err),
+		Duration:   time.Since(start).String(),
+	}
+	if err := runDriveHook(context.Background(), event, device, &result); err != nil {
+		warnHook(err)
+	}
+}
+
+// setBatchHooks makes a multi-disk run call the pre and post hooks (either
+// may be "") for each of devices, keyed by disk number.
+func setBatchHooks(executor *parallel.Executor, pre, post string, devices map[int]*usb.Device) {
+	var before func(ctx context.Context, diskNum int) error
+	if pre != "" && hooks.Command(pre) != "" {
+		before = func(ctx context.Context, diskNum int) error {
+			return runDriveHook(ctx, pre, devices[diskNum], nil)
+		}
+	}
+	var after func(result parallel.OperationResult)
+	if post != "" && hooks.Command(post) != "" {
+		after = func(result parallel.OperationResult) {
+			result.Serial = strings.TrimSpace(devices[result.DiskNumber].SerialNumber)
+			if err := runDriveHook(context.Background(), post, devices[result.DiskNumber], &result); err != nil {
+				warnHook(err)
+			}
+		}
+	}
+	executor.SetHooks(before, after)
+}
+
+// runBatchHook runs the post-batch hook for a finished multi-disk run.
+func runBatchHook(result parallel.BatchResult) {
+	env := map[string]string{
+		"WUSBKIT_OPERATION": batchCommand,
+		"WUSBKIT_TOTAL":     strconv.Itoa(result.Total),
+		"WUSBKIT_SUCCEEDED": strconv.Itoa(result.Succeeded),
+		"WUSBKIT_FAILED":    strconv.Itoa(result.Failed),
+	}
+	payload := batchHookPayload{Hook: hooks.PostBatch, Operation: batchCommand, Result: result}
+	if err := hooks.Run(context.Background(), hooks.PostBatch, payload, env); err != nil {
+		warnHook(err)
+	}
+}
+
+func warnHook(err error) {
+	if !jsonOutput {
+		pterm.Warning.Println(err.Error())
+	}
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// HTTP flags shared by commands that download images (flash, image pull)
+var (
+	httpRetries     int
+	httpRetryDelay  time.Duration
+	httpHeaders     []string
+	httpBearerToken string
+	httpUser        string
+	httpProxy       string
+)
+
+// addHTTPFlags registers the flags controlling URL downloads on cmd.
+func addHTTPFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&httpRetries, "http-retries", 5, "Times to retry or resume a URL download after a network error (0=off)")
+	cmd.Flags().DurationVar(&httpRetryDelay, "http-retry-delay", 2*time.Second, "Initial wait between URL retries, doubled on each attempt")
+	cmd.Flags().StringArrayVar(&httpHeaders, "header", nil, "Extra HTTP header for URL images, as 'Name: value' (repeatable)")
+	cmd.Flags().StringVar(&httpBearerToken, "bearer-token", "", "Bearer token for URL images (default: $WUSBKIT_BEARER_TOKEN)")
+	cmd.Flags().StringVar(&httpUser, "http-user", "", "HTTP basic auth for URL images, as user[:password] (prompts if password omitted)")
+	cmd.Flags().StringVar(&httpProxy, "proxy", "", "Proxy URL for URL images (default: $HTTPS_PROXY/$HTTP_PROXY)")
+}
+
+// resolveHTTPOptions builds the fetch settings for URL images from the flags
+// registered by addHTTPFlags, prompting for a basic auth password if
+// --http-user doesn't include one.
+func resolveHTTPOptions(imagePath string) (flash.HTTPOptions, error) {
+	opts := flash.HTTPOptions{
+		Retries:     max(httpRetries, 0),
+		RetryDelay:  httpRetryDelay,
+		BearerToken: httpBearerToken,
+		Proxy:       httpProxy,
+	}
+	if opts.BearerToken == "" {
+		opts.BearerToken = os.Getenv("WUSBKIT_BEARER_TOKEN")
+	}
+
+	if len(httpHeaders) > 0 {
+		opts.Header = make(http.Header)
+		for _, h := range httpHeaders {
+			name, value, ok := strings.Cut(h, ":")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				return opts, fmt.Errorf("invalid --header %q: expected 'Name: value'", h)
+			}
+			opts.Header.Add(name, strings.TrimSpace(value))
+		}
+	}
+
+	if httpUser != "" {
+		if httpBearerToken != "" {
+			return opts, errors.New("--http-user and --bearer-token are mutually exclusive")
+		}
+		user, password, err := splitCredentials("--http-user", httpUser, flash.IsURL(imagePath))
+		if err != nil {
+			return opts, err
+		}
+		opts.BearerToken = ""
+		opts.Username = user
+		opts.Password = password
+	}
+
+	return opts, nil
+}
+
+// splitCredentials splits a user[:password] flag value. If the password is
+// omitted and prompt is set, it is read interactively (never in JSON mode).
+func splitCredentials(flagName, value string, prompt bool) (user, password string, err error) {
+	user, password, hasPassword := strings.Cut(value, ":")
+	if hasPassword || !prompt {
+		return user, password, nil
+	}
+	if jsonOutput {
+		return "", "", fmt.Errorf("%s needs user:password in JSON mode", flagName)
+	}
+	password, err = pterm.DefaultInteractiveTextInput.
+		WithMask("*").
+		Show(fmt.Sprintf("Password for %s", user))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return user, password, nil
+}
@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/cache"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	imageCacheDir     string
+	imageExpectedHash string
+	imageChecksumFile string
+	imageUnusedFor    string
+)
+
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Manage the local image cache",
+	Long: `Download remote images into a local content-addressed cache.
+
+Pulled images are stored exactly as downloaded (still compressed) under
+%LOCALAPPDATA%\wusbkit\images, or $WUSBKIT_CACHE_DIR if set. When flashing
+a URL that has been pulled, the cached copy is used instead of streaming it
+again; pass --no-cache to flash to bypass it.`,
+}
+
+var imagePullCmd = &cobra.Command{
+	Use:   "pull <url>",
+	Short: "Download an image into the cache",
+	Example: `  wusbkit image pull https://example.com/raspios.img.xz
+  wusbkit image pull https://example.com/ubuntu.iso --checksum-file https://example.com/SHA256SUMS`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImagePull,
+}
+
+var imageListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List cached images",
+	Example: `  wusbkit image list --json`,
+	Args:    cobra.NoArgs,
+	RunE:    runImageList,
+}
+
+var imageVerifyCmd = &cobra.Command{
+	Use:     "verify",
+	Short:   "Re-hash cached images and check them against their stored digests",
+	Example: `  wusbkit image verify`,
+	Args:    cobra.NoArgs,
+	RunE:    runImageVerify,
+}
+
+var imageRmCmd = &cobra.Command{
+	Use:   "rm <url|name|sha256-prefix>...",
+	Short: "Remove images from the cache",
+	Example: `  wusbkit image rm raspios.img.xz
+  wusbkit image rm 3f2a9c1e`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runImageRm,
+}
+
+var imageGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove partial downloads, orphaned files and unused images",
+	Example: `  wusbkit image gc
+  wusbkit image gc --unused-for 30d`,
+	Args: cobra.NoArgs,
+	RunE: runImageGC,
+}
+
+func init() {
+	imageCmd.PersistentFlags().StringVar(&imageCacheDir, "cache-dir", "", "Cache directory (default: %LOCALAPPDATA%\\wusbkit\\images)")
+	imagePullCmd.Flags().StringVar(&imageExpectedHash, "expected-hash", "", "Expected image digest, as hex or algo:hex (md5, sha1, sha256, sha512)")
+	imagePullCmd.Flags().StringVar(&imageChecksumFile, "checksum-file", "", "Checksum sidecar to verify the download against (e.g. SHA256SUMS)")
+	addHTTPFlags(imagePullCmd)
+	imageGCCmd.Flags().StringVar(&imageUnusedFor, "unused-for", "", "Also remove images not pulled or flashed for this long (e.g. 30d, 12h)")
+
+	imageCmd.AddCommand(imagePullCmd, imageListCmd, imageVerifyCmd, imageRmCmd, imageGCCmd)
+	rootCmd.AddCommand(imageCmd)
+}
+
+// openImageCache opens the cache selected by --cache-dir, printing any error.
+func openImageCache() (*cache.Cache, error) {
+	c, err := cache.Open(imageCacheDir)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// signalContext returns a context cancelled on Ctrl+C or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func runImagePull(cmd *cobra.Command, args []string) error {
+	url := args[0]
+	if !flash.IsURL(url) {
+		errMsg := fmt.Sprintf("not an HTTP/HTTPS URL: %s", url)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	httpOpts, err := resolveHTTPOptions(url)
+	if err == nil {
+		var expected flash.ExpectedHash
+		expected, err = resolveExpectedHash(imageExpectedHash, imageChecksumFile, url, httpOpts)
+		if err == nil {
+			return pullImage(url, httpOpts, expected)
+		}
+	}
+	if jsonOutput {
+		output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+	} else {
+		PrintError(err.Error(), output.ErrCodeInvalidInput)
+	}
+	return err
+}
+
+func pullImage(url string, httpOpts flash.HTTPOptions, expected flash.ExpectedHash) error {
+	c, err := openImageCache()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var spinner *pterm.SpinnerPrinter
+	var onProgress func(done, total int64)
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start("Downloading...")
+		start := time.Now()
+		lastUpdate := time.Time{}
+		onProgress = func(done, total int64) {
+			if time.Since(lastUpdate) < 250*time.Millisecond {
+				return
+			}
+			lastUpdate = time.Now()
+			text := fmt.Sprintf("Downloading | %s", flash.FormatBytes(done))
+			if total > 0 {
+				text = fmt.Sprintf("Downloading %d%% | %s / %s", done*100/total,
+					flash.FormatBytes(done), flash.FormatBytes(total))
+			}
+			if secs := time.Since(start).Seconds(); secs > 0 {
+				text += fmt.Sprintf(" | %s/s", flash.FormatBytes(int64(float64(done)/secs)))
+			}
+			spinner.UpdateText(text)
+		}
+	}
+
+	entry, err := c.Pull(ctx, url, httpOpts, expected, onProgress)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			spinner.Fail(err.Error())
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(entry)
+	}
+	spinner.Success(fmt.Sprintf("Cached %s (%s)", entry.Name, flash.FormatBytes(entry.Size)))
+	pterm.Info.Printfln("SHA-256: %s", entry.SHA256)
+	if expected.IsSet() {
+		pterm.Info.Printfln("Checksum: %s verified", expected.Algorithm)
+	}
+	return nil
+}
+
+func runImageList(cmd *cobra.Command, args []string) error {
+	c, err := openImageCache()
+	if err != nil {
+		return err
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(entries)
+	}
+
+	if len(entries) == 0 {
+		pterm.Info.Printfln("No cached images in %s", c.Dir())
+		return nil
+	}
+
+	tableData := pterm.TableData{{"SHA-256", "Name", "Size", "Pulled", "Last Used", "URL"}}
+	for _, e := range entries {
+		tableData = append(tableData, []string{
+			e.SHA256[:12],
+			e.Name,
+			flash.FormatBytes(e.Size),
+			e.PulledAt.Format("2006-01-02 15:04"),
+			e.LastUsed.Format("2006-01-02 15:04"),
+			e.URL,
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(tableData).Render()
+	return nil
+}
+
+func runImageVerify(cmd *cobra.Command, args []string) error {
+	c, err := openImageCache()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var spinner *pterm.SpinnerPrinter
+	var onProgress func(e cache.Entry, done, total int64)
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start("Verifying cached images...")
+		onProgress = func(e cache.Entry, done, total int64) {
+			if total > 0 {
+				spinner.UpdateText(fmt.Sprintf("Verifying %s %d%%", e.Name, done*100/total))
+			}
+		}
+	}
+
+	results, err := c.Verify(ctx, onProgress)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			spinner.Fail(err.Error())
+		}
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+
+	if jsonOutput {
+		if err := output.PrintJSON(results); err != nil {
+			return err
+		}
+	} else {
+		spinner.Stop()
+		for _, r := range results {
+			switch {
+			case r.OK:
+				pterm.Success.Printfln("%s  %s", r.SHA256[:12], r.Name)
+			case r.Error != "":
+				pterm.Error.Printfln("%s  %s: %s", r.SHA256[:12], r.Name, r.Error)
+			default:
+				pterm.Error.Printfln("%s  %s: corrupt (now hashes to %s)", r.SHA256[:12], r.Name, r.Actual[:12])
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cached images failed verification", failed, len(results))
+	}
+	return nil
+}
+
+func runImageRm(cmd *cobra.Command, args []string) error {
+	c, err := openImageCache()
+	if err != nil {
+		return err
+	}
+
+	var removed []cache.Entry
+	for _, query := range args {
+		entries, err := c.Remove(query)
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+		removed = append(removed, entries...)
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(removed)
+	}
+	for _, e := range removed {
+		pterm.Success.Printfln("Removed %s (%s)", e.Name, e.URL)
+	}
+	return nil
+}
+
+func runImageGC(cmd *cobra.Command, args []string) error {
+	unusedFor, err := parseAge(imageUnusedFor)
+	if err != nil {
+		errMsg := fmt.Sprintf("--unused-for: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	c, err := openImageCache()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.GC(unusedFor)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(result)
+	}
+	pterm.Success.Printfln("Removed %d item(s), freed %s", len(result.Removed), flash.FormatBytes(result.Freed))
+	return nil
+}
+
+// parseAge parses a duration that may also be given in days (e.g. "30d").
+// An empty string is zero.
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// useCachedImage resolves a URL image to its copy in the image cache, if it
+// has been pulled. Returns the path to read the image from and the original
+// image argument, for checksum lookups and reports.
+func useCachedImage(image string) (path, original string) {
+	if flashNoCache || !flash.IsURL(image) {
+		return image, image
+	}
+
+	c, err := cache.Open("")
+	if err != nil {
+		return image, image
+	}
+	if entry, ok := c.Lookup(image); ok {
+		if !jsonOutput {
+			pterm.Info.Printfln("Using cached copy of %s", entry.Name)
+		}
+		return entry.Path, image
+	}
+	return image, image
+}
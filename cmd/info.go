@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/lazaroagomez/wusbkit/internal/disk"
 	"github.com/lazaroagomez/wusbkit/internal/output"
 	"github.com/lazaroagomez/wusbkit/internal/usb"
 	"github.com/spf13/cobra"
@@ -14,6 +15,11 @@ var infoCmd = &cobra.Command{
 	Short: "Show detailed information for a USB drive",
 	Long: `Display detailed information about a specific USB storage device.
 
+Drives that expose health data (usually USB-to-SATA/NVMe enclosures, rarely
+plain sticks) also show their temperature, power-on hours and wear, under
+"smart" in JSON output. Reading it needs administrator privileges; see the
+smart command for the full attribute table.
+
 The drive can be specified by:
   - Drive letter (e.g., E: or E)
   - Disk number (e.g., 2)`,
@@ -26,6 +32,7 @@ The drive can be specified by:
 }
 
 func init() {
+	addTargetFlags(infoCmd, targetSingle)
 	rootCmd.AddCommand(infoCmd)
 }
 
@@ -61,6 +68,12 @@ func runInfo(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Health data is best-effort: most sticks don't expose any, and it
+	// needs administrator privileges
+	if smart, err := disk.QuerySmart(device.DiskNumber); err == nil {
+		device.Smart = smart
+	}
+
 	// Output results
 	if jsonOutput {
 		return output.PrintJSON(device)
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	initStyle   string
+	initYes     bool
+	initForce   bool
+	initMaxSize string
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init <drive>",
+	Short: "Initialize a USB drive with an empty MBR or GPT",
+	Long: `Clear a USB drive (see clean) and initialize it with an empty MBR or GPT
+partition table, without creating or formatting any partitions, for
+workflows where another tool lays down the partitions afterwards.
+
+WARNING: The drive's partitions will be GONE and its data inaccessible!
+
+The new table gets a random disk signature (MBR) or disk GUID (GPT),
+reported in the result. Windows then shows the drive as an initialized
+disk with all of its space unallocated.`,
+	Example: `  wusbkit init 2 --style gpt
+  wusbkit init E: --style mbr --yes --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runInit,
+}
+
+func init() {
+	initCmd.Flags().StringVar(&initStyle, "style", "gpt", "Partition style: gpt or mbr")
+	initCmd.Flags().BoolVarP(&initYes, "yes", "y", false, "Skip confirmation prompt")
+	initCmd.Flags().StringVar(&initMaxSize, "max-size", "", "Maximum device size to allow (e.g., 64G, 256G)")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Override safety protections (system disk, size limits)")
+	addConfirmFlag(initCmd)
+	addTargetFlags(initCmd, targetSingle)
+	addDrivePicker(initCmd)
+	rootCmd.AddCommand(initCmd)
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	if err := flash.ValidatePartitionStyle(initStyle); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+	if !initForce {
+		if err := checkDriveSafety(enum, device, initMaxSize); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !initYes && !jsonOutput {
+		pterm.Warning.Printf("This will REMOVE ALL PARTITIONS on disk %d (%s - %s)\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		printContentSummary(device.DiskNumber, "  ")
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show(fmt.Sprintf("Initialize as %s?", strings.ToUpper(initStyle)))
+		if !confirmed {
+			pterm.Info.Println("Initialize cancelled")
+			return nil
+		}
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Initializing disk %d...", device.DiskNumber))
+	}
+
+	result, err := flash.Initialize(device.DiskNumber, device.DriveLetter, initStyle)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			spinner.Fail(err.Error())
+		}
+		return err
+	}
+
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+		return nil
+	}
+	spinner.Success(fmt.Sprintf("Disk %d initialized as %s (disk ID %s)", result.DiskNumber,
+		strings.ToUpper(result.Style), result.DiskID))
+	return nil
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inspectZipEntry string
+	inspectHashAlgo []string
+	inspectNoHash   bool
+)
+
+var inspectImageCmd = &cobra.Command{
+	Use:   "inspect-image <path|url>",
+	Short: "Show what an image contains without writing it",
+	Long: `Open an image and report its size, partition table, filesystems, volume
+labels, detected OS/distribution and hashes. No device is touched.
+
+Accepts every source flash does: local files, UNC paths, URLs, and
+.zip/.7z/.gz/.xz/.zst images. Hashes are computed over the uncompressed
+image and require reading all of it; pass --no-hash for a quick look.`,
+	Example: `  wusbkit inspect-image ubuntu-24.04-desktop-amd64.iso
+  wusbkit inspect-image raspios.img.xz --hash-algo sha256,md5
+  wusbkit inspect-image https://example.com/image.img.gz --no-hash --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runInspectImage,
+}
+
+func init() {
+	inspectImageCmd.Flags().StringVar(&inspectZipEntry, "zip-entry", "", "File inside a .zip/.7z archive to inspect (default: first image)")
+	inspectImageCmd.Flags().StringSliceVar(&inspectHashAlgo, "hash-algo", []string{"sha256"}, "Hashes to compute: md5, sha1, sha256, sha512 (comma-separated)")
+	inspectImageCmd.Flags().BoolVar(&inspectNoHash, "no-hash", false, "Skip hashing; only read as much of the image as needed")
+	addHTTPFlags(inspectImageCmd)
+	rootCmd.AddCommand(inspectImageCmd)
+}
+
+func runInspectImage(cmd *cobra.Command, args []string) error {
+	imagePath := args[0]
+
+	httpOpts, err := resolveHTTPOptions(imagePath)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	opts := flash.InspectOptions{
+		Source: flash.SourceOptions{ArchiveEntry: inspectZipEntry, HTTP: httpOpts},
+	}
+	if !inspectNoHash {
+		opts.HashAlgorithms = inspectHashAlgo
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var spinner *pterm.SpinnerPrinter
+	var onProgress func(done, total int64)
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start("Reading image...")
+		lastUpdate := time.Time{}
+		onProgress = func(done, total int64) {
+			if time.Since(lastUpdate) < 250*time.Millisecond {
+				return
+			}
+			lastUpdate = time.Now()
+			text := fmt.Sprintf("Reading image | %s", flash.FormatBytes(done))
+			if total > 0 {
+				text = fmt.Sprintf("Reading image %d%% | %s / %s", done*100/total,
+					flash.FormatBytes(done), flash.FormatBytes(total))
+			}
+			spinner.UpdateText(text)
+		}
+	}
+
+	info, err := flash.InspectImage(ctx, imagePath, opts, onProgress)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			spinner.Fail(err.Error())
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(info)
+	}
+	spinner.Stop()
+	output.PrintImageInfo(info)
+	return nil
+}
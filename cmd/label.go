@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/label"
 	"github.com/lazaroagomez/wusbkit/internal/output"
 	"github.com/lazaroagomez/wusbkit/internal/parallel"
 	"github.com/lazaroagomez/wusbkit/internal/usb"
@@ -21,39 +25,89 @@ var (
 	labelName          string
 	labelParallel      bool
 	labelMaxConcurrent int
+	labelStartIndex    int
+	labelGet           bool
+	labelClear         bool
 )
 
 var labelCmd = &cobra.Command{
 	Use:   "label <drive>",
-	Short: "Set volume label for a USB drive",
+	Short: "Set, read or clear the volume label of a USB drive",
 	Long: `Changes the volume label of a USB drive without reformatting.
 
+--get prints the current label instead, and --clear removes it. When a
+label is changed, the label it replaced is reported too.
+
 The drive can be specified by:
   - Drive letter (e.g., E: or E)
   - Disk number (e.g., 2)
   - Multiple drives (e.g., E,F,G or 2,3,4 or 2-6)
+  - Serial number or hub port, with --serial, --port or --location
+  - Every USB drive, with --all (--exclude leaves drives out)
+
+The name can be a template, so a batch of drives gets distinct labels:
+  {n}        Drive's number, counting from --start-index in hub port
+             order; {n:03} pads it to 3 digits
+  {serial}   Serial number; {serial:6} keeps its last 6 characters
+  {port}     Hub port number
+  {disk}     Disk number
+  {date}     Today as YYYYMMDD
+FAT32 and exFAT labels are limited to 11 characters, NTFS to 32.
 
 This operation does not require administrator privileges for USB drives.`,
 	Example: `  wusbkit label E: --name "BACKUP_001"
   wusbkit label F --name "USB_DATA" --json
   wusbkit label E,F,G --name "USB_DATA" --parallel
   wusbkit label 2,3,4 --name "BACKUP" --parallel --json
-  wusbkit label 2-6 --name "USB" --parallel --max-concurrent 3`,
+  wusbkit label 2-6 --name "USB" --parallel --max-concurrent 3
+  wusbkit label --location "Port_#0002.Hub_#0003" --name "SLOT_2"
+  wusbkit label --port 1-8 --name "KIOSK_{n:03}" --start-index 41
+  wusbkit label E,F,G --name "SN{serial:8}"
+  wusbkit label E: --get --json
+  wusbkit label E,F,G --clear`,
 	Args: cobra.ExactArgs(1),
 	RunE: runLabel,
 }
 
 func init() {
-	labelCmd.Flags().StringVar(&labelName, "name", "", "New volume label (required)")
+	labelCmd.Flags().StringVar(&labelName, "name", "", "New volume label")
+	labelCmd.Flags().BoolVar(&labelGet, "get", false, "Print the current volume label")
+	labelCmd.Flags().BoolVar(&labelClear, "clear", false, "Remove the volume label")
 	labelCmd.Flags().BoolVar(&labelParallel, "parallel", false, "Label multiple drives in parallel")
 	labelCmd.Flags().IntVar(&labelMaxConcurrent, "max-concurrent", 0, "Max concurrent operations (0=unlimited)")
-	labelCmd.MarkFlagRequired("name")
+	labelCmd.Flags().IntVar(&labelStartIndex, "start-index", 1, "First number given to {n} in a label template")
+	addBatchFlags(labelCmd)
+	addTargetFlags(labelCmd, targetLetter)
 	rootCmd.AddCommand(labelCmd)
 }
 
 func runLabel(cmd *cobra.Command, args []string) error {
 	identifier := args[0]
 
+	// Exactly one of --name, --get and --clear
+	modes := 0
+	for _, set := range []bool{cmd.Flags().Changed("name"), labelGet, labelClear} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		errMsg := "specify one of --name, --get or --clear"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	if labelGet {
+		return runGetLabel(identifier)
+	}
+	if labelClear {
+		labelName = ""
+	}
+
 	// Check if parallel mode (explicit flag or multi-drive syntax)
 	if labelParallel || parallel.IsMultiDiskArg(identifier) {
 		return runParallelLabel(cmd, args)
@@ -76,7 +130,7 @@ func runSingleLabel(cmd *cobra.Command, args []string) error {
 	}
 
 	// Validate label is not empty
-	if strings.TrimSpace(labelName) == "" {
+	if !labelClear && strings.TrimSpace(labelName) == "" {
 		errMsg := "label name cannot be empty"
 		if jsonOutput {
 			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
@@ -107,8 +161,20 @@ func runSingleLabel(cmd *cobra.Command, args []string) error {
 		return errors.New(errMsg)
 	}
 
-	// Use Windows API to set volume label (no admin required for USB drives)
-	if err := disk.SetVolumeLabel(driveLetter, labelName); err != nil {
+	labels, err := driveLabels(labelName, []*usb.Device{device}, labelStartIndex, "")
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+	name := labels[device.DiskNumber]
+	previous, _ := disk.GetVolumeLabel(driveLetter + `:\`)
+
+	// Win32 API first, Set-Volume if it fails (no admin required for USB drives)
+	if err := label.Set(driveLetter, name); err != nil {
 		errMsg := fmt.Sprintf("failed to set label: %v", err)
 		if jsonOutput {
 			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
@@ -121,13 +187,21 @@ func runSingleLabel(cmd *cobra.Command, args []string) error {
 	// Output result
 	if jsonOutput {
 		return PrintJSON(map[string]interface{}{
-			"success":     true,
-			"driveLetter": driveLetter + ":",
-			"label":       labelName,
+			"success":       true,
+			"driveLetter":   driveLetter + ":",
+			"label":         name,
+			"previousLabel": previous,
 		})
 	}
 
-	pterm.Success.Printf("Label set to \"%s\" on drive %s:\n", labelName, driveLetter)
+	switch {
+	case name == "":
+		pterm.Success.Printf("Label \"%s\" cleared on drive %s:\n", previous, driveLetter)
+	case previous == "":
+		pterm.Success.Printf("Label set to \"%s\" on drive %s:\n", name, driveLetter)
+	default:
+		pterm.Success.Printf("Label changed from \"%s\" to \"%s\" on drive %s:\n", previous, name, driveLetter)
+	}
 	return nil
 }
 
@@ -136,7 +210,7 @@ func runParallelLabel(cmd *cobra.Command, args []string) error {
 	identifier := args[0]
 
 	// Validate label is not empty
-	if strings.TrimSpace(labelName) == "" {
+	if !labelClear && strings.TrimSpace(labelName) == "" {
 		errMsg := "label name cannot be empty"
 		if jsonOutput {
 			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
@@ -170,6 +244,7 @@ func runParallelLabel(cmd *cobra.Command, args []string) error {
 	// Validate all drives are USB devices
 	enum := usb.NewEnumerator()
 	var driveNames []string
+	var devices []*usb.Device
 	for _, dl := range driveLetters {
 		device, err := enum.GetDeviceByDriveLetter(dl)
 		if err != nil {
@@ -191,14 +266,37 @@ func runParallelLabel(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("drive %s: not found or not a USB device", dl)
 		}
 		driveNames = append(driveNames, fmt.Sprintf("%s: (%s - %s)", dl, device.FriendlyName, device.SizeHuman))
+		devices = append(devices, device)
+	}
+
+	labels, err := driveLabels(labelName, devices, labelStartIndex, "")
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+	opts := parallel.LabelOptions{
+		Label:  labelName,
+		Labels: make(map[string]string, len(devices)),
+	}
+	for i, d := range devices {
+		opts.Labels[driveLetters[i]] = labels[d.DiskNumber]
 	}
 
 	// Show info in non-JSON mode
-	if !jsonOutput {
-		pterm.Info.Printf("Setting label \"%s\" on %d drives:\n", labelName, len(driveLetters))
+	if !jsonOutput && labelClear {
+		pterm.Info.Printf("Clearing the label of %d drives:\n", len(driveLetters))
 		for _, name := range driveNames {
 			pterm.Info.Printf("  Drive %s\n", name)
 		}
+	} else if !jsonOutput {
+		pterm.Info.Printf("Setting label \"%s\" on %d drives:\n", labelName, len(driveLetters))
+		for i, name := range driveNames {
+			pterm.Info.Printf("  Drive %s -> %s\n", name, opts.Labels[driveLetters[i]])
+		}
 	}
 
 	// Setup context with cancellation for Ctrl+C
@@ -217,11 +315,7 @@ func runParallelLabel(cmd *cobra.Command, args []string) error {
 	}()
 
 	// Execute parallel label
-	opts := parallel.LabelOptions{
-		Label: labelName,
-	}
-
-	executor := parallel.NewExecutor(labelMaxConcurrent, jsonOutput)
+	executor := newBatchExecutor(labelMaxConcurrent, len(driveLetters))
 	result := executor.LabelAll(ctx, driveLetters, opts)
 
 	// Output result (non-JSON mode - JSON mode streams NDJSON)
@@ -229,8 +323,66 @@ func runParallelLabel(cmd *cobra.Command, args []string) error {
 		parallel.PrintBatchResult(result, "Labeled")
 	}
 
-	if result.Failed > 0 {
-		return fmt.Errorf("%d drives failed to label", result.Failed)
+	return finishBatch(result, "label")
+}
+
+// driveLabelInfo is a drive's current label, for label --get.
+type driveLabelInfo struct {
+	DriveLetter string `json:"driveLetter"`
+	DiskNumber  int    `json:"diskNumber"`
+	Label       string `json:"label"`
+}
+
+// runGetLabel prints the current label of one or more drives.
+func runGetLabel(identifier string) error {
+	driveLetters, err := parseDriversOrDisks(identifier)
+	if err == nil && len(driveLetters) == 0 {
+		err = errors.New("no valid drives provided")
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	enum := usb.NewEnumerator()
+	var infos []driveLabelInfo
+	for _, dl := range driveLetters {
+		device, err := enum.GetDeviceByDriveLetter(dl)
+		if err == nil && device == nil {
+			err = errors.New("not found or not a USB device")
+		}
+		var name string
+		if err == nil {
+			name, err = disk.GetVolumeLabel(dl + `:\`)
+		}
+		if err != nil {
+			errMsg := fmt.Sprintf("drive %s: %v", dl, err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
+			} else {
+				PrintError(errMsg, output.ErrCodeUSBNotFound)
+			}
+			return errors.New(errMsg)
+		}
+		infos = append(infos, driveLabelInfo{DriveLetter: dl + ":", DiskNumber: device.DiskNumber, Label: name})
+	}
+
+	if jsonOutput {
+		if len(infos) == 1 {
+			return PrintJSON(infos[0])
+		}
+		return PrintJSON(infos)
+	}
+	for _, info := range infos {
+		if info.Label == "" {
+			fmt.Printf("%s  (no label)\n", info.DriveLetter)
+		} else {
+			fmt.Printf("%s  %s\n", info.DriveLetter, info.Label)
+		}
 	}
 	return nil
 }
@@ -307,3 +459,74 @@ func uniqueStrings(strs []string) []string {
 	}
 	return result
 }
+
+// driveLabels renders a label template for each device, keyed by disk
+// number. Drives are numbered from start in hub port order (drives without
+// a port last, by disk number), so a station's slots get the same numbers
+// every run. A static label is used as is; rendered labels are checked
+// against the file system's length limit (fileSystem, or each drive's own
+// if empty) and must differ from each other.
+func driveLabels(template string, devices []*usb.Device, start int, fileSystem string) (map[int]string, error) {
+	tmpl, err := label.Parse(template)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[int]string, len(devices))
+	if tmpl.IsStatic() {
+		for _, d := range devices {
+			labels[d.DiskNumber] = template
+		}
+		return labels, nil
+	}
+
+	ordered := append([]*usb.Device(nil), devices...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, _ := strconv.Atoi(usb.ParsePortNumber(ordered[i].LocationInfo))
+		pj, _ := strconv.Atoi(usb.ParsePortNumber(ordered[j].LocationInfo))
+		if (pi == 0) != (pj == 0) {
+			return pj == 0
+		}
+		if ordered[i].ParentInstanceId != ordered[j].ParentInstanceId {
+			return ordered[i].ParentInstanceId < ordered[j].ParentInstanceId
+		}
+		if pi != pj {
+			return pi < pj
+		}
+		return ordered[i].DiskNumber < ordered[j].DiskNumber
+	})
+
+	now := time.Now()
+	used := make(map[string]int)
+	for i, d := range ordered {
+		port := usb.ParsePortNumber(d.LocationInfo)
+		if tmpl.Uses(label.FieldSerial) && strings.TrimSpace(d.SerialNumber) == "" {
+			return nil, fmt.Errorf("disk %d has no serial number for {serial}", d.DiskNumber)
+		}
+		if tmpl.Uses(label.FieldPort) && port == "" {
+			return nil, fmt.Errorf("disk %d has no hub port for {port}", d.DiskNumber)
+		}
+		name := tmpl.Render(label.Drive{
+			Index:      start + i,
+			Serial:     d.SerialNumber,
+			Port:       port,
+			DiskNumber: d.DiskNumber,
+		}, now)
+
+		fs := fileSystem
+		if fs == "" {
+			fs = d.FileSystem
+		}
+		if fs == "" {
+			fs = "FAT"
+		}
+		if max := label.MaxLength(fs); len([]rune(name)) > max {
+			return nil, fmt.Errorf("label %q for disk %d is longer than %s allows (%d characters)", name, d.DiskNumber, fs, max)
+		}
+		if other, dup := used[strings.ToUpper(name)]; dup {
+			return nil, fmt.Errorf("disks %d and %d would both be labeled %q", other, d.DiskNumber, name)
+		}
+		used[strings.ToUpper(name)] = d.DiskNumber
+		labels[d.DiskNumber] = name
+	}
+	return labels, nil
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mountLetter string
+	mountFolder string
+)
+
+var mountCmd = &cobra.Command{
+	Use:   "mount <drive>[:partition]",
+	Short: "Give a USB drive's volume a drive letter or mount folder",
+	Long: `Give a volume of a USB drive a specific drive letter or mount it on a
+folder, so scripts can rely on a fixed path. The drive's first volume is
+used unless a partition number follows the disk number (2:3 is partition 3
+of disk 2), e.g. for a partition Windows didn't mount after flashing.
+
+--letter moves the volume to that letter and fails if another drive uses
+it. --folder mounts the volume on an empty folder (created if missing) on
+an NTFS drive, keeping any drive letter it has. Without either, a free
+letter is assigned if the volume has none.`,
+	Example: `  wusbkit mount 2 --letter U
+  wusbkit mount 2:2 --letter V
+  wusbkit mount E: --folder C:\mnt\usb
+  wusbkit mount --serial 0401396 --letter U --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runMount,
+}
+
+var unmountCmd = &cobra.Command{
+	Use:   "unmount <drive>",
+	Short: "Remove a USB drive's drive letters and mount folders",
+	Long: `Remove access paths from a USB drive's volumes without ejecting the
+drive: a drive letter (E:) or mount folder (C:\mnt\usb) removes just that
+path, a disk number removes every path of the disk's volumes, and
+disk:partition every path of one partition's volume.
+
+The volumes stay mounted by Windows and can be given a path again with
+mount; use eject to remove the drive.`,
+	Example: `  wusbkit unmount E:
+  wusbkit unmount C:\mnt\usb
+  wusbkit unmount 2
+  wusbkit unmount 2:2 --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runUnmount,
+}
+
+func init() {
+	mountCmd.Flags().StringVar(&mountLetter, "letter", "", "Drive letter to assign (e.g., U)")
+	mountCmd.Flags().StringVar(&mountFolder, "folder", "", `Empty folder to mount the volume on (e.g., C:\mnt\usb)`)
+	addTargetFlags(mountCmd, targetSingle)
+	rootCmd.AddCommand(mountCmd)
+
+	addTargetFlags(unmountCmd, targetSingle)
+	rootCmd.AddCommand(unmountCmd)
+}
+
+// mountResult is the JSON output of mount.
+type mountResult struct {
+	DiskNumber  int    `json:"diskNumber"`
+	Partition   int    `json:"partition,omitempty"`
+	Volume      string `json:"volume"`
+	DriveLetter string `json:"driveLetter,omitempty"`
+	MountPoint  string `json:"mountPoint,omitempty"`
+}
+
+// unmountResult is the JSON output of unmount.
+type unmountResult struct {
+	DiskNumber int      `json:"diskNumber"`
+	Removed    []string `json:"removed"`
+}
+
+func runMount(cmd *cobra.Command, args []string) error {
+	identifier, partition, err := splitPartitionArg(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if mountLetter != "" && mountFolder != "" {
+		errMsg := "--letter and --folder can't be combined"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to change drive letters and mount points"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	volume, err := partitionVolume(device.DiskNumber, partition)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	result, err := mountVolume(device.DiskNumber, volume, mountLetter, mountFolder)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	result.Partition = partition
+	if jsonOutput {
+		return output.PrintJSON(result)
+	}
+	name := fmt.Sprintf("Disk %d", result.DiskNumber)
+	if partition > 0 {
+		name += fmt.Sprintf(" partition %d", partition)
+	}
+	if result.MountPoint != "" {
+		pterm.Success.Printf("%s mounted on %s\n", name, result.MountPoint)
+	} else {
+		pterm.Success.Printf("%s mounted as %s\n", name, result.DriveLetter)
+	}
+	return nil
+}
+
+func runUnmount(cmd *cobra.Command, args []string) error {
+	target := args[0]
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to change drive letters and mount points"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	result, err := unmountPaths(usb.NewEnumerator(), target)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	for _, path := range result.Removed {
+		if err := disk.RemoveDriveLetter(path); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInternalError)
+			}
+			return err
+		}
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(result)
+	}
+	pterm.Success.Printf("Disk %d unmounted from %s\n", result.DiskNumber, strings.Join(result.Removed, ", "))
+	return nil
+}
+
+// splitPartitionArg splits a disk:partition argument such as 2:3 into the
+// disk and partition number. Anything else, including drive letters, is
+// returned whole with partition 0.
+func splitPartitionArg(arg string) (string, int, error) {
+	diskPart, partPart, found := strings.Cut(arg, ":")
+	if !found || partPart == "" {
+		return arg, 0, nil
+	}
+	if _, err := strconv.Atoi(diskPart); err != nil {
+		return arg, 0, nil
+	}
+	partition, err := strconv.Atoi(partPart)
+	if err != nil || partition < 1 {
+		return "", 0, fmt.Errorf("invalid partition %q in %q, want disk:partition (e.g. 2:1)", partPart, arg)
+	}
+	return diskPart, partition, nil
+}
+
+// partitionVolume returns the volume of a partition of a disk, or of its
+// first partition that has one if partition is 0.
+func partitionVolume(diskNumber, partition int) (string, error) {
+	if partition == 0 {
+		volume, err := disk.FirstVolumeByDiskNumber(diskNumber)
+		if err == nil && volume == "" {
+			err = fmt.Errorf("disk %d has no volume Windows can mount", diskNumber)
+		}
+		return volume, err
+	}
+	p, err := disk.FindPartition(diskNumber, partition)
+	if err != nil {
+		return "", err
+	}
+	volume, err := disk.FindVolumeByPartition(diskNumber, p.StartingOffset)
+	if err != nil {
+		return "", fmt.Errorf("partition %d of disk %d (type 0x%02X) has no volume; Windows doesn't recognize its file system",
+			partition, diskNumber, p.PartitionType)
+	}
+	return volume, nil
+}
+
+// unmountPaths works out the access paths unmount removes: the drive letter
+// or folder given, or every path of a disk's (or a partition's) volumes.
+// Paths on drives other than USB drives are refused.
+func unmountPaths(enum *usb.Enumerator, target string) (*unmountResult, error) {
+	name := strings.ToUpper(strings.TrimRight(target, `:\`))
+	isLetter := len(name) == 1 && name[0] >= 'A' && name[0] <= 'Z'
+	if isLetter || (filepath.IsAbs(target) && len(target) > 3) {
+		path := strings.TrimRight(target, `\`) + `\`
+		if isLetter {
+			path = name + `:\`
+		}
+		volume, err := disk.VolumeForMountPoint(path)
+		if err != nil {
+			return nil, err
+		}
+		diskNumber, err := disk.VolumeDiskNumber(volume)
+		if err != nil {
+			return nil, err
+		}
+		if device, err := enum.GetDeviceByDiskNumber(diskNumber); err != nil || device == nil {
+			return nil, fmt.Errorf("%s is not on a USB drive", path)
+		}
+		return &unmountResult{DiskNumber: diskNumber, Removed: []string{path}}, nil
+	}
+
+	identifier, partition, err := splitPartitionArg(target)
+	if err != nil {
+		return nil, err
+	}
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := disk.ListVolumesByDiskNumber(device.DiskNumber)
+	if partition > 0 {
+		var volume string
+		volume, err = partitionVolume(device.DiskNumber, partition)
+		volumes = []string{volume}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &unmountResult{DiskNumber: device.DiskNumber}
+	for _, volume := range volumes {
+		paths, _ := disk.GetVolumePaths(volume)
+		result.Removed = append(result.Removed, paths...)
+	}
+	if len(result.Removed) == 0 {
+		return nil, fmt.Errorf("disk %d has no drive letter or mount folder to remove", device.DiskNumber)
+	}
+	return result, nil
+}
+
+// mountVolume gives a volume the drive letter or folder asked for, or any
+// free drive letter if it has none and neither is given.
+func mountVolume(diskNumber int, volume, letter, folder string) (*mountResult, error) {
+	result := &mountResult{DiskNumber: diskNumber, Volume: volume}
+	result.DriveLetter, _ = disk.GetVolumeDriveLetter(volume)
+
+	var err error
+	switch {
+	case letter != "":
+		result.DriveLetter, err = disk.SetDriveLetter(volume, letter)
+	case folder != "":
+		result.MountPoint, err = disk.MountFolder(volume, folder)
+	case result.DriveLetter == "":
+		result.DriveLetter, err = disk.AssignDriveLetter(volume)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/multiboot"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	multibootFS    string
+	multibootLabel string
+	multibootGrub  string
+	multibootYes   bool
+	multibootName  string
+)
+
+var multibootCmd = &cobra.Command{
+	Use:   "multiboot",
+	Short: "Build a drive that boots several ISOs",
+	Long: `Turn a USB drive into a multiboot drive holding several ISOs.
+
+'init' formats the drive, installs a GRUB2 boot loader bundle and creates a
+catalog (\multiboot\catalog.json). 'add' and 'remove' copy ISOs on and off
+the drive and regenerate the GRUB menu (\boot\grub\grub.cfg), which
+loop-mounts each ISO.
+
+wusbkit does not ship GRUB: pass --grub with a directory holding a GRUB2
+bundle laid out as on the drive, i.e. EFI\BOOT\BOOTX64.EFI (a standalone
+GRUB EFI image with prefix /boot/grub), boot\grub\x86_64-efi\ and, for
+legacy BIOS, boot\grub\i386-pc\core.img built with prefix
+(hd0,msdos1)/boot/grub.
+
+ISOs boot if they provide /boot/grub/loopback.cfg (Ubuntu, Debian live,
+Mint, Kali, ...) or a GRUB menu that works from a loop device. Windows
+setup ISOs can be stored but not booted this way; use flash --mode files.`,
+}
+
+var multibootInitCmd = &cobra.Command{
+	Use:   "init <drive>",
+	Short: "Format a drive as a multiboot drive and install the boot loader",
+	Example: `  wusbkit multiboot init E: --grub C:\tools\grub-bundle
+  wusbkit multiboot init 2 --fs exfat --label MULTIBOOT --grub C:\tools\grub-bundle --yes`,
+	Args: cobra.ExactArgs(1),
+	RunE: runMultibootInit,
+}
+
+var multibootAddCmd = &cobra.Command{
+	Use:   "add <drive> <iso>...",
+	Short: "Copy ISOs onto a multiboot drive",
+	Example: `  wusbkit multiboot add E: ubuntu-24.04-desktop-amd64.iso debian-live-12-amd64-kde.iso
+  wusbkit multiboot add E: rescue.iso --name "Rescue Tools"`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runMultibootAdd,
+}
+
+var multibootRemoveCmd = &cobra.Command{
+	Use:     "remove <drive> <name|file>...",
+	Aliases: []string{"rm"},
+	Short:   "Remove ISOs from a multiboot drive",
+	Example: `  wusbkit multiboot remove E: debian-live-12-amd64-kde.iso`,
+	Args:    cobra.MinimumNArgs(2),
+	RunE:    runMultibootRemove,
+}
+
+var multibootListCmd = &cobra.Command{
+	Use:     "list <drive>",
+	Short:   "List the ISOs on a multiboot drive",
+	Example: `  wusbkit multiboot list E: --json`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runMultibootList,
+}
+
+// multibootInitResult is the JSON result of multiboot init.
+type multibootInitResult struct {
+	DiskNumber int    `json:"diskNumber"`
+	Drive      string `json:"drive"`
+	FileSystem string `json:"fileSystem"`
+	UEFI       bool   `json:"uefi"`
+	BIOS       bool   `json:"bios"`
+}
+
+func init() {
+	multibootInitCmd.Flags().StringVar(&multibootFS, "fs", "fat32", "Filesystem: fat32 (UEFI-bootable everywhere, 4GB file limit), exfat, ntfs")
+	multibootInitCmd.Flags().StringVar(&multibootLabel, "label", "MULTIBOOT", "Volume label")
+	multibootInitCmd.Flags().StringVar(&multibootGrub, "grub", "", "Directory with the GRUB2 bundle to install")
+	multibootInitCmd.Flags().BoolVarP(&multibootYes, "yes", "y", false, "Skip confirmation prompt")
+	multibootAddCmd.Flags().StringVar(&multibootName, "name", "", "Menu title (default: detected OS or file name; single ISO only)")
+
+	addConfirmFlag(multibootInitCmd)
+	addTargetFlags(multibootInitCmd, targetSingle)
+	addDrivePicker(multibootInitCmd)
+	addTargetFlags(multibootAddCmd, targetSingle)
+	addTargetFlags(multibootRemoveCmd, targetSingle)
+	addTargetFlags(multibootListCmd, targetSingle)
+	multibootCmd.AddCommand(multibootInitCmd, multibootAddCmd, multibootRemoveCmd, multibootListCmd)
+	rootCmd.AddCommand(multibootCmd)
+}
+
+// multibootRoot returns the root directory of a multiboot drive.
+func multibootRoot(identifier string) (string, error) {
+	device, err := usb.NewEnumerator().GetDevice(identifier)
+	if err != nil {
+		return "", err
+	}
+	if device.DriveLetter == "" {
+		return "", fmt.Errorf("disk %d has no drive letter", device.DiskNumber)
+	}
+	return device.DriveLetter + `\`, nil
+}
+
+func runMultibootInit(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	if err := format.ValidateFileSystem(multibootFS); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for multiboot init"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	if isSystem, _ := enum.IsSystemDisk(device.DiskNumber); isSystem {
+		errMsg := fmt.Sprintf("Disk %d appears to be a system disk", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(cmd.Context(), 1*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	if !multibootYes && !jsonOutput {
+		pterm.Warning.Printf("This will ERASE ALL DATA on disk %d (%s - %s)\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		if multibootGrub == "" {
+			pterm.Warning.Println("No --grub bundle given: the drive will hold ISOs but won't boot until one is installed")
+		}
+
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Continue with multiboot init?")
+		if !confirmed {
+			pterm.Info.Println("Multiboot init cancelled")
+			return nil
+		}
+	}
+
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start("Formatting...")
+	}
+
+	// Format as a single active partition
+	formatter := format.NewFormatter()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- formatter.Format(context.Background(), format.Options{
+			DiskNumber: device.DiskNumber,
+			FileSystem: multibootFS,
+			Label:      multibootLabel,
+			Quick:      true,
+		})
+	}()
+	var drive string
+	for progress := range formatter.Progress() {
+		if progress.Status == "complete" {
+			drive = progress.Drive
+		} else if spinner != nil && progress.Status == "in_progress" {
+			spinner.UpdateText(fmt.Sprintf("%s (%d%%)", progress.Stage, progress.Percentage))
+		}
+	}
+	err = <-errChan
+	if err == nil && drive == "" {
+		err = errors.New("formatted volume has no drive letter")
+	}
+
+	// Lay out the catalog and install the boot loader
+	result := multibootInitResult{DiskNumber: device.DiskNumber, Drive: drive, FileSystem: multibootFS}
+	var biosErr error
+	if err == nil {
+		if spinner != nil {
+			spinner.UpdateText("Installing boot loader...")
+		}
+		root := drive + `\`
+		err = multiboot.Init(root, multibootGrub)
+		if err == nil && multibootGrub != "" {
+			biosErr = multiboot.InstallBIOSBoot(device.DiskNumber, multibootGrub)
+			result.BIOS = biosErr == nil
+		}
+		result.UEFI = multiboot.HasEFILoader(root)
+	}
+
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeFormatFailed)
+		} else {
+			spinner.Fail(err.Error())
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(result)
+	}
+	spinner.Success(fmt.Sprintf("Multiboot drive ready at %s", drive))
+	if !result.UEFI {
+		pterm.Warning.Println("No EFI\\BOOT\\BOOTX64.EFI installed; the drive won't boot in UEFI mode")
+	}
+	if biosErr != nil {
+		pterm.Warning.Printf("Legacy BIOS boot not installed: %v\n", biosErr)
+	}
+	return nil
+}
+
+func runMultibootAdd(cmd *cobra.Command, args []string) error {
+	isos := args[1:]
+	if multibootName != "" && len(isos) > 1 {
+		errMsg := "--name can only be used when adding a single ISO"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	root, err := multibootRoot(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var added []multiboot.Entry
+	for _, isoPath := range isos {
+		var spinner *pterm.SpinnerPrinter
+		var onProgress func(done, total int64)
+		if !jsonOutput {
+			spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Adding %s...", isoPath))
+			lastUpdate := time.Time{}
+			onProgress = func(done, total int64) {
+				if time.Since(lastUpdate) < 250*time.Millisecond || total <= 0 {
+					return
+				}
+				lastUpdate = time.Now()
+				spinner.UpdateText(fmt.Sprintf("Copying %s %d%% | %s / %s", isoPath, done*100/total,
+					flash.FormatBytes(done), flash.FormatBytes(total)))
+			}
+		}
+
+		entry, err := multiboot.Add(ctx, root, isoPath, multibootName, onProgress)
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				spinner.Fail(fmt.Sprintf("%s: %v", isoPath, err))
+			}
+			return err
+		}
+		added = append(added, *entry)
+
+		if !jsonOutput {
+			spinner.Success(fmt.Sprintf("Added %s (%s)", entry.Name, flash.FormatBytes(entry.Size)))
+			if entry.Boot == multiboot.BootUnsupported {
+				pterm.Warning.Printf("%s can't be booted from a loop device; it is stored but not in the boot menu\n", entry.File)
+			}
+		}
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(added)
+	}
+	return nil
+}
+
+func runMultibootRemove(cmd *cobra.Command, args []string) error {
+	root, err := multibootRoot(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	var removed []multiboot.Entry
+	for _, query := range args[1:] {
+		entries, err := multiboot.Remove(root, query)
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+		removed = append(removed, entries...)
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(removed)
+	}
+	for _, e := range removed {
+		pterm.Success.Printfln("Removed %s (%s)", e.Name, e.File)
+	}
+	return nil
+}
+
+func runMultibootList(cmd *cobra.Command, args []string) error {
+	root, err := multibootRoot(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	catalog, err := multiboot.Load(root)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(catalog.Entries)
+	}
+
+	if len(catalog.Entries) == 0 {
+		pterm.Info.Printfln("No ISOs on %s", root)
+		return nil
+	}
+
+	tableData := pterm.TableData{{"Name", "File", "Size", "Boot", "Added"}}
+	for _, e := range catalog.Entries {
+		tableData = append(tableData, []string{
+			e.Name,
+			e.File,
+			flash.FormatBytes(e.Size),
+			e.Boot,
+			e.Added.Local().Format("2006-01-02 15:04"),
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(tableData).Render()
+	return nil
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows"
+)
+
+// addDrivePicker lets a destructive command be run without its drive
+// argument in a console: the drive is then picked from a list of USB drives
+// rather than guessed at. It must be called after addTargetFlags.
+func addDrivePicker(cmd *cobra.Command) {
+	validate, run := cmd.Args, cmd.RunE
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if canPickDrive(args) {
+			// The picked drive stands in for the drive argument
+			args = append([]string{""}, args...)
+		}
+		if validate == nil {
+			return nil
+		}
+		return validate(cmd, args)
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if canPickDrive(args) {
+			identifier, err := pickDrive(strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" "))
+			if err != nil {
+				PrintError(err.Error(), output.ErrCodeUSBNotFound)
+				return err
+			}
+			args = append([]string{identifier}, args...)
+		}
+		return run(cmd, args)
+	}
+}
+
+// canPickDrive reports whether the drive argument was left out in a session
+// where the user can be asked for it.
+func canPickDrive(args []string) bool {
+	return len(args) == 0 && !targetSelected() && !jsonOutput && isConsole()
+}
+
+// isConsole reports whether standard input is an interactive console rather
+// than a pipe, a file or a service session.
+func isConsole() bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Stdin, &mode) == nil
+}
+
+// pickDrive lists the USB drives, leaving out system disks, and returns the
+// disk number of the one the user selects.
+func pickDrive(command string) (string, error) {
+	enum := usb.NewEnumerator()
+	devices, err := enum.ListDevices()
+	if err != nil {
+		return "", err
+	}
+
+	var options []string
+	var disks []int
+	for _, d := range devices {
+		if isSystem, _ := enum.IsSystemDisk(d.DiskNumber); isSystem {
+			continue
+		}
+		options = append(options, pickerOption(d))
+		disks = append(disks, d.DiskNumber)
+	}
+	if len(options) == 0 {
+		return "", errors.New("no USB drives found")
+	}
+
+	selected, err := pterm.DefaultInteractiveSelect.
+		WithOptions(options).
+		WithDefaultText(fmt.Sprintf("Select a drive for %s", command)).
+		Show()
+	if err != nil {
+		return "", fmt.Errorf("failed to read selection: %w", err)
+	}
+	for i, option := range options {
+		if option == selected {
+			return strconv.Itoa(disks[i]), nil
+		}
+	}
+	return "", errors.New("no drive selected")
+}
+
+// pickerOption describes a drive on one line of the picker.
+func pickerOption(d usb.Device) string {
+	parts := []string{fmt.Sprintf("Disk %d", d.DiskNumber)}
+	if d.DriveLetter != "" {
+		parts = append(parts, d.DriveLetter)
+	}
+	parts = append(parts, fmt.Sprintf("%s - %s", d.FriendlyName, d.SizeHuman))
+	if d.VolumeLabel != "" {
+		parts = append(parts, fmt.Sprintf("%q", d.VolumeLabel))
+	}
+	if serial := strings.TrimSpace(d.SerialNumber); serial != "" {
+		parts = append(parts, "serial "+serial)
+	}
+	return strings.Join(parts, "  ")
+}
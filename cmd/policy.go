@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy <drive> [quick|performance]",
+	Short: "Show or switch the removal policy of a USB drive",
+	Long: `Show or switch a USB drive's removal policy, the setting on the Policies
+tab in Device Manager.
+
+  quick         Quick removal: Windows doesn't cache writes, so the drive
+                can be unplugged any time it is idle. Slower writes.
+  performance   Better performance: Windows caches writes, which speeds up
+                writing many small files. The drive must be ejected before
+                unplugging it or data can be lost.
+
+The new policy takes effect once the drive is reconnected. Switching it
+requires administrator privileges.`,
+	Example: `  wusbkit policy E:
+  wusbkit policy E: performance
+  wusbkit policy 2 quick --json`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runPolicy,
+}
+
+func init() {
+	addTargetFlags(policyCmd, targetSingle)
+	rootCmd.AddCommand(policyCmd)
+}
+
+// policyResult is the JSON output of the policy command.
+type policyResult struct {
+	DiskNumber      int    `json:"diskNumber"`
+	RemovalPolicy   string `json:"removalPolicy"`
+	ReconnectNeeded bool   `json:"reconnectNeeded,omitempty"`
+}
+
+func runPolicy(cmd *cobra.Command, args []string) error {
+	var newPolicy string
+	if len(args) == 2 {
+		newPolicy = args[1]
+		if newPolicy != usb.RemovalPolicyQuick && newPolicy != usb.RemovalPolicyPerformance {
+			errMsg := fmt.Sprintf("Invalid policy %q: use quick or performance", newPolicy)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return errors.New(errMsg)
+		}
+		if !format.IsAdmin() {
+			errMsg := "Administrator privileges required to change the removal policy"
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+			} else {
+				PrintError(errMsg, output.ErrCodePermDenied)
+			}
+			return errors.New(errMsg)
+		}
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	if newPolicy == "" {
+		if jsonOutput {
+			return output.PrintJSON(policyResult{DiskNumber: device.DiskNumber, RemovalPolicy: device.RemovalPolicy})
+		}
+		pterm.Info.Printf("Disk %d (%s): %s\n", device.DiskNumber, device.FriendlyName, output.FormatRemovalPolicy(device.RemovalPolicy))
+		return nil
+	}
+
+	changed := newPolicy != device.RemovalPolicy
+	if changed {
+		if err := usb.SetRemovalPolicy(device.PNPDeviceID, newPolicy); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInternalError)
+			}
+			return err
+		}
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(policyResult{DiskNumber: device.DiskNumber, RemovalPolicy: newPolicy, ReconnectNeeded: changed})
+	}
+	if !changed {
+		pterm.Info.Printf("Disk %d (%s) already uses %s\n", device.DiskNumber, device.FriendlyName, output.FormatRemovalPolicy(newPolicy))
+		return nil
+	}
+	pterm.Success.Printf("Disk %d (%s) set to %s\n", device.DiskNumber, device.FriendlyName, output.FormatRemovalPolicy(newPolicy))
+	pterm.Info.Println("Reconnect the drive (or run wusbkit replug) for the new policy to take effect")
+	if newPolicy == usb.RemovalPolicyPerformance {
+		pterm.Warning.Println("Eject the drive before unplugging it from now on")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	protectOn  bool
+	protectOff bool
+)
+
+var protectCmd = &cobra.Command{
+	Use:   "protect <drive>",
+	Short: "Show or toggle write protection on a USB drive",
+	Long: `Show or change the write protection of a USB drive.
+
+With --on or --off the drive's read-only attribute is set or cleared, the
+same flag as Set-Disk -IsReadOnly; the change persists across reboots.
+Without either flag the current state is shown.
+
+Drives with a physical lock switch (common on SD cards and some sticks)
+refuse writes regardless of the read-only attribute. The command reports
+when the switch is what blocks writes; only flipping the switch fixes that.`,
+	Example: `  wusbkit protect E:
+  wusbkit protect E: --on
+  wusbkit protect 2 --off --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runProtect,
+}
+
+func init() {
+	protectCmd.Flags().BoolVar(&protectOn, "on", false, "Make the drive read-only")
+	protectCmd.Flags().BoolVar(&protectOff, "off", false, "Clear the read-only attribute")
+	addTargetFlags(protectCmd, targetSingle)
+	rootCmd.AddCommand(protectCmd)
+}
+
+// protectReport is the JSON output of the protect command.
+type protectReport struct {
+	DiskNumber     int  `json:"diskNumber"`
+	ReadOnly       bool `json:"readOnly"`
+	WriteProtected bool `json:"writeProtected"`
+}
+
+func runProtect(cmd *cobra.Command, args []string) error {
+	if protectOn && protectOff {
+		err := errors.New("--on and --off cannot be used together")
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	changing := protectOn || protectOff
+	if changing && !format.IsAdmin() {
+		errMsg := "Administrator privileges required to change write protection"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	if changing {
+		if err := disk.SetReadOnly(device.DiskNumber, protectOn); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInternalError)
+			}
+			return err
+		}
+	}
+
+	status, err := disk.GetWriteProtect(device.DiskNumber)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	// Clearing the attribute doesn't help if the lock switch is on
+	if protectOff && status.WriteProtected {
+		errMsg := fmt.Sprintf("Read-only attribute cleared, but disk %d is still write-protected by its physical switch", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return errors.New(errMsg)
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(protectReport{
+			DiskNumber:     device.DiskNumber,
+			ReadOnly:       status.ReadOnly,
+			WriteProtected: status.WriteProtected,
+		})
+	}
+
+	switch {
+	case protectOn:
+		pterm.Success.Printf("Disk %d (%s) is now read-only\n", device.DiskNumber, device.FriendlyName)
+	case protectOff:
+		pterm.Success.Printf("Disk %d (%s) is now writable\n", device.DiskNumber, device.FriendlyName)
+	case status.WriteProtected:
+		pterm.Warning.Printf("Disk %d (%s) is write-protected by its physical switch\n", device.DiskNumber, device.FriendlyName)
+	case status.ReadOnly:
+		pterm.Info.Printf("Disk %d (%s) is read-only (clear with --off)\n", device.DiskNumber, device.FriendlyName)
+	default:
+		pterm.Info.Printf("Disk %d (%s) is writable\n", device.DiskNumber, device.FriendlyName)
+	}
+	return nil
+}
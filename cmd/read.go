@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// readMaxJSON is the largest region read prints inline with --json; larger
+// regions must go to a file with --out.
+const readMaxJSON = 16 << 20
+
+var (
+	readOffset string
+	readLength string
+	readHex    bool
+	readOut    string
+)
+
+var readCmd = &cobra.Command{
+	Use:   "read <drive>",
+	Short: "Hexdump or extract raw sectors of a USB drive",
+	Long: `Read a byte range of a USB drive straight from the disk, to inspect the MBR,
+GPT headers or boot sectors, or to extract a region to a file without dd.
+
+The range is given by --offset and --length, in bytes with an optional K, M
+or G suffix, or in hex with a 0x prefix; it doesn't have to be sector
+aligned. By default (or with --hex) it is printed as a hexdump with disk
+offsets, repeated lines collapsed into "*"; --out writes the raw bytes to a
+file instead. With --json the bytes are returned hex-encoded (up to 16MB).
+
+The drive is only read, so its volumes stay mounted. Requires administrator
+privileges.`,
+	Example: `  wusbkit read E:
+  wusbkit read 2 --offset 512 --length 512
+  wusbkit read 2 --offset 0x1BE --length 64
+  wusbkit read E: --length 1M --out first-mb.bin
+  wusbkit read 2 --length 512 --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRead,
+}
+
+func init() {
+	readCmd.Flags().StringVar(&readOffset, "offset", "0", "Byte offset to start at (e.g., 512, 0x1BE, 1M)")
+	readCmd.Flags().StringVar(&readLength, "length", "512", "Number of bytes to read (e.g., 512, 4K, 1M)")
+	readCmd.Flags().BoolVar(&readHex, "hex", false, "Print a hexdump (the default without --out)")
+	readCmd.Flags().StringVarP(&readOut, "out", "o", "", "Write the raw bytes to this file")
+	addTargetFlags(readCmd, targetSingle)
+	rootCmd.AddCommand(readCmd)
+}
+
+// readResult is the JSON output of the read command.
+type readResult struct {
+	DiskNumber int    `json:"diskNumber"`
+	Offset     int64  `json:"offset"`
+	Length     int64  `json:"length"`
+	Output     string `json:"output,omitempty"` // File written with --out
+	Data       string `json:"data,omitempty"`   // Hex-encoded bytes, without --out
+}
+
+// validateReadFlags parses --offset and --length and checks the flag
+// combination.
+func validateReadFlags() (offset, length int64, err error) {
+	if readHex && readOut != "" {
+		return 0, 0, errors.New("--hex and --out cannot be used together")
+	}
+	offset, err = parseByteOffset(readOffset)
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("invalid --offset %q", readOffset)
+	}
+	length, err = parseByteOffset(readLength)
+	if err != nil || length <= 0 {
+		return 0, 0, fmt.Errorf("invalid --length %q: must be greater than 0", readLength)
+	}
+	if jsonOutput && readOut == "" && length > readMaxJSON {
+		return 0, 0, fmt.Errorf("--length %s is too large to print as JSON: use --out", readLength)
+	}
+	return offset, length, nil
+}
+
+// parseByteOffset parses a byte count in hex (0x1BE) or decimal with an
+// optional K, M, G or T suffix (4K).
+func parseByteOffset(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		return strconv.ParseInt(rest, 16, 64)
+	}
+	return parseSize(s)
+}
+
+func runRead(cmd *cobra.Command, args []string) error {
+	offset, length, err := validateReadFlags()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Raw disk access needs admin even for reading
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to read raw sectors"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	device, err := usb.NewEnumerator().GetDevice(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	result := readResult{DiskNumber: device.DiskNumber, Offset: offset, Length: length}
+	switch {
+	case readOut != "":
+		err = readToFile(ctx, device, offset, length)
+		result.Output = readOut
+	case jsonOutput:
+		var buf bytes.Buffer
+		err = disk.ReadRegion(ctx, device.DiskNumber, offset, length, &buf)
+		result.Data = hex.EncodeToString(buf.Bytes())
+	default:
+		out := bufio.NewWriter(os.Stdout)
+		dumper := &hexDumper{w: out, offset: offset}
+		err = disk.ReadRegion(ctx, device.DiskNumber, offset, length, dumper)
+		if err == nil {
+			err = dumper.Close()
+		}
+		if flushErr := out.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to read disk %d: %v", device.DiskNumber, err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(result)
+	}
+	if readOut != "" {
+		pterm.Success.Printf("Wrote %d bytes of disk %d at offset %d to %s\n", length, device.DiskNumber, offset, readOut)
+	}
+	return nil
+}
+
+// readToFile writes a region of a drive to --out.
+func readToFile(ctx context.Context, device *usb.Device, offset, length int64) error {
+	f, err := os.Create(readOut)
+	if err != nil {
+		return err
+	}
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Reading %s from disk %d (%s)...", usb.FormatSize(length), device.DiskNumber, device.FriendlyName))
+	}
+	err = disk.ReadRegion(ctx, device.DiskNumber, offset, length, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if spinner != nil {
+		spinner.Stop()
+	}
+	if err != nil {
+		os.Remove(readOut)
+	}
+	return err
+}
+
+// hexDumper writes the bytes written to it as a hexdump -C style listing
+// with disk offsets. Runs of identical lines are printed once, then "*".
+type hexDumper struct {
+	w        io.Writer
+	offset   int64  // Disk offset of the line being filled
+	line     []byte // Bytes of the line being filled
+	prev     []byte // Last full line, to collapse repeats
+	squeezed bool   // A "*" was printed for the current run
+}
+
+func (d *hexDumper) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		take := min(16-len(d.line), len(p))
+		d.line = append(d.line, p[:take]...)
+		p = p[take:]
+		if len(d.line) == 16 {
+			if err := d.flushLine(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close prints the last, partial line and the end offset.
+func (d *hexDumper) Close() error {
+	if len(d.line) > 0 {
+		if err := d.flushLine(); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(d.w, "%08x\n", d.offset)
+	return err
+}
+
+func (d *hexDumper) flushLine() error {
+	defer func() {
+		d.prev = append(d.prev[:0], d.line...)
+		d.offset += int64(len(d.line))
+		d.line = d.line[:0]
+	}()
+
+	if len(d.line) == 16 && bytes.Equal(d.line, d.prev) {
+		if d.squeezed {
+			return nil
+		}
+		d.squeezed = true
+		_, err := fmt.Fprintln(d.w, "*")
+		return err
+	}
+	d.squeezed = false
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%08x ", d.offset)
+	for i := range 16 {
+		if i == 8 {
+			b.WriteByte(' ')
+		}
+		if i < len(d.line) {
+			fmt.Fprintf(&b, " %02x", d.line[i])
+		} else {
+			b.WriteString("   ")
+		}
+	}
+	b.WriteString("  |")
+	for _, c := range d.line {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		b.WriteByte(c)
+	}
+	b.WriteString("|\n")
+	_, err := io.WriteString(d.w, b.String())
+	return err
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// replugPollInterval is how often replug looks for the drive to come back.
+const replugPollInterval = 500 * time.Millisecond
+
+var (
+	replugYes     bool
+	replugForce   bool
+	replugTimeout time.Duration
+)
+
+var replugCmd = &cobra.Command{
+	Use:   "replug <drive>",
+	Short: "Disable and re-enable a USB drive, as if it were reconnected",
+	Long: `Restart a USB drive's device in Windows, like unplugging it and plugging
+it back in, without touching it: the USB device node it sits on is disabled
+and enabled again (as devcon or Device Manager would), which restarts its
+drivers. This recovers drives stuck in a bad state on headless duplication
+rigs, and applies a removal policy changed with the policy command.
+
+The drive is waited for until it is back (see --timeout); it may come back
+under another disk number, which is printed. Windows refuses to stop a
+drive that programs have files open on: eject it or close them first.
+Requires administrator privileges.`,
+	Example: `  wusbkit replug E:
+  wusbkit replug 2 --yes
+  wusbkit replug --port 1-4 --yes --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runReplug,
+}
+
+func init() {
+	replugCmd.Flags().BoolVarP(&replugYes, "yes", "y", false, "Skip confirmation prompt")
+	replugCmd.Flags().BoolVar(&replugForce, "force", false, "Allow replugging a drive that appears to be a system disk")
+	replugCmd.Flags().DurationVar(&replugTimeout, "timeout", 30*time.Second, "How long to wait for the drive to come back (0 = don't wait)")
+	addTargetFlags(replugCmd, targetSingle)
+	rootCmd.AddCommand(replugCmd)
+}
+
+// replugResult is the JSON output of the replug command.
+type replugResult struct {
+	DiskNumber    int    `json:"diskNumber"`              // Before the replug
+	NewDiskNumber int    `json:"newDiskNumber,omitempty"` // After it, if the drive came back
+	DriveLetter   string `json:"driveLetter,omitempty"`   // After it, if the drive came back
+	USBInstanceID string `json:"usbInstanceId"`           // The device node that was restarted
+	Reconnected   bool   `json:"reconnected"`
+	Duration      string `json:"duration"`
+}
+
+func runReplug(cmd *cobra.Command, args []string) error {
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to replug a drive"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+	if replugTimeout < 0 {
+		errMsg := "--timeout must not be negative"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	// Restarting a system disk would pull the running Windows out from
+	// under itself
+	if !replugForce {
+		if isSystem, _ := enum.IsSystemDisk(device.DiskNumber); isSystem {
+			errMsg := fmt.Sprintf("disk %d appears to be a system disk. Use --force to override", device.DiskNumber)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return errors.New(errMsg)
+		}
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !replugYes && !jsonOutput {
+		pterm.Info.Printf("Replugging disk %d (%s - %s)\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman)
+
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(true).
+			Show("Continue?")
+
+		if !confirmed {
+			pterm.Info.Println("Replug cancelled")
+			return nil
+		}
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	start := time.Now()
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Restarting disk %d (%s)...", device.DiskNumber, device.FriendlyName))
+	}
+
+	instanceID, err := usb.Replug(device.PNPDeviceID)
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to replug disk %d: %v", device.DiskNumber, err)
+		code := output.ErrCodeInternalError
+		if errors.Is(err, usb.ErrReplugVetoed) {
+			code = output.ErrCodeDiskBusy
+		}
+		if spinner != nil {
+			spinner.Fail(errMsg)
+		}
+		if jsonOutput {
+			output.PrintJSONError(errMsg, code)
+		}
+		return err
+	}
+
+	result := replugResult{DiskNumber: device.DiskNumber, USBInstanceID: instanceID}
+	var back *usb.Device
+	if replugTimeout > 0 {
+		if spinner != nil {
+			spinner.UpdateText(fmt.Sprintf("Waiting for disk %d (%s) to come back...", device.DiskNumber, device.FriendlyName))
+		}
+		back, err = waitForReplug(ctx, device.PNPDeviceID, replugTimeout)
+		if err != nil {
+			errMsg := fmt.Sprintf("disk %d was restarted but %v", device.DiskNumber, err)
+			if spinner != nil {
+				spinner.Fail(errMsg)
+			}
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
+			}
+			return errors.New(errMsg)
+		}
+		result.NewDiskNumber = back.DiskNumber
+		result.DriveLetter = back.DriveLetter
+		result.Reconnected = true
+	}
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	if jsonOutput {
+		return output.PrintJSON(result)
+	}
+	if back == nil {
+		spinner.Success(fmt.Sprintf("Restarted disk %d (%s)", device.DiskNumber, device.FriendlyName))
+		return nil
+	}
+	where := fmt.Sprintf("disk %d", back.DiskNumber)
+	if back.DriveLetter != "" {
+		where += ", " + back.DriveLetter
+	}
+	spinner.Success(fmt.Sprintf("Disk %d (%s) is back as %s", device.DiskNumber, device.FriendlyName, where))
+	return nil
+}
+
+// waitForReplug waits for a replugged drive, given its disk's PNPDeviceID,
+// to be enumerated again and returns it.
+func waitForReplug(ctx context.Context, pnpDeviceID string, timeout time.Duration) (*usb.Device, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(replugPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("didn't come back within %s", timeout)
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		// A fresh enumerator each time, as the cached list is stale
+		devices, err := usb.NewEnumerator().ListDevices()
+		if err != nil {
+			continue
+		}
+		for i := range devices {
+			if devices[i].PNPDeviceID == pnpDeviceID {
+				return &devices[i], nil
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// rescanSettle is how long rescan gives Windows to mount the volumes of
+// re-read partition tables before listing them.
+const rescanSettle = 2 * time.Second
+
+var rescanCmd = &cobra.Command{
+	Use:   "rescan [drive]",
+	Short: "Make Windows re-read the partition tables of USB drives",
+	Long: `Make Windows re-read a USB drive's partition table and refresh its volumes,
+like Update-Disk or diskpart's rescan, for scripts that change drives with
+other tools (dd, sgdisk, a hex editor) and need Windows to see the result.
+
+Without a drive, the whole device tree is scanned for hardware changes
+first, then every USB drive is re-read. The volumes found afterwards are
+listed by drive letter, or by GUID path for volumes without one. Drives
+another wusbkit command is working on are left alone. Requires
+administrator privileges.`,
+	Example: `  wusbkit rescan
+  wusbkit rescan E:
+  wusbkit rescan 2 --json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runRescan,
+}
+
+func init() {
+	addTargetFlags(rescanCmd, targetSingle)
+	rootCmd.AddCommand(rescanCmd)
+}
+
+// rescanDisk is the result of one drive in the rescan command's JSON output.
+type rescanDisk struct {
+	DiskNumber   int      `json:"diskNumber"`
+	FriendlyName string   `json:"friendlyName"`
+	Volumes      []string `json:"volumes"` // Drive letters, or GUID paths for volumes without one
+	Error        string   `json:"error,omitempty"`
+}
+
+// rescanResult is the JSON output of the rescan command.
+type rescanResult struct {
+	Disks  []rescanDisk `json:"disks"`
+	Failed int          `json:"failed"`
+}
+
+func runRescan(cmd *cobra.Command, args []string) error {
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to rescan drives"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	var devices []usb.Device
+	if len(args) == 1 {
+		device, err := usb.NewEnumerator().GetDevice(args[0])
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+			} else {
+				PrintError(err.Error(), output.ErrCodeUSBNotFound)
+			}
+			return err
+		}
+		devices = []usb.Device{*device}
+	} else {
+		if err := usb.RescanDevices(); err != nil {
+			errMsg := fmt.Sprintf("Failed to scan for hardware changes: %v", err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+			} else {
+				PrintError(errMsg, output.ErrCodeInternalError)
+			}
+			return err
+		}
+		// Listed after the scan, so newly detected drives are included
+		var err error
+		devices, err = usb.NewEnumerator().ListDevices()
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInternalError)
+			}
+			return err
+		}
+	}
+
+	result := rescanResult{Disks: make([]rescanDisk, len(devices))}
+	rescanned := false
+	for i, d := range devices {
+		result.Disks[i] = rescanDisk{DiskNumber: d.DiskNumber, FriendlyName: d.FriendlyName}
+		if err := rescanLocked(d.DiskNumber); err != nil {
+			result.Disks[i].Error = err.Error()
+			result.Failed++
+			continue
+		}
+		rescanned = true
+	}
+
+	if rescanned {
+		time.Sleep(rescanSettle)
+	}
+	for i := range result.Disks {
+		r := &result.Disks[i]
+		if r.Error != "" {
+			continue
+		}
+		r.Volumes = []string{}
+		volumes, _ := disk.ListVolumesByDiskNumber(r.DiskNumber)
+		for _, v := range volumes {
+			name := strings.TrimRight(v, `\`)
+			if root, _ := disk.GetVolumeDriveLetter(v); root != "" {
+				name = strings.TrimSuffix(root, `\`)
+			}
+			r.Volumes = append(r.Volumes, name)
+		}
+	}
+
+	var err error
+	if result.Failed > 0 {
+		err = fmt.Errorf("%d of %d drives failed to rescan", result.Failed, len(result.Disks))
+	}
+	if jsonOutput {
+		if printErr := output.PrintJSON(result); printErr != nil {
+			return printErr
+		}
+		return err
+	}
+
+	if len(result.Disks) == 0 {
+		pterm.Info.Println("No USB drives found")
+		return nil
+	}
+	for _, r := range result.Disks {
+		switch {
+		case r.Error != "":
+			pterm.Error.Printf("Disk %d (%s): %s\n", r.DiskNumber, r.FriendlyName, r.Error)
+		case len(r.Volumes) == 0:
+			pterm.Success.Printf("Disk %d (%s): rescanned, no volumes\n", r.DiskNumber, r.FriendlyName)
+		default:
+			pterm.Success.Printf("Disk %d (%s): rescanned, volumes %s\n", r.DiskNumber, r.FriendlyName, strings.Join(r.Volumes, ", "))
+		}
+	}
+	return err
+}
+
+// rescanLocked rescans a disk unless another wusbkit command is working on
+// it, whose partition table may be half written.
+func rescanLocked(diskNumber int) error {
+	diskLock, err := lock.NewDiskLock(diskNumber)
+	if err != nil {
+		return fmt.Errorf("failed to create disk lock: %w", err)
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		return fmt.Errorf("disk %d is busy (another operation in progress)", diskNumber)
+	}
+	defer diskLock.Unlock()
+	return disk.RescanDisk(diskNumber)
+}
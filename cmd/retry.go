@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	retryReport  string
+	retryYes     bool
+	retryConfirm string
+	retrySecrets = make(map[string]*string) // Credential flag name to value
+	retryHeaders []string
+)
+
+var retryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Re-run the drives that failed in a previous multi-disk run",
+	Long: `Read a report written by flash, format, wipe or label --report and run
+the same operation again on the drives that failed in its last run, with
+the same options.
+
+The failed drives are found again by serial number, so disk numbers and
+drive letters that changed when a drive was replugged don't matter. Drives
+without a serial number, or that are no longer plugged in, are skipped.
+The new run is appended to the report, so retry can be repeated until
+every drive has succeeded.
+
+Credentials (--bearer-token, --header, --http-user, --smb-user) are never
+written to the report, only which of them the run used: pass them to retry
+again (the bearer token can also come from $WUSBKIT_BEARER_TOKEN).`,
+	Example: `  wusbkit flash 2-9 --image kiosk.img --report run.json --yes
+  wusbkit retry --report run.json --yes
+  wusbkit retry --report run.json --json --yes
+  wusbkit retry --report run.json --bearer-token "$TOKEN" --yes`,
+	Args: cobra.NoArgs,
+	RunE: runRetry,
+}
+
+func init() {
+	retryCmd.Flags().StringVar(&retryReport, "report", "", "Report file of the run to retry (required)")
+	retryCmd.Flags().BoolVarP(&retryYes, "yes", "y", false, "Skip confirmation prompt")
+	retryCmd.Flags().StringVar(&retryConfirm, "confirm", "", "Serial or disk numbers the retried drives must match (comma-separated)")
+	for _, name := range []string{"bearer-token", "http-user", "smb-user"} {
+		retrySecrets[name] = retryCmd.Flags().String(name, "", "Pass the run's --"+name+" again; it isn't stored in the report")
+	}
+	retryCmd.Flags().StringArrayVar(&retryHeaders, "header", nil, "Pass the run's --header values again; they aren't stored in the report (repeatable)")
+	retryCmd.MarkFlagRequired("report")
+	rootCmd.AddCommand(retryCmd)
+}
+
+// batchReportFile is the --report file of a multi-disk run: the command and
+// options it ran with and the result of each run, the first one followed by
+// those of retry.
+type batchReportFile struct {
+	Command string     `json:"command"`           // "flash", "format", "wipe", "label" or "fsck"
+	Args    []string   `json:"args"`              // Options, without the drive selection or credentials
+	Secrets []string   `json:"secrets,omitempty"` // Credential flags the run used, whose values aren't recorded
+	Runs    []batchRun `json:"runs"`
+}
+
+// batchRun is the result of one run in a report.
+type batchRun struct {
+	Time time.Time `json:"time"`
+	parallel.BatchResult
+}
+
+// reportSkipFlags are the flags not recorded in a report: retry selects the
+// drives itself and brings its own confirmation.
+var reportSkipFlags = map[string]bool{
+	"serial": true, "port": true, "location": true, "all": true, "exclude": true,
+	"min-size": true, "report": true, "yes": true, "confirm": true,
+}
+
+// reportSecretFlags are the flags holding credentials. Only their names are
+// recorded, as the report is meant to be kept and shared; retry needs them
+// passed again.
+var reportSecretFlags = map[string]bool{
+	"bearer-token": true, "header": true, "http-user": true, "smb-user": true,
+}
+
+var (
+	reportArgs    []string
+	reportSecrets []string
+	reportSerials map[string]string // Disk number or drive letter to serial
+	reportAppend  bool              // Set by retry: add to the report instead of replacing it
+)
+
+// startBatchReport notes what the command runs with, and the serial numbers
+// of the drives before they are touched, for the --report file.
+func startBatchReport(cmd *cobra.Command) {
+	reportArgs = nil
+	reportSecrets = nil
+	cmd.LocalFlags().Visit(func(f *pflag.Flag) {
+		if reportSkipFlags[f.Name] {
+			return
+		}
+		if reportSecretFlags[f.Name] {
+			reportSecrets = append(reportSecrets, "--"+f.Name)
+			return
+		}
+		// Repeatable flags are recorded once per value
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range slice.GetSlice() {
+				reportArgs = append(reportArgs, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		reportArgs = append(reportArgs, "--"+f.Name+"="+f.Value.String())
+	})
+
+	reportSerials = make(map[string]string)
+	devices, err := usb.NewEnumerator().ListDevices()
+	if err != nil {
+		return
+	}
+	for _, d := range devices {
+		serial := strings.TrimSpace(d.SerialNumber)
+		if serial == "" {
+			continue
+		}
+		reportSerials[fmt.Sprint(d.DiskNumber)] = serial
+		if d.DriveLetter != "" {
+			reportSerials[strings.ToUpper(d.DriveLetter)] = serial
+		}
+	}
+}
+
+// writeBatchReport writes a run's result to the --report file, after the
+// earlier runs when retry is adding to it.
+func writeBatchReport(result parallel.BatchResult) error {
+	for i, r := range result.Results {
+		key := fmt.Sprint(r.DiskNumber)
+		if r.DriveLetter != "" {
+			key = strings.ToUpper(r.DriveLetter)
+		}
+		result.Results[i].Serial = reportSerials[key]
+	}
+
+	report := batchReportFile{Command: batchCommand, Args: reportArgs, Secrets: reportSecrets}
+	if reportAppend {
+		if existing, err := readBatchReport(batchReport); err == nil && existing.Command == batchCommand {
+			report = *existing
+		}
+	}
+	report.Runs = append(report.Runs, batchRun{Time: time.Now(), BatchResult: result})
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(batchReport, append(data, '\n'), 0644)
+}
+
+func readBatchReport(path string) (*batchReportFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report batchReportFile
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%s is not a wusbkit report: %w", path, err)
+	}
+	if report.Command == "" || len(report.Runs) == 0 {
+		return nil, fmt.Errorf("%s is not a wusbkit report", path)
+	}
+	return &report, nil
+}
+
+func runRetry(cmd *cobra.Command, args []string) error {
+	report, err := readBatchReport(retryReport)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	opCmd, _, err := rootCmd.Find([]string{report.Command})
+	if err != nil || opCmd == rootCmd || opCmd.Flags().Lookup("serial") == nil {
+		errMsg := fmt.Sprintf("%s: can't retry command %q", retryReport, report.Command)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	secretArgs, err := retrySecretArgs(report)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	serials, err := failedSerials(report.Runs[len(report.Runs)-1])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+	if len(serials) == 0 {
+		if jsonOutput {
+			return PrintJSON(map[string]interface{}{"success": true, "retried": 0})
+		}
+		pterm.Success.Println("No failed drives to retry")
+		return nil
+	}
+
+	// Re-run the operation in-process on the failed drives, selected by
+	// serial; --parallel keeps a single drive on the multi-disk path so the
+	// run lands in the report
+	opArgs := append(report.Args, secretArgs...)
+	opArgs = append(opArgs, "--parallel", "--serial="+strings.Join(serials, ","), "--report="+retryReport)
+	if retryYes {
+		opArgs = append(opArgs, "--yes")
+	}
+	if retryConfirm != "" {
+		opArgs = append(opArgs, "--confirm="+retryConfirm)
+	}
+	if err := opCmd.ParseFlags(opArgs); err != nil {
+		return err
+	}
+	if err := opCmd.ValidateArgs(opCmd.Flags().Args()); err != nil {
+		return err
+	}
+	if !jsonOutput {
+		pterm.Info.Printf("Retrying %s on %d drives\n", report.Command, len(serials))
+	}
+	reportAppend = true
+	return opCmd.RunE(opCmd, opCmd.Flags().Args())
+}
+
+// retrySecretArgs returns the credential flags given to retry as arguments
+// for the retried command, and fails if the report's run used one that
+// isn't given again.
+func retrySecretArgs(report *batchReportFile) ([]string, error) {
+	var args []string
+	for name, value := range retrySecrets {
+		if *value != "" {
+			args = append(args, "--"+name+"="+*value)
+		}
+	}
+	for _, h := range retryHeaders {
+		args = append(args, "--header="+h)
+	}
+
+	var missing []string
+	for _, secret := range report.Secrets {
+		name := strings.TrimPrefix(secret, "--")
+		given := len(retryHeaders) > 0
+		if value, ok := retrySecrets[name]; ok {
+			given = *value != ""
+		}
+		if name == "bearer-token" && os.Getenv("WUSBKIT_BEARER_TOKEN") != "" {
+			given = true
+		}
+		if !given {
+			missing = append(missing, secret)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the run used %s, which the report doesn't store: pass them to retry again", strings.Join(missing, ", "))
+	}
+	return args, nil
+}
+
+// failedSerials returns the serial numbers of the drives that failed in a
+// run and are plugged in, telling the user about those it can't retry.
+func failedSerials(run batchRun) ([]string, error) {
+	devices, err := usb.NewEnumerator().ListDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	var serials []string
+	for _, r := range run.Results {
+		if r.Success {
+			continue
+		}
+		name := fmt.Sprintf("disk %d", r.DiskNumber)
+		if r.DriveLetter != "" {
+			name = "drive " + r.DriveLetter
+		}
+		if r.Serial == "" {
+			if !jsonOutput {
+				pterm.Warning.Printf("Skipping %s: no serial number to find it by\n", name)
+			}
+			continue
+		}
+		found := false
+		for _, d := range devices {
+			if strings.EqualFold(strings.TrimSpace(d.SerialNumber), r.Serial) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if !jsonOutput {
+				pterm.Warning.Printf("Skipping %s: serial %s is not plugged in\n", name, r.Serial)
+			}
+			continue
+		}
+		serials = append(serials, r.Serial)
+	}
+
+	if len(serials) == 0 && run.Failed > 0 {
+		return nil, fmt.Errorf("none of the %d failed drives can be found again", run.Failed)
+	}
+	return serials, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 )
@@ -14,6 +16,9 @@ var (
 	jsonOutput bool
 	verbose    bool
 	noColor    bool
+	engine     string
+	includeBus []string
+	removable  bool
 
 	// Version info (set via ldflags)
 	Version   = "dev"
@@ -28,10 +33,27 @@ var rootCmd = &cobra.Command{
 It provides commands to list, inspect, flash, and format USB drives,
 create disk images, and write bootable ISOs using native Windows APIs
 (WMI, VDS, fmifs) with no external dependencies.`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		if noColor {
 			pterm.DisableColor()
 		}
+		buses := includeBus
+		if removable {
+			buses = []string{usb.BusSD, usb.BusMMC, usb.BusSATARemovable}
+		}
+		err := usb.SetEngine(engine)
+		if err == nil {
+			err = usb.SetIncludeBuses(buses)
+		}
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+		return nil
 	},
 }
 
@@ -43,6 +65,9 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&jsonOutput, "json", "j", false, "Output in JSON format")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show verbose output")
 	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output")
+	rootCmd.PersistentFlags().StringSliceVar(&includeBus, "include-bus", nil, "Also list removable disks on these non-USB buses: sd, mmc, sata-removable")
+	rootCmd.PersistentFlags().BoolVar(&removable, "removable", false, "Also list removable disks on every non-USB bus (same as --include-bus sd,mmc,sata-removable)")
+	rootCmd.PersistentFlags().StringVar(&engine, "engine", usb.EngineAuto, "Drive enumeration engine: auto (WMI, falling back to PowerShell, then SetupAPI), wmi, powershell, setupapi")
 }
 
 // IsJSON returns true if JSON output mode is enabled
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+)
+
+// checkDriveSafety applies the guard rails of commands that erase a drive:
+// it refuses drives larger than maxSize (when given) and drives that look
+// like system disks. Callers skip it when --force is given.
+func checkDriveSafety(enum *usb.Enumerator, device *usb.Device, maxSize string) error {
+	if maxSize != "" {
+		limit, err := parseSize(maxSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-size: %w", err)
+		}
+		if limit > 0 && device.Size > limit {
+			return fmt.Errorf("disk %d: size (%s) exceeds maximum allowed (%s). Use --force to override",
+				device.DiskNumber, device.SizeHuman, maxSize)
+		}
+	}
+	if isSystem, _ := enum.IsSystemDisk(device.DiskNumber); isSystem {
+		return fmt.Errorf("disk %d appears to be a system disk. Use --force to override", device.DiskNumber)
+	}
+	return nil
+}
+
+// targetProblems collects what is wrong with the drives of a multi-disk
+// command, so every bad target is reported at once instead of one per run.
+type targetProblems struct {
+	code     string // Error code of the first problem
+	messages []string
+}
+
+func (p *targetProblems) add(code, message string) {
+	if len(p.messages) == 0 {
+		p.code = code
+	}
+	p.messages = append(p.messages, message)
+}
+
+// report prints the problems found among total drives as one error and
+// returns it, or returns nil if there were none.
+func (p *targetProblems) report(total int) error {
+	if len(p.messages) == 0 {
+		return nil
+	}
+	errMsg := p.messages[0]
+	if len(p.messages) > 1 {
+		sep := "\n  "
+		if jsonOutput {
+			sep = "; "
+		}
+		errMsg = fmt.Sprintf("%d of %d drives can't be used:%s%s",
+			len(p.messages), total, sep, strings.Join(p.messages, sep))
+	}
+	if jsonOutput {
+		output.PrintJSONError(errMsg, p.code)
+	} else {
+		PrintError(errMsg, p.code)
+	}
+	return errors.New(errMsg)
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/spf13/cobra"
+)
+
+var smartCmd = &cobra.Command{
+	Use:   "smart <drive>",
+	Short: "Show SMART health data for a USB drive",
+	Long: `Read health data from a USB drive: temperature, power-on hours, power
+cycles, wear and reallocated sectors, plus the raw SMART attribute table.
+
+SMART attributes are read with an ATA PASS-THROUGH command, which most
+USB-to-SATA enclosures and a few sticks forward to the drive. For other
+drives only the temperature Windows reports (if any) is shown. Most plain
+USB sticks expose no health data at all; the command then exits with an
+error.`,
+	Example: `  wusbkit smart E:
+  wusbkit smart 2 --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSmart,
+}
+
+func init() {
+	addTargetFlags(smartCmd, targetSingle)
+	rootCmd.AddCommand(smartCmd)
+}
+
+// smartReport is the JSON output of the smart command.
+type smartReport struct {
+	DiskNumber int `json:"diskNumber"`
+	*disk.SmartInfo
+}
+
+func runSmart(cmd *cobra.Command, args []string) error {
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to query drive health"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	info, err := disk.QuerySmart(device.DiskNumber)
+	if err == nil && info == nil {
+		err = fmt.Errorf("disk %d (%s) does not expose SMART or health data", device.DiskNumber, device.FriendlyName)
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(smartReport{DiskNumber: device.DiskNumber, SmartInfo: info})
+	}
+	output.PrintSmartInfo(device.DiskNumber, info)
+	return nil
+}
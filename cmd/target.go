@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// targetMode controls how drives selected by addTargetFlags are passed on.
+type targetMode int
+
+const (
+	targetDisks  targetMode = iota // Disk number, or a list for several drives
+	targetLetter                   // Drive letter for one drive, disk numbers for several
+	targetSingle                   // Disk number of exactly one drive
+)
+
+var (
+	targetSerials   string
+	targetPorts     string
+	targetLocations string
+	targetAll       bool
+	targetExclude   string
+	targetMinSize   string
+	targetMaxSize   string
+)
+
+// addTargetFlags registers the flags that select drives by serial number or
+// by the hub port they are plugged into, instead of the drive argument, plus
+// --all, --exclude and the --min-size/--max-size filters for commands that
+// handle several drives. The command's Args and RunE are wrapped so the
+// selected drive is passed as its first argument, in the form mode asks for.
+func addTargetFlags(cmd *cobra.Command, mode targetMode) {
+	cmd.Flags().StringVar(&targetSerials, "serial", "", "Select drives by serial number (comma-separated)")
+	cmd.Flags().StringVar(&targetPorts, "port", "", "Select drives by hub port number (e.g., 3, 1-4 or 1,3,5-8)")
+	cmd.Flags().StringVar(&targetLocations, "location", "", `Select drives by exact port location (e.g., "Port_#0002.Hub_#0003"; comma-separated)`)
+	if mode != targetSingle {
+		cmd.Flags().BoolVar(&targetAll, "all", false, "Select every USB drive (system disks are skipped)")
+		cmd.Flags().StringVar(&targetExclude, "exclude", "", "Leave out drives by serial number, drive letter or disk number (comma-separated)")
+		cmd.Flags().StringVar(&targetMinSize, "min-size", "", "Skip drives smaller than this when selecting several (e.g., 16G)")
+		// flash, format and wipe have their own --max-size safety limit,
+		// which then doubles as the filter
+		if cmd.Flags().Lookup("max-size") == nil {
+			cmd.Flags().StringVar(&targetMaxSize, "max-size", "", "Skip drives larger than this when selecting several (e.g., 64G)")
+		}
+	}
+
+	validate, run := cmd.Args, cmd.RunE
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if targetSelected() {
+			// The selected drive stands in for the drive argument
+			args = append([]string{""}, args...)
+		}
+		if validate == nil {
+			return nil
+		}
+		return validate(cmd, args)
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		sizes, err := targetSizeRange(cmd)
+		if err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+
+		switch {
+		case targetSelected():
+			identifier, err := resolveTarget(mode, sizes)
+			if err != nil {
+				if jsonOutput {
+					output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+				} else {
+					PrintError(err.Error(), output.ErrCodeUSBNotFound)
+				}
+				return err
+			}
+			args = append([]string{identifier}, args...)
+		case sizes.set() && parallel.IsMultiDiskArg(args[0]):
+			identifier, err := filterTargetList(args[0], mode, sizes)
+			if err != nil {
+				if jsonOutput {
+					output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+				} else {
+					PrintError(err.Error(), output.ErrCodeUSBNotFound)
+				}
+				return err
+			}
+			args[0] = identifier
+		}
+		return run(cmd, args)
+	}
+}
+
+// targetSelected reports whether drives were selected with --serial, --port,
+// --location or --all.
+func targetSelected() bool {
+	return targetSerials != "" || targetPorts != "" || targetLocations != "" || targetAll
+}
+
+// resolveTarget finds the drives selected by --serial, --port, --location
+// and --all, minus those matching --exclude, and returns them as a drive
+// argument. The lookup is fresh, so disk numbers that changed when a drive
+// was replugged are picked up.
+func resolveTarget(mode targetMode, sizes sizeRange) (string, error) {
+	ports := make(map[string]bool)
+	if targetPorts != "" {
+		nums, err := parallel.ParseDisks(targetPorts)
+		if err != nil {
+			return "", fmt.Errorf("invalid --port %q: %w", targetPorts, err)
+		}
+		for _, n := range nums {
+			ports[strconv.Itoa(n)] = true
+		}
+	}
+	locations := splitList(targetLocations)
+	serials := splitList(targetSerials)
+
+	enum := usb.NewEnumerator()
+	devices, err := enum.ListDevices()
+	if err != nil {
+		return "", err
+	}
+
+	var matched []usb.Device
+	for _, d := range devices {
+		if targetAll {
+			// A USB system disk (Windows To Go) is never part of "all"
+			if isSystem, _ := enum.IsSystemDisk(d.DiskNumber); isSystem {
+				continue
+			}
+			// Nor is a card reader without a card
+			if !d.HasMedia() {
+				continue
+			}
+			matched = append(matched, d)
+		} else if matchesPort(d, ports, locations) {
+			matched = append(matched, d)
+		}
+	}
+
+	// Every serial must match exactly one drive: a missing drive is an
+	// error, and cheap drives sometimes share a serial number
+	for _, serial := range serials {
+		var found []usb.Device
+		for _, d := range devices {
+			if strings.EqualFold(strings.TrimSpace(d.SerialNumber), serial) {
+				found = append(found, d)
+			}
+		}
+		switch len(found) {
+		case 0:
+			return "", fmt.Errorf("no USB drive with serial number %s", serial)
+		case 1:
+			matched = appendDevice(matched, found[0])
+		default:
+			return "", fmt.Errorf("serial number %s matches %d drives; select them by disk number or port instead", serial, len(found))
+		}
+	}
+
+	exclude := splitList(targetExclude)
+	kept := matched[:0]
+	for _, d := range matched {
+		if !matchesExclude(d, exclude) && sizes.admit(d) {
+			kept = append(kept, d)
+		}
+	}
+	matched = kept
+
+	switch len(matched) {
+	case 0:
+		return "", errors.New("no USB drives match the selection")
+	case 1:
+		d := matched[0]
+		if mode == targetLetter {
+			if d.DriveLetter == "" {
+				return "", fmt.Errorf("disk %d: no drive letter assigned", d.DiskNumber)
+			}
+			return d.DriveLetter, nil
+		}
+		return strconv.Itoa(d.DiskNumber), nil
+	}
+	if mode == targetSingle {
+		return "", fmt.Errorf("%d drives match; this command works on one drive", len(matched))
+	}
+
+	disks := make([]string, len(matched))
+	for i, d := range matched {
+		disks[i] = strconv.Itoa(d.DiskNumber)
+	}
+	return strings.Join(disks, ","), nil
+}
+
+// filterTargetList drops the drives outside the size range from an explicit
+// list of disk numbers or drive letters. Drives that can't be looked up are
+// kept for the command to report.
+func filterTargetList(identifier string, mode targetMode, sizes sizeRange) (string, error) {
+	enum := usb.NewEnumerator()
+	numeric := isNumericIdentifier(identifier)
+
+	var parts []string
+	if numeric {
+		disks, err := parallel.ParseDisks(identifier)
+		if err != nil {
+			return "", err
+		}
+		for _, n := range disks {
+			parts = append(parts, strconv.Itoa(n))
+		}
+	} else {
+		parts = splitList(identifier)
+	}
+
+	var kept []string
+	var lastKept *usb.Device
+	for _, part := range parts {
+		var device *usb.Device
+		var err error
+		if numeric {
+			n, _ := strconv.Atoi(part)
+			device, err = enum.GetDeviceByDiskNumber(n)
+		} else {
+			device, err = enum.GetDeviceByDriveLetter(part)
+		}
+		if err != nil || device == nil {
+			kept = append(kept, part)
+			continue
+		}
+		if sizes.admit(*device) {
+			kept = append(kept, part)
+			lastKept = device
+		}
+	}
+
+	switch {
+	case len(kept) == 0:
+		return "", errors.New("no drives within the --min-size/--max-size range")
+	case len(kept) == 1 && numeric && mode == targetLetter && lastKept != nil && lastKept.DriveLetter != "":
+		return lastKept.DriveLetter, nil
+	}
+	return strings.Join(kept, ","), nil
+}
+
+// sizeRange is the --min-size/--max-size filter; zero bounds are open.
+type sizeRange struct {
+	min, max int64
+}
+
+// targetSizeRange reads the size filter flags of cmd.
+func targetSizeRange(cmd *cobra.Command) (sizeRange, error) {
+	var sizes sizeRange
+	for _, bound := range []struct {
+		flag  string
+		value *int64
+	}{{"min-size", &sizes.min}, {"max-size", &sizes.max}} {
+		f := cmd.Flags().Lookup(bound.flag)
+		if f == nil {
+			continue
+		}
+		n, err := parseSize(f.Value.String())
+		if err != nil {
+			return sizes, fmt.Errorf("invalid --%s: %w", bound.flag, err)
+		}
+		*bound.value = n
+	}
+	if sizes.max > 0 && sizes.min > sizes.max {
+		return sizes, errors.New("--min-size is larger than --max-size")
+	}
+	return sizes, nil
+}
+
+func (r sizeRange) set() bool {
+	return r.min > 0 || r.max > 0
+}
+
+// admit reports whether a drive is within the range, telling the user
+// about drives it skips.
+func (r sizeRange) admit(d usb.Device) bool {
+	if (r.min <= 0 || d.Size >= r.min) && (r.max <= 0 || d.Size <= r.max) {
+		return true
+	}
+	if !jsonOutput {
+		pterm.Info.Printf("Skipping disk %d (%s - %s): outside the --min-size/--max-size range\n",
+			d.DiskNumber, d.FriendlyName, d.SizeHuman)
+	}
+	return false
+}
+
+// matchesPort reports whether a device is plugged into one of the given
+// port numbers or port locations.
+func matchesPort(d usb.Device, ports map[string]bool, locations []string) bool {
+	if d.LocationInfo == "" {
+		return false
+	}
+	if ports[usb.ParsePortNumber(d.LocationInfo)] {
+		return true
+	}
+	for _, loc := range locations {
+		if strings.EqualFold(d.LocationInfo, loc) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesExclude reports whether a device is named in the --exclude list by
+// serial number, drive letter or disk number.
+func matchesExclude(d usb.Device, exclude []string) bool {
+	for _, item := range exclude {
+		switch {
+		case strings.EqualFold(strings.TrimSpace(d.SerialNumber), item):
+			return true
+		case item == strconv.Itoa(d.DiskNumber):
+			return true
+		}
+		// Any of the drive's volumes excludes it
+		for _, v := range d.Volumes {
+			if strings.EqualFold(strings.TrimSuffix(v.DriveLetter, ":"), strings.TrimSuffix(item, ":")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendDevice appends d unless a device with the same disk number is
+// already in the list.
+func appendDevice(devices []usb.Device, d usb.Device) []usb.Device {
+	for _, existing := range devices {
+		if existing.DiskNumber == d.DiskNumber {
+			return devices
+		}
+	}
+	return append(devices, d)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
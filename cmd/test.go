@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	testYes            bool
+	testForce          bool
+	testBuffer         string
+	testDuration       time.Duration
+	testStatusInterval time.Duration
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Test USB drives for defects",
+	Long: `Destructive tests that check whether a USB drive works as advertised.
+
+WARNING: Every test overwrites the whole drive and DESTROYS ALL DATA on it.`,
+}
+
+var testCapacityCmd = &cobra.Command{
+	Use:   "capacity <drive>",
+	Short: "Detect drives with fake capacity",
+	Long: `Fill the whole drive with pseudorandom data and read it back, like f3.
+
+Counterfeit drives report more capacity than their flash holds: past the
+real size they return garbage, or wrap around and overwrite the start of
+the drive. Every 512-byte block is stamped with its own offset, so the
+report separates corrupted blocks from overwritten ones and gives the
+usable size: the bytes from the start up to the first bad block.
+
+A genuine drive passes with its usable size equal to its advertised size.
+The command exits with an error if any block fails.`,
+	Example: `  wusbkit test capacity E:
+  wusbkit test capacity 2 --yes --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTestCapacity,
+}
+
+var testBurninCmd = &cobra.Command{
+	Use:   "burnin <drive>",
+	Short: "Stress-test a drive with repeated write/verify cycles",
+	Long: `Fill the whole drive with fresh pseudorandom data and read it back, over
+and over until --duration has passed, for acceptance testing before drives
+go into service. Without --duration a single cycle runs.
+
+Write and read errors and bytes that read back wrong are counted rather
+than stopping the test, and each cycle's write and read speed is recorded,
+so drives that degrade under sustained load show up in the report. The
+cycle running when the duration ends is cut short and marked partial.
+
+With --json, a status line (cycle, elapsed time, error totals, progress and
+speed) is printed every --status-interval, plus one when each cycle ends
+with that cycle's summary. The command exits with an error if any cycle
+had errors.`,
+	Example: `  wusbkit test burnin E: --duration 2h
+  wusbkit test burnin 2 --duration 24h --yes --json --status-interval 1m`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTestBurnin,
+}
+
+func init() {
+	testBurninCmd.Flags().DurationVar(&testDuration, "duration", 0, "How long to keep cycling, e.g. 30m, 2h (default: one cycle)")
+	testBurninCmd.Flags().DurationVar(&testStatusInterval, "status-interval", 10*time.Second, "Time between status lines with --json")
+	testCmd.PersistentFlags().BoolVarP(&testYes, "yes", "y", false, "Skip confirmation prompt")
+	testCmd.PersistentFlags().BoolVar(&testForce, "force", false, "Allow drives that look like system disks")
+	testCmd.PersistentFlags().StringVarP(&testBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB, 16M)")
+	addConfirmFlag(testCapacityCmd)
+	addTargetFlags(testCapacityCmd, targetSingle)
+	addDrivePicker(testCapacityCmd)
+	addConfirmFlag(testBurninCmd)
+	addTargetFlags(testBurninCmd, targetSingle)
+	addDrivePicker(testBurninCmd)
+	testCmd.AddCommand(testCapacityCmd, testBurninCmd)
+	rootCmd.AddCommand(testCmd)
+}
+
+// prepareTest validates the common flags, resolves the drive, asks for
+// confirmation and locks it. It returns the device, the buffer size in MB
+// and a function releasing the lock, or a nil device if the user declined.
+func prepareTest(identifier, name string) (*usb.Device, int, func(), error) {
+	bufferMB, err := parseBufferSize(testBuffer)
+	if err == nil && (bufferMB < 1 || bufferMB > 64) {
+		err = fmt.Errorf("buffer size must be between 1 and 64 MB")
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return nil, 0, nil, err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return nil, 0, nil, errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return nil, 0, nil, err
+	}
+	if !testForce {
+		if isSystem, _ := enum.IsSystemDisk(device.DiskNumber); isSystem {
+			errMsg := fmt.Sprintf("disk %d appears to be a system disk. Use --force to override", device.DiskNumber)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return nil, 0, nil, errors.New(errMsg)
+		}
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !testYes && !jsonOutput {
+		pterm.Warning.Printf("The %s test will DESTROY ALL DATA on disk %d (%s - %s)\n",
+			name, device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Continue with test?")
+		if !confirmed {
+			pterm.Info.Println("Test cancelled")
+			return nil, 0, nil, nil
+		}
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return nil, 0, nil, err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return nil, 0, nil, errors.New(errMsg)
+	}
+	return device, bufferMB, func() { diskLock.Unlock() }, nil
+}
+
+func runTestCapacity(cmd *cobra.Command, args []string) error {
+	device, bufferMB, unlock, err := prepareTest(args[0], "capacity")
+	if err != nil || device == nil {
+		return err
+	}
+	defer unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts := flash.CapacityOptions{
+		DiskNumber:  device.DiskNumber,
+		DriveLetter: device.DriveLetter,
+		BufferSize:  bufferMB,
+	}
+
+	tester := flash.NewCapacityTester()
+	type capacityDone struct {
+		result *flash.CapacityResult
+		err    error
+	}
+	doneChan := make(chan capacityDone, 1)
+	go func() {
+		result, err := tester.Test(ctx, opts)
+		doneChan <- capacityDone{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range tester.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Opening drive...")
+		for progress := range tester.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				text := fmt.Sprintf("%s %d%% | %s / %s", progress.Stage, progress.Percentage,
+					flash.FormatBytes(progress.BytesWritten), flash.FormatBytes(progress.TotalBytes))
+				if progress.Speed != "" {
+					text += fmt.Sprintf(" | %s", progress.Speed)
+				}
+				spinner.UpdateText(text)
+			case flash.StatusError:
+				spinner.Fail(progress.Error)
+			case flash.StatusComplete:
+				spinner.Success("Capacity test complete")
+			}
+		}
+	}
+
+	done := <-doneChan
+	if done.err != nil {
+		if !jsonOutput && done.err != context.Canceled {
+			PrintError(done.err.Error(), output.ErrCodeInternalError)
+		}
+		return done.err
+	}
+
+	result := done.result
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+	} else {
+		pterm.Info.Printfln("Advertised: %s | Usable: %s (tested in %s)",
+			flash.FormatBytes(result.AdvertisedSize), flash.FormatBytes(result.UsableSize), result.Duration)
+		if !result.Passed {
+			pterm.Info.Printfln("Good: %s | Corrupted: %s | Overwritten: %s",
+				flash.FormatBytes(result.GoodBytes), flash.FormatBytes(result.CorruptedBytes),
+				flash.FormatBytes(result.OverwrittenBytes))
+		}
+		if result.WriteErrors > 0 || result.ReadErrors > 0 {
+			pterm.Info.Printfln("Write errors: %d | Read errors: %d", result.WriteErrors, result.ReadErrors)
+		}
+	}
+
+	if !result.Passed {
+		if result.OverwrittenBytes > 0 {
+			return fmt.Errorf("disk %d has fake capacity: only %s of %s is usable", device.DiskNumber,
+				flash.FormatBytes(result.UsableSize), flash.FormatBytes(result.AdvertisedSize))
+		}
+		return fmt.Errorf("disk %d failed the capacity test: %s of %s corrupted", device.DiskNumber,
+			flash.FormatBytes(result.CorruptedBytes), flash.FormatBytes(result.AdvertisedSize))
+	}
+	return nil
+}
+
+func runTestBurnin(cmd *cobra.Command, args []string) error {
+	if testDuration < 0 || testStatusInterval <= 0 {
+		err := errors.New("--duration and --status-interval must be positive")
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	device, bufferMB, unlock, err := prepareTest(args[0], "burn-in")
+	if err != nil || device == nil {
+		return err
+	}
+	defer unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts := flash.BurninOptions{
+		DiskNumber:  device.DiskNumber,
+		DriveLetter: device.DriveLetter,
+		Duration:    testDuration,
+		BufferSize:  bufferMB,
+	}
+	// The spinner wants frequent updates; log lines don't
+	if jsonOutput {
+		opts.StatusInterval = testStatusInterval
+	}
+
+	tester := flash.NewBurninTester()
+	type burninDone struct {
+		result *flash.BurninResult
+		err    error
+	}
+	doneChan := make(chan burninDone, 1)
+	go func() {
+		result, err := tester.Run(ctx, opts)
+		doneChan <- burninDone{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range tester.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Opening drive...")
+		for progress := range tester.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				if c := progress.Finished; c != nil {
+					pterm.Info.Printfln("Cycle %d: write %s, read %s, %d error(s), %s bad",
+						c.Cycle, flash.FormatBytes(int64(c.WriteBytesPerSec))+"/s",
+						flash.FormatBytes(int64(c.ReadBytesPerSec))+"/s",
+						c.WriteErrors+c.ReadErrors, flash.FormatBytes(c.BadBytes))
+					continue
+				}
+				text := fmt.Sprintf("Cycle %d: %s %d%% | %s elapsed", progress.Cycle, progress.Stage,
+					progress.Percentage, progress.Elapsed)
+				if progress.Speed != "" {
+					text += fmt.Sprintf(" | %s", progress.Speed)
+				}
+				if errs := progress.WriteErrors + progress.ReadErrors; errs > 0 {
+					text += fmt.Sprintf(" | %d error(s)", errs)
+				}
+				spinner.UpdateText(text)
+			case flash.StatusError:
+				spinner.Fail(progress.Error)
+			case flash.StatusComplete:
+				spinner.Success("Burn-in complete")
+			}
+		}
+	}
+
+	done := <-doneChan
+	if done.err != nil {
+		if !jsonOutput && done.err != context.Canceled {
+			PrintError(done.err.Error(), output.ErrCodeInternalError)
+		}
+		return done.err
+	}
+
+	result := done.result
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+	} else {
+		pterm.Info.Printfln("%d cycle(s), %s written in %s", len(result.Cycles),
+			flash.FormatBytes(result.TotalBytesWritten), result.Duration)
+		if result.WriteSpeedChange != 0 || result.ReadSpeedChange != 0 {
+			pterm.Info.Printfln("Speed change, first to last cycle: write %+.1f%%, read %+.1f%%",
+				result.WriteSpeedChange, result.ReadSpeedChange)
+		}
+	}
+
+	if !result.Passed {
+		return fmt.Errorf("disk %d failed burn-in: %d write error(s), %d read error(s), %s bad",
+			device.DiskNumber, result.WriteErrors, result.ReadErrors, flash.FormatBytes(result.BadBytes))
+	}
+	return nil
+}
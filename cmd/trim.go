@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	trimYes   bool
+	trimForce bool
+)
+
+var trimCmd = &cobra.Command{
+	Use:   "trim <drive>",
+	Short: "Discard every block of a USB drive with TRIM",
+	Long: `Send TRIM (ATA DSM or SCSI UNMAP) for the whole drive, telling its
+controller that every block is free. The controller can then erase blocks
+in the background instead of during writes, restoring write speed on
+sticks that have slowed down with use.
+
+WARNING: The drive's data and partition table will be GONE!
+
+Only drives that report TRIM support are trimmed; most plain USB sticks
+don't, while UASP enclosures and some newer sticks do. Trimmed blocks are
+not guaranteed to be erased, so use wipe (optionally with --trim) to
+destroy data.`,
+	Example: `  wusbkit trim E:
+  wusbkit trim 2 --yes --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTrim,
+}
+
+func init() {
+	trimCmd.Flags().BoolVarP(&trimYes, "yes", "y", false, "Skip confirmation prompt")
+	trimCmd.Flags().BoolVar(&trimForce, "force", false, "Allow drives that look like system disks")
+	addConfirmFlag(trimCmd)
+	addTargetFlags(trimCmd, targetSingle)
+	addDrivePicker(trimCmd)
+	rootCmd.AddCommand(trimCmd)
+}
+
+func runTrim(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+	if !trimForce {
+		if isSystem, _ := enum.IsSystemDisk(device.DiskNumber); isSystem {
+			errMsg := fmt.Sprintf("disk %d appears to be a system disk. Use --force to override", device.DiskNumber)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+			} else {
+				PrintError(errMsg, output.ErrCodeInvalidInput)
+			}
+			return errors.New(errMsg)
+		}
+	}
+
+	// Confirmation prompt (unless --yes or --json)
+	if !trimYes && !jsonOutput {
+		pterm.Warning.Printf("This will DISCARD ALL DATA on disk %d (%s - %s)\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman)
+		confirmed, _ := pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("Continue with trim?")
+		if !confirmed {
+			pterm.Info.Println("Trim cancelled")
+			return nil
+		}
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var spinner *pterm.SpinnerPrinter
+	if !jsonOutput {
+		spinner, _ = pterm.DefaultSpinner.Start(fmt.Sprintf("Trimming disk %d...", device.DiskNumber))
+	}
+
+	result, err := flash.Discard(ctx, device.DiskNumber, device.DriveLetter)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			spinner.Fail(err.Error())
+		}
+		return err
+	}
+
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+		return nil
+	}
+	spinner.Success(fmt.Sprintf("Disk %d trimmed (%s in %s)", result.DiskNumber,
+		flash.FormatBytes(result.Size), result.Duration))
+	return nil
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unlockPassword    string
+	unlockRecoveryKey string
+)
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock <drive>",
+	Short: "Unlock a BitLocker-encrypted USB drive",
+	Long: `Unlock a BitLocker To Go volume with its password or 48-digit recovery key.
+
+Without --password or --recovery-key the password is prompted for (not
+available in JSON mode). Requires administrator privileges.`,
+	Example: `  wusbkit unlock E:
+  wusbkit unlock E: --password "correct horse"
+  wusbkit unlock E: --recovery-key 123456-123456-123456-123456-123456-123456-123456-123456`,
+	Args: cobra.ExactArgs(1),
+	RunE: runUnlock,
+}
+
+func init() {
+	unlockCmd.Flags().StringVar(&unlockPassword, "password", "", "BitLocker password")
+	unlockCmd.Flags().StringVar(&unlockRecoveryKey, "recovery-key", "", "48-digit BitLocker recovery key")
+	addTargetFlags(unlockCmd, targetSingle)
+	rootCmd.AddCommand(unlockCmd)
+}
+
+// unlockResult is the JSON output of the unlock command.
+type unlockResult struct {
+	DiskNumber  int    `json:"diskNumber"`
+	DriveLetter string `json:"driveLetter"`
+	Unlocked    bool   `json:"unlocked"`
+}
+
+// resolveUnlockSecret returns the password or recovery key to unlock with,
+// prompting for the password if neither flag was given.
+func resolveUnlockSecret(driveLetter string) (password, recoveryKey string, err error) {
+	if unlockPassword != "" && unlockRecoveryKey != "" {
+		return "", "", errors.New("--password and --recovery-key cannot be used together")
+	}
+	if unlockPassword != "" || unlockRecoveryKey != "" {
+		return unlockPassword, unlockRecoveryKey, nil
+	}
+	if jsonOutput {
+		return "", "", errors.New("--password or --recovery-key is required in JSON mode")
+	}
+	password, err = pterm.DefaultInteractiveTextInput.
+		WithMask("*").
+		Show(fmt.Sprintf("BitLocker password for %s", driveLetter))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if password == "" {
+		return "", "", errors.New("no password given")
+	}
+	return password, "", nil
+}
+
+func runUnlock(cmd *cobra.Command, args []string) error {
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required to unlock BitLocker volumes"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	// By disk number, the drive's locked volume is unlocked rather than its
+	// first one
+	if _, err := strconv.Atoi(args[0]); err == nil {
+		for _, v := range device.Volumes {
+			if v.BitLocker == usb.BitLockerLocked {
+				device.DriveLetter = v.DriveLetter
+				break
+			}
+		}
+	}
+	state := ""
+	for _, v := range device.Volumes {
+		if v.DriveLetter == device.DriveLetter {
+			state = v.BitLocker
+		}
+	}
+
+	if device.DriveLetter == "" || state == "" {
+		errMsg := fmt.Sprintf("Disk %d (%s) has no BitLocker volume", device.DiskNumber, device.FriendlyName)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+
+	if state == usb.BitLockerUnlocked {
+		if jsonOutput {
+			return output.PrintJSON(unlockResult{DiskNumber: device.DiskNumber, DriveLetter: device.DriveLetter, Unlocked: true})
+		}
+		pterm.Info.Printf("%s is already unlocked\n", device.DriveLetter)
+		return nil
+	}
+
+	password, recoveryKey, err := resolveUnlockSecret(device.DriveLetter)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if err := disk.UnlockBitLocker(device.DriveLetter, password, recoveryKey); err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return output.PrintJSON(unlockResult{DiskNumber: device.DiskNumber, DriveLetter: device.DriveLetter, Unlocked: true})
+	}
+	pterm.Success.Printf("Unlocked %s (%s)\n", device.DriveLetter, device.FriendlyName)
+	return nil
+}
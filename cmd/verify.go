@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyImage    string
+	verifyMode     string
+	verifyHashAlgo string
+	verifyBuffer   string
+	verifyZipEntry string
+	verifyNoTrim   bool
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <drive>",
+	Short: "Check a USB drive against an image without writing",
+	Long: `Compare a USB drive with an image file, reading both and writing nothing.
+Useful for auditing drives flashed earlier or by other tools.
+
+The image can be anything flash accepts: a raw, compressed, archived or
+split image, or a URL. Only the image's length is compared; the rest of
+the drive is ignored. Like flash, images with a partition table are only
+compared up to the end of their last partition unless --no-trim is given.
+
+Modes:
+  bytes    Compare buffer by buffer and stop at the first differing byte,
+           reporting its offset (default)
+  hash     Hash the image and the drive with --hash-algo and compare the
+           digests; both are reported, for audit records
+
+The command exits with an error if the drive doesn't match.`,
+	Example: `  wusbkit verify E: --image ubuntu.iso
+  wusbkit verify 2 -i raspios.img.xz --mode hash --hash-algo sha512
+  wusbkit verify 2 -i backup.img.split --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().StringVarP(&verifyImage, "image", "i", "", "Path to image file or URL (required)")
+	verifyCmd.Flags().StringVar(&verifyMode, "mode", flash.VerifyModeBytes, "Compare mode: bytes or hash")
+	verifyCmd.Flags().StringVar(&verifyHashAlgo, "hash-algo", "sha256", "Digest algorithm for --mode hash: sha256, sha512, sha1, md5, blake3, xxhash")
+	verifyCmd.Flags().StringVarP(&verifyBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB, 16M)")
+	verifyCmd.Flags().StringVar(&verifyZipEntry, "zip-entry", "", "File inside a .zip/.7z archive to compare (default: first image)")
+	verifyCmd.Flags().BoolVar(&verifyNoTrim, "no-trim", false, "Compare the whole image instead of stopping after the last partition")
+	addHTTPFlags(verifyCmd)
+	verifyCmd.MarkFlagRequired("image")
+	addTargetFlags(verifyCmd, targetSingle)
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// validateVerifyFlags checks the flags and returns the buffer size in MB.
+func validateVerifyFlags() (int, error) {
+	bufferMB, err := parseBufferSize(verifyBuffer)
+	if err != nil {
+		return 0, err
+	}
+	if bufferMB < 1 || bufferMB > 64 {
+		return 0, fmt.Errorf("buffer size must be between 1 and 64 MB")
+	}
+	switch strings.ToLower(verifyMode) {
+	case flash.VerifyModeBytes:
+	case flash.VerifyModeHash:
+		switch strings.ToLower(verifyHashAlgo) {
+		case "md5", "sha1", "sha256", "sha512", "blake3", "xxhash":
+		default:
+			return 0, fmt.Errorf("unsupported --hash-algo %q: use sha256, sha512, sha1, md5, blake3 or xxhash", verifyHashAlgo)
+		}
+	default:
+		return 0, fmt.Errorf("invalid --mode %q: use bytes or hash", verifyMode)
+	}
+	if !flash.IsURL(verifyImage) {
+		if _, err := os.Stat(verifyImage); os.IsNotExist(err) {
+			return 0, fmt.Errorf("Image file not found: %s", verifyImage)
+		}
+	}
+	return bufferMB, nil
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	bufferMB, err := validateVerifyFlags()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	httpOpts, err := resolveHTTPOptions(verifyImage)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts := flash.VerifyOptions{
+		DiskNumber:  device.DiskNumber,
+		DriveLetter: device.DriveLetter,
+		ImagePath:   verifyImage,
+		Source: flash.SourceOptions{
+			ArchiveEntry: verifyZipEntry,
+			Trim:         !verifyNoTrim,
+			HTTP:         httpOpts,
+		},
+		Mode:          strings.ToLower(verifyMode),
+		HashAlgorithm: strings.ToLower(verifyHashAlgo),
+		BufferSize:    bufferMB,
+	}
+
+	if !jsonOutput {
+		pterm.Info.Printf("Verifying disk %d (%s - %s) against %s\n",
+			device.DiskNumber, device.FriendlyName, device.SizeHuman, verifyImage)
+	}
+
+	verifier := flash.NewVerifier()
+	type verifyDone struct {
+		result *flash.VerifyResult
+		err    error
+	}
+	doneChan := make(chan verifyDone, 1)
+	go func() {
+		result, err := verifier.Verify(ctx, opts)
+		doneChan <- verifyDone{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range verifier.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Opening drive...")
+		for progress := range verifier.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				text := fmt.Sprintf("%s %d%% | %s", progress.Stage, progress.Percentage,
+					flash.FormatBytes(progress.BytesWritten))
+				if progress.TotalBytes > 0 {
+					text += " / " + flash.FormatBytes(progress.TotalBytes)
+				}
+				if progress.Speed != "" {
+					text += fmt.Sprintf(" | %s", progress.Speed)
+				}
+				spinner.UpdateText(text)
+			case flash.StatusError:
+				spinner.Fail(progress.Error)
+			case flash.StatusComplete:
+				spinner.Success("Drive matches the image")
+			}
+		}
+	}
+
+	done := <-doneChan
+	if done.err != nil {
+		if !jsonOutput && done.err != context.Canceled {
+			PrintError(done.err.Error(), output.ErrCodeInternalError)
+		}
+		return done.err
+	}
+
+	result := done.result
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+	} else {
+		pterm.Info.Printfln("Compared %s in %s", flash.FormatBytes(result.BytesCompared), result.Duration)
+		if result.MismatchOffset != nil {
+			pterm.Info.Printfln("First difference at offset %d (%s)",
+				*result.MismatchOffset, flash.FormatBytes(*result.MismatchOffset))
+		}
+		if result.ImageHash != "" {
+			algo := strings.ToUpper(result.HashAlgorithm)
+			pterm.Info.Printfln("%s (image): %s", algo, result.ImageHash)
+			pterm.Info.Printfln("%s (drive): %s", algo, result.DiskHash)
+		}
+	}
+
+	if !result.Match {
+		return fmt.Errorf("disk %d does not match %s", device.DiskNumber, result.Image)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/files"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyFilesManifest string
+	verifyFilesDest     string
+	verifyFilesStrict   bool
+)
+
+var verifyFilesCmd = &cobra.Command{
+	Use:   "verify-files <drive>",
+	Short: "Check the files on a drive against a copy manifest",
+	Long: `Hash the files on a drive's volume and compare them with a manifest
+saved by copy --manifest, for QA of duplicated content sticks.
+
+Every file of the manifest is checked and the report lists the files
+that are missing, corrupted (a different size or hash) and extra (on the
+drive but not in the manifest). Windows' own folders at the root are
+ignored.
+
+The command exits with an error if a file is missing or corrupted, and
+with --strict also if there are extra files.`,
+	Example: `  wusbkit verify-files E: --manifest content.json
+  wusbkit verify-files 2 --manifest content.json --dest kiosk --strict
+  wusbkit verify-files --serial ABC123 --manifest content.json --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runVerifyFiles,
+}
+
+func init() {
+	verifyFilesCmd.Flags().StringVarP(&verifyFilesManifest, "manifest", "m", "", "Manifest saved by copy --manifest (required)")
+	verifyFilesCmd.Flags().StringVar(&verifyFilesDest, "dest", "", "Directory on the drive the files were copied into (default: the root)")
+	verifyFilesCmd.Flags().BoolVar(&verifyFilesStrict, "strict", false, "Also fail if the drive has files not in the manifest")
+	verifyFilesCmd.MarkFlagRequired("manifest")
+	addTargetFlags(verifyFilesCmd, targetSingle)
+	rootCmd.AddCommand(verifyFilesCmd)
+}
+
+func runVerifyFiles(cmd *cobra.Command, args []string) error {
+	manifest, err := files.ReadManifest(verifyFilesManifest)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(args[0])
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+	if device.DriveLetter == "" {
+		errMsg := fmt.Sprintf("disk %d has no volume with a drive letter", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInvalidInput)
+		} else {
+			PrintError(errMsg, output.ErrCodeInvalidInput)
+		}
+		return errors.New(errMsg)
+	}
+	root := filepath.Join(strings.TrimSuffix(device.DriveLetter, ":")+`:\`, verifyFilesDest)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var spinner *pterm.SpinnerPrinter
+	var report func(checked, total int64)
+	if !jsonOutput {
+		pterm.Info.Printf("Checking %s on disk %d (%s - %s) against %s\n",
+			root, device.DiskNumber, device.FriendlyName, device.SizeHuman, verifyFilesManifest)
+		spinner, _ = pterm.DefaultSpinner.Start("Hashing files...")
+		report = func(checked, total int64) {
+			spinner.UpdateText(fmt.Sprintf("Hashing files %d%% | %s / %s", checked*100/max(total, 1),
+				flash.FormatBytes(checked), flash.FormatBytes(total)))
+		}
+	}
+
+	result, err := files.Check(ctx, root, manifest, report)
+	if err != nil {
+		if spinner != nil {
+			spinner.Fail(err.Error())
+		}
+		if err != context.Canceled {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInternalError)
+			}
+		}
+		return err
+	}
+
+	ok := result.OK() && (!verifyFilesStrict || len(result.Extra) == 0)
+	if jsonOutput {
+		data, _ := json.Marshal(struct {
+			*files.CheckResult
+			Match bool `json:"match"`
+		}{result, ok})
+		fmt.Println(string(data))
+	} else {
+		if ok {
+			spinner.Success("Files match the manifest")
+		} else {
+			spinner.Fail("Files don't match the manifest")
+		}
+		pterm.Info.Printfln("%d of %d files intact, %s checked in %s",
+			result.Matched, result.Files, flash.FormatBytes(result.Bytes), result.Duration)
+		printFileList("Missing", result.Missing)
+		printFileList("Corrupted", result.Corrupted)
+		printFileList("Extra", result.Extra)
+	}
+
+	if !ok {
+		return fmt.Errorf("%s: %d missing, %d corrupted, %d extra files",
+			root, len(result.Missing), len(result.Corrupted), len(result.Extra))
+	}
+	return nil
+}
+
+// printFileList prints a titled list of files, if there are any.
+func printFileList(title string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	pterm.Warning.Printfln("%s (%d):", title, len(paths))
+	for _, p := range paths {
+		fmt.Printf("  %s\n", p)
+	}
+}
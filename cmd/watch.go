@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Report USB drives as they are plugged in and removed",
+	Long: `Watch for USB drives being plugged in and removed until interrupted
+with Ctrl+C.
+
+Each event shows the drive's disk number, drive letter, hub port and serial
+number as they are when it arrives, or as they were last seen when it is
+removed. Cards inserted into and taken out of card readers, which stay
+attached, are reported too (media-arrival and media-removal). With --json,
+every event is printed as one JSON line (NDJSON), for inventory tools and
+automation triggers.`,
+	Example: `  wusbkit watch
+  wusbkit watch --json`,
+	Args: cobra.NoArgs,
+	RunE: runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	events := make(chan usb.Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- usb.NewEnumerator().Watch(ctx, events)
+	}()
+
+	if !jsonOutput {
+		pterm.Info.Println("Watching for USB drives (Ctrl+C to stop)")
+		output.PrintDeviceEventHeader()
+	}
+	for ev := range events {
+		if jsonOutput {
+			data, _ := json.Marshal(ev)
+			fmt.Println(string(data))
+		} else {
+			output.PrintDeviceEvent(ev)
+		}
+	}
+
+	if err := <-done; err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInternalError)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInternalError)
+		}
+		return err
+	}
+	return nil
+}
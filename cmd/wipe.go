@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/output"
+	"github.com/lazaroagomez/wusbkit/internal/parallel"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	wipePasses        int
+	wipePattern       string
+	wipeVerify        bool
+	wipeTrim          bool
+	wipeYes           bool
+	wipeForce         bool
+	wipeBuffer        string
+	wipeParallel      bool
+	wipeMaxConcurrent int
+	wipeMaxSize       string
+)
+
+var wipeCmd = &cobra.Command{
+	Use:   "wipe <drive>",
+	Short: "Securely overwrite a whole USB drive",
+	Long: `Overwrite every sector of a USB drive, for decommissioning drives that
+held sensitive data.
+
+WARNING: This will DESTROY ALL DATA on the drive, including the partition
+table. The drive must be formatted or flashed before it can be used again.
+
+Patterns:
+  zero     0x00 on every pass (default)
+  random   Fresh pseudorandom data on every pass
+  dod      DoD 5220.22-M: 0x00, then 0xFF, then random; --passes repeats
+           the three-pass cycle
+
+--verify reads the drive back after the last pass and fails on the first
+sector that doesn't hold the expected data. --trim then discards every
+block (see the trim command), so the stick's controller can erase them
+ahead of the drive's next use; drives without TRIM support are refused
+before the first pass.
+
+Flash media remaps worn blocks internally, so overwriting can't reach data
+in blocks the controller has retired. For full assurance, physically
+destroy drives that held highly sensitive data.
+
+The drive can be specified by drive letter, disk number or several disks
+(e.g., 2,3,4 or 2-6), which are wiped in parallel. --all selects every USB
+drive except system disks; --exclude leaves drives out.`,
+	Example: `  wusbkit wipe E:
+  wusbkit wipe 2 --pattern random --passes 3 --verify --yes
+  wusbkit wipe 2-6 --pattern dod --yes --json
+  wusbkit wipe --all --exclude E:,AA0123 --yes`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWipe,
+}
+
+func init() {
+	wipeCmd.Flags().IntVar(&wipePasses, "passes", 1, "Times to apply the pattern")
+	wipeCmd.Flags().StringVar(&wipePattern, "pattern", flash.WipePatternZero, "Pattern: zero, random, dod")
+	wipeCmd.Flags().BoolVar(&wipeVerify, "verify", false, "Read the drive back after the last pass")
+	wipeCmd.Flags().BoolVar(&wipeTrim, "trim", false, "TRIM the whole drive after wiping")
+	wipeCmd.Flags().BoolVarP(&wipeYes, "yes", "y", false, "Skip confirmation prompt")
+	wipeCmd.Flags().StringVar(&wipeMaxSize, "max-size", "", "Maximum device size to allow (e.g., 64G, 256G); larger drives are skipped when wiping several")
+	wipeCmd.Flags().BoolVar(&wipeForce, "force", false, "Override safety protections (system disk, size limits)")
+	wipeCmd.Flags().StringVarP(&wipeBuffer, "buffer", "b", "4M", "Buffer size (e.g., 4M, 8MB, 16M)")
+	wipeCmd.Flags().BoolVar(&wipeParallel, "parallel", false, "Wipe multiple disks in parallel")
+	wipeCmd.Flags().IntVar(&wipeMaxConcurrent, "max-concurrent", 0, "Max concurrent operations (0=unlimited)")
+	addBatchFlags(wipeCmd)
+	addConfirmFlag(wipeCmd)
+	addTargetFlags(wipeCmd, targetDisks)
+	addDrivePicker(wipeCmd)
+	rootCmd.AddCommand(wipeCmd)
+}
+
+// validateWipeFlags checks the flags and returns the buffer size in MB.
+func validateWipeFlags() (int, error) {
+	bufferMB, err := parseBufferSize(wipeBuffer)
+	if err != nil {
+		return 0, err
+	}
+	if bufferMB < 1 || bufferMB > 64 {
+		return 0, fmt.Errorf("buffer size must be between 1 and 64 MB")
+	}
+	if wipePasses < 1 || wipePasses > 35 {
+		return 0, fmt.Errorf("--passes must be between 1 and 35 (got %d)", wipePasses)
+	}
+	switch strings.ToLower(wipePattern) {
+	case flash.WipePatternZero, flash.WipePatternRandom, flash.WipePatternDoD:
+	default:
+		return 0, fmt.Errorf("invalid --pattern %q: use zero, random or dod", wipePattern)
+	}
+	return bufferMB, nil
+}
+
+func runWipe(cmd *cobra.Command, args []string) error {
+	identifier := args[0]
+
+	bufferMB, err := validateWipeFlags()
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	if !format.IsAdmin() {
+		errMsg := "Administrator privileges required for raw disk access"
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodePermDenied)
+		} else {
+			PrintError(errMsg, output.ErrCodePermDenied)
+		}
+		return errors.New(errMsg)
+	}
+
+	opts := flash.WipeOptions{
+		Passes:     wipePasses,
+		Pattern:    strings.ToLower(wipePattern),
+		Verify:     wipeVerify,
+		Trim:       wipeTrim,
+		BufferSize: bufferMB,
+	}
+
+	if wipeParallel || parallel.IsMultiDiskArg(identifier) {
+		return runParallelWipe(identifier, opts)
+	}
+	return runSingleWipe(identifier, opts)
+}
+
+// confirmWipe lists the drives about to be wiped and asks for confirmation
+// (unless --yes or --json). It reports whether to go ahead.
+func confirmWipe(devices []*usb.Device) bool {
+	if wipeYes || jsonOutput {
+		return true
+	}
+	pterm.Warning.Printf("This will DESTROY ALL DATA on %d drive(s) (%s, %d pass(es)):\n",
+		len(devices), strings.ToLower(wipePattern), wipePasses)
+	for _, d := range devices {
+		pterm.Info.Printf("  Disk %d (%s - %s)\n", d.DiskNumber, d.FriendlyName, d.SizeHuman)
+	}
+	confirmed, _ := pterm.DefaultInteractiveConfirm.
+		WithDefaultValue(false).
+		Show("Continue with wipe?")
+	if !confirmed {
+		pterm.Info.Println("Wipe cancelled")
+	}
+	return confirmed
+}
+
+func runSingleWipe(identifier string, opts flash.WipeOptions) error {
+	enum := usb.NewEnumerator()
+	device, err := enum.GetDevice(identifier)
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeUSBNotFound)
+		} else {
+			PrintError(err.Error(), output.ErrCodeUSBNotFound)
+		}
+		return err
+	}
+	if !wipeForce {
+		if err := checkDriveSafety(enum, device, wipeMaxSize); err != nil {
+			if jsonOutput {
+				output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+			} else {
+				PrintError(err.Error(), output.ErrCodeInvalidInput)
+			}
+			return err
+		}
+	}
+
+	if !confirmWipe([]*usb.Device{device}) {
+		return nil
+	}
+
+	diskLock, err := lock.NewDiskLock(device.DiskNumber)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to create disk lock: %v", err)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeInternalError)
+		} else {
+			PrintError(errMsg, output.ErrCodeInternalError)
+		}
+		return err
+	}
+	if err := diskLock.TryLock(context.Background(), 2*time.Second); err != nil {
+		errMsg := fmt.Sprintf("disk %d is busy (another operation in progress)", device.DiskNumber)
+		if jsonOutput {
+			output.PrintJSONError(errMsg, output.ErrCodeDiskBusy)
+		} else {
+			PrintError(errMsg, output.ErrCodeDiskBusy)
+		}
+		return errors.New(errMsg)
+	}
+	defer diskLock.Unlock()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	opts.DiskNumber = device.DiskNumber
+	opts.DriveLetter = device.DriveLetter
+
+	wiper := flash.NewWiper()
+	type wipeDone struct {
+		result *flash.WipeResult
+		err    error
+	}
+	doneChan := make(chan wipeDone, 1)
+	go func() {
+		result, err := wiper.Wipe(ctx, opts)
+		doneChan <- wipeDone{result, err}
+	}()
+
+	if jsonOutput {
+		for progress := range wiper.Progress() {
+			data, _ := json.Marshal(progress)
+			fmt.Println(string(data))
+		}
+	} else {
+		spinner, _ := pterm.DefaultSpinner.Start("Opening drive...")
+		for progress := range wiper.Progress() {
+			switch progress.Status {
+			case flash.StatusInProgress:
+				text := fmt.Sprintf("%s %d%% | %s / %s", progress.Stage, progress.Percentage,
+					flash.FormatBytes(progress.BytesWritten), flash.FormatBytes(progress.TotalBytes))
+				if progress.Passes > 1 {
+					text = fmt.Sprintf("%s (pass %d/%d) %d%%", progress.Stage, progress.Pass, progress.Passes, progress.Percentage)
+				}
+				if progress.Speed != "" {
+					text += fmt.Sprintf(" | %s", progress.Speed)
+				}
+				spinner.UpdateText(text)
+			case flash.StatusError:
+				spinner.Fail(progress.Error)
+			case flash.StatusComplete:
+				spinner.Success("Wipe complete!")
+			}
+		}
+	}
+
+	done := <-doneChan
+	if done.err != nil {
+		if !jsonOutput && done.err != context.Canceled {
+			PrintError(done.err.Error(), output.ErrCodeInternalError)
+		}
+		return done.err
+	}
+
+	result := done.result
+	if jsonOutput {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+		return nil
+	}
+	msg := fmt.Sprintf("Wiped %s with %d %s pass(es) in %s", flash.FormatBytes(result.Size),
+		result.Passes, result.Pattern, result.Duration)
+	if result.Verified {
+		msg += " (verified)"
+	}
+	if result.Trimmed {
+		msg += " (trimmed)"
+	}
+	pterm.Info.Println(msg)
+	return nil
+}
+
+func runParallelWipe(identifier string, opts flash.WipeOptions) error {
+	disks, err := parallel.ParseDisks(identifier)
+	if err == nil && len(disks) == 0 {
+		err = errors.New("no valid disk numbers provided")
+	}
+	if err != nil {
+		if jsonOutput {
+			output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+		} else {
+			PrintError(err.Error(), output.ErrCodeInvalidInput)
+		}
+		return err
+	}
+
+	// Validate all disks exist, are USB and pass the safety checks
+	enum := usb.NewEnumerator()
+	var devices []*usb.Device
+	for _, diskNum := range disks {
+		device, err := enum.GetDeviceByDiskNumber(diskNum)
+		if err != nil {
+			errMsg := fmt.Sprintf("disk %d: %v", diskNum, err)
+			if jsonOutput {
+				output.PrintJSONError(errMsg, output.ErrCodeUSBNotFound)
+			} else {
+				PrintError(errMsg, output.ErrCodeUSBNotFound)
+			}
+			return fmt.Errorf("disk %d: %w", diskNum, err)
+		}
+		if !wipeForce {
+			if err := checkDriveSafety(enum, device, wipeMaxSize); err != nil {
+				if jsonOutput {
+					output.PrintJSONError(err.Error(), output.ErrCodeInvalidInput)
+				} else {
+					PrintError(err.Error(), output.ErrCodeInvalidInput)
+				}
+				return err
+			}
+		}
+		devices = append(devices, device)
+	}
+
+	if !confirmWipe(devices) {
+		return nil
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	executor := newBatchExecutor(wipeMaxConcurrent, len(disks))
+	if !jsonOutput {
+		pterm.Info.Printf("Wiping %d drives in parallel...\n", len(disks))
+	}
+
+	result := executor.WipeAll(ctx, disks, opts)
+
+	// Output result (non-JSON mode - JSON mode streams NDJSON)
+	if !jsonOutput {
+		parallel.PrintBatchResult(result, "Wiped")
+	}
+
+	return finishBatch(result, "wipe")
+}
@@ -0,0 +1,424 @@
+// Package cache keeps downloaded images in a local content-addressed store,
+// so the same remote image can be flashed many times without re-streaming it.
+//
+// Layout under the cache directory:
+//
+//	blobs/<sha256>/<file name>   image exactly as downloaded (still compressed)
+//	tmp/                         partial downloads
+//	index.json                   URL -> blob mapping with pull/use timestamps
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+)
+
+const indexFile = "index.json"
+
+// Entry describes one cached image.
+type Entry struct {
+	SHA256   string    `json:"sha256"`
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	PulledAt time.Time `json:"pulledAt"`
+	LastUsed time.Time `json:"lastUsed"`
+	Path     string    `json:"path"`
+}
+
+// VerifyResult is the outcome of re-hashing one cached image.
+type VerifyResult struct {
+	Entry
+	OK     bool   `json:"ok"`
+	Actual string `json:"actual,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GCResult summarizes what a garbage collection removed.
+type GCResult struct {
+	Removed []string `json:"removed"`
+	Freed   int64    `json:"freed"`
+}
+
+// Cache is a local image store rooted at a directory.
+type Cache struct {
+	dir string
+}
+
+// DefaultDir returns the cache directory: $WUSBKIT_CACHE_DIR if set,
+// otherwise wusbkit\images under the user's local cache (%LOCALAPPDATA%).
+func DefaultDir() (string, error) {
+	if dir := os.Getenv("WUSBKIT_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	return filepath.Join(base, "wusbkit", "images"), nil
+}
+
+// Open returns the cache rooted at dir, or at DefaultDir if dir is empty.
+func Open(dir string) (*Cache, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the cache's root directory.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// List returns all cached images, most recently pulled first.
+func (c *Cache) List() ([]Entry, error) {
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// Lookup returns the cached copy of url, if present, and records the use
+// so gc keeps recently flashed images.
+func (c *Cache) Lookup(url string) (*Entry, bool) {
+	entries, err := c.load()
+	if err != nil {
+		return nil, false
+	}
+	for i := range entries {
+		if entries[i].URL != url {
+			continue
+		}
+		if _, err := os.Stat(entries[i].Path); err != nil {
+			return nil, false
+		}
+		entries[i].LastUsed = time.Now()
+		_ = c.save(entries)
+		return &entries[i], true
+	}
+	return nil, false
+}
+
+// Pull downloads url into the cache, replacing any earlier copy of the same
+// URL. If expected is set the download must match it. onProgress (if
+// non-nil) is called with bytes downloaded and the total (SizeUnknown if
+// the server sent no length).
+func (c *Cache) Pull(ctx context.Context, url string, httpOpts flash.HTTPOptions, expected flash.ExpectedHash, onProgress func(done, total int64)) (*Entry, error) {
+	tmpDir := filepath.Join(c.dir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	httpOpts.Context = ctx
+	body, name, total, err := flash.OpenURL(url, httpOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(tmpDir, "pull-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op once renamed into blobs/
+
+	hasher := sha256.New()
+	size, err := copyWithProgress(ctx, io.MultiWriter(tmp, hasher), body, total, onProgress)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	digest := hex.EncodeToString(hasher.Sum(nil))
+
+	if expected.IsSet() {
+		actual := digest
+		if expected.Algorithm != "sha256" {
+			if actual, err = flash.HashFile(ctx, tmpPath, expected.Algorithm, nil); err != nil {
+				return nil, err
+			}
+		}
+		if actual != expected.Digest {
+			return nil, fmt.Errorf("checksum mismatch: expected %s %s, got %s",
+				expected.Algorithm, expected.Digest, actual)
+		}
+	}
+
+	name = blobName(name, digest)
+	blobDir := filepath.Join(c.dir, "blobs", digest)
+	blobPath := filepath.Join(blobDir, name)
+	if _, err := os.Stat(blobPath); err != nil {
+		if err := os.MkdirAll(blobDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		if err := os.Rename(tmpPath, blobPath); err != nil {
+			return nil, fmt.Errorf("failed to store image: %w", err)
+		}
+	}
+
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entry := Entry{
+		SHA256:   digest,
+		URL:      url,
+		Name:     name,
+		Size:     size,
+		PulledAt: now,
+		LastUsed: now,
+		Path:     blobPath,
+	}
+	var replaced []Entry
+	entries, replaced = removeEntries(entries, func(e Entry) bool { return e.URL == url })
+	entries = append(entries, entry)
+	if err := c.save(entries); err != nil {
+		return nil, err
+	}
+	c.removeUnreferenced(entries, replaced)
+
+	return &entry, nil
+}
+
+// blobName returns the file name to store a download under. The name comes
+// from the server (URL path or Content-Disposition), so only its last element
+// is kept, and the digest stands in when nothing usable is left.
+func blobName(name, digest string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	// Base turns "" into "." and a bare separator into itself
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return digest
+	}
+	return name
+}
+
+// Verify re-hashes every cached image and compares it with its stored digest.
+func (c *Cache) Verify(ctx context.Context, onProgress func(e Entry, done, total int64)) ([]VerifyResult, error) {
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]VerifyResult, 0, len(entries))
+	for _, e := range entries {
+		result := VerifyResult{Entry: e}
+		actual, err := flash.HashFile(ctx, e.Path, "sha256", func(done, total int64) {
+			if onProgress != nil {
+				onProgress(e, done, total)
+			}
+		})
+		switch {
+		case ctx.Err() != nil:
+			return results, ctx.Err()
+		case err != nil:
+			result.Error = err.Error()
+		default:
+			result.Actual = actual
+			result.OK = actual == e.SHA256
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Remove deletes the cached images matching query: a URL, a file name, or a
+// SHA-256 prefix of at least 8 characters. Returns the removed entries.
+func (c *Cache) Remove(query string) ([]Entry, error) {
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.TrimSpace(query)
+	entries, removed := removeEntries(entries, func(e Entry) bool {
+		return e.URL == query ||
+			strings.EqualFold(e.Name, query) ||
+			(len(query) >= 8 && strings.HasPrefix(e.SHA256, strings.ToLower(query)))
+	})
+	if len(removed) == 0 {
+		return nil, fmt.Errorf("no cached image matches %q", query)
+	}
+
+	if err := c.save(entries); err != nil {
+		return nil, err
+	}
+	c.removeUnreferenced(entries, removed)
+	return removed, nil
+}
+
+// GC removes partial downloads, blobs no index entry refers to, and (if
+// unusedFor > 0) images not pulled or flashed within that duration.
+func (c *Cache) GC(unusedFor time.Duration) (*GCResult, error) {
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	result := &GCResult{Removed: []string{}}
+
+	if unusedFor > 0 {
+		cutoff := time.Now().Add(-unusedFor)
+		var stale []Entry
+		entries, stale = removeEntries(entries, func(e Entry) bool { return e.LastUsed.Before(cutoff) })
+		if len(stale) > 0 {
+			if err := c.save(entries); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	referenced := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		referenced[e.SHA256] = true
+	}
+
+	blobs, _ := os.ReadDir(filepath.Join(c.dir, "blobs"))
+	for _, b := range blobs {
+		if referenced[b.Name()] {
+			continue
+		}
+		path := filepath.Join(c.dir, "blobs", b.Name())
+		result.Freed += dirSize(path)
+		if err := os.RemoveAll(path); err == nil {
+			result.Removed = append(result.Removed, path)
+		}
+	}
+
+	tmps, _ := os.ReadDir(filepath.Join(c.dir, "tmp"))
+	for _, t := range tmps {
+		path := filepath.Join(c.dir, "tmp", t.Name())
+		result.Freed += dirSize(path)
+		if err := os.RemoveAll(path); err == nil {
+			result.Removed = append(result.Removed, path)
+		}
+	}
+
+	return result, nil
+}
+
+// load reads the index. A missing index is an empty cache.
+func (c *Cache) load() ([]Entry, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache index: %w", err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("cache index is corrupt: %w", err)
+	}
+	return entries, nil
+}
+
+// save writes the index atomically so an interrupted write can't corrupt it.
+func (c *Cache) save(entries []Entry) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(c.dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, indexFile)); err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	return nil
+}
+
+// removeUnreferenced deletes the blobs of removed entries that no remaining
+// entry shares (two URLs can serve the same image).
+func (c *Cache) removeUnreferenced(remaining, removed []Entry) {
+	for _, r := range removed {
+		shared := false
+		for _, e := range remaining {
+			if e.SHA256 == r.SHA256 {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			os.RemoveAll(filepath.Join(c.dir, "blobs", r.SHA256))
+		}
+	}
+}
+
+// removeEntries splits entries into those kept and those matching drop.
+func removeEntries(entries []Entry, drop func(Entry) bool) (kept, removed []Entry) {
+	kept = entries[:0:0]
+	for _, e := range entries {
+		if drop(e) {
+			removed = append(removed, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	return kept, removed
+}
+
+// copyWithProgress copies src to dst, reporting progress and honouring ctx.
+func copyWithProgress(ctx context.Context, dst io.Writer, src io.Reader, total int64, onProgress func(done, total int64)) (int64, error) {
+	buf := make([]byte, 1<<20)
+	var done int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return done, werr
+			}
+			done += int64(n)
+			if onProgress != nil {
+				onProgress(done, total)
+			}
+		}
+		if err == io.EOF {
+			return done, nil
+		}
+		if err != nil {
+			return done, err
+		}
+	}
+}
+
+// dirSize returns the total size of the files under path.
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
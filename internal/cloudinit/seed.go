@@ -0,0 +1,114 @@
+// Package cloudinit writes cloud-init NoCloud seed files onto a freshly
+// flashed drive so cloud images provision themselves on first boot.
+package cloudinit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"golang.org/x/sys/windows"
+)
+
+// volumeWaitTimeout is how long to wait for Windows to mount the flashed
+// image's partitions after the partition table is re-read.
+const volumeWaitTimeout = 15 * time.Second
+
+// Seed holds the NoCloud seed files.
+type Seed struct {
+	UserData []byte
+	MetaData []byte
+}
+
+// LoadSeed reads the user-data file and optional meta-data file. When no
+// meta-data is given, a minimal one with a fresh instance-id is generated so
+// cloud-init treats the drive as a new instance.
+func LoadSeed(userDataPath, metaDataPath string) (*Seed, error) {
+	userData, err := os.ReadFile(userDataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user-data: %w", err)
+	}
+	if len(strings.TrimSpace(string(userData))) == 0 {
+		return nil, fmt.Errorf("user-data file %s is empty", userDataPath)
+	}
+
+	var metaData []byte
+	if metaDataPath != "" {
+		metaData, err = os.ReadFile(metaDataPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read meta-data: %w", err)
+		}
+	} else {
+		metaData = []byte(fmt.Sprintf("instance-id: iid-wusbkit-%d\n", time.Now().Unix()))
+	}
+
+	return &Seed{UserData: userData, MetaData: metaData}, nil
+}
+
+// WriteSeed writes user-data and meta-data to the root of the first FAT
+// volume on the disk (the boot partition of typical cloud and Raspberry Pi
+// images), where the NoCloud datasource picks them up. The partition table
+// is re-read first so Windows mounts the partitions that were just flashed.
+// Returns the volume path the seed was written to.
+func WriteSeed(diskNumber int, seed *Seed) (string, error) {
+	if err := rescanDisk(diskNumber); err != nil {
+		return "", err
+	}
+
+	volumePath, err := waitForFATVolume(diskNumber, volumeWaitTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"user-data", seed.UserData},
+		{"meta-data", seed.MetaData},
+	}
+	for _, f := range files {
+		path := filepath.Join(volumePath, f.name)
+		if err := os.WriteFile(path, f.data, 0644); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+	}
+
+	return volumePath, nil
+}
+
+// rescanDisk asks Windows to re-read the partition table after a raw write.
+func rescanDisk(diskNumber int) error {
+	handle, err := disk.OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return fmt.Errorf("rescan disk: %w", err)
+	}
+	defer windows.CloseHandle(handle)
+
+	if err := disk.UpdateDiskProperties(handle); err != nil {
+		return fmt.Errorf("rescan disk: %w", err)
+	}
+	return nil
+}
+
+// waitForFATVolume polls until a FAT-formatted volume appears on the disk.
+func waitForFATVolume(diskNumber int, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		volumes, _ := disk.ListVolumesByDiskNumber(diskNumber)
+		for _, v := range volumes {
+			fs, err := disk.GetVolumeFileSystem(v)
+			if err == nil && strings.HasPrefix(strings.ToUpper(fs), "FAT") {
+				return v, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("no FAT boot partition found on disk %d to hold the cloud-init seed", diskNumber)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
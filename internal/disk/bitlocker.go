@@ -1,10 +1,14 @@
 package disk
 
 import (
+	"errors"
 	"fmt"
+	"runtime"
 	"strings"
 
 	"github.com/StackExchange/wmi"
+	"github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
 )
 
 // bitlockerNamespace is the WMI namespace for BitLocker volume encryption.
@@ -21,6 +25,17 @@ type BitLockerStatus struct {
 	DriveLetter      string
 	ProtectionStatus int  // 0=Off, 1=On, 2=Unknown
 	IsProtected      bool // true when ProtectionStatus == 1
+	IsLocked         bool // true when ProtectionStatus == 2, which Windows reports for locked volumes
+}
+
+// newBitLockerStatus converts a WMI result to a BitLockerStatus.
+func newBitLockerStatus(vol win32EncryptableVolume) *BitLockerStatus {
+	return &BitLockerStatus{
+		DriveLetter:      vol.DriveLetter,
+		ProtectionStatus: int(vol.ProtectionStatus),
+		IsProtected:      vol.ProtectionStatus == 1,
+		IsLocked:         vol.ProtectionStatus == 2,
+	}
 }
 
 // CheckBitLocker checks if a volume is BitLocker-protected.
@@ -49,16 +64,37 @@ func CheckBitLocker(driveLetter string) (*BitLockerStatus, error) {
 		return nil, nil
 	}
 
-	vol := results[0]
-	return &BitLockerStatus{
-		DriveLetter:      vol.DriveLetter,
-		ProtectionStatus: int(vol.ProtectionStatus),
-		IsProtected:      vol.ProtectionStatus == 1,
-	}, nil
+	return newBitLockerStatus(results[0]), nil
+}
+
+// QueryBitLocker returns the BitLocker state of every volume with a drive
+// letter, keyed by "X:". Returns nil (not an error) if the BitLocker WMI
+// class is not available. The class requires administrator privileges.
+func QueryBitLocker() (map[string]BitLockerStatus, error) {
+	var results []win32EncryptableVolume
+	err := wmi.QueryNamespace(
+		"SELECT DriveLetter, ProtectionStatus FROM Win32_EncryptableVolume",
+		&results, bitlockerNamespace,
+	)
+	if err != nil {
+		if isWMIClassNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("BitLocker WMI query: %w", err)
+	}
+
+	volumes := make(map[string]BitLockerStatus, len(results))
+	for _, vol := range results {
+		if vol.DriveLetter == "" {
+			continue
+		}
+		volumes[normalizeDriveLetter(vol.DriveLetter)] = *newBitLockerStatus(vol)
+	}
+	return volumes, nil
 }
 
 // CheckBitLockerByDisk checks all volumes on a physical disk for BitLocker protection.
-// Returns only protected volumes (empty slice if none are protected).
+// Returns only protected or locked volumes (empty slice if there are none).
 func CheckBitLockerByDisk(diskNumber int) ([]BitLockerStatus, error) {
 	letters, err := getVolumeLettersForDisk(diskNumber)
 	if err != nil {
@@ -71,7 +107,7 @@ func CheckBitLockerByDisk(diskNumber int) ([]BitLockerStatus, error) {
 		if err != nil {
 			return nil, err
 		}
-		if status != nil && status.IsProtected {
+		if status != nil && (status.IsProtected || status.IsLocked) {
 			protected = append(protected, *status)
 		}
 	}
@@ -107,6 +143,95 @@ func getVolumeLettersForDisk(diskNumber int) ([]string, error) {
 	return letters, nil
 }
 
+// fveFailedAuthentication is FVE_E_FAILED_AUTHENTICATION, returned for a
+// wrong password or recovery key.
+const fveFailedAuthentication = 0x80310027
+
+// UnlockBitLocker unlocks a BitLocker To Go volume with its password or, if
+// recoveryKey is set, its 48-digit recovery key. Requires administrator
+// privileges.
+func UnlockBitLocker(driveLetter, password, recoveryKey string) error {
+	driveLetter = normalizeDriveLetter(driveLetter)
+
+	// COM is initialized per thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		// S_FALSE means COM was already initialized on this thread
+		var oleErr *ole.OleError
+		if !errors.As(err, &oleErr) || oleErr.Code() != 1 {
+			return fmt.Errorf("CoInitializeEx: %w", err)
+		}
+	}
+	defer ole.CoUninitialize()
+
+	unknown, err := oleutil.CreateObject("WbemScripting.SWbemLocator")
+	if err != nil {
+		return fmt.Errorf("create WMI locator: %w", err)
+	}
+	defer unknown.Release()
+
+	locator, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("WMI locator: %w", err)
+	}
+	defer locator.Release()
+
+	serviceRaw, err := oleutil.CallMethod(locator, "ConnectServer", nil, bitlockerNamespace)
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", bitlockerNamespace, err)
+	}
+	defer serviceRaw.Clear()
+	service := serviceRaw.ToIDispatch()
+
+	resultRaw, err := oleutil.CallMethod(service, "ExecQuery", fmt.Sprintf(
+		"SELECT * FROM Win32_EncryptableVolume WHERE DriveLetter='%s'", driveLetter,
+	))
+	if err != nil {
+		return fmt.Errorf("BitLocker WMI query for %s: %w", driveLetter, err)
+	}
+	defer resultRaw.Clear()
+	result := resultRaw.ToIDispatch()
+
+	countVar, err := oleutil.GetProperty(result, "Count")
+	if err != nil {
+		return fmt.Errorf("BitLocker WMI query for %s: %w", driveLetter, err)
+	}
+	if countVar.Val == 0 {
+		return fmt.Errorf("%s is not a BitLocker volume", driveLetter)
+	}
+
+	itemRaw, err := oleutil.CallMethod(result, "ItemIndex", 0)
+	if err != nil {
+		return fmt.Errorf("BitLocker volume %s: %w", driveLetter, err)
+	}
+	defer itemRaw.Clear()
+	volume := itemRaw.ToIDispatch()
+
+	method, secret := "UnlockWithPassphrase", password
+	if recoveryKey != "" {
+		method, secret = "UnlockWithNumericalPassword", strings.TrimSpace(recoveryKey)
+	}
+	ret, err := oleutil.CallMethod(volume, method, secret)
+	if err != nil {
+		return fmt.Errorf("%s on %s: %w", method, driveLetter, err)
+	}
+	defer ret.Clear()
+
+	switch code := uint32(ret.Val); code {
+	case 0:
+		return nil
+	case fveFailedAuthentication:
+		if recoveryKey != "" {
+			return fmt.Errorf("wrong recovery key for %s", driveLetter)
+		}
+		return fmt.Errorf("wrong password for %s", driveLetter)
+	default:
+		return fmt.Errorf("%s on %s failed: 0x%08X", method, driveLetter, code)
+	}
+}
+
 // normalizeDriveLetter ensures the drive letter is in "X:" format.
 func normalizeDriveLetter(dl string) string {
 	dl = strings.TrimSpace(dl)
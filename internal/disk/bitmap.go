@@ -0,0 +1,152 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Volume FSCTLs for reading the cluster allocation map.
+const (
+	FSCTL_GET_VOLUME_BITMAP          = 0x0009006F
+	FSCTL_GET_RETRIEVAL_POINTER_BASE = 0x00090234
+)
+
+// volumeBitmapChunk is how much bitmap is requested per FSCTL call (one bit
+// per cluster, so 1 MB covers 8M clusters).
+const volumeBitmapChunk = 1 << 20
+
+var procGetDiskFreeSpaceW = kernel32.NewProc("GetDiskFreeSpaceW")
+
+// VolumeBitmap is the cluster allocation map of a mounted volume.
+type VolumeBitmap struct {
+	ClusterSize int64 // Bytes per cluster
+	DataOffset  int64 // Bytes from the volume start to cluster 0 (FAT data area; 0 on NTFS)
+	Clusters    int64 // Number of clusters in the bitmap
+	bitmap      []byte
+}
+
+// Allocated reports whether the given cluster is in use.
+func (b *VolumeBitmap) Allocated(cluster int64) bool {
+	return b.bitmap[cluster/8]&(1<<(cluster%8)) != 0
+}
+
+// GetVolumeClusterSize returns the cluster size in bytes of a mounted
+// volume given by its GUID path (e.g. `\\?\Volume{GUID}\`).
+func GetVolumeClusterSize(volumeGUIDPath string) (int64, error) {
+	clusterSize, _, err := volumeGeometry(volumeGUIDPath)
+	return clusterSize, err
+}
+
+// volumeGeometry returns the cluster and sector sizes in bytes of a mounted
+// volume given by its GUID path.
+func volumeGeometry(volumeGUIDPath string) (clusterSize, sectorSize int64, err error) {
+	var sectorsPerCluster, bytesPerSector, freeClusters, totalClusters uint32
+	rootPtr, err := syscall.UTF16PtrFromString(strings.TrimRight(volumeGUIDPath, `\`) + `\`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid volume path: %w", err)
+	}
+	r, _, err := procGetDiskFreeSpaceW.Call(
+		uintptr(unsafe.Pointer(rootPtr)),
+		uintptr(unsafe.Pointer(&sectorsPerCluster)),
+		uintptr(unsafe.Pointer(&bytesPerSector)),
+		uintptr(unsafe.Pointer(&freeClusters)),
+		uintptr(unsafe.Pointer(&totalClusters)),
+	)
+	if r == 0 {
+		return 0, 0, fmt.Errorf("GetDiskFreeSpaceW: %w", err)
+	}
+	return int64(sectorsPerCluster) * int64(bytesPerSector), int64(bytesPerSector), nil
+}
+
+// GetVolumeBitmap reads the allocation bitmap of a mounted FAT, exFAT or
+// NTFS volume given by its GUID path (e.g. `\\?\Volume{GUID}\`).
+func GetVolumeBitmap(volumeGUIDPath string) (*VolumeBitmap, error) {
+	clusterSize, sectorSize, err := volumeGeometry(volumeGUIDPath)
+	if err != nil {
+		return nil, err
+	}
+
+	devPtr, err := syscall.UTF16PtrFromString(strings.TrimRight(volumeGUIDPath, `\`))
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume path: %w", err)
+	}
+	h, err := windows.CreateFile(
+		devPtr,
+		windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open volume: %w", err)
+	}
+	defer windows.CloseHandle(h)
+
+	// Cluster 0 of FAT volumes starts after the reserved sectors and FATs
+	var base int64
+	var bytesReturned uint32
+	err = windows.DeviceIoControl(
+		h,
+		FSCTL_GET_RETRIEVAL_POINTER_BASE,
+		nil, 0,
+		(*byte)(unsafe.Pointer(&base)),
+		uint32(unsafe.Sizeof(base)),
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("FSCTL_GET_RETRIEVAL_POINTER_BASE: %w", err)
+	}
+
+	result := &VolumeBitmap{
+		ClusterSize: clusterSize,
+		DataOffset:  base * sectorSize,
+	}
+
+	// VOLUME_BITMAP_BUFFER: StartingLcn, BitmapSize (clusters), bitmap bytes
+	out := make([]byte, 16+volumeBitmapChunk)
+	var startingLCN int64
+	for {
+		bytesReturned = 0
+		err := windows.DeviceIoControl(
+			h,
+			FSCTL_GET_VOLUME_BITMAP,
+			(*byte)(unsafe.Pointer(&startingLCN)),
+			uint32(unsafe.Sizeof(startingLCN)),
+			&out[0],
+			uint32(len(out)),
+			&bytesReturned,
+			nil,
+		)
+		if err != nil && !errors.Is(err, windows.ERROR_MORE_DATA) {
+			return nil, fmt.Errorf("FSCTL_GET_VOLUME_BITMAP: %w", err)
+		}
+		if bytesReturned < 16 {
+			return nil, errors.New("FSCTL_GET_VOLUME_BITMAP: short response")
+		}
+
+		// The returned StartingLcn is rounded down to a byte boundary
+		chunkStart := int64(binary.LittleEndian.Uint64(out[0:8]))
+		total := int64(binary.LittleEndian.Uint64(out[8:16])) + chunkStart
+		result.Clusters = total
+		if result.bitmap == nil {
+			result.bitmap = make([]byte, (total+7)/8)
+		}
+		copy(result.bitmap[chunkStart/8:], out[16:bytesReturned])
+
+		if err == nil {
+			break
+		}
+		startingLCN = chunkStart + int64(bytesReturned-16)*8
+	}
+
+	return result, nil
+}
@@ -0,0 +1,180 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Volumes are retried for a moment before an eject gives up on them, as
+// Explorer and indexers briefly hold newly written volumes open.
+const (
+	ejectLockAttempts = 10
+	ejectLockDelay    = 200 * time.Millisecond
+)
+
+// ErrVolumeInUse is returned (wrapped, as a *VolumeInUseError) by EjectDisk
+// when a volume can't be locked because a program has a file, folder or
+// window open on it.
+var ErrVolumeInUse = errors.New("volume is in use")
+
+// EjectOptions configures an eject.
+type EjectOptions struct {
+	// Force dismounts volumes that programs hold open instead of failing;
+	// the programs' open files stop working
+	Force bool
+}
+
+// EjectDisk safely ejects a physical disk. Each of its volumes has its
+// write cache flushed, is locked so nothing can open it again, and is
+// dismounted; the disk is then allowed to be removed and ejected with
+// IOCTL_STORAGE_EJECT_MEDIA. The volumes stay locked until the eject is
+// done. An error names the volume and step that failed.
+func EjectDisk(diskNumber int) error {
+	return EjectDiskWithOptions(diskNumber, EjectOptions{})
+}
+
+// EjectDiskWithOptions is EjectDisk with options.
+func EjectDiskWithOptions(diskNumber int, opts EjectOptions) error {
+	volumes, err := ListVolumesByDiskNumber(diskNumber)
+	if err != nil {
+		return fmt.Errorf("list volumes: %w", err)
+	}
+
+	var locked []windows.Handle
+	defer func() {
+		for _, h := range locked {
+			windows.CloseHandle(h)
+		}
+	}()
+	for _, v := range volumes {
+		name := strings.TrimRight(v, `\`)
+		if root, _ := GetVolumeDriveLetter(v); root != "" {
+			name = strings.TrimSuffix(root, `\`)
+		}
+		h, err := prepareVolumeEject(v, name, opts.Force)
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", name, err)
+		}
+		locked = append(locked, h)
+	}
+
+	path := fmt.Sprintf(`\\.\PhysicalDrive%d`, diskNumber)
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return fmt.Errorf("invalid disk path: %w", err)
+	}
+
+	handle, err := windows.CreateFile(
+		pathPtr,
+		windows.GENERIC_READ|windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to open disk: %w", err)
+	}
+	defer windows.CloseHandle(handle)
+
+	// Undo any removal lock a program took; fixed-media sticks don't take
+	// one and may not support the request
+	prevent := byte(0) // PREVENT_MEDIA_REMOVAL.PreventMediaRemoval
+	var bytesReturned uint32
+	err = windows.DeviceIoControl(
+		handle,
+		IOCTL_STORAGE_MEDIA_REMOVAL,
+		&prevent, 1,
+		nil, 0,
+		&bytesReturned,
+		nil,
+	)
+	if err != nil && !errors.Is(err, windows.ERROR_INVALID_FUNCTION) && !errors.Is(err, windows.ERROR_NOT_SUPPORTED) {
+		return fmt.Errorf("IOCTL_STORAGE_MEDIA_REMOVAL (allow removal) failed: %w", err)
+	}
+
+	err = windows.DeviceIoControl(
+		handle,
+		IOCTL_STORAGE_EJECT_MEDIA,
+		nil, 0,
+		nil, 0,
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("IOCTL_STORAGE_EJECT_MEDIA failed: %w", err)
+	}
+
+	return nil
+}
+
+// prepareVolumeEject flushes, locks and dismounts a volume given by its
+// GUID path, returning the handle that holds the lock. A volume programs
+// hold open fails with a *VolumeInUseError listing them, unless force is
+// set: it is then dismounted first, which invalidates their handles.
+func prepareVolumeEject(volumeGUIDPath, name string, force bool) (windows.Handle, error) {
+	// The volume device is the GUID path without its trailing backslash
+	pathPtr, err := syscall.UTF16PtrFromString(strings.TrimRight(volumeGUIDPath, `\`))
+	if err != nil {
+		return windows.InvalidHandle, fmt.Errorf("invalid volume path: %w", err)
+	}
+	h, err := windows.CreateFile(
+		pathPtr,
+		windows.GENERIC_READ|windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+	if err != nil {
+		return windows.InvalidHandle, fmt.Errorf("open: %w", err)
+	}
+
+	// Write-protected media has nothing to flush
+	if err := windows.FlushFileBuffers(h); err != nil && !errors.Is(err, windows.ERROR_WRITE_PROTECT) {
+		windows.CloseHandle(h)
+		return windows.InvalidHandle, fmt.Errorf("flush write cache: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = LockVolume(h)
+		if err == nil {
+			break
+		}
+		if attempt == ejectLockAttempts {
+			inUse := errors.Is(err, windows.ERROR_ACCESS_DENIED) || errors.Is(err, windows.ERROR_SHARING_VIOLATION)
+			if inUse && force {
+				// Dismounting an unlocked volume cuts off the programs
+				// using it, after which the lock can be taken
+				if err = DismountVolume(h); err == nil {
+					err = LockVolume(h)
+				}
+				if err == nil {
+					break
+				}
+			}
+			windows.CloseHandle(h)
+			if inUse {
+				// Listing the processes is best effort; the error stands
+				// without them
+				processes, _ := VolumeProcesses(volumeGUIDPath)
+				return windows.InvalidHandle, &VolumeInUseError{Volume: name, Processes: processes}
+			}
+			return windows.InvalidHandle, err
+		}
+		time.Sleep(ejectLockDelay)
+	}
+
+	if err := DismountVolume(h); err != nil {
+		windows.CloseHandle(h)
+		return windows.InvalidHandle, err
+	}
+	return h, nil
+}
@@ -0,0 +1,420 @@
+package disk
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// FormatExtOptions configures the native ext2/ext4 format operation.
+// Windows can't create (or mount) Linux file systems, so the superblock,
+// group descriptors, bitmaps, inode tables and root directory are written
+// directly to the disk, like FormatFAT32 does for FAT32.
+type FormatExtOptions struct {
+	DiskHandle      windows.Handle // Already-opened physical disk handle
+	PartitionOffset int64          // Start offset of the partition in bytes
+	PartitionSize   int64          // Size of the partition in bytes
+	VolumeLabel     string         // Volume label (max 16 bytes)
+	Ext4            bool           // ext4 (extents, lazy inode tables) instead of ext2
+}
+
+const (
+	extBlockSize      = 4096
+	extLogBlockSize   = 2 // 1024 << 2
+	extBlocksPerGroup = 8 * extBlockSize
+	extInodeSize      = 256
+	extInodesPerBlock = extBlockSize / extInodeSize
+	extBytesPerInode  = 16384
+	extDescSize       = 32
+	extFirstInode     = 11 // First non-reserved inode: lost+found
+	extRootInode      = 2
+	extMinBlocks      = 2048 // 8 MB
+	extMaxBlocks      = 0xFFFFFFFF
+	extMagic          = 0xEF53
+
+	// Feature flags
+	extCompatDirIndex      = 0x0020
+	extIncompatFiletype    = 0x0002
+	extIncompatExtents     = 0x0040
+	extROCompatSparseSuper = 0x0001
+	extROCompatLargeFile   = 0x0002
+	extROCompatGDTCsum     = 0x0010
+	extROCompatDirNlink    = 0x0020
+	extROCompatExtraIsize  = 0x0040
+
+	// Block group flags (ext4 uninit_bg)
+	extBGInodeUninit = 0x0001
+
+	extInodeFlagExtents = 0x00080000
+	extExtentMagic      = 0xF30A
+)
+
+// extParams holds the computed layout of an ext2/ext4 file system.
+type extParams struct {
+	blocks         uint32
+	groups         uint32
+	inodesPerGroup uint32
+	itableBlocks   uint32 // Inode table blocks per group
+	gdtBlocks      uint32 // Group descriptor table blocks
+	ext4           bool
+	uuid           [16]byte
+	hashSeed       [16]byte
+	label          [16]byte
+	now            uint32
+}
+
+// FormatExt formats a partition as ext2 or ext4. ext4 file systems are
+// created without a journal and with uninitialized inode tables, which the
+// Linux kernel zeroes in the background on first mount, so formatting a
+// large drive takes seconds; ext2 needs its inode tables zeroed up front.
+func FormatExt(opts FormatExtOptions) error {
+	if opts.DiskHandle == windows.InvalidHandle {
+		return fmt.Errorf("invalid disk handle")
+	}
+	if len(opts.VolumeLabel) > 16 {
+		return fmt.Errorf("label %q is longer than ext allows (16 bytes)", opts.VolumeLabel)
+	}
+	blocks := opts.PartitionSize / extBlockSize
+	if blocks < extMinBlocks {
+		return fmt.Errorf("partition too small for ext: %d bytes (minimum %d)", opts.PartitionSize, extMinBlocks*extBlockSize)
+	}
+	if blocks > extMaxBlocks {
+		return fmt.Errorf("partition too large for ext: %d blocks (maximum %d, 16 TB)", blocks, uint32(extMaxBlocks))
+	}
+
+	p := planExt(uint32(blocks), opts.Ext4)
+	copy(p.label[:], opts.VolumeLabel)
+	if _, err := rand.Read(p.uuid[:]); err != nil {
+		return fmt.Errorf("generate UUID: %w", err)
+	}
+	if _, err := rand.Read(p.hashSeed[:]); err != nil {
+		return fmt.Errorf("generate hash seed: %w", err)
+	}
+	// RFC 4122 version 4
+	p.uuid[6] = p.uuid[6]&0x0F | 0x40
+	p.uuid[8] = p.uuid[8]&0x3F | 0x80
+
+	w := &sectorWriter{
+		handle:          opts.DiskHandle,
+		partitionOffset: opts.PartitionOffset,
+		bytesPerSector:  extBlockSize,
+	}
+	return p.write(w)
+}
+
+// planExt lays out the block groups. A last group too small to hold its own
+// metadata and some data is left out, as mke2fs does.
+func planExt(blocks uint32, ext4 bool) *extParams {
+	p := &extParams{ext4: ext4, now: uint32(time.Now().Unix())}
+	for {
+		p.blocks = blocks
+		p.groups = (blocks + extBlocksPerGroup - 1) / extBlocksPerGroup
+
+		inodes := max(uint64(blocks)*extBlockSize/extBytesPerInode, uint64(p.groups)*extInodesPerBlock)
+		perGroup := (inodes + uint64(p.groups) - 1) / uint64(p.groups)
+		perGroup = (perGroup + extInodesPerBlock - 1) / extInodesPerBlock * extInodesPerBlock
+		p.inodesPerGroup = uint32(min(perGroup, 8*extBlockSize))
+		p.itableBlocks = p.inodesPerGroup / extInodesPerBlock
+		p.gdtBlocks = (p.groups*extDescSize + extBlockSize - 1) / extBlockSize
+
+		last := blocks - (p.groups-1)*extBlocksPerGroup
+		if p.groups == 1 || last >= p.overhead(p.groups-1)+50 {
+			return p
+		}
+		blocks -= last
+	}
+}
+
+// hasSuperblock reports whether a group holds a superblock copy: groups 0
+// and 1 and the powers of 3, 5 and 7 (sparse_super).
+func hasSuperblock(group uint32) bool {
+	if group <= 1 {
+		return true
+	}
+	for _, base := range []uint32{3, 5, 7} {
+		n := base
+		for n < group {
+			n *= base
+		}
+		if n == group {
+			return true
+		}
+	}
+	return false
+}
+
+// groupStart returns a group's first block.
+func (p *extParams) groupStart(group uint32) uint32 {
+	return group * extBlocksPerGroup
+}
+
+// groupBlocks returns how many blocks a group has; the last may be short.
+func (p *extParams) groupBlocks(group uint32) uint32 {
+	if group == p.groups-1 {
+		return p.blocks - p.groupStart(group)
+	}
+	return extBlocksPerGroup
+}
+
+// overhead returns the blocks a group's metadata takes: the superblock and
+// descriptor copies, both bitmaps and the inode table.
+func (p *extParams) overhead(group uint32) uint32 {
+	n := 2 + p.itableBlocks
+	if hasSuperblock(group) {
+		n += 1 + p.gdtBlocks
+	}
+	return n
+}
+
+// metadata returns the block bitmap, inode bitmap and inode table blocks of
+// a group.
+func (p *extParams) metadata(group uint32) (blockBitmap, inodeBitmap, inodeTable uint32) {
+	b := p.groupStart(group)
+	if hasSuperblock(group) {
+		b += 1 + p.gdtBlocks
+	}
+	return b, b + 1, b + 2
+}
+
+// write writes the whole file system.
+func (p *extParams) write(w *sectorWriter) error {
+	_, _, itable0 := p.metadata(0)
+	rootBlock := itable0 + p.itableBlocks
+	lostFoundBlock := rootBlock + 1
+
+	// Group descriptors, and the free counts for the superblock
+	gdt := make([]byte, p.gdtBlocks*extBlockSize)
+	var freeBlocks, freeInodes uint32
+	for g := uint32(0); g < p.groups; g++ {
+		bb, ib, it := p.metadata(g)
+		free := p.groupBlocks(g) - p.overhead(g)
+		inodes := p.inodesPerGroup
+		dirs := uint16(0)
+		if g == 0 {
+			free -= 2 // Root and lost+found directories
+			inodes -= extFirstInode
+			dirs = 2
+		}
+		freeBlocks += free
+		freeInodes += inodes
+
+		d := gdt[g*extDescSize : (g+1)*extDescSize]
+		binary.LittleEndian.PutUint32(d[0:], bb)
+		binary.LittleEndian.PutUint32(d[4:], ib)
+		binary.LittleEndian.PutUint32(d[8:], it)
+		binary.LittleEndian.PutUint16(d[12:], uint16(free))
+		binary.LittleEndian.PutUint16(d[14:], uint16(inodes))
+		binary.LittleEndian.PutUint16(d[16:], dirs)
+		if p.ext4 {
+			if g > 0 {
+				binary.LittleEndian.PutUint16(d[18:], extBGInodeUninit)
+			}
+			binary.LittleEndian.PutUint16(d[28:], uint16(inodes)) // bg_itable_unused
+			binary.LittleEndian.PutUint16(d[30:], p.descChecksum(g, d))
+		}
+	}
+
+	// Each group: superblock and descriptor copies, bitmaps, inode table
+	for g := uint32(0); g < p.groups; g++ {
+		bb, ib, it := p.metadata(g)
+		if hasSuperblock(g) {
+			block := make([]byte, extBlockSize)
+			sbOffset := 0
+			if g == 0 {
+				sbOffset = 1024 // Block 0 starts with 1 KB left for a boot sector
+			}
+			p.putSuperblock(block[sbOffset:sbOffset+1024], g, freeBlocks, freeInodes)
+			if err := w.writeSector(p.groupStart(g), block); err != nil {
+				return fmt.Errorf("write superblock of group %d: %w", g, err)
+			}
+			if err := w.writeSectors(p.groupStart(g)+1, gdt); err != nil {
+				return fmt.Errorf("write group descriptors of group %d: %w", g, err)
+			}
+		}
+
+		bitmap := make([]byte, extBlockSize)
+		used := p.overhead(g)
+		if g == 0 {
+			used += 2
+		}
+		setBits(bitmap, 0, used)
+		setBits(bitmap, p.groupBlocks(g), extBlocksPerGroup) // Past the end of the disk
+		if err := w.writeSector(bb, bitmap); err != nil {
+			return fmt.Errorf("write block bitmap of group %d: %w", g, err)
+		}
+
+		bitmap = make([]byte, extBlockSize)
+		if g == 0 {
+			setBits(bitmap, 0, extFirstInode)
+		}
+		setBits(bitmap, p.inodesPerGroup, 8*extBlockSize)
+		if err := w.writeSector(ib, bitmap); err != nil {
+			return fmt.Errorf("write inode bitmap of group %d: %w", g, err)
+		}
+
+		// ext4 leaves unused inode tables to the kernel; group 0's first
+		// block holds the reserved inodes and is written below
+		if !p.ext4 && g > 0 {
+			if err := writeZeroSectors(w, it, p.itableBlocks, extBlockSize); err != nil {
+				return fmt.Errorf("zero inode table of group %d: %w", g, err)
+			}
+		}
+	}
+
+	// Group 0's inode table with the root and lost+found directories
+	itableBytes := p.itableBlocks * extBlockSize
+	if p.ext4 {
+		itableBytes = extBlockSize
+	}
+	itable := make([]byte, itableBytes)
+	p.putDirInode(itable[(extRootInode-1)*extInodeSize:], 040755, 3, rootBlock)
+	p.putDirInode(itable[(extFirstInode-1)*extInodeSize:], 040700, 2, lostFoundBlock)
+	for ino := uint32(1); ino <= extFirstInode; ino++ {
+		if ino != extRootInode && ino != extFirstInode {
+			// Reserved inodes are in use but empty
+			binary.LittleEndian.PutUint16(itable[(ino-1)*extInodeSize+128:], extInodeSize-128) // i_extra_isize
+		}
+	}
+	if err := w.writeSectors(itable0, itable); err != nil {
+		return fmt.Errorf("write inode table: %w", err)
+	}
+
+	root := make([]byte, extBlockSize)
+	off := putDirEntry(root, 0, extRootInode, ".", 12)
+	off = putDirEntry(root, off, extRootInode, "..", 12)
+	putDirEntry(root, off, extFirstInode, "lost+found", extBlockSize-off)
+	if err := w.writeSector(rootBlock, root); err != nil {
+		return fmt.Errorf("write root directory: %w", err)
+	}
+
+	lostFound := make([]byte, extBlockSize)
+	off = putDirEntry(lostFound, 0, extFirstInode, ".", 12)
+	putDirEntry(lostFound, off, extRootInode, "..", extBlockSize-off)
+	if err := w.writeSector(lostFoundBlock, lostFound); err != nil {
+		return fmt.Errorf("write lost+found: %w", err)
+	}
+	return nil
+}
+
+// putSuperblock fills in the superblock copy kept in a group.
+func (p *extParams) putSuperblock(sb []byte, group, freeBlocks, freeInodes uint32) {
+	le := binary.LittleEndian
+	le.PutUint32(sb[0:], p.inodesPerGroup*p.groups) // s_inodes_count
+	le.PutUint32(sb[4:], p.blocks)                  // s_blocks_count
+	le.PutUint32(sb[8:], p.blocks/20)               // s_r_blocks_count: 5% for root
+	le.PutUint32(sb[12:], freeBlocks)
+	le.PutUint32(sb[16:], freeInodes)
+	le.PutUint32(sb[20:], 0) // s_first_data_block
+	le.PutUint32(sb[24:], extLogBlockSize)
+	le.PutUint32(sb[28:], extLogBlockSize) // s_log_cluster_size
+	le.PutUint32(sb[32:], extBlocksPerGroup)
+	le.PutUint32(sb[36:], extBlocksPerGroup) // s_clusters_per_group
+	le.PutUint32(sb[40:], p.inodesPerGroup)
+	le.PutUint32(sb[48:], p.now)    // s_wtime
+	le.PutUint16(sb[54:], 0xFFFF)   // s_max_mnt_count: -1, no forced checks
+	le.PutUint16(sb[56:], extMagic) // s_magic
+	le.PutUint16(sb[58:], 1)        // s_state: clean
+	le.PutUint16(sb[60:], 1)        // s_errors: continue
+	le.PutUint32(sb[64:], p.now)    // s_lastcheck
+	le.PutUint32(sb[76:], 1)        // s_rev_level: dynamic
+	le.PutUint32(sb[84:], extFirstInode)
+	le.PutUint16(sb[88:], extInodeSize)
+	le.PutUint16(sb[90:], uint16(group)) // s_block_group_nr
+
+	compat := uint32(extCompatDirIndex)
+	incompat := uint32(extIncompatFiletype)
+	roCompat := uint32(extROCompatSparseSuper | extROCompatLargeFile)
+	if p.ext4 {
+		incompat |= extIncompatExtents
+		roCompat |= extROCompatGDTCsum | extROCompatDirNlink | extROCompatExtraIsize
+	}
+	le.PutUint32(sb[92:], compat)
+	le.PutUint32(sb[96:], incompat)
+	le.PutUint32(sb[100:], roCompat)
+	copy(sb[104:120], p.uuid[:])
+	copy(sb[120:136], p.label[:])
+
+	copy(sb[236:252], p.hashSeed[:]) // For dir_index
+	sb[252] = 1                      // s_def_hash_version: half MD4
+
+	le.PutUint32(sb[264:], p.now) // s_mkfs_time
+	if p.ext4 {
+		le.PutUint16(sb[348:], extInodeSize-128) // s_min_extra_isize
+		le.PutUint16(sb[350:], extInodeSize-128) // s_want_extra_isize
+	}
+	le.PutUint32(sb[352:], 0x2) // s_flags: unsigned directory hash
+}
+
+// putDirInode writes a directory inode whose contents are one block.
+func (p *extParams) putDirInode(inode []byte, mode uint16, links uint16, block uint32) {
+	le := binary.LittleEndian
+	le.PutUint16(inode[0:], mode)
+	le.PutUint32(inode[4:], extBlockSize) // i_size
+	le.PutUint32(inode[8:], p.now)        // i_atime
+	le.PutUint32(inode[12:], p.now)       // i_ctime
+	le.PutUint32(inode[16:], p.now)       // i_mtime
+	le.PutUint16(inode[26:], links)
+	le.PutUint32(inode[28:], extBlockSize/512) // i_blocks in 512-byte units
+	if p.ext4 {
+		le.PutUint32(inode[32:], extInodeFlagExtents)
+		// Extent tree in i_block: header, then one extent of one block
+		le.PutUint16(inode[40:], extExtentMagic)
+		le.PutUint16(inode[42:], 1) // eh_entries
+		le.PutUint16(inode[44:], 4) // eh_max
+		le.PutUint16(inode[46:], 0) // eh_depth
+		le.PutUint32(inode[52:], 0) // ee_block
+		le.PutUint16(inode[56:], 1) // ee_len
+		le.PutUint16(inode[58:], 0) // ee_start_hi
+		le.PutUint32(inode[60:], block)
+	} else {
+		le.PutUint32(inode[40:], block) // i_block[0]
+	}
+	le.PutUint16(inode[128:], extInodeSize-128) // i_extra_isize
+}
+
+// putDirEntry writes a directory entry at off and returns the offset past
+// its record.
+func putDirEntry(b []byte, off int, inode uint32, name string, recLen int) int {
+	binary.LittleEndian.PutUint32(b[off:], inode)
+	binary.LittleEndian.PutUint16(b[off+4:], uint16(recLen))
+	b[off+6] = byte(len(name))
+	b[off+7] = 2 // EXT2_FT_DIR
+	copy(b[off+8:], name)
+	return off + recLen
+}
+
+// setBits sets bits [from, to) of a bitmap.
+func setBits(bitmap []byte, from, to uint32) {
+	for i := from; i < to; i++ {
+		bitmap[i/8] |= 1 << (i % 8)
+	}
+}
+
+// descChecksum returns a group descriptor's crc16 checksum (uninit_bg):
+// over the UUID, the group number and the descriptor up to the checksum.
+func (p *extParams) descChecksum(group uint32, desc []byte) uint16 {
+	var g [4]byte
+	binary.LittleEndian.PutUint32(g[:], group)
+	crc := crc16(0xFFFF, p.uuid[:])
+	crc = crc16(crc, g[:])
+	return crc16(crc, desc[:30])
+}
+
+// crc16 is the CRC-16 (polynomial 0x8005, reflected) ext4 uses for group
+// descriptor checksums.
+func crc16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc ^= uint16(b)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
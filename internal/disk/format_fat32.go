@@ -23,6 +23,18 @@ type FormatFAT32Options struct {
 	SectorsPerTrack   uint32         // From disk geometry
 	TracksPerCylinder uint32         // From disk geometry (heads)
 	HiddenSectors     uint32         // Partition start in sectors
+	ClusterSize       uint32         // Bytes per cluster, 0 = chosen by partition size
+
+	// DataAlignment, if set, pads the reserved area so the first cluster
+	// starts on a multiple of this many bytes from the start of the disk
+	// (the SD card spec's boundary unit). 0 leaves 32 reserved sectors.
+	DataAlignment int64
+
+	// VolumePath is the partition's volume (\\?\Volume{GUID}\), if Windows
+	// mounted one. It is locked and dismounted while the file system is
+	// written, so Windows mounts it again as FAT32 instead of keeping the
+	// file system it recognized before.
+	VolumePath string
 }
 
 const (
@@ -36,6 +48,7 @@ const (
 	fat32BootSignatureByte = 0x29
 	fat32MinClusters       = 65526
 	fat32MaxClusters       = 0x0FFFFFF5
+	fat32MaxSectors        = 0xFFFFFFFF // BPB_TotSec32
 )
 
 // FormatFAT32 formats a partition as FAT32 by writing the BPB, FSInfo,
@@ -47,13 +60,42 @@ func FormatFAT32(opts FormatFAT32Options) error {
 	}
 
 	bps := opts.BytesPerSector
+	if sectors := opts.PartitionSize / int64(bps); sectors > fat32MaxSectors {
+		return fmt.Errorf("partition too large for FAT32: %d sectors (maximum %d, 2 TB with %d-byte sectors)",
+			sectors, uint32(fat32MaxSectors), bps)
+	}
 	totalSectors := uint32(opts.PartitionSize / int64(bps))
 	sectorsPerCluster := calculateSectorsPerCluster(opts.PartitionSize, bps)
+	if opts.ClusterSize != 0 {
+		sectorsPerCluster = max(opts.ClusterSize/bps, 1)
+	}
 
-	fatSizeSectors := calculateFATSize(totalSectors, fat32ReservedSectors, sectorsPerCluster, bps)
-	dataStartSector := fat32ReservedSectors + (fatSizeSectors * fat32NumFATs)
+	reservedSectors := uint32(fat32ReservedSectors)
+	fatSizeSectors := calculateFATSize(totalSectors, reservedSectors, sectorsPerCluster, bps)
+	dataStartSector := reservedSectors + (fatSizeSectors * fat32NumFATs)
 	totalClusters := (totalSectors - dataStartSector) / sectorsPerCluster
 
+	// The estimate can come out a sector short on large volumes; every
+	// cluster (plus the two reserved entries) needs a FAT entry
+	for uint64(fatSizeSectors)*uint64(bps/4) < uint64(totalClusters)+2 {
+		fatSizeSectors++
+		dataStartSector = reservedSectors + (fatSizeSectors * fat32NumFATs)
+		totalClusters = (totalSectors - dataStartSector) / sectorsPerCluster
+	}
+
+	// Padding the reserved area only shrinks the data area, so the FAT
+	// size stays large enough
+	if opts.DataAlignment > 0 {
+		dataOffset := opts.PartitionOffset + int64(dataStartSector)*int64(bps)
+		pad := uint32((opts.DataAlignment - dataOffset%opts.DataAlignment) % opts.DataAlignment / int64(bps))
+		if reservedSectors+pad > 0xFFFF {
+			return fmt.Errorf("data alignment %d is too large for the reserved area", opts.DataAlignment)
+		}
+		reservedSectors += pad
+		dataStartSector += pad
+		totalClusters = (totalSectors - dataStartSector) / sectorsPerCluster
+	}
+
 	if totalClusters < fat32MinClusters {
 		return fmt.Errorf("partition too small for FAT32: %d clusters (minimum %d)", totalClusters, fat32MinClusters)
 	}
@@ -67,6 +109,7 @@ func FormatFAT32(opts FormatFAT32Options) error {
 	params := &fat32Params{
 		bytesPerSector:    bps,
 		sectorsPerCluster: sectorsPerCluster,
+		reservedSectors:   reservedSectors,
 		totalSectors:      totalSectors,
 		fatSizeSectors:    fatSizeSectors,
 		dataStartSector:   dataStartSector,
@@ -78,6 +121,22 @@ func FormatFAT32(opts FormatFAT32Options) error {
 		hiddenSectors:     opts.HiddenSectors,
 	}
 
+	if opts.VolumePath != "" {
+		volume, err := openVolumeHandle(opts.VolumePath)
+		if err != nil {
+			return err
+		}
+		// Closing the handle unlocks the volume, which Windows then mounts
+		// with the new file system
+		defer windows.CloseHandle(volume)
+		// Dismounting works without the lock too, invalidating any handle
+		// Explorer opened on the new volume
+		_ = LockVolume(volume)
+		if err := DismountVolume(volume); err != nil {
+			return fmt.Errorf("dismount volume: %w", err)
+		}
+	}
+
 	w := &sectorWriter{
 		handle:          opts.DiskHandle,
 		partitionOffset: opts.PartitionOffset,
@@ -111,6 +170,7 @@ func FormatFAT32(opts FormatFAT32Options) error {
 type fat32Params struct {
 	bytesPerSector    uint32
 	sectorsPerCluster uint32
+	reservedSectors   uint32
 	totalSectors      uint32
 	fatSizeSectors    uint32
 	dataStartSector   uint32
@@ -177,6 +237,9 @@ func validateFAT32Options(opts FormatFAT32Options) error {
 	if opts.PartitionOffset < 0 {
 		return fmt.Errorf("partition offset must be non-negative")
 	}
+	if opts.ClusterSize != 0 && (opts.ClusterSize&(opts.ClusterSize-1) != 0 || opts.ClusterSize/opts.BytesPerSector > 128) {
+		return fmt.Errorf("cluster size must be a power of 2 up to 128 sectors, got %d", opts.ClusterSize)
+	}
 	return nil
 }
 
@@ -255,7 +318,7 @@ func buildBPBSector(p *fat32Params) []byte {
 	// BPB fields
 	binary.LittleEndian.PutUint16(bpb[11:13], uint16(p.bytesPerSector))
 	bpb[13] = byte(p.sectorsPerCluster)
-	binary.LittleEndian.PutUint16(bpb[14:16], fat32ReservedSectors)
+	binary.LittleEndian.PutUint16(bpb[14:16], uint16(p.reservedSectors))
 	bpb[16] = fat32NumFATs
 	binary.LittleEndian.PutUint16(bpb[17:19], 0) // RootEntryCount (0 for FAT32)
 	binary.LittleEndian.PutUint16(bpb[19:21], 0) // TotalSectors16 (0 for FAT32)
@@ -350,7 +413,7 @@ func writeFATTables(w *sectorWriter, p *fat32Params) error {
 
 	// Write FAT1 and FAT2
 	for fatIndex := uint32(0); fatIndex < fat32NumFATs; fatIndex++ {
-		fatStartSector := fat32ReservedSectors + (fatIndex * p.fatSizeSectors)
+		fatStartSector := p.reservedSectors + (fatIndex * p.fatSizeSectors)
 
 		// Write the first sector with the initialized entries
 		if err := w.writeSector(fatStartSector, firstSector); err != nil {
@@ -3,6 +3,8 @@ package disk
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -13,13 +15,14 @@ import (
 	"golang.org/x/sys/windows"
 )
 
-// FormatVolumeOptions configures an NTFS or exFAT format operation using the
+// FormatVolumeOptions configures an NTFS, exFAT, ReFS or UDF format operation using the
 // Windows fmifs.dll FormatEx function or, as a fallback, the VDS COM API.
 type FormatVolumeOptions struct {
 	// VolumePath is the volume to format, e.g. `\\?\Volume{GUID}\` or `E:\`.
 	VolumePath string
 
-	// FileSystem is the target filesystem: "NTFS" or "exFAT".
+	// FileSystem is the target filesystem: "NTFS", "exFAT", "ReFS", "UDF",
+	// or "FAT" for FAT12/FAT16 (chosen by Windows from the cluster count).
 	FileSystem string
 
 	// Label is the volume label (max 32 chars for NTFS, 11 for exFAT).
@@ -30,9 +33,13 @@ type FormatVolumeOptions struct {
 
 	// ClusterSize is the allocation unit size in bytes. Use 0 for the default.
 	ClusterSize uint32
+
+	// Progress, if set, is called with the percentage done as the format
+	// advances. It is called from the formatting thread and must not block.
+	Progress func(percent int)
 }
 
-// FormatVolume formats a volume as NTFS or exFAT. It first attempts the
+// FormatVolume formats a volume as NTFS, exFAT, ReFS or UDF. It first attempts the
 // fmifs.dll FormatEx approach (simpler, no COM). If that fails, it falls
 // back to the VDS COM API.
 func FormatVolume(opts FormatVolumeOptions) error {
@@ -73,9 +80,10 @@ func validateFormatOptions(opts FormatVolumeOptions) error {
 	if opts.VolumePath == "" {
 		return fmt.Errorf("volume path is required")
 	}
-	fs := strings.ToUpper(opts.FileSystem)
-	if fs != "NTFS" && fs != "EXFAT" {
-		return fmt.Errorf("unsupported filesystem %q (supported: NTFS, exFAT)", opts.FileSystem)
+	switch strings.ToUpper(opts.FileSystem) {
+	case "NTFS", "EXFAT", "REFS", "UDF", "FAT":
+	default:
+		return fmt.Errorf("unsupported filesystem %q (supported: NTFS, exFAT, ReFS, UDF, FAT)", opts.FileSystem)
 	}
 	return nil
 }
@@ -107,6 +115,7 @@ type formatResult struct {
 	success  bool
 	finished bool
 	lastErr  fmifsCallbackCommand
+	progress func(percent int)
 }
 
 // There can only be one fmifs format operation at a time (the callback is a
@@ -117,6 +126,11 @@ var fmifsFormatMu sync.Mutex
 // returns. Protected by fmifsFormatMu (only one format at a time).
 var globalFormatResult formatResult
 
+// fmifsCallbackPtr is fmifsCallback as a native function pointer. It is
+// created once: Windows callbacks are never freed, and a process can only
+// create a limited number of them.
+var fmifsCallbackPtr = syscall.NewCallback(fmifsCallback)
+
 // fmifsCallback is the callback function passed to FormatEx.
 // It is called from the fmifs.dll thread with progress and status updates.
 //
@@ -127,7 +141,13 @@ var globalFormatResult formatResult
 func fmifsCallback(command fmifsCallbackCommand, _ uint32, actionInfo uintptr) uintptr {
 	switch command {
 	case fmifsProgress:
-		// actionInfo points to a DWORD percentage -- we ignore it for now.
+		// actionInfo points to a DWORD percentage.
+		globalFormatResult.mu.Lock()
+		progress := globalFormatResult.progress
+		globalFormatResult.mu.Unlock()
+		if progress != nil && actionInfo != 0 {
+			progress(int(readUint32Ptr(actionInfo)))
+		}
 	case fmifsDone:
 		globalFormatResult.mu.Lock()
 		globalFormatResult.finished = true
@@ -160,7 +180,7 @@ func formatViaFmifs(opts FormatVolumeOptions) error {
 	defer fmifsFormatMu.Unlock()
 
 	// Reset global state.
-	globalFormatResult = formatResult{}
+	globalFormatResult = formatResult{progress: opts.Progress}
 
 	fmifsDLL := windows.NewLazySystemDLL("fmifs.dll")
 	procFormatEx := fmifsDLL.NewProc("FormatEx")
@@ -180,9 +200,12 @@ func formatViaFmifs(opts FormatVolumeOptions) error {
 	}
 
 	fsName := strings.ToUpper(opts.FileSystem)
-	// The fmifs.dll expects "exFAT" with that exact casing.
-	if fsName == "EXFAT" {
+	// The fmifs.dll expects "exFAT" and "ReFS" with that exact casing.
+	switch fsName {
+	case "EXFAT":
 		fsName = "exFAT"
+	case "REFS":
+		fsName = "ReFS"
 	}
 	fsNamePtr, err := syscall.UTF16PtrFromString(fsName)
 	if err != nil {
@@ -203,8 +226,6 @@ func formatViaFmifs(opts FormatVolumeOptions) error {
 		quickFormat = 1
 	}
 
-	callbackPtr := syscall.NewCallback(fmifsCallback)
-
 	// FormatEx(DriveRoot, MediaType, FileSystemName, Label, QuickFormat,
 	//          ClusterSize, Callback)
 	//
@@ -216,7 +237,7 @@ func formatViaFmifs(opts FormatVolumeOptions) error {
 		uintptr(unsafe.Pointer(labelPtr)),
 		quickFormat,
 		uintptr(opts.ClusterSize),
-		callbackPtr,
+		fmifsCallbackPtr,
 	)
 
 	globalFormatResult.mu.Lock()
@@ -517,13 +538,20 @@ func vdsTryFormatVolume(volUnk *comObject, opts FormatVolumeOptions) error {
 //	    IVdsAsync**         ppAsync
 //	);
 func vdsFormatVolumeMF(volMF *comObject, opts FormatVolumeOptions) error {
-	// VDS_FILE_SYSTEM_TYPE: VDS_FST_NTFS = 2, VDS_FST_EXFAT = 7.
+	// VDS_FILE_SYSTEM_TYPE: VDS_FST_FAT = 2, VDS_FST_NTFS = 4,
+	// VDS_FST_UDF = 6, VDS_FST_EXFAT = 7, VDS_FST_REFS = 9.
 	var fsType uint32
 	switch strings.ToUpper(opts.FileSystem) {
+	case "FAT":
+		fsType = 2 // VDS_FST_FAT
 	case "NTFS":
-		fsType = 2 // VDS_FST_NTFS
+		fsType = 4 // VDS_FST_NTFS
+	case "UDF":
+		fsType = 6 // VDS_FST_UDF
 	case "EXFAT":
 		fsType = 7 // VDS_FST_EXFAT
+	case "REFS":
+		fsType = 9 // VDS_FST_REFS
 	default:
 		return fmt.Errorf("unsupported VDS filesystem: %s", opts.FileSystem)
 	}
@@ -564,6 +592,9 @@ func vdsFormatVolumeMF(volMF *comObject, opts FormatVolumeOptions) error {
 	asyncObj := newCOMObject(asyncPtr)
 	defer asyncObj.release()
 
+	if opts.Progress != nil {
+		vdsPollProgress(asyncObj, opts.Progress)
+	}
 	if err := vdsWaitAsync(asyncObj); err != nil {
 		return err
 	}
@@ -591,6 +622,34 @@ func vdsWaitAsync(async *comObject) error {
 	return nil
 }
 
+// vdsPollProgress reports the percentage of an async operation from
+// IVdsAsync::QueryStatus until it is done or fails; vdsWaitAsync then
+// collects the result.
+func vdsPollProgress(async *comObject, progress func(percent int)) {
+	last := -1
+	for {
+		var hrResult int32
+		var percent uint32
+		hr, _, _ := syscall.SyscallN(
+			async.method(5), // QueryStatus
+			async.uptr(),
+			uintptr(unsafe.Pointer(&hrResult)),
+			uintptr(unsafe.Pointer(&percent)),
+		)
+		if hr != 0 {
+			return
+		}
+		if int(percent) != last {
+			last = int(percent)
+			progress(last)
+		}
+		if percent >= 100 || hrResult != 0 {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // VDS enumeration helper
 // ---------------------------------------------------------------------------
@@ -666,6 +725,80 @@ type rawVolumeDiskExtents struct {
 // found on the given physical disk number. Returns an error if no volume
 // is found.
 func FindVolumeByDiskNumber(diskNumber int) (string, error) {
+	path, err := findVolume(func(volumePath string) bool {
+		return matchesPhysicalDisk(volumePath, diskNumber)
+	})
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("no volume found on PhysicalDrive%d", diskNumber)
+	}
+	return path, nil
+}
+
+// FindVolumeByPartition returns the volume GUID path of the volume whose
+// first extent starts at startingOffset on the given physical disk, i.e. the
+// volume backed by that partition. Returns an error if no volume is found.
+func FindVolumeByPartition(diskNumber int, startingOffset int64) (string, error) {
+	path, err := findVolume(func(volumePath string) bool {
+		extent, ok := volumeFirstExtent(volumePath)
+		return ok && int(extent.DiskNumber) == diskNumber && extent.StartingOffset == startingOffset
+	})
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("no volume found at offset %d on PhysicalDrive%d", startingOffset, diskNumber)
+	}
+	return path, nil
+}
+
+// ListVolumesByDiskNumber returns the volume GUID paths of every volume on
+// the given physical disk, in enumeration order.
+func ListVolumesByDiskNumber(diskNumber int) ([]string, error) {
+	var volumes []string
+	_, err := findVolume(func(volumePath string) bool {
+		if matchesPhysicalDisk(volumePath, diskNumber) {
+			volumes = append(volumes, volumePath)
+		}
+		return false // keep enumerating
+	})
+	return volumes, err
+}
+
+// FirstVolumeByDiskNumber returns the volume GUID path of the first
+// partition (lowest offset) on a physical disk that has a mounted volume,
+// or "" if none does.
+func FirstVolumeByDiskNumber(diskNumber int) (string, error) {
+	var first string
+	var firstOffset int64
+	_, err := findVolume(func(volumePath string) bool {
+		extent, ok := volumeFirstExtent(volumePath)
+		if ok && int(extent.DiskNumber) == diskNumber && (first == "" || extent.StartingOffset < firstOffset) {
+			first, firstOffset = volumePath, extent.StartingOffset
+		}
+		return false // keep enumerating
+	})
+	return first, err
+}
+
+// VolumesByOffset maps the starting offset of each mounted volume on a
+// physical disk to its volume GUID path, to match volumes with partitions.
+func VolumesByOffset(diskNumber int) (map[int64]string, error) {
+	volumes := make(map[int64]string)
+	_, err := findVolume(func(volumePath string) bool {
+		if extent, ok := volumeFirstExtent(volumePath); ok && int(extent.DiskNumber) == diskNumber {
+			volumes[extent.StartingOffset] = volumePath
+		}
+		return false // keep enumerating
+	})
+	return volumes, err
+}
+
+// findVolume enumerates all volumes on the system and returns the first
+// volume GUID path for which match returns true, or "" if none matches.
+func findVolume(match func(volumePath string) bool) (string, error) {
 	buf := make([]uint16, 260)
 
 	hFind, _, err := procFindFirstVolumeW.Call(
@@ -680,7 +813,7 @@ func FindVolumeByDiskNumber(diskNumber int) (string, error) {
 
 	for {
 		volumePath := windows.UTF16ToString(buf)
-		if matchesPhysicalDisk(volumePath, diskNumber) {
+		if match(volumePath) {
 			return volumePath, nil
 		}
 
@@ -698,17 +831,47 @@ func FindVolumeByDiskNumber(diskNumber int) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("no volume found on PhysicalDrive%d", diskNumber)
+	return "", nil
+}
+
+// VolumeDiskNumber returns the physical disk a volume GUID path is on.
+func VolumeDiskNumber(volumeGUIDPath string) (int, error) {
+	extent, ok := volumeFirstExtent(volumeGUIDPath)
+	if !ok {
+		return 0, fmt.Errorf("no disk extents for volume %s", volumeGUIDPath)
+	}
+	return int(extent.DiskNumber), nil
+}
+
+// VolumeForMountPoint returns the volume GUID path mounted on a drive
+// letter ("E:\") or folder.
+func VolumeForMountPoint(mountPoint string) (string, error) {
+	mountPoint = strings.TrimRight(mountPoint, `\`) + `\`
+	mountPtr, err := syscall.UTF16PtrFromString(mountPoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid mount point: %w", err)
+	}
+	buf := make([]uint16, 260)
+	if err := windows.GetVolumeNameForVolumeMountPoint(mountPtr, &buf[0], uint32(len(buf))); err != nil {
+		return "", fmt.Errorf("no volume mounted on %s: %w", mountPoint, err)
+	}
+	return windows.UTF16ToString(buf), nil
 }
 
 // matchesPhysicalDisk checks whether a volume GUID path resides on the given
 // physical disk by querying its disk extents.
 func matchesPhysicalDisk(volumeGUIDPath string, diskNumber int) bool {
+	extent, ok := volumeFirstExtent(volumeGUIDPath)
+	return ok && int(extent.DiskNumber) == diskNumber
+}
+
+// volumeFirstExtent returns the first disk extent of a volume GUID path.
+func volumeFirstExtent(volumeGUIDPath string) (rawDiskExtent, bool) {
 	// Remove the trailing backslash to open the volume device.
 	devPath := strings.TrimRight(volumeGUIDPath, `\`)
 	pathPtr, err := syscall.UTF16PtrFromString(devPath)
 	if err != nil {
-		return false
+		return rawDiskExtent{}, false
 	}
 
 	h, err := windows.CreateFile(
@@ -721,7 +884,7 @@ func matchesPhysicalDisk(volumeGUIDPath string, diskNumber int) bool {
 		0,
 	)
 	if err != nil {
-		return false
+		return rawDiskExtent{}, false
 	}
 	defer windows.CloseHandle(h)
 
@@ -736,23 +899,37 @@ func matchesPhysicalDisk(volumeGUIDPath string, diskNumber int) bool {
 		&bytesReturned,
 		nil,
 	)
-	if err != nil {
-		return false
+	if err != nil || extents.NumberOfDiskExtents == 0 {
+		return rawDiskExtent{}, false
 	}
 
-	return extents.NumberOfDiskExtents > 0 &&
-		int(extents.Extents[0].DiskNumber) == diskNumber
+	return extents.Extents[0], true
 }
 
 // GetVolumeDriveLetter returns the drive letter (e.g. "E:\") assigned to a
 // volume GUID path, or an empty string if none is assigned.
 func GetVolumeDriveLetter(volumeGUIDPath string) (string, error) {
+	paths, err := GetVolumePaths(volumeGUIDPath)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range paths {
+		if len(path) == 3 && path[1] == ':' {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// GetVolumePaths returns every access path of a volume GUID path: its drive
+// letter (e.g. "E:\") and the folders it is mounted on (e.g. "C:\mnt\usb\").
+func GetVolumePaths(volumeGUIDPath string) ([]string, error) {
 	volPtr, err := syscall.UTF16PtrFromString(volumeGUIDPath)
 	if err != nil {
-		return "", fmt.Errorf("invalid volume path: %w", err)
+		return nil, fmt.Errorf("invalid volume path: %w", err)
 	}
 
-	buf := make([]uint16, 260)
+	buf := make([]uint16, 1024)
 	var returnLength uint32
 
 	r, _, callErr := procGetVolumePathNamesForVolumeNameW.Call(
@@ -762,16 +939,17 @@ func GetVolumeDriveLetter(volumeGUIDPath string) (string, error) {
 		uintptr(unsafe.Pointer(&returnLength)),
 	)
 	if r == 0 {
-		return "", fmt.Errorf("GetVolumePathNamesForVolumeNameW: %w", callErr)
+		return nil, fmt.Errorf("GetVolumePathNamesForVolumeNameW: %w", callErr)
 	}
 
-	// The buffer contains a multi-string (double-null terminated). The first
-	// entry is the mount point, typically "E:\".
-	path := windows.UTF16ToString(buf)
-	if len(path) >= 2 && path[1] == ':' {
-		return path, nil
+	// The buffer contains a multi-string (double-null terminated)
+	var paths []string
+	for len(buf) > 0 && buf[0] != 0 {
+		path := windows.UTF16ToString(buf)
+		paths = append(paths, path)
+		buf = buf[len(windows.StringToUTF16(path)):]
 	}
-	return "", nil
+	return paths, nil
 }
 
 // AssignDriveLetter assigns an available drive letter to the given volume
@@ -816,8 +994,89 @@ func AssignDriveLetter(volumeGUIDPath string) (string, error) {
 	return "", fmt.Errorf("no available drive letter found")
 }
 
+// SetDriveLetter assigns the given drive letter ("E", "E:" or "E:\") to a
+// volume GUID path, moving it off the letter it had. It fails if another
+// drive uses the letter. Returns the assigned path (e.g. "E:\").
+func SetDriveLetter(volumeGUIDPath, letter string) (string, error) {
+	letter = strings.ToUpper(strings.TrimRight(letter, `:\`))
+	if len(letter) != 1 || letter[0] < 'A' || letter[0] > 'Z' {
+		return "", fmt.Errorf("invalid drive letter %q", letter)
+	}
+	mountPoint := letter + `:\`
+
+	current, _ := GetVolumeDriveLetter(volumeGUIDPath)
+	if strings.EqualFold(current, mountPoint) {
+		return mountPoint, nil
+	}
+	if drives, err := windows.GetLogicalDrives(); err == nil && drives&(1<<(letter[0]-'A')) != 0 {
+		return "", fmt.Errorf("drive letter %s is already in use", mountPoint[:2])
+	}
+
+	if current != "" {
+		if err := RemoveDriveLetter(current); err != nil {
+			return "", err
+		}
+	}
+	if err := setVolumeMountPoint(mountPoint, volumeGUIDPath); err != nil {
+		if current != "" {
+			_ = setVolumeMountPoint(current, volumeGUIDPath) // Put the old letter back
+		}
+		return "", err
+	}
+	return mountPoint, nil
+}
+
+// MountFolder mounts a volume GUID path on folder, which is created if it
+// doesn't exist and must otherwise be an empty directory on an NTFS volume.
+// Returns the mount point with its trailing backslash.
+func MountFolder(volumeGUIDPath, folder string) (string, error) {
+	if !filepath.IsAbs(folder) || len(folder) <= 3 {
+		return "", fmt.Errorf("mount folder %q must be an absolute path below a drive root", folder)
+	}
+	if err := os.MkdirAll(folder, 0o755); err != nil {
+		return "", fmt.Errorf("create mount folder: %w", err)
+	}
+	if entries, err := os.ReadDir(folder); err != nil {
+		return "", fmt.Errorf("read mount folder: %w", err)
+	} else if len(entries) > 0 {
+		return "", fmt.Errorf("mount folder %s is not empty", folder)
+	}
+
+	mountPoint := strings.TrimRight(folder, `\`) + `\`
+	if err := setVolumeMountPoint(mountPoint, volumeGUIDPath); err != nil {
+		return "", err
+	}
+	return mountPoint, nil
+}
+
+// setVolumeMountPoint mounts a volume GUID path on a drive letter or folder
+// path, both with a trailing backslash.
+func setVolumeMountPoint(mountPoint, volumeGUIDPath string) error {
+	if !strings.HasSuffix(volumeGUIDPath, `\`) {
+		volumeGUIDPath += `\`
+	}
+	mountPtr, err := syscall.UTF16PtrFromString(mountPoint)
+	if err != nil {
+		return fmt.Errorf("invalid mount point: %w", err)
+	}
+	volPtr, err := syscall.UTF16PtrFromString(volumeGUIDPath)
+	if err != nil {
+		return fmt.Errorf("invalid volume path: %w", err)
+	}
+
+	r, _, callErr := procSetVolumeMountPointW.Call(
+		uintptr(unsafe.Pointer(mountPtr)),
+		uintptr(unsafe.Pointer(volPtr)),
+	)
+	if r == 0 {
+		return fmt.Errorf("SetVolumeMountPointW(%s): %w", mountPoint, callErr)
+	}
+	return nil
+}
+
 // RemoveDriveLetter removes the mount point (drive letter) from a path like
-// "E:\". This is useful before ejecting or reformatting.
+// "E:\". This is useful before ejecting or reformatting. It removes a mount
+// folder too, given its path; the volume stays mounted on its other paths.
 func RemoveDriveLetter(mountPoint string) error {
 	if !strings.HasSuffix(mountPoint, `\`) {
 		mountPoint += `\`
@@ -0,0 +1,204 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// volumeNameGUID makes GetFinalPathNameByHandle return a path on the
+// volume's GUID path (\\?\Volume{GUID}\...) instead of its drive letter.
+const volumeNameGUID = 0x1
+
+// hangingAccessMasks are the granted access masks of handles (mostly
+// synchronous named pipes) that GetFinalPathNameByHandle can block on.
+var hangingAccessMasks = map[uint32]bool{
+	0x0012019F: true,
+	0x001A019F: true,
+	0x00120189: true,
+	0x00100000: true,
+}
+
+// systemHandleEntry maps to SYSTEM_HANDLE_TABLE_ENTRY_INFO_EX.
+type systemHandleEntry struct {
+	Object                uintptr
+	UniqueProcessID       uintptr
+	HandleValue           uintptr
+	GrantedAccess         uint32
+	CreatorBackTraceIndex uint16
+	ObjectTypeIndex       uint16
+	HandleAttributes      uint32
+	Reserved              uint32
+}
+
+// VolumeProcess is a process with files or folders open on a volume.
+type VolumeProcess struct {
+	PID   uint32   `json:"pid"`
+	Name  string   `json:"name"`
+	Files []string `json:"files"` // Paths on the volume, e.g. `\docs\report.docx`
+}
+
+// VolumeInUseError is returned (wrapped) by EjectDisk when a volume can't
+// be locked because programs hold it open. Processes lists them, if they
+// could be found.
+type VolumeInUseError struct {
+	Volume    string // Drive letter, or GUID path if the volume has none
+	Processes []VolumeProcess
+}
+
+func (e *VolumeInUseError) Error() string {
+	if len(e.Processes) == 0 {
+		return ErrVolumeInUse.Error() + ": a program has a file, folder or window open on it"
+	}
+	names := make([]string, len(e.Processes))
+	for i, p := range e.Processes {
+		names[i] = fmt.Sprintf("%s (PID %d)", p.Name, p.PID)
+	}
+	return ErrVolumeInUse.Error() + " by " + strings.Join(names, ", ")
+}
+
+func (e *VolumeInUseError) Unwrap() error { return ErrVolumeInUse }
+
+// VolumeProcesses lists the processes with files or folders (including
+// their working directory and Explorer windows) open on a volume given by
+// its GUID path (e.g. `\\?\Volume{GUID}\`). It walks the system handle
+// table, so it needs administrator privileges to see other users'
+// processes; processes it can't inspect are left out.
+func VolumeProcesses(volumeGUIDPath string) ([]VolumeProcess, error) {
+	// The object type index of files differs between Windows versions, so
+	// it is read from a file this process holds open while the handle
+	// table is taken
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	marker, err := os.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := systemHandles()
+	fileType, ok := fileObjectType(entries, windows.Handle(marker.Fd()))
+	marker.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("file handle type not found in the system handle table")
+	}
+
+	prefix := strings.TrimRight(volumeGUIDPath, `\`) + `\`
+	self := windows.CurrentProcess()
+	selfPID := uint32(os.Getpid())
+	processes := make(map[uint32]windows.Handle)
+	defer func() {
+		for _, h := range processes {
+			if h != 0 {
+				windows.CloseHandle(h)
+			}
+		}
+	}()
+
+	byPID := make(map[uint32]*VolumeProcess)
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	for _, e := range entries {
+		pid := uint32(e.UniqueProcessID)
+		if e.ObjectTypeIndex != fileType || pid == selfPID || hangingAccessMasks[e.GrantedAccess] {
+			continue
+		}
+		proc, seen := processes[pid]
+		if !seen {
+			proc, _ = windows.OpenProcess(windows.PROCESS_DUP_HANDLE, false, pid)
+			processes[pid] = proc
+		}
+		if proc == 0 {
+			continue
+		}
+
+		var dup windows.Handle
+		if err := windows.DuplicateHandle(proc, windows.Handle(e.HandleValue), self, &dup, 0, false, windows.DUPLICATE_SAME_ACCESS); err != nil {
+			continue
+		}
+		path := ""
+		if t, _ := windows.GetFileType(dup); t == windows.FILE_TYPE_DISK {
+			if n, err := windows.GetFinalPathNameByHandle(dup, &buf[0], uint32(len(buf)), volumeNameGUID); err == nil && int(n) < len(buf) {
+				path = windows.UTF16ToString(buf[:n])
+			}
+		}
+		windows.CloseHandle(dup)
+		if !strings.HasPrefix(strings.ToLower(path+`\`), strings.ToLower(prefix)) {
+			continue
+		}
+
+		p := byPID[pid]
+		if p == nil {
+			p = &VolumeProcess{PID: pid, Name: processName(pid)}
+			byPID[pid] = p
+		}
+		p.Files = append(p.Files, `\`+strings.TrimPrefix(path[min(len(prefix), len(path)):], `\`))
+	}
+
+	result := make([]VolumeProcess, 0, len(byPID))
+	for _, p := range byPID {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PID < result[j].PID })
+	return result, nil
+}
+
+// systemHandles returns every open handle in the system.
+func systemHandles() ([]systemHandleEntry, error) {
+	size := uint32(1 << 20)
+	for {
+		buf := make([]byte, size)
+		var needed uint32
+		err := windows.NtQuerySystemInformation(windows.SystemExtendedHandleInformation, unsafe.Pointer(&buf[0]), size, &needed)
+		if errors.Is(err, windows.STATUS_INFO_LENGTH_MISMATCH) {
+			// Handles come and go, so leave some room
+			size = max(size*2, needed+needed/4)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("NtQuerySystemInformation: %w", err)
+		}
+
+		// SYSTEM_HANDLE_INFORMATION_EX: NumberOfHandles, Reserved, Handles[]
+		count := *(*uintptr)(unsafe.Pointer(&buf[0]))
+		header := 2 * unsafe.Sizeof(uintptr(0))
+		entries := unsafe.Slice((*systemHandleEntry)(unsafe.Pointer(&buf[header])), count)
+		return append([]systemHandleEntry(nil), entries...), nil
+	}
+}
+
+// fileObjectType returns the object type index of files: that of file, a
+// file handle of this process.
+func fileObjectType(entries []systemHandleEntry, file windows.Handle) (uint16, bool) {
+	selfPID := uintptr(os.Getpid())
+	for _, e := range entries {
+		if e.UniqueProcessID == selfPID && windows.Handle(e.HandleValue) == file {
+			return e.ObjectTypeIndex, true
+		}
+	}
+	return 0, false
+}
+
+// processName returns the executable name of a process, or "PID n" if it
+// can't be read.
+func processName(pid uint32) string {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return fmt.Sprintf("PID %d", pid)
+	}
+	defer windows.CloseHandle(h)
+	buf := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size); err != nil {
+		return fmt.Sprintf("PID %d", pid)
+	}
+	return filepath.Base(windows.UTF16ToString(buf[:size]))
+}
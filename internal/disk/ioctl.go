@@ -20,7 +20,8 @@ const (
 	IOCTL_DISK_UPDATE_PROPERTIES     = 0x00074004
 	IOCTL_DISK_GROW_PARTITION        = 0x0007C054
 
-	IOCTL_STORAGE_EJECT_MEDIA = 0x002D4808
+	IOCTL_STORAGE_EJECT_MEDIA   = 0x002D4808
+	IOCTL_STORAGE_MEDIA_REMOVAL = 0x002D4804
 
 	FSCTL_LOCK_VOLUME            = 0x00090018
 	FSCTL_DISMOUNT_VOLUME        = 0x00090020
@@ -58,6 +59,13 @@ type rawCreateDisk struct {
 	Signature      uint32
 }
 
+// rawCreateDiskGPT maps to CREATE_DISK with its CREATE_DISK_GPT member.
+type rawCreateDiskGPT struct {
+	PartitionStyle    uint32
+	DiskID            windows.GUID
+	MaxPartitionCount uint32
+}
+
 // rawDiskGeometry maps to DISK_GEOMETRY.
 type rawDiskGeometry struct {
 	Cylinders         int64
@@ -267,6 +275,29 @@ func GetDriveLayout(handle windows.Handle) (*DriveLayout, error) {
 	}, nil
 }
 
+// FindPartition opens the given physical disk and returns the partition with
+// the given (1-based) partition number.
+func FindPartition(diskNumber, partitionNumber int) (PartitionInfo, error) {
+	handle, err := OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return PartitionInfo{}, err
+	}
+	defer windows.CloseHandle(handle)
+
+	layout, err := GetDriveLayout(handle)
+	if err != nil {
+		return PartitionInfo{}, err
+	}
+
+	for _, p := range layout.Partitions {
+		if int(p.PartitionNumber) == partitionNumber {
+			return p, nil
+		}
+	}
+	return PartitionInfo{}, fmt.Errorf("partition %d not found on PhysicalDrive%d (%d partitions)",
+		partitionNumber, diskNumber, len(layout.Partitions))
+}
+
 // ---------------------------------------------------------------------------
 // Disk initialization
 // ---------------------------------------------------------------------------
@@ -295,6 +326,32 @@ func CreateMBRDisk(handle windows.Handle, signature uint32) error {
 	return nil
 }
 
+// CreateGPTDisk initializes the disk with an empty GPT (protective MBR plus
+// both partition tables) identified by diskID, with room for the usual 128
+// partitions.
+func CreateGPTDisk(handle windows.Handle, diskID windows.GUID) error {
+	create := rawCreateDiskGPT{
+		PartitionStyle:    PARTITION_STYLE_GPT,
+		DiskID:            diskID,
+		MaxPartitionCount: 128,
+	}
+	var bytesReturned uint32
+
+	err := windows.DeviceIoControl(
+		handle,
+		IOCTL_DISK_CREATE_DISK,
+		(*byte)(unsafe.Pointer(&create)),
+		uint32(unsafe.Sizeof(create)),
+		nil, 0,
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("IOCTL_DISK_CREATE_DISK: %w", err)
+	}
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // Partition layout (write)
 // ---------------------------------------------------------------------------
@@ -370,6 +427,18 @@ func UpdateDiskProperties(handle windows.Handle) error {
 	return nil
 }
 
+// RescanDisk makes Windows re-read a disk's partition table and properties,
+// picking up changes made by other tools; volumes on new partitions are then
+// mounted. Requires administrator privileges.
+func RescanDisk(diskNumber int) error {
+	handle, err := OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+	return UpdateDiskProperties(handle)
+}
+
 // ---------------------------------------------------------------------------
 // Partition growth
 // ---------------------------------------------------------------------------
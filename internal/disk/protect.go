@@ -0,0 +1,144 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Disk attribute IOCTLs, the native equivalent of Set-Disk -IsReadOnly.
+const (
+	IOCTL_DISK_IS_WRITABLE         = 0x00070024
+	IOCTL_DISK_GET_DISK_ATTRIBUTES = 0x000700F0
+	IOCTL_DISK_SET_DISK_ATTRIBUTES = 0x0007C0F4
+)
+
+// diskAttributeReadOnly is DISK_ATTRIBUTE_READ_ONLY.
+const diskAttributeReadOnly = 0x2
+
+// rawGetDiskAttributes maps to GET_DISK_ATTRIBUTES.
+type rawGetDiskAttributes struct {
+	Version    uint32
+	Reserved1  uint32
+	Attributes uint64
+}
+
+// rawSetDiskAttributes maps to SET_DISK_ATTRIBUTES.
+type rawSetDiskAttributes struct {
+	Version        uint32
+	Persist        byte
+	Reserved1      [3]byte
+	Attributes     uint64
+	AttributesMask uint64
+	Reserved2      [4]uint32
+}
+
+// WriteProtectStatus describes what stops writes to a disk.
+type WriteProtectStatus struct {
+	ReadOnly       bool // Windows' read-only disk attribute (Set-Disk -IsReadOnly)
+	WriteProtected bool // The media reports write protection, e.g. a lock switch
+}
+
+// openDiskForQuery opens \\.\PhysicalDriveN without read or write access,
+// which is enough for attribute queries and doesn't need administrator
+// privileges.
+func openDiskForQuery(diskNumber int) (windows.Handle, error) {
+	path := fmt.Sprintf(`\\.\PhysicalDrive%d`, diskNumber)
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return windows.InvalidHandle, fmt.Errorf("invalid disk path: %w", err)
+	}
+	handle, err := windows.CreateFile(
+		pathPtr,
+		0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+	if err != nil {
+		return windows.InvalidHandle, fmt.Errorf("open PhysicalDrive%d: %w", diskNumber, err)
+	}
+	return handle, nil
+}
+
+// GetWriteProtect reports the disk's read-only attribute and whether the
+// media itself refuses writes.
+func GetWriteProtect(diskNumber int) (*WriteProtectStatus, error) {
+	handle, err := openDiskForQuery(diskNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(handle)
+
+	var attrs rawGetDiskAttributes
+	var bytesReturned uint32
+	err = windows.DeviceIoControl(
+		handle,
+		IOCTL_DISK_GET_DISK_ATTRIBUTES,
+		nil, 0,
+		(*byte)(unsafe.Pointer(&attrs)),
+		uint32(unsafe.Sizeof(attrs)),
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("IOCTL_DISK_GET_DISK_ATTRIBUTES: %w", err)
+	}
+	status := &WriteProtectStatus{ReadOnly: attrs.Attributes&diskAttributeReadOnly != 0}
+
+	// Fails with ERROR_WRITE_PROTECT when the media is write-protected
+	err = windows.DeviceIoControl(
+		handle,
+		IOCTL_DISK_IS_WRITABLE,
+		nil, 0, nil, 0,
+		&bytesReturned,
+		nil,
+	)
+	if errors.Is(err, windows.ERROR_WRITE_PROTECT) {
+		status.WriteProtected = true
+	}
+	return status, nil
+}
+
+// SetReadOnly sets or clears the disk's read-only attribute, persisting it
+// across reboots like Set-Disk -IsReadOnly. It can't override a write
+// protection switch on the media.
+func SetReadOnly(diskNumber int, readOnly bool) error {
+	handle, err := OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+
+	attrs := rawSetDiskAttributes{
+		Persist:        1,
+		AttributesMask: diskAttributeReadOnly,
+	}
+	attrs.Version = uint32(unsafe.Sizeof(attrs))
+	if readOnly {
+		attrs.Attributes = diskAttributeReadOnly
+	}
+	var bytesReturned uint32
+
+	err = windows.DeviceIoControl(
+		handle,
+		IOCTL_DISK_SET_DISK_ATTRIBUTES,
+		(*byte)(unsafe.Pointer(&attrs)),
+		uint32(unsafe.Sizeof(attrs)),
+		nil, 0,
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("IOCTL_DISK_SET_DISK_ATTRIBUTES: %w", err)
+	}
+
+	// Let the volumes pick up the new state
+	UpdateDiskProperties(handle)
+	return nil
+}
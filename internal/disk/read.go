@@ -0,0 +1,80 @@
+package disk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// readChunk is how much ReadRegion reads from the disk at a time.
+const readChunk = 1 << 20
+
+// ReadRegion copies length bytes of a disk, starting at offset, to w. The
+// disk is opened read-only, so its volumes stay mounted. Raw disk reads must
+// cover whole sectors, so the region is widened to sector boundaries and
+// trimmed back as it is written: offset and length can be any byte range
+// within the disk. Requires administrator privileges.
+func ReadRegion(ctx context.Context, diskNumber int, offset, length int64, w io.Writer) error {
+	pathPtr, err := syscall.UTF16PtrFromString(fmt.Sprintf(`\\.\PhysicalDrive%d`, diskNumber))
+	if err != nil {
+		return fmt.Errorf("invalid disk path: %w", err)
+	}
+	handle, err := windows.CreateFile(
+		pathPtr,
+		windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+	if err != nil {
+		return fmt.Errorf("open PhysicalDrive%d: %w", diskNumber, err)
+	}
+	defer windows.CloseHandle(handle)
+
+	geo, err := GetDiskGeometry(handle)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || length <= 0 {
+		return fmt.Errorf("invalid region: offset %d, length %d", offset, length)
+	}
+	if offset+length > geo.DiskSize {
+		return fmt.Errorf("region %d-%d ends past the end of the disk (%d bytes)", offset, offset+length, geo.DiskSize)
+	}
+	sector := int64(geo.BytesPerSector)
+	if sector <= 0 {
+		sector = 512
+	}
+
+	end := offset + length
+	alignedEnd := (end + sector - 1) / sector * sector
+	buf := make([]byte, readChunk)
+	for pos := offset / sector * sector; pos < alignedEnd; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(int64(len(buf)), alignedEnd-pos)
+		if _, err := windows.Seek(handle, pos, io.SeekStart); err != nil {
+			return fmt.Errorf("seek to %d: %w", pos, err)
+		}
+		var read uint32
+		if err := windows.ReadFile(handle, buf[:n], &read, nil); err != nil {
+			return fmt.Errorf("read at %d: %w", pos, err)
+		}
+		if int64(read) != n {
+			return fmt.Errorf("short read at %d: %d of %d bytes", pos, read, n)
+		}
+
+		from, to := max(offset, pos)-pos, min(end, pos+n)-pos
+		if _, err := w.Write(buf[from:to]); err != nil {
+			return err
+		}
+		pos += n
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package disk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// IOCTL_SCSI_PASS_THROUGH sends a raw CDB to the device, used here for the
+// SAT ATA PASS-THROUGH command that USB-to-SATA bridges translate.
+const IOCTL_SCSI_PASS_THROUGH = 0x0004D004
+
+const (
+	storageDeviceTemperatureProperty = 52 // STORAGE_PROPERTY_ID StorageDeviceTemperatureProperty
+	scsiIoctlDataIn                  = 1  // SCSI_IOCTL_DATA_IN
+	smartDataSize                    = 512
+	smartAttributeCount              = 30
+)
+
+// rawScsiPassThrough maps to SCSI_PASS_THROUGH. DataBufferOffset is a
+// ULONG_PTR, so the layout differs between 32- and 64-bit builds the same
+// way it does in C.
+type rawScsiPassThrough struct {
+	Length             uint16
+	ScsiStatus         uint8
+	PathId             uint8
+	TargetId           uint8
+	Lun                uint8
+	CdbLength          uint8
+	SenseInfoLength    uint8
+	DataIn             uint8
+	DataTransferLength uint32
+	TimeOutValue       uint32
+	DataBufferOffset   uintptr
+	SenseInfoOffset    uint32
+	Cdb                [16]byte
+}
+
+// rawScsiPassThroughWithBuffers is the IOCTL buffer: the request followed
+// by the sense and data buffers it points into.
+type rawScsiPassThroughWithBuffers struct {
+	Spt   rawScsiPassThrough
+	Sense [32]byte
+	Data  [smartDataSize]byte
+}
+
+// rawTemperatureInfo maps to STORAGE_TEMPERATURE_INFO.
+type rawTemperatureInfo struct {
+	Index                   uint16
+	Temperature             int16
+	OverThreshold           int16
+	UnderThreshold          int16
+	OverThresholdChangable  byte
+	UnderThresholdChangable byte
+	EventGenerated          byte
+	Reserved0               byte
+	Reserved1               uint32
+}
+
+// rawTemperatureDescriptor maps to STORAGE_TEMPERATURE_DATA_DESCRIPTOR with
+// room for a single sensor.
+type rawTemperatureDescriptor struct {
+	Version             uint32
+	Size                uint32
+	CriticalTemperature int16
+	WarningTemperature  int16
+	InfoCount           uint16
+	Reserved0           [2]byte
+	Reserved1           [2]uint32
+	TemperatureInfo     [1]rawTemperatureInfo
+}
+
+// SmartAttribute is one entry of the ATA SMART attribute table.
+type SmartAttribute struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Current int    `json:"current"` // Normalized value, higher is better
+	Worst   int    `json:"worst"`
+	Raw     int64  `json:"raw"`
+}
+
+// SmartInfo is the health data a drive exposes. Fields the drive doesn't
+// report are nil.
+type SmartInfo struct {
+	Source             string           `json:"source"`                // "ata" (SMART through the USB bridge) or "storage" (temperature only)
+	Temperature        *int             `json:"temperature,omitempty"` // Degrees Celsius
+	PowerOnHours       *int64           `json:"powerOnHours,omitempty"`
+	PowerCycles        *int64           `json:"powerCycles,omitempty"`
+	WearPercent        *int             `json:"wearPercent,omitempty"` // Share of rated write endurance used
+	ReallocatedSectors *int64           `json:"reallocatedSectors,omitempty"`
+	Attributes         []SmartAttribute `json:"attributes,omitempty"`
+}
+
+// smartAttributeNames names the attributes wusbkit interprets plus a few
+// other common ones.
+var smartAttributeNames = map[int]string{
+	1:   "Raw Read Error Rate",
+	5:   "Reallocated Sectors Count",
+	9:   "Power-On Hours",
+	12:  "Power Cycle Count",
+	169: "Remaining Life",
+	173: "Wear Leveling Count",
+	177: "Wear Leveling Count",
+	187: "Reported Uncorrectable Errors",
+	190: "Airflow Temperature",
+	194: "Temperature",
+	196: "Reallocation Event Count",
+	197: "Current Pending Sectors",
+	198: "Offline Uncorrectable",
+	199: "UDMA CRC Error Count",
+	231: "SSD Life Left",
+	233: "Media Wearout Indicator",
+	241: "Total LBAs Written",
+	242: "Total LBAs Read",
+}
+
+// wearAttributes are the attributes whose normalized value counts down from
+// 100 as the flash wears, in order of preference.
+var wearAttributes = []int{231, 233, 169, 177}
+
+// QuerySmart reads health data from a disk. SMART attributes are read with
+// an ATA PASS-THROUGH command, which USB-to-SATA bridges and some sticks
+// forward to the drive; otherwise the storage stack's temperature property
+// is tried. Returns nil (not an error) if the drive exposes neither, which
+// is the case for most USB sticks.
+func QuerySmart(diskNumber int) (*SmartInfo, error) {
+	handle, err := OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(handle)
+
+	if info := readATASmart(handle); info != nil {
+		return info, nil
+	}
+
+	if temp, ok := readTemperature(handle); ok {
+		return &SmartInfo{Source: "storage", Temperature: &temp}, nil
+	}
+	return nil, nil
+}
+
+// readATASmart issues SMART READ DATA through SAT ATA PASS-THROUGH (16)
+// and parses the attribute table, or returns nil if the bridge rejects it.
+func readATASmart(handle windows.Handle) *SmartInfo {
+	var req rawScsiPassThroughWithBuffers
+	req.Spt = rawScsiPassThrough{
+		Length:             uint16(unsafe.Sizeof(req.Spt)),
+		CdbLength:          16,
+		SenseInfoLength:    uint8(len(req.Sense)),
+		DataIn:             scsiIoctlDataIn,
+		DataTransferLength: smartDataSize,
+		TimeOutValue:       5,
+		DataBufferOffset:   unsafe.Offsetof(req.Data),
+		SenseInfoOffset:    uint32(unsafe.Offsetof(req.Sense)),
+	}
+	req.Spt.Cdb = [16]byte{
+		0:  0x85,   // ATA PASS-THROUGH (16)
+		1:  4 << 1, // Protocol: PIO data-in
+		2:  0x0E,   // T_DIR from device, length in sectors, from the sector count field
+		4:  0xD0,   // Features: SMART READ DATA
+		6:  1,      // Sector count
+		10: 0x4F,   // LBA mid (SMART signature)
+		12: 0xC2,   // LBA high (SMART signature)
+		14: 0xB0,   // Command: SMART
+	}
+	var bytesReturned uint32
+
+	err := windows.DeviceIoControl(
+		handle,
+		IOCTL_SCSI_PASS_THROUGH,
+		(*byte)(unsafe.Pointer(&req)),
+		uint32(unsafe.Sizeof(req)),
+		(*byte)(unsafe.Pointer(&req)),
+		uint32(unsafe.Sizeof(req)),
+		&bytesReturned,
+		nil,
+	)
+	if err != nil || req.Spt.ScsiStatus != 0 {
+		return nil
+	}
+	return parseSmartData(req.Data[:])
+}
+
+// parseSmartData decodes the SMART READ DATA attribute table. Returns nil
+// if the table is empty, as bridges that ignore the command leave it.
+func parseSmartData(data []byte) *SmartInfo {
+	info := &SmartInfo{Source: "ata"}
+	attrs := make(map[int]SmartAttribute)
+	for i := range smartAttributeCount {
+		entry := data[2+i*12 : 2+(i+1)*12]
+		id := int(entry[0])
+		if id == 0 {
+			continue
+		}
+		var raw [8]byte
+		copy(raw[:], entry[5:11])
+		attr := SmartAttribute{
+			ID:      id,
+			Name:    smartAttributeNames[id],
+			Current: int(entry[3]),
+			Worst:   int(entry[4]),
+			Raw:     int64(binary.LittleEndian.Uint64(raw[:])),
+		}
+		info.Attributes = append(info.Attributes, attr)
+		attrs[id] = attr
+	}
+	if len(info.Attributes) == 0 {
+		return nil
+	}
+
+	if a, ok := attrs[9]; ok {
+		// Some drives keep minutes or milliseconds in the upper bytes
+		hours := a.Raw & 0xFFFFFFFF
+		info.PowerOnHours = &hours
+	}
+	if a, ok := attrs[12]; ok {
+		info.PowerCycles = &a.Raw
+	}
+	if a, ok := attrs[5]; ok {
+		info.ReallocatedSectors = &a.Raw
+	}
+	for _, id := range []int{194, 190} {
+		if a, ok := attrs[id]; ok {
+			// The low byte is the current temperature; the others hold min/max
+			temp := int(a.Raw & 0xFF)
+			info.Temperature = &temp
+			break
+		}
+	}
+	for _, id := range wearAttributes {
+		if a, ok := attrs[id]; ok {
+			wear := 100 - min(a.Current, 100)
+			info.WearPercent = &wear
+			break
+		}
+	}
+	return info
+}
+
+// readTemperature queries StorageDeviceTemperatureProperty, which Windows
+// fills for drives whose driver reports a temperature sensor.
+func readTemperature(handle windows.Handle) (int, bool) {
+	query := rawStoragePropertyQuery{
+		PropertyId: storageDeviceTemperatureProperty,
+		QueryType:  propertyStandardQuery,
+	}
+	var desc rawTemperatureDescriptor
+	var bytesReturned uint32
+
+	err := windows.DeviceIoControl(
+		handle,
+		IOCTL_STORAGE_QUERY_PROPERTY,
+		(*byte)(unsafe.Pointer(&query)),
+		uint32(unsafe.Sizeof(query)),
+		(*byte)(unsafe.Pointer(&desc)),
+		uint32(unsafe.Sizeof(desc)),
+		&bytesReturned,
+		nil,
+	)
+	if err != nil || desc.InfoCount == 0 {
+		return 0, false
+	}
+	return int(desc.TemperatureInfo[0].Temperature), true
+}
+
+// String summarizes the headline health values, e.g. "38°C, 1234 h, 12% worn".
+func (s *SmartInfo) String() string {
+	var parts []string
+	if s.Temperature != nil {
+		parts = append(parts, fmt.Sprintf("%d°C", *s.Temperature))
+	}
+	if s.PowerOnHours != nil {
+		parts = append(parts, fmt.Sprintf("%d h", *s.PowerOnHours))
+	}
+	if s.WearPercent != nil {
+		parts = append(parts, fmt.Sprintf("%d%% worn", *s.WearPercent))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
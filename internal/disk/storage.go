@@ -0,0 +1,170 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Storage IOCTLs that work on handles opened without read or write access.
+const (
+	IOCTL_STORAGE_GET_DEVICE_NUMBER = 0x002D1080 // Disk number behind a device interface path
+	IOCTL_STORAGE_CHECK_VERIFY2     = 0x002D0800 // Whether the drive has media
+)
+
+// storageDeviceProperty is STORAGE_PROPERTY_ID StorageDeviceProperty.
+const storageDeviceProperty = 0
+
+// storageDescriptorBufferSize leaves room for the strings that follow
+// STORAGE_DEVICE_DESCRIPTOR.
+const storageDescriptorBufferSize = 1024
+
+// rawStorageDeviceNumber maps to STORAGE_DEVICE_NUMBER.
+type rawStorageDeviceNumber struct {
+	DeviceType      uint32
+	DeviceNumber    uint32
+	PartitionNumber uint32
+}
+
+// rawStorageDeviceDescriptor maps to the fixed part of
+// STORAGE_DEVICE_DESCRIPTOR. The offsets point to NUL-terminated strings
+// in the same buffer, or are 0 when the device doesn't report them.
+type rawStorageDeviceDescriptor struct {
+	Version               uint32
+	Size                  uint32
+	DeviceType            byte
+	DeviceTypeModifier    byte
+	RemovableMedia        byte
+	CommandQueueing       byte
+	VendorIdOffset        uint32
+	ProductIdOffset       uint32
+	ProductRevisionOffset uint32
+	SerialNumberOffset    uint32
+	BusType               uint32
+	RawPropertiesLength   uint32
+}
+
+// StorageDescriptor is what a storage device reports about itself.
+type StorageDescriptor struct {
+	Vendor       string
+	Product      string
+	Revision     string
+	SerialNumber string
+	BusType      int  // STORAGE_BUS_TYPE, e.g. 7 for USB
+	Removable    bool // The media can be removed, as on sticks and card readers
+}
+
+// GetStorageDescriptor opens a physical disk by number and reads its
+// storage device descriptor. It doesn't need administrator privileges.
+func GetStorageDescriptor(diskNumber int) (*StorageDescriptor, error) {
+	handle, err := openDiskForQuery(diskNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(handle)
+	return QueryStorageDescriptor(handle)
+}
+
+// HasMedia reports whether a disk has media in it. Card readers and other
+// removable media drives stay attached without any.
+func HasMedia(diskNumber int) (bool, error) {
+	handle, err := openDiskForQuery(diskNumber)
+	if err != nil {
+		return false, err
+	}
+	defer windows.CloseHandle(handle)
+
+	var bytesReturned uint32
+	err = windows.DeviceIoControl(
+		handle,
+		IOCTL_STORAGE_CHECK_VERIFY2,
+		nil, 0,
+		nil, 0,
+		&bytesReturned,
+		nil,
+	)
+	switch err {
+	case nil:
+		return true, nil
+	case windows.ERROR_NOT_READY, windows.ERROR_NO_MEDIA_IN_DRIVE:
+		return false, nil
+	}
+	return false, fmt.Errorf("IOCTL_STORAGE_CHECK_VERIFY2: %w", err)
+}
+
+// GetDeviceNumber returns the disk number of an open disk device, such as
+// one opened by its device interface path.
+func GetDeviceNumber(handle windows.Handle) (int, error) {
+	var number rawStorageDeviceNumber
+	var bytesReturned uint32
+
+	err := windows.DeviceIoControl(
+		handle,
+		IOCTL_STORAGE_GET_DEVICE_NUMBER,
+		nil, 0,
+		(*byte)(unsafe.Pointer(&number)),
+		uint32(unsafe.Sizeof(number)),
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("IOCTL_STORAGE_GET_DEVICE_NUMBER: %w", err)
+	}
+	return int(number.DeviceNumber), nil
+}
+
+// QueryStorageDescriptor reads the device's STORAGE_DEVICE_DESCRIPTOR: its
+// identity strings, bus type and whether its media is removable. The handle
+// needs no read or write access.
+func QueryStorageDescriptor(handle windows.Handle) (*StorageDescriptor, error) {
+	query := rawStoragePropertyQuery{
+		PropertyId: storageDeviceProperty,
+		QueryType:  propertyStandardQuery,
+	}
+	// uint32 elements keep the descriptor aligned
+	buf := make([]uint32, storageDescriptorBufferSize/4)
+	var bytesReturned uint32
+
+	err := windows.DeviceIoControl(
+		handle,
+		IOCTL_STORAGE_QUERY_PROPERTY,
+		(*byte)(unsafe.Pointer(&query)),
+		uint32(unsafe.Sizeof(query)),
+		(*byte)(unsafe.Pointer(&buf[0])),
+		storageDescriptorBufferSize,
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("IOCTL_STORAGE_QUERY_PROPERTY: %w", err)
+	}
+
+	raw := (*rawStorageDeviceDescriptor)(unsafe.Pointer(&buf[0]))
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), min(int(bytesReturned), storageDescriptorBufferSize))
+	return &StorageDescriptor{
+		Vendor:       descriptorString(data, raw.VendorIdOffset),
+		Product:      descriptorString(data, raw.ProductIdOffset),
+		Revision:     descriptorString(data, raw.ProductRevisionOffset),
+		SerialNumber: descriptorString(data, raw.SerialNumberOffset),
+		BusType:      int(raw.BusType),
+		Removable:    raw.RemovableMedia != 0,
+	}, nil
+}
+
+// descriptorString returns the NUL-terminated string at offset in a
+// descriptor buffer, trimmed of the padding devices add.
+func descriptorString(data []byte, offset uint32) string {
+	if offset == 0 || int(offset) >= len(data) {
+		return ""
+	}
+	s := data[offset:]
+	for i, c := range s {
+		if c == 0 {
+			s = s[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(string(s))
+}
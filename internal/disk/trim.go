@@ -0,0 +1,119 @@
+package disk
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Storage IOCTLs for querying TRIM support and discarding blocks.
+const (
+	IOCTL_STORAGE_QUERY_PROPERTY             = 0x002D1400
+	IOCTL_STORAGE_MANAGE_DATA_SET_ATTRIBUTES = 0x002D9404
+)
+
+const (
+	storageDeviceTrimProperty = 8 // STORAGE_PROPERTY_ID StorageDeviceTrimProperty
+	propertyStandardQuery     = 0 // STORAGE_QUERY_TYPE PropertyStandardQuery
+	deviceDsmActionTrim       = 1 // DEVICE_DATA_MANAGEMENT_SET_ACTION DeviceDsmAction_Trim
+)
+
+// rawStoragePropertyQuery maps to STORAGE_PROPERTY_QUERY.
+type rawStoragePropertyQuery struct {
+	PropertyId           uint32
+	QueryType            uint32
+	AdditionalParameters [1]byte
+}
+
+// rawDeviceTrimDescriptor maps to DEVICE_TRIM_DESCRIPTOR.
+type rawDeviceTrimDescriptor struct {
+	Version     uint32
+	Size        uint32
+	TrimEnabled byte
+}
+
+// rawManageDataSetAttributes maps to DEVICE_MANAGE_DATA_SET_ATTRIBUTES.
+type rawManageDataSetAttributes struct {
+	Size                 uint32
+	Action               uint32
+	Flags                uint32
+	ParameterBlockOffset uint32
+	ParameterBlockLength uint32
+	DataSetRangesOffset  uint32
+	DataSetRangesLength  uint32
+}
+
+// rawDataSetRange maps to DEVICE_DATA_SET_RANGE.
+type rawDataSetRange struct {
+	StartingOffset int64
+	LengthInBytes  uint64
+}
+
+// rawTrimRequest is the IOCTL input: the attributes followed by a single
+// range. The padding keeps the range 8-byte aligned on 32-bit builds too.
+type rawTrimRequest struct {
+	Attributes rawManageDataSetAttributes
+	_          uint32
+	Range      rawDataSetRange
+}
+
+// TrimSupported reports whether the disk advertises TRIM (ATA DSM or SCSI
+// UNMAP). Most USB sticks don't; UASP enclosures and some newer sticks do.
+func TrimSupported(handle windows.Handle) (bool, error) {
+	query := rawStoragePropertyQuery{
+		PropertyId: storageDeviceTrimProperty,
+		QueryType:  propertyStandardQuery,
+	}
+	var desc rawDeviceTrimDescriptor
+	var bytesReturned uint32
+
+	err := windows.DeviceIoControl(
+		handle,
+		IOCTL_STORAGE_QUERY_PROPERTY,
+		(*byte)(unsafe.Pointer(&query)),
+		uint32(unsafe.Sizeof(query)),
+		(*byte)(unsafe.Pointer(&desc)),
+		uint32(unsafe.Sizeof(desc)),
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		// Drivers that don't know the property reject the query outright
+		if err == windows.ERROR_INVALID_FUNCTION || err == windows.ERROR_NOT_SUPPORTED {
+			return false, nil
+		}
+		return false, fmt.Errorf("IOCTL_STORAGE_QUERY_PROPERTY: %w", err)
+	}
+	return desc.TrimEnabled != 0, nil
+}
+
+// Trim tells the device that the given byte range no longer holds data, so
+// the controller can erase the blocks ahead of the next write. offset and
+// length must be sector multiples. Trimmed sectors read back as zeros or as
+// stale data, depending on the device.
+func Trim(handle windows.Handle, offset, length int64) error {
+	var req rawTrimRequest
+	req.Attributes = rawManageDataSetAttributes{
+		Size:                uint32(unsafe.Sizeof(req.Attributes)),
+		Action:              deviceDsmActionTrim,
+		DataSetRangesOffset: uint32(unsafe.Offsetof(req.Range)),
+		DataSetRangesLength: uint32(unsafe.Sizeof(req.Range)),
+	}
+	req.Range = rawDataSetRange{StartingOffset: offset, LengthInBytes: uint64(length)}
+	var bytesReturned uint32
+
+	err := windows.DeviceIoControl(
+		handle,
+		IOCTL_STORAGE_MANAGE_DATA_SET_ATTRIBUTES,
+		(*byte)(unsafe.Pointer(&req)),
+		uint32(unsafe.Sizeof(req)),
+		nil, 0,
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("IOCTL_STORAGE_MANAGE_DATA_SET_ATTRIBUTES: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package disk
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// virtdisk.dll constants for creating VHD/VHDX files (Windows 8+).
+const (
+	virtualStorageTypeDeviceVHD   = 2 // VIRTUAL_STORAGE_TYPE_DEVICE_VHD
+	virtualStorageTypeDeviceVHDX  = 3 // VIRTUAL_STORAGE_TYPE_DEVICE_VHDX
+	createVirtualDiskVersion2     = 2
+	attachVirtualDiskVersion1     = 1
+	attachVirtualDiskFlagNoLetter = 0x00000002 // ATTACH_VIRTUAL_DISK_FLAG_NO_DRIVE_LETTER
+)
+
+// virtualStorageTypeVendorMicrosoft is VIRTUAL_STORAGE_TYPE_VENDOR_MICROSOFT.
+var virtualStorageTypeVendorMicrosoft = windows.GUID{
+	Data1: 0xEC984AEC,
+	Data2: 0xA0F9,
+	Data3: 0x47E9,
+	Data4: [8]byte{0x90, 0x1F, 0x71, 0x41, 0x5A, 0x66, 0x34, 0x5B},
+}
+
+var (
+	modvirtdisk                    = windows.NewLazySystemDLL("virtdisk.dll")
+	procCreateVirtualDisk          = modvirtdisk.NewProc("CreateVirtualDisk")
+	procAttachVirtualDisk          = modvirtdisk.NewProc("AttachVirtualDisk")
+	procDetachVirtualDisk          = modvirtdisk.NewProc("DetachVirtualDisk")
+	procGetVirtualDiskPhysicalPath = modvirtdisk.NewProc("GetVirtualDiskPhysicalPath")
+)
+
+// virtualStorageType mirrors VIRTUAL_STORAGE_TYPE.
+type virtualStorageType struct {
+	DeviceID uint32
+	VendorID windows.GUID
+}
+
+// createVirtualDiskParameters mirrors CREATE_VIRTUAL_DISK_PARAMETERS with
+// the Version2 member of its union. Zero sizes select the defaults.
+type createVirtualDiskParameters struct {
+	Version                   uint32
+	_                         uint32
+	UniqueID                  windows.GUID
+	MaximumSize               uint64
+	BlockSizeInBytes          uint32
+	SectorSizeInBytes         uint32
+	PhysicalSectorSizeInBytes uint32
+	_                         uint32
+	ParentPath                *uint16
+	SourcePath                *uint16
+	OpenFlags                 uint32
+	ParentVirtualStorageType  virtualStorageType
+	SourceVirtualStorageType  virtualStorageType
+	ResiliencyGUID            windows.GUID
+	_                         [64]byte // Room for later union members
+}
+
+// attachVirtualDiskParameters mirrors ATTACH_VIRTUAL_DISK_PARAMETERS.
+type attachVirtualDiskParameters struct {
+	Version  uint32
+	Reserved uint32
+	_        [16]byte
+}
+
+// VirtualDisk is a newly created VHD/VHDX attached as a local disk.
+type VirtualDisk struct {
+	handle windows.Handle
+	// PhysicalPath is the attached disk, e.g. \\.\PhysicalDrive5
+	PhysicalPath string
+}
+
+// CreateVirtualDisk creates a dynamically expanding VHD or VHDX (chosen by
+// the path's extension) of the given size and attaches it without drive
+// letters, so its contents can be written through PhysicalPath.
+func CreateVirtualDisk(path string, size int64) (*VirtualDisk, error) {
+	if err := modvirtdisk.Load(); err != nil {
+		return nil, fmt.Errorf("virtdisk.dll not available: %w", err)
+	}
+
+	deviceID := uint32(virtualStorageTypeDeviceVHDX)
+	if strings.EqualFold(filepath.Ext(path), ".vhd") {
+		deviceID = virtualStorageTypeDeviceVHD
+	}
+	storageType := virtualStorageType{DeviceID: deviceID, VendorID: virtualStorageTypeVendorMicrosoft}
+
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+	params := createVirtualDiskParameters{
+		Version:     createVirtualDiskVersion2,
+		MaximumSize: uint64(size),
+	}
+
+	var handle windows.Handle
+	r1, _, _ := procCreateVirtualDisk.Call(
+		uintptr(unsafe.Pointer(&storageType)),
+		uintptr(unsafe.Pointer(pathPtr)),
+		0, // VIRTUAL_DISK_ACCESS_NONE, required with version 2 parameters
+		0,
+		0, // CREATE_VIRTUAL_DISK_FLAG_NONE: dynamically expanding
+		0,
+		uintptr(unsafe.Pointer(&params)),
+		0,
+		uintptr(unsafe.Pointer(&handle)),
+	)
+	if r1 != 0 {
+		return nil, fmt.Errorf("CreateVirtualDisk: %w", syscall.Errno(r1))
+	}
+
+	attachParams := attachVirtualDiskParameters{Version: attachVirtualDiskVersion1}
+	r1, _, _ = procAttachVirtualDisk.Call(
+		uintptr(handle),
+		0,
+		attachVirtualDiskFlagNoLetter,
+		0,
+		uintptr(unsafe.Pointer(&attachParams)),
+		0,
+	)
+	if r1 != 0 {
+		windows.CloseHandle(handle)
+		return nil, fmt.Errorf("AttachVirtualDisk: %w", syscall.Errno(r1))
+	}
+
+	vd := &VirtualDisk{handle: handle}
+	buf := make([]uint16, windows.MAX_PATH)
+	bufSize := uint32(len(buf) * 2)
+	r1, _, _ = procGetVirtualDiskPhysicalPath.Call(
+		uintptr(handle),
+		uintptr(unsafe.Pointer(&bufSize)),
+		uintptr(unsafe.Pointer(&buf[0])),
+	)
+	if r1 != 0 {
+		vd.Close()
+		return nil, fmt.Errorf("GetVirtualDiskPhysicalPath: %w", syscall.Errno(r1))
+	}
+	vd.PhysicalPath = windows.UTF16ToString(buf)
+	return vd, nil
+}
+
+// Close detaches the virtual disk and closes it.
+func (vd *VirtualDisk) Close() error {
+	procDetachVirtualDisk.Call(uintptr(vd.handle), 0, 0)
+	return windows.CloseHandle(vd.handle)
+}
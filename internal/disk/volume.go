@@ -2,9 +2,13 @@ package disk
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"syscall"
 	"time"
 	"unsafe"
+
+	"golang.org/x/sys/windows"
 )
 
 const (
@@ -17,14 +21,22 @@ var procSetVolumeLabelW = syscall.NewLazyDLL("kernel32.dll").NewProc("SetVolumeL
 // SetVolumeLabel sets the volume label on a Windows drive using the native API.
 // Retries up to 3 times with a 500ms delay to handle transient USB bus errors.
 func SetVolumeLabel(driveLetter, label string) error {
-	rootPath := driveLetter + ":\\"
+	return SetVolumeLabelByPath(driveLetter+":\\", label)
+}
+
+// SetVolumeLabelByPath sets the label of a volume given its root path, a
+// drive root (E:\) or volume GUID path, so volumes without a drive letter
+// can be labeled too. An empty label removes the volume's label.
+func SetVolumeLabelByPath(rootPath, label string) error {
 	rootPtr, err := syscall.UTF16PtrFromString(rootPath)
 	if err != nil {
-		return fmt.Errorf("invalid drive letter: %w", err)
+		return fmt.Errorf("invalid volume path: %w", err)
 	}
-	labelPtr, err := syscall.UTF16PtrFromString(label)
-	if err != nil {
-		return fmt.Errorf("invalid label: %w", err)
+	var labelPtr *uint16 // NULL deletes the label
+	if label != "" {
+		if labelPtr, err = syscall.UTF16PtrFromString(label); err != nil {
+			return fmt.Errorf("invalid label: %w", err)
+		}
 	}
 
 	var lastErr error
@@ -43,3 +55,103 @@ func SetVolumeLabel(driveLetter, label string) error {
 	}
 	return fmt.Errorf("SetVolumeLabelW failed after %d attempts: %w", labelMaxRetries, lastErr)
 }
+
+// GetVolumeLabel returns the label of a mounted volume, given a drive root
+// (E:\) or volume GUID path; it is empty for unlabeled volumes.
+func GetVolumeLabel(volumePath string) (string, error) {
+	if !strings.HasSuffix(volumePath, `\`) {
+		volumePath += `\`
+	}
+	rootPtr, err := windows.UTF16PtrFromString(volumePath)
+	if err != nil {
+		return "", fmt.Errorf("invalid volume path: %w", err)
+	}
+
+	label := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(rootPtr, &label[0], uint32(len(label)), nil, nil, nil, nil, 0); err != nil {
+		return "", fmt.Errorf("GetVolumeInformation %s: %w", volumePath, err)
+	}
+	return windows.UTF16ToString(label), nil
+}
+
+// GetVolumeFileSystem returns the file system name (e.g. "FAT32", "NTFS")
+// of a mounted volume, given a drive root (E:\) or volume GUID path.
+func GetVolumeFileSystem(volumePath string) (string, error) {
+	if !strings.HasSuffix(volumePath, `\`) {
+		volumePath += `\`
+	}
+	rootPtr, err := windows.UTF16PtrFromString(volumePath)
+	if err != nil {
+		return "", fmt.Errorf("invalid volume path: %w", err)
+	}
+
+	fsName := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(rootPtr, nil, 0, nil, nil, nil, &fsName[0], uint32(len(fsName))); err != nil {
+		return "", fmt.Errorf("GetVolumeInformation %s: %w", volumePath, err)
+	}
+	return windows.UTF16ToString(fsName), nil
+}
+
+// VolumeContents summarizes what a mounted volume holds.
+type VolumeContents struct {
+	Label      string
+	FileSystem string
+	TotalBytes int64
+	UsedBytes  int64
+	Folders    int // Top-level folders, not counting system folders
+	Files      int // Top-level files
+}
+
+// hiddenRootFolders are created by Windows on every volume and say nothing
+// about what the user stored there.
+var hiddenRootFolders = map[string]bool{
+	"system volume information": true,
+	"$recycle.bin":              true,
+}
+
+// GetVolumeContents returns the label, space usage and top-level entry
+// counts of a mounted volume, given a drive root (E:\) or volume GUID path.
+// It fails for volumes Windows can't read, such as RAW or locked ones.
+func GetVolumeContents(volumePath string) (*VolumeContents, error) {
+	if !strings.HasSuffix(volumePath, `\`) {
+		volumePath += `\`
+	}
+	rootPtr, err := windows.UTF16PtrFromString(volumePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume path: %w", err)
+	}
+
+	label := make([]uint16, windows.MAX_PATH+1)
+	fsName := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(rootPtr, &label[0], uint32(len(label)), nil, nil, nil, &fsName[0], uint32(len(fsName))); err != nil {
+		return nil, fmt.Errorf("GetVolumeInformation %s: %w", volumePath, err)
+	}
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	if err := windows.GetDiskFreeSpaceEx(rootPtr, &freeBytesAvailable, &totalBytes, &totalFreeBytes); err != nil {
+		return nil, fmt.Errorf("GetDiskFreeSpaceEx %s: %w", volumePath, err)
+	}
+
+	contents := &VolumeContents{
+		Label:      windows.UTF16ToString(label),
+		FileSystem: windows.UTF16ToString(fsName),
+		TotalBytes: int64(totalBytes),
+		UsedBytes:  int64(totalBytes - totalFreeBytes),
+	}
+
+	// The entry counts are best-effort; a volume that can't be listed still
+	// reports its space usage
+	entries, err := os.ReadDir(volumePath)
+	if err != nil {
+		return contents, nil
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir() && hiddenRootFolders[strings.ToLower(entry.Name())]:
+		case entry.IsDir():
+			contents.Folders++
+		default:
+			contents.Files++
+		}
+	}
+	return contents, nil
+}
@@ -0,0 +1,362 @@
+// Package files copies directory trees onto drives' volumes and checks them
+// afterwards, for loading content onto freshly formatted sticks.
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+)
+
+// Copy stages
+const (
+	StageScanning  = "Scanning"
+	StageCopying   = "Copying"
+	StageVerifying = "Verifying"
+	StageComplete  = "Complete"
+)
+
+// copyBufferSize is the buffer used to copy and hash files.
+const copyBufferSize = 1 << 20
+
+// Options configures a copy.
+type Options struct {
+	Source string // Directory to copy
+	Target string // Directory to copy into, e.g. `E:\` or `E:\content`
+	Verify bool   // Read every file back and compare its hash
+	Sync   bool   // Skip files already on the target with the same size and modification time
+}
+
+// Entry is a file of a copied tree.
+type Entry struct {
+	Path   string `json:"path"` // Relative to the tree, with forward slashes
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Result describes a finished copy.
+type Result struct {
+	Files    int     `json:"files"`
+	Skipped  int     `json:"skipped,omitempty"` // Unchanged files left alone with Sync
+	Bytes    int64   `json:"bytes"`
+	Verified bool    `json:"verified"`
+	Duration string  `json:"duration"`
+	Entries  []Entry `json:"-"`
+}
+
+// Progress represents the current state of a copy.
+type Progress struct {
+	Stage       string `json:"stage"`
+	Percentage  int    `json:"percentage"`
+	BytesCopied int64  `json:"bytes_copied"`
+	TotalBytes  int64  `json:"total_bytes"`
+	Files       int    `json:"files"`
+	TotalFiles  int    `json:"total_files"`
+	File        string `json:"file,omitempty"`
+	Speed       string `json:"speed,omitempty"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Copier copies a directory tree onto a volume.
+type Copier struct {
+	progressChan chan Progress
+}
+
+// NewCopier creates a new copier
+func NewCopier() *Copier {
+	return &Copier{
+		progressChan: make(chan Progress, 10),
+	}
+}
+
+// Progress returns a channel that receives progress updates
+func (c *Copier) Progress() <-chan Progress {
+	return c.progressChan
+}
+
+// sourceFile is a file found while scanning the source tree.
+type sourceFile struct {
+	rel  string
+	info fs.FileInfo
+}
+
+// Copy copies opts.Source into opts.Target, hashing every file (SHA-256) as
+// it is written, then with opts.Verify reads the copies back and compares
+// their hashes. Paths longer than MAX_PATH are handled.
+func (c *Copier) Copy(ctx context.Context, opts Options) (*Result, error) {
+	defer close(c.progressChan)
+	start := time.Now()
+
+	result, err := c.copy(ctx, opts, start)
+	if err != nil {
+		c.send(Progress{Stage: "Error", Status: flash.StatusError, Error: err.Error()})
+		return nil, err
+	}
+	result.Duration = time.Since(start).Round(time.Second).String()
+	c.send(Progress{
+		Stage:       StageComplete,
+		Percentage:  100,
+		BytesCopied: result.Bytes,
+		TotalBytes:  result.Bytes,
+		Files:       result.Files,
+		TotalFiles:  result.Files,
+		Status:      flash.StatusComplete,
+	})
+	return result, nil
+}
+
+func (c *Copier) copy(ctx context.Context, opts Options, start time.Time) (*Result, error) {
+	c.sendProgress(Progress{Stage: StageScanning})
+	sources, total, err := scan(opts.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	totalFiles := 0
+	for _, f := range sources {
+		if !f.info.IsDir() {
+			totalFiles++
+		}
+	}
+
+	result := &Result{Bytes: total}
+	var done int64
+	for _, f := range sources {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		src := LongPath(filepath.Join(opts.Source, f.rel))
+		dst := LongPath(filepath.Join(opts.Target, f.rel))
+		if f.info.IsDir() {
+			if err := os.MkdirAll(dst, 0o755); err != nil {
+				return nil, fmt.Errorf("create directory %s: %w", f.rel, err)
+			}
+			continue
+		}
+
+		var digest string
+		if opts.Sync && unchanged(dst, f.info) {
+			if digest, err = HashFile(ctx, src); err != nil {
+				return nil, fmt.Errorf("hash %s: %w", f.rel, err)
+			}
+			result.Skipped++
+		} else {
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+				return nil, fmt.Errorf("create directory for %s: %w", f.rel, err)
+			}
+			if digest, err = copyFile(ctx, src, dst, f.info); err != nil {
+				return nil, fmt.Errorf("copy %s: %w", f.rel, err)
+			}
+		}
+		result.Entries = append(result.Entries, Entry{
+			Path:   filepath.ToSlash(f.rel),
+			Size:   f.info.Size(),
+			SHA256: digest,
+		})
+
+		done += f.info.Size()
+		c.sendProgress(Progress{
+			Stage:       StageCopying,
+			Percentage:  percent(done, total, opts.Verify),
+			BytesCopied: done,
+			TotalBytes:  total,
+			Files:       len(result.Entries),
+			TotalFiles:  totalFiles,
+			File:        filepath.ToSlash(f.rel),
+			Speed:       speed(done, start),
+		})
+	}
+	result.Files = len(result.Entries)
+
+	if opts.Verify {
+		verifyStart := time.Now()
+		var checked int64
+		err := Verify(ctx, opts.Target, result.Entries, func(e Entry) {
+			checked += e.Size
+			c.sendProgress(Progress{
+				Stage:       StageVerifying,
+				Percentage:  50 + percent(checked, total, false)/2,
+				BytesCopied: checked,
+				TotalBytes:  total,
+				File:        e.Path,
+				Speed:       speed(checked, verifyStart),
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Verified = true
+	}
+	return result, nil
+}
+
+// Verify hashes the files of entries under root and compares them with the
+// entries' hashes, calling done after each file. It fails at the first
+// missing or different file.
+func Verify(ctx context.Context, root string, entries []Entry, done func(Entry)) error {
+	for _, e := range entries {
+		digest, err := HashFile(ctx, LongPath(filepath.Join(root, filepath.FromSlash(e.Path))))
+		if err != nil {
+			return fmt.Errorf("verify %s: %w", e.Path, err)
+		}
+		if digest != e.SHA256 {
+			return fmt.Errorf("verify %s: contents differ from the source", e.Path)
+		}
+		if done != nil {
+			done(e)
+		}
+	}
+	return nil
+}
+
+// HashFile returns the hex SHA-256 of a file.
+func HashFile(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyBuffer(h, &ctxReader{ctx: ctx, r: f}, make([]byte, copyBufferSize)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// scan lists the source tree, directories before their contents, and
+// totals the size of its files.
+func scan(root string) ([]sourceFile, int64, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !info.IsDir() {
+		return nil, 0, fmt.Errorf("%s is not a directory", root)
+	}
+
+	var sources []sourceFile
+	var total int64
+	err = filepath.WalkDir(LongPath(root), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(LongPath(root), path)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		sources = append(sources, sourceFile{rel: rel, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(sources) == 0 {
+		return nil, 0, errors.New("nothing to copy: the source directory is empty")
+	}
+	return sources, total, nil
+}
+
+// unchanged reports whether path exists with info's size and modification
+// time, as left by an earlier copy.
+func unchanged(path string, info fs.FileInfo) bool {
+	existing, err := os.Stat(path)
+	if err != nil || existing.IsDir() {
+		return false
+	}
+	// FAT keeps modification times to 2 seconds
+	diff := existing.ModTime().Sub(info.ModTime())
+	return existing.Size() == info.Size() && diff < 2*time.Second && diff > -2*time.Second
+}
+
+// copyFile copies src to dst, replacing it, keeps src's modification time
+// and returns the hex SHA-256 of the data written.
+func copyFile(ctx context.Context, src, dst string, info fs.FileInfo) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.CopyBuffer(io.MultiWriter(out, h), &ctxReader{ctx: ctx, r: in}, make([]byte, copyBufferSize))
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// percent returns done as a percentage of total, scaled to the first half
+// when a verification pass follows.
+func percent(done, total int64, verifyFollows bool) int {
+	pct := 100
+	if total > 0 {
+		pct = int(done * 100 / total)
+	}
+	if verifyFollows {
+		pct /= 2
+	}
+	return pct
+}
+
+func speed(done int64, since time.Time) string {
+	elapsed := time.Since(since).Seconds()
+	if elapsed < 0.5 {
+		return ""
+	}
+	return flash.FormatBytes(int64(float64(done)/elapsed)) + "/s"
+}
+
+func (c *Copier) sendProgress(p Progress) {
+	p.Status = flash.StatusInProgress
+	select {
+	case c.progressChan <- p:
+	default:
+	}
+}
+
+func (c *Copier) send(p Progress) {
+	c.progressChan <- p
+}
+
+// ctxReader stops a copy when its context is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,24 @@
+package files
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// LongPath returns path in the \\?\ form, which lifts the 260-character
+// MAX_PATH limit of Windows file APIs for deep content trees. Relative
+// paths are made absolute first, since the prefix turns off path parsing.
+func LongPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// UNC share: \\server\share -> \\?\UNC\server\share
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
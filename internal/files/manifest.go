@@ -0,0 +1,200 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// manifestVersion is the version written to new manifests.
+const manifestVersion = 1
+
+// systemDirs are folders Windows keeps at a volume's root, never reported as
+// extra files.
+var systemDirs = []string{"System Volume Information", "$RECYCLE.BIN"}
+
+// Manifest lists the files of a copied tree with their hashes, so drives
+// loaded with it can be checked later.
+type Manifest struct {
+	Version    int       `json:"version"`
+	Created    time.Time `json:"created"`
+	Source     string    `json:"source"`
+	TotalBytes int64     `json:"total_bytes"`
+	Files      []Entry   `json:"files"`
+}
+
+// NewManifest creates a manifest of the entries copied from source.
+func NewManifest(source string, entries []Entry) *Manifest {
+	m := &Manifest{
+		Version: manifestVersion,
+		Created: time.Now().UTC(),
+		Source:  source,
+		Files:   entries,
+	}
+	for _, e := range entries {
+		m.TotalBytes += e.Size
+	}
+	return m
+}
+
+// HashTree hashes every file under root, for a manifest of what a copy of
+// it will put on a drive.
+func HashTree(ctx context.Context, root string) ([]Entry, error) {
+	sources, _, err := scan(root)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, f := range sources {
+		if f.info.IsDir() {
+			continue
+		}
+		digest, err := HashFile(ctx, LongPath(filepath.Join(root, f.rel)))
+		if err != nil {
+			return nil, fmt.Errorf("hash %s: %w", f.rel, err)
+		}
+		entries = append(entries, Entry{
+			Path:   filepath.ToSlash(f.rel),
+			Size:   f.info.Size(),
+			SHA256: digest,
+		})
+	}
+	return entries, nil
+}
+
+// WriteManifest saves a manifest as indented JSON.
+func WriteManifest(path string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadManifest loads a manifest written by WriteManifest.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: not a valid manifest: %w", path, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("%s: unsupported manifest version %d", path, m.Version)
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("%s: the manifest lists no files", path)
+	}
+	return &m, nil
+}
+
+// CheckResult is the outcome of checking a drive against a manifest.
+type CheckResult struct {
+	Root      string   `json:"root"`
+	Files     int      `json:"files"`   // Files listed in the manifest
+	Matched   int      `json:"matched"` // Files present with the right contents
+	Missing   []string `json:"missing"`
+	Corrupted []string `json:"corrupted"` // Present, but with a different size or hash
+	Extra     []string `json:"extra"`     // On the drive but not in the manifest
+	Bytes     int64    `json:"bytes_checked"`
+	Duration  string   `json:"duration"`
+}
+
+// OK reports whether every file of the manifest is present and intact.
+func (r *CheckResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Corrupted) == 0
+}
+
+// Check hashes the files under root and compares them with the manifest,
+// collecting every missing, corrupted and extra file instead of stopping at
+// the first. done is called after each manifest file is checked.
+func Check(ctx context.Context, root string, m *Manifest, done func(checked, total int64)) (*CheckResult, error) {
+	start := time.Now()
+	result := &CheckResult{
+		Root:      root,
+		Files:     len(m.Files),
+		Missing:   []string{},
+		Corrupted: []string{},
+		Extra:     []string{},
+	}
+
+	listed := make(map[string]bool, len(m.Files))
+	for _, e := range m.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		listed[strings.ToLower(e.Path)] = true
+
+		path := LongPath(filepath.Join(root, filepath.FromSlash(e.Path)))
+		info, err := os.Stat(path)
+		switch {
+		case err != nil || info.IsDir():
+			result.Missing = append(result.Missing, e.Path)
+		case info.Size() != e.Size:
+			result.Corrupted = append(result.Corrupted, e.Path)
+		default:
+			digest, err := HashFile(ctx, path)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				result.Corrupted = append(result.Corrupted, e.Path)
+			} else if digest != e.SHA256 {
+				result.Corrupted = append(result.Corrupted, e.Path)
+			} else {
+				result.Matched++
+			}
+		}
+		result.Bytes += e.Size
+		if done != nil {
+			done(result.Bytes, m.TotalBytes)
+		}
+	}
+
+	// Windows paths are case-insensitive, so compare them that way
+	err := filepath.WalkDir(LongPath(root), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(LongPath(root), path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if d.IsDir() {
+			if isSystemDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel := filepath.ToSlash(rel); !listed[strings.ToLower(rel)] {
+			result.Extra = append(result.Extra, rel)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("list %s: %w", root, err)
+	}
+	sort.Strings(result.Extra)
+
+	result.Duration = time.Since(start).Round(time.Second).String()
+	return result, nil
+}
+
+// isSystemDir reports whether rel is one of Windows' folders at the root.
+func isSystemDir(rel string) bool {
+	for _, dir := range systemDirs {
+		if strings.EqualFold(rel, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,609 @@
+package flash
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/sys/windows"
+)
+
+// StageReading is reported while a drive is read into an image
+const StageReading = "Reading"
+
+// BackupOptions configures backing up a drive to an image file
+type BackupOptions struct {
+	DiskNumber    int
+	DriveLetter   string // Optional: cached drive letter to avoid WMI lookup
+	OutputPath    string // .img/.bin/.raw, or .gz/.zst/.xz to compress
+	BufferSize    int    // Buffer size in MB (default: 4)
+	HashAlgorithm string // md5, sha1, sha256, sha512, blake3 or xxhash; empty disables hashing
+	Used          string // BackupUsedPartitions or BackupUsedClusters; empty reads the whole disk
+	Format        string // BackupFormatRaw, BackupFormatVHD or BackupFormatVHDX; empty picks by extension
+	SplitSize     int64  // Split raw output into chunks of this many bytes plus a SplitIndex; 0 = one file
+	BlockMap      string // Optional: write a block map of the drive for later delta flashes
+	DiskSerial    string // Serial number recorded in the block map
+}
+
+// Backup output formats
+const (
+	BackupFormatRaw  = "raw"  // Raw image, optionally compressed
+	BackupFormatVHD  = "vhd"  // Dynamic VHD, mountable in Disk Management
+	BackupFormatVHDX = "vhdx" // Dynamic VHDX, mountable in Disk Management and Hyper-V
+)
+
+// BackupResult describes a finished backup
+type BackupResult struct {
+	Output      string `json:"output"`
+	ImageSize   int64  `json:"imageSize"` // Uncompressed image size
+	BytesRead   int64  `json:"bytesRead"` // Bytes read from the drive
+	OutputSize  int64  `json:"outputSize"`
+	Format      string `json:"format"`
+	Compression string `json:"compression,omitempty"`
+	Used        string `json:"used,omitempty"`
+	Chunks      int    `json:"chunks,omitempty"` // Number of chunk files of a split image
+	BlockMap    string `json:"blockMap,omitempty"`
+	// Hash is the digest of the image contents, comparable to flash --hash;
+	// FileHash is the digest of the output file, also written to a
+	// <output>.<algo> sidecar that flash --checksum accepts.
+	HashAlgorithm string   `json:"hashAlgorithm,omitempty"`
+	Hash          string   `json:"hash,omitempty"`
+	FileHash      string   `json:"fileHash,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+}
+
+// Backuper reads a drive into an image file
+type Backuper struct {
+	progressChan chan Progress
+}
+
+// NewBackuper creates a new backuper
+func NewBackuper() *Backuper {
+	return &Backuper{
+		progressChan: make(chan Progress, 10),
+	}
+}
+
+// Progress returns a channel that receives progress updates
+func (b *Backuper) Progress() <-chan Progress {
+	return b.progressChan
+}
+
+// BackupFormat resolves the output format: format if set (it must match the
+// extension of a .vhd/.vhdx file), otherwise the one the extension implies.
+func BackupFormat(outputPath, format string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(outputPath))
+	byExt := BackupFormatRaw
+	if ext == ".vhd" || ext == ".vhdx" {
+		byExt = ext[1:]
+	}
+	switch format {
+	case "":
+		return byExt, nil
+	case BackupFormatRaw:
+		if byExt != BackupFormatRaw {
+			return "", fmt.Errorf("%s output needs --format %s", ext, byExt)
+		}
+		return format, nil
+	case BackupFormatVHD, BackupFormatVHDX:
+		if byExt != format {
+			return "", fmt.Errorf("--format %s needs a .%s output file", format, format)
+		}
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q: use raw, vhd or vhdx", format)
+	}
+}
+
+// BackupCompression returns the compressor selected by the output file's
+// extension ("gzip", "zstd", "xz"), or "" for an uncompressed image.
+func BackupCompression(outputPath string) (string, error) {
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".gz":
+		return "gzip", nil
+	case ".zst", ".zstd":
+		return "zstd", nil
+	case ".xz":
+		return "xz", nil
+	case ".zip", ".7z":
+		return "", fmt.Errorf("cannot write %s archives: use .gz, .zst or .xz", filepath.Ext(outputPath))
+	default:
+		return "", nil
+	}
+}
+
+// Backup reads the drive (or with opts.Used only its used parts) and writes
+// it to opts.OutputPath. The image is written to a .partial file first and
+// only renamed into place once it is complete; split images are complete
+// once their index has been written.
+func (b *Backuper) Backup(ctx context.Context, opts BackupOptions) (*BackupResult, error) {
+	defer close(b.progressChan)
+
+	format, err := BackupFormat(opts.OutputPath, opts.Format)
+	if err != nil {
+		b.sendError(err.Error())
+		return nil, err
+	}
+	compression := ""
+	if format == BackupFormatRaw {
+		if compression, err = BackupCompression(opts.OutputPath); err != nil {
+			b.sendError(err.Error())
+			return nil, err
+		}
+	}
+
+	var diskHash, fileHash hash.Hash
+	if opts.HashAlgorithm != "" {
+		if diskHash, err = newHash(opts.HashAlgorithm); err != nil {
+			b.sendError(err.Error())
+			return nil, err
+		}
+		fileHash, _ = newHash(opts.HashAlgorithm)
+	}
+
+	// Plan the read while the volumes are still mounted: cluster bitmaps
+	// can only be queried from a mounted filesystem
+	plan, err := b.plan(opts)
+	if err != nil {
+		b.sendError(err.Error())
+		return nil, err
+	}
+
+	// Lock the volumes like a flash does, so nothing changes on the drive
+	// while it's being read
+	var reader *diskWriter
+	if opts.DriveLetter != "" {
+		reader = newDiskWriterWithDriveLetter(opts.DiskNumber, opts.DriveLetter)
+	} else {
+		reader = newDiskWriter(opts.DiskNumber)
+	}
+	if err := reader.Open(); err != nil {
+		b.sendError(err.Error())
+		return nil, err
+	}
+	defer reader.Close()
+
+	var sink *backupSink
+	switch {
+	case format != BackupFormatRaw:
+		// The container itself isn't hashed, only its contents
+		fileHash = nil
+		sink, err = openVirtualDiskSink(opts.OutputPath, plan.size)
+	case opts.SplitSize > 0:
+		sink, err = openSplitSink(opts.OutputPath, opts.SplitSize, compression, fileHash)
+	default:
+		sink, err = openRawSink(opts.OutputPath, compression, fileHash)
+	}
+	if err != nil {
+		b.sendError(err.Error())
+		return nil, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			sink.discard()
+		}
+	}()
+
+	var out io.Writer = sink
+	var mapper *blockMapWriter
+	if opts.BlockMap != "" {
+		mapper = &blockMapWriter{m: newBlockMap(plan.diskSize, opts.DiskSerial)}
+		out = io.MultiWriter(sink, mapper)
+	}
+
+	bytesRead, err := b.readDisk(ctx, opts, reader, out, diskHash, plan)
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = sink.commit()
+	}
+	if err != nil {
+		b.sendError(err.Error())
+		return nil, err
+	}
+	committed = true
+
+	result := &BackupResult{
+		Output:      sink.output,
+		ImageSize:   plan.size,
+		BytesRead:   bytesRead,
+		OutputSize:  sink.size(),
+		Format:      format,
+		Compression: compression,
+		Used:        opts.Used,
+		Chunks:      sink.chunks,
+		Warnings:    plan.warnings,
+	}
+	if mapper != nil {
+		// Zero-filled gaps say nothing about what's on the drive there
+		mapper.Flush()
+		for _, gap := range plan.gaps() {
+			mapper.m.forget(gap.offset, gap.length)
+		}
+		if err := mapper.m.Save(opts.BlockMap); err != nil {
+			b.sendError(err.Error())
+			return nil, err
+		}
+		result.BlockMap = opts.BlockMap
+	}
+	if diskHash != nil {
+		result.HashAlgorithm = opts.HashAlgorithm
+		result.Hash = fmt.Sprintf("%x", diskHash.Sum(nil))
+	}
+	if fileHash != nil {
+		result.FileHash = fmt.Sprintf("%x", fileHash.Sum(nil))
+		sidecar := result.Output + "." + opts.HashAlgorithm
+		line := fmt.Sprintf("%s *%s\n", result.FileHash, filepath.Base(result.Output))
+		if err := os.WriteFile(sidecar, []byte(line), 0o644); err != nil {
+			err = fmt.Errorf("failed to write %s: %w", filepath.Base(sidecar), err)
+			b.sendError(err.Error())
+			return nil, err
+		}
+	}
+
+	b.sendComplete(bytesRead, result.Hash)
+	return result, nil
+}
+
+// plan measures the disk and decides which parts of it to read.
+func (b *Backuper) plan(opts BackupOptions) (*backupPlan, error) {
+	handle, err := disk.OpenPhysicalDisk(opts.DiskNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(handle)
+
+	geo, err := disk.GetDiskGeometry(handle)
+	if err != nil {
+		return nil, err
+	}
+	return planBackup(handle, opts.DiskNumber, geo.DiskSize, opts.Used)
+}
+
+// readDisk writes the planned image to out: extents are read from the
+// disk and everything between them is written as zeros. The image contents
+// are hashed into diskHash if set. Returns the number of bytes read.
+func (b *Backuper) readDisk(ctx context.Context, opts BackupOptions, reader *diskWriter, out io.Writer, diskHash hash.Hash, plan *backupPlan) (int64, error) {
+	bufSize := opts.BufferSize << 20
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+	buffer := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, buffer)
+	zeros := make([]byte, bufSize)
+
+	emit := func(data []byte) error {
+		if _, err := out.Write(data); err != nil {
+			return fmt.Errorf("write image: %w", err)
+		}
+		if diskHash != nil {
+			diskHash.Write(data)
+		}
+		return nil
+	}
+
+	readTotal := plan.readBytes()
+	var bytesRead, position int64
+	startTime := time.Now()
+	lastProgressUpdate := startTime
+	b.sendProgress(0, 0, readTotal, "")
+
+	// A final zero extent pads the image out to its full size
+	extents := append(plan.extents, extent{plan.size, 0})
+	for _, e := range extents {
+		for position < e.offset {
+			n := min(int64(bufSize), e.offset-position)
+			if err := emit(zeros[:n]); err != nil {
+				return bytesRead, err
+			}
+			position += n
+		}
+
+		for position < e.offset+e.length {
+			select {
+			case <-ctx.Done():
+				return bytesRead, ctx.Err()
+			default:
+			}
+
+			// Extents are sector multiples, so reads stay aligned
+			readSize := int(min(int64(bufSize), e.offset+e.length-position))
+			n, err := reader.ReadAt(buffer[:readSize], position)
+			if err != nil {
+				return bytesRead, fmt.Errorf("read disk at offset %d: %w", position, err)
+			}
+			if n == 0 {
+				return bytesRead, fmt.Errorf("unexpected end of disk at offset %d", position)
+			}
+			if err := emit(buffer[:n]); err != nil {
+				return bytesRead, err
+			}
+			position += int64(n)
+			bytesRead += int64(n)
+
+			now := time.Now()
+			if now.Sub(lastProgressUpdate) >= progressUpdateInterval {
+				lastProgressUpdate = now
+				speed := ""
+				if elapsed := now.Sub(startTime).Seconds(); elapsed > 0 {
+					speed = formatSpeed(float64(bytesRead) / elapsed)
+				}
+				b.sendProgress(progressPercent(bytesRead, readTotal), bytesRead, readTotal, speed)
+			}
+		}
+	}
+
+	return bytesRead, nil
+}
+
+// partialOutputPath returns where the image is written until it's complete.
+// Virtual disks keep their extension, which virtdisk uses to pick the format.
+func partialOutputPath(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	switch strings.ToLower(ext) {
+	case ".vhd", ".vhdx":
+		return strings.TrimSuffix(outputPath, ext) + ".partial" + ext
+	default:
+		return outputPath + ".partial"
+	}
+}
+
+// backupSink receives the image data of a backup.
+type backupSink struct {
+	io.Writer
+	output  string       // What to report as the output, once committed
+	close   func() error // Flushes and closes the output
+	commit  func() error // Moves the closed output into place
+	discard func()       // Removes the output after a failure
+	size    func() int64 // Size of the output once closed
+	chunks  int          // Chunk files written, for split images
+}
+
+func (s *backupSink) Close() error { return s.close() }
+
+// compressedSink feeds image data through the named compressor into dst,
+// hashing the bytes written to dst with fileHash if set. closeDst is called
+// after the compressor has been flushed.
+func compressedSink(dst io.Writer, compression string, fileHash hash.Hash, closeDst func() error) (*backupSink, error) {
+	// disk -> [compressor] -> [file hash] -> counter -> dst
+	counter := &countingWriter{w: dst}
+	var w io.Writer = counter
+	if fileHash != nil {
+		w = io.MultiWriter(counter, fileHash)
+	}
+	out, err := newCompressor(compression, w)
+	if err != nil {
+		closeDst()
+		return nil, err
+	}
+	return &backupSink{
+		Writer: out,
+		close: func() error {
+			err := out.Close()
+			if closeErr := closeDst(); err == nil {
+				err = closeErr
+			}
+			return err
+		},
+		size: func() int64 { return counter.n.Load() },
+	}, nil
+}
+
+// openRawSink creates a raw image at the partial path of outputPath,
+// compressed if compression is set. Uncompressed images are written sparse,
+// so skipped areas take no space.
+func openRawSink(outputPath, compression string, fileHash hash.Hash) (*backupSink, error) {
+	partialPath := partialOutputPath(outputPath)
+	file, err := os.Create(partialPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	var dst io.Writer = file
+	var sparse *sparseWriter
+	if compression == "" {
+		sparse = newSparseWriter(file)
+		dst = sparse
+	}
+	sink, err := compressedSink(dst, compression, fileHash, func() error {
+		var err error
+		if sparse != nil {
+			err = sparse.Finish()
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+	if err != nil {
+		os.Remove(partialPath)
+		return nil, err
+	}
+	sink.output = outputPath
+	sink.commit = func() error { return finalizeOutput(partialPath, outputPath) }
+	sink.discard = func() { os.Remove(partialPath) }
+	return sink, nil
+}
+
+// openSplitSink writes a raw image as chunks of chunkSize bytes named
+// outputPath.001, .002... Committing writes the SplitIndex that makes them
+// a complete image.
+func openSplitSink(outputPath string, chunkSize int64, compression string, fileHash hash.Hash) (*backupSink, error) {
+	chunks := newSplitWriter(outputPath, chunkSize, compression == "")
+	sink, err := compressedSink(chunks, compression, fileHash, chunks.Close)
+	if err != nil {
+		return nil, err
+	}
+	indexPath := outputPath + SplitIndexExt
+	sink.output = indexPath
+	sink.commit = func() error {
+		sink.chunks = len(chunks.chunks)
+		return writeSplitIndex(indexPath, chunks.index())
+	}
+	sink.discard = chunks.Remove
+	return sink, nil
+}
+
+// openVirtualDiskSink creates a dynamic VHD/VHDX of the given size and
+// writes the image onto it through its attached disk. All-zero blocks are
+// skipped, so they stay unallocated in the container.
+func openVirtualDiskSink(outputPath string, size int64) (*backupSink, error) {
+	partialPath := partialOutputPath(outputPath)
+	vd, err := disk.CreateVirtualDisk(partialPath, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create virtual disk: %w", err)
+	}
+	dev, err := os.OpenFile(vd.PhysicalPath, os.O_WRONLY, 0)
+	if err != nil {
+		vd.Close()
+		os.Remove(partialPath)
+		return nil, fmt.Errorf("failed to open virtual disk: %w", err)
+	}
+
+	return &backupSink{
+		Writer: &sparseWriter{file: dev},
+		output: outputPath,
+		close: func() error {
+			err := dev.Close()
+			if closeErr := vd.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		},
+		commit:  func() error { return finalizeOutput(partialPath, outputPath) },
+		discard: func() { os.Remove(partialPath) },
+		size: func() int64 {
+			if info, err := os.Stat(outputPath); err == nil {
+				return info.Size()
+			}
+			return 0
+		},
+	}, nil
+}
+
+// finalizeOutput renames a completed partial file into place.
+func finalizeOutput(partialPath, outputPath string) error {
+	if err := os.Rename(partialPath, outputPath); err != nil {
+		return fmt.Errorf("failed to finalize output file: %w", err)
+	}
+	return nil
+}
+
+// newCompressor wraps w in the named compressor. Close flushes the
+// compressor but leaves w open.
+func newCompressor(compression string, w io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	case "xz":
+		return xz.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// fsctlSetSparse is FSCTL_SET_SPARSE
+const fsctlSetSparse = 0x000900C4
+
+// sparseWriter writes to a file or disk, seeking over all-zero blocks
+// instead of writing them. Files are marked sparse by newSparseWriter so the
+// holes take no disk space.
+type sparseWriter struct {
+	file *os.File
+	size int64
+}
+
+func newSparseWriter(file *os.File) *sparseWriter {
+	// Best effort: without the flag the holes are simply zero-filled
+	var bytesReturned uint32
+	_ = windows.DeviceIoControl(windows.Handle(file.Fd()), fsctlSetSparse,
+		nil, 0, nil, 0, &bytesReturned, nil)
+	return &sparseWriter{file: file}
+}
+
+func (s *sparseWriter) Write(p []byte) (int, error) {
+	if isZero(p) {
+		if _, err := s.file.Seek(int64(len(p)), io.SeekCurrent); err != nil {
+			return 0, err
+		}
+		s.size += int64(len(p))
+		return len(p), nil
+	}
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// Finish sets the file's length, which a trailing hole doesn't extend.
+func (s *sparseWriter) Finish() error {
+	return s.file.Truncate(s.size)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (b *Backuper) sendProgress(percentage int, bytesRead, totalBytes int64, speed string) {
+	select {
+	case b.progressChan <- Progress{
+		Stage:        StageReading,
+		Percentage:   percentage,
+		BytesWritten: bytesRead,
+		TotalBytes:   totalBytes,
+		Speed:        speed,
+		Status:       StatusInProgress,
+	}:
+	default:
+	}
+}
+
+func (b *Backuper) sendError(errMsg string) {
+	select {
+	case b.progressChan <- Progress{
+		Stage:  "Error",
+		Status: StatusError,
+		Error:  errMsg,
+	}:
+	default:
+	}
+}
+
+func (b *Backuper) sendComplete(totalBytes int64, hash string) {
+	select {
+	case b.progressChan <- Progress{
+		Stage:        StageComplete,
+		Percentage:   100,
+		BytesWritten: totalBytes,
+		TotalBytes:   totalBytes,
+		Status:       StatusComplete,
+		Hash:         hash,
+	}:
+	default:
+	}
+}
@@ -0,0 +1,205 @@
+package flash
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"golang.org/x/sys/windows"
+)
+
+// Values for BackupOptions.Used
+const (
+	BackupUsedPartitions = "partitions" // Only read partitions and the partition table
+	BackupUsedClusters   = "clusters"   // Also skip free clusters of FAT/exFAT/NTFS volumes
+)
+
+// gptTailSize is read from the end of GPT disks to keep the backup header.
+const gptTailSize = 1 << 20
+
+// extent is a byte range of the disk that is read into the image.
+type extent struct {
+	offset, length int64
+}
+
+// backupPlan describes which parts of a disk a backup reads. Everything in
+// [0, size) outside extents is written to the image as zeros.
+type backupPlan struct {
+	diskSize int64
+	size     int64
+	extents  []extent
+	warnings []string
+}
+
+// gaps returns the parts of the image the plan doesn't read.
+func (p *backupPlan) gaps() []extent {
+	var result []extent
+	var position int64
+	for _, e := range append(p.extents, extent{p.size, 0}) {
+		if e.offset > position {
+			result = append(result, extent{position, e.offset - position})
+		}
+		position = e.offset + e.length
+	}
+	return result
+}
+
+// readBytes returns the number of bytes the plan reads from the disk.
+func (p *backupPlan) readBytes() int64 {
+	var n int64
+	for _, e := range p.extents {
+		n += e.length
+	}
+	return n
+}
+
+// isContainer reports whether an MBR partition type is an extended
+// partition, which holds logical partitions rather than a filesystem.
+func isContainer(partType byte) bool {
+	return partType == 0x05 || partType == 0x0F || partType == 0x85
+}
+
+// planBackup decides what to read from the disk. With used empty the whole
+// disk is read. Otherwise only the area before the first partition, the
+// partitions themselves, the EBRs of extended partitions and (on GPT) the
+// backup header at the end are read; MBR images end with the last
+// partition. With BackupUsedClusters, partitions holding a mounted volume
+// are further reduced to their allocated clusters. Must run while the
+// volumes are still mounted.
+func planBackup(handle windows.Handle, diskNumber int, diskSize int64, used string) (*backupPlan, error) {
+	plan := &backupPlan{diskSize: diskSize, size: diskSize}
+	if used == "" {
+		plan.extents = []extent{{0, diskSize}}
+		return plan, nil
+	}
+
+	layout, err := disk.GetDriveLayout(handle)
+	if err != nil {
+		return nil, err
+	}
+	var data, containers []disk.PartitionInfo
+	for _, p := range layout.Partitions {
+		if layout.PartitionStyle == disk.PARTITION_STYLE_MBR && isContainer(p.PartitionType) {
+			containers = append(containers, p)
+		} else {
+			data = append(data, p)
+		}
+	}
+	if len(data) == 0 {
+		plan.warnings = append(plan.warnings, "no partitions found; reading the whole disk")
+		plan.extents = []extent{{0, diskSize}}
+		return plan, nil
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].StartingOffset < data[j].StartingOffset })
+
+	var extents []extent
+	var end int64
+	for _, p := range data {
+		end = max(end, p.StartingOffset+p.Length)
+	}
+	extents = append(extents, extent{0, data[0].StartingOffset})
+
+	// The EBR chain lives in the parts of an extended partition that no
+	// logical partition covers
+	for _, c := range containers {
+		extents = append(extents, uncovered(extent{c.StartingOffset, c.Length}, data)...)
+		end = max(end, c.StartingOffset+c.Length)
+	}
+
+	for _, p := range data {
+		if used != BackupUsedClusters {
+			extents = append(extents, extent{p.StartingOffset, p.Length})
+			continue
+		}
+		clusters, err := clusterExtents(diskNumber, p)
+		if err != nil {
+			plan.warnings = append(plan.warnings,
+				fmt.Sprintf("partition %d: %v; reading it in full", p.PartitionNumber, err))
+			extents = append(extents, extent{p.StartingOffset, p.Length})
+			continue
+		}
+		extents = append(extents, clusters...)
+	}
+
+	if layout.PartitionStyle == disk.PARTITION_STYLE_GPT {
+		tail := max(diskSize-gptTailSize, end)
+		extents = append(extents, extent{tail, diskSize - tail})
+		end = diskSize
+	}
+
+	plan.size = end
+	plan.extents = mergeExtents(extents)
+	return plan, nil
+}
+
+// clusterExtents returns the parts of a partition its filesystem uses:
+// everything before cluster 0 (boot sector, FATs), the allocated clusters,
+// and anything after the last cluster (e.g. the NTFS backup boot sector).
+func clusterExtents(diskNumber int, p disk.PartitionInfo) ([]extent, error) {
+	volume, err := disk.FindVolumeByPartition(diskNumber, p.StartingOffset)
+	if err != nil {
+		return nil, err
+	}
+	bitmap, err := disk.GetVolumeBitmap(volume)
+	if err != nil {
+		return nil, err
+	}
+
+	dataStart := p.StartingOffset + bitmap.DataOffset
+	extents := []extent{{p.StartingOffset, bitmap.DataOffset}}
+	for c := int64(0); c < bitmap.Clusters; c++ {
+		if !bitmap.Allocated(c) {
+			continue
+		}
+		start := c
+		for c+1 < bitmap.Clusters && bitmap.Allocated(c+1) {
+			c++
+		}
+		extents = append(extents, extent{dataStart + start*bitmap.ClusterSize, (c - start + 1) * bitmap.ClusterSize})
+	}
+	if clustersEnd := dataStart + bitmap.Clusters*bitmap.ClusterSize; clustersEnd < p.StartingOffset+p.Length {
+		extents = append(extents, extent{clustersEnd, p.StartingOffset + p.Length - clustersEnd})
+	}
+	return extents, nil
+}
+
+// uncovered returns the parts of r not covered by any partition in parts,
+// which must be sorted by offset.
+func uncovered(r extent, parts []disk.PartitionInfo) []extent {
+	var result []extent
+	cursor := r.offset
+	rEnd := r.offset + r.length
+	for _, p := range parts {
+		pEnd := p.StartingOffset + p.Length
+		if pEnd <= cursor || p.StartingOffset >= rEnd {
+			continue
+		}
+		if p.StartingOffset > cursor {
+			result = append(result, extent{cursor, p.StartingOffset - cursor})
+		}
+		cursor = max(cursor, pEnd)
+	}
+	if cursor < rEnd {
+		result = append(result, extent{cursor, rEnd - cursor})
+	}
+	return result
+}
+
+// mergeExtents sorts extents and merges overlapping or adjacent ones,
+// dropping empty ranges.
+func mergeExtents(extents []extent) []extent {
+	sort.Slice(extents, func(i, j int) bool { return extents[i].offset < extents[j].offset })
+	var merged []extent
+	for _, e := range extents {
+		if e.length <= 0 {
+			continue
+		}
+		if n := len(merged); n > 0 && e.offset <= merged[n-1].offset+merged[n-1].length {
+			last := &merged[n-1]
+			last.length = max(last.length, e.offset+e.length-last.offset)
+			continue
+		}
+		merged = append(merged, e)
+	}
+	return merged
+}
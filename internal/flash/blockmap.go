@@ -0,0 +1,176 @@
+package flash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// BlockMapExt is the conventional extension of block map files.
+const BlockMapExt = ".wusbmap"
+
+// blockMapBlockSize is the granularity of a block map. Flash buffers are
+// whole megabytes, so every buffer but the last covers whole blocks.
+const blockMapBlockSize = 1 << 20
+
+// BlockMap records a hash of every block of a drive's contents as last
+// written by flash or read by backup. A later flash with the same map only
+// writes the blocks whose hash changed, without reading the drive.
+//
+// The map is only valid as long as nothing else writes to the drive; the
+// flasher deletes it before writing and saves it again once the flash has
+// succeeded.
+type BlockMap struct {
+	Version   int       `json:"version"`
+	DiskSize  int64     `json:"diskSize"`
+	Serial    string    `json:"serial,omitempty"`
+	BlockSize int64     `json:"blockSize"`
+	Updated   time.Time `json:"updated"`
+	// Blocks holds the hex SHA-256 of each block from the start of the
+	// disk. "" marks a block whose contents are unknown; blocks past the
+	// end are unknown too.
+	Blocks []string `json:"blocks"`
+}
+
+const blockMapVersion = 1
+
+func newBlockMap(diskSize int64, serial string) *BlockMap {
+	return &BlockMap{
+		Version:   blockMapVersion,
+		DiskSize:  diskSize,
+		Serial:    serial,
+		BlockSize: blockMapBlockSize,
+	}
+}
+
+// LoadBlockMap reads a block map file. Errors wrap fs.ErrNotExist if the
+// file doesn't exist.
+func LoadBlockMap(path string) (*BlockMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m BlockMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid block map %s: %w", path, err)
+	}
+	if m.Version != blockMapVersion || m.BlockSize != blockMapBlockSize {
+		return nil, fmt.Errorf("unsupported block map %s (version %d, block size %d)", path, m.Version, m.BlockSize)
+	}
+	return &m, nil
+}
+
+// Matches reports whether the map was made for a drive of this size and
+// serial number.
+func (m *BlockMap) Matches(diskSize int64, serial string) bool {
+	return m.DiskSize == diskSize && m.Serial == serial
+}
+
+// Save writes the map atomically.
+func (m *BlockMap) Save(path string) error {
+	m.Updated = time.Now().UTC()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".partial"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write block map: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write block map: %w", err)
+	}
+	return nil
+}
+
+// update records the hash of block i and reports whether it differs from
+// what the map held before (unknown blocks always differ).
+func (m *BlockMap) update(i int, data []byte) bool {
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	for len(m.Blocks) <= i {
+		m.Blocks = append(m.Blocks, "")
+	}
+	changed := m.Blocks[i] != digest
+	m.Blocks[i] = digest
+	return changed
+}
+
+// updateBuffer records the blocks of data, written at offset (a multiple
+// of the block size), and returns the ranges of data whose blocks changed.
+// Adjacent blocks are merged and a range ending the data is extended to
+// writeSize, the aligned size the buffer is written with.
+func (m *BlockMap) updateBuffer(offset int64, data []byte, writeSize int) []extent {
+	var changed []extent
+	blockSize := int(m.BlockSize)
+	first := int(offset / m.BlockSize)
+	for start := 0; start < len(data); start += blockSize {
+		end := min(start+blockSize, len(data))
+		if !m.update(first+start/blockSize, data[start:end]) {
+			continue
+		}
+		if end == len(data) {
+			end = writeSize
+		}
+		if k := len(changed); k > 0 && changed[k-1].offset+changed[k-1].length == int64(start) {
+			changed[k-1].length = int64(end) - changed[k-1].offset
+		} else {
+			changed = append(changed, extent{int64(start), int64(end - start)})
+		}
+	}
+	return changed
+}
+
+// forget marks the blocks overlapping [offset, offset+length) as unknown.
+func (m *BlockMap) forget(offset, length int64) {
+	if length <= 0 {
+		return
+	}
+	first := offset / m.BlockSize
+	last := (offset + length - 1) / m.BlockSize
+	for i := first; i <= last && i < int64(len(m.Blocks)); i++ {
+		m.Blocks[i] = ""
+	}
+}
+
+// blockMapWriter fills a block map from a stream of disk contents starting
+// at offset 0.
+type blockMapWriter struct {
+	m       *BlockMap
+	pending []byte
+	next    int
+}
+
+func (w *blockMapWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if len(w.pending) == 0 && len(p) >= int(w.m.BlockSize) {
+			w.m.update(w.next, p[:w.m.BlockSize])
+			w.next++
+			p = p[w.m.BlockSize:]
+			continue
+		}
+		take := min(len(p), int(w.m.BlockSize)-len(w.pending))
+		w.pending = append(w.pending, p[:take]...)
+		p = p[take:]
+		if len(w.pending) == int(w.m.BlockSize) {
+			w.m.update(w.next, w.pending)
+			w.next++
+			w.pending = w.pending[:0]
+		}
+	}
+	return n, nil
+}
+
+// Flush hashes a trailing partial block.
+func (w *blockMapWriter) Flush() {
+	if len(w.pending) > 0 {
+		w.m.update(w.next, w.pending)
+		w.next++
+		w.pending = w.pending[:0]
+	}
+}
@@ -0,0 +1,252 @@
+package flash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+// sharedSlots is the number of chunks a SharedSource buffers, i.e. how far
+// the fastest drive can get ahead of the slowest one.
+const sharedSlots = 4
+
+// SharedSource reads and decompresses an image once for several flashes.
+// Each chunk read from the image goes into a ring of buffers that every
+// reader copies from, and a slot is only refilled once all readers are past
+// it, so the whole batch writes at the pace of the slowest drive. A reader
+// that is closed early (its flash failed) stops holding the others back.
+type SharedSource struct {
+	src       Source
+	chunkSize int
+	rawHasher hash.Hash    // Checks a URL download against the expected digest
+	expected  ExpectedHash // Digest rawHasher must match
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	slots    [][]byte
+	lens     []int
+	produced int64 // Number of chunks read from src so far
+	err      error // io.EOF once src is exhausted, or why reading it failed
+	readers  []*sharedReader
+	closed   bool
+	stopped  chan struct{}
+}
+
+// sharedReader is one flash's view of a SharedSource.
+type sharedReader struct {
+	s    *SharedSource
+	seq  int64 // Chunk being read
+	off  int   // Bytes of the chunk already returned
+	done bool
+}
+
+// NewSharedSource opens opts.ImagePath for the given number of readers, one
+// per flash. A local image is checked against opts.ExpectedHash before
+// anything is read; a URL is hashed while it streams and, on a mismatch,
+// readers get the error instead of the end of the image, so the flashes
+// fail rather than finish with a bad image.
+func NewSharedSource(ctx context.Context, opts Options, readers int) (*SharedSource, error) {
+	s := &SharedSource{expected: opts.ExpectedHash}
+	sourceOpts := opts.sourceOptions()
+	if opts.ExpectedHash.IsSet() {
+		if IsURL(opts.ImagePath) {
+			s.rawHasher, _ = newHash(opts.ExpectedHash.Algorithm)
+			sourceOpts.RawHash = s.rawHasher
+		} else {
+			digest, err := HashFile(ctx, opts.ImagePath, opts.ExpectedHash.Algorithm, nil)
+			if err != nil {
+				return nil, fmt.Errorf("checksum: %w", err)
+			}
+			if digest != opts.ExpectedHash.Digest {
+				return nil, fmt.Errorf("checksum mismatch: expected %s %s, got %s",
+					opts.ExpectedHash.Algorithm, opts.ExpectedHash.Digest, digest)
+			}
+		}
+	}
+
+	sourceOpts.HTTP.Context = ctx
+	src, err := OpenSourceWithOptions(opts.ImagePath, sourceOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks match the flasher's buffer so each of its reads is one copy
+	s.chunkSize = opts.BufferSize << 20
+	if s.chunkSize <= 0 {
+		s.chunkSize = defaultBufferSize
+	}
+	s.src = src
+	s.cond = sync.NewCond(&s.mu)
+	s.slots = make([][]byte, sharedSlots)
+	for i := range s.slots {
+		s.slots[i] = make([]byte, s.chunkSize)
+	}
+	s.lens = make([]int, sharedSlots)
+	s.readers = make([]*sharedReader, readers)
+	for i := range s.readers {
+		s.readers[i] = &sharedReader{s: s}
+	}
+	s.stopped = make(chan struct{})
+	go s.run()
+	return s, nil
+}
+
+// Reader returns the i-th reader. Each must be closed, by the flash it is
+// passed to or by the caller if that flash never starts.
+func (s *SharedSource) Reader(i int) Source {
+	return s.readers[i]
+}
+
+// Close stops reading the image and releases it.
+func (s *SharedSource) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	<-s.stopped
+	return s.src.Close()
+}
+
+// run fills the ring from the image until it is exhausted, every reader is
+// closed or the source is.
+func (s *SharedSource) run() {
+	defer close(s.stopped)
+	for seq := int64(0); ; seq++ {
+		slot := int(seq % sharedSlots)
+
+		// Wait until every reader has finished with the chunk in this slot
+		s.mu.Lock()
+		for !s.closed && s.active() && s.slowest() <= seq-sharedSlots {
+			s.cond.Wait()
+		}
+		if s.closed || !s.active() {
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		n, err := io.ReadFull(s.src, s.slots[slot])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		if err == io.EOF {
+			err = s.finish()
+		}
+
+		s.mu.Lock()
+		if n > 0 {
+			s.lens[slot] = n
+			s.produced = seq + 1
+		}
+		s.err = err
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// finish is called at the end of the image. It returns io.EOF, or why the
+// download doesn't match the expected digest.
+func (s *SharedSource) finish() error {
+	if s.rawHasher == nil {
+		return io.EOF
+	}
+	// Consume any trailing bytes the decoder didn't need so the digest
+	// covers the whole file
+	if d, ok := s.src.(rawDrainer); ok {
+		if err := d.drainRaw(); err != nil {
+			return fmt.Errorf("checksum: %w", err)
+		}
+	}
+	if digest := fmt.Sprintf("%x", s.rawHasher.Sum(nil)); digest != s.expected.Digest {
+		return fmt.Errorf("checksum mismatch: expected %s %s, got %s",
+			s.expected.Algorithm, s.expected.Digest, digest)
+	}
+	return io.EOF
+}
+
+// active reports whether any reader is still open. Callers hold s.mu.
+func (s *SharedSource) active() bool {
+	for _, r := range s.readers {
+		if !r.done {
+			return true
+		}
+	}
+	return false
+}
+
+// slowest returns the chunk the furthest-behind open reader is on. Callers
+// hold s.mu.
+func (s *SharedSource) slowest() int64 {
+	slowest := s.produced
+	for _, r := range s.readers {
+		if !r.done && r.seq < slowest {
+			slowest = r.seq
+		}
+	}
+	return slowest
+}
+
+func (r *sharedReader) Size() int64  { return r.s.src.Size() }
+func (r *sharedReader) Name() string { return r.s.src.Name() }
+
+func (r *sharedReader) Read(p []byte) (int, error) {
+	s := r.s
+	s.mu.Lock()
+	for r.seq >= s.produced && s.err == nil && !s.closed && !r.done {
+		s.cond.Wait()
+	}
+	if r.done {
+		// Closed by the batch while this flash was still reading
+		s.mu.Unlock()
+		return 0, errors.New("read from closed shared source")
+	}
+	if r.seq >= s.produced {
+		err := s.err
+		if err == nil {
+			err = errors.New("shared source closed")
+		}
+		s.mu.Unlock()
+		return 0, err
+	}
+	slot := int(r.seq % sharedSlots)
+	chunk := s.slots[slot][r.off:s.lens[slot]]
+	s.mu.Unlock()
+
+	// The slot isn't refilled until this reader moves past it
+	n := copy(p, chunk)
+
+	s.mu.Lock()
+	r.off += n
+	if r.off == s.lens[slot] {
+		r.seq++
+		r.off = 0
+		s.cond.Broadcast()
+	}
+	s.mu.Unlock()
+	return n, nil
+}
+
+// CompressedProgress reports how far the shared decompressor has got, which
+// is at most a few chunks ahead of this reader.
+func (r *sharedReader) CompressedProgress() (consumed, total int64) {
+	if cp, ok := r.s.src.(CompressedProgress); ok {
+		return cp.CompressedProgress()
+	}
+	return 0, 0
+}
+
+// Close releases the reader so the others no longer wait for it.
+func (r *sharedReader) Close() error {
+	s := r.s
+	s.mu.Lock()
+	r.done = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,303 @@
+package flash
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// BurninOptions configures a burn-in test.
+type BurninOptions struct {
+	DiskNumber     int
+	DriveLetter    string        // Optional: cached drive letter to avoid WMI lookup
+	Duration       time.Duration // How long to keep cycling (0 = one cycle)
+	StatusInterval time.Duration // Time between status updates (default: 100ms)
+	BufferSize     int           // Buffer size in MB (default: 4)
+}
+
+// BurninCycle summarizes one write/verify cycle over the whole drive.
+type BurninCycle struct {
+	Cycle            int     `json:"cycle"`
+	BytesWritten     int64   `json:"bytesWritten"`
+	BytesVerified    int64   `json:"bytesVerified"`
+	WriteBytesPerSec float64 `json:"writeBytesPerSec"`
+	ReadBytesPerSec  float64 `json:"readBytesPerSec"`
+	WriteErrors      int     `json:"writeErrors"`
+	ReadErrors       int     `json:"readErrors"`
+	BadBytes         int64   `json:"badBytes"`          // Bytes that read back wrong
+	Partial          bool    `json:"partial,omitempty"` // Cut short by the end of the test
+}
+
+// BurninProgress is a status update for a burn-in test. The error counts
+// are totals over all cycles so far; Finished is set on the update that
+// closes a cycle.
+type BurninProgress struct {
+	Cycle       int          `json:"cycle,omitempty"`
+	Elapsed     string       `json:"elapsed,omitempty"`
+	WriteErrors int          `json:"writeErrors"`
+	ReadErrors  int          `json:"readErrors"`
+	BadBytes    int64        `json:"badBytes"`
+	Finished    *BurninCycle `json:"finished,omitempty"`
+	Progress
+}
+
+// BurninResult describes a finished burn-in test.
+type BurninResult struct {
+	DiskNumber        int           `json:"diskNumber"`
+	Size              int64         `json:"size"`
+	Cycles            []BurninCycle `json:"cycles"`
+	TotalBytesWritten int64         `json:"totalBytesWritten"`
+	WriteErrors       int           `json:"writeErrors"`
+	ReadErrors        int           `json:"readErrors"`
+	BadBytes          int64         `json:"badBytes"`
+	// Percent change in speed from the first to the last full cycle, e.g.
+	// -20 when the drive got a fifth slower. Needs two full cycles.
+	WriteSpeedChange float64 `json:"writeSpeedChange,omitempty"`
+	ReadSpeedChange  float64 `json:"readSpeedChange,omitempty"`
+	Passed           bool    `json:"passed"`
+	Duration         string  `json:"duration"`
+}
+
+// BurninTester stress-tests drives with repeated write/verify cycles.
+type BurninTester struct {
+	progressChan chan BurninProgress
+	start        time.Time
+	interval     time.Duration
+	result       *BurninResult
+}
+
+// NewBurninTester creates a new burn-in tester
+func NewBurninTester() *BurninTester {
+	return &BurninTester{
+		progressChan: make(chan BurninProgress, 10),
+	}
+}
+
+// Progress returns a channel that receives progress updates
+func (t *BurninTester) Progress() <-chan BurninProgress {
+	return t.progressChan
+}
+
+// Run fills the drive with fresh pseudorandom data and reads it back, over
+// and over until Duration has passed; the cycle running at that point is
+// cut short and reported as partial. Errors are counted rather than
+// aborting the test, so a degrading drive is tracked to the end. All data
+// on the drive is destroyed.
+func (t *BurninTester) Run(ctx context.Context, opts BurninOptions) (*BurninResult, error) {
+	defer close(t.progressChan)
+	t.start = time.Now()
+	t.interval = opts.StatusInterval
+	if t.interval <= 0 {
+		t.interval = progressUpdateInterval
+	}
+
+	var writer *diskWriter
+	if opts.DriveLetter != "" {
+		writer = newDiskWriterWithDriveLetter(opts.DiskNumber, opts.DriveLetter)
+	} else {
+		writer = newDiskWriter(opts.DiskNumber)
+	}
+	if err := writer.Open(); err != nil {
+		t.sendError(err.Error())
+		return nil, err
+	}
+	defer writer.Close()
+
+	geo, err := disk.GetDiskGeometry(writer.handle)
+	if err != nil {
+		t.sendError(err.Error())
+		return nil, err
+	}
+	size := geo.DiskSize
+
+	bufSize := opts.BufferSize << 20
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+	buf := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, buf)
+	expected := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, expected)
+
+	t.result = &BurninResult{DiskNumber: opts.DiskNumber, Size: size}
+	var deadline time.Time
+	if opts.Duration > 0 {
+		deadline = t.start.Add(opts.Duration)
+	}
+
+	for cycle := 1; ; cycle++ {
+		c, err := t.cycle(ctx, writer, cycle, size, buf, expected, deadline)
+		if err != nil {
+			t.sendError(err.Error())
+			return nil, err
+		}
+		t.result.Cycles = append(t.result.Cycles, *c)
+		t.sendProgress(StageVerifying, cycle, 100, c.BytesVerified, size, "", c)
+		if c.Partial || deadline.IsZero() || !time.Now().Before(deadline) {
+			break
+		}
+	}
+
+	result := t.result
+	var full []BurninCycle
+	for _, c := range result.Cycles {
+		if !c.Partial {
+			full = append(full, c)
+		}
+	}
+	if len(full) >= 2 {
+		first, last := full[0], full[len(full)-1]
+		result.WriteSpeedChange = percentChange(first.WriteBytesPerSec, last.WriteBytesPerSec)
+		result.ReadSpeedChange = percentChange(first.ReadBytesPerSec, last.ReadBytesPerSec)
+	}
+	result.Passed = result.WriteErrors == 0 && result.ReadErrors == 0 && result.BadBytes == 0
+
+	// The partition table was overwritten; let Windows forget the old volumes
+	disk.UpdateDiskProperties(writer.handle)
+
+	result.Duration = time.Since(t.start).Round(time.Millisecond).String()
+	t.sendComplete(result.TotalBytesWritten)
+	return result, nil
+}
+
+// errBurninExpired stops a cycle's pass over the drive once the test's
+// duration is up.
+var errBurninExpired = errors.New("burn-in duration expired")
+
+// cycle writes the drive with a new pattern and reads it back, stopping
+// early (and marking the cycle partial) once deadline passes.
+func (t *BurninTester) cycle(ctx context.Context, writer *diskWriter, cycle int, size int64, buf, expected []byte, deadline time.Time) (*BurninCycle, error) {
+	c := &BurninCycle{Cycle: cycle}
+	pattern := newCapacityPattern()
+	expired := func(now time.Time) bool {
+		return !deadline.IsZero() && !now.Before(deadline)
+	}
+
+	fill := pattern.source()
+	phaseStart := time.Now()
+	err := forEachDiskChunk(ctx, size, len(buf), t.interval, func(offset int64, n int) error {
+		fill(buf[:n], offset)
+		if _, err := writeWithRetry(writer, buf[:n], offset); err != nil {
+			c.WriteErrors++
+			t.result.WriteErrors++
+		}
+		c.BytesWritten = offset + int64(n)
+		t.result.TotalBytesWritten += int64(n)
+
+		now := time.Now()
+		c.WriteBytesPerSec = bytesPerSec(c.BytesWritten, phaseStart, now)
+		if expired(now) {
+			return errBurninExpired
+		}
+		return nil
+	}, func(done int64) {
+		t.sendProgress(StageWriting, cycle, progressPercent(done, size), done, size, formatSpeed(c.WriteBytesPerSec), nil)
+	})
+	if err == errBurninExpired {
+		c.Partial = true
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fill = pattern.source()
+	phaseStart = time.Now()
+	err = forEachDiskChunk(ctx, size, len(buf), t.interval, func(offset int64, n int) error {
+		fill(expected[:n], offset)
+		var good int64
+		if _, err := writer.ReadAt(buf[:n], offset); err != nil {
+			c.ReadErrors++
+			t.result.ReadErrors++
+		} else {
+			good, _ = pattern.classify(expected[:n], buf[:n], offset, size)
+		}
+		c.BadBytes += int64(n) - good
+		t.result.BadBytes += int64(n) - good
+		c.BytesVerified = offset + int64(n)
+
+		now := time.Now()
+		c.ReadBytesPerSec = bytesPerSec(c.BytesVerified, phaseStart, now)
+		if expired(now) {
+			return errBurninExpired
+		}
+		return nil
+	}, func(done int64) {
+		t.sendProgress(StageVerifying, cycle, progressPercent(done, size), done, size, formatSpeed(c.ReadBytesPerSec), nil)
+	})
+	if err == errBurninExpired {
+		c.Partial = true
+	} else if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// percentChange is the change from a to b in percent of a.
+func percentChange(a, b float64) float64 {
+	if a <= 0 {
+		return 0
+	}
+	return (b - a) / a * 100
+}
+
+func (t *BurninTester) sendProgress(stage string, cycle, percentage int, done, totalBytes int64, speed string, finished *BurninCycle) {
+	update := BurninProgress{
+		Cycle:       cycle,
+		Elapsed:     time.Since(t.start).Round(time.Second).String(),
+		WriteErrors: t.result.WriteErrors,
+		ReadErrors:  t.result.ReadErrors,
+		BadBytes:    t.result.BadBytes,
+		Finished:    finished,
+		Progress: Progress{
+			Stage:        stage,
+			Percentage:   percentage,
+			BytesWritten: done,
+			TotalBytes:   totalBytes,
+			Speed:        speed,
+			Status:       StatusInProgress,
+		},
+	}
+	if finished != nil {
+		// Cycle summaries are what test rigs log, so they are never dropped
+		t.progressChan <- update
+		return
+	}
+	select {
+	case t.progressChan <- update:
+	default:
+	}
+}
+
+func (t *BurninTester) sendError(errMsg string) {
+	select {
+	case t.progressChan <- BurninProgress{Progress: Progress{
+		Stage:  "Error",
+		Status: StatusError,
+		Error:  errMsg,
+	}}:
+	default:
+	}
+}
+
+func (t *BurninTester) sendComplete(written int64) {
+	select {
+	case t.progressChan <- BurninProgress{
+		Cycle:       len(t.result.Cycles),
+		Elapsed:     time.Since(t.start).Round(time.Second).String(),
+		WriteErrors: t.result.WriteErrors,
+		ReadErrors:  t.result.ReadErrors,
+		BadBytes:    t.result.BadBytes,
+		Progress: Progress{
+			Stage:        StageComplete,
+			Percentage:   100,
+			BytesWritten: written,
+			TotalBytes:   written,
+			Status:       StatusComplete,
+		},
+	}:
+	default:
+	}
+}
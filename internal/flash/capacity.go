@@ -0,0 +1,262 @@
+package flash
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// capacityBlock is the unit the capacity test stamps and checks. Every
+// sector size is a multiple of it.
+const capacityBlock = 512
+
+// CapacityOptions configures a capacity test.
+type CapacityOptions struct {
+	DiskNumber  int
+	DriveLetter string // Optional: cached drive letter to avoid WMI lookup
+	BufferSize  int    // Buffer size in MB (default: 4)
+}
+
+// CapacityResult reports how much of a drive's advertised capacity holds
+// data. Counterfeit drives typically pass up to their real size and then
+// return garbage, or wrap around and overwrite the start of the drive.
+type CapacityResult struct {
+	DiskNumber       int    `json:"diskNumber"`
+	AdvertisedSize   int64  `json:"advertisedSize"`
+	UsableSize       int64  `json:"usableSize"` // Bytes from the start up to the first bad block
+	GoodBytes        int64  `json:"goodBytes"`
+	CorruptedBytes   int64  `json:"corruptedBytes"`   // Blocks that read back as something else
+	OverwrittenBytes int64  `json:"overwrittenBytes"` // Blocks holding data written to another offset
+	WriteErrors      int    `json:"writeErrors,omitempty"`
+	ReadErrors       int    `json:"readErrors,omitempty"`
+	Passed           bool   `json:"passed"`
+	Duration         string `json:"duration"`
+}
+
+// capacityPattern generates the test data: a pseudorandom stream with each
+// block stamped with its own offset, so a block found at the wrong offset
+// can be told apart from one that was simply corrupted.
+type capacityPattern struct {
+	seed [32]byte
+	key  uint64 // XORed into the stamps so leftovers from other runs don't match
+}
+
+func newCapacityPattern() *capacityPattern {
+	p := &capacityPattern{}
+	crand.Read(p.seed[:])
+	p.key = binary.LittleEndian.Uint64(p.seed[:8]) ^ binary.LittleEndian.Uint64(p.seed[24:])
+	return p
+}
+
+// source returns a function that fills buffers with the pattern for the
+// given drive offset. Buffers must be requested in order from offset 0.
+func (p *capacityPattern) source() func(buf []byte, offset int64) {
+	stream := rand.NewChaCha8(p.seed)
+	return func(buf []byte, offset int64) {
+		stream.Read(buf)
+		for i := 0; i+capacityBlock <= len(buf); i += capacityBlock {
+			binary.LittleEndian.PutUint64(buf[i:], uint64(offset+int64(i))^p.key)
+		}
+	}
+}
+
+// classify compares a buffer read back at offset with the expected data
+// and returns how many bytes are good and how many hold blocks stamped for
+// another offset. The rest are corrupted.
+func (p *capacityPattern) classify(expected, actual []byte, offset, size int64) (good, overwritten int64) {
+	if bytes.Equal(expected, actual) {
+		return int64(len(actual)), 0
+	}
+	for i := 0; i+capacityBlock <= len(actual); i += capacityBlock {
+		if bytes.Equal(expected[i:i+capacityBlock], actual[i:i+capacityBlock]) {
+			good += capacityBlock
+			continue
+		}
+		stamp := int64(binary.LittleEndian.Uint64(actual[i:]) ^ p.key)
+		if stamp != offset+int64(i) && stamp >= 0 && stamp < size && stamp%capacityBlock == 0 {
+			overwritten += capacityBlock
+		}
+	}
+	return good, overwritten
+}
+
+// CapacityTester checks drives for fake capacity.
+type CapacityTester struct {
+	progressChan chan Progress
+}
+
+// NewCapacityTester creates a new capacity tester
+func NewCapacityTester() *CapacityTester {
+	return &CapacityTester{
+		progressChan: make(chan Progress, 10),
+	}
+}
+
+// Progress returns a channel that receives progress updates
+func (t *CapacityTester) Progress() <-chan Progress {
+	return t.progressChan
+}
+
+// Test fills the whole drive with stamped pseudorandom data, then reads it
+// all back and classifies every block. Write and read errors are counted
+// rather than aborting the test, since fake drives often fail past their
+// real size. All data on the drive is destroyed.
+func (t *CapacityTester) Test(ctx context.Context, opts CapacityOptions) (*CapacityResult, error) {
+	defer close(t.progressChan)
+	start := time.Now()
+
+	var writer *diskWriter
+	if opts.DriveLetter != "" {
+		writer = newDiskWriterWithDriveLetter(opts.DiskNumber, opts.DriveLetter)
+	} else {
+		writer = newDiskWriter(opts.DiskNumber)
+	}
+	if err := writer.Open(); err != nil {
+		t.sendError(err.Error())
+		return nil, err
+	}
+	defer writer.Close()
+
+	geo, err := disk.GetDiskGeometry(writer.handle)
+	if err != nil {
+		t.sendError(err.Error())
+		return nil, err
+	}
+	size := geo.DiskSize
+
+	bufSize := opts.BufferSize << 20
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+	buf := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, buf)
+	expected := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, expected)
+
+	result := &CapacityResult{
+		DiskNumber:     opts.DiskNumber,
+		AdvertisedSize: size,
+		UsableSize:     -1,
+	}
+	pattern := newCapacityPattern()
+
+	// Fill the drive
+	fill := pattern.source()
+	phaseStart := time.Now()
+	t.sendProgress(StageWriting, 0, 0, size, "")
+	err = forEachDiskChunk(ctx, size, bufSize, progressUpdateInterval, func(offset int64, n int) error {
+		fill(buf[:n], offset)
+		if _, err := writeWithRetry(writer, buf[:n], offset); err != nil {
+			result.WriteErrors++
+		}
+		return nil
+	}, func(done int64) {
+		t.sendProgress(StageWriting, progressPercent(done, size), done, size, phaseSpeed(done, phaseStart, time.Now()))
+	})
+	if err != nil {
+		t.sendError("capacity test cancelled")
+		return nil, err
+	}
+
+	// Read it back
+	fill = pattern.source()
+	phaseStart = time.Now()
+	t.sendProgress(StageVerifying, 0, 0, size, "")
+	err = forEachDiskChunk(ctx, size, bufSize, progressUpdateInterval, func(offset int64, n int) error {
+		fill(expected[:n], offset)
+		var good, overwritten int64
+		badAt := offset
+		if _, err := writer.ReadAt(buf[:n], offset); err != nil {
+			result.ReadErrors++
+		} else {
+			good, overwritten = pattern.classify(expected[:n], buf[:n], offset, size)
+			badAt += int64(firstDifference(expected[:n], buf[:n]) / capacityBlock * capacityBlock)
+		}
+		result.GoodBytes += good
+		result.OverwrittenBytes += overwritten
+		result.CorruptedBytes += int64(n) - good - overwritten
+		if result.UsableSize < 0 && good < int64(n) {
+			result.UsableSize = badAt
+		}
+		return nil
+	}, func(done int64) {
+		t.sendProgress(StageVerifying, progressPercent(done, size), done, size, phaseSpeed(done, phaseStart, time.Now()))
+	})
+	if err != nil {
+		t.sendError("capacity test cancelled")
+		return nil, err
+	}
+
+	if result.UsableSize < 0 {
+		result.UsableSize = size
+	}
+	result.Passed = result.GoodBytes == size
+
+	// The partition table was overwritten; let Windows forget the old volumes
+	disk.UpdateDiskProperties(writer.handle)
+
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	t.sendComplete(size)
+	return result, nil
+}
+
+// phaseSpeed formats the average speed of a phase that has processed done
+// bytes since start.
+func phaseSpeed(done int64, start, now time.Time) string {
+	if rate := bytesPerSec(done, start, now); rate > 0 {
+		return formatSpeed(rate)
+	}
+	return ""
+}
+
+// bytesPerSec is the average rate of a phase that has processed done bytes
+// since start.
+func bytesPerSec(done int64, start, now time.Time) float64 {
+	if elapsed := now.Sub(start).Seconds(); elapsed > 0 {
+		return float64(done) / elapsed
+	}
+	return 0
+}
+
+func (t *CapacityTester) sendProgress(stage string, percentage int, done, totalBytes int64, speed string) {
+	select {
+	case t.progressChan <- Progress{
+		Stage:        stage,
+		Percentage:   percentage,
+		BytesWritten: done,
+		TotalBytes:   totalBytes,
+		Speed:        speed,
+		Status:       StatusInProgress,
+	}:
+	default:
+	}
+}
+
+func (t *CapacityTester) sendError(errMsg string) {
+	select {
+	case t.progressChan <- Progress{
+		Stage:  "Error",
+		Status: StatusError,
+		Error:  errMsg,
+	}:
+	default:
+	}
+}
+
+func (t *CapacityTester) sendComplete(size int64) {
+	select {
+	case t.progressChan <- Progress{
+		Stage:        StageComplete,
+		Percentage:   100,
+		BytesWritten: size,
+		TotalBytes:   size,
+		Status:       StatusComplete,
+	}:
+	default:
+	}
+}
@@ -0,0 +1,274 @@
+package flash
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/blake3"
+)
+
+// ExpectedHash is a digest the image file must match before it is trusted.
+// The zero value means no checksum verification is requested.
+type ExpectedHash struct {
+	Algorithm string // md5, sha1, sha256, sha512, blake3 or xxhash
+	Digest    string // Lowercase hex digest
+}
+
+// IsSet reports whether a digest has been provided.
+func (e ExpectedHash) IsSet() bool {
+	return e.Digest != ""
+}
+
+func (e ExpectedHash) String() string {
+	return e.Algorithm + ":" + e.Digest
+}
+
+// ParseExpectedHash parses a digest given as "algo:hex" or bare hex.
+// For bare hex the algorithm is inferred from the digest length.
+func ParseExpectedHash(s string) (ExpectedHash, error) {
+	s = strings.TrimSpace(s)
+	algo := ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		algo = strings.ToLower(s[:i])
+		s = s[i+1:]
+	}
+	return newExpectedHash(algo, s)
+}
+
+// newExpectedHash validates a hex digest and resolves its algorithm.
+// An empty algo is inferred from the digest length.
+func newExpectedHash(algo, digest string) (ExpectedHash, error) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if _, err := hex.DecodeString(digest); err != nil || digest == "" {
+		return ExpectedHash{}, fmt.Errorf("invalid hash %q: expected a hex digest", digest)
+	}
+
+	if algo == "" {
+		switch len(digest) {
+		case 32:
+			algo = "md5"
+		case 40:
+			algo = "sha1"
+		case 64:
+			algo = "sha256"
+		case 128:
+			algo = "sha512"
+		case 16:
+			algo = "xxhash"
+		default:
+			return ExpectedHash{}, fmt.Errorf("cannot infer hash algorithm from %d-character digest", len(digest))
+		}
+	}
+
+	h, err := newHash(algo)
+	if err != nil {
+		return ExpectedHash{}, err
+	}
+	if len(digest) != h.Size()*2 {
+		return ExpectedHash{}, fmt.Errorf("invalid %s digest: expected %d hex characters, got %d",
+			algo, h.Size()*2, len(digest))
+	}
+
+	return ExpectedHash{Algorithm: algo, Digest: digest}, nil
+}
+
+// newHash returns a hash.Hash for the named algorithm.
+func newHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "blake3":
+		return blake3.New(), nil
+	case "xxhash":
+		// 64-bit XXH64, much faster than the cryptographic hashes but only
+		// fit for catching accidental corruption
+		return xxhash.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", algo)
+	}
+}
+
+// LoadChecksumFile reads the expected digest for imagePath from a checksum
+// sidecar. Supported layouts are single-digest files (image.img.sha256),
+// GNU coreutils lists ("<digest>  <name>", as in SHA256SUMS) and BSD tags
+// ("SHA256 (<name>) = <digest>"). Both the sidecar and the image may be URLs;
+// a sidecar URL is fetched with the same credentials and proxy as the image.
+func LoadChecksumFile(sidecar, imagePath string, httpOpts HTTPOptions) (ExpectedHash, error) {
+	var r io.ReadCloser
+	if IsURL(sidecar) {
+		resp, err := httpOpts.get(sidecar)
+		if err != nil {
+			return ExpectedHash{}, fmt.Errorf("failed to fetch checksum file: %w", err)
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return ExpectedHash{}, fmt.Errorf("failed to fetch checksum file: server returned %s", resp.Status)
+		}
+		r = resp.Body
+	} else {
+		file, err := os.Open(sidecar)
+		if err != nil {
+			return ExpectedHash{}, fmt.Errorf("failed to open checksum file: %w", err)
+		}
+		r = file
+	}
+	defer r.Close()
+
+	algo := checksumAlgoFromName(sidecar)
+	imageName := checksumImageName(imagePath)
+
+	var digests []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// BSD tag format: SHA256 (name) = digest
+		if open := strings.Index(line, " ("); open > 0 {
+			if closeIdx := strings.LastIndex(line, ") = "); closeIdx > open {
+				name := line[open+2 : closeIdx]
+				if strings.EqualFold(path.Base(filepath.ToSlash(name)), imageName) {
+					return newExpectedHash(strings.ReplaceAll(strings.ToLower(line[:open]), "-", ""), line[closeIdx+4:])
+				}
+				continue
+			}
+		}
+
+		// GNU format: digest, whitespace, optional '*' (binary mode), name
+		fields := strings.Fields(line)
+		if len(fields) == 1 {
+			digests = append(digests, fields[0])
+			continue
+		}
+		name := strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		if strings.EqualFold(path.Base(filepath.ToSlash(name)), imageName) {
+			return newExpectedHash(algo, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ExpectedHash{}, fmt.Errorf("failed to read checksum file: %w", err)
+	}
+
+	// A sidecar containing just a digest applies to the image it sits next to
+	if len(digests) == 1 {
+		return newExpectedHash(algo, digests[0])
+	}
+
+	return ExpectedHash{}, fmt.Errorf("no checksum for %s found in %s", imageName, sidecar)
+}
+
+// checksumAlgoFromName infers the hash algorithm from a sidecar file name
+// (e.g. image.img.sha256, SHA256SUMS, MD5SUMS, image.img.blake3). Returns
+// "" if unknown.
+func checksumAlgoFromName(name string) string {
+	base := strings.ToLower(path.Base(filepath.ToSlash(name)))
+	for _, algo := range []string{"sha512", "sha256", "sha1", "md5", "blake3", "xxhash"} {
+		if strings.Contains(base, algo) {
+			return algo
+		}
+	}
+	return ""
+}
+
+// checksumImageName returns the file name checksum lists refer to.
+func checksumImageName(imagePath string) string {
+	if IsURL(imagePath) {
+		if u, err := url.Parse(imagePath); err == nil {
+			name := path.Base(u.Path)
+			if decoded, err := url.PathUnescape(name); err == nil {
+				return decoded
+			}
+			return name
+		}
+	}
+	return filepath.Base(imagePath)
+}
+
+// HashFile computes the digest of a local file with the given algorithm,
+// calling onProgress (if non-nil) with bytes hashed so far and the file size.
+// A split image index is hashed as the concatenation of its chunks.
+func HashFile(ctx context.Context, filePath, algo string, onProgress func(done, total int64)) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	file, size, err := openHashTarget(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := GetBuffer(defaultBufferSize)
+	defer PutBuffer(defaultBufferSize, buf)
+
+	var done int64
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		default:
+		}
+
+		n, err := file.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			done += int64(n)
+			if onProgress != nil {
+				onProgress(done, size)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read image: %w", err)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openHashTarget opens the bytes HashFile digests and returns their size.
+func openHashTarget(filePath string) (io.ReadCloser, int64, error) {
+	if IsSplitIndex(filePath) {
+		index, err := LoadSplitIndex(filePath)
+		if err != nil {
+			return nil, 0, err
+		}
+		return openChunkReader(filePath, index), index.Size, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open image: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat image: %w", err)
+	}
+	return file, info.Size(), nil
+}
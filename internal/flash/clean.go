@@ -0,0 +1,74 @@
+package flash
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// cleanSize is how much is zeroed at each end of the drive by Clean. It
+// covers the MBR, the primary GPT and the start of the first partition
+// (boot sector and filesystem headers), and the backup GPT at the end.
+const cleanSize = 4 << 20
+
+// CleanResult describes a cleaned drive.
+type CleanResult struct {
+	DiskNumber  int    `json:"diskNumber"`
+	Size        int64  `json:"size"`
+	BytesZeroed int64  `json:"bytesZeroed"`
+	Duration    string `json:"duration"`
+}
+
+// Clean zeroes the first and last few megabytes of a drive, removing the
+// partition table (MBR and both GPT copies) and the filesystem signatures
+// at the start of the first partition, then has Windows re-read the
+// now-empty drive. The rest of the data is left in place; use Wiper to
+// destroy it.
+func Clean(diskNumber int, driveLetter string) (*CleanResult, error) {
+	start := time.Now()
+
+	var writer *diskWriter
+	if driveLetter != "" {
+		writer = newDiskWriterWithDriveLetter(diskNumber, driveLetter)
+	} else {
+		writer = newDiskWriter(diskNumber)
+	}
+	if err := writer.Open(); err != nil {
+		return nil, err
+	}
+	defer writer.Close()
+
+	geo, err := disk.GetDiskGeometry(writer.handle)
+	if err != nil {
+		return nil, err
+	}
+	size := geo.DiskSize
+
+	// Small drives are simply zeroed in full
+	head := min(int64(cleanSize), size)
+	regions := []extent{{0, head}}
+	if tail := max(size-cleanSize, head); tail < size {
+		regions = append(regions, extent{tail, size - tail})
+	}
+
+	zeros := GetBuffer(cleanSize)
+	defer PutBuffer(cleanSize, zeros)
+	clear(zeros)
+
+	result := &CleanResult{DiskNumber: diskNumber, Size: size}
+	for _, r := range regions {
+		// Both regions start and end on sector boundaries
+		if _, err := writeWithRetry(writer, zeros[:r.length], r.offset); err != nil {
+			return nil, fmt.Errorf("zero %s at offset %d: %w", FormatBytes(r.length), r.offset, err)
+		}
+		result.BytesZeroed += r.length
+	}
+
+	if err := disk.UpdateDiskProperties(writer.handle); err != nil {
+		return nil, fmt.Errorf("drive cleaned but rescan failed: %w", err)
+	}
+
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	return result, nil
+}
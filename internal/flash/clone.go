@@ -0,0 +1,416 @@
+package flash
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"sync"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// cloneBuffers is how many buffers the source is read ahead into, so the
+// next read overlaps with writing the current buffer to the targets.
+const cloneBuffers = 3
+
+// CloneTarget is a disk a clone is written to.
+type CloneTarget struct {
+	DiskNumber  int
+	DriveLetter string // Optional: cached drive letter to avoid WMI lookup
+}
+
+// CloneOptions configures a device-to-device clone.
+type CloneOptions struct {
+	SourceDisk        int
+	SourceDriveLetter string // Optional: cached drive letter of the source
+	Targets           []CloneTarget
+	BufferSize        int  // Buffer size in MB (default: 4)
+	Verify            bool // Read every target back and compare its hash with the source
+}
+
+// CloneProgress is a progress update for one clone target.
+type CloneProgress struct {
+	DiskNumber int `json:"diskNumber"`
+	Progress
+}
+
+// CloneTargetResult is the outcome for one clone target.
+type CloneTargetResult struct {
+	DiskNumber int    `json:"diskNumber"`
+	Success    bool   `json:"success"`
+	Verified   bool   `json:"verified,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Duration   string `json:"duration"`
+}
+
+// CloneResult describes a finished clone.
+type CloneResult struct {
+	SourceDisk int                 `json:"sourceDisk"`
+	Size       int64               `json:"size"`             // Bytes copied
+	Shrunk     bool                `json:"shrunk,omitempty"` // Only the partitions were copied, to fit a smaller target
+	Hash       string              `json:"hash,omitempty"`   // SHA-256 of the source, with Verify
+	Targets    []CloneTargetResult `json:"targets"`
+	Succeeded  int                 `json:"succeeded"`
+	Failed     int                 `json:"failed"`
+}
+
+// cloneTarget tracks one target during a clone.
+type cloneTarget struct {
+	CloneTarget
+	writer *diskWriter
+	size   int64
+	start  time.Time
+	err    error
+	ok     bool // Verified
+}
+
+// Cloner copies a disk to one or more other disks.
+type Cloner struct {
+	progressChan chan CloneProgress
+}
+
+// NewCloner creates a new cloner
+func NewCloner() *Cloner {
+	return &Cloner{
+		progressChan: make(chan CloneProgress, 64),
+	}
+}
+
+// Progress returns a channel that receives per-target progress updates
+func (c *Cloner) Progress() <-chan CloneProgress {
+	return c.progressChan
+}
+
+// Clone reads the source disk once and writes it to every target in
+// parallel. A target that fails is dropped while the others carry on; the
+// error is only returned if the source can't be read or no target
+// succeeded.
+//
+// If a target is smaller than the source, only the source up to the end of
+// its last partition is copied (to every target), and a GPT is rewritten to
+// fit each target. Targets the partitions don't fit on fail.
+func (c *Cloner) Clone(ctx context.Context, opts CloneOptions) (*CloneResult, error) {
+	defer close(c.progressChan)
+
+	var reader *diskWriter
+	if opts.SourceDriveLetter != "" {
+		reader = newDiskWriterWithDriveLetter(opts.SourceDisk, opts.SourceDriveLetter)
+	} else {
+		reader = newDiskWriter(opts.SourceDisk)
+	}
+	if err := reader.Open(); err != nil {
+		return nil, fmt.Errorf("source disk %d: %w", opts.SourceDisk, err)
+	}
+	defer reader.Close()
+
+	geo, err := disk.GetDiskGeometry(reader.handle)
+	if err != nil {
+		return nil, fmt.Errorf("source disk %d: %w", opts.SourceDisk, err)
+	}
+	size := geo.DiskSize
+
+	targets := make([]*cloneTarget, len(opts.Targets))
+	for i, t := range opts.Targets {
+		targets[i] = c.openTarget(t)
+		defer targets[i].writer.Close()
+	}
+
+	// Shrink to the partitioned extent if any target is too small
+	var layout *cloneLayout
+	for _, t := range c.alive(targets) {
+		if t.size < size {
+			layout, err = readCloneLayout(reader.handle, int64(geo.BytesPerSector))
+			if err != nil {
+				err = fmt.Errorf("disk %d is smaller than the source and %w", t.DiskNumber, err)
+				return c.result(opts, size, "", targets), err
+			}
+			break
+		}
+	}
+	if layout != nil {
+		size = layout.end
+		for _, t := range c.alive(targets) {
+			if t.size < layout.minSize() {
+				c.fail(t, fmt.Errorf("target (%s) is too small: the source's partitions need %s",
+					FormatBytes(t.size), FormatBytes(layout.minSize())))
+			}
+		}
+	}
+
+	if len(c.alive(targets)) == 0 {
+		return c.result(opts, size, "", targets), errors.New("no target could be opened")
+	}
+
+	var sourceHash hash.Hash
+	if opts.Verify {
+		sourceHash = sha256.New()
+	}
+	if err := c.copy(ctx, opts, reader, targets, size, sourceHash); err != nil {
+		return c.result(opts, size, "", targets), err
+	}
+
+	digest := ""
+	if sourceHash != nil {
+		digest = fmt.Sprintf("%x", sourceHash.Sum(nil))
+		c.verify(ctx, opts, targets, size, digest)
+	}
+
+	// The backup GPT wasn't copied; recreate it at the end of each target
+	if layout != nil && layout.gpt {
+		for _, t := range c.alive(targets) {
+			if err := relocateGPT(t.writer, t.size, layout); err != nil {
+				c.fail(t, err)
+			}
+		}
+	}
+
+	result := c.result(opts, size, digest, targets)
+	result.Shrunk = layout != nil
+	for _, t := range targets {
+		if t.err == nil {
+			c.send(t.DiskNumber, Progress{Stage: StageComplete, Percentage: 100, BytesWritten: size, TotalBytes: size, Status: StatusComplete})
+		}
+	}
+	if result.Succeeded == 0 {
+		return result, errors.New("clone failed on every target")
+	}
+	return result, nil
+}
+
+// openTarget opens a target for writing. Failures are recorded on the
+// returned target rather than returned.
+func (c *Cloner) openTarget(t CloneTarget) *cloneTarget {
+	target := &cloneTarget{CloneTarget: t, start: time.Now()}
+	if t.DriveLetter != "" {
+		target.writer = newDiskWriterWithDriveLetter(t.DiskNumber, t.DriveLetter)
+	} else {
+		target.writer = newDiskWriter(t.DiskNumber)
+	}
+	if err := target.writer.Open(); err != nil {
+		c.fail(target, err)
+		return target
+	}
+	geo, err := disk.GetDiskGeometry(target.writer.handle)
+	if err != nil {
+		c.fail(target, err)
+		return target
+	}
+	target.size = geo.DiskSize
+	return target
+}
+
+// cloneChunk is one buffer of source data.
+type cloneChunk struct {
+	buf    []byte
+	offset int64
+}
+
+// copy streams the source to all live targets.
+func (c *Cloner) copy(ctx context.Context, opts CloneOptions, reader *diskWriter, targets []*cloneTarget, size int64, sourceHash hash.Hash) error {
+	bufSize := opts.BufferSize << 20
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	free := make(chan []byte, cloneBuffers)
+	for range cloneBuffers {
+		free <- alignedBuffer(bufSize)
+	}
+	filled := make(chan cloneChunk, cloneBuffers)
+	readErr := make(chan error, 1)
+
+	// Read ahead of the writers
+	go func() {
+		defer close(filled)
+		err := forEachDiskChunk(ctx, size, bufSize, 0, func(offset int64, n int) error {
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			read, err := reader.ReadAt(buf[:n], offset)
+			if err == nil && read < n {
+				err = errors.New("unexpected end of disk")
+			}
+			if err != nil {
+				return fmt.Errorf("read source at offset %d: %w", offset, err)
+			}
+			select {
+			case filled <- cloneChunk{buf[:n], offset}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			readErr <- err
+		}
+	}()
+
+	var copied int64
+	startTime := time.Now()
+	lastProgressUpdate := startTime
+	for chunk := range filled {
+		if sourceHash != nil {
+			sourceHash.Write(chunk.buf)
+		}
+
+		var wg sync.WaitGroup
+		for _, t := range c.alive(targets) {
+			wg.Add(1)
+			go func(t *cloneTarget) {
+				defer wg.Done()
+				if _, err := writeWithRetry(t.writer, chunk.buf, chunk.offset); err != nil {
+					c.fail(t, fmt.Errorf("write error at offset %d: %w", chunk.offset, err))
+				}
+			}(t)
+		}
+		wg.Wait()
+		free <- chunk.buf[:cap(chunk.buf)]
+		copied += int64(len(chunk.buf))
+
+		if len(c.alive(targets)) == 0 {
+			cancel()
+			for range filled {
+			}
+			return errors.New("clone failed on every target")
+		}
+
+		now := time.Now()
+		if now.Sub(lastProgressUpdate) >= progressUpdateInterval {
+			lastProgressUpdate = now
+			speed := ""
+			if elapsed := now.Sub(startTime).Seconds(); elapsed > 0 {
+				speed = formatSpeed(float64(copied) / elapsed)
+			}
+			for _, t := range c.alive(targets) {
+				c.send(t.DiskNumber, Progress{
+					Stage:        StageWriting,
+					Percentage:   progressPercent(copied, size),
+					BytesWritten: copied,
+					TotalBytes:   size,
+					Speed:        speed,
+					Status:       StatusInProgress,
+				})
+			}
+		}
+	}
+
+	select {
+	case err := <-readErr:
+		for _, t := range c.alive(targets) {
+			c.fail(t, err)
+		}
+		return err
+	default:
+	}
+	return nil
+}
+
+// verify reads every live target back in parallel and compares its hash
+// with the source's.
+func (c *Cloner) verify(ctx context.Context, opts CloneOptions, targets []*cloneTarget, size int64, digest string) {
+	bufSize := opts.BufferSize << 20
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range c.alive(targets) {
+		wg.Add(1)
+		go func(t *cloneTarget) {
+			defer wg.Done()
+			buffer := GetBuffer(bufSize)
+			defer PutBuffer(bufSize, buffer)
+
+			h := sha256.New()
+			startTime := time.Now()
+			err := forEachDiskChunk(ctx, size, bufSize, progressUpdateInterval, func(offset int64, n int) error {
+				read, err := t.writer.ReadAt(buffer[:n], offset)
+				if err == nil && read < n {
+					err = errors.New("unexpected end of disk")
+				}
+				if err != nil {
+					return fmt.Errorf("verify: read error at offset %d: %w", offset, err)
+				}
+				h.Write(buffer[:n])
+				return nil
+			}, func(done int64) {
+				c.send(t.DiskNumber, Progress{
+					Stage:        StageVerifying,
+					Percentage:   progressPercent(done, size),
+					BytesWritten: done,
+					TotalBytes:   size,
+					Speed:        phaseSpeed(done, startTime, time.Now()),
+					Status:       StatusInProgress,
+				})
+			})
+			if err != nil {
+				c.fail(t, err)
+				return
+			}
+			if got := fmt.Sprintf("%x", h.Sum(nil)); got != digest {
+				c.fail(t, fmt.Errorf("verification failed: target hash %s does not match source %s", got, digest))
+				return
+			}
+			t.ok = true
+		}(t)
+	}
+	wg.Wait()
+}
+
+// alive returns the targets that haven't failed.
+func (c *Cloner) alive(targets []*cloneTarget) []*cloneTarget {
+	var result []*cloneTarget
+	for _, t := range targets {
+		if t.err == nil {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// fail marks a target as failed and reports it.
+func (c *Cloner) fail(t *cloneTarget, err error) {
+	t.err = err
+	c.send(t.DiskNumber, Progress{Stage: "Error", Status: StatusError, Error: err.Error()})
+}
+
+func (c *Cloner) result(opts CloneOptions, size int64, digest string, targets []*cloneTarget) *CloneResult {
+	result := &CloneResult{
+		SourceDisk: opts.SourceDisk,
+		Size:       size,
+		Hash:       digest,
+		Targets:    make([]CloneTargetResult, 0, len(targets)),
+	}
+	for _, t := range targets {
+		r := CloneTargetResult{
+			DiskNumber: t.DiskNumber,
+			Success:    t.err == nil,
+			Verified:   t.ok,
+			Duration:   time.Since(t.start).Round(time.Millisecond).String(),
+		}
+		if t.err != nil {
+			r.Error = t.err.Error()
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+		result.Targets = append(result.Targets, r)
+	}
+	return result
+}
+
+func (c *Cloner) send(diskNumber int, p Progress) {
+	select {
+	case c.progressChan <- CloneProgress{DiskNumber: diskNumber, Progress: p}:
+	default:
+	}
+}
@@ -0,0 +1,119 @@
+package flash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"golang.org/x/sys/windows"
+)
+
+// gptEntryArraySize is the size of a standard GPT partition entry array
+// (128 entries of 128 bytes), which a shrunk clone keeps room for at the
+// end of the target.
+const gptEntryArraySize = 128 * 128
+
+// cloneLayout is what a partition-aware clone needs to know about the
+// source's partition table.
+type cloneLayout struct {
+	end        int64 // Just past the last partition
+	gpt        bool
+	sectorSize int64
+}
+
+// readCloneLayout reads the source's partition table.
+func readCloneLayout(handle windows.Handle, sectorSize int64) (*cloneLayout, error) {
+	layout, err := disk.GetDriveLayout(handle)
+	if err != nil {
+		return nil, err
+	}
+	l := &cloneLayout{
+		gpt:        layout.PartitionStyle == disk.PARTITION_STYLE_GPT,
+		sectorSize: sectorSize,
+	}
+	for _, p := range layout.Partitions {
+		l.end = max(l.end, p.StartingOffset+p.Length)
+	}
+	if l.end == 0 {
+		return nil, errors.New("the source has no partitions, so it can only be cloned to a drive at least as large")
+	}
+	return l, nil
+}
+
+// minSize returns the smallest target the source's partitions fit on. GPT
+// disks also need room for the backup entry array and header.
+func (l *cloneLayout) minSize() int64 {
+	if l.gpt {
+		return l.end + gptEntryArraySize + l.sectorSize
+	}
+	return l.end
+}
+
+// relocateGPT rewrites a cloned GPT for a target of targetSize bytes: the
+// primary header and protective MBR are updated for the new last LBA and
+// the backup entry array and header are written at the end of the target.
+func relocateGPT(writer *diskWriter, targetSize int64, l *cloneLayout) error {
+	sector := l.sectorSize
+	head := alignedBuffer(int(2 * sector))
+	if _, err := writer.ReadAt(head, 0); err != nil {
+		return fmt.Errorf("read GPT header: %w", err)
+	}
+	primary := head[sector:]
+	if string(primary[0:8]) != "EFI PART" {
+		return errors.New("cloned GPT header not found")
+	}
+	headerSize := binary.LittleEndian.Uint32(primary[12:16])
+	if headerSize < 92 || int64(headerSize) > sector {
+		return fmt.Errorf("invalid GPT header size %d", headerSize)
+	}
+
+	entryLBA := int64(binary.LittleEndian.Uint64(primary[72:80]))
+	entryBytes := int64(binary.LittleEndian.Uint32(primary[80:84])) * int64(binary.LittleEndian.Uint32(primary[84:88]))
+	entrySectors := (entryBytes + sector - 1) / sector
+	entries := alignedBuffer(int(entrySectors * sector))
+	if _, err := writer.ReadAt(entries, entryLBA*sector); err != nil {
+		return fmt.Errorf("read GPT entries: %w", err)
+	}
+
+	lastLBA := targetSize/sector - 1
+	backupEntryLBA := lastLBA - entrySectors
+	lastUsable := backupEntryLBA - 1
+	if l.end/sector-1 > lastUsable {
+		return fmt.Errorf("partitions end at %s, past the target's last usable sector", FormatBytes(l.end))
+	}
+
+	// Protective MBR: the 0xEE partition covers the whole (smaller) disk
+	if head[510] == 0x55 && head[511] == 0xAA && head[446+4] == 0xEE {
+		binary.LittleEndian.PutUint32(head[446+12:], uint32(min(lastLBA, 0xFFFFFFFF)))
+	}
+
+	binary.LittleEndian.PutUint64(primary[32:40], uint64(lastLBA))
+	binary.LittleEndian.PutUint64(primary[48:56], uint64(lastUsable))
+	setGPTHeaderCRC(primary[:headerSize])
+
+	backup := alignedBuffer(int(sector))
+	copy(backup, primary[:headerSize])
+	binary.LittleEndian.PutUint64(backup[24:32], uint64(lastLBA))
+	binary.LittleEndian.PutUint64(backup[32:40], 1)
+	binary.LittleEndian.PutUint64(backup[72:80], uint64(backupEntryLBA))
+	setGPTHeaderCRC(backup[:headerSize])
+
+	if _, err := writeWithRetry(writer, entries, backupEntryLBA*sector); err != nil {
+		return fmt.Errorf("write backup GPT entries: %w", err)
+	}
+	if _, err := writeWithRetry(writer, backup, lastLBA*sector); err != nil {
+		return fmt.Errorf("write backup GPT header: %w", err)
+	}
+	if _, err := writeWithRetry(writer, head, 0); err != nil {
+		return fmt.Errorf("write GPT header: %w", err)
+	}
+	return nil
+}
+
+// setGPTHeaderCRC recomputes the CRC32 of a GPT header.
+func setGPTHeaderCRC(header []byte) {
+	binary.LittleEndian.PutUint32(header[16:20], 0)
+	binary.LittleEndian.PutUint32(header[16:20], crc32.ChecksumIEEE(header))
+}
@@ -0,0 +1,360 @@
+package flash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// StageComparing is reported while two drives are compared
+const StageComparing = "Comparing"
+
+// Values for CompareOptions.Extent
+const (
+	CompareExtentDisk       = "disk"       // The whole drives; drives of different sizes never match
+	CompareExtentPartitions = "partitions" // Up to the end of the first drive's last partition
+)
+
+// CompareOptions configures a comparison of two drives.
+type CompareOptions struct {
+	DiskA        int
+	DriveLetterA string // Optional: cached drive letter to avoid WMI lookup
+	DiskB        int
+	DriveLetterB string
+	Extent       string // CompareExtentDisk (default) or CompareExtentPartitions
+	BufferSize   int    // Buffer size in MB (default: 4)
+}
+
+// CompareRegion is the comparison result for one part of the drives, laid
+// out after the first drive's partition table.
+type CompareRegion struct {
+	Name            string `json:"name"` // "partition table", "partition N", "unallocated" or "backup GPT"
+	Offset          int64  `json:"offset"`
+	Length          int64  `json:"length"`
+	Identical       bool   `json:"identical"`
+	FirstDifference *int64 `json:"firstDifference,omitempty"` // Drive offset
+	DifferentBytes  int64  `json:"differentBytes,omitempty"`
+}
+
+// CompareResult describes a finished comparison.
+type CompareResult struct {
+	DiskA           int             `json:"diskA"`
+	DiskB           int             `json:"diskB"`
+	SizeA           int64           `json:"sizeA"`
+	SizeB           int64           `json:"sizeB"`
+	Extent          string          `json:"extent"`
+	BytesCompared   int64           `json:"bytesCompared"`
+	Identical       bool            `json:"identical"`
+	FirstDifference *int64          `json:"firstDifference,omitempty"`
+	DifferentBytes  int64           `json:"differentBytes"`
+	Regions         []CompareRegion `json:"regions"`
+	Duration        string          `json:"duration"`
+}
+
+// Comparer compares two drives byte for byte.
+type Comparer struct {
+	progressChan chan Progress
+}
+
+// NewComparer creates a new comparer
+func NewComparer() *Comparer {
+	return &Comparer{
+		progressChan: make(chan Progress, 10),
+	}
+}
+
+// Progress returns a channel that receives progress updates
+func (c *Comparer) Progress() <-chan Progress {
+	return c.progressChan
+}
+
+// Compare reads both drives in full (or up to the end of the first drive's
+// partitions) and reports where they differ. Differences are reported in
+// the result, not as an error.
+func (c *Comparer) Compare(ctx context.Context, opts CompareOptions) (*CompareResult, error) {
+	defer close(c.progressChan)
+	start := time.Now()
+
+	extent := opts.Extent
+	if extent == "" {
+		extent = CompareExtentDisk
+	}
+	if extent != CompareExtentDisk && extent != CompareExtentPartitions {
+		err := fmt.Errorf("unsupported compare extent %q", extent)
+		c.sendError(err.Error())
+		return nil, err
+	}
+
+	a, sizeA, err := openCompareDisk(opts.DiskA, opts.DriveLetterA)
+	if err != nil {
+		c.sendError(err.Error())
+		return nil, err
+	}
+	defer a.Close()
+	b, sizeB, err := openCompareDisk(opts.DiskB, opts.DriveLetterB)
+	if err != nil {
+		c.sendError(err.Error())
+		return nil, err
+	}
+	defer b.Close()
+
+	regions, err := compareRegions(a, sizeA, extent)
+	if err != nil {
+		err = fmt.Errorf("disk %d: %w", opts.DiskA, err)
+		c.sendError(err.Error())
+		return nil, err
+	}
+	// A disk compare stops at the smaller drive; the size difference alone
+	// makes them not identical
+	size := regions[len(regions)-1].Offset + regions[len(regions)-1].Length
+	if size > sizeB {
+		if extent == CompareExtentPartitions {
+			err := fmt.Errorf("disk %d (%s) is smaller than disk %d's partitions (%s)",
+				opts.DiskB, FormatBytes(sizeB), opts.DiskA, FormatBytes(size))
+			c.sendError(err.Error())
+			return nil, err
+		}
+		regions = clipRegions(regions, sizeB)
+		size = sizeB
+	}
+
+	bufSize := opts.BufferSize << 20
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+	bufA := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, bufA)
+	bufB := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, bufB)
+
+	result := &CompareResult{
+		DiskA:     opts.DiskA,
+		DiskB:     opts.DiskB,
+		SizeA:     sizeA,
+		SizeB:     sizeB,
+		Extent:    extent,
+		Identical: extent == CompareExtentPartitions || sizeA == sizeB,
+	}
+	lastProgressUpdate := start
+	c.sendProgress(0, 0, size, "")
+
+	for i := range regions {
+		r := &regions[i]
+		r.Identical = true
+		for offset := r.Offset; offset < r.Offset+r.Length; {
+			select {
+			case <-ctx.Done():
+				c.sendError("comparison cancelled")
+				return nil, ctx.Err()
+			default:
+			}
+
+			// Regions are sector-aligned, so reads stay aligned
+			n := int(min(int64(bufSize), r.Offset+r.Length-offset))
+			if err := readBoth(a, b, bufA[:n], bufB[:n], offset); err != nil {
+				c.sendError(err.Error())
+				return nil, err
+			}
+			if !bytes.Equal(bufA[:n], bufB[:n]) {
+				first := offset + int64(firstDifference(bufA[:n], bufB[:n]))
+				if r.Identical {
+					r.Identical = false
+					r.FirstDifference = &first
+				}
+				if result.FirstDifference == nil {
+					result.FirstDifference = &first
+				}
+				r.DifferentBytes += int64(countDifferences(bufA[:n], bufB[:n]))
+			}
+			offset += int64(n)
+			result.BytesCompared += int64(n)
+
+			now := time.Now()
+			if now.Sub(lastProgressUpdate) >= progressUpdateInterval {
+				lastProgressUpdate = now
+				speed := ""
+				if elapsed := now.Sub(start).Seconds(); elapsed > 0 {
+					speed = formatSpeed(float64(result.BytesCompared) / elapsed)
+				}
+				c.sendProgress(progressPercent(result.BytesCompared, size), result.BytesCompared, size, speed)
+			}
+		}
+		result.DifferentBytes += r.DifferentBytes
+		if !r.Identical {
+			result.Identical = false
+		}
+	}
+
+	result.Regions = regions
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	c.sendComplete(result.BytesCompared)
+	return result, nil
+}
+
+// openCompareDisk opens a drive for reading and returns its size.
+func openCompareDisk(diskNumber int, driveLetter string) (*diskWriter, int64, error) {
+	var reader *diskWriter
+	if driveLetter != "" {
+		reader = newDiskWriterWithDriveLetter(diskNumber, driveLetter)
+	} else {
+		reader = newDiskWriter(diskNumber)
+	}
+	if err := reader.Open(); err != nil {
+		return nil, 0, fmt.Errorf("disk %d: %w", diskNumber, err)
+	}
+	geo, err := disk.GetDiskGeometry(reader.handle)
+	if err != nil {
+		reader.Close()
+		return nil, 0, fmt.Errorf("disk %d: %w", diskNumber, err)
+	}
+	return reader, geo.DiskSize, nil
+}
+
+// compareRegions splits [0, size) into the partition table, partitions and
+// the gaps between them, per the drive's partition table. With
+// CompareExtentPartitions the regions end with the last partition. A drive
+// without partitions is one region.
+func compareRegions(reader *diskWriter, size int64, extent string) ([]CompareRegion, error) {
+	layout, err := disk.GetDriveLayout(reader.handle)
+	if err != nil {
+		return nil, err
+	}
+	var parts []disk.PartitionInfo
+	var end int64
+	for _, p := range layout.Partitions {
+		if p.Length == 0 {
+			continue
+		}
+		end = max(end, p.StartingOffset+p.Length)
+		// Extended partitions overlap their logical partitions; the EBRs
+		// show up as unallocated gaps
+		if layout.PartitionStyle == disk.PARTITION_STYLE_MBR && isContainer(p.PartitionType) {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	if len(parts) == 0 {
+		if extent == CompareExtentPartitions {
+			return nil, errors.New("no partitions to compare")
+		}
+		return []CompareRegion{{Name: "disk", Length: size}}, nil
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].StartingOffset < parts[j].StartingOffset })
+
+	var regions []CompareRegion
+	if parts[0].StartingOffset > 0 {
+		regions = append(regions, CompareRegion{Name: "partition table", Length: parts[0].StartingOffset})
+	}
+	position := parts[0].StartingOffset
+	for _, p := range parts {
+		if p.StartingOffset > position {
+			regions = append(regions, CompareRegion{Name: "unallocated", Offset: position, Length: p.StartingOffset - position})
+		}
+		regions = append(regions, CompareRegion{
+			Name:   fmt.Sprintf("partition %d", p.PartitionNumber),
+			Offset: p.StartingOffset,
+			Length: p.Length,
+		})
+		position = max(position, p.StartingOffset+p.Length)
+	}
+	if end > position {
+		regions = append(regions, CompareRegion{Name: "unallocated", Offset: position, Length: end - position})
+		position = end
+	}
+	if extent == CompareExtentDisk && size > position {
+		name := "unallocated"
+		if layout.PartitionStyle == disk.PARTITION_STYLE_GPT {
+			name = "backup GPT"
+		}
+		regions = append(regions, CompareRegion{Name: name, Offset: position, Length: size - position})
+	}
+	return regions, nil
+}
+
+// clipRegions cuts regions off at size.
+func clipRegions(regions []CompareRegion, size int64) []CompareRegion {
+	var clipped []CompareRegion
+	for _, r := range regions {
+		if r.Offset >= size {
+			break
+		}
+		r.Length = min(r.Length, size-r.Offset)
+		clipped = append(clipped, r)
+	}
+	return clipped
+}
+
+// readBoth reads the same range of two drives concurrently.
+func readBoth(a, b *diskWriter, bufA, bufB []byte, offset int64) error {
+	var wg sync.WaitGroup
+	var errB error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, errB = b.ReadAt(bufB, offset)
+	}()
+	_, errA := a.ReadAt(bufA, offset)
+	wg.Wait()
+	if errA != nil {
+		return fmt.Errorf("read first disk at offset %d: %w", offset, errA)
+	}
+	if errB != nil {
+		return fmt.Errorf("read second disk at offset %d: %w", offset, errB)
+	}
+	return nil
+}
+
+// countDifferences returns the number of positions where a and b differ.
+func countDifferences(a, b []byte) int {
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Comparer) sendProgress(percentage int, bytesCompared, totalBytes int64, speed string) {
+	select {
+	case c.progressChan <- Progress{
+		Stage:        StageComparing,
+		Percentage:   percentage,
+		BytesWritten: bytesCompared,
+		TotalBytes:   totalBytes,
+		Speed:        speed,
+		Status:       StatusInProgress,
+	}:
+	default:
+	}
+}
+
+func (c *Comparer) sendError(errMsg string) {
+	select {
+	case c.progressChan <- Progress{
+		Stage:  "Error",
+		Status: StatusError,
+		Error:  errMsg,
+	}:
+	default:
+	}
+}
+
+func (c *Comparer) sendComplete(totalBytes int64) {
+	select {
+	case c.progressChan <- Progress{
+		Stage:        StageComplete,
+		Percentage:   100,
+		BytesWritten: totalBytes,
+		TotalBytes:   totalBytes,
+		Status:       StatusComplete,
+	}:
+	default:
+	}
+}
@@ -0,0 +1,92 @@
+package flash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"golang.org/x/sys/windows"
+)
+
+// StageTrimming is reported while a drive's blocks are discarded
+const StageTrimming = "Trimming"
+
+// discardChunk is how much is trimmed per request, so trimming a large
+// drive can report progress and be cancelled.
+const discardChunk = 1 << 30
+
+// errTrimUnsupported is returned for drives that don't advertise TRIM.
+var errTrimUnsupported = errors.New("drive does not support TRIM")
+
+// DiscardResult describes a drive whose blocks were trimmed.
+type DiscardResult struct {
+	DiskNumber int    `json:"diskNumber"`
+	Size       int64  `json:"size"`
+	Duration   string `json:"duration"`
+}
+
+// Discard TRIMs every block of a drive, so its controller can erase them in
+// the background and later writes run at full speed again. The drive's data
+// and partition table are lost. Drives that don't report TRIM support are
+// refused.
+func Discard(ctx context.Context, diskNumber int, driveLetter string) (*DiscardResult, error) {
+	start := time.Now()
+
+	var writer *diskWriter
+	if driveLetter != "" {
+		writer = newDiskWriterWithDriveLetter(diskNumber, driveLetter)
+	} else {
+		writer = newDiskWriter(diskNumber)
+	}
+	if err := writer.Open(); err != nil {
+		return nil, err
+	}
+	defer writer.Close()
+
+	if err := checkTrimSupported(writer.handle); err != nil {
+		return nil, err
+	}
+	geo, err := disk.GetDiskGeometry(writer.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := discardDisk(ctx, writer.handle, geo.DiskSize, nil); err != nil {
+		return nil, err
+	}
+
+	// The partition table may now read back as zeros
+	disk.UpdateDiskProperties(writer.handle)
+
+	return &DiscardResult{
+		DiskNumber: diskNumber,
+		Size:       geo.DiskSize,
+		Duration:   time.Since(start).Round(time.Millisecond).String(),
+	}, nil
+}
+
+// checkTrimSupported fails with errTrimUnsupported unless the drive reports
+// TRIM support.
+func checkTrimSupported(handle windows.Handle) error {
+	ok, err := disk.TrimSupported(handle)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errTrimUnsupported
+	}
+	return nil
+}
+
+// discardDisk trims the first size bytes of the drive in discardChunk
+// requests, calling progress (if set) with the bytes trimmed so far.
+func discardDisk(ctx context.Context, handle windows.Handle, size int64, progress func(done int64)) error {
+	return forEachDiskChunk(ctx, size, discardChunk, 0, func(offset int64, n int) error {
+		if err := disk.Trim(handle, offset, int64(n)); err != nil {
+			return fmt.Errorf("trim at offset %d: %w", offset, err)
+		}
+		return nil
+	}, progress)
+}
@@ -3,10 +3,18 @@ package flash
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
 	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/cloudinit"
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/label"
 )
 
 // Stage constants for flash progress
@@ -14,6 +22,11 @@ const (
 	StageExtracting = "Extracting"
 	StageWriting    = "Writing"
 	StageVerifying  = "Verifying"
+	StageValidating = "Validating"
+	StageChecksum   = "Checksum"
+	StageCloudInit  = "Cloud-init"
+	StageRescanning = "Rescanning"
+	StageLabeling   = "Labeling"
 	StageComplete   = "Complete"
 )
 
@@ -37,19 +50,26 @@ const (
 	StatusInProgress = "in_progress"
 	StatusComplete   = "complete"
 	StatusError      = "error"
+	// StatusHashVerified is sent once the image matched Options.ExpectedHash
+	StatusHashVerified = "hash_verified"
+	// StatusImageValidated carries the Options.ValidateImage result
+	StatusImageValidated = "image_validated"
 )
 
 // Progress represents the current state of a flash operation
 type Progress struct {
-	Stage        string `json:"stage"`
-	Percentage   int    `json:"percentage"`
-	BytesWritten int64  `json:"bytes_written"`
-	TotalBytes   int64  `json:"total_bytes"`
-	Speed        string `json:"speed"`
-	Status       string `json:"status"`
-	Error        string `json:"error,omitempty"`
-	Hash         string `json:"hash,omitempty"`
-	BytesSkipped int64  `json:"bytes_skipped,omitempty"`
+	Stage         string           `json:"stage"`
+	Percentage    int              `json:"percentage"`
+	BytesWritten  int64            `json:"bytes_written"`
+	TotalBytes    int64            `json:"total_bytes"`
+	Speed         string           `json:"speed"`
+	Status        string           `json:"status"`
+	Error         string           `json:"error,omitempty"`
+	Hash          string           `json:"hash,omitempty"`
+	HashAlgorithm string           `json:"hash_algorithm,omitempty"` // Algorithm of Hash on completion
+	BytesSkipped  int64            `json:"bytes_skipped,omitempty"`  // Not written: unchanged on disk, or all-zero with Sparse
+	Validation    *ImageValidation `json:"validation,omitempty"`
+	Partitions    []Partition      `json:"partitions,omitempty"` // Layout after the rescan, on completion
 }
 
 // Options configures the flash operation
@@ -57,10 +77,141 @@ type Options struct {
 	DiskNumber    int
 	ImagePath     string
 	Verify        bool
-	BufferSize    int    // Buffer size in MB (default: 4)
-	CalculateHash bool   // Calculate SHA-256 hash while writing
-	SkipUnchanged bool   // Skip writing sectors that haven't changed
-	DriveLetter   string // Optional: cached drive letter to avoid WMI lookup
+	BufferSize    int             // Buffer size in MB (default: 4)
+	CalculateHash bool            // Calculate a hash of the image while writing
+	HashAlgorithm string          // Algorithm for CalculateHash (default: sha256); blake3 and xxhash are faster
+	SkipUnchanged bool            // Skip writing sectors that haven't changed
+	DriveLetter   string          // Optional: cached drive letter to avoid WMI lookup
+	ArchiveEntry  string          // Optional: file to flash from inside a .zip/.7z archive
+	ExpectedHash  ExpectedHash    // Optional: digest the image file must match
+	Seek          int64           // Device offset in bytes to start writing at (dd seek)
+	Skip          int64           // Image bytes to skip before writing (dd skip)
+	Count         int64           // Maximum image bytes to write, 0 = all (dd count)
+	Partition     int             // Optional: write into this partition instead of the whole disk
+	NoTrim        bool            // Write the whole image, even past the last partition
+	Sparse        bool            // Skip all-zero blocks (assumes the target is already zeroed)
+	CloudInit     *cloudinit.Seed // Optional: NoCloud seed to write after flashing
+	Label         string          // Optional: volume label to set on the first partition after flashing
+	HTTP          HTTPOptions     // Credentials, proxy and retry settings for URL images
+	ValidateImage bool            // Check the image looks like a disk image before writing
+	BlockMap      string          // Optional: block map file; with a map of this drive only changed blocks are written
+	DiskSerial    string          // Serial number recorded in and checked against BlockMap
+	Source        Source          // Optional: already-open image stream to write instead of ImagePath; its owner checks ExpectedHash
+	VerifySource  Source          // Optional: already-open image stream to verify against instead of reopening ImagePath
+}
+
+// verifyChecksum hashes a local image file and compares it with
+// opts.ExpectedHash, reporting progress under StageChecksum.
+func (f *Flasher) verifyChecksum(ctx context.Context, opts Options) error {
+	f.sendProgress(opts, StageChecksum, 0, 0, 0, "", 0)
+
+	lastProgressUpdate := time.Now()
+	digest, err := HashFile(ctx, opts.ImagePath, opts.ExpectedHash.Algorithm, func(done, total int64) {
+		if now := time.Now(); now.Sub(lastProgressUpdate) >= progressUpdateInterval {
+			lastProgressUpdate = now
+			f.sendProgress(opts, StageChecksum, progressPercent(done, total), done, total, "", 0)
+		}
+	})
+	if err != nil {
+		f.sendError(opts, fmt.Sprintf("checksum: %v", err))
+		return err
+	}
+
+	return f.checkDigest(opts, digest)
+}
+
+// checkDigest compares a computed digest with opts.ExpectedHash and sends
+// either a hash_verified event or an error.
+func (f *Flasher) checkDigest(opts Options, digest string) error {
+	if digest != opts.ExpectedHash.Digest {
+		err := fmt.Errorf("checksum mismatch: expected %s %s, got %s",
+			opts.ExpectedHash.Algorithm, opts.ExpectedHash.Digest, digest)
+		f.sendError(opts, err.Error())
+		return err
+	}
+
+	select {
+	case f.progressChan <- Progress{
+		Stage:      StageChecksum,
+		Percentage: 100,
+		Status:     StatusHashVerified,
+		Hash:       opts.ExpectedHash.String(),
+	}:
+	default:
+	}
+	return nil
+}
+
+// validateImage runs ValidateImageHeader on the start of source, reports the
+// result as an image_validated event and fails if the image looks wrong.
+// Returns a source that still yields the bytes that were inspected.
+func (f *Flasher) validateImage(opts Options, source Source) (Source, error) {
+	validation, source, err := validateSource(source)
+	if err != nil {
+		err = fmt.Errorf("failed to read image: %w", err)
+		f.sendError(opts, err.Error())
+		return nil, err
+	}
+
+	// A partition's contents are expected to be a bare filesystem
+	if opts.Partition > 0 && validation.Format == ImageFormatFilesystem {
+		validation.Warnings = nil
+	}
+
+	select {
+	case f.progressChan <- Progress{
+		Stage:      StageValidating,
+		Percentage: 100,
+		Status:     StatusImageValidated,
+		Validation: validation,
+	}:
+	default:
+	}
+
+	if !validation.OK() {
+		err := fmt.Errorf("image validation failed: %s", strings.Join(validation.Errors, "; "))
+		f.sendError(opts, err.Error())
+		return nil, err
+	}
+	return source, nil
+}
+
+// sourceOptions returns the options used to open the image source.
+func (o Options) sourceOptions() SourceOptions {
+	return SourceOptions{
+		ArchiveEntry: o.ArchiveEntry,
+		Skip:         o.Skip,
+		Count:        o.Count,
+		// A partition image's own layout (if any) says nothing about its size
+		Trim: !o.NoTrim && o.Partition == 0,
+		HTTP: o.HTTP,
+	}
+}
+
+// hashAlgorithm returns the algorithm CalculateHash uses.
+func (o Options) hashAlgorithm() string {
+	if o.HashAlgorithm == "" {
+		return "sha256"
+	}
+	return o.HashAlgorithm
+}
+
+// isRegion reports whether only part of the disk is written (seek/count or a
+// partition), in which case bytes outside the region must be left untouched.
+func (o Options) isRegion() bool {
+	return o.Seek > 0 || o.Count > 0 || o.Partition > 0
+}
+
+// ValidateRegion checks dd-style seek/skip/count values. The device offset
+// must be aligned for unbuffered I/O; skip and count may be any size.
+func ValidateRegion(seek, skip, count int64) error {
+	if seek < 0 || skip < 0 || count < 0 {
+		return fmt.Errorf("seek, skip and count must not be negative")
+	}
+	if seek%alignment != 0 {
+		return fmt.Errorf("seek offset %d must be a multiple of %d bytes", seek, alignment)
+	}
+	return nil
 }
 
 // Flasher handles USB drive flashing operations
@@ -80,25 +231,85 @@ func (f *Flasher) Progress() <-chan Progress {
 	return f.progressChan
 }
 
-// Flash writes an image to a USB drive
-// Returns error or nil on success. Also available via FlashWithStats for hash/skip stats.
+// Flash writes an image to a USB drive.
+// Returns the image hash (empty unless CalculateHash is set), the number of
+// bytes skipped because they were already identical on disk (or all zero
+// with Sparse), and any error.
 func (f *Flasher) Flash(ctx context.Context, opts Options) (string, int64, error) {
 	defer close(f.progressChan)
+	// Streams handed in are closed however the flash ends, so a shared
+	// source doesn't wait on them
+	if opts.Source != nil {
+		defer opts.Source.Close()
+	}
+	if opts.VerifySource != nil {
+		defer opts.VerifySource.Close()
+	}
 
-	// Open the image source
-	source, err := OpenSource(opts.ImagePath)
-	if err != nil {
+	if err := ValidateRegion(opts.Seek, opts.Skip, opts.Count); err != nil {
 		f.sendError(opts, err.Error())
 		return "", 0, err
 	}
-	defer source.Close()
+	if opts.CalculateHash {
+		if _, err := newHash(opts.hashAlgorithm()); err != nil {
+			f.sendError(opts, err.Error())
+			return "", 0, err
+		}
+	}
+
+	// Check the image against the expected digest before touching the disk.
+	// Remote images can't be read twice, so they're hashed while streaming.
+	var rawHasher hash.Hash
+	if opts.ExpectedHash.IsSet() && opts.Source == nil {
+		if IsURL(opts.ImagePath) {
+			rawHasher, _ = newHash(opts.ExpectedHash.Algorithm)
+		} else if err := f.verifyChecksum(ctx, opts); err != nil {
+			return "", 0, err
+		}
+	}
+
+	// Open the image source
+	var err error
+	source := opts.Source
+	if source == nil {
+		sourceOpts := opts.sourceOptions()
+		sourceOpts.RawHash = rawHasher
+		sourceOpts.HTTP.Context = ctx
+		if source, err = OpenSourceWithOptions(opts.ImagePath, sourceOpts); err != nil {
+			f.sendError(opts, err.Error())
+			return "", 0, err
+		}
+		defer source.Close()
+	}
+
+	// Sanity-check the image before anything on the disk is touched. With
+	// --skip the stream doesn't start at the image's header, so there's
+	// nothing meaningful to check.
+	if opts.ValidateImage && opts.Skip == 0 {
+		if source, err = f.validateImage(opts, source); err != nil {
+			return "", 0, err
+		}
+	}
 
 	totalSize := source.Size()
-	f.sendProgress(opts, StageWriting, 0, 0, totalSize, "")
+	f.sendProgress(opts, StageWriting, 0, 0, totalSize, "", 0)
 
 	// Open the disk for writing (use cached drive letter if available)
 	var writer *diskWriter
-	if opts.DriveLetter != "" {
+	if opts.Partition > 0 {
+		target, err := ResolvePartition(opts.DiskNumber, opts.Partition)
+		if err != nil {
+			f.sendError(opts, err.Error())
+			return "", 0, err
+		}
+		if totalSize != SizeUnknown && opts.Seek+totalSize > target.Length {
+			err := fmt.Errorf("image (%s) does not fit in partition %d (%s)",
+				FormatBytes(totalSize), opts.Partition, FormatBytes(target.Length))
+			f.sendError(opts, err.Error())
+			return "", 0, err
+		}
+		writer = newPartitionWriter(opts.DiskNumber, target)
+	} else if opts.DriveLetter != "" {
 		writer = newDiskWriterWithDriveLetter(opts.DiskNumber, opts.DriveLetter)
 	} else {
 		writer = newDiskWriter(opts.DiskNumber)
@@ -109,18 +320,59 @@ func (f *Flasher) Flash(ctx context.Context, opts Options) (string, int64, error
 	}
 	defer writer.Close()
 
-	// Pre-write speed test: verify drive is responsive
-	if err := f.speedTest(writer); err != nil {
-		f.sendError(opts, err.Error())
-		return "", 0, err
+	// Streams of unknown length can't be checked against the device up
+	// front, so bound the writer by the disk size and fail as soon as the
+	// image outgrows it instead of on a cryptic write error.
+	if writer.limit == 0 && totalSize == SizeUnknown {
+		if geo, err := disk.GetDiskGeometry(writer.handle); err == nil {
+			writer.limit = geo.DiskSize
+		}
+	}
+
+	var blockMap *BlockMap
+	delta := false
+	if opts.BlockMap != "" {
+		if blockMap, delta, err = openBlockMap(opts, writer); err != nil {
+			f.sendError(opts, err.Error())
+			return "", 0, err
+		}
+	}
+
+	// Pre-write speed test: verify drive is responsive. It scribbles over the
+	// start of the disk, so skip it when only a region is being written or
+	// the block map says which blocks need writing.
+	if !opts.isRegion() && !delta {
+		if err := f.speedTest(writer); err != nil {
+			f.sendError(opts, err.Error())
+			return "", 0, err
+		}
 	}
 
 	// Write the image and get hash/skip stats
-	finalHash, bytesSkipped, err := f.writeImage(ctx, opts, source, writer, totalSize)
+	finalHash, bytesWritten, bytesSkipped, err := f.writeImage(ctx, opts, source, writer, totalSize, blockMap, delta)
 	if err != nil {
 		return "", 0, err
 	}
 
+	// Streams of unknown size are only measured once fully written
+	if totalSize == SizeUnknown {
+		totalSize = bytesWritten
+	}
+
+	if rawHasher != nil {
+		// Consume any trailing bytes the decoder didn't need so the digest
+		// covers the whole file
+		if d, ok := source.(rawDrainer); ok {
+			if err := d.drainRaw(); err != nil {
+				f.sendError(opts, fmt.Sprintf("checksum: %v", err))
+				return "", 0, err
+			}
+		}
+		if err := f.checkDigest(opts, fmt.Sprintf("%x", rawHasher.Sum(nil))); err != nil {
+			return "", 0, err
+		}
+	}
+
 	// Verify if requested
 	if opts.Verify {
 		if err := f.verifyImage(ctx, opts, writer, totalSize); err != nil {
@@ -128,17 +380,137 @@ func (f *Flasher) Flash(ctx context.Context, opts Options) (string, int64, error
 		}
 	}
 
-	f.sendComplete(opts, totalSize, finalHash, bytesSkipped)
+	if blockMap != nil {
+		if err := blockMap.Save(opts.BlockMap); err != nil {
+			f.sendError(opts, err.Error())
+			return "", 0, err
+		}
+	}
+
+	// Release the disk and rescan it, so Windows drops the stale partitions
+	// it still shows and mounts the image's
+	writer.Close()
+	f.sendProgress(opts, StageRescanning, 100, totalSize, totalSize, "", bytesSkipped)
+	layout, _ := rescan(opts.DiskNumber)
+
+	// Seed cloud-init once Windows has mounted the freshly written partitions
+	if opts.CloudInit != nil {
+		f.sendProgress(opts, StageCloudInit, 100, totalSize, totalSize, "", bytesSkipped)
+		if _, err := cloudinit.WriteSeed(opts.DiskNumber, opts.CloudInit); err != nil {
+			f.sendError(opts, fmt.Sprintf("cloud-init: %v", err))
+			return "", 0, err
+		}
+	}
+
+	if opts.Label != "" {
+		f.sendProgress(opts, StageLabeling, 100, totalSize, totalSize, "", bytesSkipped)
+		if err := labelFirstVolume(ctx, opts.DiskNumber, layout, opts.Label); err != nil {
+			f.sendError(opts, fmt.Sprintf("label: %v", err))
+			return "", 0, err
+		}
+	}
+
+	f.sendComplete(opts, totalSize, finalHash, bytesSkipped, describeLayout(ctx, opts.DiskNumber, layout))
 	return finalHash, bytesSkipped, nil
 }
 
+// labelMountTimeout is how long a flashed drive's first volume gets to be
+// mounted before labeling it fails.
+const labelMountTimeout = 15 * time.Second
+
+// labelFirstVolume sets the label of the volume on a freshly flashed disk's
+// first partition, waiting for Windows to mount it. If the volume can't be
+// labeled or never mounts, the file system is patched on the raw disk.
+func labelFirstVolume(ctx context.Context, diskNumber int, layout *disk.DriveLayout, name string) error {
+	deadline := time.Now().Add(labelMountTimeout)
+	for {
+		if volume, _ := disk.FirstVolumeByDiskNumber(diskNumber); volume != "" {
+			err := label.SetByPath(volume, name)
+			if err == nil {
+				return nil
+			}
+			return labelFirstPartition(diskNumber, layout, name, err)
+		}
+		if time.Now().After(deadline) {
+			err := fmt.Errorf("no volume on disk %d to label appeared", diskNumber)
+			return labelFirstPartition(diskNumber, layout, name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// labelFirstPartition labels the file system of the disk's first partition
+// offline, after labeling its volume failed with cause.
+func labelFirstPartition(diskNumber int, layout *disk.DriveLayout, name string, cause error) error {
+	if layout == nil {
+		return cause
+	}
+	first, ok := firstDataPartition(layout)
+	if !ok {
+		return cause
+	}
+	if err := labelOffline(diskNumber, first.StartingOffset, name); err != nil {
+		return fmt.Errorf("%w (offline: %v)", cause, err)
+	}
+	return nil
+}
+
 // progressUpdateInterval controls how often progress updates are sent
 // This reduces CPU overhead from calculating/sending progress on every buffer
 const progressUpdateInterval = 100 * time.Millisecond
 
-// writeImage writes the source to the disk with progress updates
-// Returns: finalHash (empty if not calculated), bytesSkipped, error
-func (f *Flasher) writeImage(ctx context.Context, opts Options, source Source, writer *diskWriter, totalSize int64) (string, int64, error) {
+// writeRange writes an aligned buffer at offset (with retry on failure).
+func (f *Flasher) writeRange(opts Options, writer *diskWriter, buf []byte, offset int64) error {
+	written, err := writeWithRetry(writer, buf, offset)
+	if err != nil {
+		f.sendError(opts, fmt.Sprintf("write error at offset %d: %v", offset, err))
+		return err
+	}
+	if written < len(buf) {
+		err := fmt.Errorf("incomplete write at offset %d: wrote %d of %d bytes", offset, written, len(buf))
+		f.sendError(opts, err.Error())
+		return err
+	}
+	return nil
+}
+
+// openBlockMap loads opts.BlockMap for a flash, or starts a new map if the
+// file doesn't exist yet. delta is true when the map describes the drive's
+// current contents. The file is removed until the flash succeeds, as the
+// drive stops matching it once writing starts.
+func openBlockMap(opts Options, writer *diskWriter) (blockMap *BlockMap, delta bool, err error) {
+	if opts.isRegion() || opts.CloudInit != nil {
+		return nil, false, errors.New("a block map can't be combined with a partition, seek/count or cloud-init")
+	}
+	geo, err := disk.GetDiskGeometry(writer.handle)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get disk size: %w", err)
+	}
+
+	blockMap, err = LoadBlockMap(opts.BlockMap)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return newBlockMap(geo.DiskSize, opts.DiskSerial), false, nil
+	case err != nil:
+		return nil, false, err
+	case !blockMap.Matches(geo.DiskSize, opts.DiskSerial):
+		return nil, false, fmt.Errorf("block map %s was made for a different drive", opts.BlockMap)
+	}
+	if err := os.Remove(opts.BlockMap); err != nil {
+		return nil, false, fmt.Errorf("failed to remove block map: %w", err)
+	}
+	return blockMap, true, nil
+}
+
+// writeImage writes the source to the disk with progress updates. Every
+// block written is recorded in blockMap if set; with delta, only the blocks
+// that differ from the map are written.
+// Returns: finalHash (empty if not calculated), bytesWritten, bytesSkipped, error
+func (f *Flasher) writeImage(ctx context.Context, opts Options, source Source, writer *diskWriter, totalSize int64, blockMap *BlockMap, delta bool) (string, int64, int64, error) {
 	// Calculate buffer size in bytes (with fallback to 4MB)
 	bufSize := opts.BufferSize << 20
 	if bufSize <= 0 {
@@ -157,7 +529,7 @@ func (f *Flasher) writeImage(ctx context.Context, opts Options, source Source, w
 	// Initialize hash if requested
 	var hasher hash.Hash
 	if opts.CalculateHash {
-		hasher = sha256.New()
+		hasher, _ = newHash(opts.hashAlgorithm())
 	}
 
 	// Buffer for skip-write comparison
@@ -171,18 +543,33 @@ func (f *Flasher) writeImage(ctx context.Context, opts Options, source Source, w
 		select {
 		case <-ctx.Done():
 			f.sendError(opts, "operation cancelled")
-			return "", 0, ctx.Err()
+			return "", 0, 0, ctx.Err()
 		default:
 		}
 
-		// Read from source
-		n, err := source.Read(buffer)
+		// Fill the whole buffer so every write but the last stays aligned
+		// (decompressors often return short reads)
+		n, err := io.ReadFull(source, buffer)
 		if n == 0 && err != nil {
-			if err.Error() == "EOF" {
+			if err == io.EOF {
 				break
 			}
 			f.sendError(opts, fmt.Sprintf("read error: %v", err))
-			return "", 0, err
+			return "", 0, 0, err
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			f.sendError(opts, fmt.Sprintf("read error: %v", err))
+			return "", 0, 0, err
+		}
+		offset := opts.Seek + bytesWritten
+		if writer.limit > 0 && offset+int64(n) > writer.limit {
+			target := "device capacity"
+			if opts.Partition > 0 {
+				target = "partition size"
+			}
+			err := fmt.Errorf("image exceeds %s (%s)", target, FormatBytes(writer.limit))
+			f.sendError(opts, err.Error())
+			return "", 0, 0, err
 		}
 
 		if n == 0 {
@@ -198,15 +585,46 @@ func (f *Flasher) writeImage(ctx context.Context, opts Options, source Source, w
 		writeSize := alignSize(n)
 		writeBuffer := buffer[:writeSize]
 
-		// Zero-pad if needed (optimized: use clear instead of byte-by-byte loop)
+		// Zero-pad if needed (optimized: use clear instead of byte-by-byte loop).
+		// When writing a region, keep the existing device bytes past the end of
+		// the data instead so the padding doesn't clobber them.
 		if writeSize > n {
 			clear(writeBuffer[n:writeSize])
+			if opts.isRegion() {
+				tailOffset := int64(writeSize - alignment)
+				tail := alignedBuffer(alignment)
+				if _, err := writer.ReadAt(tail, offset+tailOffset); err == nil {
+					copy(writeBuffer[n:writeSize], tail[n-int(tailOffset):])
+				}
+			}
 		}
 
-		// Skip-write: check if data on disk is already identical
+		// Sparse write: seek past all-zero blocks instead of writing them
 		shouldWrite := true
-		if opts.SkipUnchanged {
-			_, readErr := writer.ReadAt(diskBuffer[:writeSize], bytesWritten)
+		if opts.Sparse && isZero(buffer[:n]) {
+			shouldWrite = false
+			bytesSkipped += int64(n)
+		}
+
+		// Block map: the map knows what's on the drive, so only write the
+		// blocks that changed
+		if blockMap != nil {
+			changed := blockMap.updateBuffer(offset, buffer[:n], writeSize)
+			if delta && shouldWrite {
+				shouldWrite = false
+				bytesSkipped += int64(n)
+				for _, c := range changed {
+					if err := f.writeRange(opts, writer, writeBuffer[c.offset:c.offset+c.length], offset+c.offset); err != nil {
+						return "", 0, 0, err
+					}
+					bytesSkipped -= min(c.length, int64(n)-c.offset)
+				}
+			}
+		}
+
+		// Skip-write: check if data on disk is already identical
+		if shouldWrite && opts.SkipUnchanged {
+			_, readErr := writer.ReadAt(diskBuffer[:writeSize], offset)
 			if readErr == nil && bytes.Equal(buffer[:n], diskBuffer[:n]) {
 				shouldWrite = false
 				bytesSkipped += int64(n)
@@ -215,14 +633,8 @@ func (f *Flasher) writeImage(ctx context.Context, opts Options, source Source, w
 
 		// Write to disk only if needed (with retry on failure)
 		if shouldWrite {
-			written, err := f.writeWithRetry(writer, writeBuffer, bytesWritten)
-			if err != nil {
-				f.sendError(opts, fmt.Sprintf("write error at offset %d: %v", bytesWritten, err))
-				return "", 0, err
-			}
-			if written < writeSize {
-				f.sendError(opts, fmt.Sprintf("incomplete write at offset %d: wrote %d of %d bytes", bytesWritten, written, writeSize))
-				return "", 0, fmt.Errorf("incomplete write at offset %d: wrote %d of %d bytes", bytesWritten, written, writeSize)
+			if err := f.writeRange(opts, writer, writeBuffer, offset); err != nil {
+				return "", 0, 0, err
 			}
 		}
 
@@ -241,11 +653,8 @@ func (f *Flasher) writeImage(ctx context.Context, opts Options, source Source, w
 				speed = formatSpeed(bytesPerSec)
 			}
 
-			percentage := int(float64(bytesWritten) / float64(totalSize) * 100)
-			if percentage > 100 {
-				percentage = 100 // Cap at 100% (can exceed if size was estimated)
-			}
-			f.sendProgress(opts, StageWriting, percentage, bytesWritten, totalSize, speed)
+			percentage := sourcePercent(source, bytesWritten, totalSize)
+			f.sendProgress(opts, StageWriting, percentage, bytesWritten, totalSize, speed, bytesSkipped)
 		}
 	}
 
@@ -255,18 +664,23 @@ func (f *Flasher) writeImage(ctx context.Context, opts Options, source Source, w
 		finalHash = fmt.Sprintf("%x", hasher.Sum(nil))
 	}
 
-	return finalHash, bytesSkipped, nil
+	return finalHash, bytesWritten, bytesSkipped, nil
 }
 
 // verifyImage reads back the written data and compares with source
 func (f *Flasher) verifyImage(ctx context.Context, opts Options, writer *diskWriter, totalSize int64) error {
 	// Reopen the source for verification
-	source, err := OpenSource(opts.ImagePath)
-	if err != nil {
-		f.sendError(opts, fmt.Sprintf("verify: failed to reopen source: %v", err))
-		return err
+	source := opts.VerifySource
+	if source == nil {
+		var err error
+		sourceOpts := opts.sourceOptions()
+		sourceOpts.HTTP.Context = ctx
+		if source, err = OpenSourceWithOptions(opts.ImagePath, sourceOpts); err != nil {
+			f.sendError(opts, fmt.Sprintf("verify: failed to reopen source: %v", err))
+			return err
+		}
+		defer source.Close()
 	}
-	defer source.Close()
 
 	// Calculate buffer size in bytes (with fallback to 4MB)
 	bufSize := opts.BufferSize << 20
@@ -284,7 +698,7 @@ func (f *Flasher) verifyImage(ctx context.Context, opts Options, writer *diskWri
 	startTime := time.Now()
 	lastProgressUpdate := startTime
 
-	f.sendProgress(opts, StageVerifying, 0, 0, totalSize, "")
+	f.sendProgress(opts, StageVerifying, 0, 0, totalSize, "", 0)
 
 	for {
 		select {
@@ -294,15 +708,20 @@ func (f *Flasher) verifyImage(ctx context.Context, opts Options, writer *diskWri
 		default:
 		}
 
-		// Read from source
-		n, err := source.Read(sourceBuffer)
+		// Read from source (full buffers keep disk reads aligned)
+		n, err := io.ReadFull(source, sourceBuffer)
 		if n == 0 && err != nil {
-			if err.Error() == "EOF" {
+			if err == io.EOF {
 				break
 			}
 			f.sendError(opts, fmt.Sprintf("verify: read source error: %v", err))
 			return err
 		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			f.sendError(opts, fmt.Sprintf("verify: read source error: %v", err))
+			return err
+		}
+		offset := opts.Seek + bytesVerified
 
 		if n == 0 {
 			break
@@ -310,16 +729,16 @@ func (f *Flasher) verifyImage(ctx context.Context, opts Options, writer *diskWri
 
 		// Read from disk (aligned)
 		readSize := alignSize(n)
-		_, err = writer.ReadAt(diskBuffer[:readSize], bytesVerified)
+		_, err = writer.ReadAt(diskBuffer[:readSize], offset)
 		if err != nil {
-			f.sendError(opts, fmt.Sprintf("verify: read disk error at offset %d: %v", bytesVerified, err))
+			f.sendError(opts, fmt.Sprintf("verify: read disk error at offset %d: %v", offset, err))
 			return err
 		}
 
 		// Compare only the actual data bytes (not padding)
 		if !bytes.Equal(sourceBuffer[:n], diskBuffer[:n]) {
-			f.sendError(opts, fmt.Sprintf("verify: data mismatch at offset %d", bytesVerified))
-			return fmt.Errorf("verification failed: data mismatch at offset %d", bytesVerified)
+			f.sendError(opts, fmt.Sprintf("verify: data mismatch at offset %d", offset))
+			return fmt.Errorf("verification failed: data mismatch at offset %d", offset)
 		}
 
 		bytesVerified += int64(n)
@@ -337,11 +756,8 @@ func (f *Flasher) verifyImage(ctx context.Context, opts Options, writer *diskWri
 				speed = formatSpeed(bytesPerSec)
 			}
 
-			percentage := int(float64(bytesVerified) / float64(totalSize) * 100)
-			if percentage > 100 {
-				percentage = 100 // Cap at 100% (can exceed if size was estimated)
-			}
-			f.sendProgress(opts, StageVerifying, percentage, bytesVerified, totalSize, speed)
+			percentage := sourcePercent(source, bytesVerified, totalSize)
+			f.sendProgress(opts, StageVerifying, percentage, bytesVerified, totalSize, speed, 0)
 		}
 	}
 
@@ -351,7 +767,7 @@ func (f *Flasher) verifyImage(ctx context.Context, opts Options, writer *diskWri
 // writeWithRetry writes data to disk, retrying on failure or partial writes.
 // On write error: retries up to maxWriteRetries times with retryDelay between attempts.
 // On partial write: retries the remaining bytes up to maxWriteRetries times.
-func (f *Flasher) writeWithRetry(writer *diskWriter, data []byte, offset int64) (int, error) {
+func writeWithRetry(writer *diskWriter, data []byte, offset int64) (int, error) {
 	totalWritten := 0
 	remaining := data
 	currentOffset := offset
@@ -384,6 +800,35 @@ func (f *Flasher) writeWithRetry(writer *diskWriter, data []byte, offset int64)
 	return totalWritten, fmt.Errorf("partial write after %d retries: wrote %d of %d bytes", maxWriteRetries, totalWritten, len(data))
 }
 
+// forEachDiskChunk walks the first size bytes of a disk in chunks of at most
+// chunkSize bytes, calling fn with each chunk's offset and length in order,
+// and progress (if set) with the bytes done so far at most once per interval.
+// It stops at the first error from fn, or with ctx's error once cancelled.
+// The disk size is a sector multiple, as are the chunk sizes used, so every
+// chunk starts and ends on a sector boundary as unbuffered disk I/O requires.
+func forEachDiskChunk(ctx context.Context, size int64, chunkSize int, interval time.Duration, fn func(offset int64, n int) error, progress func(done int64)) error {
+	lastProgressUpdate := time.Now()
+	for offset := int64(0); offset < size; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n := int(min(int64(chunkSize), size-offset))
+		if err := fn(offset, n); err != nil {
+			return err
+		}
+		offset += int64(n)
+
+		if progress != nil {
+			if now := time.Now(); now.Sub(lastProgressUpdate) >= interval {
+				lastProgressUpdate = now
+				progress(offset)
+			}
+		}
+	}
+	return nil
+}
+
 // speedTest writes up to 10MB of zeroes to verify the drive is responsive.
 // Stops early if 1 second has elapsed. Returns an error if zero blocks
 // were written (likely a fake or unresponsive drive).
@@ -414,7 +859,7 @@ func (f *Flasher) speedTest(writer *diskWriter) error {
 	return nil
 }
 
-func (f *Flasher) sendProgress(opts Options, stage string, percentage int, bytesWritten, totalBytes int64, speed string) {
+func (f *Flasher) sendProgress(opts Options, stage string, percentage int, bytesWritten, totalBytes int64, speed string, bytesSkipped int64) {
 	select {
 	case f.progressChan <- Progress{
 		Stage:        stage,
@@ -423,6 +868,7 @@ func (f *Flasher) sendProgress(opts Options, stage string, percentage int, bytes
 		TotalBytes:   totalBytes,
 		Speed:        speed,
 		Status:       StatusInProgress,
+		BytesSkipped: bytesSkipped,
 	}:
 	default:
 	}
@@ -439,21 +885,68 @@ func (f *Flasher) sendError(opts Options, errMsg string) {
 	}
 }
 
-func (f *Flasher) sendComplete(opts Options, totalBytes int64, hash string, bytesSkipped int64) {
+func (f *Flasher) sendComplete(opts Options, totalBytes int64, hash string, bytesSkipped int64, partitions []Partition) {
+	hashAlgorithm := ""
+	if hash != "" {
+		hashAlgorithm = opts.hashAlgorithm()
+	}
 	select {
 	case f.progressChan <- Progress{
-		Stage:        StageComplete,
-		Percentage:   100,
-		BytesWritten: totalBytes,
-		TotalBytes:   totalBytes,
-		Status:       StatusComplete,
-		Hash:         hash,
-		BytesSkipped: bytesSkipped,
+		Stage:         StageComplete,
+		Percentage:    100,
+		BytesWritten:  totalBytes,
+		TotalBytes:    totalBytes,
+		Status:        StatusComplete,
+		Hash:          hash,
+		HashAlgorithm: hashAlgorithm,
+		BytesSkipped:  bytesSkipped,
+		Partitions:    partitions,
 	}:
 	default:
 	}
 }
 
+// progressPercent returns done as a percentage of total, capped at 100.
+// Returns 0 when the total is unknown (SizeUnknown) or zero.
+func progressPercent(done, total int64) int {
+	if total <= 0 {
+		return 0
+	}
+	percentage := int(float64(done) / float64(total) * 100)
+	if percentage > 100 {
+		percentage = 100 // Cap at 100% (can exceed if size was estimated)
+	}
+	return percentage
+}
+
+// sourcePercent returns progress through source. When the uncompressed size
+// is unknown, it falls back to the fraction of compressed input consumed.
+func sourcePercent(source Source, done, total int64) int {
+	if total == SizeUnknown {
+		if cp, ok := source.(CompressedProgress); ok {
+			consumed, compressedTotal := cp.CompressedProgress()
+			return progressPercent(consumed, compressedTotal)
+		}
+	}
+	return progressPercent(done, total)
+}
+
+// zeroBlock is compared against in chunks so isZero can use the optimized
+// bytes.Equal instead of a byte-by-byte loop.
+var zeroBlock = make([]byte, 64<<10)
+
+// isZero reports whether b contains only zero bytes.
+func isZero(b []byte) bool {
+	for len(b) > 0 {
+		n := min(len(b), len(zeroBlock))
+		if !bytes.Equal(b[:n], zeroBlock[:n]) {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
+
 // formatSpeed formats bytes per second into human readable string
 func formatSpeed(bytesPerSec float64) string {
 	const (
@@ -0,0 +1,135 @@
+package flash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPOptions controls how URL sources are fetched.
+type HTTPOptions struct {
+	// Retries is how many times a failed connection or interrupted download
+	// is retried. Interrupted downloads resume from the last received byte
+	// with a Range request. 0 disables retrying.
+	Retries int
+	// RetryDelay is the wait before the first retry; it doubles on every
+	// further attempt, up to one minute.
+	RetryDelay time.Duration
+	// Header holds extra request headers, e.g. an Artifactory X-JFrog-Art-Api key.
+	Header http.Header
+	// BearerToken, if set, is sent as "Authorization: Bearer <token>".
+	BearerToken string
+	// Username and Password, if Username is set, are sent as HTTP basic auth.
+	Username string
+	Password string
+	// Proxy is the proxy URL to use. Empty falls back to the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string
+	// Context, if set, cancels requests, interrupted downloads and the waits
+	// between retries.
+	Context context.Context
+}
+
+// ctx returns o.Context, or the background context if none is set.
+func (o HTTPOptions) ctx() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
+}
+
+// newRequest builds a GET request for rawURL carrying the configured
+// headers and credentials. Go drops the Authorization header when a
+// redirect leaves the original domain, but copies every other header, so
+// client strips the --header values on such redirects: API keys like
+// X-JFrog-Art-Api must not leak to e.g. a CDN either.
+func (o HTTPOptions) newRequest(rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(o.ctx(), http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	for name, values := range o.Header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	switch {
+	case o.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+o.BearerToken)
+	case o.Username != "":
+		req.SetBasicAuth(o.Username, o.Password)
+	}
+	return req, nil
+}
+
+// client returns the HTTP client to fetch with: the shared client, or a copy
+// routed through o.Proxy and keeping o.Header to the original host when
+// either is given.
+func (o HTTPOptions) client() (*http.Client, error) {
+	if o.Proxy == "" && len(o.Header) == 0 {
+		return httpClient, nil
+	}
+
+	client := &http.Client{Transport: httpClient.Transport}
+	if o.Proxy != "" {
+		proxyURL, err := url.Parse(o.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL: %s", o.Proxy)
+		}
+		transport := httpClient.Transport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		client.Transport = transport
+	}
+	if len(o.Header) > 0 {
+		client.CheckRedirect = o.stripHeadersOnRedirect
+	}
+	return client, nil
+}
+
+// stripHeadersOnRedirect removes the configured extra headers from a
+// redirect to another host, keeping Go's default limit of 10 redirects.
+func (o HTTPOptions) stripHeadersOnRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		for name := range o.Header {
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+// get fetches rawURL with the configured credentials and proxy.
+func (o HTTPOptions) get(rawURL string) (*http.Response, error) {
+	client, err := o.client()
+	if err != nil {
+		return nil, err
+	}
+	req, err := o.newRequest(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// OpenURL starts downloading rawURL without decompressing it, retrying and
+// resuming per opts. It returns the body, the file name the server suggests
+// (from Content-Disposition or the URL path) and the Content-Length, or
+// SizeUnknown if the server didn't send one.
+func OpenURL(rawURL string, opts HTTPOptions) (io.ReadCloser, string, int64, error) {
+	body, resp, err := openResumable(rawURL, opts)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	name, _ := detectURLType(rawURL, resp)
+	size := resp.ContentLength
+	if size <= 0 {
+		size = SizeUnknown
+	}
+	return body, name, size, nil
+}
@@ -0,0 +1,75 @@
+package flash
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"golang.org/x/sys/windows"
+)
+
+// InitializeResult describes an initialized drive.
+type InitializeResult struct {
+	DiskNumber int    `json:"diskNumber"`
+	Style      string `json:"style"`  // mbr or gpt
+	DiskID     string `json:"diskId"` // MBR signature (8 hex digits) or GPT disk GUID
+	Duration   string `json:"duration"`
+}
+
+// ValidatePartitionStyle checks if the partition style is supported
+func ValidatePartitionStyle(style string) error {
+	switch strings.ToLower(style) {
+	case "mbr", "gpt":
+		return nil
+	default:
+		return fmt.Errorf("unsupported partition style: %s (supported: gpt, mbr)", style)
+	}
+}
+
+// Initialize cleans a drive (see Clean) and writes an empty MBR or GPT
+// partition table with a new disk signature or GUID, without creating any
+// partitions, like diskpart's clean followed by convert.
+func Initialize(diskNumber int, driveLetter, style string) (*InitializeResult, error) {
+	start := time.Now()
+	style = strings.ToLower(style)
+	if err := ValidatePartitionStyle(style); err != nil {
+		return nil, err
+	}
+
+	if _, err := Clean(diskNumber, driveLetter); err != nil {
+		return nil, err
+	}
+
+	handle, err := disk.OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(handle)
+
+	result := &InitializeResult{DiskNumber: diskNumber, Style: style}
+	if style == "gpt" {
+		id, err := windows.GenerateGUID()
+		if err != nil {
+			return nil, fmt.Errorf("generate disk GUID: %w", err)
+		}
+		if err := disk.CreateGPTDisk(handle, id); err != nil {
+			return nil, err
+		}
+		result.DiskID = id.String()
+	} else {
+		signature := rand.Uint32()
+		if err := disk.CreateMBRDisk(handle, signature); err != nil {
+			return nil, err
+		}
+		result.DiskID = fmt.Sprintf("%08X", signature)
+	}
+
+	if err := disk.UpdateDiskProperties(handle); err != nil {
+		return nil, fmt.Errorf("drive initialized but rescan failed: %w", err)
+	}
+
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	return result, nil
+}
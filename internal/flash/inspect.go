@@ -0,0 +1,375 @@
+package flash
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/encoding"
+)
+
+// inspectPrefixSize is how much of the image is kept in memory for layout
+// and ISO9660 analysis when the source can't be read at random.
+const inspectPrefixSize = 16 << 20
+
+// fsProbeSize is how much of each partition is read to identify its filesystem.
+const fsProbeSize = 4096
+
+// ImageInfo describes an image without writing it anywhere.
+type ImageInfo struct {
+	Name           string            `json:"name"`
+	Size           int64             `json:"size"` // Uncompressed size, SizeUnknown if not determined
+	Format         string            `json:"format"`
+	PartitionTable string            `json:"partitionTable,omitempty"`
+	Partitions     []ImagePartition  `json:"partitions,omitempty"`
+	Filesystem     string            `json:"filesystem,omitempty"` // For bare filesystem images
+	VolumeLabel    string            `json:"volumeLabel,omitempty"`
+	OS             string            `json:"os,omitempty"`
+	Hashes         map[string]string `json:"hashes,omitempty"`
+	Warnings       []string          `json:"warnings,omitempty"`
+}
+
+// ImagePartition is one entry of an image's partition table.
+type ImagePartition struct {
+	Number     int    `json:"number"`
+	Type       string `json:"type"` // MBR type byte (0x0C) or GPT type GUID
+	TypeName   string `json:"typeName,omitempty"`
+	Name       string `json:"name,omitempty"` // GPT partition name
+	Offset     int64  `json:"offset"`
+	Size       int64  `json:"size"`
+	Bootable   bool   `json:"bootable,omitempty"`
+	Filesystem string `json:"filesystem,omitempty"`
+	Label      string `json:"label,omitempty"`
+}
+
+// InspectOptions controls InspectImage.
+type InspectOptions struct {
+	Source SourceOptions
+	// HashAlgorithms lists the digests to compute over the uncompressed
+	// image. Computing any of them reads the whole image.
+	HashAlgorithms []string
+}
+
+// InspectImage opens any supported source and reports its size, partition
+// layout, filesystems, detected OS and (optionally) hashes. onProgress, if
+// non-nil, is called with bytes read and the total (SizeUnknown if unknown).
+func InspectImage(ctx context.Context, path string, opts InspectOptions, onProgress func(done, total int64)) (*ImageInfo, error) {
+	hashers := make(map[string]hash.Hash, len(opts.HashAlgorithms))
+	for _, algo := range opts.HashAlgorithms {
+		h, err := newHash(strings.ToLower(algo))
+		if err != nil {
+			return nil, err
+		}
+		hashers[strings.ToLower(algo)] = h
+	}
+
+	opts.Source.HTTP.Context = ctx
+	src, err := OpenSourceWithOptions(path, opts.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	info := &ImageInfo{Name: src.Name(), Size: src.Size()}
+	total := src.Size()
+
+	var writers []io.Writer
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+	hashWriter := io.MultiWriter(writers...)
+
+	// Read the prefix first; it holds the partition tables and usually the
+	// ISO9660 directory tree.
+	prefix := make([]byte, inspectPrefixSize)
+	n, err := io.ReadFull(src, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	prefix = prefix[:n]
+	hashWriter.Write(prefix)
+	read := int64(n)
+	eof := err != nil
+	if onProgress != nil {
+		onProgress(read, total)
+	}
+
+	validation := ValidateImageHeader(prefix[:min(len(prefix), validateHeaderSize)], SizeUnknown)
+	info.Format = validation.Format
+	info.Warnings = append(info.Warnings, validation.Errors...)
+
+	switch validation.Format {
+	case ImageFormatMBR, ImageFormatGPT, ImageFormatISO9660:
+		info.Partitions, info.PartitionTable = parsePartitions(prefix)
+	case ImageFormatFilesystem:
+		info.Filesystem, info.VolumeLabel = probeFilesystem(prefix)
+	}
+
+	// Partitions starting past the prefix are probed as the stream passes them
+	probes := make(map[int][]byte)
+	var lastProbe int64
+	for i, p := range info.Partitions {
+		if p.Offset < 0 || p.Offset > math.MaxInt64-fsProbeSize {
+			continue
+		}
+		if p.Offset+fsProbeSize <= int64(len(prefix)) {
+			probes[i] = prefix[p.Offset : p.Offset+fsProbeSize]
+		} else {
+			lastProbe = max(lastProbe, p.Offset+fsProbeSize)
+		}
+	}
+
+	if !eof && (len(hashers) > 0 || lastProbe > read) {
+		buf := GetBuffer(defaultBufferSize)
+		defer PutBuffer(defaultBufferSize, buf)
+
+		for len(hashers) > 0 || lastProbe > read {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			n, err := src.Read(buf)
+			if n > 0 {
+				chunk := buf[:n]
+				hashWriter.Write(chunk)
+				for i, p := range info.Partitions {
+					if _, done := probes[i]; done {
+						continue
+					}
+					if p.Offset >= read && p.Offset+fsProbeSize <= read+int64(n) {
+						start := p.Offset - read
+						probes[i] = bytes.Clone(chunk[start : start+fsProbeSize])
+					}
+				}
+				read += int64(n)
+				if onProgress != nil {
+					onProgress(read, total)
+				}
+			}
+			if err == io.EOF {
+				eof = true
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read image: %w", err)
+			}
+		}
+	}
+
+	if eof {
+		info.Size = read
+	}
+	for i := range info.Partitions {
+		if probe, ok := probes[i]; ok {
+			info.Partitions[i].Filesystem, info.Partitions[i].Label = probeFilesystem(probe)
+		}
+	}
+
+	if len(hashers) > 0 {
+		info.Hashes = make(map[string]string, len(hashers))
+		for algo, h := range hashers {
+			info.Hashes[algo] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+
+	if info.Format == ImageFormatISO9660 {
+		// Local ISOs can be read at random; anything else (compressed,
+		// remote) is limited to what was buffered.
+		var r io.ReaderAt = bytes.NewReader(prefix)
+		if rs, ok := src.(*rawSource); ok && !rs.hasBinHeader {
+			r = rs.file
+		}
+		info.VolumeLabel, info.OS = inspectISO(r)
+	}
+	if info.OS == "" {
+		labels := []string{info.VolumeLabel}
+		for _, p := range info.Partitions {
+			labels = append(labels, p.Label, p.Name)
+		}
+		info.OS = osFromLabels(labels...)
+	}
+
+	if eof && info.Size != SizeUnknown {
+		end := int64(0)
+		for _, p := range info.Partitions {
+			end = max(end, p.Offset+p.Size)
+		}
+		if end > info.Size {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("image is truncated: partitions extend to %s but the image is only %s",
+				FormatBytes(end), FormatBytes(info.Size)))
+		}
+	}
+
+	return info, nil
+}
+
+// parsePartitions lists the partitions of the MBR or GPT at the start of
+// header, returning them and the table type ("mbr" or "gpt").
+func parsePartitions(header []byte) ([]ImagePartition, string) {
+	if len(header) < 512 || header[510] != 0x55 || header[511] != 0xAA || isVolumeBootRecord(header) {
+		return nil, ""
+	}
+
+	var parts []ImagePartition
+	for i := 0; i < 4; i++ {
+		entry := header[446+i*16 : 446+(i+1)*16]
+		partType := entry[4]
+		if partType == 0 {
+			continue
+		}
+		if partType == 0xEE {
+			if gpt := parseGPT(header); gpt != nil {
+				return gpt, ImageFormatGPT
+			}
+		}
+		parts = append(parts, ImagePartition{
+			Number:   i + 1,
+			Type:     fmt.Sprintf("0x%02X", partType),
+			TypeName: mbrTypeNames[partType],
+			Offset:   int64(binary.LittleEndian.Uint32(entry[8:12])) * 512,
+			Size:     int64(binary.LittleEndian.Uint32(entry[12:16])) * 512,
+			Bootable: entry[0] == 0x80,
+		})
+	}
+	return parts, ImageFormatMBR
+}
+
+// parseGPT lists the partitions of a GPT, trying 512- and 4096-byte sectors.
+func parseGPT(header []byte) []ImagePartition {
+	for _, sectorSize := range []int64{512, 4096} {
+		if int64(len(header)) < sectorSize+92 || string(header[sectorSize:sectorSize+8]) != "EFI PART" {
+			continue
+		}
+		gpt := header[sectorSize:]
+		// Every value comes from the image, which may be corrupt or
+		// hostile: bounds are checked before any multiplication
+		entriesLBA := binary.LittleEndian.Uint64(gpt[72:80])
+		numEntries := int64(binary.LittleEndian.Uint32(gpt[80:84]))
+		entrySize := int64(binary.LittleEndian.Uint32(gpt[84:88]))
+		if entriesLBA < 2 || entriesLBA > uint64(len(header))/uint64(sectorSize) || entrySize < 128 {
+			return nil
+		}
+		entriesStart := int64(entriesLBA) * sectorSize
+		if numEntries > (int64(len(header))-entriesStart)/entrySize {
+			return nil
+		}
+
+		var parts []ImagePartition
+		for i := int64(0); i < numEntries; i++ {
+			entry := header[entriesStart+i*entrySize : entriesStart+(i+1)*entrySize]
+			if isZero(entry[0:16]) {
+				continue
+			}
+			typeGUID := formatGUID(entry[0:16])
+			first := binary.LittleEndian.Uint64(entry[32:40])
+			last := binary.LittleEndian.Uint64(entry[40:48])
+			if last < first || last >= uint64(math.MaxInt64/sectorSize) {
+				continue // Not a partition that can be located
+			}
+			parts = append(parts, ImagePartition{
+				Number:   int(i) + 1,
+				Type:     typeGUID,
+				TypeName: gptTypeNames[typeGUID],
+				Name:     encoding.DecodeUTF16LE(entry[56:128]),
+				Offset:   int64(first) * sectorSize,
+				Size:     int64(last-first+1) * sectorSize,
+			})
+		}
+		return parts
+	}
+	return nil
+}
+
+// formatGUID renders a mixed-endian on-disk GUID in its usual text form.
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10], b[10:16])
+}
+
+// probeFilesystem identifies the filesystem starting at b and its label.
+func probeFilesystem(b []byte) (fs, label string) {
+	if len(b) < 512 {
+		return "", ""
+	}
+	switch {
+	case string(b[3:11]) == "NTFS    ":
+		return "NTFS", ""
+	case string(b[3:11]) == "EXFAT   ":
+		return "exFAT", ""
+	case string(b[82:87]) == "FAT32":
+		return "FAT32", fatLabel(b[71:82])
+	case string(b[54:59]) == "FAT16" || string(b[54:59]) == "FAT12":
+		return string(b[54:59]), fatLabel(b[43:54])
+	case string(b[0:4]) == "hsqs":
+		return "squashfs", ""
+	}
+
+	if len(b) >= 1024+136 && binary.LittleEndian.Uint16(b[1024+56:1024+58]) == 0xEF53 {
+		sb := b[1024:]
+		fs = "ext2"
+		if binary.LittleEndian.Uint32(sb[92:96])&0x4 != 0 { // has_journal
+			fs = "ext3"
+		}
+		if binary.LittleEndian.Uint32(sb[96:100])&0x40 != 0 { // extents
+			fs = "ext4"
+		}
+		return fs, strings.TrimRight(string(sb[120:136]), "\x00")
+	}
+	return "", ""
+}
+
+// fatLabel returns the volume label from a FAT boot sector, if one was set.
+func fatLabel(b []byte) string {
+	label := strings.TrimSpace(string(b))
+	if label == "NO NAME" {
+		return ""
+	}
+	return label
+}
+
+var mbrTypeNames = map[byte]string{
+	0x01: "FAT12",
+	0x04: "FAT16 <32M",
+	0x05: "Extended",
+	0x06: "FAT16",
+	0x07: "NTFS/exFAT",
+	0x0B: "FAT32",
+	0x0C: "FAT32 (LBA)",
+	0x0E: "FAT16 (LBA)",
+	0x0F: "Extended (LBA)",
+	0x17: "Hidden NTFS",
+	0x27: "Windows recovery",
+	0x82: "Linux swap",
+	0x83: "Linux",
+	0x8E: "Linux LVM",
+	0xA5: "FreeBSD",
+	0xEE: "GPT protective",
+	0xEF: "EFI System",
+}
+
+var gptTypeNames = map[string]string{
+	"C12A7328-F81F-11D2-BA4B-00A0C93EC93B": "EFI System",
+	"21686148-6449-6E6F-744E-656564454649": "BIOS boot",
+	"E3C9E316-0B5C-4DB8-817D-F92DF00215AE": "Microsoft reserved",
+	"EBD0A0A2-B9E5-4433-87C0-68B6B72699C7": "Microsoft basic data",
+	"DE94BBA4-06D1-4D40-A16A-BFD50179D6AC": "Windows recovery",
+	"0FC63DAF-8483-4772-8E79-3D69D8477DE4": "Linux filesystem",
+	"4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709": "Linux root (x86-64)",
+	"B921B045-1DF0-41C3-AF44-4C6F280D3FAE": "Linux root (ARM64)",
+	"0657FD6D-A4AB-43C4-84E5-0933C84B4F4F": "Linux swap",
+	"E6D6D379-F507-44C2-A23C-238F2A3DF928": "Linux LVM",
+	"BC13C2FF-59E6-4262-A352-B275FD6F7172": "Linux extended boot",
+	"FE3A2A5D-4F32-41A7-B725-ACCC3285A309": "ChromeOS kernel",
+	"3CB8E202-3B7E-47DD-8A3C-7FF2A13CFCEC": "ChromeOS rootfs",
+	"2E0A753D-9E48-43B0-8337-B15192CB1B5E": "ChromeOS reserved",
+	"CAB6E88E-ABF3-4102-A07A-D4BB9BE3C1D3": "ChromeOS firmware",
+	"516E7CB4-6ECF-11D6-8FF8-00022D09712B": "FreeBSD",
+}
@@ -0,0 +1,122 @@
+package flash
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/kdomanski/iso9660"
+	"github.com/lazaroagomez/wusbkit/internal/iso"
+)
+
+// isoMaxFileSize bounds how much of a metadata file is read from an ISO.
+const isoMaxFileSize = 64 << 10
+
+// inspectISO returns the volume label of an ISO9660 image and, if it can be
+// told, the operating system or distribution it installs.
+func inspectISO(r io.ReaderAt) (label, osName string) {
+	img, err := iso9660.OpenImage(r)
+	if err != nil {
+		return "", ""
+	}
+	label, _ = img.Label()
+	label = strings.TrimSpace(label)
+	root, err := img.RootDir()
+	if err != nil {
+		return label, osFromLabels(label)
+	}
+
+	read := func(path string) []byte {
+		f := iso.LookupPath(root, path)
+		if f == nil || f.IsDir() {
+			return nil
+		}
+		data, _ := io.ReadAll(io.LimitReader(f.Reader(), isoMaxFileSize))
+		return data
+	}
+
+	for _, path := range []string{"etc/os-release", "usr/lib/os-release"} {
+		if name := parseOSRelease(read(path)); name != "" {
+			return label, name
+		}
+	}
+	if info := read(".disk/info"); info != nil {
+		line, _, _ := strings.Cut(string(info), "\n")
+		if line = strings.TrimSpace(line); line != "" {
+			return label, line
+		}
+	}
+	if name := parseTreeInfo(read(".treeinfo")); name != "" {
+		return label, name
+	}
+	for _, path := range []string{"sources/install.wim", "sources/install.esd", "sources/boot.wim"} {
+		if iso.LookupPath(root, path) != nil {
+			return label, "Windows"
+		}
+	}
+	return label, osFromLabels(label)
+}
+
+// parseOSRelease returns PRETTY_NAME (or NAME VERSION) from an os-release file.
+func parseOSRelease(data []byte) string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+	if fields["PRETTY_NAME"] != "" {
+		return fields["PRETTY_NAME"]
+	}
+	return strings.TrimSpace(fields["NAME"] + " " + fields["VERSION"])
+}
+
+// parseTreeInfo returns "name version" from a Fedora/RHEL-style .treeinfo,
+// which keeps them in a [release] (or older [general]) section.
+func parseTreeInfo(data []byte) string {
+	sections := make(map[string]map[string]string)
+	var section string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if sections[section] == nil {
+			sections[section] = make(map[string]string)
+		}
+		sections[section][strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	for _, name := range []string{"release", "general"} {
+		if s := sections[name]; s["name"] != "" {
+			return strings.TrimSpace(s["name"] + " " + s["version"])
+		}
+	}
+	return ""
+}
+
+// osFromLabels guesses the operating system from well-known volume labels.
+func osFromLabels(labels ...string) string {
+	for _, label := range labels {
+		upper := strings.ToUpper(label)
+		switch {
+		case strings.Contains(upper, "X64FRE"), strings.Contains(upper, "X86FRE"),
+			strings.Contains(upper, "A64FRE"), strings.HasPrefix(upper, "ESD-"):
+			return "Windows"
+		case upper == "BOOTFS":
+			return "Raspberry Pi OS"
+		case upper == "SYSTEM-BOOT":
+			return "Ubuntu (Raspberry Pi)"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,481 @@
+package flash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// maxChainClusters bounds a directory's cluster chain, so a corrupt FAT
+// can't loop forever.
+const maxChainClusters = 65536
+
+// fatLabelChars are the characters Windows refuses in FAT and exFAT labels.
+const fatLabelChars = `*?.,;:/\|+=<>[]"`
+
+// rawVolume reads and writes a file system's structures on the raw disk,
+// at offsets relative to the start of its partition. Unbuffered I/O needs
+// aligned transfers, so partial writes read the surrounding blocks first.
+type rawVolume struct {
+	w    *diskWriter
+	base int64
+}
+
+func (v *rawVolume) span(off int64, n int) (start int64, size int) {
+	start = (v.base + off) / alignment * alignment
+	end := (v.base + off + int64(n) + alignment - 1) / alignment * alignment
+	return start, int(end - start)
+}
+
+func (v *rawVolume) read(off int64, n int) ([]byte, error) {
+	start, size := v.span(off, n)
+	buf := alignedBuffer(size)
+	if _, err := v.w.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+	skip := v.base + off - start
+	return append([]byte(nil), buf[skip:skip+int64(n)]...), nil
+}
+
+func (v *rawVolume) write(off int64, data []byte) error {
+	start, size := v.span(off, len(data))
+	buf := alignedBuffer(size)
+	if _, err := v.w.ReadAt(buf, start); err != nil {
+		return err
+	}
+	copy(buf[v.base+off-start:], data)
+	_, err := v.w.WriteAt(buf, start)
+	return err
+}
+
+// labelOffline sets the label of the FAT, exFAT or NTFS file system in the
+// partition at offset by patching its structures on the raw disk, for
+// volumes Windows won't label because they are dismounted or locked. The
+// disk's volumes are locked while it runs and remounted afterwards.
+func labelOffline(diskNumber int, offset int64, name string) error {
+	w := newDiskWriter(diskNumber)
+	if err := w.Open(); err != nil {
+		return err
+	}
+	defer w.Close()
+
+	v := &rawVolume{w: w, base: offset}
+	boot, err := v.read(0, 512)
+	if err != nil {
+		return fmt.Errorf("read boot sector: %w", err)
+	}
+	switch {
+	case string(boot[3:11]) == "NTFS    ":
+		return labelNTFS(v, boot, name)
+	case string(boot[3:11]) == "EXFAT   ":
+		return labelExFAT(v, boot, name)
+	case string(boot[82:87]) == "FAT32":
+		return labelFAT(v, boot, name, true)
+	case string(boot[54:59]) == "FAT16" || string(boot[54:59]) == "FAT12":
+		return labelFAT(v, boot, name, false)
+	}
+	return errors.New("no FAT, exFAT or NTFS file system to label")
+}
+
+// checkFATLabel checks a label against the rules shared by FAT and exFAT.
+func checkFATLabel(name string) error {
+	if strings.ContainsAny(name, fatLabelChars) {
+		return fmt.Errorf("label %q contains a character FAT doesn't allow (%s)", name, fatLabelChars)
+	}
+	for _, r := range name {
+		if r < 0x20 {
+			return fmt.Errorf("label %q contains a control character", name)
+		}
+	}
+	return nil
+}
+
+// labelFAT patches a FAT12/16/32 volume: the label in the boot sector (and
+// FAT32's backup boot sector) and the volume label entry of the root
+// directory, which is what Windows shows.
+func labelFAT(v *rawVolume, boot []byte, name string, fat32 bool) error {
+	if err := checkFATLabel(name); err != nil {
+		return err
+	}
+	upper := strings.ToUpper(name)
+	for _, r := range upper {
+		if r > 0x7E {
+			return fmt.Errorf("label %q: only ASCII labels can be written offline", name)
+		}
+	}
+	if len(upper) > 11 {
+		return fmt.Errorf("label %q is longer than FAT allows (11 characters)", name)
+	}
+	label := []byte(fmt.Sprintf("%-11s", upper))
+
+	bps := int64(binary.LittleEndian.Uint16(boot[11:13]))
+	spc := int64(boot[13])
+	reserved := int64(binary.LittleEndian.Uint16(boot[14:16]))
+	numFATs := int64(boot[16])
+	if bps < 512 || bps&(bps-1) != 0 || spc == 0 || numFATs == 0 {
+		return errors.New("invalid FAT boot sector")
+	}
+
+	// Boot sector label, NO NAME when there is none
+	bootLabel := label
+	if name == "" {
+		bootLabel = []byte("NO NAME    ")
+	}
+	labelOffset := 43
+	if fat32 {
+		labelOffset = 71
+	}
+	copy(boot[labelOffset:], bootLabel)
+	if err := v.write(0, boot); err != nil {
+		return fmt.Errorf("write boot sector: %w", err)
+	}
+	if backup := int64(binary.LittleEndian.Uint16(boot[50:52])); fat32 && backup != 0 && backup != 0xFFFF {
+		if err := v.write(backup*bps, boot); err != nil {
+			return fmt.Errorf("write backup boot sector: %w", err)
+		}
+	}
+
+	// The root directory: a fixed area on FAT12/16, a cluster chain on FAT32
+	var regions [][2]int64 // offset, length
+	if fat32 {
+		fatSize := int64(binary.LittleEndian.Uint32(boot[36:40]))
+		dataStart := (reserved + numFATs*fatSize) * bps
+		clusters, err := fatChain(v, reserved*bps, binary.LittleEndian.Uint32(boot[44:48]), 0x0FFFFFF7, 0x0FFFFFFF)
+		if err != nil {
+			return err
+		}
+		for _, c := range clusters {
+			regions = append(regions, [2]int64{dataStart + int64(c-2)*spc*bps, spc * bps})
+		}
+	} else {
+		fatSize := int64(binary.LittleEndian.Uint16(boot[22:24]))
+		rootEntries := int64(binary.LittleEndian.Uint16(boot[17:19]))
+		regions = append(regions, [2]int64{(reserved + numFATs*fatSize) * bps, rootEntries * 32})
+	}
+
+	return patchDirectory(v, regions, func(e []byte) dirEntryKind {
+		switch {
+		case e[0] == 0x00:
+			return entryEnd
+		case e[0] == 0xE5:
+			return entryFree
+		case e[11] != 0x0F && e[11]&0x08 != 0 && e[11]&0x10 == 0:
+			return entryLabel
+		}
+		return entryOther
+	}, func(e []byte, existing bool) {
+		if name == "" {
+			e[0] = 0xE5
+			return
+		}
+		if !existing {
+			clear(e)
+			e[11] = 0x08 // ATTR_VOLUME_ID
+		}
+		copy(e[0:11], label)
+	}, name == "", false)
+}
+
+// labelExFAT patches the volume label entry of an exFAT root directory.
+// exFAT keeps no label in its boot region, so its checksum is unaffected.
+func labelExFAT(v *rawVolume, boot []byte, name string) error {
+	if err := checkFATLabel(name); err != nil {
+		return err
+	}
+	units := utf16.Encode([]rune(name))
+	if len(units) > 11 {
+		return fmt.Errorf("label %q is longer than exFAT allows (11 characters)", name)
+	}
+
+	bpsShift, spcShift := boot[108], boot[109]
+	if bpsShift < 9 || bpsShift > 12 || int(bpsShift)+int(spcShift) > 25 {
+		return errors.New("invalid exFAT boot sector")
+	}
+	bps := int64(1) << bpsShift
+	clusterSize := bps << spcShift
+	fatOffset := int64(binary.LittleEndian.Uint32(boot[80:84])) * bps
+	heapOffset := int64(binary.LittleEndian.Uint32(boot[88:92])) * bps
+
+	clusters, err := fatChain(v, fatOffset, binary.LittleEndian.Uint32(boot[96:100]), 0xFFFFFFF7, 0xFFFFFFFF)
+	if err != nil {
+		return err
+	}
+	var regions [][2]int64
+	for _, c := range clusters {
+		regions = append(regions, [2]int64{heapOffset + int64(c-2)*clusterSize, clusterSize})
+	}
+
+	return patchDirectory(v, regions, func(e []byte) dirEntryKind {
+		switch {
+		case e[0] == 0x00:
+			return entryEnd
+		case e[0] == 0x83 || e[0] == 0x03:
+			return entryLabel
+		case e[0]&0x80 == 0:
+			return entryFree
+		}
+		return entryOther
+	}, func(e []byte, existing bool) {
+		clear(e)
+		e[0] = 0x03 // Volume label entry, no label
+		if name != "" {
+			e[0] = 0x83
+		}
+		e[1] = byte(len(units))
+		for i, u := range units {
+			binary.LittleEndian.PutUint16(e[2+2*i:], u)
+		}
+	}, name == "", true)
+}
+
+// fatChain follows a cluster chain through a FAT of 32-bit entries, up to
+// the first entry at or above end, the bad cluster marker.
+func fatChain(v *rawVolume, fatOffset int64, first, end, mask uint32) ([]uint32, error) {
+	var chain []uint32
+	for c := first; c >= 2 && c < end; {
+		if len(chain) == maxChainClusters {
+			return nil, errors.New("root directory cluster chain doesn't end")
+		}
+		chain = append(chain, c)
+		entry, err := v.read(fatOffset+int64(c)*4, 4)
+		if err != nil {
+			return nil, fmt.Errorf("read FAT: %w", err)
+		}
+		c = binary.LittleEndian.Uint32(entry) & mask
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("invalid root directory cluster")
+	}
+	return chain, nil
+}
+
+type dirEntryKind int
+
+const (
+	entryOther dirEntryKind = iota
+	entryLabel              // The volume label entry
+	entryFree               // Deleted, can be reused
+	entryEnd                // First entry past the directory's end
+)
+
+// patchDirectory finds the volume label entry among a directory's 32-byte
+// entries and rewrites it with set, or writes a new one into the first free
+// entry if there is none (unless removing the label, which needs nothing
+// then). endIsZeroed says whether every entry past the end marker is already
+// an end marker (exFAT), or the next one must be made one (FAT).
+func patchDirectory(v *rawVolume, regions [][2]int64, kind func(e []byte) dirEntryKind,
+	set func(e []byte, existing bool), removing, endIsZeroed bool) error {
+	type slot struct {
+		region int
+		offset int
+	}
+	data := make([][]byte, len(regions))
+	var free *slot
+	for i, r := range regions {
+		buf, err := v.read(r[0], int(r[1]))
+		if err != nil {
+			return fmt.Errorf("read root directory: %w", err)
+		}
+		data[i] = buf
+		for off := 0; off+32 <= len(buf); off += 32 {
+			e := buf[off : off+32]
+			switch kind(e) {
+			case entryLabel:
+				set(e, true)
+				return v.write(r[0]+int64(off), e)
+			case entryFree:
+				if free == nil {
+					free = &slot{i, off}
+				}
+			case entryEnd:
+				if removing {
+					return nil
+				}
+				if free == nil {
+					free = &slot{i, off}
+					if !endIsZeroed {
+						if err := markEnd(v, regions, data, i, off+32); err != nil {
+							return err
+						}
+					}
+				}
+				e := data[free.region][free.offset : free.offset+32]
+				set(e, false)
+				return v.write(regions[free.region][0]+int64(free.offset), e)
+			}
+		}
+	}
+	if removing {
+		return nil
+	}
+	if free == nil {
+		return errors.New("root directory is full")
+	}
+	e := data[free.region][free.offset : free.offset+32]
+	set(e, false)
+	return v.write(regions[free.region][0]+int64(free.offset), e)
+}
+
+// markEnd makes the entry at off of region i (or the first entry of the next
+// region) an end marker, once the old end marker is taken by a new entry.
+func markEnd(v *rawVolume, regions [][2]int64, data [][]byte, i, off int) error {
+	if off+32 > len(data[i]) {
+		if i+1 == len(regions) {
+			return nil
+		}
+		i, off = i+1, 0
+	}
+	return v.write(regions[i][0]+int64(off), []byte{0})
+}
+
+// NTFS $Volume is MFT record 3; its label is the $VOLUME_NAME attribute.
+const (
+	ntfsVolumeRecord = 3
+	ntfsVolumeName   = 0x60
+	ntfsEndMarker    = 0xFFFFFFFF
+	ntfsFixupStride  = 512
+)
+
+// labelNTFS rewrites the $VOLUME_NAME attribute of the $Volume record in
+// the MFT and its mirror.
+func labelNTFS(v *rawVolume, boot []byte, name string) error {
+	units := utf16.Encode([]rune(name))
+	if len(units) > 32 {
+		return fmt.Errorf("label %q is longer than NTFS allows (32 characters)", name)
+	}
+	value := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(value[2*i:], u)
+	}
+
+	bps := int64(binary.LittleEndian.Uint16(boot[11:13]))
+	spc := int64(boot[13])
+	if spc > 0x80 {
+		spc = 1 << (256 - spc)
+	}
+	clusterSize := bps * spc
+	recordSize := int64(int8(boot[64]))
+	if recordSize > 0 {
+		recordSize *= clusterSize
+	} else {
+		recordSize = 1 << -recordSize
+	}
+	if bps < 512 || clusterSize == 0 || recordSize < ntfsFixupStride || recordSize > 65536 {
+		return errors.New("invalid NTFS boot sector")
+	}
+
+	mft := int64(binary.LittleEndian.Uint64(boot[48:56])) * clusterSize
+	mirror := int64(binary.LittleEndian.Uint64(boot[56:64])) * clusterSize
+	for _, start := range []int64{mft, mirror} {
+		offset := start + ntfsVolumeRecord*recordSize
+		record, err := v.read(offset, int(recordSize))
+		if err != nil {
+			return fmt.Errorf("read $Volume: %w", err)
+		}
+		if err := setNTFSVolumeName(record, value); err != nil {
+			return err
+		}
+		if err := v.write(offset, record); err != nil {
+			return fmt.Errorf("write $Volume: %w", err)
+		}
+	}
+	return nil
+}
+
+// setNTFSVolumeName replaces (or adds) the resident $VOLUME_NAME attribute
+// of an MFT record, undoing and reapplying its update sequence fixups.
+func setNTFSVolumeName(record, value []byte) error {
+	if string(record[0:4]) != "FILE" {
+		return errors.New("$Volume record has no FILE signature")
+	}
+	usaOffset := int(binary.LittleEndian.Uint16(record[4:6]))
+	usaCount := int(binary.LittleEndian.Uint16(record[6:8]))
+	if usaCount < 2 || usaOffset+2*usaCount > len(record) || (usaCount-1)*ntfsFixupStride > len(record) {
+		return errors.New("$Volume record has an invalid update sequence")
+	}
+	usn := record[usaOffset : usaOffset+2]
+	for i := 1; i < usaCount; i++ {
+		end := i*ntfsFixupStride - 2
+		if record[end] != usn[0] || record[end+1] != usn[1] {
+			return errors.New("$Volume record is torn (update sequence mismatch)")
+		}
+		copy(record[end:end+2], record[usaOffset+2*i:])
+	}
+
+	used := int(binary.LittleEndian.Uint32(record[0x18:0x1C]))
+	allocated := int(binary.LittleEndian.Uint32(record[0x1C:0x20]))
+	if allocated > len(record) || used > allocated {
+		return errors.New("$Volume record has invalid sizes")
+	}
+
+	// Find the attribute to replace, or where to insert one in type order
+	pos := int(binary.LittleEndian.Uint16(record[0x14:0x16]))
+	oldLength := 0
+	for pos+8 <= used {
+		attrType := binary.LittleEndian.Uint32(record[pos:])
+		if attrType == ntfsEndMarker || attrType > ntfsVolumeName {
+			break
+		}
+		length := int(binary.LittleEndian.Uint32(record[pos+4:]))
+		if length < 0x18 || pos+length > used {
+			return errors.New("$Volume record has an invalid attribute")
+		}
+		if attrType == ntfsVolumeName {
+			oldLength = length
+			break
+		}
+		pos += length
+	}
+
+	attr := make([]byte, (0x18+len(value)+7)&^7)
+	binary.LittleEndian.PutUint32(attr[0x00:], ntfsVolumeName)
+	binary.LittleEndian.PutUint32(attr[0x04:], uint32(len(attr)))
+	binary.LittleEndian.PutUint16(attr[0x0A:], 0x18) // Name offset (unnamed)
+	binary.LittleEndian.PutUint32(attr[0x10:], uint32(len(value)))
+	binary.LittleEndian.PutUint16(attr[0x14:], 0x18) // Value offset
+	copy(attr[0x18:], value)
+	if oldLength > 0 {
+		copy(attr[0x0E:0x10], record[pos+0x0E:pos+0x10]) // Keep the attribute ID
+	} else {
+		id := binary.LittleEndian.Uint16(record[0x28:0x2A])
+		binary.LittleEndian.PutUint16(attr[0x0E:], id)
+		binary.LittleEndian.PutUint16(record[0x28:], id+1)
+	}
+
+	newUsed := used - oldLength + len(attr)
+	if newUsed > allocated {
+		return errors.New("no room for the label in the $Volume record")
+	}
+	rest := append([]byte(nil), record[pos+oldLength:used]...)
+	copy(record[pos:], attr)
+	copy(record[pos+len(attr):], rest)
+	clear(record[newUsed:max(used, newUsed)])
+	binary.LittleEndian.PutUint32(record[0x18:], uint32(newUsed))
+
+	for i := 1; i < usaCount; i++ {
+		end := i*ntfsFixupStride - 2
+		copy(record[usaOffset+2*i:], record[end:end+2])
+		copy(record[end:end+2], usn)
+	}
+	return nil
+}
+
+// firstDataPartition returns the partition with the lowest offset that
+// isn't an MBR extended partition container.
+func firstDataPartition(layout *disk.DriveLayout) (disk.PartitionInfo, bool) {
+	var first disk.PartitionInfo
+	found := false
+	for _, p := range layout.Partitions {
+		if layout.PartitionStyle == disk.PARTITION_STYLE_MBR && (p.PartitionType == 0x05 || p.PartitionType == 0x0F) {
+			continue
+		}
+		if !found || p.StartingOffset < first.StartingOffset {
+			first, found = p, true
+		}
+	}
+	return first, found
+}
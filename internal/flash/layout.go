@@ -0,0 +1,91 @@
+package flash
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"golang.org/x/sys/windows"
+)
+
+// layoutMountTimeout is how long a flashed disk's partitions get to show up
+// as volumes before the layout is reported without them.
+const layoutMountTimeout = 5 * time.Second
+
+// Partition is a partition of a freshly flashed disk as Windows sees it
+// after the rescan, reported in the completion event.
+type Partition struct {
+	Number      int    `json:"number"`
+	Offset      int64  `json:"offset"`
+	Size        int64  `json:"size"`
+	Type        string `json:"type,omitempty"` // MBR partition type, e.g. "0x0C"
+	Active      bool   `json:"active,omitempty"`
+	DriveLetter string `json:"drive_letter,omitempty"` // With the colon, e.g. "E:"
+	FileSystem  string `json:"file_system,omitempty"`
+	Label       string `json:"label,omitempty"`
+}
+
+// rescan makes Windows re-read the partition table just written, dropping
+// the stale partitions it still shows, and returns the new layout. The
+// writer must be closed first so the disk's volumes can be mounted again.
+func rescan(diskNumber int) (*disk.DriveLayout, error) {
+	handle, err := disk.OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(handle)
+
+	if err := disk.UpdateDiskProperties(handle); err != nil {
+		return nil, err
+	}
+	return disk.GetDriveLayout(handle)
+}
+
+// describeLayout lists a rescanned disk's partitions with the drive letter,
+// file system and label of their volumes, waiting briefly for Windows to
+// mount them. Partitions Windows doesn't mount (e.g. ext4) are listed
+// without a volume.
+func describeLayout(ctx context.Context, diskNumber int, layout *disk.DriveLayout) []Partition {
+	if layout == nil || len(layout.Partitions) == 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(layoutMountTimeout)
+	var volumes map[int64]string
+	for {
+		volumes, _ = disk.VolumesByOffset(diskNumber)
+		if len(volumes) >= len(layout.Partitions) || time.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	partitions := make([]Partition, len(layout.Partitions))
+	for i, p := range layout.Partitions {
+		part := Partition{
+			Number: int(p.PartitionNumber),
+			Offset: p.StartingOffset,
+			Size:   p.Length,
+		}
+		if layout.PartitionStyle == disk.PARTITION_STYLE_MBR {
+			part.Type = fmt.Sprintf("0x%02X", p.PartitionType)
+			part.Active = p.IsActive
+		}
+		if volume, ok := volumes[p.StartingOffset]; ok {
+			if root, _ := disk.GetVolumeDriveLetter(volume); root != "" {
+				part.DriveLetter = root[:2]
+			}
+			if contents, err := disk.GetVolumeContents(volume); err == nil {
+				part.FileSystem = contents.FileSystem
+				part.Label = contents.Label
+			}
+		}
+		partitions[i] = part
+	}
+	return partitions
+}
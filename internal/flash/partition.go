@@ -0,0 +1,90 @@
+package flash
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"golang.org/x/sys/windows"
+)
+
+// PartitionTarget describes a partition selected with Options.Partition.
+type PartitionTarget struct {
+	Number     int
+	Offset     int64  // Starting offset on the physical disk in bytes
+	Length     int64  // Partition size in bytes
+	VolumePath string // Volume GUID path, empty if Windows exposes no volume
+}
+
+// ResolvePartition looks up a partition on a disk and the volume backed by it.
+func ResolvePartition(diskNumber, partitionNumber int) (PartitionTarget, error) {
+	p, err := disk.FindPartition(diskNumber, partitionNumber)
+	if err != nil {
+		return PartitionTarget{}, err
+	}
+
+	target := PartitionTarget{
+		Number: partitionNumber,
+		Offset: p.StartingOffset,
+		Length: p.Length,
+	}
+
+	// Not every partition gets a volume (e.g. unrecognized types); those are
+	// written through the physical disk at the partition's offset instead.
+	if volumePath, err := disk.FindVolumeByPartition(diskNumber, p.StartingOffset); err == nil {
+		target.VolumePath = volumePath
+	}
+
+	return target, nil
+}
+
+// newPartitionWriter creates a writer confined to a single partition.
+// Offsets passed to WriteAt/ReadAt are relative to the partition start.
+func newPartitionWriter(diskNumber int, target PartitionTarget) *diskWriter {
+	w := newDiskWriter(diskNumber)
+	w.volumePath = target.VolumePath
+	w.limit = target.Length
+	if target.VolumePath == "" {
+		w.baseOffset = target.Offset
+		w.skipVolumeLock = true
+	}
+	return w
+}
+
+// openVolume opens the partition's volume device for unbuffered writes,
+// locking and dismounting it through the same handle so no other handle
+// can touch the volume while it is being written.
+func (w *diskWriter) openVolume() error {
+	path := strings.TrimRight(w.volumePath, `\`)
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return fmt.Errorf("invalid volume path: %w", err)
+	}
+
+	handle, err := windows.CreateFile(
+		pathPtr,
+		windows.GENERIC_READ|windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_NO_BUFFERING|windows.FILE_FLAG_WRITE_THROUGH,
+		0,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to open volume %s: %w", path, err)
+	}
+
+	var bytesReturned uint32
+	if err := windows.DeviceIoControl(handle, FSCTL_LOCK_VOLUME, nil, 0, nil, 0, &bytesReturned, nil); err != nil {
+		windows.CloseHandle(handle)
+		return fmt.Errorf("failed to lock volume %s: %w", path, err)
+	}
+	_ = windows.DeviceIoControl(handle, FSCTL_DISMOUNT_VOLUME, nil, 0, nil, 0, &bytesReturned, nil)
+
+	// Allow writes outside the (now dismounted) filesystem's bounds
+	_ = windows.DeviceIoControl(handle, FSCTL_ALLOW_EXTENDED_DASD_IO, nil, 0, nil, 0, &bytesReturned, nil)
+
+	w.handle = handle
+	return nil
+}
@@ -0,0 +1,189 @@
+package flash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxRetryDelay caps the exponential backoff between HTTP retries.
+const maxRetryDelay = 60 * time.Second
+
+// resumableBody is an HTTP response body that transparently reconnects with
+// a Range request when the connection drops mid-stream, so readers above it
+// (hashing, decompression) see one continuous stream.
+type resumableBody struct {
+	url     string
+	opts    HTTPOptions
+	client  *http.Client
+	body    io.ReadCloser
+	offset  int64  // Bytes received so far
+	total   int64  // Content-Length of the full response, -1 if unknown
+	ifRange string // ETag or Last-Modified, so a changed file isn't spliced
+}
+
+// openResumable issues the initial GET for rawURL, retrying connection
+// failures and server errors per opts.
+func openResumable(rawURL string, opts HTTPOptions) (*resumableBody, *http.Response, error) {
+	client, err := opts.client()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resp *http.Response
+	err = retryHTTP(opts.ctx(), opts, func() error {
+		req, err := opts.newRequest(rawURL)
+		if err != nil {
+			return permanent(err)
+		}
+		r, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to connect to URL: %w", err)
+		}
+		if r.StatusCode != http.StatusOK {
+			r.Body.Close()
+			err := fmt.Errorf("server returned error: %s", r.Status)
+			if r.StatusCode < 500 {
+				return permanent(err)
+			}
+			return err
+		}
+		resp = r
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ifRange := resp.Header.Get("ETag")
+	if ifRange == "" || strings.HasPrefix(ifRange, "W/") {
+		// Weak ETags can't be used with If-Range
+		ifRange = resp.Header.Get("Last-Modified")
+	}
+
+	return &resumableBody{
+		url:     rawURL,
+		opts:    opts,
+		client:  client,
+		body:    resp.Body,
+		total:   resp.ContentLength,
+		ifRange: ifRange,
+	}, resp, nil
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		if err == nil || n > 0 {
+			return n, nil
+		}
+		if err == io.EOF {
+			// A body cut short at a chunk boundary can end "cleanly"
+			if b.total < 0 || b.offset >= b.total {
+				return 0, io.EOF
+			}
+			err = io.ErrUnexpectedEOF
+		}
+		if b.opts.Retries == 0 {
+			return 0, err
+		}
+		if rerr := b.resume(err); rerr != nil {
+			return 0, rerr
+		}
+	}
+}
+
+// resume reconnects from the current offset after cause interrupted the download.
+func (b *resumableBody) resume(cause error) error {
+	err := retryHTTP(b.opts.ctx(), b.opts, func() error {
+		req, err := b.opts.newRequest(b.url)
+		if err != nil {
+			return permanent(err)
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+		if b.ifRange != "" {
+			req.Header.Set("If-Range", b.ifRange)
+		}
+
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return err
+		}
+		switch {
+		case resp.StatusCode == http.StatusPartialContent:
+			if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", b.offset)) {
+				resp.Body.Close()
+				return permanent(fmt.Errorf("server resumed at the wrong offset (%s)", resp.Header.Get("Content-Range")))
+			}
+		case resp.StatusCode == http.StatusOK:
+			// Range ignored, or If-Range failed because the file changed
+			resp.Body.Close()
+			return permanent(errors.New("server does not support resuming or the file changed"))
+		default:
+			resp.Body.Close()
+			err := fmt.Errorf("server returned error: %s", resp.Status)
+			if resp.StatusCode < 500 {
+				return permanent(err)
+			}
+			return err
+		}
+
+		b.body.Close()
+		b.body = resp.Body
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("download interrupted at %s (%v); resume failed: %w",
+			FormatBytes(b.offset), cause, err)
+	}
+	return nil
+}
+
+func (b *resumableBody) Close() error {
+	return b.body.Close()
+}
+
+// permanentError marks an HTTP failure that retrying won't fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// retryHTTP calls attempt until it succeeds, returns a permanent error, or
+// opts.Retries retries have been used, backing off exponentially in between.
+// Cancelling ctx ends the wait for the next attempt.
+func retryHTTP(ctx context.Context, opts HTTPOptions, attempt func() error) error {
+	delay := opts.RetryDelay
+	var err error
+	for i := 0; ; i++ {
+		if err = attempt(); err == nil {
+			return nil
+		}
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if i >= opts.Retries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+	if opts.Retries > 0 {
+		return fmt.Errorf("%w (after %d retries)", err, opts.Retries)
+	}
+	return err
+}
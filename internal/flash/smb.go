@@ -0,0 +1,235 @@
+package flash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// smbChunkSize is the size of each read issued against an SMB share.
+	// Large reads keep the redirector streaming instead of round-tripping.
+	smbChunkSize = 4 << 20
+	// smbReadAhead is how many chunks are fetched ahead of the writer, so
+	// network reads overlap with disk writes.
+	smbReadAhead = 4
+
+	resourceTypeDisk               = 1    // RESOURCETYPE_DISK
+	errorSessionCredentialConflict = 1219 // ERROR_SESSION_CREDENTIAL_CONFLICT
+)
+
+var (
+	modmpr                     = syscall.NewLazyDLL("mpr.dll")
+	procWNetAddConnection2W    = modmpr.NewProc("WNetAddConnection2W")
+	procWNetCancelConnection2W = modmpr.NewProc("WNetCancelConnection2W")
+)
+
+// netResource mirrors the Win32 NETRESOURCEW structure.
+type netResource struct {
+	Scope       uint32
+	Type        uint32
+	DisplayType uint32
+	Usage       uint32
+	LocalName   *uint16
+	RemoteName  *uint16
+	Comment     *uint16
+	Provider    *uint16
+}
+
+// IsUNCPath reports whether path is a network path such as
+// \\server\share\image.img (or //server/share/image.img).
+// Device paths like \\?\ and \\.\ are not UNC shares.
+func IsUNCPath(path string) bool {
+	if len(path) < 3 || !isSlash(path[0]) || !isSlash(path[1]) {
+		return false
+	}
+	return path[2] != '?' && path[2] != '.' && !isSlash(path[2])
+}
+
+func isSlash(c byte) bool {
+	return c == '\\' || c == '/'
+}
+
+// uncShare returns the \\server\share root of a UNC path.
+func uncShare(path string) (string, error) {
+	parts := strings.FieldsFunc(path, func(r rune) bool { return r == '\\' || r == '/' })
+	if len(parts) < 2 {
+		return "", fmt.Errorf("invalid UNC path %s: expected \\\\server\\share\\...", path)
+	}
+	return `\\` + parts[0] + `\` + parts[1], nil
+}
+
+// ConnectSMB authenticates to the share holding a UNC path with the given
+// credentials (user may be DOMAIN\user). The returned function disconnects
+// the share again. Without credentials the current logon session is used
+// and nothing is connected.
+func ConnectSMB(path, user, password string) (disconnect func(), err error) {
+	if user == "" || !IsUNCPath(path) {
+		return func() {}, nil
+	}
+
+	share, err := uncShare(path)
+	if err != nil {
+		return nil, err
+	}
+	sharePtr, err := windows.UTF16PtrFromString(share)
+	if err != nil {
+		return nil, fmt.Errorf("invalid share %s: %w", share, err)
+	}
+	userPtr, err := windows.UTF16PtrFromString(user)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user name: %w", err)
+	}
+	passwordPtr, err := windows.UTF16PtrFromString(password)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password: %w", err)
+	}
+
+	resource := netResource{Type: resourceTypeDisk, RemoteName: sharePtr}
+	r1, _, _ := procWNetAddConnection2W.Call(
+		uintptr(unsafe.Pointer(&resource)),
+		uintptr(unsafe.Pointer(passwordPtr)),
+		uintptr(unsafe.Pointer(userPtr)),
+		0,
+	)
+	switch r1 {
+	case 0:
+	case errorSessionCredentialConflict:
+		return nil, fmt.Errorf("already connected to %s with different credentials; disconnect it first (net use %s /delete) or omit the SMB user", share, share)
+	default:
+		return nil, fmt.Errorf("failed to connect to %s: %w", share, syscall.Errno(r1))
+	}
+
+	return func() {
+		procWNetCancelConnection2W.Call(uintptr(unsafe.Pointer(sharePtr)), 0, 1)
+	}, nil
+}
+
+// openImageFile opens an image file for sequential reading. Files on SMB
+// shares are opened with FILE_FLAG_SEQUENTIAL_SCAN so the redirector reads
+// ahead aggressively.
+func openImageFile(path string) (*os.File, error) {
+	if !IsUNCPath(path) {
+		return os.Open(path)
+	}
+
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.CreateFile(
+		pathPtr,
+		windows.GENERIC_READ,
+		windows.FILE_SHARE_READ,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_SEQUENTIAL_SCAN,
+		0,
+	)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
+
+// sequentialReader returns the reader a source should stream file through,
+// starting at the file's current position. For SMB paths it prefetches
+// large chunks in the background; local files are read directly.
+func sequentialReader(file *os.File, path string) io.ReadCloser {
+	if !IsUNCPath(path) {
+		return io.NopCloser(file)
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return io.NopCloser(file)
+	}
+	return newReadAhead(file, offset)
+}
+
+// readAhead streams a file from a fixed offset using ReadAt in a background
+// goroutine, keeping up to smbReadAhead chunks buffered. ReadAt leaves the
+// file position alone, so callers may still Seek the file (e.g. to probe a
+// gzip footer) while prefetching runs.
+type readAhead struct {
+	chunks chan readChunk
+	free   chan []byte
+	done   chan struct{}
+	once   sync.Once
+	cur    readChunk
+	pos    int
+}
+
+type readChunk struct {
+	buf []byte
+	n   int
+	err error
+}
+
+func newReadAhead(file *os.File, offset int64) *readAhead {
+	r := &readAhead{
+		chunks: make(chan readChunk, smbReadAhead),
+		free:   make(chan []byte, smbReadAhead+1),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < smbReadAhead+1; i++ {
+		r.free <- make([]byte, smbChunkSize)
+	}
+	go r.fill(file, offset)
+	return r
+}
+
+func (r *readAhead) fill(file *os.File, offset int64) {
+	defer close(r.chunks)
+	for {
+		var buf []byte
+		select {
+		case buf = <-r.free:
+		case <-r.done:
+			return
+		}
+
+		n, err := file.ReadAt(buf, offset)
+		offset += int64(n)
+
+		select {
+		case r.chunks <- readChunk{buf: buf, n: n, err: err}:
+		case <-r.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *readAhead) Read(p []byte) (int, error) {
+	for r.pos >= r.cur.n {
+		if r.cur.err != nil {
+			return 0, r.cur.err
+		}
+		if r.cur.buf != nil {
+			r.free <- r.cur.buf
+		}
+		chunk, ok := <-r.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		r.cur, r.pos = chunk, 0
+	}
+
+	n := copy(p, r.cur.buf[r.pos:r.cur.n])
+	r.pos += n
+	return n, nil
+}
+
+// Close stops prefetching. The underlying file is closed by its owner.
+func (r *readAhead) Close() error {
+	r.once.Do(func() { close(r.done) })
+	return nil
+}
@@ -2,9 +2,11 @@ package flash
 
 import (
 	"archive/zip"
+	"bufio"
 	"compress/gzip"
 	"encoding/binary"
 	"fmt"
+	"hash"
 	"io"
 	"mime"
 	"net/http"
@@ -12,8 +14,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/bodgit/sevenzip"
 	"github.com/klauspost/compress/zstd"
 	"github.com/lazaroagomez/wusbkit/internal/encoding"
 	"github.com/ulikunitz/xz"
@@ -32,22 +36,116 @@ type Source interface {
 	Name() string
 }
 
+// SizeUnknown is returned by Source.Size when the uncompressed image size
+// cannot be determined without reading the whole stream (e.g. gzip files
+// larger than 4GB, or compressed images streamed from a URL).
+const SizeUnknown int64 = -1
+
+// CompressedProgress is implemented by compressed sources that can report how
+// much of the underlying compressed stream has been consumed. The flasher uses
+// it to estimate progress when Size returns SizeUnknown.
+type CompressedProgress interface {
+	// CompressedProgress returns the compressed bytes consumed so far and the
+	// total compressed size (0 if not known).
+	CompressedProgress() (consumed, total int64)
+}
+
+// countingReader wraps a reader and counts the bytes read through it. The
+// count is atomic: decoders read on their own goroutines while progress is
+// polled from another.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
 // OpenSource opens an image file and returns the appropriate Source implementation.
-// Supports: .img, .iso, .bin, .raw (raw), .zip (streaming extraction),
+// Supports: .img, .iso, .bin, .raw (raw), .zip and .7z (streaming extraction),
 // and compressed formats: .gz, .xz, .zst/.zstd (streaming decompression).
-// Also supports HTTP/HTTPS URLs for remote image streaming.
+// Also supports HTTP/HTTPS URLs for remote image streaming, including .gz, .xz
+// and .zst URLs which are decompressed on-the-fly, and \\server\share UNC paths,
+// which are read ahead in large chunks. Split images (see SplitIndex) are
+// reassembled from their chunks. Sources whose uncompressed size
+// cannot be determined report SizeUnknown from Size().
 func OpenSource(path string) (Source, error) {
+	return OpenSourceWithOptions(path, SourceOptions{})
+}
+
+// SourceOptions controls how an image path is opened.
+type SourceOptions struct {
+	// ArchiveEntry selects which file inside a .zip or .7z archive to stream,
+	// matched case-insensitively against the entry path or its base name.
+	// Empty selects the first image file in the archive.
+	ArchiveEntry string
+	// RawHash, if set, receives every byte read from a URL before
+	// decompression, so the download can be checked against a published digest.
+	RawHash hash.Hash
+	// Skip discards this many bytes from the start of the image (dd skip).
+	Skip int64
+	// Count limits the image to this many bytes after Skip, 0 = all (dd count).
+	Count int64
+	// Trim stops the image at the end of its last partition (per the MBR/GPT
+	// inside the image). Ignored when Skip is set and for ISO9660 images,
+	// recognized by their content whatever their name.
+	Trim bool
+	// HTTP controls credentials, proxying and retrying of URL downloads.
+	HTTP HTTPOptions
+}
+
+// rawDrainer is implemented by sources that can read the remainder of their
+// underlying stream, e.g. trailing bytes a decompressor stopped short of.
+type rawDrainer interface {
+	drainRaw() error
+}
+
+// OpenSourceWithOptions is like OpenSource but accepts additional options.
+func OpenSourceWithOptions(path string, opts SourceOptions) (Source, error) {
+	src, err := openSource(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Trim && opts.Skip == 0 {
+		trimmed, err := newTrimmedSource(src, opts.Count)
+		if err != nil {
+			src.Close()
+			return nil, fmt.Errorf("failed to read partition table: %w", err)
+		}
+		return trimmed, nil
+	}
+	if opts.Skip > 0 || opts.Count > 0 {
+		return newRegionSource(src, opts.Skip, opts.Count), nil
+	}
+	return src, nil
+}
+
+func openSource(path string, opts SourceOptions) (Source, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if opts.ArchiveEntry != "" && ext != ".zip" && ext != ".7z" {
+		return nil, fmt.Errorf("archive entry %q requested but %s is not a .zip or .7z archive",
+			opts.ArchiveEntry, filepath.Base(path))
+	}
+
 	// Check if path is a URL and handle remote sources
 	if IsURL(path) {
-		return newURLSource(path)
+		return newURLSource(path, opts.RawHash, opts.HTTP)
 	}
 
-	// Handle local files based on extension
-	ext := strings.ToLower(filepath.Ext(path))
+	// Split images are opened through their index
+	if index := resolveSplitIndex(path); index != "" {
+		return newSplitSource(index)
+	}
 
+	// Handle local files based on extension
 	switch ext {
 	case ".zip":
-		return newZipSource(path)
+		return newZipSource(path, opts.ArchiveEntry)
+	case ".7z":
+		return newSevenZipSource(path, opts.ArchiveEntry)
 	case ".gz", ".gzip":
 		return newGzipSource(path)
 	case ".xz":
@@ -62,13 +160,81 @@ func OpenSource(path string) (Source, error) {
 	}
 }
 
+// regionSource exposes a window of another source, like dd's skip and count:
+// the first skip bytes are discarded on first read and reading stops after
+// count bytes (0 = until EOF).
+type regionSource struct {
+	Source
+	reader  io.Reader
+	size    int64
+	skip    int64
+	skipped bool
+}
+
+var _ CompressedProgress = (*regionSource)(nil)
+
+func newRegionSource(src Source, skip, count int64) *regionSource {
+	size := src.Size()
+	if size != SizeUnknown {
+		size = max(size-skip, 0)
+		if count > 0 {
+			size = min(size, count)
+		}
+	} else if count > 0 {
+		size = count // Upper bound; the stream may end sooner
+	}
+
+	var reader io.Reader = src
+	if count > 0 {
+		reader = io.LimitReader(src, count)
+	}
+
+	return &regionSource{Source: src, reader: reader, size: size, skip: skip}
+}
+
+func (r *regionSource) Size() int64 { return r.size }
+
+func (r *regionSource) Read(p []byte) (int, error) {
+	if !r.skipped {
+		r.skipped = true
+		if r.skip > 0 {
+			if _, err := io.CopyN(io.Discard, r.Source, r.skip); err != nil {
+				if err == io.EOF {
+					return 0, fmt.Errorf("skip offset %d is beyond the end of the image", r.skip)
+				}
+				return 0, err
+			}
+		}
+	}
+	return r.reader.Read(p)
+}
+
+// CompressedProgress forwards to the wrapped source, so a compressed image of
+// unknown size still shows progress when it's windowed, trimmed or replayed
+// after validation (all of which wrap it in a regionSource); embedding alone
+// would hide the method from the interface check in sourcePercent.
+func (r *regionSource) CompressedProgress() (consumed, total int64) {
+	if cp, ok := r.Source.(CompressedProgress); ok {
+		return cp.CompressedProgress()
+	}
+	return 0, 0
+}
+
+func (r *regionSource) drainRaw() error {
+	if d, ok := r.Source.(rawDrainer); ok {
+		return d.drainRaw()
+	}
+	return nil
+}
+
 // rawSource reads directly from an uncompressed image file.
 // For ImageUSB .bin files with a 512-byte header, the header is skipped
 // and the reported size reflects only the image data.
 type rawSource struct {
-	file *os.File
-	size int64
-	name string
+	file   *os.File
+	reader io.ReadCloser // file, or an SMB read-ahead over it
+	size   int64
+	name   string
 	// ImageUSB .bin header fields (populated if header detected)
 	hasBinHeader bool
 	binMD5       string
@@ -79,7 +245,7 @@ type rawSource struct {
 const imageUSBHeaderSize = 512
 
 func newRawSource(path string) (*rawSource, error) {
-	file, err := os.Open(path)
+	file, err := openImageFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open image: %w", err)
 	}
@@ -110,6 +276,7 @@ func newRawSource(path string) (*rawSource, error) {
 		}
 	}
 
+	src.reader = sequentialReader(file, path)
 	return src, nil
 }
 
@@ -190,10 +357,11 @@ func (r *rawSource) Size() int64 {
 }
 
 func (r *rawSource) Read(p []byte) (n int, err error) {
-	return r.file.Read(p)
+	return r.reader.Read(p)
 }
 
 func (r *rawSource) Close() error {
+	r.reader.Close()
 	return r.file.Close()
 }
 
@@ -201,7 +369,7 @@ func (r *rawSource) Name() string {
 	return r.name
 }
 
-// zipSource extracts and streams the first image file from a zip archive
+// zipSource extracts and streams an image file from a zip archive
 type zipSource struct {
 	zipReader  *zip.ReadCloser
 	fileReader io.ReadCloser
@@ -209,7 +377,7 @@ type zipSource struct {
 	name       string
 }
 
-// Supported image extensions inside zip files
+// Supported image extensions inside zip and 7z archives
 var imageExtensions = map[string]bool{
 	".img": true,
 	".iso": true,
@@ -217,29 +385,63 @@ var imageExtensions = map[string]bool{
 	".raw": true,
 }
 
-func newZipSource(path string) (*zipSource, error) {
-	zr, err := zip.OpenReader(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open zip: %w", err)
+// archiveEntry describes a file inside a zip or 7z archive.
+type archiveEntry struct {
+	name  string
+	isDir bool
+}
+
+// selectArchiveEntry returns the index of the entry to flash. With an empty
+// want it picks the first file with an image extension; otherwise it matches
+// want against the entry path or base name, listing the available files if
+// nothing matches. kind names the archive format for error messages.
+func selectArchiveEntry(entries []archiveEntry, want, kind string) (int, error) {
+	if want == "" {
+		for i, e := range entries {
+			if !e.isDir && imageExtensions[strings.ToLower(filepath.Ext(e.name))] {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("no image file found in %s (supported: .img, .iso, .bin, .raw)", kind)
 	}
 
-	// Find the first image file in the archive
-	var imageFile *zip.File
-	for _, f := range zr.File {
-		if f.FileInfo().IsDir() {
+	want = filepath.ToSlash(want)
+	var available []string
+	for i, e := range entries {
+		if e.isDir {
 			continue
 		}
-		ext := strings.ToLower(filepath.Ext(f.Name))
-		if imageExtensions[ext] {
-			imageFile = f
-			break
+		name := filepath.ToSlash(e.name)
+		if strings.EqualFold(name, want) || strings.EqualFold(filepath.Base(name), want) {
+			return i, nil
 		}
+		available = append(available, name)
+	}
+
+	if len(available) == 0 {
+		return -1, fmt.Errorf("entry %q not found in %s (archive contains no files)", want, kind)
+	}
+	return -1, fmt.Errorf("entry %q not found in %s; available entries: %s",
+		want, kind, strings.Join(available, ", "))
+}
+
+func newZipSource(path, entry string) (*zipSource, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip: %w", err)
 	}
 
-	if imageFile == nil {
+	// Find the requested (or first) image file in the archive
+	entries := make([]archiveEntry, len(zr.File))
+	for i, f := range zr.File {
+		entries[i] = archiveEntry{name: f.Name, isDir: f.FileInfo().IsDir()}
+	}
+	idx, err := selectArchiveEntry(entries, entry, "zip")
+	if err != nil {
 		zr.Close()
-		return nil, fmt.Errorf("no image file found in zip (supported: .img, .iso, .bin, .raw)")
+		return nil, err
 	}
+	imageFile := zr.File[idx]
 
 	// Open the image file for streaming
 	fr, err := imageFile.Open()
@@ -273,92 +475,154 @@ func (z *zipSource) Name() string {
 	return z.name
 }
 
+// sevenZipSource extracts and streams an image file from a 7z archive
+type sevenZipSource struct {
+	archive    *sevenzip.ReadCloser
+	fileReader io.ReadCloser
+	size       int64
+	name       string
+}
+
+func newSevenZipSource(path, entry string) (*sevenZipSource, error) {
+	ar, err := sevenzip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open 7z: %w", err)
+	}
+
+	// Find the requested (or first) image file in the archive
+	entries := make([]archiveEntry, len(ar.File))
+	for i, f := range ar.File {
+		entries[i] = archiveEntry{name: f.Name, isDir: f.FileInfo().IsDir()}
+	}
+	idx, err := selectArchiveEntry(entries, entry, "7z")
+	if err != nil {
+		ar.Close()
+		return nil, err
+	}
+	imageFile := ar.File[idx]
+
+	// Open the image file for streaming
+	fr, err := imageFile.Open()
+	if err != nil {
+		ar.Close()
+		return nil, fmt.Errorf("failed to open image in 7z: %w", err)
+	}
+
+	return &sevenZipSource{
+		archive:    ar,
+		fileReader: fr,
+		size:       int64(imageFile.UncompressedSize),
+		name:       filepath.Base(imageFile.Name),
+	}, nil
+}
+
+func (s *sevenZipSource) Size() int64 {
+	return s.size
+}
+
+func (s *sevenZipSource) Read(p []byte) (n int, err error) {
+	return s.fileReader.Read(p)
+}
+
+func (s *sevenZipSource) Close() error {
+	s.fileReader.Close()
+	return s.archive.Close()
+}
+
+func (s *sevenZipSource) Name() string {
+	return s.name
+}
+
 // gzipSource decompresses gzip files on-the-fly
 type gzipSource struct {
-	file   *os.File
-	reader *gzip.Reader
-	size   int64
-	name   string
+	file           *os.File
+	input          io.ReadCloser // file, or an SMB read-ahead over it
+	counter        *countingReader
+	reader         *gzip.Reader
+	size           int64
+	compressedSize int64
+	name           string
 }
 
 func newGzipSource(path string) (*gzipSource, error) {
-	file, err := os.Open(path)
+	file, err := openImageFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open gzip file: %w", err)
 	}
 
-	gzr, err := gzip.NewReader(file)
+	input := sequentialReader(file, path)
+	counter := &countingReader{r: input}
+	gzr, err := gzip.NewReader(counter)
 	if err != nil {
+		input.Close()
 		file.Close()
 		return nil, fmt.Errorf("failed to read gzip header: %w", err)
 	}
 
 	// Try to get uncompressed size from gzip footer (last 4 bytes = ISIZE)
 	size := getGzipUncompressedSize(file)
+	var compressedSize int64
+	if info, err := file.Stat(); err == nil {
+		compressedSize = info.Size()
+	}
 
 	// Remove .gz extension for display name
 	name := filepath.Base(path)
 	name = strings.TrimSuffix(name, filepath.Ext(name))
 
 	return &gzipSource{
-		file:   file,
-		reader: gzr,
-		size:   size,
-		name:   name,
+		file:           file,
+		input:          input,
+		counter:        counter,
+		reader:         gzr,
+		size:           size,
+		compressedSize: compressedSize,
+		name:           name,
 	}, nil
 }
 
 // getGzipUncompressedSize reads the ISIZE field from gzip footer and validates it.
 // The gzip ISIZE field is a 32-bit value that stores size modulo 2^32, so it wraps
-// for files > 4GB. When this happens, we estimate based on compressed file size.
+// for files > 4GB. When the value cannot be trusted, SizeUnknown is returned and
+// the flasher streams until EOF instead of relying on a total.
 func getGzipUncompressedSize(file *os.File) int64 {
-	// Get compressed file size for validation/estimation
 	info, err := file.Stat()
 	if err != nil {
-		return 0
+		return SizeUnknown
 	}
 	compressedSize := info.Size()
 
 	// Save current position
 	currentPos, err := file.Seek(0, io.SeekCurrent)
 	if err != nil {
-		return compressedSize * 3 // Fallback estimate
+		return SizeUnknown
 	}
+	defer file.Seek(currentPos, io.SeekStart)
 
 	// Seek to last 4 bytes (ISIZE field)
-	_, err = file.Seek(-4, io.SeekEnd)
-	if err != nil {
-		file.Seek(currentPos, io.SeekStart)
-		return compressedSize * 3 // Fallback estimate
+	if _, err := file.Seek(-4, io.SeekEnd); err != nil {
+		return SizeUnknown
 	}
 
 	// Read ISIZE (little-endian uint32)
 	var isize uint32
-	err = binary.Read(file, binary.LittleEndian, &isize)
-	if err != nil {
-		file.Seek(currentPos, io.SeekStart)
-		return compressedSize * 3 // Fallback estimate
+	if err := binary.Read(file, binary.LittleEndian, &isize); err != nil {
+		return SizeUnknown
 	}
 
-	// Restore position
-	file.Seek(currentPos, io.SeekStart)
-
 	uncompressedSize := int64(isize)
 
-	// Validate ISIZE: if it's smaller than compressed size or seems wrapped (> 4GB file),
-	// the ISIZE field has wrapped around. Use estimation instead.
-	// A valid uncompressed size should always be >= compressed size.
+	// A valid uncompressed size should always be >= compressed size. If it's
+	// smaller, the ISIZE field has wrapped around (original > 4GB).
 	if uncompressedSize < compressedSize {
-		// ISIZE wrapped around - estimate based on compressed size
-		// Use a conservative estimate (3x compression ratio typical for disk images)
-		return compressedSize * 3
+		return SizeUnknown
 	}
 
 	// Additional sanity check: if compressed file is > 1GB and ISIZE < 1GB,
 	// it's very likely wrapped (disk images rarely compress better than 4:1)
 	const oneGB = 1 << 30
 	if compressedSize > oneGB && uncompressedSize < oneGB {
-		return compressedSize * 3
+		return SizeUnknown
 	}
 
 	return uncompressedSize
@@ -371,94 +635,269 @@ func (g *gzipSource) Read(p []byte) (n int, err error) {
 	return g.reader.Read(p)
 }
 
+func (g *gzipSource) CompressedProgress() (consumed, total int64) {
+	return g.counter.n.Load(), g.compressedSize
+}
+
 func (g *gzipSource) Close() error {
 	g.reader.Close()
+	g.input.Close()
 	return g.file.Close()
 }
 
-// xzSource decompresses xz files on-the-fly
+// xzSource decompresses xz files on-the-fly.
+// The xz container doesn't declare the uncompressed size up front, so Size
+// reports SizeUnknown and progress is derived from compressed bytes consumed.
 type xzSource struct {
-	file   *os.File
-	reader io.Reader
-	size   int64
-	name   string
+	file           *os.File
+	input          io.ReadCloser // file, or an SMB read-ahead over it
+	counter        *countingReader
+	reader         io.Reader
+	compressedSize int64
+	name           string
 }
 
 func newXzSource(path string) (*xzSource, error) {
-	file, err := os.Open(path)
+	file, err := openImageFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open xz file: %w", err)
 	}
 
-	xzr, err := xz.NewReader(file)
+	var compressedSize int64
+	if info, err := file.Stat(); err == nil {
+		compressedSize = info.Size()
+	}
+
+	// Buffer reads so the xz decoder doesn't issue tiny syscalls; the counter
+	// sits below the buffer so it tracks what was actually pulled from disk.
+	input := sequentialReader(file, path)
+	counter := &countingReader{r: input}
+	xzr, err := xz.NewReader(bufio.NewReaderSize(counter, 1<<20))
 	if err != nil {
+		input.Close()
 		file.Close()
 		return nil, fmt.Errorf("failed to read xz header: %w", err)
 	}
 
-	// XZ doesn't store uncompressed size in header, estimate from file size
-	info, _ := file.Stat()
-	estimatedSize := info.Size() * 5 // Typical compression ratio
-
 	// Remove .xz extension for display name
 	name := filepath.Base(path)
 	name = strings.TrimSuffix(name, filepath.Ext(name))
 
 	return &xzSource{
-		file:   file,
-		reader: xzr,
-		size:   estimatedSize,
-		name:   name,
+		file:           file,
+		input:          input,
+		counter:        counter,
+		reader:         xzr,
+		compressedSize: compressedSize,
+		name:           name,
 	}, nil
 }
 
-func (x *xzSource) Size() int64  { return x.size }
+func (x *xzSource) Size() int64  { return SizeUnknown }
 func (x *xzSource) Name() string { return x.name }
 
 func (x *xzSource) Read(p []byte) (n int, err error) {
 	return x.reader.Read(p)
 }
 
+func (x *xzSource) CompressedProgress() (consumed, total int64) {
+	return x.counter.n.Load(), x.compressedSize
+}
+
 func (x *xzSource) Close() error {
+	x.input.Close()
 	return x.file.Close()
 }
 
 // zstdSource decompresses zstd files on-the-fly
 type zstdSource struct {
-	file   *os.File
-	reader *zstd.Decoder
-	size   int64
-	name   string
+	file           *os.File
+	input          io.ReadCloser // file, or an SMB read-ahead over it
+	counter        *countingReader
+	reader         *zstd.Decoder
+	size           int64
+	compressedSize int64
+	name           string
 }
 
 func newZstdSource(path string) (*zstdSource, error) {
-	file, err := os.Open(path)
+	file, err := openImageFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open zstd file: %w", err)
 	}
 
-	zr, err := zstd.NewReader(file)
+	// Frame_Content_Size is optional; fall back to unknown-size mode without it
+	size := SizeUnknown
+	var compressedSize int64
+	if info, err := file.Stat(); err == nil {
+		compressedSize = info.Size()
+		size = getZstdContentSize(file, compressedSize)
+	}
+
+	input := sequentialReader(file, path)
+	counter := &countingReader{r: input}
+	zr, err := zstd.NewReader(counter)
 	if err != nil {
+		input.Close()
 		file.Close()
 		return nil, fmt.Errorf("failed to read zstd header: %w", err)
 	}
 
-	// ZSTD doesn't always store uncompressed size, estimate from file size
-	info, _ := file.Stat()
-	estimatedSize := info.Size() * 4 // Typical compression ratio
-
 	// Remove .zst/.zstd extension for display name
 	name := filepath.Base(path)
 	name = strings.TrimSuffix(name, filepath.Ext(name))
 
 	return &zstdSource{
-		file:   file,
-		reader: zr,
-		size:   estimatedSize,
-		name:   name,
+		file:           file,
+		input:          input,
+		counter:        counter,
+		reader:         zr,
+		size:           size,
+		compressedSize: compressedSize,
+		name:           name,
 	}, nil
 }
 
+// zstdFrameMagic is the little-endian magic number that starts a zstd frame.
+const zstdFrameMagic = 0xFD2FB528
+
+// zstdSkippableMagic is the magic number of skippable frames, whose low four
+// bits may take any value.
+const zstdSkippableMagic = 0x184D2A50
+
+// getZstdContentSize sums the Frame_Content_Size fields of every frame in the
+// file (RFC 8878, section 3.1.1), since pzstd and concatenated archives hold
+// several frames. Each frame's block headers are walked to find where the
+// next one starts, and skippable frames are stepped over. Returns SizeUnknown
+// if any frame doesn't declare its size or the frames don't end exactly at
+// fileSize.
+func getZstdContentSize(file *os.File, fileSize int64) int64 {
+	var total, offset int64
+	for offset < fileSize {
+		// Magic (4) + descriptor (1) + window (1) + dictionary ID (4) + content size (8)
+		header := make([]byte, 18)
+		n, _ := file.ReadAt(header, offset)
+		if n < 8 {
+			return SizeUnknown
+		}
+
+		if binary.LittleEndian.Uint32(header[0:4])&0xFFFFFFF0 == zstdSkippableMagic {
+			offset += 8 + int64(binary.LittleEndian.Uint32(header[4:8]))
+			continue
+		}
+
+		size, headerLen, checksum := parseZstdFrameHeader(header[:n])
+		if size == SizeUnknown {
+			return SizeUnknown
+		}
+		total += size
+		if total > 1<<62 {
+			return SizeUnknown
+		}
+
+		frameLen, ok := zstdBlocksLen(file, offset+int64(headerLen), fileSize)
+		if !ok {
+			return SizeUnknown
+		}
+		offset += int64(headerLen) + frameLen
+		if checksum {
+			offset += 4 // Content_Checksum
+		}
+	}
+	if offset != fileSize {
+		return SizeUnknown
+	}
+	return total
+}
+
+// parseZstdFrameHeader decodes a zstd frame header, returning the declared
+// content size (SizeUnknown if absent), the header's length and whether a
+// content checksum follows the last block.
+func parseZstdFrameHeader(header []byte) (size int64, headerLen int, checksum bool) {
+	if len(header) < 5 || binary.LittleEndian.Uint32(header[0:4]) != zstdFrameMagic {
+		return SizeUnknown, 0, false
+	}
+
+	descriptor := header[4]
+	fcsFlag := descriptor >> 6
+	singleSegment := descriptor&0x20 != 0
+	checksum = descriptor&0x04 != 0
+	dictFlag := descriptor & 0x03
+
+	offset := 5
+	if !singleSegment {
+		offset++ // Window_Descriptor
+	}
+	offset += [4]int{0, 1, 2, 4}[dictFlag]
+
+	var fcsSize int
+	switch fcsFlag {
+	case 0:
+		if !singleSegment {
+			return SizeUnknown, 0, false // Content size not declared
+		}
+		fcsSize = 1
+	case 1:
+		fcsSize = 2
+	case 2:
+		fcsSize = 4
+	case 3:
+		fcsSize = 8
+	}
+	if offset+fcsSize > len(header) {
+		return SizeUnknown, 0, false
+	}
+
+	headerLen = offset + fcsSize
+	field := header[offset:headerLen]
+	switch fcsSize {
+	case 1:
+		size = int64(field[0])
+	case 2:
+		size = int64(binary.LittleEndian.Uint16(field)) + 256
+	case 4:
+		size = int64(binary.LittleEndian.Uint32(field))
+	default:
+		fcs := binary.LittleEndian.Uint64(field)
+		if fcs > 1<<62 {
+			return SizeUnknown, 0, false
+		}
+		size = int64(fcs)
+	}
+	return size, headerLen, checksum
+}
+
+// zstdBlocksLen walks the block headers starting at offset and returns the
+// combined length of the frame's blocks, up to and including the last one.
+func zstdBlocksLen(file *os.File, offset, fileSize int64) (int64, bool) {
+	start := offset
+	var blockHeader [3]byte
+	for {
+		if _, err := file.ReadAt(blockHeader[:], offset); err != nil {
+			return 0, false
+		}
+		bh := uint32(blockHeader[0]) | uint32(blockHeader[1])<<8 | uint32(blockHeader[2])<<16
+		last := bh&1 != 0
+		blockSize := int64(bh >> 3)
+		offset += 3
+
+		switch (bh >> 1) & 3 {
+		case 0, 2: // Raw, Compressed
+			offset += blockSize
+		case 1: // RLE stores a single byte
+			offset++
+		default: // Reserved
+			return 0, false
+		}
+		if offset > fileSize {
+			return 0, false
+		}
+		if last {
+			return offset - start, true
+		}
+	}
+}
+
 func (z *zstdSource) Size() int64  { return z.size }
 func (z *zstdSource) Name() string { return z.name }
 
@@ -466,8 +905,13 @@ func (z *zstdSource) Read(p []byte) (n int, err error) {
 	return z.reader.Read(p)
 }
 
+func (z *zstdSource) CompressedProgress() (consumed, total int64) {
+	return z.counter.n.Load(), z.compressedSize
+}
+
 func (z *zstdSource) Close() error {
 	z.reader.Close()
+	z.input.Close()
 	return z.file.Close()
 }
 
@@ -476,6 +920,7 @@ func (z *zstdSource) Close() error {
 var httpClient = &http.Client{
 	Timeout: 0, // No overall timeout - we handle this via context
 	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
 		ResponseHeaderTimeout: 30 * time.Second,
 		IdleConnTimeout:       90 * time.Second,
 		DisableCompression:    true, // We want the raw bytes
@@ -483,14 +928,15 @@ var httpClient = &http.Client{
 }
 
 // urlSource streams image data from a remote HTTP/HTTPS URL.
-// Supports both direct image files and compressed archives.
+// Supports both direct image files and compressed streams (.gz, .xz, .zst).
 type urlSource struct {
-	resp     *http.Response
-	body     io.ReadCloser
-	size     int64
-	name     string
-	isZip    bool
-	zipInner io.ReadCloser // Inner reader when streaming from zip
+	body           *resumableBody
+	raw            io.Reader // body, possibly teed into SourceOptions.RawHash
+	size           int64
+	name           string
+	decoder        io.ReadCloser   // Decompressing reader wrapping body (nil for raw images)
+	counter        *countingReader // Counts compressed bytes fed to decoder
+	compressedSize int64           // Content-Length of the compressed stream, 0 if unknown
 }
 
 // IsURL returns true if the path looks like an HTTP/HTTPS URL.
@@ -500,7 +946,9 @@ func IsURL(path string) bool {
 
 // newURLSource creates a new source that streams from a remote URL.
 // Uses a single GET request (no HEAD) for better performance.
-func newURLSource(rawURL string) (*urlSource, error) {
+// If rawHash is non-nil, all bytes read from the response body are fed to it.
+// Dropped connections are resumed with Range requests as configured by httpOpts.
+func newURLSource(rawURL string, rawHash hash.Hash, httpOpts HTTPOptions) (*urlSource, error) {
 	// Validate URL format
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
@@ -511,21 +959,17 @@ func newURLSource(rawURL string) (*urlSource, error) {
 	}
 
 	// Open GET request directly (skip HEAD for better performance)
-	getResp, err := httpClient.Get(rawURL)
+	body, getResp, err := openResumable(rawURL, httpOpts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to URL: %w", err)
-	}
-
-	if getResp.StatusCode != http.StatusOK {
-		getResp.Body.Close()
-		return nil, fmt.Errorf("server returned error: %s", getResp.Status)
+		return nil, err
 	}
 
-	// Get content size from Content-Length header
+	// Get content size from Content-Length header. Servers streaming chunked
+	// responses don't send one; the image is then written until EOF and
+	// checked against the device capacity as it goes.
 	contentLength := getResp.ContentLength
 	if contentLength <= 0 {
-		getResp.Body.Close()
-		return nil, fmt.Errorf("server did not provide content size (Content-Length header missing or invalid)")
+		contentLength = SizeUnknown
 	}
 
 	// Detect filename and format from URL and headers
@@ -534,17 +978,74 @@ func newURLSource(rawURL string) (*urlSource, error) {
 	// If it's a zip file, we cannot stream-extract from HTTP without downloading first
 	// because zip format requires random access to read the central directory.
 	if isZip {
-		getResp.Body.Close()
+		body.Close()
 		return nil, fmt.Errorf("zip files from URLs are not supported (zip format requires random access); download the file first or use a direct image URL")
 	}
 
-	return &urlSource{
-		resp:  getResp,
-		body:  getResp.Body,
-		size:  contentLength,
-		name:  filename,
-		isZip: false,
-	}, nil
+	// 7z archives keep their header at the end of the file, so they need
+	// random access just like zip.
+	if strings.EqualFold(filepath.Ext(filename), ".7z") {
+		body.Close()
+		return nil, fmt.Errorf("7z files from URLs are not supported (7z format requires random access); download the file first or use a direct image URL")
+	}
+
+	var raw io.Reader = body
+	if rawHash != nil {
+		raw = io.TeeReader(body, rawHash)
+	}
+
+	src := &urlSource{
+		body: body,
+		raw:  raw,
+		size: contentLength,
+		name: filename,
+	}
+
+	// Compressed streams are decompressed on-the-fly. The uncompressed size
+	// can't be known without reading to the end, so report it as unknown.
+	ext := strings.ToLower(filepath.Ext(filename))
+	counter := &countingReader{r: raw}
+	decoder, err := newStreamDecoder(ext, counter)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	if decoder != nil {
+		src.decoder = decoder
+		src.counter = counter
+		src.compressedSize = max(contentLength, 0)
+		src.size = SizeUnknown
+		src.name = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+
+	return src, nil
+}
+
+// newStreamDecoder wraps r in a streaming decompressor chosen by file
+// extension. Returns a nil decoder (and no error) for uncompressed formats.
+func newStreamDecoder(ext string, r io.Reader) (io.ReadCloser, error) {
+	switch ext {
+	case ".gz", ".gzip":
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip header: %w", err)
+		}
+		return gzr, nil
+	case ".xz":
+		xzr, err := xz.NewReader(bufio.NewReaderSize(r, 1<<20))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read xz header: %w", err)
+		}
+		return io.NopCloser(xzr), nil
+	case ".zst", ".zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd header: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, nil
+	}
 }
 
 // detectURLType determines the filename and format from a URL and HTTP response.
@@ -599,15 +1100,27 @@ func (u *urlSource) Size() int64 {
 }
 
 func (u *urlSource) Read(p []byte) (n int, err error) {
-	if u.zipInner != nil {
-		return u.zipInner.Read(p)
+	if u.decoder != nil {
+		return u.decoder.Read(p)
+	}
+	return u.raw.Read(p)
+}
+
+func (u *urlSource) drainRaw() error {
+	_, err := io.Copy(io.Discard, u.raw)
+	return err
+}
+
+func (u *urlSource) CompressedProgress() (consumed, total int64) {
+	if u.counter == nil {
+		return 0, 0
 	}
-	return u.body.Read(p)
+	return u.counter.n.Load(), u.compressedSize
 }
 
 func (u *urlSource) Close() error {
-	if u.zipInner != nil {
-		u.zipInner.Close()
+	if u.decoder != nil {
+		u.decoder.Close()
 	}
 	return u.body.Close()
 }
@@ -0,0 +1,322 @@
+package flash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// SplitIndexExt is the extension of the index file that lists the chunks of
+// a split image, e.g. backup.img.zst.split for backup.img.zst.001, .002...
+const SplitIndexExt = ".split"
+
+// FAT32MaxFileSize is the largest file FAT32 can store (4GB minus 1 byte),
+// the default chunk size for split images.
+const FAT32MaxFileSize = 1<<32 - 1
+
+// SplitIndex describes an image stored as numbered chunks. The chunks are
+// plain byte ranges of the image file and concatenate back into it.
+type SplitIndex struct {
+	Image     string       `json:"image"`     // File name of the whole image, e.g. backup.img.zst
+	Size      int64        `json:"size"`      // Total size of the chunks
+	ChunkSize int64        `json:"chunkSize"` // Size of every chunk but the last
+	Chunks    []SplitChunk `json:"chunks"`
+}
+
+// SplitChunk is one file of a split image, named relative to the index.
+type SplitChunk struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// IsSplitIndex reports whether path names a split image index.
+func IsSplitIndex(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), SplitIndexExt)
+}
+
+// splitChunkPath returns the path of chunk i (0-based) of imagePath.
+func splitChunkPath(imagePath string, i int) string {
+	return fmt.Sprintf("%s.%03d", imagePath, i+1)
+}
+
+// resolveSplitIndex returns the index of a split image given either the
+// index itself or its first chunk (image.001), or "" if path is neither.
+func resolveSplitIndex(path string) string {
+	if IsSplitIndex(path) {
+		return path
+	}
+	if strings.HasSuffix(path, ".001") {
+		index := strings.TrimSuffix(path, ".001") + SplitIndexExt
+		if _, err := os.Stat(index); err == nil {
+			return index
+		}
+	}
+	return ""
+}
+
+// LoadSplitIndex reads a split image index and checks that all its chunks
+// are present with the recorded sizes.
+func LoadSplitIndex(indexPath string) (*SplitIndex, error) {
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read split index: %w", err)
+	}
+	var index SplitIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid split index %s: %w", filepath.Base(indexPath), err)
+	}
+	if len(index.Chunks) == 0 {
+		return nil, fmt.Errorf("split index %s lists no chunks", filepath.Base(indexPath))
+	}
+
+	dir := filepath.Dir(indexPath)
+	var total int64
+	for _, c := range index.Chunks {
+		// Chunks sit next to the index; a name that leads elsewhere isn't one
+		if c.Name == "" || c.Name == "." || c.Name == ".." || strings.ContainsAny(c.Name, `/\:`) {
+			return nil, fmt.Errorf("invalid chunk name %q in split index %s", c.Name, filepath.Base(indexPath))
+		}
+		info, err := os.Stat(filepath.Join(dir, c.Name))
+		if err != nil {
+			return nil, fmt.Errorf("missing chunk %s of split image", c.Name)
+		}
+		if info.Size() != c.Size {
+			return nil, fmt.Errorf("chunk %s is %d bytes, expected %d", c.Name, info.Size(), c.Size)
+		}
+		total += c.Size
+	}
+	if total != index.Size {
+		return nil, fmt.Errorf("split image chunks add up to %d bytes, expected %d", total, index.Size)
+	}
+	return &index, nil
+}
+
+// writeSplitIndex writes the index of a split image atomically; the chunks
+// aren't considered a complete image until it exists.
+func writeSplitIndex(indexPath string, index *SplitIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := indexPath + ".partial"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write split index: %w", err)
+	}
+	if err := os.Rename(tmp, indexPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write split index: %w", err)
+	}
+	return nil
+}
+
+// splitWriter writes a stream to numbered chunk files of at most chunkSize
+// bytes each. With sparse set, all-zero blocks become holes in the chunks.
+type splitWriter struct {
+	imagePath string
+	chunkSize int64
+	sparse    bool
+
+	file    *os.File
+	w       io.Writer
+	sw      *sparseWriter
+	written int64 // Bytes in the current chunk
+	chunks  []SplitChunk
+}
+
+func newSplitWriter(imagePath string, chunkSize int64, sparse bool) *splitWriter {
+	return &splitWriter{imagePath: imagePath, chunkSize: chunkSize, sparse: sparse}
+}
+
+func (s *splitWriter) Write(p []byte) (int, error) {
+	var total int
+	for len(p) > 0 {
+		if s.file == nil || s.written == s.chunkSize {
+			if err := s.nextChunk(); err != nil {
+				return total, err
+			}
+		}
+		n := int(min(int64(len(p)), s.chunkSize-s.written))
+		n, err := s.w.Write(p[:n])
+		total += n
+		s.written += int64(n)
+		s.chunks[len(s.chunks)-1].Size = s.written
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// nextChunk closes the current chunk and starts the next one.
+func (s *splitWriter) nextChunk() error {
+	if err := s.closeChunk(); err != nil {
+		return err
+	}
+	path := splitChunkPath(s.imagePath, len(s.chunks))
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create chunk: %w", err)
+	}
+	s.file, s.w, s.sw, s.written = file, file, nil, 0
+	if s.sparse {
+		s.sw = newSparseWriter(file)
+		s.w = s.sw
+	}
+	s.chunks = append(s.chunks, SplitChunk{Name: filepath.Base(path)})
+	return nil
+}
+
+func (s *splitWriter) closeChunk() error {
+	if s.file == nil {
+		return nil
+	}
+	var err error
+	if s.sw != nil {
+		err = s.sw.Finish()
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
+
+// Close finishes the last chunk.
+func (s *splitWriter) Close() error {
+	return s.closeChunk()
+}
+
+// Remove deletes the chunks written so far.
+func (s *splitWriter) Remove() {
+	s.closeChunk()
+	for i := range s.chunks {
+		os.Remove(splitChunkPath(s.imagePath, i))
+	}
+}
+
+// index returns the index describing the chunks written.
+func (s *splitWriter) index() *SplitIndex {
+	index := &SplitIndex{
+		Image:     filepath.Base(s.imagePath),
+		ChunkSize: s.chunkSize,
+		Chunks:    s.chunks,
+	}
+	for _, c := range s.chunks {
+		index.Size += c.Size
+	}
+	return index
+}
+
+// chunkReader reads the chunks of a split image as one stream.
+type chunkReader struct {
+	dir    string
+	chunks []SplitChunk
+	next   int
+	file   *os.File
+	n      atomic.Int64 // Bytes read so far
+}
+
+func openChunkReader(indexPath string, index *SplitIndex) *chunkReader {
+	return &chunkReader{dir: filepath.Dir(indexPath), chunks: index.Chunks}
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.file == nil {
+			if c.next == len(c.chunks) {
+				return 0, io.EOF
+			}
+			file, err := os.Open(filepath.Join(c.dir, c.chunks[c.next].Name))
+			if err != nil {
+				return 0, fmt.Errorf("failed to open chunk: %w", err)
+			}
+			c.file = file
+			c.next++
+		}
+		n, err := c.file.Read(p)
+		c.n.Add(int64(n))
+		if err == io.EOF {
+			c.file.Close()
+			c.file = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// splitSource reassembles a split image, decompressing it if the image
+// name has a .gz, .xz or .zst extension.
+type splitSource struct {
+	name    string
+	size    int64
+	total   int64 // Total chunk size, for compressed progress
+	chunks  *chunkReader
+	decoder io.ReadCloser
+}
+
+func newSplitSource(indexPath string) (*splitSource, error) {
+	index, err := LoadSplitIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(index.Image))
+	if ext == ".zip" || ext == ".7z" {
+		return nil, errors.New("split archives are not supported; join the chunks first")
+	}
+
+	s := &splitSource{
+		name:   index.Image,
+		size:   index.Size,
+		total:  index.Size,
+		chunks: openChunkReader(indexPath, index),
+	}
+	decoder, err := newStreamDecoder(ext, s.chunks)
+	if err != nil {
+		s.chunks.Close()
+		return nil, err
+	}
+	if decoder != nil {
+		s.decoder = decoder
+		s.size = SizeUnknown
+	}
+	return s, nil
+}
+
+func (s *splitSource) Size() int64  { return s.size }
+func (s *splitSource) Name() string { return s.name }
+
+func (s *splitSource) Read(p []byte) (int, error) {
+	if s.decoder != nil {
+		return s.decoder.Read(p)
+	}
+	return s.chunks.Read(p)
+}
+
+func (s *splitSource) CompressedProgress() (consumed, total int64) {
+	return s.chunks.n.Load(), s.total
+}
+
+func (s *splitSource) Close() error {
+	if s.decoder != nil {
+		s.decoder.Close()
+	}
+	return s.chunks.Close()
+}
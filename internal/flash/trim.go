@@ -0,0 +1,144 @@
+package flash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// trimHeaderSize is how much of the image is read to find the partition
+// table: LBA 0-1 plus a 128-entry GPT array, for 512- and 4096-byte sectors.
+const trimHeaderSize = 64 << 10
+
+// newTrimmedSource limits src to the end of the last partition described by
+// the MBR or GPT at the start of the image, so unpartitioned space at the end
+// of large images isn't written. count (if > 0) further caps the size.
+// Images without a recognizable partition table, and ISO9660 images, are
+// passed through unchanged: hybrid ISOs keep their filesystem outside the
+// partitions, and may come as .img or inside an archive, so they are
+// recognized by their content rather than their name.
+func newTrimmedSource(src Source, count int64) (Source, error) {
+	header := make([]byte, trimHeaderSize)
+	n, err := io.ReadFull(src, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	size := src.Size()
+	limit := count
+	if _, iso := isoImageSize(header); iso {
+		// Nothing to trim
+	} else if end := partitionTableEnd(header); end > 0 && (size == SizeUnknown || end < size) {
+		if limit == 0 || end < limit {
+			limit = end
+		}
+	}
+
+	reader := io.MultiReader(bytes.NewReader(header), src)
+	if limit > 0 {
+		reader = io.LimitReader(reader, limit)
+		if size == SizeUnknown || limit < size {
+			size = limit
+		}
+	}
+
+	return &regionSource{Source: src, reader: reader, size: size, skipped: true}, nil
+}
+
+// partitionTableEnd returns the byte offset just past the last partition in
+// the image's MBR or GPT, or 0 if header doesn't start with a partition table.
+func partitionTableEnd(header []byte) int64 {
+	if len(header) < 512 || header[510] != 0x55 || header[511] != 0xAA {
+		return 0
+	}
+
+	// A FAT/NTFS/exFAT boot sector also ends in 55AA but has no partition table
+	if isVolumeBootRecord(header) {
+		return 0
+	}
+
+	var end int64
+	protective := false
+	for i := 0; i < 4; i++ {
+		entry := header[446+i*16 : 446+(i+1)*16]
+		status, partType := entry[0], entry[4]
+		if status != 0x00 && status != 0x80 {
+			return 0 // Not a valid MBR partition entry
+		}
+		if partType == 0 {
+			continue
+		}
+		if partType == 0xEE {
+			protective = true
+			continue
+		}
+		start := int64(binary.LittleEndian.Uint32(entry[8:12]))
+		sectors := int64(binary.LittleEndian.Uint32(entry[12:16]))
+		if start == 0 || sectors == 0 {
+			return 0
+		}
+		// Extended partitions (0x05/0x0F/0x85) contain their logical drives,
+		// so their end also bounds every logical partition.
+		end = max(end, (start+sectors)*512)
+	}
+
+	if protective {
+		return gptEnd(header)
+	}
+	return end
+}
+
+// gptEnd returns the byte offset just past the last GPT partition, trying
+// 512- and 4096-byte logical sectors, or 0 if no valid GPT header is found.
+func gptEnd(header []byte) int64 {
+	for _, sectorSize := range []int{512, 4096} {
+		if len(header) < sectorSize+92 || string(header[sectorSize:sectorSize+8]) != "EFI PART" {
+			continue
+		}
+		gpt := header[sectorSize:]
+		entriesLBA := binary.LittleEndian.Uint64(gpt[72:80])
+		numEntries := int64(binary.LittleEndian.Uint32(gpt[80:84]))
+		entrySize := int64(binary.LittleEndian.Uint32(gpt[84:88]))
+		if entrySize < 128 || entriesLBA < 2 {
+			return 0
+		}
+
+		// Entry array lies outside what we read; don't guess
+		if entriesLBA > uint64(len(header)/sectorSize) {
+			return 0
+		}
+		entriesStart := int64(entriesLBA) * int64(sectorSize)
+		if numEntries > (int64(len(header))-entriesStart)/entrySize {
+			return 0
+		}
+
+		var lastLBA int64
+		for i := int64(0); i < numEntries; i++ {
+			entry := header[entriesStart+i*entrySize : entriesStart+(i+1)*entrySize]
+			if isZero(entry[0:16]) {
+				continue // Unused entry (zero type GUID)
+			}
+			last := binary.LittleEndian.Uint64(entry[40:48])
+			if last >= uint64(math.MaxInt64/sectorSize) {
+				return 0 // Corrupt entry; don't guess
+			}
+			lastLBA = max(lastLBA, int64(last))
+		}
+		if lastLBA == 0 {
+			return 0
+		}
+		return (lastLBA + 1) * int64(sectorSize)
+	}
+	return 0
+}
+
+// isVolumeBootRecord reports whether sector 0 is a filesystem boot sector
+// (a "superfloppy" image) rather than an MBR.
+func isVolumeBootRecord(sector []byte) bool {
+	return string(sector[3:7]) == "NTFS" ||
+		string(sector[3:8]) == "EXFAT" ||
+		string(sector[54:57]) == "FAT" ||
+		string(sector[82:87]) == "FAT32"
+}
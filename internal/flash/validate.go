@@ -0,0 +1,154 @@
+package flash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Image formats reported by ValidateImageHeader
+const (
+	ImageFormatMBR        = "mbr"
+	ImageFormatGPT        = "gpt"
+	ImageFormatISO9660    = "iso9660"
+	ImageFormatFilesystem = "filesystem" // Bare FAT/NTFS/exFAT/ext volume (no partition table)
+	ImageFormatUnknown    = "unknown"
+)
+
+// validateHeaderSize covers the partition tables and the ISO9660 primary
+// volume descriptor at 32KB.
+const validateHeaderSize = 64 << 10
+
+// isoPVDOffset is where the ISO9660 primary volume descriptor starts.
+const isoPVDOffset = 16 * 2048
+
+// ImageValidation is the result of sanity-checking the start of an image.
+// Errors mean the image is almost certainly not what the user meant to
+// write (an HTML error page, a truncated download); warnings are merely
+// unusual.
+type ImageValidation struct {
+	Format   string   `json:"format"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// OK reports whether no errors were found.
+func (v *ImageValidation) OK() bool {
+	return len(v.Errors) == 0
+}
+
+// ValidateImageHeader inspects the first bytes of an image for a partition
+// table, ISO9660 descriptor or filesystem boot sector. size is the image
+// size (SizeUnknown if not known) and is used to detect truncation.
+func ValidateImageHeader(header []byte, size int64) *ImageValidation {
+	v := &ImageValidation{Format: ImageFormatUnknown}
+
+	if len(header) < 512 {
+		v.Errors = append(v.Errors, fmt.Sprintf("image is only %d bytes; too small to be a disk image", len(header)))
+		return v
+	}
+
+	if looksLikeText(header) {
+		kind := "a text file"
+		if isHTML(header) {
+			kind = "an HTML page (a download error page?)"
+		}
+		v.Errors = append(v.Errors, "image looks like "+kind+", not a disk image")
+		return v
+	}
+
+	// Hybrid ISOs carry both an MBR and an ISO9660 descriptor; report them
+	// as ISO since that's what the size check needs.
+	if iso, ok := isoImageSize(header); ok {
+		v.Format = ImageFormatISO9660
+		if size != SizeUnknown && iso > size {
+			v.Errors = append(v.Errors, fmt.Sprintf("image is truncated: the ISO9660 volume is %s but the image is only %s",
+				FormatBytes(iso), FormatBytes(size)))
+		}
+		return v
+	}
+
+	if end := partitionTableEnd(header); end > 0 {
+		v.Format = ImageFormatMBR
+		if header[446+4] == 0xEE {
+			v.Format = ImageFormatGPT
+		}
+		if size != SizeUnknown && end > size {
+			v.Errors = append(v.Errors, fmt.Sprintf("image is truncated: partitions extend to %s but the image is only %s",
+				FormatBytes(end), FormatBytes(size)))
+		}
+		return v
+	}
+
+	if isFilesystemImage(header) {
+		v.Format = ImageFormatFilesystem
+		v.Warnings = append(v.Warnings, "image is a bare filesystem with no partition table; some systems won't boot or mount it")
+		return v
+	}
+
+	if isZero(header) {
+		v.Warnings = append(v.Warnings, fmt.Sprintf("the first %s of the image are all zeros", FormatBytes(int64(len(header)))))
+	} else {
+		v.Warnings = append(v.Warnings, "no partition table, ISO9660 or filesystem signature found")
+	}
+	return v
+}
+
+// validateSource reads the start of src, checks it, and returns a source
+// that replays the header so nothing is lost.
+func validateSource(src Source) (*ImageValidation, Source, error) {
+	header := make([]byte, validateHeaderSize)
+	n, err := io.ReadFull(src, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, nil, err
+	}
+	header = header[:n]
+
+	replay := &regionSource{
+		Source:  src,
+		reader:  io.MultiReader(bytes.NewReader(header), src),
+		size:    src.Size(),
+		skipped: true,
+	}
+	return ValidateImageHeader(header, src.Size()), replay, nil
+}
+
+// isoImageSize returns the volume size declared by an ISO9660 primary
+// volume descriptor, if header contains one.
+func isoImageSize(header []byte) (int64, bool) {
+	pvd := isoPVDOffset
+	if len(header) < pvd+132 || header[pvd] != 1 || string(header[pvd+1:pvd+6]) != "CD001" {
+		return 0, false
+	}
+	blocks := int64(binary.LittleEndian.Uint32(header[pvd+80 : pvd+84]))
+	blockSize := int64(binary.LittleEndian.Uint16(header[pvd+128 : pvd+130]))
+	return blocks * blockSize, true
+}
+
+// isFilesystemImage reports whether header starts with a FAT, NTFS or exFAT
+// boot sector, or holds an ext2/3/4 superblock.
+func isFilesystemImage(header []byte) bool {
+	if header[510] == 0x55 && header[511] == 0xAA && isVolumeBootRecord(header) {
+		return true
+	}
+	return len(header) >= 1024+58 && binary.LittleEndian.Uint16(header[1024+56:1024+58]) == 0xEF53
+}
+
+// looksLikeText reports whether the first 4KB are (almost) all printable
+// ASCII, which a disk image never is.
+func looksLikeText(header []byte) bool {
+	sample := header[:min(len(header), 4096)]
+	printable := 0
+	for _, b := range sample {
+		if b == '\t' || b == '\n' || b == '\r' || (b >= 0x20 && b < 0x7F) {
+			printable++
+		}
+	}
+	return printable*100 >= len(sample)*95
+}
+
+func isHTML(header []byte) bool {
+	start := bytes.ToLower(bytes.TrimSpace(header[:min(len(header), 512)]))
+	return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html"))
+}
@@ -0,0 +1,275 @@
+package flash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// Verify modes
+const (
+	// VerifyModeBytes compares the drive with the image buffer by buffer and
+	// stops at the first difference.
+	VerifyModeBytes = "bytes"
+	// VerifyModeHash hashes the image and the same range of the drive and
+	// compares the digests, reporting both.
+	VerifyModeHash = "hash"
+)
+
+// VerifyOptions configures a read-only comparison of a drive with an image.
+type VerifyOptions struct {
+	DiskNumber    int
+	DriveLetter   string // Optional: cached drive letter to avoid WMI lookup
+	ImagePath     string
+	Source        SourceOptions
+	Mode          string // VerifyModeBytes (default) or VerifyModeHash
+	HashAlgorithm string // For VerifyModeHash (default: sha256)
+	BufferSize    int    // Buffer size in MB (default: 4)
+}
+
+// VerifyResult describes a finished verification.
+type VerifyResult struct {
+	DiskNumber    int    `json:"diskNumber"`
+	Image         string `json:"image"`
+	Mode          string `json:"mode"`
+	Match         bool   `json:"match"`
+	BytesCompared int64  `json:"bytesCompared"`
+	// MismatchOffset is the drive offset of the first differing byte, in
+	// bytes mode.
+	MismatchOffset *int64 `json:"mismatchOffset,omitempty"`
+	HashAlgorithm  string `json:"hashAlgorithm,omitempty"`
+	ImageHash      string `json:"imageHash,omitempty"`
+	DiskHash       string `json:"diskHash,omitempty"`
+	Duration       string `json:"duration"`
+}
+
+// Verifier compares a drive with an image without writing to it.
+type Verifier struct {
+	progressChan chan Progress
+}
+
+// NewVerifier creates a new verifier
+func NewVerifier() *Verifier {
+	return &Verifier{
+		progressChan: make(chan Progress, 10),
+	}
+}
+
+// Progress returns a channel that receives progress updates
+func (v *Verifier) Progress() <-chan Progress {
+	return v.progressChan
+}
+
+// Verify reads the image and the drive side by side. A drive that doesn't
+// match is reported in the result, not as an error; errors mean the
+// comparison couldn't be completed.
+func (v *Verifier) Verify(ctx context.Context, opts VerifyOptions) (*VerifyResult, error) {
+	defer close(v.progressChan)
+	start := time.Now()
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = VerifyModeBytes
+	}
+	var imageHash, diskHash hash.Hash
+	switch mode {
+	case VerifyModeBytes:
+	case VerifyModeHash:
+		algo := opts.HashAlgorithm
+		if algo == "" {
+			algo = "sha256"
+		}
+		var err error
+		if imageHash, err = newHash(algo); err != nil {
+			v.sendError(err.Error())
+			return nil, err
+		}
+		diskHash, _ = newHash(algo)
+		opts.HashAlgorithm = algo
+	default:
+		err := fmt.Errorf("unsupported verify mode %q", mode)
+		v.sendError(err.Error())
+		return nil, err
+	}
+
+	opts.Source.HTTP.Context = ctx
+	source, err := OpenSourceWithOptions(opts.ImagePath, opts.Source)
+	if err != nil {
+		v.sendError(err.Error())
+		return nil, err
+	}
+	defer source.Close()
+
+	var reader *diskWriter
+	if opts.DriveLetter != "" {
+		reader = newDiskWriterWithDriveLetter(opts.DiskNumber, opts.DriveLetter)
+	} else {
+		reader = newDiskWriter(opts.DiskNumber)
+	}
+	if err := reader.Open(); err != nil {
+		v.sendError(err.Error())
+		return nil, err
+	}
+	defer reader.Close()
+
+	geo, err := disk.GetDiskGeometry(reader.handle)
+	if err != nil {
+		v.sendError(err.Error())
+		return nil, err
+	}
+	diskSize := geo.DiskSize
+	if size := source.Size(); size != SizeUnknown && size > diskSize {
+		err := fmt.Errorf("image (%s) is larger than the drive (%s)", FormatBytes(size), FormatBytes(diskSize))
+		v.sendError(err.Error())
+		return nil, err
+	}
+
+	bufSize := opts.BufferSize << 20
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+	sourceBuffer := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, sourceBuffer)
+	diskBuffer := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, diskBuffer)
+
+	result := &VerifyResult{
+		DiskNumber:    opts.DiskNumber,
+		Image:         source.Name(),
+		Mode:          mode,
+		Match:         true,
+		HashAlgorithm: opts.HashAlgorithm,
+	}
+	totalSize := source.Size()
+	lastProgressUpdate := start
+	v.sendProgress(0, 0, totalSize, "")
+
+	for {
+		select {
+		case <-ctx.Done():
+			v.sendError("verification cancelled")
+			return nil, ctx.Err()
+		default:
+		}
+
+		// Full buffers keep disk reads aligned
+		n, err := io.ReadFull(source, sourceBuffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			err = fmt.Errorf("read image: %w", err)
+			v.sendError(err.Error())
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		offset := result.BytesCompared
+		if offset+int64(n) > diskSize {
+			err := fmt.Errorf("image is larger than the drive (%s)", FormatBytes(diskSize))
+			v.sendError(err.Error())
+			return nil, err
+		}
+
+		readSize := min(int64(alignSize(n)), diskSize-offset)
+		if _, err := reader.ReadAt(diskBuffer[:readSize], offset); err != nil {
+			err = fmt.Errorf("read disk at offset %d: %w", offset, err)
+			v.sendError(err.Error())
+			return nil, err
+		}
+
+		if imageHash != nil {
+			imageHash.Write(sourceBuffer[:n])
+			diskHash.Write(diskBuffer[:n])
+		} else if !bytes.Equal(sourceBuffer[:n], diskBuffer[:n]) {
+			mismatch := offset + int64(firstDifference(sourceBuffer[:n], diskBuffer[:n]))
+			result.Match = false
+			result.MismatchOffset = &mismatch
+			result.BytesCompared = mismatch
+			break
+		}
+		result.BytesCompared += int64(n)
+
+		now := time.Now()
+		if now.Sub(lastProgressUpdate) >= progressUpdateInterval {
+			lastProgressUpdate = now
+			speed := ""
+			if elapsed := now.Sub(start).Seconds(); elapsed > 0 {
+				speed = formatSpeed(float64(result.BytesCompared) / elapsed)
+			}
+			v.sendProgress(sourcePercent(source, result.BytesCompared, totalSize), result.BytesCompared, totalSize, speed)
+		}
+	}
+
+	if result.Match && result.BytesCompared == 0 {
+		err := errors.New("image is empty")
+		v.sendError(err.Error())
+		return nil, err
+	}
+	if imageHash != nil {
+		result.ImageHash = fmt.Sprintf("%x", imageHash.Sum(nil))
+		result.DiskHash = fmt.Sprintf("%x", diskHash.Sum(nil))
+		result.Match = result.ImageHash == result.DiskHash
+	}
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	if result.Match {
+		v.sendComplete(result.BytesCompared, result.DiskHash)
+	} else {
+		v.sendError("drive does not match the image")
+	}
+	return result, nil
+}
+
+// firstDifference returns the index of the first byte where a and b differ.
+func firstDifference(a, b []byte) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return len(a)
+}
+
+func (v *Verifier) sendProgress(percentage int, bytesVerified, totalBytes int64, speed string) {
+	select {
+	case v.progressChan <- Progress{
+		Stage:        StageVerifying,
+		Percentage:   percentage,
+		BytesWritten: bytesVerified,
+		TotalBytes:   totalBytes,
+		Speed:        speed,
+		Status:       StatusInProgress,
+	}:
+	default:
+	}
+}
+
+func (v *Verifier) sendError(errMsg string) {
+	select {
+	case v.progressChan <- Progress{
+		Stage:  "Error",
+		Status: StatusError,
+		Error:  errMsg,
+	}:
+	default:
+	}
+}
+
+func (v *Verifier) sendComplete(totalBytes int64, hash string) {
+	select {
+	case v.progressChan <- Progress{
+		Stage:        StageComplete,
+		Percentage:   100,
+		BytesWritten: totalBytes,
+		TotalBytes:   totalBytes,
+		Status:       StatusComplete,
+		Hash:         hash,
+	}:
+	default:
+	}
+}
@@ -0,0 +1,310 @@
+package flash
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// StageWiping is reported while a wipe pass overwrites the drive
+const StageWiping = "Wiping"
+
+// Wipe patterns
+const (
+	WipePatternZero   = "zero"   // 0x00 on every pass
+	WipePatternRandom = "random" // Fresh pseudorandom data on every pass
+	WipePatternDoD    = "dod"    // DoD 5220.22-M: 0x00, 0xFF, random; --passes repeats the cycle
+)
+
+// WipeOptions configures a wipe.
+type WipeOptions struct {
+	DiskNumber  int
+	DriveLetter string // Optional: cached drive letter to avoid WMI lookup
+	Passes      int    // Times to apply the pattern (default: 1)
+	Pattern     string // WipePatternZero (default), WipePatternRandom or WipePatternDoD
+	Verify      bool   // Read the drive back after the last pass
+	Trim        bool   // TRIM the whole drive after the passes (and verify)
+	BufferSize  int    // Buffer size in MB (default: 4)
+}
+
+// WipeProgress is a progress update for a wipe. Percentage covers all
+// passes; the verify pass is reported on its own.
+type WipeProgress struct {
+	Pass   int `json:"pass,omitempty"`
+	Passes int `json:"passes,omitempty"`
+	Progress
+}
+
+// WipeResult describes a finished wipe.
+type WipeResult struct {
+	DiskNumber int    `json:"diskNumber"`
+	Size       int64  `json:"size"`
+	Pattern    string `json:"pattern"`
+	Passes     int    `json:"passes"` // Passes written, e.g. 3 for one dod cycle
+	Verified   bool   `json:"verified,omitempty"`
+	Trimmed    bool   `json:"trimmed,omitempty"`
+	Duration   string `json:"duration"`
+}
+
+// wipePass is one overwrite of the whole drive, with either a fill byte or
+// a pseudorandom stream.
+type wipePass struct {
+	fill   byte
+	random bool
+	seed   [32]byte
+}
+
+// wipePasses expands a pattern into the passes to write.
+func wipePasses(pattern string, passes int) ([]wipePass, error) {
+	if passes <= 0 {
+		passes = 1
+	}
+	var cycle []wipePass
+	switch pattern {
+	case "", WipePatternZero:
+		cycle = []wipePass{{fill: 0x00}}
+	case WipePatternRandom:
+		cycle = []wipePass{{random: true}}
+	case WipePatternDoD:
+		cycle = []wipePass{{fill: 0x00}, {fill: 0xFF}, {random: true}}
+	default:
+		return nil, fmt.Errorf("unsupported wipe pattern %q", pattern)
+	}
+
+	var result []wipePass
+	for range passes {
+		for _, p := range cycle {
+			if p.random {
+				// Seeded from the OS so passes can't be predicted, and kept
+				// so the last pass can be regenerated for verification
+				crand.Read(p.seed[:])
+			}
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// source returns a function that fills buffers with the pass's data, in
+// order from the start of the drive.
+func (p wipePass) source() func([]byte) {
+	if !p.random {
+		return func(buf []byte) {
+			for i := range buf {
+				buf[i] = p.fill
+			}
+		}
+	}
+	stream := rand.NewChaCha8(p.seed)
+	return func(buf []byte) {
+		stream.Read(buf)
+	}
+}
+
+// Wiper overwrites drives.
+type Wiper struct {
+	progressChan chan WipeProgress
+}
+
+// NewWiper creates a new wiper
+func NewWiper() *Wiper {
+	return &Wiper{
+		progressChan: make(chan WipeProgress, 10),
+	}
+}
+
+// Progress returns a channel that receives progress updates
+func (w *Wiper) Progress() <-chan WipeProgress {
+	return w.progressChan
+}
+
+// Wipe overwrites every sector of the drive once per pass and, with
+// Verify, reads it back to check the last pass landed. With Trim, the
+// drive's blocks are then discarded so the controller can erase them. The
+// drive is left without a partition table.
+func (w *Wiper) Wipe(ctx context.Context, opts WipeOptions) (*WipeResult, error) {
+	defer close(w.progressChan)
+	start := time.Now()
+
+	passes, err := wipePasses(opts.Pattern, opts.Passes)
+	if err != nil {
+		w.sendError(err.Error())
+		return nil, err
+	}
+
+	var writer *diskWriter
+	if opts.DriveLetter != "" {
+		writer = newDiskWriterWithDriveLetter(opts.DiskNumber, opts.DriveLetter)
+	} else {
+		writer = newDiskWriter(opts.DiskNumber)
+	}
+	if err := writer.Open(); err != nil {
+		w.sendError(err.Error())
+		return nil, err
+	}
+	defer writer.Close()
+
+	// Refuse up front rather than after hours of passes
+	if opts.Trim {
+		if err := checkTrimSupported(writer.handle); err != nil {
+			w.sendError(err.Error())
+			return nil, err
+		}
+	}
+
+	geo, err := disk.GetDiskGeometry(writer.handle)
+	if err != nil {
+		w.sendError(err.Error())
+		return nil, err
+	}
+	size := geo.DiskSize
+
+	bufSize := opts.BufferSize << 20
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+	buf := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, buf)
+
+	total := size * int64(len(passes))
+	for i, pass := range passes {
+		fill := pass.source()
+		// Fixed-byte passes write the same buffer every time
+		if !pass.random {
+			fill(buf)
+		}
+		err := forEachDiskChunk(ctx, size, bufSize, progressUpdateInterval, func(offset int64, n int) error {
+			if pass.random {
+				fill(buf[:n])
+			}
+			if _, err := writeWithRetry(writer, buf[:n], offset); err != nil {
+				return fmt.Errorf("pass %d: write at offset %d: %w", i+1, offset, err)
+			}
+			return nil
+		}, func(passDone int64) {
+			done := int64(i)*size + passDone
+			w.sendProgress(StageWiping, i+1, len(passes), progressPercent(done, total), done, total, phaseSpeed(done, start, time.Now()))
+		})
+		if ctx.Err() != nil {
+			w.sendError("wipe cancelled")
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			w.sendError(err.Error())
+			return nil, err
+		}
+	}
+
+	result := &WipeResult{
+		DiskNumber: opts.DiskNumber,
+		Size:       size,
+		Pattern:    opts.Pattern,
+		Passes:     len(passes),
+	}
+	if result.Pattern == "" {
+		result.Pattern = WipePatternZero
+	}
+
+	if opts.Verify {
+		if err := w.verify(ctx, writer, passes[len(passes)-1], size, bufSize); err != nil {
+			w.sendError(err.Error())
+			return nil, err
+		}
+		result.Verified = true
+	}
+
+	if opts.Trim {
+		w.sendProgress(StageTrimming, 0, 0, 0, 0, size, "")
+		err := discardDisk(ctx, writer.handle, size, func(done int64) {
+			w.sendProgress(StageTrimming, 0, 0, progressPercent(done, size), done, size, "")
+		})
+		if err != nil {
+			w.sendError(err.Error())
+			return nil, err
+		}
+		result.Trimmed = true
+	}
+
+	// The partition table is gone; let Windows forget the old volumes
+	disk.UpdateDiskProperties(writer.handle)
+
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	w.sendComplete(size)
+	return result, nil
+}
+
+// verify reads the drive back and compares it with the last pass.
+func (w *Wiper) verify(ctx context.Context, writer *diskWriter, pass wipePass, size int64, bufSize int) error {
+	expected := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, expected)
+	actual := GetBuffer(bufSize)
+	defer PutBuffer(bufSize, actual)
+
+	fill := pass.source()
+	if !pass.random {
+		fill(expected)
+	}
+	start := time.Now()
+	w.sendProgress(StageVerifying, 0, 0, 0, 0, size, "")
+	return forEachDiskChunk(ctx, size, bufSize, progressUpdateInterval, func(offset int64, n int) error {
+		if pass.random {
+			fill(expected[:n])
+		}
+		if _, err := writer.ReadAt(actual[:n], offset); err != nil {
+			return fmt.Errorf("verify: read at offset %d: %w", offset, err)
+		}
+		if !bytes.Equal(expected[:n], actual[:n]) {
+			return fmt.Errorf("verify: data mismatch at offset %d", offset+int64(firstDifference(expected[:n], actual[:n])))
+		}
+		return nil
+	}, func(done int64) {
+		w.sendProgress(StageVerifying, 0, 0, progressPercent(done, size), done, size, phaseSpeed(done, start, time.Now()))
+	})
+}
+
+func (w *Wiper) sendProgress(stage string, pass, passes, percentage int, done, totalBytes int64, speed string) {
+	select {
+	case w.progressChan <- WipeProgress{
+		Pass:   pass,
+		Passes: passes,
+		Progress: Progress{
+			Stage:        stage,
+			Percentage:   percentage,
+			BytesWritten: done,
+			TotalBytes:   totalBytes,
+			Speed:        speed,
+			Status:       StatusInProgress,
+		},
+	}:
+	default:
+	}
+}
+
+func (w *Wiper) sendError(errMsg string) {
+	select {
+	case w.progressChan <- WipeProgress{Progress: Progress{
+		Stage:  "Error",
+		Status: StatusError,
+		Error:  errMsg,
+	}}:
+	default:
+	}
+}
+
+func (w *Wiper) sendComplete(size int64) {
+	select {
+	case w.progressChan <- WipeProgress{Progress: Progress{
+		Stage:        StageComplete,
+		Percentage:   100,
+		BytesWritten: size,
+		TotalBytes:   size,
+		Status:       StatusComplete,
+	}}:
+	default:
+	}
+}
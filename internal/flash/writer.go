@@ -96,6 +96,12 @@ type diskWriter struct {
 	handle           windows.Handle
 	volumes          []windows.Handle
 	cachedDriveLetter string // Optional: pre-cached drive letter to avoid lookups
+
+	// Partition-targeted writes (see newPartitionWriter)
+	volumePath     string // Write through this volume device instead of PhysicalDriveN
+	baseOffset     int64  // Added to every offset (partition start when writing via PhysicalDriveN)
+	limit          int64  // Maximum writable bytes from baseOffset, 0 = whole device
+	skipVolumeLock bool   // Leave other volumes on the disk mounted
 }
 
 // newDiskWriter creates a writer for raw disk access
@@ -122,9 +128,15 @@ func newDiskWriterWithDriveLetter(diskNumber int, driveLetter string) *diskWrite
 
 // Open prepares the disk for writing by locking and dismounting volumes
 func (w *diskWriter) Open() error {
+	if w.volumePath != "" {
+		return w.openVolume()
+	}
+
 	// First, lock and dismount all volumes on this disk
-	if err := w.lockVolumes(); err != nil {
-		return fmt.Errorf("failed to lock volumes: %w", err)
+	if !w.skipVolumeLock {
+		if err := w.lockVolumes(); err != nil {
+			return fmt.Errorf("failed to lock volumes: %w", err)
+		}
 	}
 
 	// Open the physical disk for writing
@@ -315,7 +327,7 @@ func (w *diskWriter) WriteAt(data []byte, offset int64) (int, error) {
 	}
 
 	// Seek to position
-	_, err := windows.Seek(w.handle, offset, 0)
+	_, err := windows.Seek(w.handle, w.baseOffset+offset, 0)
 	if err != nil {
 		return 0, fmt.Errorf("seek failed: %w", err)
 	}
@@ -337,7 +349,7 @@ func (w *diskWriter) ReadAt(data []byte, offset int64) (int, error) {
 	}
 
 	// Seek to position
-	_, err := windows.Seek(w.handle, offset, 0)
+	_, err := windows.Seek(w.handle, w.baseOffset+offset, 0)
 	if err != nil {
 		return 0, fmt.Errorf("seek failed: %w", err)
 	}
@@ -0,0 +1,276 @@
+// Package fleet runs a duplication station: drives plugged into the
+// station's ports are flashed, labeled and ejected as they arrive.
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/usb"
+)
+
+// Event types, in the order a drive goes through them
+const (
+	EventInserted = "inserted" // A drive was plugged in and accepted
+	EventSkipped  = "skipped"  // A drive was plugged in but doesn't qualify
+	EventProgress = "progress" // Flash progress of a drive
+	EventComplete = "complete" // A drive is done, successfully or not
+	EventRemoved  = "removed"  // A drive was unplugged
+)
+
+const lockTimeout = 5 * time.Second
+
+// Event is one step of a drive's pass through the station, streamed as
+// NDJSON by the fleet command.
+type Event struct {
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	DiskNumber   int       `json:"diskNumber"`
+	Port         string    `json:"port,omitempty"`
+	SerialNumber string    `json:"serialNumber,omitempty"`
+	FriendlyName string    `json:"friendlyName,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	Reason       string    `json:"reason,omitempty"` // Why a drive was skipped
+	Stage        string    `json:"stage,omitempty"`
+	Percentage   int       `json:"percentage,omitempty"`
+	Speed        string    `json:"speed,omitempty"`
+	Success      bool      `json:"success,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Duration     string    `json:"duration,omitempty"`
+	Ejected      bool      `json:"ejected,omitempty"`
+}
+
+// Options configures a station.
+type Options struct {
+	Flash         flash.Options // Image and write settings; DiskNumber is set per drive
+	Ports         []int         // Hub port numbers to accept drives on; empty for any port
+	MinSize       int64         // Skip smaller drives, 0 = no limit
+	MaxSize       int64         // Skip larger drives, 0 = no limit
+	Label         string        // Volume label to set after flashing, empty to keep the image's
+	Eject         bool          // Eject each drive once it is done
+	MaxConcurrent int           // Drives processed at once, 0 = unlimited
+	TargetCount   int           // Stop once this many drives succeeded, 0 = run until cancelled
+}
+
+// Station flashes drives as they are plugged in.
+type Station struct {
+	opts   Options
+	ports  map[string]bool
+	sem    chan struct{}
+	events chan Event
+
+	mu        sync.Mutex
+	active    map[string]bool // PnP IDs of drives being processed
+	succeeded int
+	stop      context.CancelFunc // Stops watching for drives
+}
+
+// NewStation creates a station with the given options.
+func NewStation(opts Options) *Station {
+	maxConcurrent := opts.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = 100 // Effectively unlimited
+	}
+	ports := make(map[string]bool, len(opts.Ports))
+	for _, p := range opts.Ports {
+		ports[strconv.Itoa(p)] = true
+	}
+	return &Station{
+		opts:   opts,
+		ports:  ports,
+		sem:    make(chan struct{}, maxConcurrent),
+		events: make(chan Event, 64),
+		active: make(map[string]bool),
+	}
+}
+
+// Events returns the channel the station reports on. It is closed when Run
+// returns.
+func (s *Station) Events() <-chan Event {
+	return s.events
+}
+
+// Run watches for drives until ctx is cancelled or the target count is
+// reached, processing each one that qualifies, then waits for the drives in
+// progress (which cancelling ctx cancels too) before returning. Drives
+// already plugged in when Run starts are left alone.
+func (s *Station) Run(ctx context.Context) error {
+	defer close(s.events)
+
+	watchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	s.stop = stop
+
+	enum := usb.NewEnumerator()
+	arrivals := make(chan usb.Event)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- enum.Watch(watchCtx, arrivals)
+	}()
+
+	var wg sync.WaitGroup
+	for ev := range arrivals {
+		d := ev.Device
+		// A card taken out of a reader is handled like a drive unplugged,
+		// and a card put in like a drive plugged in
+		if ev.Type == usb.EventRemoval || ev.Type == usb.EventMediaRemoval {
+			s.emit(newEvent(EventRemoved, d))
+			continue
+		}
+		if reason := s.reject(enum, d); reason != "" {
+			skipped := newEvent(EventSkipped, d)
+			skipped.Reason = reason
+			s.emit(skipped)
+			continue
+		}
+
+		s.setActive(d, true)
+		s.emit(newEvent(EventInserted, d))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.setActive(d, false)
+			s.process(ctx, d)
+		}()
+	}
+	wg.Wait()
+	return <-watchErr
+}
+
+// reject returns why a drive doesn't qualify for the station, or "".
+func (s *Station) reject(enum *usb.Enumerator, d usb.Device) string {
+	if !d.HasMedia() {
+		return "no media"
+	}
+	if len(s.ports) > 0 && !s.ports[usb.ParsePortNumber(d.LocationInfo)] {
+		return "not on a station port"
+	}
+	if s.opts.MinSize > 0 && d.Size < s.opts.MinSize {
+		return fmt.Sprintf("smaller than %s", flash.FormatBytes(s.opts.MinSize))
+	}
+	if s.opts.MaxSize > 0 && d.Size > s.opts.MaxSize {
+		return fmt.Sprintf("larger than %s", flash.FormatBytes(s.opts.MaxSize))
+	}
+	if isSystem, _ := enum.IsSystemDisk(d.DiskNumber); isSystem {
+		return "system disk"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[d.PNPDeviceID] {
+		return "already in progress"
+	}
+	// Drives in progress may still fail, so only those that could be needed
+	// are taken on
+	if s.opts.TargetCount > 0 && s.succeeded+len(s.active) >= s.opts.TargetCount {
+		return "target count reached"
+	}
+	return ""
+}
+
+// process flashes, labels and ejects one drive, reporting the outcome.
+func (s *Station) process(ctx context.Context, d usb.Device) {
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-ctx.Done():
+		done := newEvent(EventComplete, d)
+		done.Error = "cancelled"
+		s.emit(done)
+		return
+	}
+
+	start := time.Now()
+	err := s.duplicate(ctx, d)
+
+	done := newEvent(EventComplete, d)
+	done.Duration = time.Since(start).Round(time.Second).String()
+	done.Success = err == nil
+	if err != nil {
+		done.Error = err.Error()
+	} else if s.opts.Eject {
+		// A drive that won't eject is still a good copy
+		done.Ejected = disk.EjectDisk(d.DiskNumber) == nil
+	}
+	s.emit(done)
+
+	if err == nil {
+		s.mu.Lock()
+		s.succeeded++
+		delete(s.active, d.PNPDeviceID) // Counted as succeeded from now on
+		reached := s.opts.TargetCount > 0 && s.succeeded >= s.opts.TargetCount
+		s.mu.Unlock()
+		if reached {
+			s.stop()
+		}
+	}
+}
+
+// duplicate writes the image to a drive, setting its label if asked.
+func (s *Station) duplicate(ctx context.Context, d usb.Device) error {
+	diskLock, err := lock.NewDiskLock(d.DiskNumber)
+	if err != nil {
+		return err
+	}
+	if err := diskLock.TryLock(ctx, lockTimeout); err != nil {
+		return errors.New("disk busy")
+	}
+	defer diskLock.Unlock()
+
+	opts := s.opts.Flash
+	opts.DiskNumber = d.DiskNumber
+	opts.DriveLetter = d.DriveLetter
+	opts.Label = s.opts.Label
+
+	flasher := flash.NewFlasher()
+	drained := make(chan struct{})
+	go func() {
+		for p := range flasher.Progress() {
+			if p.Status != flash.StatusInProgress {
+				continue
+			}
+			progress := newEvent(EventProgress, d)
+			progress.Stage = p.Stage
+			progress.Percentage = p.Percentage
+			progress.Speed = p.Speed
+			s.emit(progress)
+		}
+		close(drained)
+	}()
+	_, _, err = flasher.Flash(ctx, opts)
+	<-drained
+	return err
+}
+
+func (s *Station) emit(ev Event) {
+	s.events <- ev
+}
+
+func (s *Station) setActive(d usb.Device, active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if active {
+		s.active[d.PNPDeviceID] = true
+	} else {
+		delete(s.active, d.PNPDeviceID)
+	}
+}
+
+// newEvent returns an event of the given type describing a drive.
+func newEvent(eventType string, d usb.Device) Event {
+	return Event{
+		Type:         eventType,
+		Time:         time.Now(),
+		DiskNumber:   d.DiskNumber,
+		Port:         usb.ParsePortNumber(d.LocationInfo),
+		SerialNumber: d.SerialNumber,
+		FriendlyName: d.FriendlyName,
+		Size:         d.Size,
+	}
+}
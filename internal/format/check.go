@@ -0,0 +1,81 @@
+package format
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"golang.org/x/sys/windows"
+)
+
+// checkChunk is how much the bad-cluster check reads at a time. A chunk
+// that can't be read is read again a cluster at a time to count the bad
+// clusters in it.
+const checkChunk = 4 << 20
+
+// checkSurface reads a partition back through the raw disk and returns how
+// many of its clusters can't be read. progress gets the percentage read.
+func checkSurface(ctx context.Context, diskNumber int, offset, size, clusterSize int64, progress func(percent int)) (int64, error) {
+	handle, err := disk.OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(handle)
+
+	buf := flash.GetBuffer(checkChunk)
+	defer flash.PutBuffer(checkChunk, buf)
+
+	var bad int64
+	lastPercent := -1
+	for done := int64(0); done < size; {
+		if err := ctx.Err(); err != nil {
+			return bad, err
+		}
+		n := min(checkChunk, size-done)
+		if readAt(handle, buf[:n], offset+done) != nil {
+			for c := int64(0); c < n; c += clusterSize {
+				if readAt(handle, buf[c:min(c+clusterSize, n)], offset+done+c) != nil {
+					bad++
+				}
+			}
+		}
+		done += n
+
+		if percent := int(done * 100 / size); percent != lastPercent {
+			lastPercent = percent
+			progress(percent)
+		}
+	}
+	return bad, nil
+}
+
+// readAt reads len(buf) bytes of the disk at offset, which must both be
+// sector multiples.
+func readAt(handle windows.Handle, buf []byte, offset int64) error {
+	if _, err := windows.Seek(handle, offset, 0); err != nil {
+		return fmt.Errorf("seek failed: %w", err)
+	}
+	var read uint32
+	if err := windows.ReadFile(handle, buf, &read, nil); err != nil {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	if int(read) != len(buf) {
+		return fmt.Errorf("short read: %d of %d bytes", read, len(buf))
+	}
+	return nil
+}
+
+// checkClusterSize returns the cluster size bad clusters are counted in:
+// the formatted volume's, or for ext (which Windows doesn't mount) its 4KB
+// block size.
+func checkClusterSize(volumePath string) int64 {
+	if volumePath == "" {
+		return 4096
+	}
+	size, err := disk.GetVolumeClusterSize(volumePath)
+	if err != nil || size <= 0 {
+		return 4096
+	}
+	return size
+}
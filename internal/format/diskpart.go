@@ -0,0 +1,78 @@
+package format
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// PrepareDiskpartScript confines a diskpart script to one disk: it starts
+// the script with "select disk N" and rejects any line that selects another
+// disk, or a volume or virtual disk, which could be on any disk. Both the
+// "select disk N" and "select disk=N" forms are checked. Returns the script
+// diskpart runs.
+func PrepareDiskpartScript(script string, diskNumber int) (string, error) {
+	lines := []string{fmt.Sprintf("select disk %d", diskNumber)}
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		// diskpart takes "disk=N" as well as "disk N"
+		fields := strings.Fields(strings.ReplaceAll(strings.ToLower(line), "=", " "))
+		if len(fields) >= 1 && strings.HasPrefix("select", fields[0]) && len(fields[0]) >= 3 {
+			if len(fields) < 2 {
+				return "", fmt.Errorf("line %d: %q: select needs an object", n, line)
+			}
+			switch {
+			case strings.HasPrefix("disk", fields[1]):
+				if len(fields) != 3 {
+					return "", fmt.Errorf("line %d: %q: select disk needs a disk number", n, line)
+				}
+				// "select disk system" and "select disk next" pick disks by role
+				if fields[2] == "system" || fields[2] == "next" {
+					return "", fmt.Errorf("line %d: %q selects another disk than disk %d", n, line, diskNumber)
+				}
+				if selected, err := strconv.Atoi(fields[2]); err != nil || selected != diskNumber {
+					return "", fmt.Errorf("line %d: %q selects another disk than disk %d", n, line, diskNumber)
+				}
+			case strings.HasPrefix("volume", fields[1]), strings.HasPrefix("vdisk", fields[1]):
+				return "", fmt.Errorf("line %d: %q: select volume and vdisk could reach other disks; select partitions instead", n, line)
+			case strings.HasPrefix("partition", fields[1]):
+			default:
+				return "", fmt.Errorf("line %d: %q: unknown select object", n, line)
+			}
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\r\n") + "\r\n", nil
+}
+
+// RunDiskpart runs a diskpart script (see PrepareDiskpartScript) and
+// returns diskpart's output. diskpart stops at the first failing command
+// and exits with an error.
+func RunDiskpart(ctx context.Context, script string) (string, error) {
+	f, err := os.CreateTemp("", "wusbkit-diskpart-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("create script file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(script); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write script file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("write script file: %w", err)
+	}
+
+	out, err := exec.CommandContext(ctx, "diskpart.exe", "/s", f.Name()).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("diskpart: %w", err)
+	}
+	return string(out), nil
+}
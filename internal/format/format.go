@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
 	"golang.org/x/sys/windows"
 )
 
@@ -18,16 +19,42 @@ type Options struct {
 	FileSystem string // fat32, ntfs, exfat
 	Label      string
 	Quick      bool
+
+	// Partitions, if set, lays out several partitions in place of a single
+	// one of FileSystem and Label (see ParseLayout)
+	Partitions []Partition
+
+	// Profile, if set, picks the file system, cluster size and partition
+	// offset from the disk's capacity in place of FileSystem (see
+	// ProfileSDCard)
+	Profile string
+
+	// DriveLetter, if set, is the drive letter given to the formatted volume
+	// instead of whichever one Windows picks
+	DriveLetter string
+
+	// MountPoint, if set, is an empty folder the formatted volume is mounted
+	// on, instead of a drive letter
+	MountPoint string
+
+	// Zap zeroes the first and last 4MB of the disk before partitioning,
+	// clearing RAID, LVM and stale GPT signatures left by a previous use
+	// (see flash.Clean)
+	Zap bool
+
+	// Check, for a full format, reads every partition back after formatting
+	// it and counts the clusters that can't be read
+	Check bool
 }
 
 // ValidateFileSystem checks if the filesystem is supported
 func ValidateFileSystem(fs string) error {
 	fs = strings.ToLower(fs)
 	switch fs {
-	case "fat32", "ntfs", "exfat":
+	case "fat32", "ntfs", "exfat", "refs", "udf", "ext2", "ext4":
 		return nil
 	default:
-		return fmt.Errorf("unsupported filesystem: %s (supported: fat32, ntfs, exfat)", fs)
+		return fmt.Errorf("unsupported filesystem: %s (supported: fat32, ntfs, exfat, refs, udf, ext2, ext4)", fs)
 	}
 }
 
@@ -39,6 +66,13 @@ type Progress struct {
 	Percentage int    `json:"percentage"`
 	Status     string `json:"status"` // in_progress, complete, error
 	Error      string `json:"error,omitempty"`
+	MountPoint string `json:"mountPoint,omitempty"`
+
+	// BadClusters is set on complete events when the format was checked
+	// (Options.Check), 0 meaning every cluster read back
+	BadClusters *int64 `json:"badClusters,omitempty"`
+
+	Volumes []Volume `json:"volumes,omitempty"` // For complete events of a multi-partition layout
 }
 
 // Stage constants for format progress
@@ -46,6 +80,7 @@ const (
 	StageCleaning          = "Cleaning disk"
 	StageCreatingPartition = "Creating partition"
 	StageFormatting        = "Formatting"
+	StageChecking          = "Checking for bad clusters"
 	StageAssigningLetter   = "Assigning drive letter"
 	StageComplete          = "Complete"
 )
@@ -80,11 +115,15 @@ func (f *Formatter) Progress() <-chan Progress {
 func (f *Formatter) Format(ctx context.Context, opts Options) error {
 	defer close(f.progressChan)
 
-	label := opts.Label
-	if label == "" {
-		label = "USB"
+	// Clearing old signatures needs the volumes locked, so it goes before
+	// the disk is opened
+	if opts.Zap {
+		f.sendProgress(opts, StageCleaning, 2)
+		if _, err := flash.Clean(opts.DiskNumber, ""); err != nil {
+			f.sendError(opts, "Failed to zap disk: "+err.Error())
+			return fmt.Errorf("zap disk %d: %w", opts.DiskNumber, err)
+		}
 	}
-	fs := strings.ToLower(opts.FileSystem)
 
 	// Step 1: Open physical disk
 	f.sendProgress(opts, StageCleaning, 5)
@@ -103,6 +142,15 @@ func (f *Formatter) Format(ctx context.Context, opts Options) error {
 		return fmt.Errorf("get geometry disk %d: %w", opts.DiskNumber, err)
 	}
 
+	// Work out where the partitions go before touching the disk
+	plan, err := planFormat(opts, geom)
+	if err != nil {
+		f.sendError(opts, err.Error())
+		return fmt.Errorf("disk %d: %w", opts.DiskNumber, err)
+	}
+	parts, mbrParts := plan.parts, plan.mbrParts
+	clusterSize, dataAlignment := plan.clusterSize, plan.dataAlignment
+
 	// Step 3: Create MBR partition table (clears existing partitions)
 	f.sendProgress(opts, StageCleaning, 15)
 
@@ -117,40 +165,10 @@ func (f *Formatter) Format(ctx context.Context, opts Options) error {
 		_ = err
 	}
 
-	// Step 4: Create single partition spanning entire disk
+	// Step 4: Create the partitions
 	f.sendProgress(opts, StageCreatingPartition, 25)
 
-	// Partition starts at sector offset (typically 1MB alignment = 2048 sectors for 512-byte sectors)
-	alignmentOffset := int64(1048576) // 1 MB
-	if alignmentOffset > geom.DiskSize/2 {
-		alignmentOffset = int64(geom.BytesPerSector) // Tiny disk: start at sector 1
-	}
-
-	partitionSize := geom.DiskSize - alignmentOffset
-
-	// Determine partition type
-	partType := byte(0x0C) // FAT32 LBA (default)
-	switch fs {
-	case "ntfs":
-		partType = 0x07 // NTFS/HPFS/exFAT
-	case "exfat":
-		partType = 0x07 // Same type ID as NTFS
-	case "fat32":
-		if geom.DiskSize > 4*1024*1024*1024 { // > 4GB
-			partType = 0x0C // FAT32 LBA
-		} else {
-			partType = 0x0B // FAT32 CHS
-		}
-	}
-
-	partition := disk.MBRPartition{
-		PartitionType: partType,
-		BootIndicator: true,
-		StartOffset:   alignmentOffset,
-		Size:          partitionSize,
-	}
-
-	if err := disk.SetDriveLayoutMBR(handle, []disk.MBRPartition{partition}); err != nil {
+	if err := disk.SetDriveLayoutMBR(handle, mbrParts); err != nil {
 		f.sendError(opts, "Failed to create partition: "+err.Error())
 		return fmt.Errorf("set drive layout disk %d: %w", opts.DiskNumber, err)
 	}
@@ -173,53 +191,268 @@ func (f *Formatter) Format(ctx context.Context, opts Options) error {
 		windows.CloseHandle(tmpHandle)
 	}
 
-	volumePath, err := disk.WaitForVolumeReady(windows.InvalidHandle, opts.DiskNumber, 15*time.Second)
-	if err != nil {
-		f.sendError(opts, "Volume not detected after partitioning: "+err.Error())
-		return fmt.Errorf("wait for volume disk %d: %w", opts.DiskNumber, err)
+	// Steps 6 and 7 for each partition: format it (and check it) and assign
+	// a drive letter, sharing 50-90% of the progress between them
+	var volumes []Volume
+	var badClusters *int64
+	if opts.Check {
+		badClusters = new(int64)
 	}
+	for i, p := range parts {
+		if err := ctx.Err(); err != nil {
+			f.sendError(opts, err.Error())
+			return err
+		}
+		stage := StageFormatting
+		if len(parts) > 1 {
+			stage = fmt.Sprintf("%s partition %d/%d", StageFormatting, i+1, len(parts))
+		}
+		// This partition's share of the 50-90% range, half of it for the
+		// check if there is one
+		base, share := 50+40*i/len(parts), 40/len(parts)
+		formatShare := share
+		if opts.Check {
+			formatShare = share / 2
+		}
+		f.sendProgress(opts, stage, base)
+
+		part := mbrParts[i]
+		ext := p.FileSystem == "ext2" || p.FileSystem == "ext4"
+
+		// Windows doesn't mount Linux partitions, so ext has no volume to wait for
+		var volumePath string
+		if !ext {
+			volumePath, err = waitForPartitionVolume(opts.DiskNumber, part.StartOffset, 15*time.Second)
+			if err != nil {
+				f.sendError(opts, "Volume not detected after partitioning: "+err.Error())
+				return fmt.Errorf("wait for volume disk %d: %w", opts.DiskNumber, err)
+			}
+		}
+
+		switch p.FileSystem {
+		case "fat32":
+			// Use custom FAT32 formatter for speed and to bypass 32GB limit
+			err = f.formatFAT32Native(opts.DiskNumber, volumePath, p.Label, geom, part.StartOffset, part.Size, clusterSize, dataAlignment)
+		case "ext2", "ext4":
+			err = f.formatExtNative(opts.DiskNumber, p.Label, part.StartOffset, part.Size, p.FileSystem == "ext4")
+		case "ntfs", "exfat", "refs", "udf", "fat":
+			// Use fmifs.dll/VDS for NTFS, exFAT, ReFS, UDF and FAT12/16
+			err = disk.FormatVolume(disk.FormatVolumeOptions{
+				VolumePath:  volumePath,
+				FileSystem:  strings.ToUpper(p.FileSystem),
+				Label:       p.Label,
+				QuickFormat: opts.Quick || p.FileSystem == "exfat", // exFAT always quick
+				ClusterSize: clusterSize,                           // 0 = default
+				Progress: func(percent int) {
+					f.sendProgress(opts, stage, base+formatShare*min(percent, 100)/100)
+				},
+			})
+		}
 
-	// Step 6: Format the volume
-	f.sendProgress(opts, StageFormatting, 50)
+		if err != nil {
+			f.sendError(opts, "Format failed: "+err.Error())
+			if len(parts) > 1 {
+				return fmt.Errorf("format disk %d partition %d as %s: %w", opts.DiskNumber, i+1, p.FileSystem, err)
+			}
+			return fmt.Errorf("format disk %d as %s: %w", opts.DiskNumber, p.FileSystem, err)
+		}
 
-	switch fs {
-	case "fat32":
-		// Use custom FAT32 formatter for speed and to bypass 32GB limit
-		err = f.formatFAT32Native(opts.DiskNumber, volumePath, label, geom, alignmentOffset, partitionSize)
-	case "ntfs", "exfat":
-		// Use fmifs.dll/VDS for NTFS and exFAT
-		err = disk.FormatVolume(disk.FormatVolumeOptions{
-			VolumePath:  volumePath,
-			FileSystem:  strings.ToUpper(fs),
-			Label:       label,
-			QuickFormat: opts.Quick || fs == "exfat", // exFAT always quick
-			ClusterSize: 0,                           // Default
+		var partBad *int64
+		if opts.Check {
+			checkStage := StageChecking
+			if len(parts) > 1 {
+				checkStage = fmt.Sprintf("%s partition %d/%d", StageChecking, i+1, len(parts))
+			}
+			checkBase, checkShare := base+formatShare, share-formatShare
+			bad, err := checkSurface(ctx, opts.DiskNumber, part.StartOffset, part.Size, checkClusterSize(volumePath), func(percent int) {
+				f.sendProgress(opts, checkStage, checkBase+checkShare*percent/100)
+			})
+			if err != nil {
+				f.sendError(opts, "Bad cluster check failed: "+err.Error())
+				return fmt.Errorf("check disk %d partition %d: %w", opts.DiskNumber, i+1, err)
+			}
+			partBad = &bad
+			*badClusters += bad
+		}
+
+		// Assign a drive letter if one isn't already assigned
+		if len(parts) == 1 {
+			f.sendProgress(opts, StageAssigningLetter, 90)
+		}
+
+		var driveLetter string
+		if !ext {
+			driveLetter, _ = disk.GetVolumeDriveLetter(volumePath)
+		}
+		if opts.DriveLetter != "" || opts.MountPoint != "" {
+			// Scripts rely on the path asked for, so failing to set it fails the format
+			if driveLetter, err = assignAccessPath(opts, volumePath, driveLetter); err != nil {
+				f.sendError(opts, err.Error())
+				return fmt.Errorf("disk %d: %w", opts.DiskNumber, err)
+			}
+		} else if driveLetter == "" && !ext {
+			driveLetter, err = disk.AssignDriveLetter(volumePath)
+			if err != nil {
+				// Non-fatal — format succeeded even without a letter
+				driveLetter = ""
+			}
+		}
+		volumes = append(volumes, Volume{
+			Partition:   i + 1,
+			DriveLetter: driveLetter,
+			FileSystem:  p.FileSystem,
+			Label:       p.Label,
+			Size:        part.Size,
+			BadClusters: partBad,
 		})
 	}
 
+	driveLetter := volumes[0].DriveLetter
+	if len(volumes) == 1 && opts.Profile == "" {
+		volumes = nil // Reported as the event's drive alone
+	}
+	f.sendComplete(opts, driveLetter, volumes, badClusters)
+	return nil
+}
+
+// assignAccessPath gives a formatted volume the drive letter or mount
+// folder of opts. Mounting on a folder removes the volume's drive letter, so
+// it is reached only through the folder. Returns the volume's drive letter.
+func assignAccessPath(opts Options, volumePath, driveLetter string) (string, error) {
+	if opts.DriveLetter != "" {
+		letter, err := disk.SetDriveLetter(volumePath, opts.DriveLetter)
+		if err != nil {
+			return "", fmt.Errorf("assign drive letter %s: %w", opts.DriveLetter, err)
+		}
+		return letter, nil
+	}
+	if _, err := disk.MountFolder(volumePath, opts.MountPoint); err != nil {
+		return "", fmt.Errorf("mount on %s: %w", opts.MountPoint, err)
+	}
+	if driveLetter != "" {
+		if err := disk.RemoveDriveLetter(driveLetter); err != nil {
+			return driveLetter, nil // Still reachable through the folder
+		}
+	}
+	return "", nil
+}
+
+// formatPlan is how a format lays out and formats a disk.
+type formatPlan struct {
+	parts         []Partition
+	mbrParts      []disk.MBRPartition
+	clusterSize   uint32 // 0 = the file system's default
+	dataAlignment int64  // FAT32 data area alignment, 0 = none
+}
+
+// planFormat works out the partitions of opts on a disk of the given
+// geometry, and the file system of the SD card profile.
+func planFormat(opts Options, geom *disk.DiskGeometry) (*formatPlan, error) {
+	plan := &formatPlan{parts: opts.Partitions}
+	if len(plan.parts) == 0 {
+		label := opts.Label
+		if label == "" {
+			label = "USB"
+		}
+		plan.parts = []Partition{{FileSystem: strings.ToLower(opts.FileSystem), Label: label}}
+	}
+
+	// The SD card profile decides the file system from the card's capacity
+	var start int64
+	if strings.EqualFold(opts.Profile, ProfileSDCard) && len(opts.Partitions) == 0 {
+		sd := sdCardLayout(geom.DiskSize)
+		plan.parts[0].FileSystem = sd.FileSystem
+		plan.clusterSize = sd.ClusterSize
+		start, plan.dataAlignment = sd.BoundaryUnit, sd.BoundaryUnit
+	}
+
+	mbrParts, err := planPartitions(plan.parts, geom, start)
 	if err != nil {
-		f.sendError(opts, "Format failed: "+err.Error())
-		return fmt.Errorf("format disk %d as %s: %w", opts.DiskNumber, fs, err)
+		return nil, err
 	}
+	plan.mbrParts = mbrParts
+	return plan, nil
+}
 
-	// Step 7: Assign a drive letter if one isn't already assigned
-	f.sendProgress(opts, StageAssigningLetter, 90)
+// planPartitions places a layout's partitions on the disk, 1 MB aligned,
+// with the first marked active. A partition of size 0 takes the rest. The
+// first partition starts at start, or 1 MB if start is 0.
+func planPartitions(parts []Partition, geom *disk.DiskGeometry, start int64) ([]disk.MBRPartition, error) {
+	// Partition starts at sector offset (typically 1MB alignment = 2048 sectors for 512-byte sectors)
+	alignmentOffset := int64(partitionAlignment)
+	if start > 0 {
+		alignmentOffset = start
+	} else if len(parts) == 1 && alignmentOffset > geom.DiskSize/2 {
+		alignmentOffset = int64(geom.BytesPerSector) // Tiny disk: start at sector 1
+	}
 
-	driveLetter, _ := disk.GetVolumeDriveLetter(volumePath)
-	if driveLetter == "" {
-		driveLetter, err = disk.AssignDriveLetter(volumePath)
-		if err != nil {
-			// Non-fatal — format succeeded even without a letter
-			driveLetter = ""
+	if need := LayoutSize(parts) - partitionAlignment + alignmentOffset; need > geom.DiskSize {
+		return nil, fmt.Errorf("the layout needs %d bytes but the disk has %d", need, geom.DiskSize)
+	}
+
+	var mbrParts []disk.MBRPartition
+	offset := alignmentOffset
+	for i, p := range parts {
+		size := p.Size
+		if size == 0 {
+			size = geom.DiskSize - offset
+		} else {
+			size = size / partitionAlignment * partitionAlignment
+		}
+		if size <= 0 || offset+size > geom.DiskSize {
+			return nil, fmt.Errorf("partition %d doesn't fit on the disk", i+1)
 		}
+		mbrParts = append(mbrParts, disk.MBRPartition{
+			PartitionType: partitionType(p.FileSystem, size),
+			BootIndicator: i == 0,
+			StartOffset:   offset,
+			Size:          size,
+		})
+		offset += size
 	}
+	return mbrParts, nil
+}
 
-	f.sendComplete(opts, driveLetter)
-	return nil
+// partitionType returns the MBR partition type for a file system.
+func partitionType(fs string, size int64) byte {
+	switch fs {
+	case "ntfs", "exfat", "refs", "udf":
+		return 0x07 // NTFS/HPFS/exFAT share a type ID, Windows uses it for ReFS and UDF too
+	case "ext2", "ext4":
+		return 0x83 // Linux
+	case "fat":
+		if size <= 64*1024*1024 { // SD cards use FAT12 up to 64MB
+			return 0x01 // FAT12
+		}
+		return 0x06 // FAT16
+	case "fat32":
+		if size > 4*1024*1024*1024 { // > 4GB
+			return 0x0C // FAT32 LBA
+		}
+		return 0x0B // FAT32 CHS
+	}
+	return 0x0C // FAT32 LBA (default)
+}
+
+// waitForPartitionVolume waits for Windows to mount the volume of the
+// partition at offset.
+func waitForPartitionVolume(diskNumber int, offset int64, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		volumePath, err := disk.FindVolumeByPartition(diskNumber, offset)
+		if err == nil {
+			return volumePath, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out waiting for volume on PhysicalDrive%d after %v", diskNumber, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
 }
 
 // formatFAT32Native formats a partition as FAT32 using direct sector writes.
-func (f *Formatter) formatFAT32Native(diskNumber int, volumePath, label string, geom *disk.DiskGeometry, partOffset, partSize int64) error {
+// A cluster size or data alignment of 0 leaves the choice to FormatFAT32.
+func (f *Formatter) formatFAT32Native(diskNumber int, volumePath, label string, geom *disk.DiskGeometry, partOffset, partSize int64, clusterSize uint32, dataAlignment int64) error {
 	// Open the physical disk for writing
 	handle, err := disk.OpenPhysicalDisk(diskNumber)
 	if err != nil {
@@ -227,15 +460,6 @@ func (f *Formatter) formatFAT32Native(diskNumber int, volumePath, label string,
 	}
 	defer windows.CloseHandle(handle)
 
-	// Lock and dismount the volume first
-	if err := disk.LockVolume(handle); err != nil {
-		// Try to continue — might not have a mounted volume yet
-		_ = err
-	}
-	if err := disk.DismountVolume(handle); err != nil {
-		_ = err
-	}
-
 	hiddenSectors := uint32(partOffset / int64(geom.BytesPerSector))
 
 	return disk.FormatFAT32(disk.FormatFAT32Options{
@@ -247,6 +471,27 @@ func (f *Formatter) formatFAT32Native(diskNumber int, volumePath, label string,
 		SectorsPerTrack:   geom.SectorsPerTrack,
 		TracksPerCylinder: geom.TracksPerCylinder,
 		HiddenSectors:     hiddenSectors,
+		ClusterSize:       clusterSize,
+		DataAlignment:     dataAlignment,
+		VolumePath:        volumePath, // Locked and dismounted while writing
+	})
+}
+
+// formatExtNative formats a partition as ext2 or ext4 using direct sector
+// writes. Windows has no volume for the partition, so nothing is dismounted.
+func (f *Formatter) formatExtNative(diskNumber int, label string, partOffset, partSize int64, ext4 bool) error {
+	handle, err := disk.OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return fmt.Errorf("open disk for ext format: %w", err)
+	}
+	defer windows.CloseHandle(handle)
+
+	return disk.FormatExt(disk.FormatExtOptions{
+		DiskHandle:      handle,
+		PartitionOffset: partOffset,
+		PartitionSize:   partSize,
+		VolumeLabel:     label,
+		Ext4:            ext4,
 	})
 }
 
@@ -275,14 +520,17 @@ func (f *Formatter) sendError(opts Options, errMsg string) {
 	}
 }
 
-func (f *Formatter) sendComplete(opts Options, driveLetter string) {
+func (f *Formatter) sendComplete(opts Options, driveLetter string, volumes []Volume, badClusters *int64) {
 	select {
 	case f.progressChan <- Progress{
-		Drive:      driveLetter,
-		DiskNumber: opts.DiskNumber,
-		Stage:      StageComplete,
-		Percentage: 100,
-		Status:     "complete",
+		Drive:       driveLetter,
+		DiskNumber:  opts.DiskNumber,
+		Stage:       StageComplete,
+		Percentage:  100,
+		Status:      "complete",
+		MountPoint:  opts.MountPoint,
+		BadClusters: badClusters,
+		Volumes:     volumes,
 	}:
 	default:
 	}
@@ -0,0 +1,173 @@
+package format
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/label"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxPartitions is how many partitions a layout can have: an MBR's
+	// primary partitions.
+	maxPartitions = 4
+
+	// partitionAlignment is where the first partition starts and what the
+	// others' sizes are rounded down to.
+	partitionAlignment = 1 << 20 // 1 MB
+)
+
+// Partition is one partition of a multi-partition layout.
+type Partition struct {
+	Size       int64  // Bytes, 0 = the rest of the disk
+	FileSystem string // fat32, ntfs, exfat, refs, udf, ext2, ext4
+	Label      string
+}
+
+// Volume is a partition formatted by a multi-partition layout, reported in
+// the completion event.
+type Volume struct {
+	Partition   int    `json:"partition"`
+	DriveLetter string `json:"driveLetter,omitempty"`
+	FileSystem  string `json:"fileSystem"`
+	Label       string `json:"label,omitempty"`
+	Size        int64  `json:"size"`
+	BadClusters *int64 `json:"badClusters,omitempty"` // With Options.Check
+}
+
+// layoutFile is a layout saved as YAML (or JSON).
+type layoutFile struct {
+	Partitions []struct {
+		Size  string `yaml:"size"` // e.g. 16G, or * for the rest of the disk
+		FS    string `yaml:"fs"`
+		Label string `yaml:"label"`
+	} `yaml:"partitions"`
+}
+
+// ParseLayout parses a layout spec such as "1:16G:fat32:BOOT,2:*:ntfs:DATA":
+// one number:size:fs[:label] per partition, numbered from 1 in disk order.
+// A size of * takes the rest of the disk and is only allowed last.
+func ParseLayout(spec string) ([]Partition, error) {
+	var parts []Partition
+	for i, item := range strings.Split(spec, ",") {
+		fields := strings.Split(strings.TrimSpace(item), ":")
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("layout %q: want number:size:fs[:label], got %q", spec, item)
+		}
+		if n, err := strconv.Atoi(fields[0]); err != nil || n != i+1 {
+			return nil, fmt.Errorf("layout %q: partition %q should be numbered %d", spec, item, i+1)
+		}
+		p := Partition{FileSystem: fields[2]}
+		if len(fields) == 4 {
+			p.Label = fields[3]
+		}
+		size, err := parseLayoutSize(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("layout %q: %w", spec, err)
+		}
+		p.Size = size
+		parts = append(parts, p)
+	}
+	if err := validateLayout(parts); err != nil {
+		return nil, fmt.Errorf("layout %q: %w", spec, err)
+	}
+	return parts, nil
+}
+
+// ReadLayoutFile loads a layout from a YAML or JSON file:
+//
+//	partitions:
+//	  - {size: 16G, fs: fat32, label: BOOT}
+//	  - {size: "*", fs: ntfs, label: DATA}
+func ReadLayoutFile(path string) ([]Partition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f layoutFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: not a valid layout: %w", path, err)
+	}
+	var parts []Partition
+	for i, p := range f.Partitions {
+		size, err := parseLayoutSize(p.Size)
+		if err != nil {
+			return nil, fmt.Errorf("%s: partition %d: %w", path, i+1, err)
+		}
+		parts = append(parts, Partition{Size: size, FileSystem: p.FS, Label: p.Label})
+	}
+	if err := validateLayout(parts); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return parts, nil
+}
+
+// LayoutSize returns the space a layout's fixed-size partitions need.
+func LayoutSize(parts []Partition) int64 {
+	total := int64(partitionAlignment)
+	for _, p := range parts {
+		total += p.Size
+	}
+	return total
+}
+
+// parseLayoutSize converts a size like 512M, 16G or 16GB to bytes; * is 0,
+// the rest of the disk.
+func parseLayoutSize(text string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(text)), "B")
+	if s == "*" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid partition size %q", text)
+	}
+	size := n * multiplier
+	if size < partitionAlignment {
+		return 0, fmt.Errorf("partition size %q is smaller than 1M", text)
+	}
+	return size, nil
+}
+
+// validateLayout checks a layout's partition count, file systems and labels.
+func validateLayout(parts []Partition) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("the layout has no partitions")
+	}
+	if len(parts) > maxPartitions {
+		return fmt.Errorf("the layout has %d partitions, MBR allows at most %d", len(parts), maxPartitions)
+	}
+	for i := range parts {
+		p := &parts[i]
+		p.FileSystem = strings.ToLower(p.FileSystem)
+		if err := ValidateFileSystem(p.FileSystem); err != nil {
+			return fmt.Errorf("partition %d: %w", i+1, err)
+		}
+		if max := label.MaxLength(p.FileSystem); len([]rune(p.Label)) > max {
+			return fmt.Errorf("partition %d: label %q is longer than %s allows (%d characters)", i+1, p.Label, p.FileSystem, max)
+		}
+		if p.Size == 0 && i != len(parts)-1 {
+			return fmt.Errorf("partition %d: only the last partition can take the rest of the disk (*)", i+1)
+		}
+	}
+	return nil
+}
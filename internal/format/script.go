@@ -0,0 +1,70 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// DiskpartScript returns the diskpart equivalent of what Format does to a
+// disk of diskSize bytes: the same partitions at the same offsets, file
+// systems, labels and drive letter. Format doesn't run diskpart, so the
+// script is for review; steps diskpart can't do the same way (FAT32 over
+// 32GB, ext) are flagged with rem lines. Sizes assume 512-byte sectors.
+func DiskpartScript(opts Options, diskSize int64) (string, error) {
+	geom := &disk.DiskGeometry{DiskSize: diskSize, BytesPerSector: 512}
+	plan, err := planFormat(opts, geom)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		fmt.Sprintf("rem wusbkit format of disk %d, written natively rather than by diskpart", opts.DiskNumber),
+		fmt.Sprintf("select disk %d", opts.DiskNumber),
+	}
+	if opts.Zap {
+		lines = append(lines, "rem --zap: wusbkit zeroes the first and last 4MB; clean zeroes the first and last 1MB")
+	}
+	lines = append(lines, "clean", "convert mbr")
+	for i, p := range plan.parts {
+		mbr := plan.mbrParts[i]
+		create := fmt.Sprintf("create partition primary offset=%d", mbr.StartOffset/1024)
+		if p.Size != 0 || i < len(plan.parts)-1 {
+			create += fmt.Sprintf(" size=%d", mbr.Size/(1<<20))
+		}
+		lines = append(lines, fmt.Sprintf("%s id=%02x", create, mbr.PartitionType))
+		if mbr.BootIndicator {
+			lines = append(lines, "active")
+		}
+
+		switch p.FileSystem {
+		case "ext2", "ext4":
+			lines = append(lines, fmt.Sprintf("rem %s is written by wusbkit's own formatter; diskpart can't format it", p.FileSystem))
+			continue
+		case "fat32":
+			if mbr.Size > 32<<30 {
+				lines = append(lines, "rem FAT32 over 32GB is written by wusbkit's own formatter; diskpart refuses it")
+			}
+		}
+
+		format := fmt.Sprintf("format fs=%s label=%q", p.FileSystem, p.Label)
+		if opts.Quick || p.FileSystem == "exfat" {
+			format += " quick"
+		}
+		if plan.clusterSize != 0 {
+			format += fmt.Sprintf(" unit=%d", plan.clusterSize)
+		}
+		lines = append(lines, format)
+
+		switch {
+		case opts.DriveLetter != "":
+			lines = append(lines, "assign letter="+strings.ToUpper(strings.TrimRight(opts.DriveLetter, `:\`)))
+		case opts.MountPoint != "":
+			lines = append(lines, fmt.Sprintf("assign mount=%q", opts.MountPoint))
+		default:
+			lines = append(lines, "assign")
+		}
+	}
+	return strings.Join(lines, "\r\n") + "\r\n", nil
+}
@@ -0,0 +1,59 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProfileSDCard formats the way the SD Association's SD Formatter does, for
+// cameras and embedded boards that expect the SD card layout.
+const ProfileSDCard = "sdcard"
+
+// ValidateProfile checks if the format profile is supported
+func ValidateProfile(profile string) error {
+	switch strings.ToLower(profile) {
+	case "", ProfileSDCard:
+		return nil
+	default:
+		return fmt.Errorf("unsupported profile: %s (supported: %s)", profile, ProfileSDCard)
+	}
+}
+
+// sdLayout is the file system the SD card spec (Part 2, File System
+// Specification) recommends for a capacity class.
+type sdLayout struct {
+	FileSystem   string // fat (FAT12/16), fat32 or exfat
+	ClusterSize  uint32
+	BoundaryUnit int64 // Partition start and data area alignment
+}
+
+// sdCardLayout returns the SD card layout for a card of size bytes: FAT12/16
+// for SDSC (up to 2GB), FAT32 for SDHC (up to 32GB) and exFAT for SDXC and
+// larger.
+func sdCardLayout(size int64) sdLayout {
+	const (
+		kb = 1 << 10
+		mb = 1 << 20
+		gb = 1 << 30
+	)
+	switch {
+	case size <= 8*mb:
+		return sdLayout{"fat", 8 * kb, 8 * kb}
+	case size <= 64*mb:
+		return sdLayout{"fat", 16 * kb, 16 * kb}
+	case size <= 256*mb:
+		return sdLayout{"fat", 16 * kb, 32 * kb}
+	case size <= 1*gb:
+		return sdLayout{"fat", 16 * kb, 64 * kb}
+	case size <= 2*gb:
+		return sdLayout{"fat", 32 * kb, 64 * kb}
+	case size <= 32*gb:
+		return sdLayout{"fat32", 32 * kb, 4 * mb}
+	case size <= 128*gb:
+		return sdLayout{"exfat", 128 * kb, 16 * mb}
+	case size <= 512*gb:
+		return sdLayout{"exfat", 256 * kb, 32 * mb}
+	default:
+		return sdLayout{"exfat", 512 * kb, 64 * mb}
+	}
+}
@@ -0,0 +1,216 @@
+// Package fsck checks the file systems of a USB drive's volumes with
+// Windows' chkdsk and turns its output into a structured result.
+package fsck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// chkdsk exit codes
+const (
+	exitClean    = 0 // No errors found
+	exitFixed    = 1 // Errors found and fixed
+	exitCleanup  = 2 // Disk cleanup done (or skipped without /f), no errors
+	exitNotFixed = 3 // Errors not fixed (without /f), or the volume couldn't be checked
+)
+
+// outputTailLines is how many lines of chkdsk's output are kept in the
+// error of a failed check.
+const outputTailLines = 5
+
+// ErrNotFixed is returned (wrapped) by Check when a volume has file system
+// errors that were left in place, either because Fix wasn't set or because
+// chkdsk couldn't fix them.
+var ErrNotFixed = errors.New("file system errors found")
+
+// Options configures a check.
+type Options struct {
+	DiskNumber int
+	Fix        bool // Fix errors (chkdsk /f /x), dismounting each volume first
+
+	// Progress, if set, is called before each volume is checked
+	Progress func(stage string, percentage int)
+}
+
+// Volume is the check result of one volume.
+type Volume struct {
+	Volume      string `json:"volume"` // Volume GUID path
+	DriveLetter string `json:"driveLetter,omitempty"`
+	FileSystem  string `json:"fileSystem,omitempty"`
+	ErrorsFound bool   `json:"errorsFound"`
+	ErrorsFixed bool   `json:"errorsFixed"`
+	BadClusters int64  `json:"badClusters"`
+	ClusterSize int64  `json:"clusterSize,omitempty"`
+	ExitCode    int    `json:"exitCode"`
+	Error       string `json:"error,omitempty"` // Set if the volume couldn't be checked
+}
+
+// Result is the check result of a drive.
+type Result struct {
+	DiskNumber  int      `json:"diskNumber"`
+	Fix         bool     `json:"fix"`
+	Volumes     []Volume `json:"volumes"`
+	ErrorsFound bool     `json:"errorsFound"` // On any volume
+	ErrorsFixed bool     `json:"errorsFixed"` // Every error found was fixed
+	BadClusters int64    `json:"badClusters"` // On all volumes
+	Duration    string   `json:"duration"`
+}
+
+// Patterns for chkdsk's summary lines, e.g. "4096 bytes in each allocation
+// unit." and "0 KB in bad sectors." (NTFS) or "0 bytes in bad sectors."
+// (FAT). The counts are only read from English output; in other display
+// languages a result rests on the exit code alone.
+var (
+	clusterSizePattern = regexp.MustCompile(`(?m)^[ \t]*([\d., \x{a0}]+?) bytes in each allocation unit`)
+	badSectorsPattern  = regexp.MustCompile(`(?m)^[ \t]*([\d., \x{a0}]+?) (KB|bytes) in bad sectors`)
+)
+
+// Check runs chkdsk on every mounted volume of a drive, read-only unless
+// opts.Fix is set. The result is returned along with an error wrapping
+// ErrNotFixed if errors were left on any volume.
+func Check(ctx context.Context, opts Options) (*Result, error) {
+	start := time.Now()
+
+	volumes, err := disk.ListVolumesByDiskNumber(opts.DiskNumber)
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("disk %d has no volume Windows can mount", opts.DiskNumber)
+	}
+
+	result := &Result{DiskNumber: opts.DiskNumber, Fix: opts.Fix, ErrorsFixed: true}
+	checked := 0
+	for i, volume := range volumes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		v := Volume{Volume: volume}
+		if root, _ := disk.GetVolumeDriveLetter(volume); root != "" {
+			v.DriveLetter = strings.TrimSuffix(root, `\`)
+		}
+		if opts.Progress != nil {
+			name := v.DriveLetter
+			if name == "" {
+				name = fmt.Sprintf("volume %d/%d", i+1, len(volumes))
+			}
+			opts.Progress("Checking "+name, 100*i/len(volumes))
+		}
+
+		if err := checkVolume(ctx, &v, opts.Fix); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			v.Error = err.Error()
+		} else {
+			checked++
+		}
+		result.Volumes = append(result.Volumes, v)
+		result.ErrorsFound = result.ErrorsFound || v.ErrorsFound
+		result.ErrorsFixed = result.ErrorsFixed && (!v.ErrorsFound || v.ErrorsFixed)
+		result.BadClusters += v.BadClusters
+	}
+	result.ErrorsFixed = result.ErrorsFound && result.ErrorsFixed
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	if checked == 0 {
+		return nil, fmt.Errorf("disk %d: no volume could be checked: %s", opts.DiskNumber, result.Volumes[0].Error)
+	}
+	if result.ErrorsFound && !result.ErrorsFixed {
+		if opts.Fix {
+			return result, fmt.Errorf("disk %d: %w that chkdsk couldn't fix", opts.DiskNumber, ErrNotFixed)
+		}
+		return result, fmt.Errorf("disk %d: %w; run with --fix to repair them", opts.DiskNumber, ErrNotFixed)
+	}
+	return result, nil
+}
+
+// checkVolume runs chkdsk on one volume and fills in v from its exit code
+// and output.
+func checkVolume(ctx context.Context, v *Volume, fix bool) error {
+	fs, err := disk.GetVolumeFileSystem(v.Volume)
+	if err != nil {
+		return errors.New("no file system Windows recognizes")
+	}
+	v.FileSystem = fs
+
+	// chkdsk takes a drive letter or a volume name without the trailing
+	// backslash
+	target := strings.TrimRight(v.Volume, `\`)
+	if v.DriveLetter != "" {
+		target = v.DriveLetter
+	}
+	args := []string{target}
+	if fix {
+		args = append(args, "/f", "/x")
+	}
+	out, err := exec.CommandContext(ctx, "chkdsk.exe", args...).CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("chkdsk: %w", err)
+		}
+		v.ExitCode = exitErr.ExitCode()
+	}
+	output := string(out)
+
+	switch v.ExitCode {
+	case exitClean, exitCleanup:
+	case exitFixed:
+		v.ErrorsFound, v.ErrorsFixed = true, true
+	case exitNotFixed:
+		v.ErrorsFound = true
+	default:
+		return fmt.Errorf("chkdsk exited with code %d: %s", v.ExitCode, outputTail(output))
+	}
+
+	if m := clusterSizePattern.FindStringSubmatch(output); m != nil {
+		v.ClusterSize = parseCount(m[1])
+	}
+	if m := badSectorsPattern.FindStringSubmatch(output); m != nil {
+		bad := parseCount(m[1])
+		if m[2] == "KB" {
+			bad <<= 10
+		}
+		if v.ClusterSize > 0 {
+			v.BadClusters = (bad + v.ClusterSize - 1) / v.ClusterSize
+		}
+	}
+	return nil
+}
+
+// parseCount parses a number as chkdsk prints it, with thousands separators.
+func parseCount(s string) int64 {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	n, _ := strconv.ParseInt(digits, 10, 64)
+	return n
+}
+
+// outputTail returns the last non-empty lines of chkdsk's output, which
+// say why a check failed.
+func outputTail(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > outputTailLines {
+		lines = lines[len(lines)-outputTailLines:]
+	}
+	return strings.Join(lines, " ")
+}
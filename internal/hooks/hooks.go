@@ -0,0 +1,71 @@
+// Package hooks runs the user's commands around operations, so asset
+// tracking and similar scripts run automatically per drive. A hook is
+// configured by setting WUSBKIT_HOOK_<EVENT> (e.g. WUSBKIT_HOOK_POST_FLASH)
+// to a command line, run through cmd.exe.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Hook events
+const (
+	PreFlash   = "pre-flash"   // Before a drive is flashed; failing refuses the drive
+	PostFlash  = "post-flash"  // After a drive is flashed, successfully or not
+	PostFormat = "post-format" // After a drive is formatted, successfully or not
+	PostBatch  = "post-batch"  // After a run on several drives
+)
+
+// Command returns the command configured for event, or "".
+func Command(event string) string {
+	return strings.TrimSpace(os.Getenv(envName(event)))
+}
+
+// envName returns the variable configuring event, e.g. WUSBKIT_HOOK_PRE_FLASH.
+func envName(event string) string {
+	return "WUSBKIT_HOOK_" + strings.ToUpper(strings.ReplaceAll(event, "-", "_"))
+}
+
+// Run runs the hook configured for event, if any, with payload as JSON on
+// its standard input and env added to its environment (WUSBKIT_HOOK is set
+// to the event). The hook's output goes to stderr, so it doesn't mix with
+// NDJSON on stdout. A hook that exits non-zero returns an error carrying
+// its last line of output.
+func Run(ctx context.Context, event string, payload any, env map[string]string) error {
+	command := Command(event)
+	if command == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "cmd.exe", "/C", command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), "WUSBKIT_HOOK="+event)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err = cmd.Run()
+	os.Stderr.Write(out.Bytes())
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+			return fmt.Errorf("%s hook failed: %w: %s", event, err, last)
+		}
+		return fmt.Errorf("%s hook failed: %w", event, err)
+	}
+	return nil
+}
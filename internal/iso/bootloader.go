@@ -4,8 +4,12 @@ package iso
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"golang.org/x/sys/windows"
@@ -66,7 +70,9 @@ type isoScanResult struct {
 	HasGRUB2i386PC bool // /boot/grub/i386-pc/ directory exists
 	HasSyslinuxCfg bool // syslinux.cfg exists anywhere
 	HasGrubCfg     bool // grub.cfg exists (without i386-pc parent)
-	HasLargeFile   bool // any file > 4 GB
+	HasLargeFile   bool // any file > 4 GB other than sources/install.wim
+	HasLargeWIM    bool // sources/install.wim > 4 GB (can be split for FAT32)
+	TotalSize      int64
 }
 
 // classifyBootloader determines the bootloader type from scan results.
@@ -108,9 +114,38 @@ func (r *isoScanResult) classifyPath(path string, isDir bool, fileSize int64) {
 		r.HasGrubCfg = true
 	}
 
-	if !isDir && fileSize > 4*1024*1024*1024 {
-		r.HasLargeFile = true
+	if !isDir && fileSize > fat32MaxFileSize {
+		if isInstallWIM(path) {
+			r.HasLargeWIM = true
+		} else {
+			r.HasLargeFile = true
+		}
 	}
+
+	if !isDir {
+		r.TotalSize += fileSize
+	}
+}
+
+// installBootSector writes bootmgr's partition boot record to the volume at
+// driveLetter (e.g. "G:\") using the bootsect.exe shipped on Windows media.
+func installBootSector(driveLetter string) error {
+	bootsect := filepath.Join(driveLetter, "boot", "bootsect.exe")
+	if _, err := os.Stat(bootsect); err != nil {
+		return errors.New("bootsect.exe not found on the media")
+	}
+	return runBootsect(bootsect, "/nt60", driveLetter)
+}
+
+// runBootsect runs bootsect.exe in the given mode (/nt60 or /nt52) against
+// the volume at driveLetter.
+func runBootsect(bootsect, mode, driveLetter string) error {
+	volume := strings.TrimSuffix(driveLetter, `\`)
+	out, err := exec.Command(bootsect, mode, volume, "/force").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("bootsect failed: %w: %s", err, lastLine(string(out)))
+	}
+	return nil
 }
 
 // WriteMBR writes the appropriate MBR bootstrap code to sector 0 of the disk.
@@ -157,6 +192,21 @@ func WriteMBR(diskHandle windows.Handle, bootType BootloaderType) error {
 	return nil
 }
 
+// WriteGRUBCore writes a GRUB2 i386-pc core.img into the gap between the
+// MBR and the first partition (starting at sector 1), where the GRUB2 MBR
+// boot code looks for it. gapSectors is the number of free sectors.
+func WriteGRUBCore(diskHandle windows.Handle, core []byte, gapSectors int64) error {
+	padded := make([]byte, (len(core)+sectorSize-1)/sectorSize*sectorSize)
+	copy(padded, core)
+	if int64(len(padded)/sectorSize) > gapSectors {
+		return fmt.Errorf("core.img (%d bytes) does not fit before the first partition", len(core))
+	}
+	if _, err := writeSector(diskHandle, 1, padded); err != nil {
+		return fmt.Errorf("write core.img: %w", err)
+	}
+	return nil
+}
+
 // readSector reads one sector from the disk at the given sector number.
 func readSector(handle windows.Handle, sectorNum int64, buf []byte) (int, error) {
 	offset := sectorNum * sectorSize
@@ -0,0 +1,210 @@
+package iso
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// mbrPartitionTypeGPT marks the protective MBR of a GPT disk.
+const mbrPartitionTypeGPT = 0xEE
+
+// ErrGPTDisk is returned when an MBR-only operation targets a GPT disk.
+var ErrGPTDisk = errors.New("disk uses GPT; active flags only apply to MBR disks")
+
+// MBREntry is one of the four primary partition slots in sector 0.
+type MBREntry struct {
+	Slot     int    `json:"slot"` // 1-4
+	Active   bool   `json:"active"`
+	Type     string `json:"type"` // e.g. "0x0C"
+	StartLBA uint32 `json:"startLba"`
+	Sectors  uint32 `json:"sectors"`
+}
+
+// MBRInfo describes the boot code and partition table in sector 0.
+type MBRInfo struct {
+	// BootCode names the recognised boot code ("windows", "grub2", ...),
+	// or is "empty" when zeroed and "unknown" otherwise.
+	BootCode       string     `json:"bootCode"`
+	DiskSignature  string     `json:"diskSignature"`
+	ValidSignature bool       `json:"validSignature"` // 0x55AA present
+	GPT            bool       `json:"gpt"`            // Protective MBR of a GPT disk
+	Partitions     []MBREntry `json:"partitions"`
+}
+
+// ParseBootloader maps a boot code name as accepted on the command line
+// (windows, grub2, syslinux, grub4dos) to its BootloaderType.
+func ParseBootloader(name string) (BootloaderType, error) {
+	for _, b := range []BootloaderType{BootloaderWindows, BootloaderGRUB2, BootloaderSyslinux, BootloaderGRUB4DOS} {
+		if strings.EqualFold(name, b.String()) {
+			return b, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown boot code %q: use windows, grub2, syslinux or grub4dos", name)
+}
+
+// ReadMBR reads sector 0 and describes its boot code and partition table.
+func ReadMBR(diskHandle windows.Handle) (*MBRInfo, error) {
+	sector := make([]byte, sectorSize)
+	if _, err := readSector(diskHandle, 0, sector); err != nil {
+		return nil, fmt.Errorf("read MBR: %w", err)
+	}
+
+	info := &MBRInfo{
+		BootCode:       identifyBootCode(sector),
+		DiskSignature:  fmt.Sprintf("%08X", binary.LittleEndian.Uint32(sector[0x1B8:0x1BC])),
+		ValidSignature: sector[mbrSignatureOff] == 0x55 && sector[mbrSignatureOff+1] == 0xAA,
+		Partitions:     []MBREntry{},
+	}
+	for slot := 0; slot < 4; slot++ {
+		entry := sector[mbrPartTableStart+slot*16 : mbrPartTableStart+(slot+1)*16]
+		if entry[4] == 0 {
+			continue
+		}
+		if entry[4] == mbrPartitionTypeGPT {
+			info.GPT = true
+		}
+		info.Partitions = append(info.Partitions, MBREntry{
+			Slot:     slot + 1,
+			Active:   entry[0] == 0x80,
+			Type:     fmt.Sprintf("0x%02X", entry[4]),
+			StartLBA: binary.LittleEndian.Uint32(entry[8:12]),
+			Sectors:  binary.LittleEndian.Uint32(entry[12:16]),
+		})
+	}
+	return info, nil
+}
+
+// identifyBootCode matches the bootstrap region against the embedded
+// templates.
+func identifyBootCode(sector []byte) string {
+	if bytes.Count(sector[:mbrBootstrapSize], []byte{0}) == mbrBootstrapSize {
+		return "empty"
+	}
+	for _, b := range []BootloaderType{BootloaderWindows, BootloaderGRUB2, BootloaderSyslinux, BootloaderGRUB4DOS} {
+		template, err := fs.ReadFile(mbrTemplates, b.mbrFileName())
+		if err != nil || len(template) > mbrBootstrapSize {
+			continue
+		}
+		if bytes.Equal(sector[:len(template)], template) {
+			return strings.ToLower(b.String())
+		}
+	}
+	return "unknown"
+}
+
+// WriteBootCode replaces the MBR boot code with the given template, leaving
+// the disk signature, partition table and active flags untouched.
+func WriteBootCode(diskHandle windows.Handle, bootType BootloaderType) error {
+	templateData, err := fs.ReadFile(mbrTemplates, bootType.mbrFileName())
+	if err != nil {
+		return fmt.Errorf("read MBR template %s: %w", bootType.mbrFileName(), err)
+	}
+
+	sector := make([]byte, sectorSize)
+	if _, err := readSector(diskHandle, 0, sector); err != nil {
+		return fmt.Errorf("read current MBR: %w", err)
+	}
+
+	// Clear the whole bootstrap region so no tail of the previous boot
+	// code survives a shorter template.
+	clear(sector[:mbrBootstrapSize])
+	copy(sector[:mbrBootstrapSize], templateData)
+	sector[mbrSignatureOff] = 0x55
+	sector[mbrSignatureOff+1] = 0xAA
+
+	if _, err := writeSector(diskHandle, 0, sector); err != nil {
+		return fmt.Errorf("write MBR: %w", err)
+	}
+	return nil
+}
+
+// SetActivePartition marks the partition in the given MBR slot (1-4) as
+// active and clears the flag on the others. Slot 0 clears all flags.
+func SetActivePartition(diskHandle windows.Handle, slot int) error {
+	if slot < 0 || slot > 4 {
+		return fmt.Errorf("invalid partition slot %d: must be 1-4", slot)
+	}
+
+	sector := make([]byte, sectorSize)
+	if _, err := readSector(diskHandle, 0, sector); err != nil {
+		return fmt.Errorf("read current MBR: %w", err)
+	}
+	if sector[mbrPartTableStart+4] == mbrPartitionTypeGPT {
+		return ErrGPTDisk
+	}
+	if slot > 0 && sector[mbrPartTableStart+(slot-1)*16+4] == 0 {
+		return fmt.Errorf("partition slot %d is empty", slot)
+	}
+
+	for i := 0; i < 4; i++ {
+		flag := byte(0x00)
+		if i == slot-1 {
+			flag = 0x80
+		}
+		sector[mbrPartTableStart+i*16] = flag
+	}
+
+	if _, err := writeSector(diskHandle, 0, sector); err != nil {
+		return fmt.Errorf("write MBR: %w", err)
+	}
+	return nil
+}
+
+// Partition boot records installable with InstallPBR.
+const (
+	PBRBootmgr = "bootmgr" // Windows Vista and later (bootsect /nt60)
+	PBRNTLDR   = "ntldr"   // Windows XP and earlier (bootsect /nt52)
+)
+
+// InstallPBR writes a partition boot record that loads BOOTMGR or NTLDR to
+// the FAT32 or NTFS volume at driveLetter (e.g. "G:\"), keeping its BPB.
+// bootsect is the path to bootsect.exe; if empty it is looked up on PATH.
+func InstallPBR(driveLetter, kind, bootsect string) error {
+	var mode string
+	switch strings.ToLower(kind) {
+	case PBRBootmgr:
+		mode = "/nt60"
+	case PBRNTLDR:
+		mode = "/nt52"
+	default:
+		return fmt.Errorf("unknown boot record %q: use bootmgr or ntldr", kind)
+	}
+
+	fileSystem, err := volumeFileSystem(driveLetter)
+	if err != nil {
+		return err
+	}
+	switch fileSystem {
+	case "FAT32", "NTFS":
+	default:
+		return fmt.Errorf("%s is %s; boot records can only be installed on FAT32 or NTFS", driveLetter, fileSystem)
+	}
+
+	if bootsect == "" {
+		if bootsect, err = exec.LookPath("bootsect.exe"); err != nil {
+			return errors.New(`bootsect.exe not found; pass --bootsect with its path (it is in \boot on Windows install media)`)
+		}
+	}
+	return runBootsect(bootsect, mode, driveLetter)
+}
+
+// volumeFileSystem returns the filesystem name of the volume at
+// driveLetter, e.g. "NTFS".
+func volumeFileSystem(driveLetter string) (string, error) {
+	root, err := windows.UTF16PtrFromString(strings.TrimSuffix(driveLetter, `\`) + `\`)
+	if err != nil {
+		return "", err
+	}
+	fsName := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(root, nil, 0, nil, nil, nil, &fsName[0], uint32(len(fsName))); err != nil {
+		return "", fmt.Errorf("query volume %s: %w", driveLetter, err)
+	}
+	return windows.UTF16ToString(fsName), nil
+}
@@ -0,0 +1,279 @@
+package iso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// virtdisk.dll constants for mounting ISO files (Windows 8+).
+const (
+	virtualStorageTypeDeviceISO   = 1          // VIRTUAL_STORAGE_TYPE_DEVICE_ISO
+	virtualDiskAccessRead         = 0x000d0000 // VIRTUAL_DISK_ACCESS_READ
+	openVirtualDiskVersion1       = 1
+	attachVirtualDiskVersion1     = 1
+	attachVirtualDiskFlagReadOnly = 0x00000001
+)
+
+// virtualStorageTypeVendorMicrosoft is VIRTUAL_STORAGE_TYPE_VENDOR_MICROSOFT.
+var virtualStorageTypeVendorMicrosoft = windows.GUID{
+	Data1: 0xEC984AEC,
+	Data2: 0xA0F9,
+	Data3: 0x47E9,
+	Data4: [8]byte{0x90, 0x1F, 0x71, 0x41, 0x5A, 0x66, 0x34, 0x5B},
+}
+
+var (
+	modvirtdisk                    = windows.NewLazySystemDLL("virtdisk.dll")
+	procOpenVirtualDisk            = modvirtdisk.NewProc("OpenVirtualDisk")
+	procAttachVirtualDisk          = modvirtdisk.NewProc("AttachVirtualDisk")
+	procDetachVirtualDisk          = modvirtdisk.NewProc("DetachVirtualDisk")
+	procGetVirtualDiskPhysicalPath = modvirtdisk.NewProc("GetVirtualDiskPhysicalPath")
+)
+
+// virtualStorageType mirrors VIRTUAL_STORAGE_TYPE.
+type virtualStorageType struct {
+	DeviceID uint32
+	VendorID windows.GUID
+}
+
+// openVirtualDiskParameters mirrors OPEN_VIRTUAL_DISK_PARAMETERS. The union
+// is padded to its largest member so any version the API reads is in bounds.
+type openVirtualDiskParameters struct {
+	Version uint32
+	RWDepth uint32
+	_       [36]byte
+}
+
+// attachVirtualDiskParameters mirrors ATTACH_VIRTUAL_DISK_PARAMETERS.
+type attachVirtualDiskParameters struct {
+	Version  uint32
+	Reserved uint32
+	_        [16]byte
+}
+
+// mountedISO is an ISO attached read-only as a virtual CD-ROM drive.
+type mountedISO struct {
+	handle windows.Handle
+	// Root is the directory the ISO's files appear under, e.g. "F:\".
+	Root string
+}
+
+// mountISO attaches an ISO file as a read-only virtual drive so its files
+// can be copied with the regular file APIs. Unlike the pure-Go ISO9660
+// reader this also sees UDF-only content, which is how Windows install
+// media is mastered.
+func mountISO(path string) (*mountedISO, error) {
+	if err := modvirtdisk.Load(); err != nil {
+		return nil, fmt.Errorf("virtdisk.dll not available: %w", err)
+	}
+
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ISO path: %w", err)
+	}
+
+	storageType := virtualStorageType{
+		DeviceID: virtualStorageTypeDeviceISO,
+		VendorID: virtualStorageTypeVendorMicrosoft,
+	}
+	openParams := openVirtualDiskParameters{Version: openVirtualDiskVersion1, RWDepth: 1}
+
+	var handle windows.Handle
+	r1, _, _ := procOpenVirtualDisk.Call(
+		uintptr(unsafe.Pointer(&storageType)),
+		uintptr(unsafe.Pointer(pathPtr)),
+		virtualDiskAccessRead,
+		0,
+		uintptr(unsafe.Pointer(&openParams)),
+		uintptr(unsafe.Pointer(&handle)),
+	)
+	if r1 != 0 {
+		return nil, fmt.Errorf("OpenVirtualDisk: %w", syscall.Errno(r1))
+	}
+
+	attachParams := attachVirtualDiskParameters{Version: attachVirtualDiskVersion1}
+	r1, _, _ = procAttachVirtualDisk.Call(
+		uintptr(handle),
+		0,
+		attachVirtualDiskFlagReadOnly,
+		0,
+		uintptr(unsafe.Pointer(&attachParams)),
+		0,
+	)
+	if r1 != 0 {
+		windows.CloseHandle(handle)
+		return nil, fmt.Errorf("AttachVirtualDisk: %w", syscall.Errno(r1))
+	}
+
+	m := &mountedISO{handle: handle}
+	physical, err := m.physicalPath()
+	if err != nil {
+		m.Unmount()
+		return nil, err
+	}
+
+	// The volume gets a drive letter shortly after attaching (unless
+	// automount is disabled, in which case the device path still works).
+	m.Root = `\\?\GLOBALROOT\Device\` + strings.TrimPrefix(physical, `\\.\`) + `\`
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if letter := driveLetterForDevice(physical); letter != "" {
+			m.Root = letter
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return m, nil
+}
+
+// physicalPath returns the attached device path, e.g. \\.\CDROM1.
+func (m *mountedISO) physicalPath() (string, error) {
+	buf := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buf) * 2)
+	r1, _, _ := procGetVirtualDiskPhysicalPath.Call(
+		uintptr(m.handle),
+		uintptr(unsafe.Pointer(&size)),
+		uintptr(unsafe.Pointer(&buf[0])),
+	)
+	if r1 != 0 {
+		return "", fmt.Errorf("GetVirtualDiskPhysicalPath: %w", syscall.Errno(r1))
+	}
+	return windows.UTF16ToString(buf), nil
+}
+
+// Unmount detaches the ISO.
+func (m *mountedISO) Unmount() {
+	procDetachVirtualDisk.Call(uintptr(m.handle), 0, 0)
+	windows.CloseHandle(m.handle)
+}
+
+// driveLetterForDevice returns the drive root ("F:\") whose DOS device
+// maps to the given \\.\CDROMn path, or "" if none does yet.
+func driveLetterForDevice(physical string) string {
+	device := strings.ToLower(strings.TrimPrefix(physical, `\\.\`))
+
+	mask, err := windows.GetLogicalDrives()
+	if err != nil {
+		return ""
+	}
+	buf := make([]uint16, windows.MAX_PATH)
+	for i := 0; i < 26; i++ {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		drive := string(rune('A'+i)) + ":"
+		drivePtr, _ := windows.UTF16PtrFromString(drive)
+		n, err := windows.QueryDosDevice(drivePtr, &buf[0], uint32(len(buf)))
+		if err != nil || n == 0 {
+			continue
+		}
+		target := strings.ToLower(windows.UTF16ToString(buf))
+		if strings.HasSuffix(target, `\`+device) {
+			return drive + `\`
+		}
+	}
+	return ""
+}
+
+// scanMounted walks a mounted ISO to detect bootloader indicators and
+// large files.
+func scanMounted(root string) (*isoScanResult, error) {
+	result := &isoScanResult{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		var size int64
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size = info.Size()
+		}
+		result.classifyPath(filepath.ToSlash(rel), d.IsDir(), size)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk mounted ISO: %w", err)
+	}
+	return result, nil
+}
+
+// copyTree copies a mounted ISO to targetDir, splitting install.wim when
+// w.splitWIM is set. Progress is reported by bytes over 45%-99%.
+func (w *Writer) copyTree(ctx context.Context, root, targetDir string, totalSize int64) error {
+	var copied int64
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		targetPath := filepath.Join(targetDir, rel)
+
+		if d.IsDir() {
+			if err := os.MkdirAll(targetPath, 0o755); err != nil {
+				return fmt.Errorf("create directory %s: %w", targetPath, err)
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		pct := 45 + int(copied*54/max(totalSize, 1))
+		if w.splitWIM && isInstallWIM(rel) && info.Size() > fat32MaxFileSize {
+			w.report("splitting", pct, "Splitting install.wim for FAT32")
+			if err := splitWIM(path, filepath.Dir(targetPath)); err != nil {
+				return fmt.Errorf("split %s: %w", rel, err)
+			}
+		} else if err := copyFile(path, targetPath); err != nil {
+			return fmt.Errorf("copy %s: %w", rel, err)
+		}
+
+		copied += info.Size()
+		pct = min(45+int(copied*54/max(totalSize, 1)), 99)
+		w.report("extracting", pct, fmt.Sprintf("Copying files (%d / %d MB)", copied>>20, totalSize>>20))
+		return nil
+	})
+}
+
+// copyFile copies a single file, replacing targetPath.
+func copyFile(srcPath, targetPath string) error {
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(targetPath)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("write file contents: %w", err)
+	}
+	return out.Close()
+}
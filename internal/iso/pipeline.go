@@ -20,7 +20,7 @@ import (
 type WriteOptions struct {
 	DiskNumber int    // Physical disk number (e.g., 1 for \\.\PhysicalDrive1)
 	ISOPath    string // Path to the ISO file
-	FileSystem string // "FAT32" or "NTFS" (auto-detected if empty: NTFS if any file > 4GB)
+	FileSystem string // "FAT32", "exFAT" or "NTFS" (auto-detected if empty: NTFS if any file > 4GB)
 	Label      string // Volume label for the formatted partition
 }
 
@@ -30,6 +30,7 @@ type WriteProgress struct {
 	Percentage int    `json:"percentage"`
 	Status     string `json:"status"`
 	Error      string `json:"error,omitempty"`
+	Warning    string `json:"warning,omitempty"`
 }
 
 // Writer orchestrates writing an ISO image to a USB drive. It creates a
@@ -37,6 +38,7 @@ type WriteProgress struct {
 // extracts ISO contents.
 type Writer struct {
 	progressChan chan WriteProgress
+	splitWIM     bool // Split a >4GB sources/install.wim into .swm pieces
 }
 
 // NewWriter creates a new ISO Writer with a buffered progress channel.
@@ -62,17 +64,24 @@ type partitionResult struct {
 }
 
 // Write executes the full ISO-to-USB pipeline:
-//  1. Scan ISO to detect bootloader type and large files
+//  1. Mount the ISO and scan it to detect bootloader type and large files
 //  2. Partition the disk (open, create MBR, wait for volume)
-//  3. Format volume (FAT32 or NTFS)
+//  3. Format volume (FAT32, exFAT or NTFS)
 //  4. Write bootloader MBR to sector 0
-//  5. Assign drive letter and extract ISO contents
+//  5. Assign drive letter and extract ISO contents, splitting install.wim
+//     when it doesn't fit on FAT32
+//  6. Install the Windows boot sector on FAT32 volumes
 func (w *Writer) Write(ctx context.Context, opts WriteOptions) error {
 	defer close(w.progressChan)
 
-	// Step 1: Scan ISO contents.
+	// Step 1: Scan ISO contents. Mounting lets Windows read UDF-only media
+	// (all current Windows ISOs); the pure-Go ISO9660 reader is the fallback.
 	w.report("scanning", 0, "Scanning ISO contents")
-	scanResult, err := w.scanISO(opts.ISOPath)
+	mount, err := mountISO(opts.ISOPath)
+	if err == nil {
+		defer mount.Unmount()
+	}
+	scanResult, err := w.scanISO(opts.ISOPath, mount)
 	if err != nil {
 		return w.fail("scanning", fmt.Errorf("scan ISO: %w", err))
 	}
@@ -88,9 +97,13 @@ func (w *Writer) Write(ctx context.Context, opts WriteOptions) error {
 			fsType = "FAT32"
 		}
 	}
+	if fsType == "EXFAT" {
+		fsType = "exFAT"
+	}
 	if scanResult.HasLargeFile && fsType == "FAT32" {
 		fsType = "NTFS" // Force NTFS when files exceed 4 GB.
 	}
+	w.splitWIM = fsType == "FAT32" && scanResult.HasLargeWIM
 
 	label := opts.Label
 	if label == "" {
@@ -130,17 +143,31 @@ func (w *Writer) Write(ctx context.Context, opts WriteOptions) error {
 
 	// Step 5: Extract ISO contents.
 	w.report("extracting", 45, "Extracting ISO contents")
-	if err := w.extractContents(ctx, opts.ISOPath, partResult.VolumePath); err != nil {
+	driveLetter, err := w.extractContents(ctx, opts.ISOPath, mount, scanResult.TotalSize, partResult.VolumePath)
+	if err != nil {
 		return err // extractContents already calls w.fail
 	}
 
+	// Step 6: Our FAT32 formatter writes no boot code, so BIOS boot of
+	// Windows media needs bootmgr's boot sector. UEFI boot works regardless,
+	// so a failure here is reported but not fatal.
+	if fsType == "FAT32" && bootType == BootloaderWindows {
+		w.report("bootloader", 99, "Installing Windows boot sector")
+		if err := installBootSector(driveLetter); err != nil {
+			w.warn("bootloader", fmt.Sprintf("%v; the drive will only boot in UEFI mode", err))
+		}
+	}
+
 	w.report("complete", 100, "ISO written successfully")
 	return nil
 }
 
-// scanISO opens the ISO and walks its filesystem to detect bootloader
-// indicators and large files.
-func (w *Writer) scanISO(isoPath string) (*isoScanResult, error) {
+// scanISO walks the ISO's filesystem to detect bootloader indicators and
+// large files, through the mounted volume when available.
+func (w *Writer) scanISO(isoPath string, mount *mountedISO) (*isoScanResult, error) {
+	if mount != nil {
+		return scanMounted(mount.Root)
+	}
 	return scanISO(isoPath)
 }
 
@@ -176,8 +203,8 @@ func (w *Writer) partitionDisk(ctx context.Context, diskNumber int, fsType strin
 
 	// Determine partition type based on target filesystem.
 	partType := byte(disk.PARTITION_FAT32) // 0x0C
-	if fsType == "NTFS" {
-		partType = byte(disk.PARTITION_NTFS) // 0x07
+	if fsType != "FAT32" {
+		partType = byte(disk.PARTITION_NTFS) // 0x07, also used for exFAT
 	}
 
 	// Single partition spanning the full disk, starting at one track offset.
@@ -224,7 +251,7 @@ func (w *Writer) partitionDisk(ctx context.Context, diskNumber int, fsType strin
 }
 
 // formatVolume formats the newly created volume with the appropriate
-// filesystem (FAT32 or NTFS).
+// filesystem (FAT32, exFAT or NTFS).
 func (w *Writer) formatVolume(diskNumber int, pr *partitionResult, fsType, label string) error {
 	err := formatVolume(pr.VolumePath, fsType, label, pr.Geo, pr.StartOffset, pr.PartSize, diskNumber)
 	if err != nil {
@@ -250,22 +277,27 @@ func (w *Writer) writeBootloader(diskNumber int, bootType BootloaderType) error
 }
 
 // extractContents assigns a drive letter to the volume and extracts the ISO
-// contents to the mounted filesystem.
-func (w *Writer) extractContents(ctx context.Context, isoPath, volumePath string) error {
+// contents to the mounted filesystem, returning the drive letter.
+func (w *Writer) extractContents(ctx context.Context, isoPath string, mount *mountedISO, totalSize int64, volumePath string) (string, error) {
 	w.report("mounting", 40, "Assigning drive letter")
 	driveLetter, err := ensureDriveLetter(volumePath)
 	if err != nil {
-		return w.fail("mounting", fmt.Errorf("assign drive letter: %w", err))
+		return "", w.fail("mounting", fmt.Errorf("assign drive letter: %w", err))
 	}
 
 	if err := ctx.Err(); err != nil {
-		return w.fail("mounting", err)
+		return "", w.fail("mounting", err)
 	}
 
-	if err := w.extractISO(ctx, isoPath, driveLetter); err != nil {
-		return w.fail("extracting", fmt.Errorf("extract ISO: %w", err))
+	if mount != nil {
+		err = w.copyTree(ctx, mount.Root, driveLetter, totalSize)
+	} else {
+		err = w.extractISO(ctx, isoPath, driveLetter)
 	}
-	return nil
+	if err != nil {
+		return "", w.fail("extracting", fmt.Errorf("extract ISO: %w", err))
+	}
+	return driveLetter, nil
 }
 
 // report sends a progress update to the progress channel.
@@ -281,6 +313,18 @@ func (w *Writer) report(stage string, pct int, status string) {
 	}
 }
 
+// warn sends a non-fatal warning progress update.
+func (w *Writer) warn(stage, warning string) {
+	select {
+	case w.progressChan <- WriteProgress{
+		Stage:   stage,
+		Status:  "Warning",
+		Warning: warning,
+	}:
+	default:
+	}
+}
+
 // fail sends an error progress update and returns the error.
 func (w *Writer) fail(stage string, err error) error {
 	select {
@@ -313,13 +357,14 @@ func formatVolume(volumePath, fsType, label string, geo *disk.DiskGeometry, part
 			SectorsPerTrack:   geo.SectorsPerTrack,
 			TracksPerCylinder: geo.TracksPerCylinder,
 			HiddenSectors:     uint32(partOffset / int64(geo.BytesPerSector)),
+			VolumePath:        volumePath,
 		})
 	}
 
-	// NTFS: use the VDS/fmifs formatter.
+	// NTFS/exFAT: use the VDS/fmifs formatter.
 	return disk.FormatVolume(disk.FormatVolumeOptions{
 		VolumePath:  volumePath,
-		FileSystem:  "NTFS",
+		FileSystem:  fsType,
 		Label:       label,
 		QuickFormat: true,
 	})
@@ -442,7 +487,13 @@ func (w *Writer) extractDir(ctx context.Context, dir *iso9660.File, targetDir st
 			continue
 		}
 
-		if err := extractFile(child, targetPath); err != nil {
+		if w.splitWIM && child.Size() > fat32MaxFileSize && strings.EqualFold(name, "install.wim") &&
+			strings.EqualFold(filepath.Base(targetDir), "sources") {
+			w.report("splitting", 45+(*extracted*54)/max(total, 1), "Splitting install.wim for FAT32")
+			if err := extractSplitWIM(child, targetDir); err != nil {
+				return fmt.Errorf("split %s: %w", targetPath, err)
+			}
+		} else if err := extractFile(child, targetPath); err != nil {
 			return fmt.Errorf("extract %s: %w", targetPath, err)
 		}
 
@@ -481,6 +532,22 @@ func extractFile(isoFile *iso9660.File, targetPath string) error {
 	return nil
 }
 
+// extractSplitWIM extracts an install.wim to a temporary directory and
+// splits it into targetDir, since DISM can't read from inside the ISO.
+func extractSplitWIM(isoFile *iso9660.File, targetDir string) error {
+	tmpDir, err := os.MkdirTemp("", "wusbkit-wim-")
+	if err != nil {
+		return fmt.Errorf("create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	wimPath := filepath.Join(tmpDir, "install.wim")
+	if err := extractFile(isoFile, wimPath); err != nil {
+		return err
+	}
+	return splitWIM(wimPath, targetDir)
+}
+
 // countISOFiles counts the total number of files (non-directories) in the ISO.
 func countISOFiles(dir *iso9660.File) int {
 	count := 0
@@ -502,3 +569,34 @@ func countISOFiles(dir *iso9660.File) int {
 	}
 	return count
 }
+
+// LookupPath resolves a slash-separated path below dir, matching names
+// case-insensitively since plain ISO9660 names are upper case. It returns
+// nil if the path doesn't exist or can't be read.
+func LookupPath(dir *iso9660.File, path string) *iso9660.File {
+	cur := dir
+	for _, part := range strings.Split(path, "/") {
+		if !cur.IsDir() {
+			return nil
+		}
+		// GetChildren panics on directories it can't read (e.g. past the
+		// buffered prefix of a compressed image); the . and .. entries
+		// GetAllChildren adds never match a path component anyway.
+		children, err := cur.GetAllChildren()
+		if err != nil {
+			return nil
+		}
+		var next *iso9660.File
+		for _, child := range children {
+			if strings.EqualFold(child.Name(), part) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
@@ -0,0 +1,43 @@
+package iso
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// fat32MaxFileSize is the largest file FAT32 can store (4 GiB - 1).
+const fat32MaxFileSize = 4*1024*1024*1024 - 1
+
+// swmChunkMB is the size of each install*.swm piece. Setup finds the
+// pieces by name, so the split image installs like the original.
+const swmChunkMB = 3800
+
+// isInstallWIM reports whether path (relative to the ISO root) is the
+// Windows install image, the one file Windows media can't fit on FAT32.
+func isInstallWIM(path string) bool {
+	return strings.EqualFold(filepath.ToSlash(path), "sources/install.wim")
+}
+
+// splitWIM splits a WIM into install.swm, install2.swm, ... in targetDir
+// using DISM, so it fits on FAT32.
+func splitWIM(wimPath, targetDir string) error {
+	cmd := exec.Command("dism.exe",
+		"/Split-Image",
+		"/ImageFile:"+wimPath,
+		"/SWMFile:"+filepath.Join(targetDir, "install.swm"),
+		fmt.Sprintf("/FileSize:%d", swmChunkMB),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("dism /Split-Image failed: %w: %s", err, lastLine(string(out)))
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of command output, which is
+// where DISM puts its error message.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
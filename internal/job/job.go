@@ -0,0 +1,261 @@
+// Package job runs provisioning jobs: a manifest lists the drives to work
+// on and a sequence of steps (flash, format, label, copy, verify, eject)
+// applied to each of them.
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"gopkg.in/yaml.v3"
+)
+
+// Step names
+const (
+	StepFlash  = "flash"
+	StepFormat = "format"
+	StepLabel  = "label"
+	StepCopy   = "copy"
+	StepVerify = "verify"
+	StepEject  = "eject"
+)
+
+// Manifest is a provisioning job, read from a YAML (or JSON) file.
+type Manifest struct {
+	Targets       Targets `yaml:"targets"`
+	MaxConcurrent int     `yaml:"maxConcurrent"` // Drives worked on at once, 0 = unlimited
+	Steps         []Step  `yaml:"steps"`
+}
+
+// Targets selects the drives a job runs on; the selections add up.
+type Targets struct {
+	Disks   string   `yaml:"disks"`   // Disk numbers, e.g. "2-5" or "2,4,6"
+	Serials []string `yaml:"serials"` // Serial numbers
+	Ports   string   `yaml:"ports"`   // Hub port numbers, e.g. "1-8"
+	All     bool     `yaml:"all"`     // Every USB drive except system disks
+	Exclude []string `yaml:"exclude"` // Serial numbers, drive letters or disk numbers to leave out
+}
+
+// Step is one operation of a job. In the manifest it is written as its name
+// with options (`format: {fs: exfat}`), its name with the main option
+// (`label: KIOSK`, `copy: ./content`, `flash: kiosk.img`) or only its name
+// (`eject`).
+type Step struct {
+	Name   string
+	Flash  FlashStep
+	Format FormatStep
+	Label  LabelStep
+	Copy   CopyStep
+	Verify VerifyStep
+}
+
+// FlashStep writes an image to the drive.
+type FlashStep struct {
+	Image  string `yaml:"image"` // Local image or URL
+	Verify bool   `yaml:"verify"`
+}
+
+// FormatStep formats the drive with a single partition.
+type FormatStep struct {
+	FS    string `yaml:"fs"` // fat32 (default), ntfs, exfat, refs, udf, ext2 or ext4
+	Label string `yaml:"label"`
+	Quick *bool  `yaml:"quick"` // Default true
+}
+
+// LabelStep sets the label of the drive's first volume.
+type LabelStep struct {
+	Name string `yaml:"name"`
+}
+
+// CopyStep copies a directory tree onto the drive's first volume.
+type CopyStep struct {
+	Source string `yaml:"source"`
+	Dest   string `yaml:"dest"` // Directory on the drive, default its root
+}
+
+// VerifyStep compares the drive with an image, or without one, re-reads the
+// files copied by the job's earlier copy steps and compares them with their
+// sources.
+type VerifyStep struct {
+	Image string `yaml:"image"`
+}
+
+// UnmarshalYAML reads a step in any of its forms.
+func (s *Step) UnmarshalYAML(node *yaml.Node) error {
+	value := (*yaml.Node)(nil)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		s.Name = node.Value
+	case yaml.MappingNode:
+		if len(node.Content) != 2 {
+			return fmt.Errorf("line %d: a step has exactly one operation", node.Line)
+		}
+		s.Name, value = node.Content[0].Value, node.Content[1]
+	default:
+		return fmt.Errorf("line %d: invalid step", node.Line)
+	}
+
+	var target any
+	var shorthand *string // Field set by a plain value
+	switch s.Name {
+	case StepFlash:
+		target, shorthand = &s.Flash, &s.Flash.Image
+	case StepFormat:
+		target, shorthand = &s.Format, &s.Format.FS
+	case StepLabel:
+		target, shorthand = &s.Label, &s.Label.Name
+	case StepCopy:
+		target, shorthand = &s.Copy, &s.Copy.Source
+	case StepVerify:
+		target, shorthand = &s.Verify, &s.Verify.Image
+	case StepEject:
+	default:
+		return fmt.Errorf("line %d: unknown step %q", node.Line, s.Name)
+	}
+	if value == nil || target == nil || value.Tag == "!!null" {
+		return nil
+	}
+	if value.Kind == yaml.ScalarNode && shorthand != nil {
+		*shorthand = value.Value
+		return nil
+	}
+	return value.Decode(target)
+}
+
+// Load reads and checks a manifest.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// validate checks the manifest before any drive is touched.
+func (m *Manifest) validate() error {
+	t := m.Targets
+	if t.Disks == "" && len(t.Serials) == 0 && t.Ports == "" && !t.All {
+		return errors.New("no targets: set targets.disks, serials, ports or all")
+	}
+	if m.MaxConcurrent < 0 {
+		return errors.New("maxConcurrent can't be negative")
+	}
+	if len(m.Steps) == 0 {
+		return errors.New("no steps")
+	}
+
+	copied := false
+	for i, s := range m.Steps {
+		n := i + 1
+		if i > 0 && m.Steps[i-1].Name == StepEject {
+			return fmt.Errorf("step %d (%s): nothing can run after eject", n, s.Name)
+		}
+		switch s.Name {
+		case StepFlash:
+			if s.Flash.Image == "" {
+				return fmt.Errorf("step %d (flash): no image", n)
+			}
+			if err := checkImage(s.Flash.Image); err != nil {
+				return fmt.Errorf("step %d (flash): %w", n, err)
+			}
+		case StepFormat:
+			if s.Format.FS == "" {
+				m.Steps[i].Format.FS = "fat32"
+			}
+			if err := format.ValidateFileSystem(m.Steps[i].Format.FS); err != nil {
+				return fmt.Errorf("step %d (format): %w", n, err)
+			}
+		case StepLabel:
+			if strings.TrimSpace(s.Label.Name) == "" {
+				return fmt.Errorf("step %d (label): no name", n)
+			}
+		case StepCopy:
+			info, err := os.Stat(s.Copy.Source)
+			if err != nil {
+				return fmt.Errorf("step %d (copy): %w", n, err)
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("step %d (copy): %s is not a directory", n, s.Copy.Source)
+			}
+			copied = true
+		case StepVerify:
+			if s.Verify.Image != "" {
+				if err := checkImage(s.Verify.Image); err != nil {
+					return fmt.Errorf("step %d (verify): %w", n, err)
+				}
+			} else if !copied {
+				return fmt.Errorf("step %d (verify): no image, and no files copied before it to check", n)
+			}
+		}
+	}
+	return nil
+}
+
+// Erases reports whether the job overwrites the drives' contents.
+func (m *Manifest) Erases() bool {
+	for _, s := range m.Steps {
+		if s.Name == StepFlash || s.Name == StepFormat {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe returns a one-line description of each step, for confirmation
+// prompts.
+func (m *Manifest) Describe() []string {
+	lines := make([]string, len(m.Steps))
+	for i, s := range m.Steps {
+		var desc string
+		switch s.Name {
+		case StepFlash:
+			desc = "flash " + s.Flash.Image
+			if s.Flash.Verify {
+				desc += " (verified)"
+			}
+		case StepFormat:
+			desc = "format as " + s.Format.FS
+			if s.Format.Label != "" {
+				desc += fmt.Sprintf(" labeled %q", s.Format.Label)
+			}
+		case StepLabel:
+			desc = fmt.Sprintf("label %q", s.Label.Name)
+		case StepCopy:
+			desc = "copy " + s.Copy.Source
+			if s.Copy.Dest != "" {
+				desc += " to " + s.Copy.Dest
+			}
+		case StepVerify:
+			desc = "verify copied files"
+			if s.Verify.Image != "" {
+				desc = "verify against " + s.Verify.Image
+			}
+		case StepEject:
+			desc = "eject"
+		}
+		lines[i] = fmt.Sprintf("%d. %s", i+1, desc)
+	}
+	return lines
+}
+
+// checkImage checks a local image exists; URLs are checked when opened.
+func checkImage(path string) error {
+	if flash.IsURL(path) {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("image not found: %s", path)
+	}
+	return nil
+}
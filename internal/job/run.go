@@ -0,0 +1,213 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/files"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/format"
+	"github.com/lazaroagomez/wusbkit/internal/label"
+)
+
+// mountTimeout is how long a step that needs the drive's volume waits for
+// Windows to mount it after a flash or format.
+const mountTimeout = 15 * time.Second
+
+// copiedTree is what a copy step put on a drive, for verify.
+type copiedTree struct {
+	root    string
+	entries []files.Entry
+}
+
+// run is one drive's pass through a job.
+type run struct {
+	m          *Manifest
+	diskNumber int
+	report     func(stage string, percentage int)
+	copied     []copiedTree
+}
+
+// Run applies the job's steps to one drive in order, stopping at the first
+// that fails. The caller holds the disk's lock. Progress is reported as the
+// current step and the share of the whole job done.
+func (m *Manifest) Run(ctx context.Context, diskNumber int, report func(stage string, percentage int)) error {
+	r := &run{m: m, diskNumber: diskNumber, report: report}
+	for i, s := range m.Steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := r.step(ctx, i, s); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, s.Name, err)
+		}
+	}
+	return nil
+}
+
+// progress reports a step's progress, scaled to the whole job.
+func (r *run) progress(idx int, stage string, percentage int) {
+	n := len(r.m.Steps)
+	r.report(fmt.Sprintf("%d/%d %s", idx+1, n, stage), (idx*100+min(max(percentage, 0), 100))/n)
+}
+
+func (r *run) step(ctx context.Context, idx int, s Step) error {
+	r.progress(idx, s.Name, 0)
+	switch s.Name {
+	case StepFlash:
+		return r.flash(ctx, idx, s.Flash)
+	case StepFormat:
+		return r.format(ctx, idx, s.Format)
+	case StepLabel:
+		root, err := volumeRoot(ctx, r.diskNumber)
+		if err != nil {
+			return err
+		}
+		return label.SetByPath(root, s.Label.Name)
+	case StepCopy:
+		return r.copy(ctx, idx, s.Copy)
+	case StepVerify:
+		if s.Verify.Image != "" {
+			return r.verifyImage(ctx, idx, s.Verify.Image)
+		}
+		return r.verifyFiles(ctx, idx)
+	case StepEject:
+		return disk.EjectDisk(r.diskNumber)
+	}
+	return fmt.Errorf("unknown step %q", s.Name)
+}
+
+func (r *run) flash(ctx context.Context, idx int, s FlashStep) error {
+	flasher := flash.NewFlasher()
+	drained := make(chan struct{})
+	go func() {
+		for p := range flasher.Progress() {
+			if p.Status == flash.StatusInProgress {
+				r.progress(idx, p.Stage, p.Percentage)
+			}
+		}
+		close(drained)
+	}()
+	_, _, err := flasher.Flash(ctx, flash.Options{
+		DiskNumber: r.diskNumber,
+		ImagePath:  s.Image,
+		Verify:     s.Verify,
+		BufferSize: 4,
+	})
+	<-drained
+	return err
+}
+
+func (r *run) format(ctx context.Context, idx int, s FormatStep) error {
+	quick := true
+	if s.Quick != nil {
+		quick = *s.Quick
+	}
+	formatter := format.NewFormatter()
+	go func() {
+		for p := range formatter.Progress() {
+			if p.Status == "in_progress" {
+				r.progress(idx, p.Stage, p.Percentage)
+			}
+		}
+	}()
+	return formatter.Format(ctx, format.Options{
+		DiskNumber: r.diskNumber,
+		FileSystem: s.FS,
+		Label:      s.Label,
+		Quick:      quick,
+	})
+}
+
+// copy copies the source tree onto the drive.
+func (r *run) copy(ctx context.Context, idx int, s CopyStep) error {
+	root, err := volumeRoot(ctx, r.diskNumber)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(root, s.Dest)
+
+	copier := files.NewCopier()
+	go func() {
+		for p := range copier.Progress() {
+			if p.Status == flash.StatusInProgress {
+				r.progress(idx, "Copying files", p.Percentage)
+			}
+		}
+	}()
+	result, err := copier.Copy(ctx, files.Options{Source: s.Source, Target: target})
+	if err != nil {
+		return err
+	}
+	r.copied = append(r.copied, copiedTree{root: target, entries: result.Entries})
+	return nil
+}
+
+// verifyFiles re-reads the files copied so far and compares them with the
+// hashes taken while copying.
+func (r *run) verifyFiles(ctx context.Context, idx int) error {
+	var total, checked int64
+	for _, tree := range r.copied {
+		for _, e := range tree.entries {
+			total += e.Size
+		}
+	}
+	for _, tree := range r.copied {
+		err := files.Verify(ctx, tree.root, tree.entries, func(e files.Entry) {
+			checked += e.Size
+			r.progress(idx, "Verifying files", int(checked*100/max(total, 1)))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyImage compares the drive with an image.
+func (r *run) verifyImage(ctx context.Context, idx int, image string) error {
+	verifier := flash.NewVerifier()
+	go func() {
+		for p := range verifier.Progress() {
+			if p.Status == flash.StatusInProgress {
+				r.progress(idx, p.Stage, p.Percentage)
+			}
+		}
+	}()
+	result, err := verifier.Verify(ctx, flash.VerifyOptions{
+		DiskNumber: r.diskNumber,
+		ImagePath:  image,
+	})
+	if err != nil {
+		return err
+	}
+	if !result.Match {
+		return errors.New("the drive doesn't match the image")
+	}
+	return nil
+}
+
+// volumeRoot returns the root (e.g. `E:\`) of the drive's first volume with
+// a drive letter, waiting for Windows to mount it after a flash or format.
+func volumeRoot(ctx context.Context, diskNumber int) (string, error) {
+	deadline := time.Now().Add(mountTimeout)
+	for {
+		volumes, _ := disk.ListVolumesByDiskNumber(diskNumber)
+		for _, v := range volumes {
+			if root, _ := disk.GetVolumeDriveLetter(v); root != "" {
+				return root, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return "", errors.New("no volume with a drive letter appeared")
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
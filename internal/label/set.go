@@ -0,0 +1,72 @@
+package label
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// powershellTimeout bounds the PowerShell fallback, which can hang on a
+// drive that is going away.
+const powershellTimeout = 30 * time.Second
+
+// Set sets the label of a drive's volume. An empty name removes the label.
+func Set(driveLetter, name string) error {
+	return SetByPath(strings.TrimSuffix(driveLetter, ":")+`:\`, name)
+}
+
+// SetByPath sets the label of the volume at rootPath, a drive root (E:\) or
+// volume GUID path. It uses the Win32 API and falls back to PowerShell's
+// Set-Volume, which goes through the Storage Management service and can
+// succeed where SetVolumeLabelW is refused.
+func SetByPath(rootPath, name string) error {
+	err := disk.SetVolumeLabelByPath(rootPath, name)
+	if err == nil {
+		return nil
+	}
+	if psErr := setWithPowerShell(rootPath, name); psErr != nil {
+		return fmt.Errorf("%w (Set-Volume fallback: %v)", err, psErr)
+	}
+	return nil
+}
+
+// setWithPowerShell sets a volume's label with Set-Volume.
+func setWithPowerShell(rootPath, name string) error {
+	volume := "Get-Volume -Path " + psQuote(strings.TrimSuffix(rootPath, `\`)+`\`)
+	if letter := strings.TrimSuffix(rootPath, `\`); len(letter) == 2 && letter[1] == ':' {
+		volume = "Get-Volume -DriveLetter " + letter[:1]
+	}
+	script := "$ErrorActionPreference = 'Stop'; " + volume +
+		" | Set-Volume -NewFileSystemLabel " + psQuote(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), powershellTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "powershell.exe",
+		"-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	if err != nil {
+		if msg := firstLine(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// psQuote quotes s as a PowerShell single-quoted string.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// firstLine returns the first non-empty line of s, trimmed.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+// Package label builds volume labels from templates, so a batch of drives
+// gets distinct, predictable labels in one run.
+package label
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Template fields
+const (
+	FieldIndex  = "n"      // Drive's number in the batch; {n:03} pads to 3 digits
+	FieldSerial = "serial" // Serial number; {serial:6} keeps its last 6 characters
+	FieldPort   = "port"   // Hub port number
+	FieldDisk   = "disk"   // Disk number
+	FieldDate   = "date"   // Today as YYYYMMDD
+)
+
+// Template is a parsed label template such as "KIOSK_{n:03}". Literal
+// braces are written doubled ("{{" and "}}").
+type Template struct {
+	parts []part
+}
+
+// part is a literal or a field of a template.
+type part struct {
+	literal string
+	field   string
+	width   int // Zero padding of {n}, characters kept of {serial}
+}
+
+// Drive is what a template's fields are filled in from.
+type Drive struct {
+	Index      int
+	Serial     string
+	Port       string
+	DiskNumber int
+}
+
+// Parse parses a label template.
+func Parse(s string) (*Template, error) {
+	t := &Template{}
+	var literal strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '{' && i+1 < len(s) && s[i+1] == '{', c == '}' && i+1 < len(s) && s[i+1] == '}':
+			literal.WriteByte(c)
+			i++
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("label template %q: unclosed {", s)
+			}
+			p, err := parseField(s[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("label template %q: %w", s, err)
+			}
+			if literal.Len() > 0 {
+				t.parts = append(t.parts, part{literal: literal.String()})
+				literal.Reset()
+			}
+			t.parts = append(t.parts, p)
+			i += end
+		case c == '}':
+			return nil, fmt.Errorf("label template %q: unexpected } (write }} for a brace)", s)
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	if literal.Len() > 0 {
+		t.parts = append(t.parts, part{literal: literal.String()})
+	}
+	return t, nil
+}
+
+// parseField parses the inside of a {field} or {field:arg}.
+func parseField(s string) (part, error) {
+	name, arg, hasArg := strings.Cut(s, ":")
+	p := part{field: name}
+	switch name {
+	case FieldIndex, FieldSerial:
+		if hasArg {
+			width, err := strconv.Atoi(arg)
+			if err != nil || width < 1 || width > 32 {
+				return part{}, fmt.Errorf("invalid width in {%s}", s)
+			}
+			p.width = width
+		}
+	case FieldPort, FieldDisk, FieldDate:
+		if hasArg {
+			return part{}, fmt.Errorf("{%s} takes no argument", name)
+		}
+	default:
+		return part{}, fmt.Errorf("unknown field {%s}: use n, serial, port, disk or date", name)
+	}
+	return p, nil
+}
+
+// IsStatic reports whether the template has no fields, so every drive gets
+// the same label.
+func (t *Template) IsStatic() bool {
+	for _, p := range t.parts {
+		if p.field != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Uses reports whether the template refers to a field.
+func (t *Template) Uses(field string) bool {
+	for _, p := range t.parts {
+		if p.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Render fills in the template for a drive, with {date} taken from now.
+func (t *Template) Render(d Drive, now time.Time) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case FieldIndex:
+			b.WriteString(fmt.Sprintf("%0*d", p.width, d.Index))
+		case FieldSerial:
+			serial := strings.TrimSpace(d.Serial)
+			if p.width > 0 && len(serial) > p.width {
+				serial = serial[len(serial)-p.width:]
+			}
+			b.WriteString(serial)
+		case FieldPort:
+			b.WriteString(d.Port)
+		case FieldDisk:
+			b.WriteString(strconv.Itoa(d.DiskNumber))
+		case FieldDate:
+			b.WriteString(now.Format("20060102"))
+		}
+	}
+	return b.String()
+}
+
+// MaxLength returns the longest label a file system allows: 11 characters
+// for FAT and exFAT, 16 for ext, 32 for NTFS, ReFS and UDF. Unknown file
+// systems get FAT's limit.
+func MaxLength(fileSystem string) int {
+	switch strings.ToLower(fileSystem) {
+	case "ntfs", "refs", "udf":
+		return 32
+	case "ext2", "ext3", "ext4":
+		return 16
+	}
+	return 11
+}
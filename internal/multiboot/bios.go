@@ -0,0 +1,54 @@
+package multiboot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/iso"
+	"golang.org/x/sys/windows"
+)
+
+// ErrNoBIOSCore is returned by InstallBIOSBoot when the GRUB bundle has no
+// i386-pc core.img, so only UEFI boot is possible.
+var ErrNoBIOSCore = errors.New("GRUB bundle has no boot/grub/i386-pc/core.img")
+
+// InstallBIOSBoot writes the GRUB2 MBR boot code and the bundle's core.img
+// to the disk so legacy BIOS machines can boot it. core.img must have been
+// built with its prefix set to (hd0,msdos1)/boot/grub.
+func InstallBIOSBoot(diskNumber int, grubDir string) error {
+	core, err := os.ReadFile(filepath.Join(grubDir, "boot", "grub", "i386-pc", "core.img"))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNoBIOSCore
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read core.img: %w", err)
+	}
+
+	handle, err := disk.OpenPhysicalDisk(diskNumber)
+	if err != nil {
+		return fmt.Errorf("open disk: %w", err)
+	}
+	defer windows.CloseHandle(handle)
+
+	layout, err := disk.GetDriveLayout(handle)
+	if err != nil {
+		return fmt.Errorf("read partition table: %w", err)
+	}
+	var gap int64
+	for _, p := range layout.Partitions {
+		if p.Length > 0 && (gap == 0 || p.StartingOffset/512-1 < gap) {
+			gap = p.StartingOffset/512 - 1
+		}
+	}
+	if gap <= 0 {
+		return errors.New("disk has no partitions")
+	}
+
+	if err := iso.WriteGRUBCore(handle, core, gap); err != nil {
+		return err
+	}
+	return iso.WriteMBR(handle, iso.BootloaderGRUB2)
+}
@@ -0,0 +1,358 @@
+// Package multiboot turns a formatted USB drive into a multi-ISO boot drive:
+// ISOs are copied into a catalog kept on the drive itself, and a GRUB2 menu
+// that loop-mounts each of them is regenerated whenever the catalog changes.
+package multiboot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kdomanski/iso9660"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/iso"
+)
+
+// Layout of a multiboot drive, relative to its root.
+const (
+	catalogDir  = "multiboot"
+	catalogFile = "multiboot/catalog.json"
+	isoDir      = "multiboot/isos"
+	grubConfig  = "boot/grub/grub.cfg"
+
+	catalogVersion = 1
+)
+
+// Boot methods recorded for each ISO.
+const (
+	// BootLoopback uses the ISO's /boot/grub/loopback.cfg, the convention
+	// Ubuntu, Debian live, Kali, Mint and many others follow.
+	BootLoopback = "loopback"
+	// BootGRUBConfig loads the ISO's own /boot/grub/grub.cfg from the loop
+	// device; works for ISOs whose menu finds its files relative to $root.
+	BootGRUBConfig = "grub"
+	// BootUnsupported ISOs (e.g. Windows setup) can't boot from a loop
+	// device and are kept in the catalog but left out of the menu.
+	BootUnsupported = "unsupported"
+)
+
+// ErrNotMultiboot is returned when a drive has no multiboot catalog.
+var ErrNotMultiboot = errors.New("not a multiboot drive (run 'wusbkit multiboot init' first)")
+
+// Catalog is the list of ISOs on a multiboot drive, stored as
+// \multiboot\catalog.json.
+type Catalog struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// Entry is one ISO in the catalog.
+type Entry struct {
+	Name  string    `json:"name"` // Menu title
+	File  string    `json:"file"` // File name under \multiboot\isos
+	Size  int64     `json:"size"`
+	OS    string    `json:"os,omitempty"`
+	Label string    `json:"label,omitempty"`
+	Boot  string    `json:"boot"`
+	Added time.Time `json:"added"`
+}
+
+// Init prepares a freshly formatted drive at root: it creates the catalog
+// and, if grubDir is set, copies a GRUB2 bundle (EFI/BOOT/BOOTX64.EFI,
+// boot/grub/...) onto the drive. The bundle is not shipped with wusbkit.
+func Init(root, grubDir string) error {
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(catalogFile))); err == nil {
+		return fmt.Errorf("%s is already a multiboot drive", root)
+	}
+	if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(isoDir)), 0o755); err != nil {
+		return fmt.Errorf("failed to create catalog directory: %w", err)
+	}
+
+	if grubDir != "" {
+		if err := copyDir(grubDir, root); err != nil {
+			return fmt.Errorf("failed to install GRUB bundle: %w", err)
+		}
+	}
+
+	catalog := &Catalog{Version: catalogVersion, Entries: []Entry{}}
+	if err := saveCatalog(root, catalog); err != nil {
+		return err
+	}
+	return writeGrubConfig(root, catalog)
+}
+
+// HasEFILoader reports whether the drive at root has a UEFI boot loader.
+func HasEFILoader(root string) bool {
+	_, err := os.Stat(filepath.Join(root, "EFI", "BOOT", "BOOTX64.EFI"))
+	return err == nil
+}
+
+// Load reads the catalog of the multiboot drive at root.
+func Load(root string) (*Catalog, error) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(catalogFile)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotMultiboot
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("corrupt catalog %s: %w", catalogFile, err)
+	}
+	if catalog.Entries == nil {
+		catalog.Entries = []Entry{}
+	}
+	return &catalog, nil
+}
+
+// Add copies an ISO onto the drive, records it in the catalog and
+// regenerates the boot menu. name overrides the menu title, which defaults
+// to the detected OS or the file name.
+func Add(ctx context.Context, root, isoPath, name string, onProgress func(done, total int64)) (*Entry, error) {
+	catalog, err := Load(root)
+	if err != nil {
+		return nil, err
+	}
+
+	file := filepath.Base(isoPath)
+	for _, e := range catalog.Entries {
+		if strings.EqualFold(e.File, file) {
+			return nil, fmt.Errorf("%s is already on the drive", file)
+		}
+	}
+
+	entry, err := describeISO(ctx, isoPath)
+	if err != nil {
+		return nil, err
+	}
+	entry.File = file
+	entry.Added = time.Now().UTC()
+	if name != "" {
+		entry.Name = name
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(isoDir), file)
+	if err := copyFile(ctx, isoPath, target, onProgress); err != nil {
+		os.Remove(target)
+		return nil, err
+	}
+
+	catalog.Entries = append(catalog.Entries, *entry)
+	sort.Slice(catalog.Entries, func(i, j int) bool {
+		return strings.ToLower(catalog.Entries[i].Name) < strings.ToLower(catalog.Entries[j].Name)
+	})
+	if err := saveCatalog(root, catalog); err != nil {
+		return nil, err
+	}
+	return entry, writeGrubConfig(root, catalog)
+}
+
+// Remove deletes the ISOs matching query (menu title or file name) from the
+// drive and the catalog, returning the removed entries.
+func Remove(root, query string) ([]Entry, error) {
+	catalog, err := Load(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept, removed []Entry
+	for _, e := range catalog.Entries {
+		if strings.EqualFold(e.File, query) || strings.EqualFold(e.Name, query) {
+			removed = append(removed, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, fmt.Errorf("no ISO named %q on the drive", query)
+	}
+
+	for _, e := range removed {
+		err := os.Remove(filepath.Join(root, filepath.FromSlash(isoDir), e.File))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to delete %s: %w", e.File, err)
+		}
+	}
+
+	catalog.Entries = kept
+	if err := saveCatalog(root, catalog); err != nil {
+		return nil, err
+	}
+	return removed, writeGrubConfig(root, catalog)
+}
+
+// describeISO inspects an ISO for its OS, label and how GRUB can boot it.
+func describeISO(ctx context.Context, isoPath string) (*Entry, error) {
+	info, err := flash.InspectImage(ctx, isoPath, flash.InspectOptions{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if info.Format != flash.ImageFormatISO9660 {
+		return nil, fmt.Errorf("%s is not an ISO image", filepath.Base(isoPath))
+	}
+
+	entry := &Entry{
+		Name:  info.OS,
+		Size:  info.Size,
+		OS:    info.OS,
+		Label: info.VolumeLabel,
+		Boot:  BootUnsupported,
+	}
+	if entry.Name == "" {
+		entry.Name = strings.TrimSuffix(filepath.Base(isoPath), filepath.Ext(isoPath))
+	}
+
+	f, err := os.Open(isoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ISO: %w", err)
+	}
+	defer f.Close()
+
+	img, err := iso9660.OpenImage(f)
+	if err != nil {
+		return entry, nil
+	}
+	rootDir, err := img.RootDir()
+	if err != nil {
+		return entry, nil
+	}
+	switch {
+	case iso.LookupPath(rootDir, "boot/grub/loopback.cfg") != nil:
+		entry.Boot = BootLoopback
+	case iso.LookupPath(rootDir, "boot/grub/grub.cfg") != nil:
+		entry.Boot = BootGRUBConfig
+	}
+	return entry, nil
+}
+
+// saveCatalog writes the catalog atomically so a yanked drive never ends
+// up with a half-written file.
+func saveCatalog(root string, catalog *Catalog) error {
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(root, filepath.FromSlash(catalogFile))
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	return nil
+}
+
+// writeGrubConfig regenerates the GRUB menu from the catalog.
+func writeGrubConfig(root string, catalog *Catalog) error {
+	var b strings.Builder
+	b.WriteString("# Generated by wusbkit multiboot; rewritten on every add/remove.\n")
+	b.WriteString("set timeout=10\nset default=0\n\n")
+	for _, mod := range []string{"part_msdos", "fat", "exfat", "ntfs", "iso9660", "loopback"} {
+		fmt.Fprintf(&b, "insmod %s\n", mod)
+	}
+
+	for _, e := range catalog.Entries {
+		isoFile := path.Join("/", isoDir, e.File)
+		title := strings.ReplaceAll(e.Name, `"`, `'`)
+		b.WriteString("\n")
+		switch e.Boot {
+		case BootLoopback, BootGRUBConfig:
+			cfg := "/boot/grub/loopback.cfg"
+			if e.Boot == BootGRUBConfig {
+				cfg = "/boot/grub/grub.cfg"
+			}
+			fmt.Fprintf(&b, "menuentry \"%s\" {\n", title)
+			fmt.Fprintf(&b, "\tset iso_path=\"%s\"\n\texport iso_path\n", isoFile)
+			b.WriteString("\tloopback loop $iso_path\n\tset root=(loop)\n")
+			fmt.Fprintf(&b, "\tconfigfile %s\n}\n", cfg)
+		default:
+			fmt.Fprintf(&b, "# %s (%s) can't be booted from a loop device\n", title, e.File)
+		}
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(grubConfig))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to write boot menu: %w", err)
+	}
+	if err := os.WriteFile(target, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write boot menu: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies src to dst, reporting progress and honouring ctx.
+func copyFile(ctx context.Context, src, dst string, onProgress func(done, total int64)) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open ISO: %w", err)
+	}
+	defer in.Close()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+
+	buf := make([]byte, 4<<20)
+	var done int64
+	for {
+		if err := ctx.Err(); err != nil {
+			out.Close()
+			return err
+		}
+		n, readErr := in.Read(buf)
+		if n > 0 {
+			if _, err := out.Write(buf[:n]); err != nil {
+				out.Close()
+				return fmt.Errorf("failed to copy ISO: %w", err)
+			}
+			done += int64(n)
+			if onProgress != nil {
+				onProgress(done, stat.Size())
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			out.Close()
+			return fmt.Errorf("failed to read ISO: %w", readErr)
+		}
+	}
+	return out.Close()
+}
+
+// copyDir copies the contents of src into dst, merging with what's there.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		return copyFile(context.Background(), p, target, nil)
+	})
+}
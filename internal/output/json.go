@@ -23,6 +23,20 @@ func PrintJSONError(message string, code string) {
 	fmt.Fprintln(os.Stderr, string(data))
 }
 
+// PrintJSONErrorDetails outputs an error as JSON to stderr, with extra fields
+// alongside the message and code
+func PrintJSONErrorDetails(message string, code string, details map[string]interface{}) {
+	errObj := map[string]interface{}{
+		"error": message,
+		"code":  code,
+	}
+	for k, v := range details {
+		errObj[k] = v
+	}
+	data, _ := json.Marshal(errObj)
+	fmt.Fprintln(os.Stderr, string(data))
+}
+
 // Error codes
 const (
 	ErrCodeUSBNotFound   = "USB_NOT_FOUND"
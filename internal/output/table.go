@@ -1,10 +1,25 @@
 package output
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/flash"
+	"github.com/lazaroagomez/wusbkit/internal/iso"
 	"github.com/lazaroagomez/wusbkit/internal/usb"
 	"github.com/pterm/pterm"
 )
 
+// Capacity bars: their width, and the percentages used from which a volume
+// is shown as filling up (yellow) and nearly full (red)
+const (
+	capacityBarWidth    = 10
+	capacityWarnPercent = 75
+	capacityFullPercent = 90
+)
+
 // PrintDevicesTable prints a table of USB devices
 func PrintDevicesTable(devices []usb.Device, verbose bool) {
 	if len(devices) == 0 {
@@ -21,21 +36,25 @@ func PrintDevicesTable(devices []usb.Device, verbose bool) {
 
 func printSimpleTable(devices []usb.Device) {
 	tableData := pterm.TableData{
-		{"Drive", "Name", "Size", "Status"},
+		{"Drive", "Name", "Size", "Used", "Status"},
 	}
 
 	for _, d := range devices {
-		drive := d.DriveLetter
-		if drive == "" {
-			drive = "(no letter)"
-		}
+		drive := formatDriveLetters(d)
 
-		status := formatStatus(d.HealthStatus)
+		status := formatDeviceStatus(d)
+		if d.WriteProtected || d.ReadOnly {
+			status += " (" + formatProtect(d) + ")"
+		}
+		if d.BitLocker == usb.BitLockerLocked {
+			status += " (" + pterm.Yellow("BitLocker locked") + ")"
+		}
 
 		tableData = append(tableData, []string{
 			drive,
 			d.FriendlyName,
 			d.SizeHuman,
+			formatVolumesUsage(d),
 			status,
 		})
 	}
@@ -45,14 +64,11 @@ func printSimpleTable(devices []usb.Device) {
 
 func printVerboseTable(devices []usb.Device) {
 	tableData := pterm.TableData{
-		{"Drive", "Name", "Size", "Serial", "VID:PID", "Port", "FS", "Partition", "Status"},
+		{"Drive", "Name", "Size", "Used", "Serial", "VID:PID", "Port", "Link", "FS", "Partition", "Protect", "Status"},
 	}
 
 	for _, d := range devices {
-		drive := d.DriveLetter
-		if drive == "" {
-			drive = "(no letter)"
-		}
+		drive := formatDriveLetters(d)
 
 		vidPid := ""
 		if d.VendorID != "" && d.ProductID != "" {
@@ -64,22 +80,25 @@ func printVerboseTable(devices []usb.Device) {
 			port = "-"
 		}
 
-		fs := d.FileSystem
-		if fs == "" {
-			fs = "-"
-		}
+		fs := formatFileSystems(d)
 
-		status := formatStatus(d.HealthStatus)
+		status := formatDeviceStatus(d)
+		if d.WriteProtected || d.ReadOnly {
+			status += " (" + formatProtect(d) + ")"
+		}
 
 		tableData = append(tableData, []string{
 			drive,
 			d.FriendlyName,
 			d.SizeHuman,
+			formatVolumesUsage(d),
 			d.SerialNumber,
 			vidPid,
 			port,
+			formatLink(d),
 			fs,
 			d.PartitionStyle,
+			formatProtect(d),
 			status,
 		})
 	}
@@ -121,9 +140,17 @@ func PrintDeviceInfo(device *usb.Device) {
 		[]string{"Volume Label", valueOrDash(device.VolumeLabel)},
 		[]string{"Partition Style", device.PartitionStyle},
 		[]string{"Bus Type", device.BusType},
+		[]string{"USB Version", valueOrDash(device.USBVersion)},
+		[]string{"Link", formatLink(*device)},
+		[]string{"Write Protect", formatProtect(*device)},
+		[]string{"BitLocker", formatBitLocker(device.BitLocker)},
+		[]string{"Removal Policy", FormatRemovalPolicy(device.RemovalPolicy)},
 		[]string{"Health Status", formatStatus(device.HealthStatus)},
 		[]string{"Status", device.Status},
 	)
+	if device.Smart != nil {
+		pairs = append(pairs, []string{"Health Data", device.Smart.String()})
+	}
 
 	tableData := pterm.TableData{}
 	for _, pair := range pairs {
@@ -131,6 +158,108 @@ func PrintDeviceInfo(device *usb.Device) {
 	}
 
 	pterm.DefaultTable.WithData(tableData).Render()
+
+	if len(device.Volumes) > 0 {
+		pterm.Println()
+		volumeData := pterm.TableData{{"Drive", "File System", "Label", "Size", "Used", "Free"}}
+		for _, v := range device.Volumes {
+			fs := valueOrDash(v.FileSystem)
+			if v.BitLocker != "" {
+				fs += " (BitLocker " + formatBitLocker(v.BitLocker) + ")"
+			}
+			volumeData = append(volumeData, []string{
+				v.DriveLetter,
+				fs,
+				valueOrDash(v.Label),
+				usb.FormatSize(v.Size),
+				formatUsage(v),
+				usb.FormatSize(v.FreeSpace),
+			})
+		}
+		pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(volumeData).Render()
+	}
+}
+
+// PrintSmartInfo prints a drive's health data and SMART attribute table
+func PrintSmartInfo(diskNumber int, info *disk.SmartInfo) {
+	pterm.DefaultSection.Printf("Disk %d health\n", diskNumber)
+
+	pairs := [][]string{{"Source", info.Source}}
+	if info.Temperature != nil {
+		pairs = append(pairs, []string{"Temperature", pterm.Sprintf("%d°C", *info.Temperature)})
+	}
+	if info.PowerOnHours != nil {
+		pairs = append(pairs, []string{"Power-On Hours", pterm.Sprintf("%d", *info.PowerOnHours)})
+	}
+	if info.PowerCycles != nil {
+		pairs = append(pairs, []string{"Power Cycles", pterm.Sprintf("%d", *info.PowerCycles)})
+	}
+	if info.WearPercent != nil {
+		pairs = append(pairs, []string{"Wear", pterm.Sprintf("%d%% of rated endurance used", *info.WearPercent)})
+	}
+	if info.ReallocatedSectors != nil {
+		pairs = append(pairs, []string{"Reallocated Sectors", pterm.Sprintf("%d", *info.ReallocatedSectors)})
+	}
+	pterm.DefaultTable.WithData(pterm.TableData(pairs)).Render()
+
+	if len(info.Attributes) == 0 {
+		return
+	}
+	tableData := pterm.TableData{
+		{"ID", "Attribute", "Current", "Worst", "Raw"},
+	}
+	for _, a := range info.Attributes {
+		tableData = append(tableData, []string{
+			pterm.Sprintf("%d", a.ID),
+			valueOrDash(a.Name),
+			pterm.Sprintf("%d", a.Current),
+			pterm.Sprintf("%d", a.Worst),
+			pterm.Sprintf("%d", a.Raw),
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(tableData).Render()
+}
+
+// deviceEventFormat lays out the columns of PrintDeviceEvent rows
+const deviceEventFormat = "%-8s  %-9s  %-4s  %-5s  %-4s  %-20s  %s\n"
+
+// PrintDeviceEventHeader prints the column headings of the rows
+// PrintDeviceEvent prints as drives come and go
+func PrintDeviceEventHeader() {
+	pterm.Print(pterm.Bold.Sprintf(deviceEventFormat, "Time", "Event", "Disk", "Drive", "Port", "Serial", "Name"))
+}
+
+// PrintDeviceEvent prints a drive being plugged in or removed, or media
+// going in or out of one, as a table row
+func PrintDeviceEvent(ev usb.Event) {
+	event := pterm.Green(pterm.Sprintf("%-9s", "Plugged"))
+	switch ev.Type {
+	case usb.EventRemoval:
+		event = pterm.Red(pterm.Sprintf("%-9s", "Removed"))
+	case usb.EventMediaArrival:
+		event = pterm.Green(pterm.Sprintf("%-9s", "Media in"))
+	case usb.EventMediaRemoval:
+		event = pterm.Red(pterm.Sprintf("%-9s", "Media out"))
+	}
+	d := ev.Device
+	pterm.Printf(strings.Replace(deviceEventFormat, "%-9s", "%s", 1),
+		ev.Time.Format("15:04:05"),
+		event,
+		strconv.Itoa(d.DiskNumber),
+		valueOrDash(d.DriveLetter),
+		valueOrDash(ev.Port),
+		valueOrDash(strings.TrimSpace(d.SerialNumber)),
+		d.FriendlyName+" - "+d.SizeHuman,
+	)
+}
+
+// formatDeviceStatus is a device's status column: its health, or "No
+// Media" for an empty card reader
+func formatDeviceStatus(d usb.Device) string {
+	if !d.HasMedia() {
+		return pterm.Gray(usb.StatusNoMedia)
+	}
+	return formatStatus(d.HealthStatus)
 }
 
 func formatStatus(status string) string {
@@ -146,9 +275,252 @@ func formatStatus(status string) string {
 	}
 }
 
+// formatProtect describes what stops writes to a device, if anything
+func formatProtect(d usb.Device) string {
+	switch {
+	case d.WriteProtected:
+		return pterm.Red("Switch")
+	case d.ReadOnly:
+		return pterm.Yellow("Read-only")
+	default:
+		return "-"
+	}
+}
+
+// formatLink shows a device's negotiated link speed, e.g. "5G UASP". USB 3
+// devices running at a lower speed are highlighted, as they are usually in
+// a USB 2.0 port or on a USB 2.0 cable.
+func formatLink(d usb.Device) string {
+	var speed string
+	switch {
+	case d.LinkSpeedMbps == 0:
+		return "-"
+	case d.LinkSpeedMbps == 1:
+		speed = "1.5M"
+	case d.LinkSpeedMbps >= 1000:
+		speed = strconv.Itoa(d.LinkSpeedMbps/1000) + "G"
+	default:
+		speed = strconv.Itoa(d.LinkSpeedMbps) + "M"
+	}
+	if d.UASP {
+		speed += " UASP"
+	}
+	if d.LinkSpeedMbps < 5000 && d.USBVersion >= "3" {
+		return pterm.Yellow(speed + " (USB 3 device)")
+	}
+	return speed
+}
+
+// formatDriveLetters lists the drive letters of a device's volumes
+func formatDriveLetters(d usb.Device) string {
+	if len(d.Volumes) == 0 {
+		if d.DriveLetter != "" {
+			return d.DriveLetter
+		}
+		return "(no letter)"
+	}
+	letters := make([]string, len(d.Volumes))
+	for i, v := range d.Volumes {
+		letters[i] = v.DriveLetter
+	}
+	return strings.Join(letters, ", ")
+}
+
+// formatFileSystems lists the file systems of a device's volumes, in the
+// order of formatDriveLetters
+func formatFileSystems(d usb.Device) string {
+	if len(d.Volumes) == 0 {
+		return valueOrDash(d.FileSystem)
+	}
+	names := make([]string, len(d.Volumes))
+	for i, v := range d.Volumes {
+		switch v.BitLocker {
+		case usb.BitLockerLocked:
+			names[i] = pterm.Yellow("BitLocker locked")
+		case usb.BitLockerUnlocked:
+			names[i] = valueOrDash(v.FileSystem) + " (BitLocker)"
+		default:
+			names[i] = valueOrDash(v.FileSystem)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// formatVolumesUsage shows how full each of a device's volumes is, one
+// line per volume
+func formatVolumesUsage(d usb.Device) string {
+	if len(d.Volumes) == 0 {
+		return "-"
+	}
+	lines := make([]string, len(d.Volumes))
+	for i, v := range d.Volumes {
+		lines[i] = formatUsage(v)
+		if len(d.Volumes) > 1 {
+			lines[i] = v.DriveLetter + " " + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatUsage shows how full a volume is as a capacity bar, the percentage
+// used and the space left. Nearly full volumes are highlighted.
+func formatUsage(v usb.Volume) string {
+	if v.Size <= 0 {
+		return "-"
+	}
+	percent := int(v.UsedSpace * 100 / v.Size)
+	filled := min((percent*capacityBarWidth+50)/100, capacityBarWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", capacityBarWidth-filled)
+	switch {
+	case percent >= capacityFullPercent:
+		bar = pterm.Red(bar)
+	case percent >= capacityWarnPercent:
+		bar = pterm.Yellow(bar)
+	default:
+		bar = pterm.Green(bar)
+	}
+	return pterm.Sprintf("%s %3d%% (%s free)", bar, percent, usb.FormatSize(v.FreeSpace))
+}
+
+// formatBitLocker describes a device's BitLocker state
+func formatBitLocker(state string) string {
+	switch state {
+	case usb.BitLockerLocked:
+		return pterm.Yellow("Locked")
+	case usb.BitLockerUnlocked:
+		return "Unlocked"
+	default:
+		return "-"
+	}
+}
+
+// FormatRemovalPolicy describes a removal policy the way Device Manager does
+func FormatRemovalPolicy(policy string) string {
+	switch policy {
+	case usb.RemovalPolicyQuick:
+		return "Quick removal"
+	case usb.RemovalPolicyPerformance:
+		return "Better performance"
+	case usb.RemovalPolicyFixed:
+		return "Not removable"
+	default:
+		return "-"
+	}
+}
+
 func valueOrDash(s string) string {
 	if s == "" {
 		return "-"
 	}
 	return s
 }
+
+// PrintImageInfo prints the result of inspecting an image
+func PrintImageInfo(info *flash.ImageInfo) {
+	pterm.DefaultSection.Println(info.Name)
+
+	size := "unknown"
+	if info.Size != flash.SizeUnknown {
+		size = pterm.Sprintf("%s (%d bytes)", flash.FormatBytes(info.Size), info.Size)
+	}
+	tableData := pterm.TableData{
+		{"Size", size},
+		{"Format", info.Format},
+	}
+	if info.PartitionTable != "" {
+		tableData = append(tableData, []string{"Partition Table", strings.ToUpper(info.PartitionTable)})
+	}
+	if info.Filesystem != "" {
+		tableData = append(tableData, []string{"File System", info.Filesystem})
+	}
+	tableData = append(tableData,
+		[]string{"Volume Label", valueOrDash(info.VolumeLabel)},
+		[]string{"Detected OS", valueOrDash(info.OS)},
+	)
+	pterm.DefaultTable.WithData(tableData).Render()
+
+	if len(info.Partitions) > 0 {
+		pterm.Println()
+		partData := pterm.TableData{{"#", "Type", "Offset", "Size", "File System", "Label", "Boot"}}
+		for _, p := range info.Partitions {
+			partType := p.Type
+			if p.TypeName != "" {
+				partType = p.TypeName
+			}
+			label := p.Label
+			if label == "" {
+				label = p.Name
+			}
+			boot := ""
+			if p.Bootable {
+				boot = "*"
+			}
+			partData = append(partData, []string{
+				pterm.Sprintf("%d", p.Number),
+				partType,
+				flash.FormatBytes(p.Offset),
+				flash.FormatBytes(p.Size),
+				valueOrDash(p.Filesystem),
+				valueOrDash(label),
+				boot,
+			})
+		}
+		pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(partData).Render()
+	}
+
+	if len(info.Hashes) > 0 {
+		pterm.Println()
+		algos := make([]string, 0, len(info.Hashes))
+		for algo := range info.Hashes {
+			algos = append(algos, algo)
+		}
+		sort.Strings(algos)
+		for _, algo := range algos {
+			pterm.Info.Printfln("%s: %s", strings.ToUpper(algo), info.Hashes[algo])
+		}
+	}
+
+	for _, w := range info.Warnings {
+		pterm.Warning.Println(w)
+	}
+}
+
+// PrintMBRInfo prints the boot code and partition table of a disk's MBR
+func PrintMBRInfo(diskNumber int, info *iso.MBRInfo) {
+	pterm.DefaultSection.Printfln("Disk %d boot sector", diskNumber)
+
+	signature := pterm.Green("0x55AA")
+	if !info.ValidSignature {
+		signature = pterm.Red("missing")
+	}
+	style := "MBR"
+	if info.GPT {
+		style = "GPT (protective MBR)"
+	}
+	tableData := pterm.TableData{
+		{"Boot Code", info.BootCode},
+		{"Boot Signature", signature},
+		{"Disk Signature", info.DiskSignature},
+		{"Partition Style", style},
+	}
+	pterm.DefaultTable.WithData(tableData).Render()
+
+	if len(info.Partitions) > 0 {
+		pterm.Println()
+		partData := pterm.TableData{{"Slot", "Active", "Type", "Start LBA", "Size"}}
+		for _, p := range info.Partitions {
+			active := ""
+			if p.Active {
+				active = "*"
+			}
+			partData = append(partData, []string{
+				pterm.Sprintf("%d", p.Slot),
+				active,
+				p.Type,
+				pterm.Sprintf("%d", p.StartLBA),
+				flash.FormatBytes(int64(p.Sectors) * 512),
+			})
+		}
+		pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(partData).Render()
+	}
+}
@@ -0,0 +1,311 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/lock"
+)
+
+const (
+	// diskLockTimeout is how long a target waits for another operation on
+	// the same disk to finish.
+	diskLockTimeout = 5 * time.Second
+
+	// timeoutGrace is how long an operation that ran out of time gets to
+	// notice its cancellation before it is abandoned.
+	timeoutGrace = 10 * time.Second
+)
+
+// errTimeout fails a target whose operation ran past the executor's
+// timeout. It isn't retried: a hung drive rarely recovers, and an abandoned
+// operation may still hold it.
+var errTimeout = permanentError{errors.New("timeout")}
+
+// target is one drive of a batch, named by disk number or, for labels, by
+// drive letter.
+type target struct {
+	diskNumber  int
+	driveLetter string // With the colon, e.g. "E:"
+}
+
+// batch describes an operation run on several drives by runAll.
+type batch struct {
+	operation     string // "format", "flash", "wipe", "label", "copy", "fsck", "eject" or "apply"
+	targets       []target
+	maxConcurrent int
+	stagger       time.Duration     // Delay between starting targets
+	progress      *progressReporter // Nil for operations without progress
+
+	// run performs the operation once on targets[idx]; attempt counts from
+	// 1. The returned result only needs its operation-specific fields set.
+	run func(ctx context.Context, idx, attempt int) (OperationResult, error)
+
+	// release, if set, is called once targets[idx] is done, however it
+	// ended, to free anything held for it.
+	release func(idx int)
+}
+
+// permanentError marks a failure that retrying can't fix.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// runAll runs a batch, emitting start and complete events per target and a
+// summary at the end. With fail-fast, the targets still running or waiting
+// are cancelled once more have failed than the executor allows.
+func (e *Executor) runAll(ctx context.Context, b batch) BatchResult {
+	sem := make(chan struct{}, b.maxConcurrent)
+	var wg sync.WaitGroup
+	results := make([]OperationResult, len(b.targets))
+
+	batchCtx, abort := context.WithCancel(ctx)
+	defer abort()
+	var mu sync.Mutex
+	failed := 0
+	aborted := false
+
+	for i := range b.targets {
+		// Stop waiting once cancelled or aborted; the remaining targets are
+		// still started so each reports as cancelled
+		if i > 0 && b.stagger > 0 {
+			select {
+			case <-batchCtx.Done():
+			case <-time.After(b.stagger):
+			}
+		}
+
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+
+			t := b.targets[idx]
+			result := e.runTarget(batchCtx, b, idx, sem)
+			result.DiskNumber = t.diskNumber
+			result.DriveLetter = t.driveLetter
+			if !result.Success {
+				mu.Lock()
+				if aborted && ctx.Err() == nil {
+					// Cancelled by the abort rather than failed in its own right
+					result.Error = "aborted after too many drives failed"
+				} else if failed++; e.failFast && failed > e.maxFailures {
+					aborted = true
+					abort()
+				}
+				mu.Unlock()
+			}
+			results[idx] = result
+
+			if b.release != nil {
+				b.release(idx)
+			}
+			if b.progress != nil {
+				b.progress.done(t.diskNumber, result.Success)
+			}
+
+			event := e.targetEvent("complete", b.operation, t)
+			event.Success = result.Success
+			event.Error = result.Error
+			event.Duration = result.Duration
+			event.WriteSpeed = result.WriteSpeed
+			event.Slow = result.Slow
+			event.Attempts = result.Attempts
+			event.Ejected = result.Ejected
+			event.BadClusters = result.BadClusters
+			event.Label = result.Label
+			event.PreviousLabel = result.PreviousLabel
+			event.Partitions = result.Partitions
+			event.Fsck = result.Fsck
+			e.emitEvent(event)
+
+			if e.after != nil {
+				e.after(result)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	if b.progress != nil {
+		b.progress.stop()
+	}
+	return e.summarize(results, aborted)
+}
+
+// runTarget runs the operation on one target once a concurrency slot is
+// free, retrying failures as the executor's retry policy allows.
+func (e *Executor) runTarget(ctx context.Context, b batch, idx int, sem chan struct{}) OperationResult {
+	t := b.targets[idx]
+	e.emitEvent(e.targetEvent("start", b.operation, t))
+
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return OperationResult{Success: false, Error: "cancelled"}
+	}
+
+	start := time.Now()
+	var result OperationResult
+	var err error
+	if e.before != nil {
+		if err := e.before(ctx, t.diskNumber); err != nil {
+			return OperationResult{
+				Success:  false,
+				Error:    err.Error(),
+				Duration: time.Since(start).String(),
+			}
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		result, err = e.attempt(ctx, b, idx, attempt)
+		if e.retries > 0 {
+			result.Attempts = attempt
+		}
+		var permanent permanentError
+		if err == nil || attempt > e.retries || ctx.Err() != nil || errors.As(err, &permanent) {
+			break
+		}
+
+		event := e.targetEvent("retry", b.operation, t)
+		event.Attempt = attempt + 1
+		event.Error = err.Error()
+		e.emitEvent(event)
+		if b.progress != nil {
+			b.progress.update(t.diskNumber, diskProgress{
+				Stage: fmt.Sprintf("Retry %d/%d in %s", attempt, e.retries, e.retryDelay),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(e.retryDelay):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err == nil && e.eject {
+		if b.progress != nil {
+			b.progress.update(t.diskNumber, diskProgress{Stage: "Ejecting", Percentage: 100})
+		}
+		if ejectErr := disk.EjectDisk(t.diskNumber); ejectErr != nil {
+			err = fmt.Errorf("%s succeeded, but eject failed: %w", b.operation, ejectErr)
+		} else {
+			result.Ejected = true
+		}
+	}
+
+	result.Success = err == nil
+	result.Error = errorString(err)
+	result.Duration = time.Since(start).String()
+	return result
+}
+
+// attempt runs the operation once on a target. With a timeout set, the
+// operation is cancelled once it runs out of time; if it doesn't return
+// within timeoutGrace (stuck in a driver call on a dying controller), it is
+// abandoned so the rest of the batch can finish.
+func (e *Executor) attempt(ctx context.Context, b batch, idx, attempt int) (OperationResult, error) {
+	if e.opTimeout <= 0 {
+		return b.run(ctx, idx, attempt)
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, e.opTimeout)
+	defer cancel()
+
+	type outcome struct {
+		result OperationResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := b.run(opCtx, idx, attempt)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil && ctx.Err() == nil && opCtx.Err() == context.DeadlineExceeded {
+			return o.result, errTimeout
+		}
+		return o.result, o.err
+	case <-opCtx.Done():
+	}
+
+	select {
+	case o := <-done:
+		if ctx.Err() != nil {
+			return o.result, o.err
+		}
+		return o.result, errTimeout
+	case <-time.After(timeoutGrace):
+		return OperationResult{}, errTimeout
+	}
+}
+
+// targetEvent returns an event of the given type naming a target.
+func (e *Executor) targetEvent(eventType, operation string, t target) ProgressEvent {
+	return ProgressEvent{
+		Type:        eventType,
+		DiskNumber:  t.diskNumber,
+		DriveLetter: t.driveLetter,
+		Operation:   operation,
+	}
+}
+
+// summarize totals a batch's results and emits the summary event.
+func (e *Executor) summarize(results []OperationResult, aborted bool) BatchResult {
+	batch := BatchResult{
+		Results: results,
+		Total:   len(results),
+		Aborted: aborted,
+	}
+	for _, r := range results {
+		if r.Success {
+			batch.Succeeded++
+		} else {
+			batch.Failed++
+		}
+		if r.Slow {
+			batch.SlowDrives++
+		}
+	}
+
+	e.emitEvent(ProgressEvent{
+		Type:       "summary",
+		Total:      batch.Total,
+		Succeeded:  batch.Succeeded,
+		Failed:     batch.Failed,
+		SlowDrives: batch.SlowDrives,
+		Aborted:    batch.Aborted,
+	})
+	return batch
+}
+
+// lockDisk takes a disk's lock, waiting briefly for an operation already
+// running on it, and returns the function that releases it.
+func lockDisk(ctx context.Context, diskNum int) (func(), error) {
+	diskLock, err := lock.NewDiskLock(diskNum)
+	if err != nil {
+		return nil, err
+	}
+	if err := diskLock.TryLock(ctx, diskLockTimeout); err != nil {
+		return nil, errors.New("disk busy")
+	}
+	return func() { diskLock.Unlock() }, nil
+}
+
+func targetsForDisks(disks []int) []target {
+	targets := make([]target, len(disks))
+	for i, d := range disks {
+		targets[i] = target{diskNumber: d}
+	}
+	return targets
+}
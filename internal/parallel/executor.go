@@ -3,61 +3,107 @@ package parallel
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"github.com/lazaroagomez/wusbkit/internal/files"
 	"github.com/lazaroagomez/wusbkit/internal/flash"
 	"github.com/lazaroagomez/wusbkit/internal/format"
-	"github.com/lazaroagomez/wusbkit/internal/lock"
+	"github.com/lazaroagomez/wusbkit/internal/fsck"
+	"github.com/lazaroagomez/wusbkit/internal/label"
 )
 
 // LabelOptions contains options for labeling drives
 type LabelOptions struct {
-	Label string
+	Label  string
+	Labels map[string]string // Per-drive labels by drive letter, overriding Label
 }
 
 // OperationResult represents the result of a single disk operation
 type OperationResult struct {
 	DiskNumber  int    `json:"diskNumber,omitempty"`
 	DriveLetter string `json:"driveLetter,omitempty"`
+	Serial      string `json:"serial,omitempty"` // Filled in for --report, to find the drive again
 	Success     bool   `json:"success"`
 	Error       string `json:"error,omitempty"`
 	Duration    string `json:"duration"`
+	WriteSpeed  string `json:"writeSpeed,omitempty"`  // Sustained write speed (flash only)
+	Slow        bool   `json:"slow,omitempty"`        // Below the minimum write speed
+	Attempts    int    `json:"attempts,omitempty"`    // Tries made, when retries are enabled
+	Ejected     bool   `json:"ejected,omitempty"`     // Ejected after succeeding, with SetEject
+	BadClusters *int64 `json:"badClusters,omitempty"` // Clusters that didn't read back (format --check only)
+
+	Label         string `json:"label,omitempty"`         // New label (label only)
+	PreviousLabel string `json:"previousLabel,omitempty"` // Label before the change (label only)
+
+	Partitions []flash.Partition `json:"partitions,omitempty"` // Layout after the rescan (flash only)
+	Fsck       *fsck.Result      `json:"fsck,omitempty"`       // Check result (fsck only)
 }
 
 // BatchResult represents the result of a batch operation
 type BatchResult struct {
-	Results   []OperationResult `json:"results"`
-	Total     int               `json:"total"`
-	Succeeded int               `json:"succeeded"`
-	Failed    int               `json:"failed"`
+	Results    []OperationResult `json:"results"`
+	Total      int               `json:"total"`
+	Succeeded  int               `json:"succeeded"`
+	Failed     int               `json:"failed"`
+	SlowDrives int               `json:"slowDrives,omitempty"`
+	Aborted    bool              `json:"aborted,omitempty"` // Stopped early by fail-fast
 }
 
 // ProgressEvent represents a progress event for NDJSON streaming
 type ProgressEvent struct {
-	Type        string `json:"type"`                  // "start", "progress", "complete", "summary"
+	Type        string `json:"type"`                  // "start", "progress", "retry", "complete", "summary"
 	DiskNumber  int    `json:"diskNumber,omitempty"`  // Only for disk-specific events
 	DriveLetter string `json:"driveLetter,omitempty"` // Only for drive-specific events (label)
-	Operation   string `json:"operation,omitempty"`   // "format", "flash", or "label"
+	Operation   string `json:"operation,omitempty"`   // "format", "flash", "wipe", "label", "copy", "fsck", "eject" or "apply"
 	Success     bool   `json:"success,omitempty"`
 	Error       string `json:"error,omitempty"`
 	Duration    string `json:"duration,omitempty"`
 	Percentage  int    `json:"percentage,omitempty"`
+	Stage       string `json:"stage,omitempty"`      // For progress events
+	Bytes       int64  `json:"bytes,omitempty"`      // Bytes done in the stage, for progress events
+	TotalBytes  int64  `json:"totalBytes,omitempty"` // For progress events
+	Speed       string `json:"speed,omitempty"`      // Current speed, for progress events
+	WriteSpeed  string `json:"writeSpeed,omitempty"`
+	Slow        bool   `json:"slow,omitempty"`
+	Attempt     int    `json:"attempt,omitempty"`     // Attempt about to start, for retry events
+	Attempts    int    `json:"attempts,omitempty"`    // Tries made, for complete events with retries enabled
+	Ejected     bool   `json:"ejected,omitempty"`     // For complete events with SetEject
+	BadClusters *int64 `json:"badClusters,omitempty"` // For format complete events with --check
+
+	Label         string `json:"label,omitempty"`         // New label, for label complete events
+	PreviousLabel string `json:"previousLabel,omitempty"` // Label before the change, for label complete events
+
+	Partitions []flash.Partition `json:"partitions,omitempty"` // Layout after the rescan, for flash complete events
+	Fsck       *fsck.Result      `json:"fsck,omitempty"`       // Check result, for fsck complete events
 	// For summary
-	Total     int `json:"total,omitempty"`
-	Succeeded int `json:"succeeded,omitempty"`
-	Failed    int `json:"failed,omitempty"`
+	Total      int  `json:"total,omitempty"`
+	Succeeded  int  `json:"succeeded,omitempty"`
+	Failed     int  `json:"failed,omitempty"`
+	SlowDrives int  `json:"slowDrives,omitempty"`
+	Aborted    bool `json:"aborted,omitempty"`
 }
 
 // Executor handles parallel format/flash operations
 type Executor struct {
 	maxConcurrent int
 	jsonOutput    bool
+	minWriteSpeed int64 // Bytes per second, 0 = no check
+	failSlow      bool
+	retries       int // Extra attempts per target after a failure
+	retryDelay    time.Duration
+	opTimeout     time.Duration // Time limit per attempt, 0 = none
+	failFast      bool
+	maxFailures   int // Failures tolerated before fail-fast aborts
+	eject         bool
+	before        func(ctx context.Context, diskNum int) error
+	after         func(result OperationResult)
 }
 
 // NewExecutor creates a new parallel executor
@@ -73,6 +119,53 @@ func NewExecutor(maxConcurrent int, jsonOutput bool) *Executor {
 	}
 }
 
+// SetMinWriteSpeed makes FlashAll check each drive's sustained write speed
+// against bytesPerSec. Slower drives are flagged as slow in the results, or
+// failed if fail is set. 0 disables the check.
+func (e *Executor) SetMinWriteSpeed(bytesPerSec int64, fail bool) {
+	e.minWriteSpeed = bytesPerSec
+	e.failSlow = fail
+}
+
+// SetRetries makes each target be tried up to retries more times after a
+// failure, waiting delay before each retry, so transient failures (a busy
+// disk, a device reset) don't fail the batch. Cancellation and slow drives
+// flagged by SetMinWriteSpeed aren't retried.
+func (e *Executor) SetRetries(retries int, delay time.Duration) {
+	e.retries = retries
+	e.retryDelay = delay
+}
+
+// SetOpTimeout limits each attempt at a target to timeout, so one hung drive
+// can't stall the batch: it is failed with a "timeout" error while the rest
+// carry on. 0 disables the limit.
+func (e *Executor) SetOpTimeout(timeout time.Duration) {
+	e.opTimeout = timeout
+}
+
+// SetFailFast makes the batch abort once more than maxFailures targets have
+// failed: targets still waiting are skipped and those in progress are
+// cancelled, all reported as aborted.
+func (e *Executor) SetFailFast(maxFailures int) {
+	e.failFast = true
+	e.maxFailures = maxFailures
+}
+
+// SetEject makes each disk be ejected once its operation succeeds. A disk
+// that then fails to eject is failed, so a drive left mounted is never
+// mistaken for a finished one.
+func (e *Executor) SetEject(eject bool) {
+	e.eject = eject
+}
+
+// SetHooks sets functions called around each disk's operation: before runs
+// once the disk's turn comes and fails the disk, without retries, if it
+// returns an error; after gets the disk's final result. Either may be nil.
+func (e *Executor) SetHooks(before func(ctx context.Context, diskNum int) error, after func(result OperationResult)) {
+	e.before = before
+	e.after = after
+}
+
 // emitEvent outputs a progress event as NDJSON if JSON output is enabled
 func (e *Executor) emitEvent(event ProgressEvent) {
 	if e.jsonOutput {
@@ -81,302 +174,335 @@ func (e *Executor) emitEvent(event ProgressEvent) {
 	}
 }
 
-// FormatAll formats multiple disks in parallel
-func (e *Executor) FormatAll(ctx context.Context, disks []int, opts format.Options) BatchResult {
-	sem := make(chan struct{}, e.maxConcurrent)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	results := make([]OperationResult, len(disks))
-
-	for i, disk := range disks {
-		wg.Add(1)
-		go func(idx, diskNum int) {
-			defer wg.Done()
-
-			// Emit start event
-			e.emitEvent(ProgressEvent{
-				Type:       "start",
-				DiskNumber: diskNum,
-				Operation:  "format",
-			})
-
-			// Acquire semaphore
-			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
-			case <-ctx.Done():
-				mu.Lock()
-				results[idx] = OperationResult{
-					DiskNumber: diskNum,
-					Success:    false,
-					Error:      "cancelled",
-				}
-				mu.Unlock()
-				e.emitEvent(ProgressEvent{
-					Type:       "complete",
-					DiskNumber: diskNum,
-					Operation:  "format",
-					Success:    false,
-					Error:      "cancelled",
-				})
-				return
-			}
-
-			start := time.Now()
-
-			// Acquire disk lock
-			diskLock, err := lock.NewDiskLock(diskNum)
+// FormatAll formats multiple disks in parallel. labels, if set, gives disks
+// their own labels in place of opts.Label.
+func (e *Executor) FormatAll(ctx context.Context, disks []int, opts format.Options, labels map[int]string) BatchResult {
+	progress := e.newProgressReporter(disks, "format")
+	return e.runAll(ctx, batch{
+		operation:     "format",
+		targets:       targetsForDisks(disks),
+		maxConcurrent: e.maxConcurrent,
+		progress:      progress,
+		run: func(ctx context.Context, idx, attempt int) (OperationResult, error) {
+			diskNum := disks[idx]
+			unlock, err := lockDisk(ctx, diskNum)
 			if err != nil {
-				result := OperationResult{
-					DiskNumber: diskNum,
-					Success:    false,
-					Error:      err.Error(),
-					Duration:   time.Since(start).String(),
-				}
-				mu.Lock()
-				results[idx] = result
-				mu.Unlock()
-				e.emitEvent(ProgressEvent{
-					Type:       "complete",
-					DiskNumber: diskNum,
-					Operation:  "format",
-					Success:    false,
-					Error:      err.Error(),
-					Duration:   result.Duration,
-				})
-				return
+				return OperationResult{}, err
 			}
-
-			if err := diskLock.TryLock(ctx, 5*time.Second); err != nil {
-				result := OperationResult{
-					DiskNumber: diskNum,
-					Success:    false,
-					Error:      "disk busy",
-					Duration:   time.Since(start).String(),
-				}
-				mu.Lock()
-				results[idx] = result
-				mu.Unlock()
-				e.emitEvent(ProgressEvent{
-					Type:       "complete",
-					DiskNumber: diskNum,
-					Operation:  "format",
-					Success:    false,
-					Error:      "disk busy",
-					Duration:   result.Duration,
-				})
-				return
-			}
-			defer diskLock.Unlock()
+			defer unlock()
 
 			// Create options copy with this disk number
 			diskOpts := opts
 			diskOpts.DiskNumber = diskNum
+			if l, ok := labels[diskNum]; ok {
+				diskOpts.Label = l
+			}
 
-			// Execute format
 			formatter := format.NewFormatter()
+			var badClusters *int64
+			drained := make(chan struct{})
 			go func() {
-				// Drain progress channel to prevent blocking
-				for range formatter.Progress() {
+				for p := range formatter.Progress() {
+					if p.Status == "complete" {
+						badClusters = p.BadClusters
+					}
+					if p.Status == "in_progress" {
+						progress.update(diskNum, diskProgress{Stage: p.Stage, Percentage: p.Percentage})
+					}
 				}
+				close(drained)
 			}()
 			err = formatter.Format(ctx, diskOpts)
+			<-drained
+			return OperationResult{BadClusters: badClusters}, err
+		},
+	})
+}
 
-			result := OperationResult{
-				DiskNumber: diskNum,
-				Success:    err == nil,
-				Error:      errorString(err),
-				Duration:   time.Since(start).String(),
+// FlashAll flashes the same image to multiple disks in parallel. When every
+// disk is flashed at once, the image is read and decompressed once and
+// shared between them (see flash.SharedSource), as is the image read back
+// to verify a local image.
+func (e *Executor) FlashAll(ctx context.Context, disks []int, opts flash.Options) BatchResult {
+	var shared, sharedVerify *flash.SharedSource
+	if len(disks) > 1 && len(disks) <= e.maxConcurrent {
+		var err error
+		if shared, err = flash.NewSharedSource(ctx, opts, len(disks)); err != nil {
+			return e.failAll(disks, "flash", err)
+		}
+		defer shared.Close()
+
+		// A URL would sit half-read while the drives are written, so it is
+		// downloaded again per drive to verify as before
+		if opts.Verify && !flash.IsURL(opts.ImagePath) {
+			verifyOpts := opts
+			verifyOpts.ExpectedHash = flash.ExpectedHash{}
+			if sharedVerify, err = flash.NewSharedSource(ctx, verifyOpts, len(disks)); err != nil {
+				return e.failAll(disks, "flash", err)
 			}
-
-			mu.Lock()
-			results[idx] = result
-			mu.Unlock()
-
-			e.emitEvent(ProgressEvent{
-				Type:       "complete",
-				DiskNumber: diskNum,
-				Operation:  "format",
-				Success:    err == nil,
-				Error:      errorString(err),
-				Duration:   result.Duration,
-			})
-		}(i, disk)
+			defer sharedVerify.Close()
+		}
 	}
 
-	wg.Wait()
-
-	// Build summary
-	batch := BatchResult{
-		Results: results,
-		Total:   len(disks),
-	}
-	for _, r := range results {
-		if r.Success {
-			batch.Succeeded++
-		} else {
-			batch.Failed++
+	// Shared readers are released however a disk ends so the others don't
+	// wait on it
+	releaseShared := func(idx int) {
+		if shared != nil {
+			shared.Reader(idx).Close()
+		}
+		if sharedVerify != nil {
+			sharedVerify.Reader(idx).Close()
 		}
 	}
 
-	// Emit summary event
-	e.emitEvent(ProgressEvent{
-		Type:      "summary",
-		Total:     batch.Total,
-		Succeeded: batch.Succeeded,
-		Failed:    batch.Failed,
-	})
-
-	return batch
-}
-
-// FlashAll flashes the same image to multiple disks in parallel
-func (e *Executor) FlashAll(ctx context.Context, disks []int, opts flash.Options) BatchResult {
-	sem := make(chan struct{}, e.maxConcurrent)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	results := make([]OperationResult, len(disks))
-
-	for i, disk := range disks {
-		wg.Add(1)
-		go func(idx, diskNum int) {
-			defer wg.Done()
-
-			// Emit start event
-			e.emitEvent(ProgressEvent{
-				Type:       "start",
-				DiskNumber: diskNum,
-				Operation:  "flash",
-			})
-
-			// Acquire semaphore
-			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
-			case <-ctx.Done():
-				mu.Lock()
-				results[idx] = OperationResult{
-					DiskNumber: diskNum,
-					Success:    false,
-					Error:      "cancelled",
+	progress := e.newProgressReporter(disks, "flash")
+	return e.runAll(ctx, batch{
+		operation:     "flash",
+		targets:       targetsForDisks(disks),
+		maxConcurrent: e.maxConcurrent,
+		progress:      progress,
+		release:       releaseShared,
+		run: func(ctx context.Context, idx, attempt int) (OperationResult, error) {
+			diskNum := disks[idx]
+
+			// Create options copy with this disk number. The shared readers
+			// only serve the first attempt; a retry reads the image itself.
+			diskOpts := opts
+			diskOpts.DiskNumber = diskNum
+			if attempt == 1 {
+				defer releaseShared(idx)
+				if shared != nil {
+					diskOpts.Source = shared.Reader(idx)
+				}
+				if sharedVerify != nil {
+					diskOpts.VerifySource = sharedVerify.Reader(idx)
 				}
-				mu.Unlock()
-				e.emitEvent(ProgressEvent{
-					Type:       "complete",
-					DiskNumber: diskNum,
-					Operation:  "flash",
-					Success:    false,
-					Error:      "cancelled",
-				})
-				return
 			}
 
-			start := time.Now()
-
-			// Acquire disk lock
-			diskLock, err := lock.NewDiskLock(diskNum)
+			unlock, err := lockDisk(ctx, diskNum)
 			if err != nil {
-				result := OperationResult{
-					DiskNumber: diskNum,
-					Success:    false,
-					Error:      err.Error(),
-					Duration:   time.Since(start).String(),
-				}
-				mu.Lock()
-				results[idx] = result
-				mu.Unlock()
-				e.emitEvent(ProgressEvent{
-					Type:       "complete",
-					DiskNumber: diskNum,
-					Operation:  "flash",
-					Success:    false,
-					Error:      err.Error(),
-					Duration:   result.Duration,
-				})
-				return
+				return OperationResult{}, err
 			}
+			defer unlock()
 
-			if err := diskLock.TryLock(ctx, 5*time.Second); err != nil {
-				result := OperationResult{
-					DiskNumber: diskNum,
-					Success:    false,
-					Error:      "disk busy",
-					Duration:   time.Since(start).String(),
+			// Execute flash
+			flasher := flash.NewFlasher()
+			meter := &writeSpeedMeter{}
+			var partitions []flash.Partition
+			drained := make(chan struct{})
+			go func() {
+				for p := range flasher.Progress() {
+					meter.observe(p)
+					if p.Status == flash.StatusComplete {
+						partitions = p.Partitions
+					}
+					if p.Status == flash.StatusInProgress {
+						progress.update(diskNum, diskProgress{
+							Stage:      p.Stage,
+							Percentage: p.Percentage,
+							Bytes:      p.BytesWritten,
+							TotalBytes: max(p.TotalBytes, 0), // SizeUnknown for some compressed images
+							Speed:      p.Speed,
+						})
+					}
+				}
+				close(drained)
+			}()
+			_, _, err = flasher.Flash(ctx, diskOpts)
+			<-drained
+
+			result := OperationResult{Partitions: partitions}
+			if speed := meter.bytesPerSec(); speed > 0 {
+				result.WriteSpeed = flash.FormatBytes(int64(speed)) + "/s"
+				if err == nil && e.minWriteSpeed > 0 && speed < float64(e.minWriteSpeed) {
+					result.Slow = true
+					if e.failSlow {
+						// A slow drive stays slow, so this isn't retried
+						err = permanentError{fmt.Errorf("sustained write speed %s is below the %s/s minimum",
+							result.WriteSpeed, flash.FormatBytes(e.minWriteSpeed))}
+					}
 				}
-				mu.Lock()
-				results[idx] = result
-				mu.Unlock()
-				e.emitEvent(ProgressEvent{
-					Type:       "complete",
-					DiskNumber: diskNum,
-					Operation:  "flash",
-					Success:    false,
-					Error:      "disk busy",
-					Duration:   result.Duration,
-				})
-				return
 			}
-			defer diskLock.Unlock()
+			return result, err
+		},
+	})
+}
+
+// WipeAll wipes multiple disks in parallel
+func (e *Executor) WipeAll(ctx context.Context, disks []int, opts flash.WipeOptions) BatchResult {
+	progress := e.newProgressReporter(disks, "wipe")
+	return e.runAll(ctx, batch{
+		operation:     "wipe",
+		targets:       targetsForDisks(disks),
+		maxConcurrent: e.maxConcurrent,
+		progress:      progress,
+		run: func(ctx context.Context, idx, attempt int) (OperationResult, error) {
+			diskNum := disks[idx]
+			unlock, err := lockDisk(ctx, diskNum)
+			if err != nil {
+				return OperationResult{}, err
+			}
+			defer unlock()
 
 			// Create options copy with this disk number
 			diskOpts := opts
 			diskOpts.DiskNumber = diskNum
 
-			// Execute flash
-			flasher := flash.NewFlasher()
+			wiper := flash.NewWiper()
 			go func() {
-				// Drain progress channel to prevent blocking
-				for range flasher.Progress() {
+				for p := range wiper.Progress() {
+					if p.Status != flash.StatusInProgress {
+						continue
+					}
+					stage := p.Stage
+					if p.Passes > 1 {
+						stage = fmt.Sprintf("%s (pass %d/%d)", p.Stage, p.Pass, p.Passes)
+					}
+					progress.update(diskNum, diskProgress{
+						Stage:      stage,
+						Percentage: p.Percentage,
+						Bytes:      p.BytesWritten,
+						TotalBytes: p.TotalBytes,
+						Speed:      p.Speed,
+					})
 				}
 			}()
-			_, _, err = flasher.Flash(ctx, diskOpts)
+			_, err = wiper.Wipe(ctx, diskOpts)
+			return OperationResult{}, err
+		},
+	})
+}
 
-			result := OperationResult{
-				DiskNumber: diskNum,
-				Success:    err == nil,
-				Error:      errorString(err),
-				Duration:   time.Since(start).String(),
+// FsckAll checks the file systems of multiple disks in parallel. A drive
+// left with file system errors fails without being retried.
+func (e *Executor) FsckAll(ctx context.Context, disks []int, opts fsck.Options) BatchResult {
+	progress := e.newProgressReporter(disks, "fsck")
+	return e.runAll(ctx, batch{
+		operation:     "fsck",
+		targets:       targetsForDisks(disks),
+		maxConcurrent: e.maxConcurrent,
+		progress:      progress,
+		run: func(ctx context.Context, idx, attempt int) (OperationResult, error) {
+			diskNum := disks[idx]
+			unlock, err := lockDisk(ctx, diskNum)
+			if err != nil {
+				return OperationResult{}, err
 			}
+			defer unlock()
 
-			mu.Lock()
-			results[idx] = result
-			mu.Unlock()
-
-			e.emitEvent(ProgressEvent{
-				Type:       "complete",
-				DiskNumber: diskNum,
-				Operation:  "flash",
-				Success:    err == nil,
-				Error:      errorString(err),
-				Duration:   result.Duration,
-			})
-		}(i, disk)
-	}
+			// Create options copy with this disk number
+			diskOpts := opts
+			diskOpts.DiskNumber = diskNum
+			diskOpts.Progress = func(stage string, percentage int) {
+				progress.update(diskNum, diskProgress{Stage: stage, Percentage: percentage})
+			}
 
-	wg.Wait()
+			result, err := fsck.Check(ctx, diskOpts)
+			if errors.Is(err, fsck.ErrNotFixed) {
+				err = permanentError{err}
+			}
+			return OperationResult{Fsck: result}, err
+		},
+	})
+}
 
-	// Build summary
-	batch := BatchResult{
-		Results: results,
-		Total:   len(disks),
-	}
-	for _, r := range results {
-		if r.Success {
-			batch.Succeeded++
-		} else {
-			batch.Failed++
-		}
+// EjectAll flushes and ejects multiple disks in parallel, e.g. at the end
+// of a duplication run.
+func (e *Executor) EjectAll(ctx context.Context, disks []int, opts disk.EjectOptions) BatchResult {
+	progress := e.newProgressReporter(disks, "eject")
+	return e.runAll(ctx, batch{
+		operation:     "eject",
+		targets:       targetsForDisks(disks),
+		maxConcurrent: e.maxConcurrent,
+		progress:      progress,
+		run: func(ctx context.Context, idx, attempt int) (OperationResult, error) {
+			diskNum := disks[idx]
+			unlock, err := lockDisk(ctx, diskNum)
+			if err != nil {
+				return OperationResult{}, err
+			}
+			defer unlock()
+
+			progress.update(diskNum, diskProgress{Stage: "Ejecting"})
+			if err := disk.EjectDiskWithOptions(diskNum, opts); err != nil {
+				return OperationResult{}, err
+			}
+			return OperationResult{Ejected: true}, nil
+		},
+	})
+}
+
+// CopyAll copies a directory tree to the volumes of multiple disks in
+// parallel: into dirs[i] (e.g. `E:\` or `E:\content`) on disks[i].
+func (e *Executor) CopyAll(ctx context.Context, disks []int, dirs []string, opts files.Options) BatchResult {
+	targets := make([]target, len(disks))
+	for i, d := range disks {
+		targets[i] = target{diskNumber: d, driveLetter: filepath.VolumeName(dirs[i])}
 	}
 
-	// Emit summary event
-	e.emitEvent(ProgressEvent{
-		Type:      "summary",
-		Total:     batch.Total,
-		Succeeded: batch.Succeeded,
-		Failed:    batch.Failed,
+	progress := e.newProgressReporter(disks, "copy")
+	return e.runAll(ctx, batch{
+		operation:     "copy",
+		targets:       targets,
+		maxConcurrent: e.maxConcurrent,
+		progress:      progress,
+		run: func(ctx context.Context, idx, attempt int) (OperationResult, error) {
+			diskNum := disks[idx]
+			unlock, err := lockDisk(ctx, diskNum)
+			if err != nil {
+				return OperationResult{}, err
+			}
+			defer unlock()
+
+			// Create options copy with this drive's directory
+			diskOpts := opts
+			diskOpts.Target = dirs[idx]
+
+			copier := files.NewCopier()
+			go func() {
+				for p := range copier.Progress() {
+					if p.Status == flash.StatusInProgress {
+						progress.update(diskNum, diskProgress{
+							Stage:      p.Stage,
+							Percentage: p.Percentage,
+							Bytes:      p.BytesCopied,
+							TotalBytes: p.TotalBytes,
+							Speed:      p.Speed,
+						})
+					}
+				}
+			}()
+			_, err = copier.Copy(ctx, diskOpts)
+			return OperationResult{}, err
+		},
 	})
+}
+
+// RunAll runs a custom sequence of steps on multiple disks in parallel, such
+// as a provisioning job, holding each disk's lock for the whole sequence.
+// run reports its progress through report, which the executor streams like
+// that of its own operations.
+func (e *Executor) RunAll(ctx context.Context, operation string, disks []int,
+	run func(ctx context.Context, diskNum int, report func(stage string, percentage int)) error) BatchResult {
+	progress := e.newProgressReporter(disks, operation)
+	return e.runAll(ctx, batch{
+		operation:     operation,
+		targets:       targetsForDisks(disks),
+		maxConcurrent: e.maxConcurrent,
+		progress:      progress,
+		run: func(ctx context.Context, idx, attempt int) (OperationResult, error) {
+			diskNum := disks[idx]
+			unlock, err := lockDisk(ctx, diskNum)
+			if err != nil {
+				return OperationResult{}, err
+			}
+			defer unlock()
 
-	return batch
+			return OperationResult{}, run(ctx, diskNum, func(stage string, percentage int) {
+				progress.update(diskNum, diskProgress{Stage: stage, Percentage: percentage})
+			})
+		},
+	})
 }
 
 // labelStaggerDelay is the delay between starting label operations on different
@@ -393,102 +519,49 @@ func (e *Executor) LabelAll(ctx context.Context, driveLetters []string, opts Lab
 		maxConc = 2
 	}
 
-	sem := make(chan struct{}, maxConc)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	results := make([]OperationResult, len(driveLetters))
-
+	targets := make([]target, len(driveLetters))
 	for i, dl := range driveLetters {
-		wg.Add(1)
-
+		targets[i] = target{driveLetter: dl + ":"}
+	}
+	return e.runAll(ctx, batch{
+		operation:     "label",
+		targets:       targets,
+		maxConcurrent: maxConc,
 		// Stagger starts to avoid hitting the USB controller simultaneously
-		if i > 0 {
-			time.Sleep(labelStaggerDelay)
-		}
-
-		go func(idx int, driveLetter string) {
-			defer wg.Done()
-
-			// Emit start event
-			e.emitEvent(ProgressEvent{
-				Type:        "start",
-				DriveLetter: driveLetter + ":",
-				Operation:   "label",
-			})
-
-			// Acquire semaphore
-			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
-			case <-ctx.Done():
-				mu.Lock()
-				results[idx] = OperationResult{
-					DriveLetter: driveLetter + ":",
-					Success:     false,
-					Error:       "cancelled",
-				}
-				mu.Unlock()
-				e.emitEvent(ProgressEvent{
-					Type:        "complete",
-					DriveLetter: driveLetter + ":",
-					Operation:   "label",
-					Success:     false,
-					Error:       "cancelled",
-				})
-				return
-			}
-
-			start := time.Now()
-
+		stagger: labelStaggerDelay,
+		run: func(ctx context.Context, idx, attempt int) (OperationResult, error) {
 			// Execute label change using Windows API (has built-in retry)
-			err := disk.SetVolumeLabel(driveLetter, opts.Label)
-
-			result := OperationResult{
-				DriveLetter: driveLetter + ":",
-				Success:     err == nil,
-				Error:       errorString(err),
-				Duration:    time.Since(start).String(),
+			name := opts.Label
+			if l, ok := opts.Labels[driveLetters[idx]]; ok {
+				name = l
 			}
+			previous, _ := disk.GetVolumeLabel(driveLetters[idx] + `:\`)
+			result := OperationResult{Label: name, PreviousLabel: previous}
+			return result, label.Set(driveLetters[idx], name)
+		},
+	})
+}
 
-			mu.Lock()
-			results[idx] = result
-			mu.Unlock()
-
-			e.emitEvent(ProgressEvent{
-				Type:        "complete",
-				DriveLetter: driveLetter + ":",
-				Operation:   "label",
-				Success:     err == nil,
-				Error:       errorString(err),
-				Duration:    result.Duration,
-			})
-		}(i, dl)
-	}
-
-	wg.Wait()
-
-	// Build summary
-	batch := BatchResult{
-		Results: results,
-		Total:   len(driveLetters),
-	}
-	for _, r := range results {
-		if r.Success {
-			batch.Succeeded++
-		} else {
-			batch.Failed++
+// failAll reports every disk as failed with err, for a batch that couldn't
+// start at all.
+func (e *Executor) failAll(disks []int, operation string, err error) BatchResult {
+	results := make([]OperationResult, len(disks))
+	for i, diskNum := range disks {
+		results[i] = OperationResult{
+			DiskNumber: diskNum,
+			Success:    false,
+			Error:      err.Error(),
+			Duration:   "0s",
 		}
+		e.emitEvent(ProgressEvent{
+			Type:       "complete",
+			DiskNumber: diskNum,
+			Operation:  operation,
+			Success:    false,
+			Error:      err.Error(),
+		})
 	}
-
-	// Emit summary event
-	e.emitEvent(ProgressEvent{
-		Type:      "summary",
-		Total:     batch.Total,
-		Succeeded: batch.Succeeded,
-		Failed:    batch.Failed,
-	})
-
-	return batch
+	return e.summarize(results, false)
 }
 
 func errorString(err error) string {
@@ -559,13 +632,67 @@ func IsMultiDiskArg(arg string) bool {
 	return strings.ContainsAny(arg, ",-")
 }
 
+// writeSpeedMeter measures a flash's sustained write speed from its
+// progress updates: the average over the Writing stage, so extraction,
+// verification and the pre-write speed test don't count.
+type writeSpeedMeter struct {
+	first, last           time.Time
+	firstBytes, lastBytes int64
+}
+
+func (m *writeSpeedMeter) observe(p flash.Progress) {
+	if p.Stage != flash.StageWriting || p.Status != flash.StatusInProgress {
+		return
+	}
+	now := time.Now()
+	if m.first.IsZero() {
+		m.first, m.firstBytes = now, p.BytesWritten
+	}
+	m.last, m.lastBytes = now, p.BytesWritten
+}
+
+// bytesPerSec returns the measured speed, or 0 if the write was too short
+// to measure.
+func (m *writeSpeedMeter) bytesPerSec() float64 {
+	elapsed := m.last.Sub(m.first).Seconds()
+	if elapsed < 1 {
+		return 0
+	}
+	return float64(m.lastBytes-m.firstBytes) / elapsed
+}
+
 // PrintBatchResult outputs the batch result for non-JSON mode
 func PrintBatchResult(result BatchResult, operation string) {
 	fmt.Printf("%s %d/%d drives successfully\n", operation, result.Succeeded, result.Total)
+	if result.Aborted {
+		fmt.Println("Stopped early: too many drives failed")
+	}
+	if result.SlowDrives > 0 {
+		fmt.Printf("%d drive(s) below the minimum write speed\n", result.SlowDrives)
+	}
 	for _, r := range result.Results {
 		status := "OK"
 		if !r.Success {
 			status = "FAILED: " + r.Error
+		} else if r.Slow {
+			status = "OK, SLOW: " + r.WriteSpeed
+		}
+		if r.Attempts > 1 {
+			status += fmt.Sprintf(" after %d attempts", r.Attempts)
+		}
+		if r.Fsck != nil {
+			if r.Fsck.ErrorsFixed {
+				status += ", errors fixed"
+			}
+			if r.Fsck.BadClusters > 0 {
+				status += fmt.Sprintf(", %d BAD CLUSTERS", r.Fsck.BadClusters)
+			}
+		}
+		if r.Success && r.BadClusters != nil && *r.BadClusters > 0 {
+			status += fmt.Sprintf(", %d BAD CLUSTERS", *r.BadClusters)
+		}
+		if r.Success && (r.Label != "" || r.PreviousLabel != "") {
+			status += fmt.Sprintf(", %q -> %q", r.PreviousLabel, r.Label)
 		}
 		// Use drive letter if available, otherwise use disk number
 		if r.DriveLetter != "" {
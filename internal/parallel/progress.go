@@ -0,0 +1,120 @@
+package parallel
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pterm/pterm"
+)
+
+// diskProgress is one progress update of a disk in a batch.
+type diskProgress struct {
+	Stage      string
+	Percentage int
+	Bytes      int64 // Bytes done in the current stage, 0 if not measured
+	TotalBytes int64
+	Speed      string
+}
+
+// progressReporter forwards the progress of a batch's disks: as "progress"
+// NDJSON events with JSON output, or as one progress bar per disk otherwise.
+type progressReporter struct {
+	e         *Executor
+	operation string
+
+	mu       sync.Mutex
+	multi    *pterm.MultiPrinter
+	bars     map[int]*pterm.ProgressbarPrinter
+	last     map[int]diskProgress // Last update sent per disk
+	finished map[int]bool         // Disks already reported done
+}
+
+// newProgressReporter starts reporting progress for disks. The bars are
+// laid out in the order of disks.
+func (e *Executor) newProgressReporter(disks []int, operation string) *progressReporter {
+	r := &progressReporter{
+		e:         e,
+		operation: operation,
+		last:      make(map[int]diskProgress),
+		finished:  make(map[int]bool),
+	}
+	if e.jsonOutput {
+		return r
+	}
+
+	r.multi, _ = pterm.DefaultMultiPrinter.Start()
+	r.bars = make(map[int]*pterm.ProgressbarPrinter, len(disks))
+	for _, diskNum := range disks {
+		r.bars[diskNum], _ = pterm.DefaultProgressbar.
+			WithTotal(100).
+			WithShowCount(false).
+			WithTitle(barTitle(diskNum, "Waiting", "")).
+			WithWriter(r.multi.NewWriter()).
+			Start()
+	}
+	return r
+}
+
+// update reports a disk's progress. Updates that change neither the stage
+// nor the percentage are dropped, to keep the NDJSON stream readable, as are
+// updates from an operation abandoned after a timeout.
+func (r *progressReporter) update(diskNum int, p diskProgress) {
+	r.mu.Lock()
+	last, seen := r.last[diskNum]
+	if r.finished[diskNum] || (seen && last.Stage == p.Stage && last.Percentage == p.Percentage) {
+		r.mu.Unlock()
+		return
+	}
+	r.last[diskNum] = p
+	r.mu.Unlock()
+
+	if r.e.jsonOutput {
+		r.e.emitEvent(ProgressEvent{
+			Type:       "progress",
+			DiskNumber: diskNum,
+			Operation:  r.operation,
+			Stage:      p.Stage,
+			Percentage: p.Percentage,
+			Bytes:      p.Bytes,
+			TotalBytes: p.TotalBytes,
+			Speed:      p.Speed,
+		})
+		return
+	}
+	if bar := r.bars[diskNum]; bar != nil {
+		bar.Current = min(max(p.Percentage, 0), 100)
+		bar.UpdateTitle(barTitle(diskNum, p.Stage, p.Speed))
+	}
+}
+
+// done marks a disk's bar as finished, successfully or not.
+func (r *progressReporter) done(diskNum int, success bool) {
+	r.mu.Lock()
+	r.finished[diskNum] = true
+	r.mu.Unlock()
+
+	bar := r.bars[diskNum]
+	if bar == nil {
+		return
+	}
+	if success {
+		bar.Current = 100
+		bar.UpdateTitle(pterm.Green(barTitle(diskNum, "Done", "")))
+	} else {
+		bar.UpdateTitle(pterm.Red(barTitle(diskNum, "FAILED", "")))
+	}
+	bar.Stop()
+}
+
+// stop ends the progress display once every disk is done.
+func (r *progressReporter) stop() {
+	if r.multi != nil {
+		r.multi.Stop()
+	}
+}
+
+// barTitle returns the title of a disk's progress bar, padded so the bars
+// line up.
+func barTitle(diskNum int, stage, speed string) string {
+	return fmt.Sprintf("Disk %-3d %-24s %12s", diskNum, stage, speed)
+}
@@ -3,30 +3,70 @@ package usb
 import (
 	"fmt"
 	"regexp"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
 )
 
 // Device represents a USB storage device
 type Device struct {
-	DriveLetter      string `json:"driveLetter"`
-	DiskNumber       int    `json:"diskNumber"`
-	FriendlyName     string `json:"friendlyName"`
-	Model            string `json:"model"`
-	Size             int64  `json:"size"`
-	SizeHuman        string `json:"sizeHuman"`
-	SerialNumber     string `json:"serialNumber"`
-	VendorID         string `json:"vendorId"`
-	ProductID        string `json:"productId"`
-	FileSystem       string `json:"fileSystem"`
-	VolumeLabel      string `json:"volumeLabel"`
-	PartitionStyle   string `json:"partitionStyle"`
-	Status           string `json:"status"`
-	HealthStatus     string `json:"healthStatus"`
-	BusType          string `json:"busType"`
-	MediaType        string `json:"mediaType"`
-	LocationInfo     string `json:"locationInfo"`     // USB hub port location (e.g., "Port_#0002.Hub_#0002")
-	ParentInstanceId string `json:"parentInstanceId"` // Parent hub instance ID (e.g., "USB\VID_2109&PID_0822\...")
+	DriveLetter      string          `json:"driveLetter"`
+	DiskNumber       int             `json:"diskNumber"`
+	FriendlyName     string          `json:"friendlyName"`
+	Model            string          `json:"model"`
+	Size             int64           `json:"size"`
+	SizeHuman        string          `json:"sizeHuman"`
+	SerialNumber     string          `json:"serialNumber"`
+	VendorID         string          `json:"vendorId"`
+	ProductID        string          `json:"productId"`
+	FileSystem       string          `json:"fileSystem"`
+	VolumeLabel      string          `json:"volumeLabel"`
+	Volumes          []Volume        `json:"volumes"` // Every volume with a drive letter, in partition order
+	PartitionStyle   string          `json:"partitionStyle"`
+	Status           string          `json:"status"`
+	HealthStatus     string          `json:"healthStatus"`
+	BusType          string          `json:"busType"`
+	MediaType        string          `json:"mediaType"`
+	LocationInfo     string          `json:"locationInfo"`            // USB hub port location (e.g., "Port_#0002.Hub_#0002")
+	ParentInstanceId string          `json:"parentInstanceId"`        // Parent hub instance ID (e.g., "USB\VID_2109&PID_0822\...")
+	PNPDeviceID      string          `json:"pnpDeviceId"`             // Disk PnP instance ID (e.g., "USBSTOR\DISK&VEN_...\...&0")
+	RemovalPolicy    string          `json:"removalPolicy,omitempty"` // RemovalPolicyQuick, RemovalPolicyPerformance or RemovalPolicyFixed
+	USBVersion       string          `json:"usbVersion,omitempty"`    // USB version the device supports (e.g., "3.2")
+	LinkSpeedMbps    int             `json:"linkSpeedMbps,omitempty"` // Negotiated link speed: 12, 480, 5000 or 10000
+	UASP             bool            `json:"uasp"`                    // USB Attached SCSI rather than bulk-only transport
+	ReadOnly         bool            `json:"readOnly"`                // Windows' read-only disk attribute (protect --on)
+	WriteProtected   bool            `json:"writeProtected"`          // Media write protection, e.g. a lock switch
+	BitLocker        string          `json:"bitLocker,omitempty"`     // BitLockerLocked or BitLockerUnlocked; empty if not protected or unknown
+	Smart            *disk.SmartInfo `json:"smart,omitempty"`         // Health data, filled in by info for drives that expose it
+}
+
+// Volume is a volume with a drive letter on a device. DriveLetter,
+// FileSystem and VolumeLabel of Device describe the first of them.
+type Volume struct {
+	DriveLetter string `json:"driveLetter"`
+	FileSystem  string `json:"fileSystem"`
+	Label       string `json:"label"`
+	Size        int64  `json:"size"`
+	UsedSpace   int64  `json:"usedSpace"`
+	FreeSpace   int64  `json:"freeSpace"`
+	BitLocker   string `json:"bitLocker,omitempty"` // BitLockerLocked or BitLockerUnlocked
+}
+
+// StatusNoMedia is the Status of a card reader or other removable media
+// drive that has no media in it.
+const StatusNoMedia = "No Media"
+
+// HasMedia reports whether the device has media; empty card readers don't.
+func (d Device) HasMedia() bool {
+	return d.Status != StatusNoMedia
 }
 
+// BitLocker states of a device's volume. They are only known when running
+// as administrator.
+const (
+	BitLockerLocked   = "locked"
+	BitLockerUnlocked = "unlocked"
+)
+
 // FormatSize converts bytes to human-readable format
 func FormatSize(bytes int64) string {
 	const unit = 1024
@@ -61,10 +101,10 @@ type rawDisk struct {
 	Model             string      `json:"Model"`
 	SerialNumber      string      `json:"SerialNumber"`
 	Size              int64       `json:"Size"`
-	PartitionStyle    string      `json:"PartitionStyle"`
-	HealthStatus      string      `json:"HealthStatus"`
+	PartitionStyle    int         `json:"PartitionStyle"`
+	HealthStatus      int         `json:"HealthStatus"`
 	OperationalStatus interface{} `json:"OperationalStatus"`
-	BusType           string      `json:"BusType"`
+	BusType           int         `json:"BusType"`
 }
 
 // rawPhysicalDisk represents the raw data from Get-PhysicalDisk queries.
@@ -104,6 +144,7 @@ type rawWin32DiskDrive struct {
 	SerialNumber  string `json:"SerialNumber"`
 	PNPDeviceID   string `json:"PNPDeviceID"`
 	InterfaceType string `json:"InterfaceType"`
+	MediaType     string `json:"MediaType"`
 }
 
 // partitionStyleNames maps partition style numbers to names
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
 )
 
 // deviceCache holds cached device enumeration results
@@ -17,6 +19,102 @@ type deviceCache struct {
 
 const cacheTTL = 2 * time.Second
 
+// Enumeration engines, selected with SetEngine
+const (
+	EngineAuto       = "auto"       // Native WMI, falling back to PowerShell, then SetupAPI
+	EngineWMI        = "wmi"        // Native WMI queries only
+	EnginePowerShell = "powershell" // Storage cmdlets through powershell.exe only
+	EngineSetupAPI   = "setupapi"   // SetupAPI and storage IOCTLs only, without WMI or PowerShell
+)
+
+// engine is the enumeration engine every Enumerator uses.
+var engine = EngineAuto
+
+// SetEngine selects how USB devices are enumerated: EngineAuto, EngineWMI,
+// EnginePowerShell or EngineSetupAPI.
+func SetEngine(name string) error {
+	switch name {
+	case EngineAuto, EngineWMI, EnginePowerShell, EngineSetupAPI:
+		engine = name
+		return nil
+	default:
+		return fmt.Errorf("invalid engine %q: use %s, %s, %s or %s", name, EngineAuto, EngineWMI, EnginePowerShell, EngineSetupAPI)
+	}
+}
+
+// Non-USB buses whose removable disks can be listed with SetIncludeBuses
+const (
+	BusSD            = "sd"             // SD cards in PCIe/SD host readers
+	BusMMC           = "mmc"            // MMC and eMMC cards
+	BusSATARemovable = "sata-removable" // SATA/ATA disks with removable media
+)
+
+// STORAGE_BUS_TYPE values; MSFT_Disk uses the same numbers
+const (
+	busTypeATA  = 3
+	busTypeUSB  = 7
+	busTypeSATA = 11
+	busTypeSD   = 12
+	busTypeMMC  = 13
+)
+
+// includeBuses are the non-USB buses whose disks are listed alongside USB
+// ones. Empty by default: only USB disks are listed.
+var includeBuses = map[string]bool{}
+
+// SetIncludeBuses makes enumeration list the disks on the given non-USB
+// buses (BusSD, BusMMC, BusSATARemovable) too, so every command can target
+// them with the same safety checks as USB drives.
+func SetIncludeBuses(buses []string) error {
+	included := make(map[string]bool, len(buses))
+	for _, b := range buses {
+		b = strings.ToLower(strings.TrimSpace(b))
+		switch b {
+		case BusSD, BusMMC, BusSATARemovable:
+			included[b] = true
+		default:
+			return fmt.Errorf("invalid bus %q: use %s, %s or %s", b, BusSD, BusMMC, BusSATARemovable)
+		}
+	}
+	includeBuses = included
+	return nil
+}
+
+// includedBusName returns the bus a non-USB disk is listed under ("SD",
+// "MMC" or "SATA"), given its storage descriptor, or "" if its bus isn't
+// included.
+func includedBusName(desc *disk.StorageDescriptor) string {
+	switch desc.BusType {
+	case busTypeSD:
+		if includeBuses[BusSD] {
+			return "SD"
+		}
+	case busTypeMMC:
+		if includeBuses[BusMMC] {
+			return "MMC"
+		}
+	case busTypeSATA, busTypeATA:
+		// Only removable media: fixed SATA disks hold Windows and data
+		if includeBuses[BusSATARemovable] && desc.Removable {
+			return "SATA"
+		}
+	}
+	return ""
+}
+
+// includedDiskBus is includedBusName for a disk given by number. It returns
+// "" without opening the disk when no bus is included.
+func includedDiskBus(diskNumber int) string {
+	if len(includeBuses) == 0 {
+		return ""
+	}
+	desc, err := disk.GetStorageDescriptor(diskNumber)
+	if err != nil {
+		return ""
+	}
+	return includedBusName(desc)
+}
+
 // Enumerator provides USB device enumeration capabilities
 type Enumerator struct {
 	cache deviceCache
@@ -27,8 +125,8 @@ func NewEnumerator() *Enumerator {
 	return &Enumerator{}
 }
 
-// ListDevices returns all connected USB storage devices.
-// Uses native WMI queries (no PowerShell).
+// ListDevices returns all connected USB storage devices, enumerated with
+// the engine selected with SetEngine: native WMI queries by default.
 func (e *Enumerator) ListDevices() ([]Device, error) {
 	// Check cache first
 	e.cache.mu.RLock()
@@ -39,7 +137,7 @@ func (e *Enumerator) ListDevices() ([]Device, error) {
 	}
 	e.cache.mu.RUnlock()
 
-	devices, err := e.listDevicesNative()
+	devices, err := e.listDevices()
 	if err != nil {
 		return nil, fmt.Errorf("failed to enumerate USB devices: %w", err)
 	}
@@ -53,7 +151,36 @@ func (e *Enumerator) ListDevices() ([]Device, error) {
 	return devices, nil
 }
 
-// GetDeviceByDriveLetter returns detailed info for a specific USB device
+// listDevices enumerates USB devices with the selected engine, bypassing
+// the cache.
+func (e *Enumerator) listDevices() ([]Device, error) {
+	switch engine {
+	case EngineWMI:
+		return e.listDevicesNative()
+	case EnginePowerShell:
+		return e.listDevicesPowerShell()
+	case EngineSetupAPI:
+		return e.listDevicesSetupAPI()
+	}
+
+	devices, err := e.listDevicesNative()
+	if err == nil {
+		return devices, nil
+	}
+	devices, psErr := e.listDevicesPowerShell()
+	if psErr == nil {
+		return devices, nil
+	}
+	devices, setupErr := e.listDevicesSetupAPI()
+	if setupErr != nil {
+		return nil, fmt.Errorf("%w (PowerShell fallback: %v; SetupAPI fallback: %v)", err, psErr, setupErr)
+	}
+	return devices, nil
+}
+
+// GetDeviceByDriveLetter returns detailed info for a specific USB device.
+// The letter can be that of any of its volumes; the device's DriveLetter,
+// FileSystem and VolumeLabel then describe that volume.
 func (e *Enumerator) GetDeviceByDriveLetter(driveLetter string) (*Device, error) {
 	// Normalize drive letter (remove colon if present)
 	driveLetter = strings.TrimSuffix(strings.ToUpper(driveLetter), ":")
@@ -67,8 +194,13 @@ func (e *Enumerator) GetDeviceByDriveLetter(driveLetter string) (*Device, error)
 	}
 
 	for _, device := range devices {
-		if strings.TrimSuffix(device.DriveLetter, ":") == driveLetter {
-			return &device, nil
+		for _, v := range device.Volumes {
+			if strings.TrimSuffix(v.DriveLetter, ":") == driveLetter {
+				device.DriveLetter = v.DriveLetter
+				device.FileSystem = v.FileSystem
+				device.VolumeLabel = v.Label
+				return &device, nil
+			}
 		}
 	}
 
@@ -113,8 +245,10 @@ func (e *Enumerator) IsSystemDisk(diskNumber int) (bool, error) {
 	for _, device := range devices {
 		if device.DiskNumber == diskNumber {
 			// If this disk has the C: drive, it's a system disk
-			if strings.TrimSuffix(device.DriveLetter, ":") == "C" {
-				return true, nil
+			for _, v := range device.Volumes {
+				if strings.TrimSuffix(v.DriveLetter, ":") == "C" {
+					return true, nil
+				}
 			}
 			return false, nil
 		}
@@ -133,7 +267,7 @@ func (e *Enumerator) getOperationalStatus(status interface{}) string {
 		case 0xD010:
 			return "Online"
 		case 0xD012:
-			return "No Media"
+			return StatusNoMedia
 		default:
 			return "Unknown"
 		}
@@ -3,10 +3,12 @@ package usb
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/StackExchange/wmi"
+	"github.com/lazaroagomez/wusbkit/internal/disk"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -87,14 +89,21 @@ func (e *Enumerator) listDevicesNative() ([]Device, error) {
 	var partitions []Win32_DiskPartition
 	var associations []Win32_LogicalDiskToPartition
 	var logicalDisks []Win32_LogicalDisk
+	var bitlocker map[string]disk.BitLockerStatus
 	var mu sync.Mutex
 
 	// Run all WMI queries in parallel using errgroup
 	g, _ := errgroup.WithContext(context.Background())
 
-	// Query USB disk drives (this is the critical one that must succeed)
+	// Query USB disk drives (this is the critical one that must succeed).
+	// UASP drives report InterfaceType SCSI and are picked out below.
 	g.Go(func() error {
-		query := "SELECT Index, Model, SerialNumber, Size, InterfaceType, PNPDeviceID, MediaType, Status FROM Win32_DiskDrive WHERE InterfaceType='USB'"
+		query := "SELECT Index, Model, SerialNumber, Size, InterfaceType, PNPDeviceID, MediaType, Status FROM Win32_DiskDrive WHERE InterfaceType='USB' OR InterfaceType='SCSI'"
+		if len(includeBuses) > 0 {
+			// SD and SATA disks report other interface types; their bus is
+			// checked below
+			query = "SELECT Index, Model, SerialNumber, Size, InterfaceType, PNPDeviceID, MediaType, Status FROM Win32_DiskDrive"
+		}
 		var drives []Win32_DiskDrive
 		if err := wmi.Query(query, &drives); err != nil {
 			return fmt.Errorf("WMI query failed: %w", err)
@@ -125,16 +134,26 @@ func (e *Enumerator) listDevicesNative() ([]Device, error) {
 		return nil
 	})
 
-	// Query logical disks (non-fatal if fails)
+	// Query logical disks (non-fatal if fails). USB hard drives and some
+	// sticks report themselves as fixed rather than removable
 	g.Go(func() error {
 		var disks []Win32_LogicalDisk
-		wmi.Query("SELECT DeviceID, FileSystem, VolumeName FROM Win32_LogicalDisk WHERE DriveType=2", &disks)
+		wmi.Query("SELECT DeviceID, FileSystem, VolumeName, Size, FreeSpace FROM Win32_LogicalDisk WHERE DriveType=2 OR DriveType=3", &disks)
 		mu.Lock()
 		logicalDisks = disks
 		mu.Unlock()
 		return nil
 	})
 
+	// Query BitLocker volume states (non-fatal if fails; needs admin)
+	g.Go(func() error {
+		volumes, _ := disk.QueryBitLocker()
+		mu.Lock()
+		bitlocker = volumes
+		mu.Unlock()
+		return nil
+	})
+
 	// Wait for all queries to complete
 	if err := g.Wait(); err != nil {
 		return nil, err
@@ -156,12 +175,11 @@ func (e *Enumerator) listDevicesNative() ([]Device, error) {
 		}
 	}
 
-	// Build disk index to partition DeviceID mapping
-	diskToPartition := make(map[uint32]string)
+	// Build disk index to partition DeviceIDs mapping, in partition order
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Index < partitions[j].Index })
+	diskToPartitions := make(map[uint32][]string)
 	for _, part := range partitions {
-		if _, exists := diskToPartition[part.DiskIndex]; !exists {
-			diskToPartition[part.DiskIndex] = part.DeviceID
-		}
+		diskToPartitions[part.DiskIndex] = append(diskToPartitions[part.DiskIndex], part.DeviceID)
 	}
 
 	// Build drive letter to logical disk mapping
@@ -170,11 +188,17 @@ func (e *Enumerator) listDevicesNative() ([]Device, error) {
 		driveToLogical[ld.DeviceID] = ld
 	}
 
-	// Build device list and collect PNPDeviceIDs for location lookup
+	// Build device list
 	devices := make([]Device, 0, len(diskDrives))
-	pnpDeviceIDs := make([]string, 0, len(diskDrives))
 
 	for _, disk := range diskDrives {
+		uasp := IsUASP(disk.PNPDeviceID)
+		bus := "USB"
+		if disk.InterfaceType != "USB" && !uasp {
+			if bus = includedDiskBus(int(disk.Index)); bus == "" {
+				continue // SCSI/NVMe disk that isn't on USB or an included bus
+			}
+		}
 		vid, pid := ParseVIDPID(disk.PNPDeviceID)
 
 		device := Device{
@@ -184,55 +208,116 @@ func (e *Enumerator) listDevicesNative() ([]Device, error) {
 			SerialNumber: strings.TrimSpace(disk.SerialNumber),
 			Size:         int64(disk.Size),
 			SizeHuman:    FormatSize(int64(disk.Size)),
-			BusType:      "USB",
+			BusType:      bus,
 			VendorID:     vid,
 			ProductID:    pid,
 			Status:       disk.Status,
 			MediaType:    disk.MediaType,
+			PNPDeviceID:  disk.PNPDeviceID,
+			UASP:         uasp,
 		}
 
-		// Find drive letter via partition association
-		if partDeviceID, ok := diskToPartition[disk.Index]; ok {
-			if driveLetter, ok := partitionToDrive[partDeviceID]; ok {
-				device.DriveLetter = driveLetter
-				if ld, ok := driveToLogical[driveLetter]; ok {
-					device.FileSystem = ld.FileSystem
-					device.VolumeLabel = ld.VolumeName
+		// Find the volumes via partition associations
+		volumes := []Volume{}
+		for _, partDeviceID := range diskToPartitions[disk.Index] {
+			driveLetter, ok := partitionToDrive[partDeviceID]
+			if !ok {
+				continue
+			}
+			volume := Volume{DriveLetter: driveLetter}
+			if ld, ok := driveToLogical[driveLetter]; ok {
+				volume.FileSystem = ld.FileSystem
+				volume.Label = ld.VolumeName
+				volume.Size = int64(ld.Size)
+				volume.FreeSpace = int64(ld.FreeSpace)
+				volume.UsedSpace = volume.Size - volume.FreeSpace
+			}
+			if bl, ok := bitlocker[driveLetter]; ok {
+				switch {
+				case bl.IsLocked:
+					volume.BitLocker = BitLockerLocked
+				case bl.IsProtected:
+					volume.BitLocker = BitLockerUnlocked
 				}
 			}
+			volumes = append(volumes, volume)
 		}
+		setVolumes(&device, volumes)
 
 		devices = append(devices, device)
-		pnpDeviceIDs = append(pnpDeviceIDs, disk.PNPDeviceID)
 	}
 
-	// Fetch hub port location info in parallel for all devices
+	enrichDevices(devices)
+	return devices, nil
+}
+
+// setVolumes sets a device's volumes. The first one stands for the device
+// in its DriveLetter, FileSystem and VolumeLabel.
+func setVolumes(device *Device, volumes []Volume) {
+	device.Volumes = volumes
+	if len(volumes) > 0 {
+		device.DriveLetter = volumes[0].DriveLetter
+		device.FileSystem = volumes[0].FileSystem
+		device.VolumeLabel = volumes[0].Label
+	}
+	// A locked volume anywhere on the drive makes it count as locked, so
+	// flash and format don't overwrite it
+	for _, v := range volumes {
+		if v.BitLocker == BitLockerLocked || device.BitLocker == "" {
+			device.BitLocker = v.BitLocker
+		}
+	}
+}
+
+// enrichDevices fills in the hub port location and link info,
+// write-protect state, removal policy and media presence of enumerated
+// devices, in parallel for all of them.
+func enrichDevices(devices []Device) {
 	if len(devices) > 0 {
 		locationResults := make([]struct {
 			locationInfo     string
 			parentInstanceId string
+			protect          *disk.WriteProtectStatus
+			removalPolicy    string
+			link             *LinkInfo
+			noMedia          bool
 		}, len(devices))
 
 		g2, _ := errgroup.WithContext(context.Background())
-		for i, pnpID := range pnpDeviceIDs {
-			i, pnpID := i, pnpID // capture loop variables
+		for i := range devices {
+			i, pnpID := i, devices[i].PNPDeviceID // capture loop variables
 			g2.Go(func() error {
 				locInfo, parentID, _ := GetHubPortLocation(pnpID)
 				locationResults[i].locationInfo = locInfo
 				locationResults[i].parentInstanceId = parentID
+				locationResults[i].link, _ = GetLinkInfo(parentID, locInfo)
+				locationResults[i].protect, _ = disk.GetWriteProtect(devices[i].DiskNumber)
+				locationResults[i].removalPolicy, _ = GetRemovalPolicy(pnpID)
+				hasMedia, err := disk.HasMedia(devices[i].DiskNumber)
+				locationResults[i].noMedia = err == nil && !hasMedia
 				return nil
 			})
 		}
 		g2.Wait()
 
-		// Apply location results to devices
+		// Apply location, link, write-protect, removal policy and media results to devices
 		for i := range devices {
 			devices[i].LocationInfo = locationResults[i].locationInfo
 			devices[i].ParentInstanceId = locationResults[i].parentInstanceId
+			devices[i].RemovalPolicy = locationResults[i].removalPolicy
+			if link := locationResults[i].link; link != nil {
+				devices[i].USBVersion = link.USBVersion
+				devices[i].LinkSpeedMbps = link.SpeedMbps
+			}
+			if wp := locationResults[i].protect; wp != nil {
+				devices[i].ReadOnly = wp.ReadOnly
+				devices[i].WriteProtected = wp.WriteProtected
+			}
+			if locationResults[i].noMedia {
+				devices[i].Status = StatusNoMedia
+			}
 		}
 	}
-
-	return devices, nil
 }
 
 // extractDeviceID extracts the DeviceID value from a WMI object path
@@ -0,0 +1,140 @@
+package usb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+)
+
+// powershellEnumTimeout bounds the PowerShell enumeration; the storage
+// cmdlets take a few seconds, more with many drives attached.
+const powershellEnumTimeout = 60 * time.Second
+
+// powershellEnumScript collects disks, partitions, lettered volumes and
+// drive PnP IDs in one PowerShell run, as a JSON object. Enums are passed
+// as numbers; disks are filtered by bus type afterwards.
+const powershellEnumScript = `$ErrorActionPreference = 'Stop'
+$letter = @{n='DriveLetter';e={"$($_.DriveLetter)".Trim([char]0)}}
+[pscustomobject]@{
+  disks = @(Get-Disk | Select-Object Number, FriendlyName, Model, SerialNumber, Size,
+    @{n='PartitionStyle';e={[int]$_.PartitionStyle}}, @{n='HealthStatus';e={[int]$_.HealthStatus}},
+    @{n='OperationalStatus';e={[int]@($_.OperationalStatus)[0]}}, @{n='BusType';e={[int]$_.BusType}})
+  partitions = @(Get-Partition -ErrorAction SilentlyContinue | Select-Object DiskNumber, PartitionNumber, $letter, Size)
+  volumes = @(Get-Volume -ErrorAction SilentlyContinue | Where-Object DriveLetter | Select-Object $letter, FileSystemLabel, FileSystem, Size, SizeRemaining,
+    @{n='HealthStatus';e={[int]$_.HealthStatus}}, @{n='DriveType';e={[int]$_.DriveType}})
+  drives = @(Get-CimInstance Win32_DiskDrive | Select-Object DeviceID, Index, Model, SerialNumber, PNPDeviceID, InterfaceType, MediaType)
+} | ConvertTo-Json -Depth 3 -Compress`
+
+// rawEnumeration is the output of powershellEnumScript.
+type rawEnumeration struct {
+	Disks      []rawDisk           `json:"disks"`
+	Partitions []rawPartition      `json:"partitions"`
+	Volumes    []rawVolume         `json:"volumes"`
+	Drives     []rawWin32DiskDrive `json:"drives"`
+}
+
+// listDevicesPowerShell enumerates USB devices with the Storage module's
+// cmdlets (Get-Disk, Get-Partition, Get-Volume) through powershell.exe. It
+// is slower than native WMI, as PowerShell takes seconds to start, but goes
+// through the Storage Management service and works where WMI queries from
+// this process fail.
+func (e *Enumerator) listDevicesPowerShell() ([]Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), powershellEnumTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "powershell.exe",
+		"-NoProfile", "-NonInteractive", "-Command", powershellEnumScript).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if msg := strings.TrimSpace(string(exitErr.Stderr)); msg != "" {
+				return nil, fmt.Errorf("PowerShell enumeration failed: %w: %s", err, strings.SplitN(msg, "\n", 2)[0])
+			}
+		}
+		return nil, fmt.Errorf("PowerShell enumeration failed: %w", err)
+	}
+
+	var raw rawEnumeration
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("parse PowerShell enumeration: %w", err)
+	}
+
+	drives := make(map[int]rawWin32DiskDrive, len(raw.Drives))
+	for _, d := range raw.Drives {
+		drives[d.Index] = d
+	}
+	volumes := make(map[string]rawVolume, len(raw.Volumes))
+	for _, v := range raw.Volumes {
+		volumes[strings.ToUpper(v.DriveLetter)] = v
+	}
+	sort.Slice(raw.Partitions, func(i, j int) bool {
+		return raw.Partitions[i].PartitionNumber < raw.Partitions[j].PartitionNumber
+	})
+	bitlocker, _ := disk.QueryBitLocker()
+
+	devices := make([]Device, 0, len(raw.Disks))
+	for _, d := range raw.Disks {
+		drive := drives[d.Number]
+		uasp := IsUASP(drive.PNPDeviceID)
+		bus := "USB"
+		if d.BusType != busTypeUSB && !uasp {
+			if bus = includedDiskBus(d.Number); bus == "" {
+				continue // Disk that isn't on USB or an included bus
+			}
+		}
+		vid, pid := ParseVIDPID(drive.PNPDeviceID)
+
+		device := Device{
+			DiskNumber:     d.Number,
+			FriendlyName:   d.FriendlyName,
+			Model:          d.Model,
+			SerialNumber:   strings.TrimSpace(d.SerialNumber),
+			Size:           d.Size,
+			SizeHuman:      FormatSize(d.Size),
+			BusType:        bus,
+			VendorID:       vid,
+			ProductID:      pid,
+			Status:         e.getOperationalStatus(d.OperationalStatus),
+			HealthStatus:   getHealthStatusName(d.HealthStatus),
+			PartitionStyle: getPartitionStyleName(d.PartitionStyle),
+			MediaType:      drive.MediaType,
+			PNPDeviceID:    drive.PNPDeviceID,
+			UASP:           uasp,
+		}
+
+		lettered := []Volume{}
+		for _, p := range raw.Partitions {
+			if p.DiskNumber != d.Number || p.DriveLetter == "" {
+				continue
+			}
+			letter := strings.ToUpper(p.DriveLetter) + ":"
+			volume := Volume{DriveLetter: letter}
+			if v, ok := volumes[strings.ToUpper(p.DriveLetter)]; ok {
+				volume.FileSystem = v.FileSystem
+				volume.Label = v.FileSystemLabel
+				volume.Size = v.Size
+				volume.FreeSpace = v.SizeRemaining
+				volume.UsedSpace = v.Size - v.SizeRemaining
+			}
+			if bl, ok := bitlocker[letter]; ok {
+				switch {
+				case bl.IsLocked:
+					volume.BitLocker = BitLockerLocked
+				case bl.IsProtected:
+					volume.BitLocker = BitLockerUnlocked
+				}
+			}
+			lettered = append(lettered, volume)
+		}
+		setVolumes(&device, lettered)
+
+		devices = append(devices, device)
+	}
+
+	enrichDevices(devices)
+	return devices, nil
+}
@@ -0,0 +1,254 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/lazaroagomez/wusbkit/internal/disk"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	setupapi                            = windows.NewLazySystemDLL("setupapi.dll")
+	procSetupDiEnumDeviceInterfaces     = setupapi.NewProc("SetupDiEnumDeviceInterfaces")
+	procSetupDiGetDeviceInterfaceDetail = setupapi.NewProc("SetupDiGetDeviceInterfaceDetailW")
+)
+
+// GUID_DEVINTERFACE_DISK: {53f56307-b6bf-11d0-94f2-00a0c91efb8b}
+var GUID_DEVINTERFACE_DISK = windows.GUID{
+	Data1: 0x53f56307,
+	Data2: 0xb6bf,
+	Data3: 0x11d0,
+	Data4: [8]byte{0x94, 0xf2, 0x00, 0xa0, 0xc9, 0x1e, 0xfb, 0x8b},
+}
+
+// spDeviceInterfaceData maps to SP_DEVICE_INTERFACE_DATA.
+type spDeviceInterfaceData struct {
+	CbSize             uint32
+	InterfaceClassGuid windows.GUID
+	Flags              uint32
+	Reserved           uintptr
+}
+
+// listDevicesSetupAPI enumerates USB devices without WMI or PowerShell: the
+// disk interfaces SetupAPI lists are opened and queried with storage
+// IOCTLs, and volumes come from the volume management functions. It is for
+// locked-down machines where WMI is restricted; BitLocker states are still
+// read through WMI when it is available.
+func (e *Enumerator) listDevicesSetupAPI() ([]Device, error) {
+	devInfo, err := windows.SetupDiGetClassDevsEx(&GUID_DEVINTERFACE_DISK, "", 0,
+		windows.DIGCF_PRESENT|windows.DIGCF_DEVICEINTERFACE, 0, "")
+	if err != nil {
+		return nil, fmt.Errorf("SetupDiGetClassDevs: %w", err)
+	}
+	defer devInfo.Close()
+
+	bitlocker, _ := disk.QueryBitLocker()
+
+	devices := []Device{}
+	for i := 0; ; i++ {
+		data, err := devInfo.EnumDeviceInfo(i)
+		if err == windows.ERROR_NO_MORE_ITEMS {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SetupDiEnumDeviceInfo: %w", err)
+		}
+
+		pnpDeviceID, err := devInfo.DeviceInstanceID(data)
+		if err != nil {
+			continue
+		}
+		path, err := getDeviceInterfacePath(devInfo, data, &GUID_DEVINTERFACE_DISK)
+		if err != nil {
+			continue
+		}
+		device, ok := querySetupAPIDisk(path, pnpDeviceID)
+		if !ok {
+			continue // Not on USB, or gone since it was listed
+		}
+		if name, err := devInfo.DeviceRegistryProperty(data, windows.SPDRP_FRIENDLYNAME); err == nil {
+			if s, ok := name.(string); ok && s != "" {
+				device.FriendlyName = s
+				device.Model = s
+			}
+		}
+		setVolumes(&device, diskVolumes(device.DiskNumber, bitlocker))
+		devices = append(devices, device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DiskNumber < devices[j].DiskNumber })
+	enrichDevices(devices)
+	return devices, nil
+}
+
+// querySetupAPIDisk opens a disk by its device interface path and reads
+// its number, identity and layout. ok is false for disks that aren't on
+// USB or an included bus, or can't be queried.
+func querySetupAPIDisk(path, pnpDeviceID string) (device Device, ok bool) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return Device{}, false
+	}
+	// No read or write access: enough for the queries, without admin
+	handle, err := windows.CreateFile(
+		pathPtr,
+		0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+	if err != nil {
+		return Device{}, false
+	}
+	defer windows.CloseHandle(handle)
+
+	desc, err := disk.QueryStorageDescriptor(handle)
+	if err != nil {
+		return Device{}, false
+	}
+	uasp := IsUASP(pnpDeviceID)
+	bus := "USB"
+	if desc.BusType != busTypeUSB && !uasp {
+		if bus = includedBusName(desc); bus == "" {
+			return Device{}, false // Disk that isn't on USB or an included bus
+		}
+	}
+	diskNumber, err := disk.GetDeviceNumber(handle)
+	if err != nil {
+		return Device{}, false
+	}
+
+	name := strings.TrimSpace(desc.Vendor + " " + desc.Product)
+	vid, pid := ParseVIDPID(pnpDeviceID)
+	device = Device{
+		DiskNumber:   diskNumber,
+		FriendlyName: name,
+		Model:        name,
+		SerialNumber: desc.SerialNumber,
+		BusType:      bus,
+		VendorID:     vid,
+		ProductID:    pid,
+		Status:       "OK",
+		MediaType:    "External hard disk media",
+		PNPDeviceID:  pnpDeviceID,
+		UASP:         uasp,
+	}
+	if desc.Removable {
+		device.MediaType = "Removable Media"
+	}
+	// Both fail on card readers without a card
+	if geo, err := disk.GetDiskGeometry(handle); err == nil {
+		device.Size = geo.DiskSize
+	}
+	device.SizeHuman = FormatSize(device.Size)
+	if layout, err := disk.GetDriveLayout(handle); err == nil {
+		switch layout.PartitionStyle {
+		case disk.PARTITION_STYLE_MBR:
+			device.PartitionStyle = "MBR"
+		case disk.PARTITION_STYLE_GPT:
+			device.PartitionStyle = "GPT"
+		case disk.PARTITION_STYLE_RAW:
+			device.PartitionStyle = "RAW"
+		}
+	}
+	return device, true
+}
+
+// diskVolumes returns the volumes with a drive letter on a disk, in
+// partition order, with their file system and space usage.
+func diskVolumes(diskNumber int, bitlocker map[string]disk.BitLockerStatus) []Volume {
+	byOffset, _ := disk.VolumesByOffset(diskNumber)
+	offsets := make([]int64, 0, len(byOffset))
+	for offset := range byOffset {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	volumes := []Volume{}
+	for _, offset := range offsets {
+		root, _ := disk.GetVolumeDriveLetter(byOffset[offset])
+		if root == "" {
+			continue
+		}
+		letter := strings.TrimSuffix(root, `\`)
+		volume := Volume{DriveLetter: letter}
+		// Fail for locked BitLocker volumes, which can't be read
+		volume.FileSystem, _ = disk.GetVolumeFileSystem(root)
+		volume.Label, _ = disk.GetVolumeLabel(root)
+		if rootPtr, err := windows.UTF16PtrFromString(root); err == nil {
+			var free, total, totalFree uint64
+			if windows.GetDiskFreeSpaceEx(rootPtr, &free, &total, &totalFree) == nil {
+				volume.Size = int64(total)
+				volume.FreeSpace = int64(totalFree)
+				volume.UsedSpace = int64(total - totalFree)
+			}
+		}
+		if bl, ok := bitlocker[letter]; ok {
+			switch {
+			case bl.IsLocked:
+				volume.BitLocker = BitLockerLocked
+			case bl.IsProtected:
+				volume.BitLocker = BitLockerUnlocked
+			}
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
+
+// getDeviceInterfacePath returns the path of a device's interface of the
+// given class, which is what CreateFile needs to open it.
+func getDeviceInterfacePath(devInfo windows.DevInfo, data *windows.DevInfoData, class *windows.GUID) (string, error) {
+	iface := spDeviceInterfaceData{}
+	iface.CbSize = uint32(unsafe.Sizeof(iface))
+	r, _, err := procSetupDiEnumDeviceInterfaces.Call(
+		uintptr(devInfo),
+		uintptr(unsafe.Pointer(data)),
+		uintptr(unsafe.Pointer(class)),
+		0,
+		uintptr(unsafe.Pointer(&iface)),
+	)
+	if r == 0 {
+		return "", fmt.Errorf("SetupDiEnumDeviceInterfaces: %w", err)
+	}
+
+	var size uint32
+	procSetupDiGetDeviceInterfaceDetail.Call(
+		uintptr(devInfo),
+		uintptr(unsafe.Pointer(&iface)),
+		0, 0,
+		uintptr(unsafe.Pointer(&size)),
+		0,
+	)
+	if size == 0 {
+		return "", errors.New("SetupDiGetDeviceInterfaceDetail: no size returned")
+	}
+
+	// SP_DEVICE_INTERFACE_DETAIL_DATA_W: a DWORD cbSize, then the path. Its
+	// cbSize is 8 on 64-bit Windows and 6 on 32-bit, per the C packing
+	buf := make([]uint32, (size+3)/4)
+	buf[0] = 6
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		buf[0] = 8
+	}
+	r, _, err = procSetupDiGetDeviceInterfaceDetail.Call(
+		uintptr(devInfo),
+		uintptr(unsafe.Pointer(&iface)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(size),
+		0,
+		0,
+	)
+	if r == 0 {
+		return "", fmt.Errorf("SetupDiGetDeviceInterfaceDetail: %w", err)
+	}
+	path := unsafe.Slice((*uint16)(unsafe.Pointer(&buf[1])), (size-4)/2)
+	return windows.UTF16ToString(path), nil
+}
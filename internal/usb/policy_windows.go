@@ -0,0 +1,133 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// DEVPKEY_Device_RemovalPolicy: {a45c254e-df1c-4efd-8020-67d146a850e0}, 33
+var DEVPKEY_Device_RemovalPolicy = DEVPROPKEY{
+	FmtID: DEVPKEY_Device_LocationInfo.FmtID,
+	PID:   33,
+}
+
+// CM_REMOVAL_POLICY values, also used for the UserRemovalPolicy override
+const (
+	CM_REMOVAL_POLICY_EXPECT_NO_REMOVAL       = 1
+	CM_REMOVAL_POLICY_EXPECT_ORDERLY_REMOVAL  = 2
+	CM_REMOVAL_POLICY_EXPECT_SURPRISE_REMOVAL = 3
+)
+
+// Removal policies as reported in Device.RemovalPolicy
+const (
+	RemovalPolicyQuick       = "quick"       // Quick removal: no write caching, safe to unplug
+	RemovalPolicyPerformance = "performance" // Better performance: write caching, eject first
+	RemovalPolicyFixed       = "fixed"       // The device is not expected to be removed
+)
+
+// userRemovalPolicyValue is the per-device override Device Manager's
+// Policies tab writes, read by the disk class driver when the device starts.
+const userRemovalPolicyValue = "UserRemovalPolicy"
+
+// removalPolicyKeyPath returns the registry path holding a device's removal
+// policy override.
+func removalPolicyKeyPath(pnpDeviceID string) string {
+	return `SYSTEM\CurrentControlSet\Enum\` + pnpDeviceID + `\Device Parameters\Classpnp`
+}
+
+// removalPolicyName maps a CM_REMOVAL_POLICY value to a RemovalPolicy* name.
+func removalPolicyName(policy uint32) string {
+	switch policy {
+	case CM_REMOVAL_POLICY_EXPECT_SURPRISE_REMOVAL:
+		return RemovalPolicyQuick
+	case CM_REMOVAL_POLICY_EXPECT_ORDERLY_REMOVAL:
+		return RemovalPolicyPerformance
+	case CM_REMOVAL_POLICY_EXPECT_NO_REMOVAL:
+		return RemovalPolicyFixed
+	default:
+		return ""
+	}
+}
+
+// GetRemovalPolicy returns the removal policy configured for a disk, given
+// its PNPDeviceID: the user override if one is set, otherwise the policy the
+// device reports. Returns an empty string if neither is available.
+func GetRemovalPolicy(pnpDeviceID string) (string, error) {
+	if pnpDeviceID == "" {
+		return "", nil
+	}
+
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, removalPolicyKeyPath(pnpDeviceID), registry.QUERY_VALUE)
+	if err == nil {
+		policy, _, err := key.GetIntegerValue(userRemovalPolicyValue)
+		key.Close()
+		if err == nil {
+			return removalPolicyName(uint32(policy)), nil
+		}
+	}
+
+	deviceID, err := windows.UTF16PtrFromString(pnpDeviceID)
+	if err != nil {
+		return "", err
+	}
+	var devInst uint32
+	ret, _, _ := procCMLocateDevNodeW.Call(
+		uintptr(unsafe.Pointer(&devInst)),
+		uintptr(unsafe.Pointer(deviceID)),
+		CM_LOCATE_DEVNODE_NORMAL,
+	)
+	if ret != CR_SUCCESS {
+		return "", nil // Device not found, return empty
+	}
+
+	var propType uint32
+	var policy uint32
+	size := uint32(unsafe.Sizeof(policy))
+	ret, _, _ = procCMGetDevNodePropertyW.Call(
+		uintptr(devInst),
+		uintptr(unsafe.Pointer(&DEVPKEY_Device_RemovalPolicy)),
+		uintptr(unsafe.Pointer(&propType)),
+		uintptr(unsafe.Pointer(&policy)),
+		uintptr(unsafe.Pointer(&size)),
+		0,
+	)
+	if ret != CR_SUCCESS {
+		return "", nil
+	}
+	return removalPolicyName(policy), nil
+}
+
+// SetRemovalPolicy stores the removal policy override for a disk, given its
+// PNPDeviceID. The disk driver only reads it when the device starts, so it
+// takes effect once the drive is reconnected. Requires administrator
+// privileges.
+func SetRemovalPolicy(pnpDeviceID, policy string) error {
+	if pnpDeviceID == "" {
+		return errors.New("device has no PnP instance ID")
+	}
+
+	var value uint32
+	switch policy {
+	case RemovalPolicyQuick:
+		value = CM_REMOVAL_POLICY_EXPECT_SURPRISE_REMOVAL
+	case RemovalPolicyPerformance:
+		value = CM_REMOVAL_POLICY_EXPECT_ORDERLY_REMOVAL
+	default:
+		return fmt.Errorf("invalid removal policy %q: use %s or %s", policy, RemovalPolicyQuick, RemovalPolicyPerformance)
+	}
+
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, removalPolicyKeyPath(pnpDeviceID), registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open removal policy key: %w", err)
+	}
+	defer key.Close()
+
+	if err := key.SetDWordValue(userRemovalPolicyValue, value); err != nil {
+		return fmt.Errorf("set %s: %w", userRemovalPolicyValue, err)
+	}
+	return nil
+}
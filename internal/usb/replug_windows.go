@@ -0,0 +1,109 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procCMDisableDevNode = cfgmgr32.NewProc("CM_Disable_DevNode")
+	procCMEnableDevNode  = cfgmgr32.NewProc("CM_Enable_DevNode")
+)
+
+// Configuration Manager values used to replug a device
+const (
+	CM_DISABLE_UI_NOT_OK = 0x4 // Fail rather than prompt when the removal is vetoed
+	CR_REMOVE_VETOED     = 23
+	CR_ACCESS_DENIED     = 51
+	MAX_DEVICE_ID_LEN    = 200
+)
+
+// replugSettle is how long a device stays disabled, so its driver stack is
+// fully torn down before it starts again.
+const replugSettle = time.Second
+
+// ErrReplugVetoed is returned (wrapped) by Replug when Windows refuses to
+// stop the device, typically because a program has a file open on it.
+var ErrReplugVetoed = errors.New("device removal vetoed")
+
+// Replug disables and re-enables the USB device node a disk, given its
+// PNPDeviceID, sits on — as if it were unplugged and plugged back in — and
+// returns the node's instance ID. The disk may come back under another disk
+// number. Requires administrator privileges.
+func Replug(pnpDeviceID string) (string, error) {
+	if pnpDeviceID == "" {
+		return "", errors.New("device has no PnP instance ID")
+	}
+	deviceID, err := syscall.UTF16PtrFromString(pnpDeviceID)
+	if err != nil {
+		return "", err
+	}
+
+	var devInst uint32
+	ret, _, _ := procCMLocateDevNodeW.Call(
+		uintptr(unsafe.Pointer(&devInst)),
+		uintptr(unsafe.Pointer(deviceID)),
+		CM_LOCATE_DEVNODE_NORMAL,
+	)
+	if ret != CR_SUCCESS {
+		return "", fmt.Errorf("device node not found (CONFIGRET %d)", ret)
+	}
+
+	// The disk sits on the USB device node (or interface, on composite
+	// devices) whose driver is the transport; restarting that node restarts
+	// the whole stack, like a reconnect
+	var usbDevInst uint32
+	ret, _, _ = procCMGetParent.Call(
+		uintptr(unsafe.Pointer(&usbDevInst)),
+		uintptr(devInst),
+		0,
+	)
+	if ret != CR_SUCCESS {
+		return "", fmt.Errorf("parent device node not found (CONFIGRET %d)", ret)
+	}
+	usbDeviceID := getDeviceID(usbDevInst)
+	if !strings.HasPrefix(strings.ToUpper(usbDeviceID), `USB\`) {
+		return "", fmt.Errorf("disk is not on a USB device node (parent %q)", usbDeviceID)
+	}
+
+	ret, _, _ = procCMDisableDevNode.Call(uintptr(usbDevInst), CM_DISABLE_UI_NOT_OK)
+	switch ret {
+	case CR_SUCCESS:
+	case CR_REMOVE_VETOED:
+		return usbDeviceID, fmt.Errorf("%w: eject the drive or close the programs using it", ErrReplugVetoed)
+	case CR_ACCESS_DENIED:
+		return usbDeviceID, errors.New("disable device: access denied (administrator privileges required)")
+	default:
+		return usbDeviceID, fmt.Errorf("disable device failed (CONFIGRET %d)", ret)
+	}
+
+	time.Sleep(replugSettle)
+
+	ret, _, _ = procCMEnableDevNode.Call(uintptr(usbDevInst), 0)
+	if ret != CR_SUCCESS {
+		return usbDeviceID, fmt.Errorf("enable device failed (CONFIGRET %d); the device is left disabled until it is reconnected", ret)
+	}
+	return usbDeviceID, nil
+}
+
+// getDeviceID returns the instance ID of a device node, or an empty string
+// if it can't be read.
+func getDeviceID(devInst uint32) string {
+	buf := make([]uint16, MAX_DEVICE_ID_LEN+1)
+	ret, _, _ := procCMGetDeviceIDW.Call(
+		uintptr(devInst),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		0,
+	)
+	if ret != CR_SUCCESS {
+		return ""
+	}
+	return windows.UTF16ToString(buf)
+}
@@ -0,0 +1,34 @@
+package usb
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+var procCMReenumerateDevNode = cfgmgr32.NewProc("CM_Reenumerate_DevNode")
+
+// CM_REENUMERATE_SYNCHRONOUS makes CM_Reenumerate_DevNode return once the
+// devices found are started.
+const CM_REENUMERATE_SYNCHRONOUS = 0x1
+
+// RescanDevices re-enumerates the whole device tree, like "Scan for hardware
+// changes" in Device Manager, so drives Windows missed are detected and
+// drives that are gone are removed.
+func RescanDevices() error {
+	// A nil device ID locates the root of the device tree
+	var root uint32
+	ret, _, _ := procCMLocateDevNodeW.Call(
+		uintptr(unsafe.Pointer(&root)),
+		0,
+		CM_LOCATE_DEVNODE_NORMAL,
+	)
+	if ret != CR_SUCCESS {
+		return fmt.Errorf("root device node not found (CONFIGRET %d)", ret)
+	}
+
+	ret, _, _ = procCMReenumerateDevNode.Call(uintptr(root), CM_REENUMERATE_SYNCHRONOUS)
+	if ret != CR_SUCCESS {
+		return fmt.Errorf("re-enumerate devices failed (CONFIGRET %d)", ret)
+	}
+	return nil
+}
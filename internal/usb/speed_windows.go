@@ -0,0 +1,223 @@
+package usb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procCMGetDeviceInterfaceListSizeW = cfgmgr32.NewProc("CM_Get_Device_Interface_List_SizeW")
+	procCMGetDeviceInterfaceListW     = cfgmgr32.NewProc("CM_Get_Device_Interface_ListW")
+)
+
+// DEVPKEY_Device_Service: {a45c254e-df1c-4efd-8020-67d146a850e0}, 6
+var DEVPKEY_Device_Service = DEVPROPKEY{
+	FmtID: DEVPKEY_Device_LocationInfo.FmtID,
+	PID:   6,
+}
+
+// GUID_DEVINTERFACE_USB_HUB: {f18a0e88-c30c-11d0-8815-00a0c906bed8}
+var GUID_DEVINTERFACE_USB_HUB = windows.GUID{
+	Data1: 0xf18a0e88,
+	Data2: 0xc30c,
+	Data3: 0x11d0,
+	Data4: [8]byte{0x88, 0x15, 0x00, 0xa0, 0xc9, 0x06, 0xbe, 0xd8},
+}
+
+// USB hub IOCTLs
+const (
+	IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX    = 0x220448
+	IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX_V2 = 0x22045C
+)
+
+const (
+	CM_GET_DEVICE_INTERFACE_LIST_PRESENT = 0
+
+	// uaspService is the driver of USB Attached SCSI devices; bulk-only
+	// devices use USBSTOR.
+	uaspService = "UASPStor"
+
+	// USB_NODE_CONNECTION_INFORMATION_EX is byte-packed, so it is read
+	// through these offsets rather than a struct.
+	connInfoBcdUSBOffset = 6
+	connInfoSpeedOffset  = 23
+	connInfoBufferSize   = 512 // Room for the pipe list that follows
+
+	usb300Protocol             = 0x4 // USB_PROTOCOLS Usb300
+	flagSuperSpeedPlusOrHigher = 0x4 // DeviceIsOperatingAtSuperSpeedPlusOrHigher
+)
+
+// rawConnectionInfoV2 maps to USB_NODE_CONNECTION_INFORMATION_EX_V2.
+type rawConnectionInfoV2 struct {
+	ConnectionIndex       uint32
+	Length                uint32
+	SupportedUsbProtocols uint32
+	Flags                 uint32
+}
+
+// LinkInfo describes how a device is connected to its hub port.
+type LinkInfo struct {
+	USBVersion string // Version the device supports, from its descriptor (e.g., "3.2")
+	SpeedMbps  int    // Negotiated link speed: 12, 480, 5000 or 10000 (1 for low speed)
+}
+
+// IsUASP reports whether a disk, given its PNPDeviceID, is driven by the
+// USB Attached SCSI driver rather than bulk-only USBSTOR.
+func IsUASP(pnpDeviceID string) bool {
+	deviceID, err := syscall.UTF16PtrFromString(pnpDeviceID)
+	if err != nil {
+		return false
+	}
+
+	var devInst uint32
+	ret, _, _ := procCMLocateDevNodeW.Call(
+		uintptr(unsafe.Pointer(&devInst)),
+		uintptr(unsafe.Pointer(deviceID)),
+		CM_LOCATE_DEVNODE_NORMAL,
+	)
+	if ret != CR_SUCCESS {
+		return false
+	}
+
+	// The disk sits on the USB device node whose driver is the transport
+	var parentDevInst uint32
+	ret, _, _ = procCMGetParent.Call(
+		uintptr(unsafe.Pointer(&parentDevInst)),
+		uintptr(devInst),
+		0,
+	)
+	if ret != CR_SUCCESS {
+		return false
+	}
+	return strings.EqualFold(getDevicePropertyString(parentDevInst, DEVPKEY_Device_Service), uaspService)
+}
+
+// GetLinkInfo queries the hub a device is plugged into for the device's USB
+// version and negotiated speed. hubInstanceId and locationInfo are the values
+// GetHubPortLocation returns. Returns nil if the hub can't be queried.
+func GetLinkInfo(hubInstanceId, locationInfo string) (*LinkInfo, error) {
+	port, err := strconv.Atoi(ParsePortNumber(locationInfo))
+	if err != nil || port == 0 || hubInstanceId == "" {
+		return nil, nil
+	}
+
+	hubPath, err := getHubInterfacePath(hubInstanceId)
+	if err != nil || hubPath == "" {
+		return nil, err
+	}
+	pathPtr, err := syscall.UTF16PtrFromString(hubPath)
+	if err != nil {
+		return nil, err
+	}
+	hub, err := windows.CreateFile(
+		pathPtr,
+		windows.GENERIC_WRITE,
+		windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open hub %s: %w", hubInstanceId, err)
+	}
+	defer windows.CloseHandle(hub)
+
+	buf := make([]byte, connInfoBufferSize)
+	binary.LittleEndian.PutUint32(buf, uint32(port))
+	var bytesReturned uint32
+	err = windows.DeviceIoControl(
+		hub,
+		IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX,
+		&buf[0], uint32(len(buf)),
+		&buf[0], uint32(len(buf)),
+		&bytesReturned,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX: %w", err)
+	}
+
+	bcdUSB := binary.LittleEndian.Uint16(buf[connInfoBcdUSBOffset:])
+	info := &LinkInfo{
+		USBVersion: fmt.Sprintf("%d.%d", bcdUSB>>8, (bcdUSB>>4)&0xF),
+	}
+	switch buf[connInfoSpeedOffset] {
+	case 0:
+		info.SpeedMbps = 1 // Low speed, 1.5 Mbps
+	case 1:
+		info.SpeedMbps = 12
+	case 2:
+		info.SpeedMbps = 480
+	case 3:
+		info.SpeedMbps = 5000
+		if superSpeedPlus(hub, port) {
+			info.SpeedMbps = 10000
+		}
+	}
+	return info, nil
+}
+
+// superSpeedPlus reports whether the device on a hub port runs at 10 Gbps or
+// faster. The V2 query is only available on Windows 8 and later.
+func superSpeedPlus(hub windows.Handle, port int) bool {
+	info := rawConnectionInfoV2{
+		ConnectionIndex:       uint32(port),
+		SupportedUsbProtocols: usb300Protocol,
+	}
+	info.Length = uint32(unsafe.Sizeof(info))
+	var bytesReturned uint32
+
+	err := windows.DeviceIoControl(
+		hub,
+		IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX_V2,
+		(*byte)(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+		(*byte)(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+		&bytesReturned,
+		nil,
+	)
+	return err == nil && info.Flags&flagSuperSpeedPlusOrHigher != 0
+}
+
+// getHubInterfacePath returns the device interface path of a USB hub, which
+// is what CreateFile needs to send hub IOCTLs.
+func getHubInterfacePath(hubInstanceId string) (string, error) {
+	deviceID, err := syscall.UTF16PtrFromString(hubInstanceId)
+	if err != nil {
+		return "", err
+	}
+
+	var size uint32
+	ret, _, _ := procCMGetDeviceInterfaceListSizeW.Call(
+		uintptr(unsafe.Pointer(&size)),
+		uintptr(unsafe.Pointer(&GUID_DEVINTERFACE_USB_HUB)),
+		uintptr(unsafe.Pointer(deviceID)),
+		CM_GET_DEVICE_INTERFACE_LIST_PRESENT,
+	)
+	if ret != CR_SUCCESS || size <= 1 {
+		return "", nil // Not a hub
+	}
+
+	buffer := make([]uint16, size)
+	ret, _, _ = procCMGetDeviceInterfaceListW.Call(
+		uintptr(unsafe.Pointer(&GUID_DEVINTERFACE_USB_HUB)),
+		uintptr(unsafe.Pointer(deviceID)),
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(size),
+		CM_GET_DEVICE_INTERFACE_LIST_PRESENT,
+	)
+	if ret != CR_SUCCESS {
+		return "", nil
+	}
+
+	// The list is double-NUL terminated; the first entry is enough
+	return syscall.UTF16ToString(buffer), nil
+}
@@ -0,0 +1,242 @@
+package usb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+)
+
+// Event types reported by Watch
+const (
+	EventArrival      = "arrival"
+	EventRemoval      = "removal"
+	EventMediaArrival = "media-arrival" // Media inserted into a drive that stays attached, like a card reader
+	EventMediaRemoval = "media-removal" // Media taken out of such a drive
+)
+
+const (
+	// deviceChangeQuery selects Windows' WM_DEVICECHANGE notifications for
+	// devices arriving (2) and being removed (3).
+	deviceChangeQuery = "SELECT * FROM Win32_DeviceChangeEvent WHERE EventType = 2 OR EventType = 3"
+
+	// wbemErrTimedOut is WBEM_E_TIMED_OUT, returned by NextEvent when no
+	// event arrived within its timeout.
+	wbemErrTimedOut = 0x80043001
+
+	watchPollMillis    = 500                     // How long NextEvent waits before cancellation is checked
+	watchSettleDelay   = 1500 * time.Millisecond // Time for a new drive's volumes to mount
+	watchMediaInterval = 2 * time.Second         // How often card readers are checked for media changes
+)
+
+// Event is a USB drive being plugged in or removed, or media being
+// inserted into or taken out of one.
+type Event struct {
+	Type   string    `json:"type"` // EventArrival, EventRemoval, EventMediaArrival or EventMediaRemoval
+	Time   time.Time `json:"time"`
+	Port   string    `json:"port,omitempty"` // Hub port number, from Device.LocationInfo
+	Device Device    `json:"device"`
+}
+
+// Watch reports USB drives as they are plugged in and removed, until ctx is
+// cancelled. Windows' device change notifications (WM_DEVICECHANGE, received
+// through WMI's Win32_DeviceChangeEvent) trigger a fresh enumeration that is
+// compared with the previous one, so every event carries the drive's disk
+// number, serial number and port; a removed drive is described as it was
+// last seen.
+//
+// Card readers stay attached while cards come and go, and a card without a
+// mountable volume raises no device notification, so drives that have been
+// seen without media are also polled for media changes, reported as
+// EventMediaArrival and EventMediaRemoval. The events channel is closed when
+// Watch returns.
+func (e *Enumerator) Watch(ctx context.Context, events chan<- Event) error {
+	defer close(events)
+
+	// COM is initialized per thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		// S_FALSE means COM was already initialized on this thread
+		var oleErr *ole.OleError
+		if !errors.As(err, &oleErr) || oleErr.Code() != 1 {
+			return fmt.Errorf("CoInitializeEx: %w", err)
+		}
+	}
+	defer ole.CoUninitialize()
+
+	unknown, err := oleutil.CreateObject("WbemScripting.SWbemLocator")
+	if err != nil {
+		return fmt.Errorf("create WMI locator: %w", err)
+	}
+	defer unknown.Release()
+
+	locator, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("WMI locator: %w", err)
+	}
+	defer locator.Release()
+
+	serviceRaw, err := oleutil.CallMethod(locator, "ConnectServer")
+	if err != nil {
+		return fmt.Errorf("connect to WMI: %w", err)
+	}
+	defer serviceRaw.Clear()
+	service := serviceRaw.ToIDispatch()
+
+	sourceRaw, err := oleutil.CallMethod(service, "ExecNotificationQuery", deviceChangeQuery)
+	if err != nil {
+		return fmt.Errorf("subscribe to device changes: %w", err)
+	}
+	defer sourceRaw.Clear()
+	source := sourceRaw.ToIDispatch()
+
+	known, err := e.snapshot()
+	if err != nil {
+		return err
+	}
+	// Keys of the drives seen without media: card readers, which are polled
+	readers := make(map[string]bool)
+	noteReaders(readers, known)
+	lastSnapshot := time.Now()
+
+	for ctx.Err() == nil {
+		eventRaw, err := oleutil.CallMethod(source, "NextEvent", watchPollMillis)
+		if err != nil {
+			if !isWMITimeout(err) {
+				return fmt.Errorf("wait for device change: %w", err)
+			}
+			if !hasReader(readers, known) || time.Since(lastSnapshot) < watchMediaInterval {
+				continue
+			}
+		} else {
+			eventRaw.Clear()
+
+			// One plug raises a burst of notifications (the USB device, the
+			// disk, its volumes), and volumes get their letters a moment later
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(watchSettleDelay):
+			}
+			for {
+				eventRaw, err := oleutil.CallMethod(source, "NextEvent", 0)
+				if err != nil {
+					break
+				}
+				eventRaw.Clear()
+			}
+		}
+
+		current, err := e.snapshot()
+		lastSnapshot = time.Now()
+		if err != nil {
+			continue // Enumeration can fail while a drive is half-attached
+		}
+		now := time.Now()
+		for _, d := range diffDevices(current, known) {
+			events <- Event{Type: EventArrival, Time: now, Port: ParsePortNumber(d.LocationInfo), Device: d}
+		}
+		for _, d := range diffDevices(known, current) {
+			events <- Event{Type: EventRemoval, Time: now, Port: ParsePortNumber(d.LocationInfo), Device: d}
+		}
+		inserted, removed := diffMedia(current, known)
+		for _, d := range inserted {
+			events <- Event{Type: EventMediaArrival, Time: now, Port: ParsePortNumber(d.LocationInfo), Device: d}
+		}
+		for _, d := range removed {
+			events <- Event{Type: EventMediaRemoval, Time: now, Port: ParsePortNumber(d.LocationInfo), Device: d}
+		}
+		noteReaders(readers, current)
+		known = current
+	}
+	return nil
+}
+
+// snapshot enumerates the drives, bypassing the cache, keyed by PnP
+// instance ID: unlike disk numbers, it doesn't shift as other drives come
+// and go.
+func (e *Enumerator) snapshot() (map[string]Device, error) {
+	devices, err := e.listDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate USB devices: %w", err)
+	}
+	snapshot := make(map[string]Device, len(devices))
+	for _, d := range devices {
+		key := d.PNPDeviceID
+		if key == "" {
+			key = strconv.Itoa(d.DiskNumber)
+		}
+		snapshot[key] = d
+	}
+	return snapshot, nil
+}
+
+// diffDevices returns the devices in a that aren't in b, ordered by disk
+// number.
+func diffDevices(a, b map[string]Device) []Device {
+	var diff []Device
+	for key, d := range a {
+		if _, ok := b[key]; !ok {
+			diff = append(diff, d)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].DiskNumber < diff[j].DiskNumber })
+	return diff
+}
+
+// diffMedia returns the devices in both snapshots that got media (inserted)
+// and that lost it (removed), ordered by disk number. A removed card is
+// described as it was last seen.
+func diffMedia(current, known map[string]Device) (inserted, removed []Device) {
+	for key, d := range current {
+		prev, ok := known[key]
+		if !ok || prev.HasMedia() == d.HasMedia() {
+			continue
+		}
+		if d.HasMedia() {
+			inserted = append(inserted, d)
+		} else {
+			removed = append(removed, prev)
+		}
+	}
+	sort.Slice(inserted, func(i, j int) bool { return inserted[i].DiskNumber < inserted[j].DiskNumber })
+	sort.Slice(removed, func(i, j int) bool { return removed[i].DiskNumber < removed[j].DiskNumber })
+	return inserted, removed
+}
+
+// noteReaders adds the drives without media in a snapshot to readers.
+func noteReaders(readers map[string]bool, snapshot map[string]Device) {
+	for key, d := range snapshot {
+		if !d.HasMedia() {
+			readers[key] = true
+		}
+	}
+}
+
+// hasReader reports whether any drive in a snapshot is a known reader.
+func hasReader(readers map[string]bool, snapshot map[string]Device) bool {
+	for key := range snapshot {
+		if readers[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// isWMITimeout reports whether err is NextEvent giving up after its timeout.
+func isWMITimeout(err error) bool {
+	var oleErr *ole.OleError
+	if !errors.As(err, &oleErr) {
+		return false
+	}
+	info, ok := oleErr.SubError().(ole.EXCEPINFO)
+	return ok && info.SCODE() == wbemErrTimedOut
+}